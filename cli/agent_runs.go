@@ -0,0 +1,290 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"q/db"
+	"q/llm"
+	"q/tools"
+	"q/util"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// agentRunStale is how long a run can go without an update before it is
+// taken to have died with its process. Agents save after every round, and
+// a round waits for the model and its tools for a few minutes at most.
+const agentRunStale = 15 * time.Minute
+
+var (
+	agentsAllFlag   bool
+	agentsLimitFlag int
+	agentsFullFlag  bool
+)
+
+var agentsCmd = &cobra.Command{
+	Use:   "agents",
+	Short: "Review and rerun sub-agents' past runs",
+}
+
+var agentsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List sub-agent runs in this project, newest first",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var paths []string
+			if !agentsAllFlag {
+				cwd, _ := os.Getwd()
+				paths = []string{db.ProjectKey(cwd)}
+			}
+			runs, err := database.AgentRuns(paths, agentsLimitFlag)
+			if err != nil {
+				return err
+			}
+			if len(runs) == 0 {
+				fmt.Println("No sub-agent runs recorded yet. Agents are spawned by the model with spawn_agent.")
+				return nil
+			}
+
+			width := util.GetTermSafeMaxWidth()
+			for _, r := range runs {
+				status := agentRunStatus(r)
+				line := fmt.Sprintf("#%-4d %s  %s %-11s %s (%s on %s)", r.ID, r.StartedAt.Local().Format("2006-01-02 15:04"),
+					agentRunMark(status), status, agentRunDuration(r), r.Role, r.Model)
+				fmt.Println(truncateLine(line, width))
+				fmt.Println("      " + truncateLine(r.Task, width-6))
+				if agentsAllFlag && r.ProjectPath != "" {
+					fmt.Println("      " + watchDimStyle.Render(r.ProjectPath))
+				}
+			}
+			fmt.Println("\n" + watchDimStyle.Render("q agents show <id> for the result and transcript, q agents rerun <id> to run one again."))
+			return nil
+		})
+	},
+}
+
+var agentsShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a sub-agent run's result and transcript",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			run, err := findAgentRun(database, args[0])
+			if err != nil {
+				return err
+			}
+			printAgentRun(run)
+			return nil
+		})
+	},
+}
+
+var agentsRerunCmd = &cobra.Command{
+	Use:   "rerun <id>",
+	Short: "Run a sub-agent's task again",
+	Long: `Run the task of a past sub-agent run again, with the same role and tools, and
+the same model unless --model names another. Progress is shown as the agent
+works, and the new run is recorded like any other.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var run *db.AgentRun
+		withDB(func(database *db.DB) error {
+			var err error
+			run, err = findAgentRun(database, args[0])
+			return err
+		})
+		rerunAgent(run)
+	},
+}
+
+func init() {
+	agentsListCmd.Flags().BoolVarP(&agentsAllFlag, "all", "a", false, "Include runs from other projects")
+	agentsListCmd.Flags().IntVarP(&agentsLimitFlag, "limit", "n", 20, "Maximum number of runs to show")
+	agentsShowCmd.Flags().BoolVar(&agentsFullFlag, "full", false, "Show tool output in full")
+	agentsCmd.AddCommand(agentsListCmd, agentsShowCmd, agentsRerunCmd)
+	RootCmd.AddCommand(agentsCmd)
+}
+
+func findAgentRun(database *db.DB, arg string) (*db.AgentRun, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not an agent run ID; see q agents list", arg)
+	}
+	return database.GetAgentRun(id)
+}
+
+// agentRunStatus is r's status, with a run that stopped being updated
+// while running shown as interrupted. Queued runs are left alone, since
+// they wait for as long as the agents ahead of them take.
+func agentRunStatus(r db.AgentRun) string {
+	if r.Status == "running" && time.Since(r.UpdatedAt) > agentRunStale {
+		return "interrupted"
+	}
+	return r.Status
+}
+
+func agentRunMark(status string) string {
+	switch status {
+	case "completed":
+		return watchOKStyle.Render("✓")
+	case "running", "queued":
+		return watchWarnStyle.Render("…")
+	}
+	return watchFailStyle.Render("✗")
+}
+
+func agentRunDuration(r db.AgentRun) time.Duration {
+	end := time.Now()
+	if r.EndedAt != nil {
+		end = *r.EndedAt
+	} else if status := agentRunStatus(r); status != "running" && status != "queued" {
+		end = r.UpdatedAt
+	}
+	return end.Sub(r.StartedAt).Round(time.Second)
+}
+
+// agentTranscriptMessage is a message of an agent's transcript.
+type agentTranscriptMessage struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	ToolCalls []struct {
+		Function struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// printAgentRun prints run for q agents show: what it was asked, how it
+// went, and the conversation that got it there.
+func printAgentRun(run *db.AgentRun) {
+	status := agentRunStatus(*run)
+	fmt.Println(watchTitleStyle.Render(fmt.Sprintf("Agent run #%d", run.ID)) + " " + watchDimStyle.Render(run.AgentID))
+	fmt.Printf("Role:    %s\n", run.Role)
+	fmt.Printf("Model:   %s\n", run.Model)
+	if run.Tools != nil {
+		names := strings.Join(run.Tools, ", ")
+		if names == "" {
+			names = "none"
+		}
+		fmt.Printf("Tools:   %s\n", names)
+	}
+	fmt.Printf("Status:  %s %s\n", agentRunMark(status), status)
+	fmt.Printf("Started: %s, ran %s\n", run.StartedAt.Local().Format("2006-01-02 15:04:05"), agentRunDuration(*run))
+	fmt.Printf("Usage:   %s, %s\n", plural(run.Iterations, "round", "rounds"), plural(run.Tokens, "token", "tokens"))
+	if run.ProjectPath != "" {
+		fmt.Printf("Project: %s\n", run.ProjectPath)
+	}
+	fmt.Println("\n" + watchHeadStyle.Render("Task") + "\n" + run.Task)
+	if run.Error != "" {
+		fmt.Println("\n" + watchFailStyle.Render("Error") + "\n" + run.Error)
+	}
+	if run.Result != "" {
+		fmt.Println("\n" + watchHeadStyle.Render("Result") + "\n" + run.Result)
+	}
+
+	var transcript []agentTranscriptMessage
+	if err := json.Unmarshal([]byte(run.Transcript), &transcript); err != nil || len(transcript) == 0 {
+		return
+	}
+	fmt.Println("\n" + watchHeadStyle.Render("Transcript"))
+	for _, m := range transcript {
+		switch m.Role {
+		case "system", "user":
+			// The task, shown above.
+		case "assistant":
+			if content := strings.TrimSpace(m.Content); content != "" {
+				fmt.Println("\n" + content)
+			}
+			for _, tc := range m.ToolCalls {
+				fmt.Println(watchWarnStyle.Render("⚡ "+tc.Function.Name) + " " + watchDimStyle.Render(strings.Join(strings.Fields(tc.Function.Arguments), " ")))
+			}
+		case "tool":
+			output := strings.TrimRight(m.Content, "\n")
+			if !agentsFullFlag {
+				output = truncateLines(output, 10)
+			}
+			for _, line := range strings.Split(output, "\n") {
+				fmt.Println(watchDimStyle.Render("    " + line))
+			}
+		}
+	}
+}
+
+// truncateLines keeps the first n lines of s, saying how many were cut.
+func truncateLines(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) <= n {
+		return s
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n... %s more (--full to show)", plural(len(lines)-n, "line", "lines"))
+}
+
+// rerunAgent runs run's task again in a new agent, printing its progress,
+// and exits with an error status if it does not complete.
+func rerunAgent(run *db.AgentRun) {
+	modelConfig := loadModelConfig()
+	c := llm.NewLLMClient(modelConfig)
+	defer c.Close()
+	c.OpenMemory()
+
+	model := run.Model
+	if modelFlag != "" {
+		model = modelConfig.Name
+	}
+	id, err := tools.SpawnAgent(run.Task, run.Role, model, run.Tools, false)
+	if err != nil {
+		fmt.Println(watchFailStyle.Render(err.Error()))
+		c.Close()
+		os.Exit(1)
+	}
+	fmt.Println(watchDimStyle.Render(fmt.Sprintf("Rerunning #%d as %s (%s on %s). Press Ctrl+C to stop.", run.ID, id, run.Role, model)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	width := util.GetTermSafeMaxWidth()
+	finding := ""
+	for {
+		var e tools.AgentEvent
+		select {
+		case <-ctx.Done():
+			fmt.Println(watchFailStyle.Render("Stopped; the run is recorded as interrupted."))
+			return
+		case e = <-tools.AgentEvents():
+		}
+		if e.ID != id {
+			continue
+		}
+		if e.Done {
+			line := fmt.Sprintf("%s %s in %s", agentRunMark(e.Status), e.Status, time.Since(e.Started).Round(time.Second))
+			if e.RunID != 0 {
+				line += fmt.Sprintf(", recorded as #%d", e.RunID)
+			}
+			fmt.Println("\n" + line)
+			if e.Finding != "" {
+				fmt.Println("\n" + e.Finding)
+			}
+			if e.Status != "completed" {
+				c.Close()
+				os.Exit(1)
+			}
+			return
+		}
+		if e.Finding != "" && e.Finding != finding {
+			finding = e.Finding
+			fmt.Println(truncateLine(finding, width))
+		}
+		if e.Tool != "" {
+			line := fmt.Sprintf("  %d/%d ⚡ %s %s", e.Iteration, e.MaxIterations, e.Tool, strings.Join(strings.Fields(e.Args), " "))
+			fmt.Println(watchDimStyle.Render(truncateLine(line, width)))
+		}
+	}
+}
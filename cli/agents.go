@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"q/tools"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type agentEventMsg tools.AgentEvent
+
+// forwardAgentEvents passes sub-agents' progress on to the TUI.
+func forwardAgentEvents(p *tea.Program) {
+	for e := range tools.AgentEvents() {
+		p.Send(agentEventMsg(e))
+	}
+}
+
+// handleAgentEventMsg keeps the agents panel up to date. An agent leaves
+// the panel when it finishes, with a line saying how it went printed
+// above.
+func (m model) handleAgentEventMsg(msg agentEventMsg) (tea.Model, tea.Cmd) {
+	agents := make([]tools.AgentEvent, 0, len(m.agents))
+	found := false
+	for _, a := range m.agents {
+		if a.ID != msg.ID {
+			agents = append(agents, a)
+		} else if !msg.Done {
+			agents = append(agents, tools.AgentEvent(msg))
+			found = true
+		}
+	}
+	if !found && !msg.Done {
+		agents = append(agents, tools.AgentEvent(msg))
+	}
+	m.agents = agents
+
+	if !msg.Done {
+		return m, nil
+	}
+	mark := lipgloss.NewStyle().Foreground(lipgloss.Color("2")).Render("✓")
+	if msg.Status != "completed" {
+		mark = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("✗")
+	}
+	line := fmt.Sprintf("%s %s (%s) %s in %s", mark, msg.ID, msg.Role, msg.Status,
+		time.Since(msg.Started).Round(time.Second))
+	if msg.Finding != "" {
+		line += lipgloss.NewStyle().Faint(true).Render(": " + truncateLine(msg.Finding, max(m.maxWidth-lipgloss.Width(line)-2, 20)))
+	}
+	return m, tea.Printf("%s", line)
+}
+
+// renderAgents shows what each running sub-agent is doing.
+func (m model) renderAgents() string {
+	if len(m.agents) == 0 {
+		return ""
+	}
+	headStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("63")).Bold(true)
+	toolStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+	dimStyle := lipgloss.NewStyle().Faint(true)
+
+	var b strings.Builder
+	b.WriteString(headStyle.Render(fmt.Sprintf("Agents (%d)", len(m.agents))) + "\n")
+	for _, a := range m.agents {
+		line := fmt.Sprintf("  %s %s", a.ID, dimStyle.Render("("+a.Role+" on "+a.Model+")"))
+		if a.Iteration > 0 {
+			line += fmt.Sprintf(" %d/%d", a.Iteration, a.MaxIterations)
+		}
+		switch {
+		case a.Tool != "":
+			activity := "⚡ " + a.Tool
+			if args := strings.Join(strings.Fields(a.Args), " "); args != "" && args != "{}" {
+				activity += " " + args
+			}
+			line += " " + toolStyle.Render(truncateLine(activity, max(m.maxWidth-lipgloss.Width(line)-1, 20)))
+		case a.QueuePosition > 0:
+			line += " " + dimStyle.Render(truncateLine(fmt.Sprintf("queued #%d: %s", a.QueuePosition, a.Task), max(m.maxWidth-lipgloss.Width(line)-1, 20)))
+		case a.Iteration == 0:
+			line += " " + dimStyle.Render(truncateLine(a.Task, max(m.maxWidth-lipgloss.Width(line)-1, 20)))
+		default:
+			line += " " + dimStyle.Render("thinking")
+		}
+		b.WriteString(line + "\n")
+		if a.Finding != "" {
+			b.WriteString(dimStyle.Render("    "+truncateLine(a.Finding, max(m.maxWidth-4, 20))) + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"q/tools"
+	"q/util"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type approvalRequestMsg struct {
+	tool   string
+	action string
+	reply  chan bool
+}
+
+func (m model) handleApprovalRequestMsg(msg approvalRequestMsg) (tea.Model, tea.Cmd) {
+	m.approval = &msg
+	return m, nil
+}
+
+func (m model) handleApprovalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	approved := msg.Type == tea.KeyRunes && strings.EqualFold(string(msg.Runes), "y")
+	m.approval.reply <- approved
+	m.approval = nil
+	return m, nil
+}
+
+func (m model) renderApprovalPrompt() string {
+	warnStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true)
+	actionStyle := lipgloss.NewStyle().Faint(true).Width(m.maxWidth).PaddingLeft(2)
+	return fmt.Sprintf("%s\n%s\n%s",
+		warnStyle.Render(fmt.Sprintf("Allow %s?", m.approval.tool)),
+		actionStyle.Render(m.approval.action),
+		"(y/N)")
+}
+
+func approvalHandler(p *tea.Program) func(tool, action string) bool {
+	return func(tool, action string) bool {
+		reply := make(chan bool)
+		p.Send(approvalRequestMsg{tool: tool, action: action, reply: reply})
+		return <-reply
+	}
+}
+
+// ttyApprovalHandler confirms on the controlling terminal for runs without
+// the TUI. Actions are denied when no terminal is available.
+func ttyApprovalHandler(tool, action string) bool {
+	answer, err := util.PromptTTY(fmt.Sprintf("Allow %s: %s? (y/N) ", tool, action))
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+}
+
+type inputReply struct {
+	value string
+	ok    bool
+}
+
+type inputRequestMsg struct {
+	prompt string
+	secret bool
+	reply  chan inputReply
+}
+
+func (m model) handleInputRequestMsg(msg inputRequestMsg) (tea.Model, tea.Cmd) {
+	m.input = &msg
+	m.inputField = textinput.New()
+	m.inputField.Width = m.maxWidth
+	if msg.secret {
+		m.inputField.EchoMode = textinput.EchoPassword
+		m.inputField.EchoCharacter = '•'
+	}
+	m.inputField.Focus()
+	return m, textinput.Blink
+}
+
+func (m model) handleInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.input.reply <- inputReply{value: m.inputField.Value(), ok: true}
+		m.input = nil
+		return m, nil
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.input.reply <- inputReply{}
+		m.input = nil
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.inputField, cmd = m.inputField.Update(msg)
+	return m, cmd
+}
+
+func (m model) renderInputPrompt() string {
+	promptStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true)
+	return fmt.Sprintf("%s\n%s\n%s",
+		promptStyle.Render(m.input.prompt),
+		m.inputField.View(),
+		lipgloss.NewStyle().Faint(true).Render("(Enter to submit, Esc to cancel)"))
+}
+
+func inputHandler(p *tea.Program) func(prompt string, secret bool) (string, bool) {
+	return func(prompt string, secret bool) (string, bool) {
+		reply := make(chan inputReply)
+		p.Send(inputRequestMsg{prompt: prompt, secret: secret, reply: reply})
+		r := <-reply
+		return r.value, r.ok
+	}
+}
+
+// ttyInputHandler reads the value from the controlling terminal for runs
+// without the TUI.
+func ttyInputHandler(prompt string, secret bool) (string, bool) {
+	read := util.PromptTTY
+	if secret {
+		read = util.PromptPasswordTTY
+	}
+	value, err := read(prompt + " ")
+	return value, err == nil
+}
+
+type questionRequestMsg struct {
+	question tools.Question
+	reply    chan inputReply
+}
+
+// questionExpiredMsg takes down a question ask_user has stopped waiting
+// for.
+type questionExpiredMsg struct {
+	reply chan inputReply
+}
+
+func (m model) handleQuestionRequestMsg(msg questionRequestMsg) (tea.Model, tea.Cmd) {
+	m.question = &msg
+	m.inputField = textinput.New()
+	m.inputField.Width = m.maxWidth
+	m.inputField.Placeholder = msg.question.Default
+	m.inputField.Focus()
+	return m, textinput.Blink
+}
+
+func (m model) handleQuestionExpiredMsg(msg questionExpiredMsg) (tea.Model, tea.Cmd) {
+	if m.question == nil || m.question.reply != msg.reply {
+		return m, nil
+	}
+	q := m.question.question
+	m.question = nil
+	line := "No answer in time"
+	if q.Default != "" {
+		line += "; went with " + q.Default
+	}
+	return m, tea.Printf("%s", lipgloss.NewStyle().Faint(true).Render(fmt.Sprintf("? %s\n  %s", q.Text, line)))
+}
+
+// handleQuestionKey answers the question on Enter, a number choosing that
+// option and an empty answer the default, and declines it on Esc.
+func (m model) handleQuestionKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	q := m.question.question
+	switch msg.Type {
+	case tea.KeyEnter:
+		answer := strings.TrimSpace(m.inputField.Value())
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(q.Options) {
+			answer = q.Options[n-1]
+		}
+		m.question.reply <- inputReply{value: answer, ok: true}
+		m.question = nil
+		if answer == "" {
+			answer = q.Default
+		}
+		return m, tea.Printf("%s", lipgloss.NewStyle().Faint(true).Render(fmt.Sprintf("? %s\n  %s", q.Text, answer)))
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.question.reply <- inputReply{}
+		m.question = nil
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.inputField, cmd = m.inputField.Update(msg)
+	return m, cmd
+}
+
+func (m model) renderQuestionPrompt() string {
+	q := m.question.question
+	promptStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true)
+	dimStyle := lipgloss.NewStyle().Faint(true)
+	asker := "The assistant asks"
+	if q.From != "" {
+		asker = q.From + " asks"
+	}
+
+	var b strings.Builder
+	b.WriteString(promptStyle.Render(asker+":") + "\n")
+	b.WriteString(lipgloss.NewStyle().Width(m.maxWidth).PaddingLeft(2).Render(q.Text) + "\n")
+	for i, option := range q.Options {
+		b.WriteString(fmt.Sprintf("  %d) %s\n", i+1, option))
+	}
+	b.WriteString(m.inputField.View() + "\n")
+	hint := "(Enter to answer"
+	if len(q.Options) > 0 {
+		hint += ", or a number for an option"
+	}
+	hint += "; Esc not to"
+	if q.Default != "" {
+		hint += fmt.Sprintf("; %s is assumed at %s", q.Default, q.Deadline.Format("15:04:05"))
+	} else {
+		hint += fmt.Sprintf("; waits until %s", q.Deadline.Format("15:04:05"))
+	}
+	b.WriteString(dimStyle.Render(hint + ")"))
+	return b.String()
+}
+
+func questionHandler(p *tea.Program) func(ctx context.Context, q tools.Question) (string, bool) {
+	return func(ctx context.Context, q tools.Question) (string, bool) {
+		// Buffered, so that answering just as the question expires does
+		// not block the TUI.
+		reply := make(chan inputReply, 1)
+		p.Send(questionRequestMsg{question: q, reply: reply})
+		select {
+		case r := <-reply:
+			return r.value, r.ok
+		case <-ctx.Done():
+			p.Send(questionExpiredMsg{reply: reply})
+			return "", false
+		}
+	}
+}
@@ -2,17 +2,20 @@ package cli
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/signal"
 	"q/config"
+	"q/db"
 	"q/llm"
+	"q/tools"
 	. "q/types"
 	"q/util"
 	"runtime"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -32,8 +35,12 @@ const (
 )
 
 type model struct {
-	client           *llm.LLMClient
-	modelName        string
+	client    *llm.LLMClient
+	modelName string
+	profile   string
+	// configModTime is when the config file had last changed when the
+	// session read it.
+	configModTime    time.Time
 	markdownRenderer *glamour.TermRenderer
 
 	textInput textinput.Model
@@ -45,6 +52,15 @@ type model struct {
 	latestCommandIsCode      bool
 	formattedPartialResponse string
 	toolActivity             string
+	approval                 *approvalRequestMsg
+	input                    *inputRequestMsg
+	question                 *questionRequestMsg
+	inputField               textinput.Model
+	queryCtx                 context.Context
+	cancelQuery              context.CancelFunc
+	usage                    db.Usage
+	// agents are the sub-agents still running, as last reported.
+	agents []tools.AgentEvent
 
 	maxWidth    int
 	runWithArgs bool
@@ -62,17 +78,25 @@ type partialResponseMsg struct {
 }
 
 type toolActivityMsg struct {
-	tool string
-	args string
+	tool   string
+	args   string
+	status string
 }
 
-func makeQuery(client *llm.LLMClient, query string) tea.Cmd {
+func makeQuery(ctx context.Context, client *llm.LLMClient, query string) tea.Cmd {
 	return func() tea.Msg {
-		response, err := client.Query(query)
+		response, err := client.QueryContext(ctx, query)
 		return responseMsg{response: response, err: err}
 	}
 }
 
+// startQuery gives the next query its own context so Ctrl+C can cancel it
+// without leaving the session.
+func (m *model) startQuery() tea.Cmd {
+	m.queryCtx, m.cancelQuery = context.WithCancel(context.Background())
+	return makeQuery(m.queryCtx, m.client, m.query)
+}
+
 func (m model) handleKeyEnter() (tea.Model, tea.Cmd) {
 	if m.state != ReceivingInput {
 		return m, nil
@@ -93,12 +117,18 @@ func (m model) handleKeyEnter() (tea.Model, tea.Cmd) {
 	}
 
 	m.textInput.SetValue("")
+	if name, args, ok := parseSlashCommand(v); ok {
+		return m.handleSlashCommand(name, args)
+	}
 	m.query = v
 	m.state = Loading
 	m.toolActivity = ""
 	placeholderStyle := lipgloss.NewStyle().Faint(true).Width(m.maxWidth)
 	message := placeholderStyle.Render(fmt.Sprintf("> %s", v))
-	return m, tea.Sequence(tea.Printf("%s", message), tea.Batch(m.spinner.Tick, makeQuery(m.client, m.query)))
+	if notice := m.reloadConfig(); notice != "" {
+		message = notice + "\n" + message
+	}
+	return m, tea.Sequence(tea.Printf("%s", message), tea.Batch(m.spinner.Tick, m.startQuery()))
 }
 
 func (m model) formatResponse(response string, isCode bool) (string, error) {
@@ -145,6 +175,24 @@ func (m model) getConnectionError(err error) string {
 func (m model) handleResponseMsg(msg responseMsg) (tea.Model, tea.Cmd) {
 	m.formattedPartialResponse = ""
 	m.toolActivity = ""
+	m.usage = m.client.Usage()
+	if m.cancelQuery != nil {
+		m.cancelQuery()
+		m.cancelQuery = nil
+	}
+
+	if errors.Is(msg.err, context.Canceled) {
+		m.state = ReceivingInput
+		message := lipgloss.NewStyle().Faint(true).Render("Cancelled.")
+		return m, tea.Sequence(tea.Printf("%s", message), textinput.Blink)
+	}
+
+	var blocked *tools.BlockedError
+	if errors.As(msg.err, &blocked) {
+		m.state = ReceivingInput
+		message := fmt.Sprintf("\n  %s %s\n", lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("Blocked by hook:"), blocked.Reason)
+		return m, tea.Sequence(tea.Printf("%s", message), textinput.Blink)
+	}
 
 	if msg.err != nil {
 		m.state = ReceivingInput
@@ -179,13 +227,17 @@ func (m model) handlePartialResponseMsg(msg partialResponseMsg) (tea.Model, tea.
 
 func (m model) handleToolActivityMsg(msg toolActivityMsg) (tea.Model, tea.Cmd) {
 	toolStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
-	m.toolActivity = toolStyle.Render(fmt.Sprintf("⚡ %s", msg.tool))
+	activity := fmt.Sprintf("⚡ %s", msg.tool)
+	if msg.status != "" {
+		activity += " " + msg.status
+	}
+	m.toolActivity = toolStyle.Render(activity)
 	return m, nil
 }
 
 func (m model) Init() tea.Cmd {
 	if m.runWithArgs {
-		return tea.Batch(m.spinner.Tick, makeQuery(m.client, m.query))
+		return tea.Batch(m.spinner.Tick, makeQuery(m.queryCtx, m.client, m.query))
 	}
 	return textinput.Blink
 }
@@ -195,8 +247,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.approval != nil {
+			return m.handleApprovalKey(msg)
+		}
+		if m.input != nil {
+			return m.handleInputKey(msg)
+		}
+		if m.question != nil {
+			return m.handleQuestionKey(msg)
+		}
 		switch msg.Type {
-		case tea.KeyCtrlC, tea.KeyEsc, tea.KeyCtrlD:
+		case tea.KeyCtrlC, tea.KeyEsc:
+			if m.state != ReceivingInput && m.cancelQuery != nil {
+				m.cancelQuery()
+				return m, nil
+			}
+			return m, tea.Quit
+		case tea.KeyCtrlD:
 			return m, tea.Quit
 		case tea.KeyEnter:
 			return m.handleKeyEnter()
@@ -211,6 +278,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case toolActivityMsg:
 		return m.handleToolActivityMsg(msg)
 
+	case approvalRequestMsg:
+		return m.handleApprovalRequestMsg(msg)
+
+	case inputRequestMsg:
+		return m.handleInputRequestMsg(msg)
+
+	case questionRequestMsg:
+		return m.handleQuestionRequestMsg(msg)
+
+	case questionExpiredMsg:
+		return m.handleQuestionExpiredMsg(msg)
+
+	case agentEventMsg:
+		return m.handleAgentEventMsg(msg)
+
 	case error:
 		m.err = msg
 		return m, nil
@@ -233,11 +315,28 @@ func (m model) renderStatusBar() string {
 		Foreground(lipgloss.Color("230")).
 		Padding(0, 1)
 
-	return modelStyle.Render(m.modelName)
+	bar := modelStyle.Render(m.modelName)
+	if m.profile != "" {
+		bar += lipgloss.NewStyle().Faint(true).Render(" profile " + m.profile)
+	}
+	if m.usage.Tokens() > 0 {
+		bar += lipgloss.NewStyle().Faint(true).Render(" " + formatUsage(m.usage))
+	}
+	return bar
 }
 
 func (m model) View() string {
-	statusBar := m.renderStatusBar()
+	statusBar := m.renderAgents() + m.renderStatusBar()
+
+	if m.approval != nil {
+		return statusBar + "\n" + m.renderApprovalPrompt()
+	}
+	if m.input != nil {
+		return statusBar + "\n" + m.renderInputPrompt()
+	}
+	if m.question != nil {
+		return statusBar + "\n" + m.renderQuestionPrompt()
+	}
 
 	switch m.state {
 	case Loading:
@@ -290,6 +389,7 @@ func initialModel(prompt string, client *llm.LLMClient, modelName string) model
 		m.runWithArgs = true
 		m.state = Loading
 		m.query = prompt
+		m.queryCtx, m.cancelQuery = context.WithCancel(context.Background())
 	}
 	return m
 }
@@ -311,6 +411,9 @@ func printAPIKeyNotSetMessage(modelConfig ModelConfig) {
 
 	styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
 	msg1 := styleRed.Render(fmt.Sprintf("%s not set.", envVar))
+	if modelConfig.AuthSource == util.AuthSourceKeychain {
+		msg1 = styleRed.Render(fmt.Sprintf("%s not set, and no key for it in the OS keychain.", envVar))
+	}
 
 	var helpURL string
 	switch {
@@ -330,7 +433,7 @@ Get your API key from %s
 Set it:
 %s
 
-Add to %s for persistence.`, helpURL, shellSyntax, profileScriptName)
+Add to %s for persistence, or store it in the OS keychain with `+"`q config`"+` → Models → %s → Store API Key.`, helpURL, shellSyntax, profileScriptName, modelConfig.Name)
 
 	msg2, _ := r.Render(messageString)
 	fmt.Printf("\n  %v%v\n", msg1, msg2)
@@ -344,7 +447,13 @@ func streamHandler(p *tea.Program) func(content string, err error) {
 
 func toolHandler(p *tea.Program) func(tool string, args string) {
 	return func(tool string, args string) {
-		p.Send(toolActivityMsg{tool, args})
+		p.Send(toolActivityMsg{tool: tool, args: args})
+	}
+}
+
+func progressHandler(p *tea.Program) func(tool, status string) {
+	return func(tool, status string) {
+		p.Send(toolActivityMsg{tool: tool, status: status})
 	}
 }
 
@@ -353,49 +462,76 @@ func getModelConfig(appConfig config.AppConfig, requestedModel string) (ModelCon
 		return ModelConfig{}, fmt.Errorf("no models configured")
 	}
 
-	targetModel := appConfig.Preferences.DefaultModel
 	if requestedModel != "" {
-		targetModel = requestedModel
+		return config.ResolveModel(appConfig, requestedModel)
 	}
-
-	for _, model := range appConfig.Models {
-		if model.Name == targetModel {
+	if name := appConfig.Preferences.DefaultModel; name != "" {
+		if model, err := config.ResolveModel(appConfig, name); err == nil {
 			return model, nil
 		}
 	}
+	return appConfig.Models[0], nil
+}
 
-	if requestedModel != "" {
-		var available []string
-		for _, m := range appConfig.Models {
-			available = append(available, m.Name)
-		}
-		return ModelConfig{}, fmt.Errorf("model '%s' not found. Available: %s", requestedModel, strings.Join(available, ", "))
+// applyToolPreferences configures tool timeouts, loads plugins, selects
+// which tool categories are offered to the model, exiting on an unknown
+// category, and sets how long history is kept.
+func applyToolPreferences(appConfig config.AppConfig) {
+	switch scope := appConfig.Preferences.Memory.Scope; scope {
+	case "", llm.ScopeProject, llm.ScopeRepo, llm.ScopeParent, llm.ScopeGlobal:
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: unknown preferences.memory.scope %q; using project\n", scope)
+	}
+	for _, err := range tools.LoadPlugins(tools.PluginDir()) {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+	}
+	if err := setPreferences(appConfig); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+}
 
-	return appConfig.Models[0], nil
+// setPreferences installs appConfig's preferences. An unknown tool
+// category fails before anything is changed.
+func setPreferences(appConfig config.AppConfig) error {
+	prefs := appConfig.Preferences
+	if err := tools.SetToolCategories(prefs.ToolCategories, tools.ParseCategories(toolsFlag)); err != nil {
+		return err
+	}
+	llm.SetHistoryRetention(prefs.MaxHistoryDays)
+	llm.SetDBBackups(prefs.DBBackups)
+	llm.SetMemoryLoading(prefs.Memory)
+	llm.SetKnowledgeInjection(prefs.EnableKnowledge)
+	llm.SetEmbeddings(prefs.Embeddings)
+	tools.SetToolTimeouts(prefs.DefaultTimeout, prefs.ToolTimeouts)
+	tools.SetWatchPreferences(prefs.Watch)
+	tools.SetAgentPreferences(prefs.Agents, appConfig.Models)
+	tools.SetHooks(prefs.Hooks)
+	tools.SetSummarizeDocs(prefs.SummarizeDocs)
+	return nil
 }
 
-func readStdin() string {
-	stat, _ := os.Stdin.Stat()
-	if (stat.Mode() & os.ModeCharDevice) == 0 {
-		reader := bufio.NewReader(os.Stdin)
-		var builder strings.Builder
-		for {
-			b, err := reader.ReadByte()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				break
-			}
-			builder.WriteByte(b)
-		}
-		return builder.String()
+// resolveAPIKey replaces the names of the environment variables in
+// modelConfig's Auth and OrgID with their values, reporting false if the
+// API key is not set.
+func resolveAPIKey(modelConfig ModelConfig) (ModelConfig, bool) {
+	if modelConfig.Auth == "" {
+		return modelConfig, true
 	}
-	return ""
+	key := util.APIKey(modelConfig.Auth, modelConfig.AuthSource)
+	if key == "" {
+		return modelConfig, false
+	}
+	modelConfig.Auth = key
+	if modelConfig.OrgID != "" {
+		modelConfig.OrgID = os.Getenv(modelConfig.OrgID)
+	}
+	return modelConfig, true
 }
 
-func runWatchMode() {
+// loadModelConfig resolves the selected model and its API key, exiting with
+// the usual help messages when either is missing.
+func loadModelConfig() ModelConfig {
 	appConfig, err := config.LoadAppConfig()
 	if err != nil {
 		config.PrintConfigErrorMessage(err)
@@ -407,77 +543,71 @@ func runWatchMode() {
 		config.PrintConfigErrorMessage(err)
 		os.Exit(1)
 	}
+	applyToolPreferences(appConfig)
 
-	if modelConfig.Auth != "" {
-		envKey := modelConfig.Auth
-		val := os.Getenv(envKey)
-		if val == "" {
-			printAPIKeyNotSetMessage(modelConfig)
-			os.Exit(1)
-		}
-		modelConfig.Auth = val
-	}
-
-	c := llm.NewLLMClient(modelConfig)
-	defer c.Close()
-
-	styleGreen := lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
-	styleYellow := lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
-	styleDim := lipgloss.NewStyle().Faint(true)
-
-	fmt.Println(styleGreen.Render("Shell-AI Watch Mode"))
-	fmt.Println(styleDim.Render("==================="))
-	fmt.Println()
-	fmt.Println("Monitoring for errors and auto-repairing...")
-	fmt.Println(styleDim.Render("Press Ctrl+C to stop"))
-	fmt.Println()
-
-	response, err := c.Query("Start watching this project for errors. Use start_watch to begin monitoring. Detect the build command automatically.")
-	if err != nil {
-		fmt.Printf("Error starting watch: %v\n", err)
+	modelConfig, ok := resolveAPIKey(modelConfig)
+	if !ok {
+		printAPIKeyNotSetMessage(modelConfig)
 		os.Exit(1)
 	}
+	return modelConfig
+}
 
-	fmt.Println(styleYellow.Render("Watch started:"))
-	fmt.Println(response)
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+// initToolModel points the tools that call the model themselves, such as
+// commit message generation, at modelConfig, for commands that hold no
+// conversation of their own.
+func initToolModel(modelConfig ModelConfig) {
+	modelName := modelConfig.ModelName
+	if modelName == "" {
+		modelName = modelConfig.Name
+	}
+	tools.InitAgentConfig(modelConfig.Endpoint, modelName, modelConfig.Auth, modelConfig.AuthHeader)
+}
 
-	fmt.Println()
-	fmt.Println(styleDim.Render("Stopping watch mode..."))
-	c.Query("Stop watching. Use stop_watch.")
-	fmt.Println(styleGreen.Render("Watch mode stopped."))
+func readStdin() string {
+	stat, _ := os.Stdin.Stat()
+	if (stat.Mode() & os.ModeCharDevice) == 0 {
+		reader := bufio.NewReader(os.Stdin)
+		var builder strings.Builder
+		for {
+			b, err := reader.ReadByte()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				break
+			}
+			builder.WriteByte(b)
+		}
+		return builder.String()
+	}
+	return ""
 }
 
 func runQProgram(prompt string) {
+	util.Startup.Mark("cli start")
 	appConfig, err := config.LoadAppConfig()
 	if err != nil {
 		config.PrintConfigErrorMessage(err)
 		os.Exit(1)
 	}
+	util.Startup.Mark("config loaded")
 
 	modelConfig, err := getModelConfig(appConfig, modelFlag)
 	if err != nil {
 		config.PrintConfigErrorMessage(err)
 		os.Exit(1)
 	}
+	applyToolPreferences(appConfig)
 
-	if modelConfig.Auth != "" {
-		envKey := modelConfig.Auth
-		val := os.Getenv(envKey)
-		if val == "" {
-			printAPIKeyNotSetMessage(modelConfig)
-			os.Exit(1)
-		}
-		modelConfig.Auth = val
-		if modelConfig.OrgID != "" {
-			modelConfig.OrgID = os.Getenv(modelConfig.OrgID)
-		}
+	modelConfig, ok := resolveAPIKey(modelConfig)
+	if !ok {
+		printAPIKeyNotSetMessage(modelConfig)
+		os.Exit(1)
 	}
 
 	stdinData := readStdin()
+	util.Startup.Mark("stdin read")
 	if stdinData != "" {
 		if prompt != "" {
 			prompt = fmt.Sprintf("Here's some input:\n```\n%s\n```\n\n%s", stdinData, prompt)
@@ -486,10 +616,13 @@ func runQProgram(prompt string) {
 		}
 	}
 
-	config.SaveAppConfig(appConfig)
+	config.SaveConfigFile()
+	// Read after saving, so the save does not look like an edit.
+	configModTime := config.ModTime()
 
 	c := llm.NewLLMClient(modelConfig)
 	defer c.Close()
+	util.Startup.Mark("client ready")
 
 	// Detect if running in interactive mode (no args and stdin is a terminal)
 	stat, _ := os.Stdin.Stat()
@@ -498,19 +631,35 @@ func runQProgram(prompt string) {
 
 	if isInteractive {
 		// Interactive mode: use bubbletea TUI
-		p := tea.NewProgram(initialModel(prompt, c, modelConfig.Name))
+		m := initialModel(prompt, c, modelConfig.Name)
+		m.profile = appConfig.ActiveProfile
+		m.configModTime = configModTime
+		p := tea.NewProgram(m)
 		c.StreamCallback = streamHandler(p)
 		c.ToolCallback = toolHandler(p)
+		tools.SetApprovalHandler(approvalHandler(p))
+		tools.SetInputHandler(inputHandler(p))
+		tools.SetQuestionHandler(questionHandler(p))
+		tools.SetProgressHandler(progressHandler(p))
+		go forwardAgentEvents(p)
+		util.Startup.Mark("tui ready")
+		util.Startup.Report(os.Stderr)
 
 		if _, err := p.Run(); err != nil {
 			fmt.Printf("Error: %v\n", err)
+			// os.Exit skips the deferred Close, which flushes queued writes.
+			c.Close()
 			os.Exit(1)
 		}
 	} else {
 		// Non-interactive mode: direct execution without TUI
+		tools.SetApprovalHandler(ttyApprovalHandler)
+		tools.SetInputHandler(ttyInputHandler)
+		util.Startup.Report(os.Stderr)
 		response, err := c.Query(prompt)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
+			c.Close()
 			os.Exit(1)
 		}
 		fmt.Println(response)
@@ -518,13 +667,18 @@ func runQProgram(prompt string) {
 }
 
 var modelFlag string
+var toolsFlag string
 var watchFlag bool
+var profileStartupFlag bool
+var configProfileFlag string
 
 var RootCmd = &cobra.Command{
 	Use:   "q [request]",
 	Short: "AI terminal assistant",
 	Long:  `Shell-AI: Ask questions, run commands, read/write files - all through natural language.`,
+	Args:  cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		util.Startup.Enabled = profileStartupFlag
 		prompt := strings.Join(args, " ")
 		if len(args) > 0 && args[0] == "config" {
 			config.RunConfigProgram(args)
@@ -534,11 +688,21 @@ var RootCmd = &cobra.Command{
 			runWatchMode()
 			return
 		}
+		if voiceFlag {
+			runVoiceMode(prompt)
+			return
+		}
 		runQProgram(prompt)
 	},
 }
 
 func init() {
-	RootCmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Model to use (e.g., gpt-4o, claude-sonnet, ollama-qwen)")
+	RootCmd.PersistentFlags().StringVarP(&modelFlag, "model", "m", "", "Model or alias to use (e.g., gpt-4o, claude-sonnet, ollama-qwen); a unique prefix is enough")
+	RootCmd.PersistentFlags().StringVar(&toolsFlag, "tools", "", "Comma-separated tool categories to enable (e.g., files,git)")
+	RootCmd.PersistentFlags().StringVar(&configProfileFlag, "profile", "", "Config profile to use (e.g., work, offline; default: Q_PROFILE, then the config's profile)")
+	cobra.OnInitialize(func() { config.SetProfile(configProfileFlag) })
 	RootCmd.Flags().BoolVarP(&watchFlag, "watch", "w", false, "Start in self-healing watch mode")
+	RootCmd.Flags().BoolVar(&voiceFlag, "voice", false, "Ask by voice: record from the microphone and transcribe")
+	RootCmd.Flags().BoolVar(&speakFlag, "speak", false, "Speak the answer aloud (with --voice)")
+	RootCmd.Flags().BoolVar(&profileStartupFlag, "profile-startup", false, "Report where startup time is spent")
 }
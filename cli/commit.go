@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"q/tools"
+	"q/util"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var commitAllFlag bool
+var commitYesFlag bool
+
+var commitCmd = &cobra.Command{
+	Use:   "commit [files...]",
+	Short: "Stage files and commit with a generated conventional commit message",
+	Run: func(cmd *cobra.Command, args []string) {
+		runCommit(args)
+	},
+}
+
+func init() {
+	commitCmd.Flags().BoolVarP(&commitAllFlag, "all", "a", false, "Stage all changes, including untracked files")
+	commitCmd.Flags().BoolVarP(&commitYesFlag, "yes", "y", false, "Commit without asking for confirmation")
+	RootCmd.AddCommand(commitCmd)
+}
+
+func git(args ...string) (string, error) {
+	output, err := exec.Command("git", args...).CombinedOutput()
+	result := strings.TrimSpace(string(output))
+	if err != nil {
+		return result, fmt.Errorf("git %s: %s", args[0], result)
+	}
+	return result, nil
+}
+
+func editCommitMessage(message string) (string, error) {
+	f, err := os.CreateTemp("", "q-commit-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(message + "\n\n# Lines starting with '#' are ignored. Save and close to continue.\n")
+	f.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		cmd.Stdin = tty
+	}
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+func runCommit(files []string) {
+	styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	styleGreen := lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fail := func(err error) {
+		fmt.Println(styleRed.Render(err.Error()))
+		os.Exit(1)
+	}
+
+	if _, err := git("rev-parse", "--git-dir"); err != nil {
+		fail(fmt.Errorf("not a git repository"))
+	}
+
+	modelConfig := loadModelConfig()
+	initToolModel(modelConfig)
+
+	if commitAllFlag {
+		if _, err := git("add", "--all"); err != nil {
+			fail(err)
+		}
+	} else if len(files) > 0 {
+		if _, err := git(append([]string{"add", "--"}, files...)...); err != nil {
+			fail(err)
+		}
+	}
+
+	stat, err := git("diff", "--cached", "--stat")
+	if err != nil {
+		fail(err)
+	}
+	if stat == "" {
+		fail(fmt.Errorf("nothing staged; pass files, use --all, or git add first"))
+	}
+	diff, err := git("diff", "--cached")
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Println(styleDim.Render(stat))
+	fmt.Println()
+
+	var message string
+	for {
+		if message == "" {
+			fmt.Println(styleDim.Render(fmt.Sprintf("Generating commit message with %s...", modelConfig.Name)))
+			message, err = tools.GenerateCommitMessage(diff)
+			if err != nil {
+				fail(err)
+			}
+		}
+
+		fmt.Println()
+		fmt.Println(message)
+		fmt.Println()
+
+		if commitYesFlag {
+			break
+		}
+
+		answer, err := util.PromptTTY("Commit? [y]es / [e]dit / [r]egenerate / [n]o: ")
+		if err != nil {
+			fail(fmt.Errorf("no terminal for confirmation; rerun with --yes"))
+		}
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+		case "e", "edit":
+			edited, err := editCommitMessage(message)
+			if err != nil {
+				fail(err)
+			}
+			if edited == "" {
+				fail(fmt.Errorf("empty commit message, aborting"))
+			}
+			message = edited
+			continue
+		case "r", "regenerate":
+			message = ""
+			continue
+		default:
+			fmt.Println(styleDim.Render("Aborted. Changes remain staged."))
+			return
+		}
+		break
+	}
+
+	output, err := git("commit", "-m", message)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(styleGreen.Render(output))
+}
@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"q/config"
+	"q/db"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintain the memory database (~/.shell-ai/memory.db)",
+}
+
+var dbEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt stored messages, tool calls, titles and summaries",
+	Long: `Encrypt message content, tool call arguments and results, session titles
+and summaries, and pinned memories with AES-256-GCM. The key is the passphrase
+in $Q_DB_KEY, or the one stored in the OS keychain (macOS Keychain, or
+secret-tool on Linux). When neither is set, a random key is generated and saved
+to the keychain. Without the key the database cannot be opened, so keep a copy
+of it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			source, err := database.EncryptDatabase()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Memory database encrypted; the key is in %s.\n", source)
+			return nil
+		})
+	},
+}
+
+var dbDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Store the memory database in plaintext again",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			if err := database.DecryptDatabase(); err != nil {
+				return err
+			}
+			fmt.Println("Memory database decrypted.")
+			return nil
+		})
+	},
+}
+
+var dbRebuildIndexFlag bool
+
+var dbStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show database size, row counts and the largest sessions",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			stats, err := database.Stats()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Database:  %s\n", stats.Path)
+			fmt.Printf("Size:      %s", formatSize(stats.Size))
+			if stats.WALSize > 0 {
+				fmt.Printf(" (+ %s write-ahead log)", formatSize(stats.WALSize))
+			}
+			fmt.Println()
+			fmt.Printf("Free:      %s (%.0f%% fragmented", formatSize(stats.FreePages*stats.Size/max(stats.Pages, 1)), stats.Fragmentation()*100)
+			if stats.Fragmentation() > 0.2 {
+				fmt.Print("; run q db vacuum")
+			}
+			fmt.Println(")")
+			fmt.Printf("Search:    %s of full-text indexes\n", formatSize(stats.FTSBytes))
+			if stats.Encrypted {
+				fmt.Println("Encrypted: yes")
+			}
+
+			fmt.Println()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TABLE\tROWS\tSIZE")
+			for _, t := range stats.Tables {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", t.Name, t.Rows, formatSize(t.Bytes))
+			}
+			w.Flush()
+
+			if len(stats.LargestSessions) > 0 {
+				fmt.Println("\nLargest sessions:")
+				for _, s := range stats.LargestSessions {
+					title := s.Title
+					if title == "" {
+						title = "(untitled)"
+					}
+					fmt.Printf("  %s  %9s  %4d messages  %s\n", shortID(s.ID), formatSize(s.Bytes), s.Messages, title)
+				}
+				fmt.Println("Prune old history with q gc; save a session first with q export <id>.")
+			}
+			return nil
+		})
+	},
+}
+
+var dbVacuumCmd = &cobra.Command{
+	Use:   "vacuum",
+	Short: "Compact the database file",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			database.Checkpoint()
+			before, _ := database.Size()
+			if dbRebuildIndexFlag {
+				if err := database.RebuildSearchIndexes(); err != nil {
+					return err
+				}
+				fmt.Println("Rebuilt search indexes.")
+			}
+			if err := database.Vacuum(); err != nil {
+				return err
+			}
+			database.Checkpoint()
+			after, _ := database.Size()
+			fmt.Printf("Database: %s -> %s (reclaimed %s)\n", formatSize(before), formatSize(after), formatSize(max(before-after, 0)))
+			return nil
+		})
+	},
+}
+
+var dbVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the database for corruption",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			problems, err := database.Verify()
+			if err != nil {
+				return err
+			}
+			if len(problems) == 0 {
+				fmt.Println("Database is healthy.")
+				return nil
+			}
+			for _, p := range problems {
+				fmt.Println("  " + p)
+			}
+			return fmt.Errorf("found %d problems; restore a backup with q db restore, or export what can be read with q export", len(problems))
+		})
+	},
+}
+
+var dbBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the memory database to ~/.shell-ai/backups",
+	Long: `Write a compacted copy of the memory database to ~/.shell-ai/backups. A backup
+is also made automatically once a day; db_backups in the preferences sets how
+many are kept (default 7, -1 turns automatic backups off).`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		keep := db.DefaultBackups
+		if appConfig, err := config.LoadAppConfig(); err == nil && appConfig.Preferences.DBBackups != 0 {
+			keep = appConfig.Preferences.DBBackups
+		}
+		withDB(func(database *db.DB) error {
+			path, err := database.Backup()
+			if err != nil {
+				return err
+			}
+			if keep > 0 {
+				if err := db.PruneBackups(keep); err != nil {
+					return err
+				}
+			}
+			info, _ := os.Stat(path)
+			fmt.Printf("Backed up to %s (%s)\n", path, formatSize(info.Size()))
+			return nil
+		})
+	},
+}
+
+var dbRestoreYesFlag bool
+
+var dbRestoreCmd = &cobra.Command{
+	Use:   "restore [backup]",
+	Short: "Replace the memory database with a backup",
+	Long: `Replace the memory database with a backup: a file name from
+~/.shell-ai/backups, a path, or "latest". With no argument, list the backups.
+The current database is saved to the backups directory first.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+		fail := func(err error) {
+			fmt.Println(styleRed.Render(err.Error()))
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			backups, err := db.ListBackups()
+			if err != nil {
+				fail(err)
+			}
+			if len(backups) == 0 {
+				fmt.Println("No backups yet. Make one with: q db backup")
+				return
+			}
+			for _, b := range backups {
+				fmt.Printf("%s  %9s  %s\n", b.ModTime.Format("2006-01-02 15:04"), formatSize(b.Size), filepath.Base(b.Path))
+			}
+			fmt.Println("Restore one with: q db restore <name> (or latest)")
+			return
+		}
+
+		path, err := db.ResolveBackup(args[0])
+		if err != nil {
+			fail(err)
+		}
+		if !dbRestoreYesFlag {
+			fmt.Printf("Replace the memory database with %s? Conversations since then will be lost. (y/N): ", path)
+			response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			response = strings.ToLower(strings.TrimSpace(response))
+			if response != "y" && response != "yes" {
+				fmt.Println("Restore cancelled.")
+				return
+			}
+		}
+		saved, err := db.Restore(path)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println("Memory database restored from " + path + ".")
+		if saved != "" {
+			fmt.Println("The previous database was saved to " + saved + ".")
+		}
+	},
+}
+
+func init() {
+	dbVacuumCmd.Flags().BoolVar(&dbRebuildIndexFlag, "rebuild-index", false, "Also rebuild the full-text search indexes")
+	dbRestoreCmd.Flags().BoolVarP(&dbRestoreYesFlag, "yes", "y", false, "Do not ask for confirmation")
+	dbCmd.AddCommand(dbStatsCmd, dbVacuumCmd, dbVerifyCmd, dbBackupCmd, dbRestoreCmd, dbEncryptCmd, dbDecryptCmd)
+	RootCmd.AddCommand(dbCmd)
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"q/tools"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Manage the documentation get_docs looks commands up in",
+}
+
+var docsSyncTLDRCmd = &cobra.Command{
+	Use:   "sync-tldr [archive.zip]",
+	Short: "Download every tldr page for get_docs to read offline",
+	Long: `Download the tldr pages archive and unpack its English pages into
+~/.shell-ai/tldr. From then on get_docs reads tldr pages from there rather
+than fetching each from GitHub, so they work without a network. Run it again
+to pick up new pages.
+
+For a machine with no network, download the archive elsewhere and give its
+path:
+
+  q docs sync-tldr tldr.zip
+
+The archive is at ` + tools.TLDRArchiveURL + `.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		source := tools.TLDRArchiveURL
+		if len(args) == 1 {
+			source = args[0]
+		} else {
+			fmt.Println("Downloading " + source + "…")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		defer cancel()
+
+		pages, err := tools.SyncTLDR(ctx, source)
+		if err != nil {
+			fmt.Println(lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render(err.Error()))
+			os.Exit(1)
+		}
+		fmt.Printf("Saved %d tldr pages to %s.\n", pages, tools.TLDRDir())
+	},
+}
+
+func init() {
+	docsCmd.AddCommand(docsSyncTLDRCmd)
+	RootCmd.AddCommand(docsCmd)
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"q/db"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormatFlag  string
+	exportOutputFlag  string
+	importProjectFlag string
+	importReplaceFlag bool
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [session-id]",
+	Short: "Export a session as Markdown or JSON",
+	Long: `Export a full session: messages, context files and tags. The session ID may be
+shortened to any unique prefix; without one, the latest session for the
+current directory is exported. JSON exports can be loaded elsewhere with
+"q import".`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var session *db.Session
+			var err error
+			if len(args) == 1 {
+				session, err = database.FindSession(args[0])
+			} else {
+				cwd, _ := os.Getwd()
+				session, err = database.LatestSession(cwd)
+			}
+			if err != nil {
+				return err
+			}
+			export, err := database.ExportSession(session.ID)
+			if err != nil {
+				return err
+			}
+
+			var data []byte
+			switch exportFormatFlag {
+			case "json":
+				data, err = json.MarshalIndent(export, "", "  ")
+				if err != nil {
+					return err
+				}
+				data = append(data, '\n')
+			case "md", "markdown":
+				data = []byte(sessionMarkdown(export))
+			default:
+				return fmt.Errorf("unknown format %q (use md or json)", exportFormatFlag)
+			}
+
+			if exportOutputFlag == "" || exportOutputFlag == "-" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(exportOutputFlag, data, 0600); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Exported session %s (%d messages) to %s\n", export.ID, len(export.Messages), exportOutputFlag)
+			return nil
+		})
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: `Import a session exported with "q export --format json"`,
+	Long: `Import a JSON session export, keeping its ID, timestamps, context files and
+tags. Use "-" to read from stdin. Importing a session that already exists fails
+unless --replace is given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var data []byte
+			var err error
+			if args[0] == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return err
+			}
+
+			var export db.SessionExport
+			if err := json.Unmarshal(data, &export); err != nil {
+				return fmt.Errorf("not a JSON session export (Markdown exports cannot be imported): %w", err)
+			}
+			project := export.ProjectPath
+			if importProjectFlag != "" {
+				if project, err = filepath.Abs(importProjectFlag); err != nil {
+					return err
+				}
+			}
+			if err := database.ImportSession(&export, project, importReplaceFlag); err != nil {
+				return err
+			}
+			fmt.Printf("Imported session %s (%d messages) for %s\n", export.ID, len(export.Messages), project)
+			return nil
+		})
+	},
+}
+
+// sessionMarkdown renders an export as a readable transcript.
+func sessionMarkdown(e *db.SessionExport) string {
+	var b strings.Builder
+	title := e.Title
+	if title == "" {
+		title = "Session " + e.ID
+	}
+	b.WriteString("# " + title + "\n\n")
+	b.WriteString(fmt.Sprintf("- **Session:** `%s`\n", e.ID))
+	b.WriteString(fmt.Sprintf("- **Project:** `%s`\n", e.ProjectPath))
+	b.WriteString(fmt.Sprintf("- **Started:** %s\n", e.CreatedAt.Local().Format(time.RFC1123)))
+	b.WriteString(fmt.Sprintf("- **Last active:** %s\n", e.UpdatedAt.Local().Format(time.RFC1123)))
+	if len(e.Tags) > 0 {
+		b.WriteString("- **Tags:** " + strings.Join(e.Tags, ", ") + "\n")
+	}
+	if e.Summary != "" {
+		b.WriteString("\n## Summary\n\n" + e.Summary + "\n")
+	}
+	if len(e.ContextFiles) > 0 {
+		b.WriteString("\n## Context Files\n\n")
+		for _, f := range e.ContextFiles {
+			b.WriteString(fmt.Sprintf("- `%s`\n", f.FilePath))
+		}
+	}
+
+	calls := make(map[string][]db.ToolCall)
+	for _, tc := range e.ToolCalls {
+		calls[tc.MessageID] = append(calls[tc.MessageID], tc)
+	}
+
+	b.WriteString("\n## Conversation\n")
+	for _, m := range e.Messages {
+		role := m.Role
+		if role != "" {
+			role = strings.ToUpper(role[:1]) + role[1:]
+		}
+		b.WriteString(fmt.Sprintf("\n### %s · %s\n\n", role, m.CreatedAt.Local().Format("2006-01-02 15:04")))
+		for _, tc := range calls[m.ID] {
+			status := ""
+			if tc.IsError {
+				status = ", failed"
+			}
+			b.WriteString(fmt.Sprintf("<details><summary>Tool: <code>%s</code> (%d ms%s)</summary>\n\n", tc.Name, tc.DurationMS, status))
+			b.WriteString(codeBlock("json", tc.Arguments))
+			result := tc.Result
+			if len(result) > 2000 {
+				result = result[:2000] + "\n..."
+			}
+			b.WriteString(codeBlock("", result))
+			b.WriteString("</details>\n\n")
+		}
+		b.WriteString(strings.TrimSpace(m.Content) + "\n")
+	}
+	return b.String()
+}
+
+// codeBlock fences text, with a longer fence if the text contains one.
+func codeBlock(lang, text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n\n"
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportFormatFlag, "format", "f", "md", "Output format: md or json")
+	exportCmd.Flags().StringVarP(&exportOutputFlag, "output", "o", "", "Write to a file instead of stdout")
+	importCmd.Flags().StringVarP(&importProjectFlag, "project", "p", "", "Attach the session to this directory instead of the exported one")
+	importCmd.Flags().BoolVar(&importReplaceFlag, "replace", false, "Overwrite an existing session with the same ID")
+	RootCmd.AddCommand(exportCmd, importCmd)
+}
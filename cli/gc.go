@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/config"
+	"q/db"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var gcDaysFlag int
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Prune old history and compact the memory database",
+	Long: `Delete sessions not used within max_history_days (or --days), stale
+knowledge that was seen rarely, and expired docs, then VACUUM the database.
+Knowledge seen often or that fixed errors is kept regardless of age. With no
+limit configured only expired docs and orphaned rows are removed.
+
+Facts and relations also lose confidence while unconfirmed and when
+contradicted; those whose confidence has faded away are removed regardless
+of the limit.
+
+The same pruning runs automatically once a day when max_history_days is set.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		days := gcDaysFlag
+		if !cmd.Flags().Changed("days") {
+			if appConfig, err := config.LoadAppConfig(); err == nil {
+				days = appConfig.Preferences.MaxHistoryDays
+			}
+		}
+		if days < 0 {
+			fmt.Fprintln(os.Stderr, "--days must not be negative")
+			os.Exit(1)
+		}
+
+		withDB(func(database *db.DB) error {
+			result, err := database.PruneAndVacuum(time.Duration(days) * 24 * time.Hour)
+			if err != nil {
+				return err
+			}
+			if days > 0 {
+				fmt.Printf("Kept the last %d days of history.\n", days)
+			} else {
+				fmt.Println("No history limit set (max_history_days); sessions kept.")
+			}
+			fmt.Printf("Removed %d sessions, %d knowledge entities, %d facts, %d relations, %d error patterns, %d command records, %d watch errors, %d agent runs, %d notes, %d expired docs, %d orphaned rows.\n",
+				result.Sessions, result.Entities, result.Facts, result.Relations, result.ErrorPatterns, result.Commands, result.WatchErrors, result.AgentRuns, result.Notes, result.Docs, result.Orphans)
+			fmt.Printf("Database: %s -> %s (reclaimed %s)\n",
+				formatSize(result.BytesBefore), formatSize(result.BytesAfter), formatSize(result.Reclaimed()))
+			return nil
+		})
+	},
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	gcCmd.Flags().IntVar(&gcDaysFlag, "days", 0, "Keep this many days of history (default: max_history_days)")
+	RootCmd.AddCommand(gcCmd)
+}
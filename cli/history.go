@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/db"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyTagFlag    string
+	historyLimitFlag  int
+	historyRemoveFlag bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past conversations in this directory, or everywhere with a tag",
+	Long: `List recent sessions for the current directory, newest first. With --tag, list
+sessions carrying that tag from every directory. Tag sessions with /tag in a
+conversation or with q history tag.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var sessions []db.SessionSummary
+			var err error
+			if historyTagFlag != "" {
+				sessions, err = database.GetSessionsByTag(historyTagFlag, historyLimitFlag)
+			} else {
+				cwd, _ := os.Getwd()
+				sessions, err = database.GetRecentSessions(cwd, historyLimitFlag)
+			}
+			if err != nil {
+				return err
+			}
+			if len(sessions) == 0 {
+				if historyTagFlag != "" {
+					fmt.Printf("No sessions tagged %q.\n", db.NormalizeTag(historyTagFlag))
+					if tags, _ := database.ListTags(); len(tags) > 0 {
+						var names []string
+						for _, t := range tags {
+							names = append(names, fmt.Sprintf("%s (%d)", t.Name, t.Sessions))
+						}
+						fmt.Println("Tags in use: " + strings.Join(names, ", "))
+					}
+				} else {
+					fmt.Println("No conversations in this directory yet.")
+				}
+				return nil
+			}
+
+			var total db.Usage
+			for _, s := range sessions {
+				total = total.Add(s.Usage)
+				title := s.Title
+				if title == "" {
+					title = firstUserMessage(database, s.ID)
+				}
+				line := fmt.Sprintf("%s  %s  %3d msgs  %-22s  %s", shortID(s.ID), s.UpdatedAt.Local().Format("2006-01-02 15:04"), s.MessageCount, formatUsage(s.Usage), title)
+				if tags, _ := database.GetSessionTags(s.ID); len(tags) > 0 {
+					var names []string
+					for _, t := range tags {
+						names = append(names, t.Name)
+					}
+					line += "  [" + strings.Join(names, ", ") + "]"
+				}
+				fmt.Println(line)
+				if historyTagFlag != "" {
+					fmt.Println("          " + s.ProjectPath)
+				}
+			}
+			if len(sessions) > 1 && total.Tokens() > 0 {
+				fmt.Printf("\nTotal: %s\n", formatUsage(total))
+			}
+			return nil
+		})
+	},
+}
+
+var historyTagCmd = &cobra.Command{
+	Use:   "tag <session-id> <tag>...",
+	Short: "Tag a session, or untag it with --remove",
+	Long: `Tag a session. The session ID may be shortened to any unique prefix, as shown
+by q history. With no tags, list the session's tags and suggested ones.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			session, err := database.FindSession(args[0])
+			if err != nil {
+				return err
+			}
+			if len(args) == 1 {
+				tags, err := database.GetSessionTags(session.ID)
+				if err != nil {
+					return err
+				}
+				var names []string
+				for _, t := range tags {
+					names = append(names, t.Name)
+				}
+				if len(names) > 0 {
+					fmt.Println("Tags: " + strings.Join(names, ", "))
+				} else {
+					fmt.Println("No tags yet.")
+				}
+				if suggested, _ := database.SuggestTags(session.ID, 5); len(suggested) > 0 {
+					fmt.Printf("Suggested: q history tag %s %s\n", shortID(session.ID), strings.Join(suggested, " "))
+				}
+				return nil
+			}
+			for _, tag := range args[1:] {
+				if historyRemoveFlag {
+					removed, err := database.UntagSession(session.ID, tag)
+					if err != nil {
+						return err
+					}
+					if !removed {
+						return fmt.Errorf("session %s is not tagged %q", shortID(session.ID), db.NormalizeTag(tag))
+					}
+					fmt.Printf("Removed tag %s\n", db.NormalizeTag(tag))
+					continue
+				}
+				if err := database.TagSession(session.ID, tag); err != nil {
+					return err
+				}
+				fmt.Printf("Tagged %s %s\n", shortID(session.ID), db.NormalizeTag(tag))
+			}
+			return nil
+		})
+	},
+}
+
+// formatUsage shows tokens and, when the model's price is known, the
+// estimated cost, e.g. "12.3k tokens $0.042".
+func formatUsage(u db.Usage) string {
+	n := u.Tokens()
+	var s string
+	switch {
+	case n >= 1_000_000:
+		s = fmt.Sprintf("%.1fM tokens", float64(n)/1e6)
+	case n >= 1000:
+		s = fmt.Sprintf("%.1fk tokens", float64(n)/1e3)
+	default:
+		s = fmt.Sprintf("%d tokens", n)
+	}
+	if u.Cost > 0 {
+		s += fmt.Sprintf(" $%.3f", u.Cost)
+	}
+	return s
+}
+
+// shortID is the start of a session ID that is enough to tell it apart.
+// Imported and synced sessions can have IDs shorter than that.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// firstUserMessage stands in for a title on sessions that have none.
+func firstUserMessage(database *db.DB, sessionID string) string {
+	messages, err := database.GetMessages(sessionID)
+	if err != nil {
+		return "(untitled)"
+	}
+	for _, m := range messages {
+		if m.Role == "user" {
+			text := strings.Join(strings.Fields(m.Content), " ")
+			if len(text) > 60 {
+				text = text[:60] + "..."
+			}
+			return text
+		}
+	}
+	return "(untitled)"
+}
+
+func init() {
+	historyCmd.Flags().StringVarP(&historyTagFlag, "tag", "t", "", "Only sessions with this tag, from any directory")
+	historyCmd.Flags().IntVarP(&historyLimitFlag, "limit", "n", 20, "Maximum number of sessions to list")
+	historyTagCmd.Flags().BoolVar(&historyRemoveFlag, "remove", false, "Remove the tags instead of adding them")
+	historyCmd.AddCommand(historyTagCmd)
+	RootCmd.AddCommand(historyCmd)
+}
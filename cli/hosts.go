@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/db"
+	"q/tools"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hostUserFlag        string
+	hostPortFlag        int
+	hostKeyFlag         string
+	hostGroupsFlag      []string
+	hostTagsFlag        []string
+	hostDescriptionFlag string
+	hostListGroupFlag   string
+)
+
+var hostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "Manage the remote host inventory used by the SSH tools",
+	Long: `The host inventory names remote machines and sorts them into groups and tags.
+SSH tools resolve inventory names before ~/.ssh/config, and "@group" runs a
+command on every host in a group or with a tag.`,
+}
+
+var hostsAddCmd = &cobra.Command{
+	Use:   "add <name> <address>",
+	Short: "Add a host, or replace an existing one with the same name",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			host := &db.Host{
+				Name:        args[0],
+				Address:     args[1],
+				User:        hostUserFlag,
+				Port:        hostPortFlag,
+				KeyPath:     hostKeyFlag,
+				Groups:      hostGroupsFlag,
+				Tags:        hostTagsFlag,
+				Description: hostDescriptionFlag,
+			}
+			if err := database.SaveHost(host); err != nil {
+				return err
+			}
+			saved, err := database.GetHost(host.Name)
+			if err != nil || saved == nil {
+				return err
+			}
+			fmt.Println("Saved " + tools.DescribeHost(*saved))
+			return nil
+		})
+	},
+}
+
+var hostsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List inventory hosts",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			hosts, err := database.ListHosts(hostListGroupFlag)
+			if err != nil {
+				return err
+			}
+			if len(hosts) == 0 {
+				if hostListGroupFlag != "" {
+					fmt.Printf("No hosts in group %q.\n", hostListGroupFlag)
+				} else {
+					fmt.Println("No hosts yet. Add one with: q hosts add <name> <address> --group web")
+				}
+				return nil
+			}
+			for _, h := range hosts {
+				fmt.Println(tools.DescribeHost(h))
+			}
+			return nil
+		})
+	},
+}
+
+var hostsRemoveCmd = &cobra.Command{
+	Use:     "remove <name>...",
+	Aliases: []string{"rm"},
+	Short:   "Remove hosts from the inventory",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			for _, name := range args {
+				removed, err := database.DeleteHost(name)
+				if err != nil {
+					return err
+				}
+				if !removed {
+					return fmt.Errorf("no host named %q", name)
+				}
+				fmt.Printf("Removed %s\n", name)
+			}
+			return nil
+		})
+	},
+}
+
+func withDB(fn func(database *db.DB) error) {
+	styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	database, err := db.Open()
+	if err != nil {
+		fmt.Println(styleRed.Render(err.Error()))
+		os.Exit(1)
+	}
+	defer database.Close()
+	if err := fn(database); err != nil {
+		fmt.Println(styleRed.Render(err.Error()))
+		database.Close()
+		os.Exit(1)
+	}
+}
+
+func init() {
+	hostsAddCmd.Flags().StringVarP(&hostUserFlag, "user", "u", "", "Preferred login user")
+	hostsAddCmd.Flags().IntVarP(&hostPortFlag, "port", "p", 0, "SSH port (default from ~/.ssh/config, else 22)")
+	hostsAddCmd.Flags().StringVarP(&hostKeyFlag, "key", "k", "", "Private key path")
+	hostsAddCmd.Flags().StringSliceVarP(&hostGroupsFlag, "group", "g", nil, "Group to put the host in (repeatable or comma-separated)")
+	hostsAddCmd.Flags().StringSliceVarP(&hostTagsFlag, "tag", "t", nil, "Tag for the host (repeatable or comma-separated)")
+	hostsAddCmd.Flags().StringVarP(&hostDescriptionFlag, "description", "d", "", "What the host is for")
+	hostsListCmd.Flags().StringVarP(&hostListGroupFlag, "group", "g", "", "Only list hosts in this group or with this tag")
+
+	hostsCmd.AddCommand(hostsAddCmd, hostsListCmd, hostsRemoveCmd)
+	RootCmd.AddCommand(hostsCmd)
+}
@@ -0,0 +1,492 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"q/db"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	knowledgeAllFlag      bool
+	knowledgeTypeFlag     string
+	knowledgeLimitFlag    int
+	knowledgeGlobalFlag   bool
+	knowledgeCategoryFlag string
+	knowledgeOutputFlag   string
+	knowledgeProjectFlag  string
+	knowledgeRemoveFlag   bool
+)
+
+var knowledgeCmd = &cobra.Command{
+	Use:   "knowledge",
+	Short: "Inspect and correct what q has learned about your environment",
+	Long: `Inspect and correct the knowledge graph q builds as it works: entities such as
+files, commands and errors (IDs like e12), and facts like "postgres version
+16" (IDs like f7). Lists cover this directory and global knowledge unless
+--all is given.`,
+}
+
+var knowledgeListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List recently seen entities and facts",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			return printKnowledge(database, "")
+		})
+	},
+}
+
+var knowledgeSearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search entities and facts",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			return printKnowledge(database, strings.Join(args, " "))
+		})
+	},
+}
+
+var knowledgeShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show an entity with its relations and facts, or a fact",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			kind, id, err := parseKnowledgeID(args[0])
+			if err != nil {
+				return err
+			}
+			if kind == 'f' {
+				f, err := database.GetFactByID(id)
+				if err != nil {
+					return err
+				}
+				if f == nil {
+					return fmt.Errorf("no fact f%d", id)
+				}
+				fmt.Printf("f%d  %s %s %s\n", f.ID, f.Subject, f.Predicate, f.Object)
+				fmt.Printf("Category:   %s\n", f.Category)
+				fmt.Printf("Scope:      %s\n", knowledgeScope(f.ProjectPath))
+				fmt.Printf("Confidence: %.2f, confirmed %s, last %s\n", f.Confidence, plural(f.VerificationCount, "time", "times"), f.LastVerified.Local().Format("2006-01-02 15:04"))
+				fmt.Printf("Trust:      %s\n", knowledgeOrigin(f.Trust, f.Source, f.SessionID, f.Model))
+				return nil
+			}
+
+			e, err := database.GetEntityByID(id)
+			if err != nil {
+				return err
+			}
+			if e == nil {
+				return fmt.Errorf("no entity e%d", id)
+			}
+			fmt.Printf("e%d  %s %s\n", e.ID, e.Type, e.Name)
+			if e.Value != "" {
+				fmt.Printf("Value:  %s\n", e.Value)
+			}
+			if aliases, _ := database.Aliases(e.ID); len(aliases) > 0 {
+				fmt.Printf("Also:   %s\n", strings.Join(aliases, ", "))
+			}
+			fmt.Printf("Scope:  %s\n", knowledgeScope(e.ProjectPath))
+			fmt.Printf("Seen:   %s, %s to %s\n", plural(e.OccurrenceCount, "time", "times"), e.FirstSeen.Local().Format("2006-01-02"), e.LastSeen.Local().Format("2006-01-02"))
+			fmt.Printf("Trust:  %s\n", knowledgeOrigin(e.Trust, e.Source, e.SessionID, e.Model))
+			if related, _ := database.GetRelatedEntities(e.ID, "", 20); len(related) > 0 {
+				fmt.Println("\nRelations:")
+				for _, r := range related {
+					fmt.Printf("  %s e%d %s %s (confidence %.2f)\n", r.Relation.Relation, r.Entity.ID, r.Entity.Type, r.Entity.Name, r.Relation.Confidence)
+				}
+			}
+			if facts, _ := database.GetFactsAboutIn(e.Name, nil, 20); len(facts) > 0 {
+				fmt.Println("\nFacts:")
+				for _, f := range facts {
+					fmt.Printf("  f%-5d %s %s %s\n", f.ID, f.Subject, f.Predicate, f.Object)
+				}
+			}
+			return nil
+		})
+	},
+}
+
+var knowledgeDeleteCmd = &cobra.Command{
+	Use:     "delete <id>...",
+	Aliases: []string{"rm"},
+	Short:   "Delete entities (with their relations) or facts by ID",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			for _, arg := range args {
+				kind, id, err := parseKnowledgeID(arg)
+				if err != nil {
+					return err
+				}
+				var removed bool
+				if kind == 'f' {
+					removed, err = database.DeleteFact(id)
+				} else {
+					removed, err = database.DeleteEntity(id)
+				}
+				if err != nil {
+					return err
+				}
+				if !removed {
+					return fmt.Errorf("no %c%d", kind, id)
+				}
+				fmt.Printf("Deleted %c%d\n", kind, id)
+			}
+			return nil
+		})
+	},
+}
+
+var knowledgeMergeCmd = &cobra.Command{
+	Use:   "merge <id> <duplicate-id>...",
+	Short: "Merge duplicate entities into the first",
+	Long: `Merge duplicate entities, such as "postgres", "postgresql" and "Postgres 15",
+into the first one given. Their relations move to it, facts about them are
+rewritten to its name, and their names become its aliases, so learning about
+them later updates it instead of creating the duplicates again.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var ids []int64
+			for _, arg := range args {
+				kind, id, err := parseKnowledgeID(arg)
+				if err != nil {
+					return err
+				}
+				if kind != 'e' {
+					return fmt.Errorf("%s is a fact; only entities (like e12) can be merged", arg)
+				}
+				ids = append(ids, id)
+			}
+			e, err := database.MergeEntities(ids[0], ids[1:])
+			if err != nil {
+				return err
+			}
+			aliases, _ := database.Aliases(e.ID)
+			fmt.Printf("Merged into e%d  %s %s", e.ID, e.Type, e.Name)
+			if len(aliases) > 0 {
+				fmt.Printf(" (also %s)", strings.Join(aliases, ", "))
+			}
+			fmt.Println()
+			return nil
+		})
+	},
+}
+
+var knowledgeAliasCmd = &cobra.Command{
+	Use:   "alias <id> <name>...",
+	Short: "Add other names for an entity",
+	Long: `Add other names for an entity. Anything learned or looked up under an alias
+(of the same type) goes to the entity, and searches naming it find it. Aliases
+are matched ignoring case. Use --remove to drop them.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			kind, id, err := parseKnowledgeID(args[0])
+			if err != nil {
+				return err
+			}
+			if kind != 'e' {
+				return fmt.Errorf("%s is a fact; only entities (like e12) have aliases", args[0])
+			}
+			for _, name := range args[1:] {
+				var ok bool
+				if knowledgeRemoveFlag {
+					ok, err = database.RemoveAlias(id, name)
+				} else {
+					ok, err = database.AddAlias(id, name)
+				}
+				if err != nil {
+					return err
+				}
+				if !ok {
+					if knowledgeRemoveFlag {
+						return fmt.Errorf("%q is not an alias of e%d", name, id)
+					}
+					return fmt.Errorf("no entity e%d", id)
+				}
+			}
+			aliases, err := database.Aliases(id)
+			if err != nil {
+				return err
+			}
+			if len(aliases) == 0 {
+				fmt.Printf("e%d has no aliases\n", id)
+			} else {
+				fmt.Printf("e%d is also %s\n", id, strings.Join(aliases, ", "))
+			}
+			return nil
+		})
+	},
+}
+
+var knowledgeAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add or correct an entity or fact",
+}
+
+var knowledgeAddFactCmd = &cobra.Command{
+	Use:   "fact <subject> <predicate> <object>...",
+	Short: `Add a fact, e.g. q knowledge add fact postgres version 16`,
+	Long: `Add a fact. A fact with the same category, subject and predicate is replaced,
+so this also corrects a wrong one.`,
+	Args: cobra.MinimumNArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			f, err := database.UpsertFact(knowledgeCategoryFlag, args[0], args[1], strings.Join(args[2:], " "), knowledgeProject(),
+				db.Attribution{Source: "q knowledge add", Trust: db.TrustUser}, 1.0)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Saved f%d  %s %s %s (%s)\n", f.ID, f.Subject, f.Predicate, f.Object, knowledgeScope(f.ProjectPath))
+			return nil
+		})
+	},
+}
+
+var knowledgeAddEntityCmd = &cobra.Command{
+	Use:   "entity <type> <name> [value...]",
+	Short: `Add an entity, e.g. q knowledge add entity command "make deploy"`,
+	Long: `Add an entity, or update the value of an existing one. Types q uses include
+file, command, error, solution, pattern and preference.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			e, err := database.UpsertEntity(args[0], args[1], strings.Join(args[2:], " "), knowledgeProject(),
+				db.Attribution{Source: "q knowledge add", Trust: db.TrustUser})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Saved e%d  %s %s (%s)\n", e.ID, e.Type, e.Name, knowledgeScope(e.ProjectPath))
+			return nil
+		})
+	},
+}
+
+var knowledgeExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export knowledge as a JSON pack others can import",
+	Long: `Export this directory's and global entities, relations, facts and learned error
+fixes as JSON, to share with a team through "q knowledge import". Knowledge
+about this directory is written with project_path "." so it applies wherever
+the pack is imported. With --all, every directory's knowledge is exported with
+its full paths.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			project := ""
+			if !knowledgeAllFlag {
+				project = knowledgeProject()
+			}
+			pack, err := database.ExportKnowledge(project)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(pack, "", "  ")
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+
+			if knowledgeOutputFlag == "" || knowledgeOutputFlag == "-" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(knowledgeOutputFlag, data, 0600); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Exported %s, %s, %s and %s to %s\n",
+				plural(len(pack.Entities), "entity", "entities"), plural(len(pack.Relations), "relation", "relations"),
+				plural(len(pack.Facts), "fact", "facts"), plural(len(pack.ErrorPatterns), "error fix", "error fixes"), knowledgeOutputFlag)
+			return nil
+		})
+	},
+}
+
+var knowledgeImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: `Merge a pack written by "q knowledge export"`,
+	Long: `Merge a knowledge pack into the local graph. Use "-" to read from stdin.
+Knowledge for project "." is attached to this directory, or to --project.
+
+Entries are matched by entity type and name, fact category, subject and
+predicate, and normalized error signature. Where both sides have an entry, the
+more confident one wins (for error fixes, the better success record) and
+counts keep the larger value, so importing the same pack twice changes
+nothing.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var data []byte
+			var err error
+			if args[0] == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return err
+			}
+
+			var pack db.KnowledgePack
+			if err := json.Unmarshal(data, &pack); err != nil {
+				return fmt.Errorf("not a knowledge pack: %w", err)
+			}
+			project := knowledgeProjectFlag
+			if project == "" {
+				project = "."
+			}
+			if project, err = filepath.Abs(project); err != nil {
+				return err
+			}
+			project = db.ProjectKey(project)
+			result, err := database.ImportKnowledge(&pack, project)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Imported knowledge for %s: %d added, %d updated, %d already known\n", project, result.Added, result.Updated, result.Unchanged)
+			return nil
+		})
+	},
+}
+
+// printKnowledge lists entities and facts, matching query when it is set.
+func printKnowledge(database *db.DB, query string) error {
+	var paths []string
+	if !knowledgeAllFlag {
+		paths = []string{knowledgeProject()}
+	}
+
+	var entities []db.KnowledgeEntity
+	var err error
+	if query != "" {
+		project := ""
+		if paths != nil {
+			project = paths[0]
+		}
+		entities, err = database.SearchEntities(query, knowledgeTypeFlag, project, knowledgeLimitFlag)
+	} else {
+		entities, err = database.GetRecentEntitiesIn(paths, knowledgeTypeFlag, knowledgeLimitFlag)
+	}
+	if err != nil {
+		return err
+	}
+	var facts []db.KnowledgeFact
+	if knowledgeTypeFlag == "" {
+		if facts, err = database.ListFacts(query, paths, knowledgeLimitFlag); err != nil {
+			return err
+		}
+	}
+
+	if len(entities) == 0 && len(facts) == 0 {
+		if query != "" {
+			fmt.Printf("Nothing matches %q.\n", query)
+		} else {
+			fmt.Println("Nothing learned here yet.")
+		}
+		return nil
+	}
+	if len(entities) > 0 {
+		fmt.Println("Entities:")
+		for _, e := range entities {
+			line := fmt.Sprintf("  e%-5d %-10s %s", e.ID, e.Type, e.Name)
+			if e.Value != "" {
+				line += " = " + truncateLine(e.Value, 60)
+			}
+			fmt.Println(line + knowledgeSource(e.ProjectPath))
+		}
+	}
+	if len(facts) > 0 {
+		if len(entities) > 0 {
+			fmt.Println()
+		}
+		fmt.Println("Facts:")
+		for _, f := range facts {
+			fmt.Printf("  f%-5d %s %s %s%s\n", f.ID, f.Subject, f.Predicate, truncateLine(f.Object, 60), knowledgeSource(f.ProjectPath))
+		}
+	}
+	return nil
+}
+
+// parseKnowledgeID splits an ID like e12 or f7 into its kind and number.
+func parseKnowledgeID(s string) (byte, int64, error) {
+	s = strings.ToLower(s)
+	if len(s) > 1 && (s[0] == 'e' || s[0] == 'f') {
+		if id, err := strconv.ParseInt(s[1:], 10, 64); err == nil {
+			return s[0], id, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%q is not a knowledge ID like e12 or f7; see q knowledge list", s)
+}
+
+// knowledgeProject is the project key for this directory, or "" with
+// --global.
+func knowledgeProject() string {
+	if knowledgeGlobalFlag {
+		return ""
+	}
+	cwd, _ := os.Getwd()
+	return db.ProjectKey(cwd)
+}
+
+func knowledgeScope(projectPath string) string {
+	if projectPath == "" {
+		return "global"
+	}
+	return projectPath
+}
+
+// knowledgeOrigin describes how far knowledge is trusted and where it came
+// from, e.g. "verified, learn_fact in session 1a2b3c4d by gpt-4o".
+func knowledgeOrigin(trust db.Trust, source, sessionID, model string) string {
+	origin := trust.String()
+	if source != "" && source != origin {
+		origin += ", " + source
+	}
+	if sessionID != "" {
+		origin += " in session " + shortID(sessionID)
+	}
+	if model != "" {
+		origin += " by " + model
+	}
+	return origin
+}
+
+// knowledgeSource marks entries from other directories when listing across
+// all of them.
+func knowledgeSource(projectPath string) string {
+	if !knowledgeAllFlag {
+		return ""
+	}
+	return "  (" + knowledgeScope(projectPath) + ")"
+}
+
+func init() {
+	for _, c := range []*cobra.Command{knowledgeListCmd, knowledgeSearchCmd} {
+		c.Flags().BoolVarP(&knowledgeAllFlag, "all", "a", false, "Include knowledge from other directories")
+		c.Flags().StringVarP(&knowledgeTypeFlag, "type", "t", "", "Only entities of this type")
+		c.Flags().IntVarP(&knowledgeLimitFlag, "limit", "n", 30, "Maximum number of entities and of facts")
+	}
+	for _, c := range []*cobra.Command{knowledgeAddFactCmd, knowledgeAddEntityCmd} {
+		c.Flags().BoolVarP(&knowledgeGlobalFlag, "global", "g", false, "Apply in every directory, not just this one")
+	}
+	knowledgeAddFactCmd.Flags().StringVarP(&knowledgeCategoryFlag, "category", "c", "system", "Fact category: system, preference, pattern or solution")
+	knowledgeExportCmd.Flags().BoolVarP(&knowledgeAllFlag, "all", "a", false, "Export every directory's knowledge, keeping full paths")
+	knowledgeExportCmd.Flags().StringVarP(&knowledgeOutputFlag, "output", "o", "", "Write to a file instead of stdout")
+	knowledgeImportCmd.Flags().StringVarP(&knowledgeProjectFlag, "project", "p", "", "Attach project knowledge to this directory instead of the current one")
+	knowledgeAliasCmd.Flags().BoolVarP(&knowledgeRemoveFlag, "remove", "d", false, "Remove the aliases instead")
+	knowledgeAddCmd.AddCommand(knowledgeAddFactCmd, knowledgeAddEntityCmd)
+	knowledgeCmd.AddCommand(knowledgeListCmd, knowledgeSearchCmd, knowledgeShowCmd, knowledgeDeleteCmd, knowledgeAddCmd,
+		knowledgeMergeCmd, knowledgeAliasCmd, knowledgeExportCmd, knowledgeImportCmd)
+	RootCmd.AddCommand(knowledgeCmd)
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"fmt"
+	"q/db"
+	"q/util"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/spf13/cobra"
+)
+
+var knowledgeReportLimitFlag int
+
+var knowledgeReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarize what q has learned here, and what may be out of date",
+	Long: `Summarize the knowledge q has learned in this directory: the entities seen
+most, the strongest relations between them, error patterns and how often
+their fixes worked, commands that keep failing, and facts that have gone
+unconfirmed long enough to be worth checking.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			if knowledgeReportLimitFlag < 1 {
+				return fmt.Errorf("--limit must be at least 1")
+			}
+			var paths []string
+			scope := "every directory"
+			if !knowledgeAllFlag {
+				paths = []string{knowledgeProject()}
+				scope = paths[0]
+			}
+			report, err := database.KnowledgeReport(paths, knowledgeReportLimitFlag)
+			if err != nil {
+				return err
+			}
+			r, err := glamour.NewTermRenderer(
+				glamour.WithAutoStyle(),
+				glamour.WithWordWrap(util.GetTermSafeMaxWidth()),
+			)
+			if err != nil {
+				return err
+			}
+			out, err := r.Render(knowledgeReportMarkdown(report, scope))
+			if err != nil {
+				return err
+			}
+			fmt.Print(out)
+			return nil
+		})
+	},
+}
+
+// knowledgeReportMarkdown lays out a knowledge report for glamour.
+func knowledgeReportMarkdown(r *db.KnowledgeReport, scope string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Knowledge in %s\n\n", scope)
+	if r.Entities == 0 && r.Facts == 0 && r.ErrorPatterns == 0 && len(r.FailingCommands) == 0 {
+		b.WriteString("Nothing learned here yet.\n")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "%s, %s, %s and %s.",
+		plural(r.Entities, "entity", "entities"), plural(r.Relations, "relation", "relations"),
+		plural(r.Facts, "fact", "facts"), plural(r.ErrorPatterns, "error pattern", "error patterns"))
+	if len(r.EntityTypes) > 0 {
+		types := make([]string, 0, len(r.EntityTypes))
+		for t := range r.EntityTypes {
+			types = append(types, t)
+		}
+		sort.Slice(types, func(i, j int) bool {
+			if r.EntityTypes[types[i]] != r.EntityTypes[types[j]] {
+				return r.EntityTypes[types[i]] > r.EntityTypes[types[j]]
+			}
+			return types[i] < types[j]
+		})
+		for i, t := range types {
+			types[i] = fmt.Sprintf("%d %s", r.EntityTypes[t], t)
+		}
+		fmt.Fprintf(&b, " Entities by type: %s.", strings.Join(types, ", "))
+	}
+	b.WriteString("\n\n")
+
+	if len(r.TopEntities) > 0 {
+		b.WriteString("## Most seen\n\n| ID | Type | Name | Seen | Last seen |\n|---|---|---|---|---|\n")
+		for _, e := range r.TopEntities {
+			fmt.Fprintf(&b, "| e%d | %s | %s | %d | %s |\n", e.ID, markdownCell(e.Type, 20), markdownCell(e.Name, 50),
+				e.OccurrenceCount, e.LastSeen.Local().Format("2006-01-02"))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.StrongestRelations) > 0 {
+		b.WriteString("## Strongest relations\n\n")
+		for _, rel := range r.StrongestRelations {
+			fmt.Fprintf(&b, "- e%d `%s` **%s** e%d `%s` (%.0f%% confident, used %s)\n",
+				rel.Source.ID, truncateLine(rel.Source.Name, 40), rel.Relation.Relation,
+				rel.Target.ID, truncateLine(rel.Target.Name, 40), rel.Relation.Confidence*100,
+				plural(rel.Relation.UseCount, "time", "times"))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.Patterns) > 0 {
+		b.WriteString("## Error patterns\n\n| Error | Fix | Fix worked |\n|---|---|---|\n")
+		for _, ep := range r.Patterns {
+			fix := ep.Solution
+			if ep.SolutionCommand != "" {
+				fix = ep.SolutionCommand
+			}
+			worked := "not tried"
+			if rate := ep.SuccessRate(); rate >= 0 {
+				worked = fmt.Sprintf("%d of %d (%.0f%%)", ep.SuccessCount, ep.SuccessCount+ep.FailureCount, rate*100)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", markdownCell(ep.ErrorSignature, 60), markdownCell(fix, 60), worked)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.FailingCommands) > 0 {
+		b.WriteString("## Commands that keep failing\n\n| Command | Failed | Last exit code |\n|---|---|---|\n")
+		for _, o := range r.FailingCommands {
+			fmt.Fprintf(&b, "| %s | %d of %d | %d |\n", markdownCell(o.Command, 60),
+				o.FailureCount, o.SuccessCount+o.FailureCount, o.LastExitCode)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.StaleFacts) > 0 {
+		b.WriteString("## Possibly out of date\n\nThese facts have not been confirmed in a long time:\n\n")
+		for _, f := range r.StaleFacts {
+			fmt.Fprintf(&b, "- f%d %s %s %s (last confirmed %s, %.0f%% confident)\n",
+				f.ID, f.Subject, f.Predicate, truncateLine(f.Object, 60),
+				f.LastVerified.Local().Format("2006-01-02"), f.Confidence*100)
+		}
+		b.WriteString("\nCheck them with `q knowledge show`, and remove wrong ones with `q knowledge delete`.\n")
+	}
+	return b.String()
+}
+
+// markdownCell fits s into a markdown table cell.
+func markdownCell(s string, n int) string {
+	return strings.ReplaceAll(truncateLine(s, n), "|", `\|`)
+}
+
+func init() {
+	knowledgeReportCmd.Flags().BoolVarP(&knowledgeAllFlag, "all", "a", false, "Report on every directory's knowledge")
+	knowledgeReportCmd.Flags().IntVarP(&knowledgeReportLimitFlag, "limit", "n", 10, "Maximum number of items in each section")
+	knowledgeCmd.AddCommand(knowledgeReportCmd)
+}
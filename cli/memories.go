@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/db"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	rememberGlobalFlag bool
+	memoriesAllFlag    bool
+)
+
+var rememberCmd = &cobra.Command{
+	Use:   "remember <fact>",
+	Short: `Pin a fact for this project, e.g. q remember "we deploy with make deploy-prod"`,
+	Long: `Pin a fact that is always included in the system prompt when q runs in this
+directory, ahead of anything learned automatically. Use --global for facts
+that apply everywhere.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		projectPath := ""
+		if !rememberGlobalFlag {
+			projectPath, _ = os.Getwd()
+		}
+		withDB(func(database *db.DB) error {
+			memory, err := database.AddMemory(projectPath, strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+			where := "everywhere"
+			if projectPath != "" {
+				where = "in " + projectPath
+			}
+			fmt.Printf("Remembered #%d %s\n", memory.ID, where)
+			return nil
+		})
+	},
+}
+
+var memoriesCmd = &cobra.Command{
+	Use:   "memories",
+	Short: "Manage facts pinned with q remember",
+}
+
+var memoriesListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List pinned memories for this project and global ones",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var memories []db.Memory
+			var err error
+			if memoriesAllFlag {
+				memories, err = database.ListMemories()
+			} else {
+				cwd, _ := os.Getwd()
+				memories, err = database.GetMemories(cwd)
+			}
+			if err != nil {
+				return err
+			}
+			if len(memories) == 0 {
+				fmt.Println(`No pinned memories. Add one with: q remember "we deploy with make deploy-prod"`)
+				return nil
+			}
+			for _, m := range memories {
+				scope := "global"
+				if m.ProjectPath != "" {
+					scope = m.ProjectPath
+				}
+				fmt.Printf("#%-4d %s  (%s)\n", m.ID, m.Content, scope)
+			}
+			return nil
+		})
+	},
+}
+
+var memoriesForgetCmd = &cobra.Command{
+	Use:     "forget <id>...",
+	Aliases: []string{"rm"},
+	Short:   "Forget pinned memories by ID",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			for _, arg := range args {
+				id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+				if err != nil {
+					return fmt.Errorf("%q is not a memory ID; see q memories list", arg)
+				}
+				removed, err := database.DeleteMemory(id)
+				if err != nil {
+					return err
+				}
+				if !removed {
+					return fmt.Errorf("no memory #%d", id)
+				}
+				fmt.Printf("Forgot #%d\n", id)
+			}
+			return nil
+		})
+	},
+}
+
+func init() {
+	rememberCmd.Flags().BoolVarP(&rememberGlobalFlag, "global", "g", false, "Apply in every directory, not just this one")
+	memoriesListCmd.Flags().BoolVarP(&memoriesAllFlag, "all", "a", false, "Include memories pinned to other projects")
+	memoriesCmd.AddCommand(memoriesListCmd, memoriesForgetCmd)
+	RootCmd.AddCommand(rememberCmd, memoriesCmd)
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/db"
+
+	"github.com/spf13/cobra"
+)
+
+var preferencesAllFlag bool
+
+var preferencesCmd = &cobra.Command{
+	Use:   "preferences",
+	Short: "Review the preferences q has learned about how you work",
+	Long: `Review preferences the model learned, like "user prefers ripgrep over grep".
+Accepted preferences are added to the system prompt in every conversation
+they apply to; rejected ones are dropped and not learned again.`,
+}
+
+var preferencesLearnedCmd = &cobra.Command{
+	Use:   "learned",
+	Short: "List learned preferences by review status",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var paths []string
+			if !preferencesAllFlag {
+				cwd, _ := os.Getwd()
+				paths = []string{db.ProjectKey(cwd)}
+			}
+			prefs, err := database.LearnedPreferences(paths)
+			if err != nil {
+				return err
+			}
+			if len(prefs) == 0 {
+				fmt.Println("No preferences learned yet.")
+				return nil
+			}
+
+			var pending, accepted, rejected []db.KnowledgeFact
+			for _, f := range prefs {
+				switch {
+				case f.Rejected:
+					rejected = append(rejected, f)
+				case f.Trust >= db.TrustUser:
+					accepted = append(accepted, f)
+				default:
+					pending = append(pending, f)
+				}
+			}
+			for _, group := range []struct {
+				title string
+				facts []db.KnowledgeFact
+			}{{"Pending review", pending}, {"Accepted", accepted}, {"Rejected", rejected}} {
+				if len(group.facts) == 0 {
+					continue
+				}
+				fmt.Printf("%s:\n", group.title)
+				for _, f := range group.facts {
+					fmt.Printf("  f%-5d %s %s %s  (%s)\n", f.ID, f.Subject, f.Predicate, f.Object, knowledgeScope(f.ProjectPath))
+				}
+			}
+			if len(pending) > 0 {
+				fmt.Printf("\nAccept with: q preferences accept f%d   Reject with: q preferences reject f%d\n", pending[0].ID, pending[0].ID)
+			}
+			return nil
+		})
+	},
+}
+
+var preferencesAcceptCmd = &cobra.Command{
+	Use:   "accept <id>...",
+	Short: "Accept learned preferences, so they are always followed",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		reviewPreferences(args, true)
+	},
+}
+
+var preferencesRejectCmd = &cobra.Command{
+	Use:   "reject <id>...",
+	Short: "Reject learned preferences, so they are dropped and not learned again",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		reviewPreferences(args, false)
+	},
+}
+
+func reviewPreferences(args []string, accept bool) {
+	withDB(func(database *db.DB) error {
+		for _, arg := range args {
+			kind, id, err := parseKnowledgeID(arg)
+			if err != nil {
+				return err
+			}
+			if kind != 'f' {
+				return fmt.Errorf("%s is an entity; preferences are facts like f7", arg)
+			}
+			f, err := database.GetFactByID(id)
+			if err != nil {
+				return err
+			}
+			if f == nil {
+				return fmt.Errorf("no fact f%d", id)
+			}
+			if _, err := database.ReviewFact(id, accept); err != nil {
+				return err
+			}
+			verb := "Accepted"
+			if !accept {
+				verb = "Rejected"
+			}
+			fmt.Printf("%s f%d  %s %s %s\n", verb, f.ID, f.Subject, f.Predicate, f.Object)
+		}
+		return nil
+	})
+}
+
+func init() {
+	preferencesLearnedCmd.Flags().BoolVarP(&preferencesAllFlag, "all", "a", false, "Include preferences learned in other directories")
+	preferencesCmd.AddCommand(preferencesLearnedCmd, preferencesAcceptCmd, preferencesRejectCmd)
+	RootCmd.AddCommand(preferencesCmd)
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+	"q/config"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// reloadConfig re-reads the config if the file changed since the session
+// last read it, applying its preferences and model to the queries that
+// follow, and returns a notice saying so, or "" if it did not change. A
+// config that no longer loads, or whose model has no API key, is not
+// applied, and the notice says why.
+func (m *model) reloadConfig() string {
+	modTime := config.ModTime()
+	if modTime.Equal(m.configModTime) {
+		return ""
+	}
+	m.configModTime = modTime
+
+	failed := func(err error) string {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("Config changed but was not reloaded: ") + err.Error()
+	}
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		return failed(err)
+	}
+	modelConfig, err := getModelConfig(appConfig, modelFlag)
+	if err != nil {
+		return failed(err)
+	}
+	modelConfig, ok := resolveAPIKey(modelConfig)
+	if !ok {
+		return failed(fmt.Errorf("%s is not set", modelConfig.Auth))
+	}
+	if err := setPreferences(appConfig); err != nil {
+		return failed(err)
+	}
+
+	m.client.SetModel(modelConfig)
+	m.profile = appConfig.ActiveProfile
+	notice := "Config reloaded."
+	if modelConfig.Name != m.modelName {
+		m.modelName = modelConfig.Name
+		notice = fmt.Sprintf("Config reloaded; now using %s.", modelConfig.Name)
+	}
+	return lipgloss.NewStyle().Faint(true).Render(notice)
+}
@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"q/tools"
+	"q/util"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reviewOnceFlag     bool
+	reviewOutputFlag   string
+	reviewIntervalFlag time.Duration
+	reviewMinLinesFlag int
+)
+
+var reviewCmd = &cobra.Command{
+	Use:   "review",
+	Short: "Review uncommitted changes as you make them",
+	Long: `Watch the git working tree and, whenever --min-lines lines of the
+uncommitted changes differ from those last reviewed and have settled, have
+the model review them for likely bugs, missing error handling and unhandled
+edge cases. Comments are shown in a panel, or written to a file with
+--output, as file:line: severity: comment lines editors can jump through, or
+as JSON if the file ends in .json.
+
+Nothing is changed; to have build errors repaired, use q watch.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runReview()
+	},
+}
+
+func init() {
+	reviewCmd.Flags().BoolVar(&reviewOnceFlag, "once", false, "Review the current changes once and exit")
+	reviewCmd.Flags().StringVarP(&reviewOutputFlag, "output", "o", "", "Write comments to this file instead of showing the panel")
+	reviewCmd.Flags().DurationVar(&reviewIntervalFlag, "interval", 5*time.Second, "How often to check the working tree")
+	reviewCmd.Flags().IntVar(&reviewMinLinesFlag, "min-lines", 5, "Changed lines needed since the last review for another")
+	RootCmd.AddCommand(reviewCmd)
+}
+
+type reviewingMsg struct{}
+type reviewMsg tools.Review
+
+// reviewModel is the review panel: the comments of the latest review,
+// grouped by file.
+type reviewModel struct {
+	spinner   spinner.Model
+	now       chan struct{}
+	reviewing bool
+	review    *tools.Review
+	// err is the latest review's error, if it failed; the comments of the
+	// one before stay on show.
+	err      error
+	selected int
+	width    int
+	height   int
+}
+
+func runReview() {
+	if _, err := git("rev-parse", "--git-dir"); err != nil {
+		fmt.Println("Not a git repository.")
+		os.Exit(1)
+	}
+
+	modelConfig := loadModelConfig()
+	initToolModel(modelConfig)
+
+	config := tools.ReviewConfig{Interval: reviewIntervalFlag, MinLines: reviewMinLinesFlag}
+	switch {
+	case reviewOnceFlag:
+		diff, err := tools.WorkingTreeDiff()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if diff == "" {
+			fmt.Println("No uncommitted changes to review.")
+			return
+		}
+		fmt.Println(watchDimStyle.Render(fmt.Sprintf("Reviewing changes with %s...", modelConfig.Name)))
+		review := tools.ReviewDiff(diff)
+		if review.Err != nil {
+			fmt.Println(watchFailStyle.Render(review.Err.Error()))
+			os.Exit(1)
+		}
+		if reviewOutputFlag != "" {
+			if err := writeReviewComments(reviewOutputFlag, review.Comments); err != nil {
+				fmt.Println(watchFailStyle.Render(err.Error()))
+				os.Exit(1)
+			}
+		}
+		printReview(review)
+
+	case reviewOutputFlag != "":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		fmt.Printf("Reviewing changes into %s as they happen. Press Ctrl+C to stop.\n", reviewOutputFlag)
+		config.OnReview = func(r tools.Review) {
+			at := r.At.Format("15:04:05")
+			if r.Err == nil {
+				r.Err = writeReviewComments(reviewOutputFlag, r.Comments)
+			}
+			if r.Err != nil {
+				fmt.Fprintf(os.Stderr, "%s %v\n", at, r.Err)
+				return
+			}
+			fmt.Printf("%s reviewed %s: %s\n", at, plural(r.Files, "file", "files"), plural(len(r.Comments), "comment", "comments"))
+		}
+		tools.WatchForReview(ctx, config)
+
+	default:
+		s := spinner.New()
+		s.Spinner = spinner.Dot
+		s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+		m := reviewModel{spinner: s, now: make(chan struct{}, 1), width: util.GetTermSafeMaxWidth()}
+		p := tea.NewProgram(&m, tea.WithAltScreen())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config.Now = m.now
+		config.OnReviewing = func() { p.Send(reviewingMsg{}) }
+		config.OnReview = func(r tools.Review) { p.Send(reviewMsg(r)) }
+		go tools.WatchForReview(ctx, config)
+
+		if _, err := p.Run(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// writeReviewComments replaces the file at path with comments.
+func writeReviewComments(path string, comments []tools.ReviewComment) error {
+	data := []byte(tools.FormatReviewComments(comments))
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if comments == nil {
+			comments = []tools.ReviewComment{}
+		}
+		var err error
+		if data, err = json.MarshalIndent(comments, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("could not write review comments: %w", err)
+	}
+	return nil
+}
+
+// printReview prints the comments of review for q review --once.
+func printReview(review tools.Review) {
+	if len(review.Comments) == 0 {
+		fmt.Println(watchOKStyle.Render("No comments."))
+		return
+	}
+	file := ""
+	for _, c := range review.Comments {
+		if c.File != file {
+			file = c.File
+			fmt.Println("\n" + watchHeadStyle.Render(file))
+		}
+		fmt.Printf("  %4d %s %s\n", c.Line, severityStyle(c.Severity).Render(fmt.Sprintf("%-7s", c.Severity)), c.Comment)
+	}
+}
+
+func severityStyle(severity string) lipgloss.Style {
+	switch severity {
+	case "bug":
+		return watchFailStyle
+	case "nit":
+		return watchDimStyle
+	}
+	return watchWarnStyle
+}
+
+func (m *reviewModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m *reviewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	case reviewingMsg:
+		m.reviewing = true
+	case reviewMsg:
+		m.reviewing = false
+		m.err = msg.Err
+		if msg.Err == nil {
+			review := tools.Review(msg)
+			m.review = &review
+			m.selected = 0
+		}
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		case "r":
+			select {
+			case m.now <- struct{}{}:
+			default:
+			}
+		case "up", "k":
+			if m.selected > 0 {
+				m.selected--
+			}
+		case "down", "j":
+			if m.review != nil && m.selected < len(m.review.Comments)-1 {
+				m.selected++
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *reviewModel) View() string {
+	var b strings.Builder
+	cwd, _ := os.Getwd()
+	b.WriteString(watchTitleStyle.Render("Shell-AI Review") + "  " + watchDimStyle.Render(cwd) + "\n\n")
+
+	switch {
+	case m.reviewing:
+		b.WriteString(m.spinner.View() + " Reviewing changes...\n")
+	case m.review == nil && m.err == nil:
+		b.WriteString(m.spinner.View() + " Reading changes...\n")
+	case m.err != nil:
+		b.WriteString(watchFailStyle.Render("✗ "+m.err.Error()) + "\n")
+	case m.review.Files == 0:
+		b.WriteString(watchDimStyle.Render("No uncommitted changes; waiting for some.") + "\n")
+	default:
+		b.WriteString(watchDimStyle.Render(fmt.Sprintf("Reviewed %s, %s, at %s",
+			plural(m.review.Files, "changed file", "changed files"), plural(m.review.Lines, "line", "lines"),
+			m.review.At.Format("15:04:05"))) + "\n")
+	}
+
+	if m.review != nil && m.review.Files > 0 {
+		comments := m.review.Comments
+		if len(comments) == 0 {
+			b.WriteString("\n" + watchOKStyle.Render("✓ No comments") + "\n")
+		} else {
+			b.WriteString("\n" + watchHeadStyle.Render(fmt.Sprintf("Comments (%d)", len(comments))) + "\n")
+			shown := max(m.height-lipgloss.Height(b.String())-4, 5)
+			first := max(0, min(m.selected-shown/2, len(comments)-shown))
+			file := ""
+			for i := first; i < len(comments) && i < first+shown; i++ {
+				c := comments[i]
+				if c.File != file || i == first {
+					file = c.File
+					b.WriteString(watchHeadStyle.Render(file) + "\n")
+				}
+				cursor := "  "
+				if i == m.selected {
+					cursor = "> "
+				}
+				line := fmt.Sprintf("%s%4d %s ", cursor, c.Line, severityStyle(c.Severity).Render(fmt.Sprintf("%-7s", c.Severity)))
+				if i == m.selected {
+					comment := lipgloss.NewStyle().Width(max(m.width-lipgloss.Width(line), 20)).Render(c.Comment)
+					b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, line, comment) + "\n")
+				} else {
+					b.WriteString(line + truncateLine(c.Comment, max(m.width-lipgloss.Width(line), 20)) + "\n")
+				}
+			}
+		}
+	}
+
+	b.WriteString("\n" + watchDimStyle.Render("r review now · ↑/↓ select comment · q quit"))
+	return b.String()
+}
@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/config"
+	"q/llm"
+	"q/tools"
+	. "q/types"
+	"strings"
+	"text/template"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [recipe] [--input value ...]",
+	Short: "Run a saved recipe, e.g. q run deploy-checklist --env staging",
+	Run: func(cmd *cobra.Command, args []string) {
+		runRecipe(cmd, args)
+	},
+}
+
+func init() {
+	// Recipe inputs are arbitrary --name value pairs, so flags after the
+	// recipe name are left to parseRecipeArgs.
+	runCmd.Flags().SetInterspersed(false)
+	RootCmd.AddCommand(runCmd)
+}
+
+// parseRecipeArgs splits `name --key value --flag=value` into the recipe
+// name and its inputs, picking out -m/--model, --tools and --profile along
+// the way.
+func parseRecipeArgs(args []string) (string, map[string]string, bool, error) {
+	var name string
+	inputs := make(map[string]string)
+	help := false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			if name != "" {
+				return "", nil, false, fmt.Errorf("unexpected argument %q", arg)
+			}
+			name = arg
+			continue
+		}
+		if arg == "-h" || arg == "--help" {
+			help = true
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !hasValue {
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				value = args[i]
+			} else if key == "m" || key == "model" || key == "tools" || key == "profile" {
+				return "", nil, false, fmt.Errorf("missing value for %s", arg)
+			} else {
+				value = "true"
+			}
+		}
+		switch key {
+		case "m", "model":
+			modelFlag = value
+		case "tools":
+			toolsFlag = value
+		case "profile":
+			configProfileFlag = value
+			config.SetProfile(value)
+		default:
+			inputs[key] = value
+		}
+	}
+	return name, inputs, help, nil
+}
+
+func findRecipe(recipes []Recipe, name string) (Recipe, bool) {
+	for _, r := range recipes {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Recipe{}, false
+}
+
+func renderRecipe(recipe Recipe, inputs map[string]string) (string, error) {
+	values := make(map[string]string)
+	known := make(map[string]bool)
+	var missing []string
+	for _, input := range recipe.Inputs {
+		known[input.Name] = true
+		value, ok := inputs[input.Name]
+		if !ok {
+			value = input.Default
+		}
+		if value == "" && input.Required {
+			missing = append(missing, "--"+input.Name)
+		}
+		values[input.Name] = value
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing required input: %s", strings.Join(missing, ", "))
+	}
+	for key := range inputs {
+		if !known[key] {
+			return "", fmt.Errorf("unknown input --%s for recipe %s", key, recipe.Name)
+		}
+	}
+
+	tmpl, err := template.New(recipe.Name).Option("missingkey=error").Parse(recipe.Prompt)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template in recipe %s: %w", recipe.Name, err)
+	}
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, values); err != nil {
+		return "", fmt.Errorf("recipe %s: %w", recipe.Name, err)
+	}
+	return prompt.String(), nil
+}
+
+func printRecipes(recipes []Recipe) {
+	styleDim := lipgloss.NewStyle().Faint(true)
+	if len(recipes) == 0 {
+		fmt.Println("No recipes defined. Add them under recipes: in ~/.shell-ai/config.yaml or as YAML files in ~/.shell-ai/recipes/.")
+		return
+	}
+	fmt.Println("Recipes:")
+	for _, r := range recipes {
+		fmt.Printf("  %-24s %s\n", r.Name, styleDim.Render(r.Description))
+	}
+	fmt.Println()
+	fmt.Println(styleDim.Render("Run with: q run <recipe> [--input value ...]"))
+}
+
+func printRecipeHelp(recipe Recipe) {
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fmt.Printf("q run %s", recipe.Name)
+	for _, input := range recipe.Inputs {
+		if input.Required {
+			fmt.Printf(" --%s <value>", input.Name)
+		} else {
+			fmt.Printf(" [--%s <value>]", input.Name)
+		}
+	}
+	fmt.Println()
+	if recipe.Description != "" {
+		fmt.Println(styleDim.Render(recipe.Description))
+	}
+	if len(recipe.Inputs) > 0 {
+		fmt.Println()
+		for _, input := range recipe.Inputs {
+			detail := input.Description
+			if input.Default != "" {
+				detail = strings.TrimSpace(fmt.Sprintf("%s (default %s)", detail, input.Default))
+			}
+			fmt.Printf("  --%-20s %s\n", input.Name, styleDim.Render(detail))
+		}
+	}
+	if len(recipe.Tools) > 0 {
+		fmt.Println()
+		fmt.Println(styleDim.Render("Tools: " + strings.Join(recipe.Tools, ", ")))
+	}
+}
+
+func runRecipe(cmd *cobra.Command, args []string) {
+	styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fail := func(err error) {
+		fmt.Println(styleRed.Render(err.Error()))
+		os.Exit(1)
+	}
+
+	name, inputs, help, err := parseRecipeArgs(args)
+	if err != nil {
+		fail(err)
+	}
+
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(1)
+	}
+	recipes, err := config.LoadRecipes(appConfig)
+	if err != nil {
+		fail(err)
+	}
+
+	if name == "" {
+		if help {
+			cmd.Help()
+			fmt.Println()
+		}
+		printRecipes(recipes)
+		return
+	}
+	recipe, ok := findRecipe(recipes, name)
+	if !ok {
+		fail(fmt.Errorf("no recipe named %s (run q run to list recipes)", name))
+	}
+	if help {
+		printRecipeHelp(recipe)
+		return
+	}
+
+	prompt, err := renderRecipe(recipe, inputs)
+	if err != nil {
+		fail(err)
+	}
+
+	if modelFlag == "" {
+		modelFlag = recipe.Model
+	}
+	modelConfig := loadModelConfig()
+	if toolsFlag == "" && len(recipe.Tools) > 0 {
+		if err := tools.SetToolCategories(nil, recipe.Tools); err != nil {
+			fail(fmt.Errorf("recipe %s: %w", recipe.Name, err))
+		}
+	}
+
+	c := llm.NewLLMClient(modelConfig)
+	defer c.Close()
+	tools.SetApprovalHandler(ttyApprovalHandler)
+	tools.SetInputHandler(ttyInputHandler)
+
+	fmt.Println(styleDim.Render(fmt.Sprintf("Running %s with %s...", recipe.Name, modelConfig.Name)))
+	response, err := c.Query(prompt)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		c.Close()
+		os.Exit(1)
+	}
+	fmt.Println(response)
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+	"q/db"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// slashCommand is handled by q itself instead of being sent to the model.
+// run returns the text to print.
+type slashCommand struct {
+	usage string
+	help  string
+	run   func(m *model, args []string) string
+}
+
+var slashCommands = map[string]slashCommand{
+	"tag": {
+		usage: "/tag [name...]",
+		help:  "Tag this conversation; with no name, show its tags and suggestions",
+		run:   (*model).slashTag,
+	},
+	"context": {
+		usage: "/context",
+		help:  "Show what was loaded from memory into this conversation",
+		run:   (*model).slashContext,
+	},
+}
+
+// parseSlashCommand splits "/name args" input. Only known commands and
+// /help match, so a query that starts with a path still goes to the model.
+func parseSlashCommand(input string) (name string, args []string, ok bool) {
+	if !strings.HasPrefix(input, "/") {
+		return "", nil, false
+	}
+	fields := strings.Fields(input[1:])
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	name = strings.ToLower(fields[0])
+	if _, known := slashCommands[name]; !known && name != "help" {
+		return "", nil, false
+	}
+	return name, fields[1:], true
+}
+
+func (m model) handleSlashCommand(name string, args []string) (tea.Model, tea.Cmd) {
+	var output string
+	if name == "help" {
+		output = slashHelp()
+	} else {
+		output = slashCommands[name].run(&m, args)
+	}
+	message := lipgloss.NewStyle().Faint(true).Width(m.maxWidth).Render(output)
+	return m, tea.Sequence(tea.Printf("%s", message), textinput.Blink)
+}
+
+func slashHelp() string {
+	names := make([]string, 0, len(slashCommands))
+	for name := range slashCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("Commands:")
+	for _, name := range names {
+		cmd := slashCommands[name]
+		fmt.Fprintf(&b, "\n  %-20s %s", cmd.usage, cmd.help)
+	}
+	return b.String()
+}
+
+func (m *model) slashTag(args []string) string {
+	if len(args) == 0 {
+		tags, suggested, err := m.client.SessionTags()
+		if err != nil {
+			return err.Error()
+		}
+		line := "No tags yet."
+		if len(tags) > 0 {
+			line = "Tags: " + strings.Join(tags, ", ")
+		}
+		if len(suggested) > 0 {
+			line += "\nSuggested: /tag " + strings.Join(suggested, " ")
+		}
+		return line
+	}
+	var added []string
+	for _, tag := range args {
+		if err := m.client.TagSession(tag); err != nil {
+			return err.Error()
+		}
+		added = append(added, db.NormalizeTag(tag))
+	}
+	return "Tagged: " + strings.Join(added, ", ")
+}
+
+func (m *model) slashContext(args []string) string {
+	context := strings.TrimSpace(m.client.MemoryContext())
+	if context == "" {
+		return "Nothing was loaded from memory. Earlier conversations are loaded per directory; see preferences.memory in the config."
+	}
+	return context
+}
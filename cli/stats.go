@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/db"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var statsDaysFlag int
+
+// maxStatsRows caps the tool and error tables.
+const maxStatsRows = 10
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show how you have been using q",
+	Long: `Show your own usage patterns from the local memory database: queries per day,
+the tools run most, how long each model takes to reply, and which errors q has
+learned to fix. Nothing is sent anywhere.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			if statsDaysFlag < 1 {
+				return fmt.Errorf("--days must be at least 1")
+			}
+			stats, err := database.UsageStats(statsDaysFlag)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Last %s: %s in %s", plural(statsDaysFlag, "day", "days"), plural(stats.Queries, "query", "queries"), plural(stats.Sessions, "session", "sessions"))
+			if stats.Usage.Tokens() > 0 {
+				fmt.Printf(", %s", formatUsage(stats.Usage))
+			}
+			fmt.Println()
+			if stats.Queries == 0 {
+				return nil
+			}
+
+			fmt.Println("\nQueries per day:")
+			busiest := 1
+			for _, d := range stats.Days {
+				busiest = max(busiest, d.Queries)
+			}
+			for _, d := range stats.Days {
+				bar := strings.Repeat("█", (d.Queries*40+busiest-1)/busiest)
+				fmt.Printf("  %s  %-40s %d\n", d.Day.Format("Mon 01-02"), bar, d.Queries)
+			}
+
+			if len(stats.Tools) > 0 {
+				fmt.Println()
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "TOOL\tCALLS\tFAILED\tAVG TIME")
+				for i, t := range stats.Tools {
+					if i == maxStatsRows {
+						break
+					}
+					fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", t.Name, t.Calls, t.Errors, formatLatency(t.AvgLatency))
+				}
+				w.Flush()
+			}
+
+			if len(stats.Models) > 0 {
+				fmt.Println()
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "MODEL\tREPLIES\tAVG RESPONSE")
+				for _, m := range stats.Models {
+					fmt.Fprintf(w, "%s\t%d\t%s\n", m.Model, m.Replies, formatLatency(m.AvgLatency))
+				}
+				w.Flush()
+			}
+
+			if len(stats.Repairs) > 0 {
+				fmt.Println()
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ERROR FIXED\tTYPE\tTIMES")
+				for i, r := range stats.Repairs {
+					if i == maxStatsRows {
+						break
+					}
+					fmt.Fprintf(w, "%s\t%s\t%d\n", truncateLine(r.Signature, 60), r.Type, r.Fixes)
+				}
+				w.Flush()
+			}
+			return nil
+		})
+	},
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+func formatLatency(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%d ms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1f s", d.Seconds())
+}
+
+// truncateLine flattens s to one line of at most n characters.
+func truncateLine(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-3]) + "..."
+	}
+	return s
+}
+
+func init() {
+	statsCmd.Flags().IntVar(&statsDaysFlag, "days", 14, "How many days back to look")
+	RootCmd.AddCommand(statsCmd)
+}
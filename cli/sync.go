@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"q/config"
+	"q/db"
+	"q/types"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncRemoteFlag    string
+	syncPlaintextFlag bool
+)
+
+// syncFileName is the file used inside a git sync repository.
+const syncFileName = "shell-ai-memory.json"
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Share sessions and knowledge with your other machines",
+	Long: `Merge the sync file on your remote into the local memory database, then
+write the merged result back. The newest copy of each session and knowledge
+entry wins. Configure the remote in ~/.shell-ai/config.yaml:
+
+  preferences:
+    sync:
+      remote: s3://my-bucket/shell-ai/memory.json     # uses the aws CLI
+      # remote: https://dav.example.com/q/memory.json  # WebDAV
+      # remote: git@github.com:me/q-memory.git         # git repository
+
+When the memory database is encrypted, the sync file is encrypted with the
+same passphrase, so every machine needs the same Q_DB_KEY. --plaintext
+writes it as plain JSON instead.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		appConfig, err := config.LoadAppConfig()
+		if err != nil {
+			config.PrintConfigErrorMessage(err)
+			os.Exit(1)
+		}
+		cfg := appConfig.Preferences.Sync
+		if syncRemoteFlag != "" {
+			cfg.Remote = syncRemoteFlag
+		}
+
+		withDB(func(database *db.DB) error {
+			remote, err := newSyncRemote(cfg)
+			if err != nil {
+				return err
+			}
+			machine := cfg.Machine
+			if machine == "" {
+				machine, _ = os.Hostname()
+			}
+
+			data, err := remote.Fetch()
+			if err != nil {
+				return fmt.Errorf("fetching %s: %w", remote, err)
+			}
+			sealed := database.Encrypted()
+			if data != nil {
+				bundle, wasSealed, err := db.DecodeBundle(data)
+				if err != nil {
+					if wasSealed {
+						return err
+					}
+					return fmt.Errorf("%s is not a q sync file: %w", remote, err)
+				}
+				sealed = sealed || wasSealed
+				var since time.Time
+				if days := appConfig.Preferences.MaxHistoryDays; days > 0 {
+					since = time.Now().AddDate(0, 0, -days)
+				}
+				result, err := database.MergeBundle(bundle, since)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Pulled from %s (last written by %s): %d new sessions, %d updated, %d knowledge changes\n",
+					remote, bundle.Machine, result.SessionsAdded, result.SessionsUpdated, result.Knowledge)
+			} else {
+				fmt.Printf("%s is empty; creating it\n", remote)
+			}
+
+			bundle, err := database.ExportBundle(machine)
+			if err != nil {
+				return err
+			}
+			// Once encrypted, the remote stays so even when written from a
+			// machine whose database is not.
+			out, err := db.EncodeBundle(bundle, sealed && !syncPlaintextFlag)
+			if err != nil {
+				return err
+			}
+			if err := remote.Store(out); err != nil {
+				return fmt.Errorf("writing %s: %w", remote, err)
+			}
+			note := ""
+			if sealed && !syncPlaintextFlag {
+				note = ", encrypted"
+			}
+			fmt.Printf("Pushed %d sessions and %d knowledge entries (%s%s)\n",
+				len(bundle.Sessions), len(bundle.Entities)+len(bundle.Facts)+len(bundle.ErrorPatterns), formatSize(int64(len(out))), note)
+			return nil
+		})
+	},
+}
+
+// syncRemote reads and writes the shared sync file. Fetch returns nil data
+// when the file does not exist yet.
+type syncRemote interface {
+	Fetch() ([]byte, error)
+	Store(data []byte) error
+	String() string
+}
+
+func newSyncRemote(cfg types.SyncConfig) (syncRemote, error) {
+	if cfg.Remote == "" {
+		return nil, fmt.Errorf("no sync remote configured; set preferences.sync.remote in ~/.shell-ai/config.yaml (see q sync --help)")
+	}
+	kind := cfg.Type
+	if kind == "" {
+		switch {
+		case strings.HasPrefix(cfg.Remote, "s3://"):
+			kind = "s3"
+		case strings.HasSuffix(cfg.Remote, ".git"), strings.HasPrefix(cfg.Remote, "git@"), strings.HasPrefix(cfg.Remote, "ssh://"):
+			kind = "git"
+		case strings.HasPrefix(cfg.Remote, "http://"), strings.HasPrefix(cfg.Remote, "https://"):
+			kind = "webdav"
+		default:
+			return nil, fmt.Errorf("cannot tell what kind of remote %q is; set preferences.sync.type to s3, webdav or git", cfg.Remote)
+		}
+	}
+	switch kind {
+	case "s3":
+		return s3Remote{url: cfg.Remote}, nil
+	case "webdav":
+		return webdavRemote{url: cfg.Remote, user: os.Getenv(cfg.UsernameEnvVar), password: os.Getenv(cfg.PasswordEnvVar)}, nil
+	case "git":
+		dir, err := config.FullFilePath(".shell-ai/sync-repo")
+		if err != nil {
+			return nil, err
+		}
+		return gitRemote{url: cfg.Remote, dir: dir}, nil
+	}
+	return nil, fmt.Errorf("unknown sync type %q (use s3, webdav or git)", kind)
+}
+
+// s3Remote uses the aws CLI so the user's profiles and credentials apply.
+type s3Remote struct{ url string }
+
+func (r s3Remote) String() string { return r.url }
+
+func (r s3Remote) Fetch() ([]byte, error) {
+	if _, err := exec.LookPath("aws"); err != nil {
+		return nil, fmt.Errorf("the aws CLI is required for s3:// remotes")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("aws", "s3", "cp", r.url, "-")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "404") || strings.Contains(stderr.String(), "does not exist") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s", strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func (r s3Remote) Store(data []byte) error {
+	cmd := exec.Command("aws", "s3", "cp", "-", r.url)
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+type webdavRemote struct{ url, user, password string }
+
+func (r webdavRemote) String() string { return r.url }
+
+func (r webdavRemote) do(method string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, r.url, body)
+	if err != nil {
+		return nil, err
+	}
+	if r.user != "" || r.password != "" {
+		req.SetBasicAuth(r.user, r.password)
+	}
+	client := &http.Client{Timeout: 2 * time.Minute}
+	return client.Do(req)
+}
+
+func (r webdavRemote) Fetch() ([]byte, error) {
+	resp, err := r.do("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (r webdavRemote) Store(data []byte) error {
+	resp, err := r.do("PUT", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+// gitRemote keeps a clone under ~/.shell-ai/sync-repo and commits the sync
+// file there.
+type gitRemote struct{ url, dir string }
+
+func (r gitRemote) String() string { return r.url }
+
+func (r gitRemote) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	output, err := cmd.CombinedOutput()
+	result := strings.TrimSpace(string(output))
+	if err != nil {
+		return result, fmt.Errorf("git %s: %s", args[0], result)
+	}
+	return result, nil
+}
+
+func (r gitRemote) Fetch() ([]byte, error) {
+	if _, err := os.Stat(filepath.Join(r.dir, ".git")); err != nil {
+		if err := os.MkdirAll(filepath.Dir(r.dir), 0700); err != nil {
+			return nil, err
+		}
+		if _, err := git("clone", "--quiet", r.url, r.dir); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.git("pull", "--quiet", "--rebase"); err != nil {
+		// A new, empty remote has nothing to pull yet.
+		if out, _ := r.git("ls-remote", "--heads", "origin"); out != "" {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(r.dir, syncFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (r gitRemote) Store(data []byte) error {
+	if err := os.WriteFile(filepath.Join(r.dir, syncFileName), data, 0600); err != nil {
+		return err
+	}
+	if _, err := r.git("add", syncFileName); err != nil {
+		return err
+	}
+	if status, _ := r.git("status", "--porcelain"); status == "" {
+		return nil
+	}
+	host, _ := os.Hostname()
+	if _, err := r.git("commit", "--quiet", "-m", "Sync from "+host); err != nil {
+		return err
+	}
+	_, err := r.git("push", "--quiet", "origin", "HEAD")
+	return err
+}
+
+func init() {
+	syncCmd.Flags().StringVar(&syncRemoteFlag, "remote", "", "Remote to sync with, overriding preferences.sync.remote")
+	syncCmd.Flags().BoolVar(&syncPlaintextFlag, "plaintext", false, "Write the sync file as plain JSON even when the database is encrypted")
+	RootCmd.AddCommand(syncCmd)
+}
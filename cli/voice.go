@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"q/config"
+	"q/llm"
+	"q/tools"
+	. "q/types"
+	"q/util"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var voiceFlag bool
+var speakFlag bool
+
+const defaultTranscribeEndpoint = "https://api.openai.com/v1/audio/transcriptions"
+
+// recordCommand returns a shell command that records mono 16 kHz audio to
+// {file} for at most {seconds}, using the configured command or the first
+// recorder found.
+func recordCommand(cfg VoiceConfig) (string, error) {
+	if cfg.RecordCommand != "" {
+		return cfg.RecordCommand, nil
+	}
+	if _, err := exec.LookPath("rec"); err == nil {
+		return "rec -q -c 1 -r 16000 {file} trim 0 {seconds}", nil
+	}
+	if _, err := exec.LookPath("arecord"); err == nil {
+		return "arecord -q -f S16_LE -c 1 -r 16000 -d {seconds} {file}", nil
+	}
+	if _, err := exec.LookPath("ffmpeg"); err == nil {
+		input := "-f pulse -i default"
+		if runtime.GOOS == "darwin" {
+			input = "-f avfoundation -i :0"
+		}
+		return "ffmpeg -loglevel error -y " + input + " -ac 1 -ar 16000 -t {seconds} {file}", nil
+	}
+	return "", fmt.Errorf("no audio recorder found: install sox (rec), alsa-utils (arecord) or ffmpeg, or set voice.record_command")
+}
+
+// speakCommand returns a command that reads text on stdin and speaks it.
+func speakCommand(cfg VoiceConfig) (string, error) {
+	if cfg.SpeakCommand != "" {
+		return cfg.SpeakCommand, nil
+	}
+	if runtime.GOOS == "darwin" {
+		return "say", nil
+	}
+	for _, name := range []string{"espeak-ng", "espeak"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name + " --stdin", nil
+		}
+	}
+	return "", fmt.Errorf("no text-to-speech command found: install espeak-ng or set voice.speak_command")
+}
+
+func recordAudio(cfg VoiceConfig, path string) error {
+	command, err := recordCommand(cfg)
+	if err != nil {
+		return err
+	}
+	maxSeconds := cfg.MaxSeconds
+	if maxSeconds <= 0 {
+		maxSeconds = 60
+	}
+	command = strings.ReplaceAll(command, "{file}", `"$1"`)
+	command = strings.ReplaceAll(command, "{seconds}", strconv.Itoa(maxSeconds))
+
+	cmd := exec.Command("sh", "-c", "exec "+command, "sh", path)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start recorder: %w", err)
+	}
+
+	prompt := fmt.Sprintf("Recording... press Enter to stop (max %ds) ", maxSeconds)
+	if _, err := util.PromptTTY(prompt); err == nil {
+		// Recorders finalize the file on SIGINT; it's a no-op if already done.
+		cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.Wait()
+
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return fmt.Errorf("nothing was recorded (check your microphone and voice.record_command)")
+	}
+	return nil
+}
+
+var codeBlockPattern = regexp.MustCompile("(?s)```.*?```")
+
+// speakableText drops code blocks and markdown markup that read badly aloud.
+func speakableText(response string) string {
+	text := codeBlockPattern.ReplaceAllString(response, " (code shown on screen) ")
+	text = strings.NewReplacer("`", "", "*", "", "#", "", "_", " ").Replace(text)
+	return strings.TrimSpace(text)
+}
+
+func speak(cfg VoiceConfig, text string) error {
+	command, err := speakCommand(cfg)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func runVoiceMode(prompt string) {
+	styleRed := lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	styleDim := lipgloss.NewStyle().Faint(true)
+	fail := func(err error) {
+		fmt.Println(styleRed.Render(err.Error()))
+		os.Exit(1)
+	}
+
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(1)
+	}
+	voice := appConfig.Preferences.Voice
+
+	endpoint := voice.TranscribeEndpoint
+	authEnv := voice.AuthEnvVar
+	if endpoint == "" {
+		endpoint = defaultTranscribeEndpoint
+		if authEnv == "" {
+			authEnv = "OPENAI_API_KEY"
+		}
+	}
+	model := voice.TranscribeModel
+	if model == "" {
+		model = "whisper-1"
+	}
+	apiKey := ""
+	if authEnv != "" {
+		if apiKey = util.APIKey(authEnv, voice.AuthSource); apiKey == "" {
+			fail(fmt.Errorf("%s is not set; it is needed for transcription (see voice.auth_env_var)", authEnv))
+		}
+	}
+
+	modelConfig := loadModelConfig()
+
+	f, err := os.CreateTemp("", "q-voice-*.wav")
+	if err != nil {
+		fail(err)
+	}
+	f.Close()
+	audioPath := f.Name()
+
+	if err := recordAudio(voice, audioPath); err != nil {
+		os.Remove(audioPath)
+		fail(err)
+	}
+
+	fmt.Println(styleDim.Render("Transcribing..."))
+	transcript, err := llm.Transcribe(context.Background(), endpoint, model, apiKey, audioPath)
+	os.Remove(audioPath)
+	if err != nil {
+		fail(err)
+	}
+	if transcript == "" {
+		fail(fmt.Errorf("no speech recognized"))
+	}
+	fmt.Println(styleDim.Render("You said: ") + transcript)
+	fmt.Println()
+
+	if prompt != "" {
+		transcript = prompt + "\n\n" + transcript
+	}
+
+	c := llm.NewLLMClient(modelConfig)
+	defer c.Close()
+	tools.SetApprovalHandler(ttyApprovalHandler)
+	tools.SetInputHandler(ttyInputHandler)
+
+	response, err := c.Query(transcript)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		c.Close()
+		os.Exit(1)
+	}
+	fmt.Println(response)
+
+	if speakFlag || voice.Speak {
+		if err := speak(voice, speakableText(response)); err != nil {
+			fmt.Println(styleDim.Render(fmt.Sprintf("Could not speak the answer: %v", err)))
+		}
+	}
+}
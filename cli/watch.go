@@ -0,0 +1,320 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/config"
+	"q/db"
+	"q/tools"
+	"q/util"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxWatchRepairs is how many repairs the dashboard keeps.
+const maxWatchRepairs = 50
+
+// watchRun is a build or test command's latest run.
+type watchRun struct {
+	tools.BuildEvent
+	at time.Time
+}
+
+type watchBuildMsg tools.BuildEvent
+type watchErrorMsg tools.ErrorEvent
+type watchRepairMsg tools.RepairResult
+type watchRevertMsg struct {
+	result string
+	err    error
+}
+
+// watchModel is the watch mode dashboard: the state of the last build, its
+// errors, the repairs attempted with what they changed, and repairs
+// waiting for approval.
+type watchModel struct {
+	watcher *tools.Watcher
+	spinner spinner.Model
+
+	// runs is the latest run of each target's commands, build first.
+	runs []watchRun
+	// cycles is the build cycle each target was last built in.
+	cycles   map[string]int
+	errors   []tools.ErrorEvent
+	repairs  []tools.RepairResult
+	selected int
+	approval *approvalRequestMsg
+	// notice is the outcome of the last undo.
+	notice string
+	width  int
+	height int
+}
+
+var (
+	watchTitleStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("2")).Bold(true)
+	watchHeadStyle   = lipgloss.NewStyle().Bold(true)
+	watchDimStyle    = lipgloss.NewStyle().Faint(true)
+	watchOKStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	watchFailStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	watchWarnStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true)
+	watchAddStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	watchRemoveStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+func runWatchMode() {
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		config.PrintConfigErrorMessage(err)
+		os.Exit(1)
+	}
+	applyToolPreferences(appConfig)
+
+	// Learned fixes come from the knowledge graph.
+	if database, err := db.Open(); err == nil {
+		defer database.Close()
+		tools.InitKnowledgeDB(database)
+	}
+
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	m := watchModel{spinner: s, cycles: make(map[string]int), width: util.GetTermSafeMaxWidth()}
+	p := tea.NewProgram(&m, tea.WithAltScreen())
+	tools.SetApprovalHandler(approvalHandler(p))
+
+	m.watcher, err = tools.StartWatcher(tools.WatchConfig{
+		OnBuildCallback:  func(e tools.BuildEvent) { p.Send(watchBuildMsg(e)) },
+		OnErrorCallback:  func(e tools.ErrorEvent) { p.Send(watchErrorMsg(e)) },
+		OnRepairCallback: func(r tools.RepairResult) { p.Send(watchRepairMsg(r)) },
+		ConfirmRepairs:   true,
+	})
+	if err != nil {
+		fmt.Printf("Error starting watch: %v\n", err)
+		os.Exit(1)
+	}
+	defer m.watcher.Stop()
+
+	if _, err := p.Run(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func (m *watchModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m *watchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	case watchBuildMsg:
+		// A target building again replaces its errors; those of targets
+		// not rebuilt stand.
+		if m.cycles[msg.Target] != msg.Cycle {
+			m.cycles[msg.Target] = msg.Cycle
+			errors := m.errors[:0]
+			for _, e := range m.errors {
+				if e.Target != msg.Target {
+					errors = append(errors, e)
+				}
+			}
+			m.errors = errors
+		}
+		run := watchRun{tools.BuildEvent(msg), time.Now()}
+		for i := range m.runs {
+			if m.runs[i].Target == msg.Target && m.runs[i].Command == msg.Command {
+				m.runs[i] = run
+				return m, nil
+			}
+		}
+		m.runs = append(m.runs, run)
+	case watchErrorMsg:
+		m.errors = append(m.errors, tools.ErrorEvent(msg))
+	case watchRepairMsg:
+		m.repairs = append(m.repairs, tools.RepairResult(msg))
+		if len(m.repairs) > maxWatchRepairs {
+			m.repairs = m.repairs[len(m.repairs)-maxWatchRepairs:]
+		}
+		m.selected = len(m.repairs) - 1
+	case watchRevertMsg:
+		m.notice = strings.TrimSpace(msg.result)
+		if msg.err != nil {
+			m.notice = "Undo failed: " + msg.err.Error()
+		}
+	case approvalRequestMsg:
+		m.approval = &msg
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *watchModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.approval != nil {
+		switch msg.String() {
+		case "a", "y", "enter":
+			m.approval.reply <- true
+			m.approval = nil
+		case "s", "n", "esc":
+			m.approval.reply <- false
+			m.approval = nil
+		case "ctrl+c", "q":
+			m.approval.reply <- false
+			m.approval = nil
+			return m, tea.Quit
+		}
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "ctrl+c", "q", "esc":
+		return m, tea.Quit
+	case "r":
+		m.watcher.Rebuild()
+	case "u":
+		// Undoing asks for approval through the dashboard, so it cannot
+		// run inside Update.
+		return m, func() tea.Msg {
+			result, err := tools.RevertLastRepair(false)
+			return watchRevertMsg{result, err}
+		}
+	case "up", "k":
+		if m.selected > 0 {
+			m.selected--
+		}
+	case "down", "j":
+		if m.selected < len(m.repairs)-1 {
+			m.selected++
+		}
+	}
+	return m, nil
+}
+
+func (m *watchModel) View() string {
+	var b strings.Builder
+	cwd, _ := os.Getwd()
+	b.WriteString(watchTitleStyle.Render("Shell-AI Watch Mode") + "  " + watchDimStyle.Render(cwd) + "\n\n")
+
+	if len(m.runs) == 0 {
+		b.WriteString(m.spinner.View() + " Starting...\n")
+	}
+	var failed *watchRun
+	for i, run := range m.runs {
+		when := watchDimStyle.Render(fmt.Sprintf(" in %s, %s", run.Duration.Round(100*time.Millisecond), run.at.Format("15:04:05")))
+		target := ""
+		if run.Target != "" {
+			target = watchHeadStyle.Render(run.Target) + " "
+		}
+		switch {
+		case run.Running:
+			b.WriteString(m.spinner.View() + " " + target + "Running " + run.Command + "\n")
+		case run.Success:
+			b.WriteString(watchOKStyle.Render("✓ ") + target + watchOKStyle.Render(run.Command+" passed") + when + "\n")
+		default:
+			b.WriteString(watchFailStyle.Render("✗ ") + target + watchFailStyle.Render(run.Command+" failed") + when + "\n")
+			if failed == nil {
+				failed = &m.runs[i]
+			}
+		}
+	}
+
+	if len(m.errors) > 0 {
+		b.WriteString("\n" + watchHeadStyle.Render(fmt.Sprintf("Errors (%d)", len(m.errors))) + "\n")
+		for i, e := range m.errors {
+			if i == 10 {
+				b.WriteString(watchDimStyle.Render(fmt.Sprintf("  ... and %d more", len(m.errors)-i)) + "\n")
+				break
+			}
+			where := e.File
+			if e.Line > 0 {
+				where = fmt.Sprintf("%s:%d", e.File, e.Line)
+			}
+			if where != "" {
+				where += " "
+			}
+			if e.Target != "" {
+				where = e.Target + ": " + where
+			}
+			b.WriteString(truncateLine(fmt.Sprintf("  [%s] %s%s", e.Type, where, e.Message), m.width) + "\n")
+		}
+	} else if failed != nil {
+		// Nothing in the output was recognized as an error.
+		b.WriteString("\n" + watchDimStyle.Render(truncateLine(failed.Output, m.width)) + "\n")
+	}
+
+	if m.notice != "" {
+		b.WriteString("\n" + m.notice + "\n")
+	}
+
+	if m.approval != nil {
+		title := "Proposed repair"
+		if m.approval.tool == "revert_last_repair" {
+			title = "Undo repair"
+		}
+		b.WriteString("\n" + watchWarnStyle.Render(title) + "\n")
+		b.WriteString(lipgloss.NewStyle().Width(m.width).PaddingLeft(2).Render(m.approval.action) + "\n")
+		b.WriteString("[a]pprove  [s]kip\n")
+	}
+
+	if len(m.repairs) > 0 {
+		b.WriteString("\n" + watchHeadStyle.Render(fmt.Sprintf("Repairs (%d)", len(m.repairs))) + "\n")
+		first := max(0, len(m.repairs)-5)
+		first = min(first, m.selected)
+		for i := first; i < len(m.repairs) && i < first+5; i++ {
+			r := m.repairs[i]
+			cursor := "  "
+			if i == m.selected {
+				cursor = "> "
+			}
+			line := watchFailStyle.Render("✗ not fixed")
+			if r.Attempts == 0 {
+				line = watchDimStyle.Render("- no fix tried")
+			}
+			if r.Success {
+				line = watchOKStyle.Render("✓ " + r.Solution)
+				if r.Command != "" {
+					line += watchDimStyle.Render(" (" + r.Command + ")")
+				}
+			}
+			b.WriteString(cursor + line + " " + truncateLine(r.Error.Message, m.width/2) + "\n")
+		}
+		if r := m.repairs[m.selected]; r.Diff != "" {
+			b.WriteString("\n" + renderDiff(r.Diff, max(m.height-lipgloss.Height(b.String())-3, 5)))
+		}
+	}
+
+	b.WriteString("\n" + watchDimStyle.Render("r rebuild · u undo last repair · ↑/↓ select repair · q quit"))
+	return b.String()
+}
+
+// renderDiff colors a unified diff, showing at most lines of it.
+func renderDiff(diff string, lines int) string {
+	var b strings.Builder
+	all := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	for i, line := range all {
+		if i == lines {
+			b.WriteString(watchDimStyle.Render(fmt.Sprintf("... %d more lines", len(all)-i)) + "\n")
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			b.WriteString(watchHeadStyle.Render(line))
+		case strings.HasPrefix(line, "+"):
+			b.WriteString(watchAddStyle.Render(line))
+		case strings.HasPrefix(line, "-"):
+			b.WriteString(watchRemoveStyle.Render(line))
+		default:
+			b.WriteString(watchDimStyle.Render(line))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
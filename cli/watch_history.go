@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"q/db"
+	"q/util"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchHistoryAllFlag   bool
+	watchHistoryLimitFlag int
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Start self-healing watch mode (same as q --watch)",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runWatchMode()
+	},
+}
+
+var watchHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show what broke in watch mode and what was fixed",
+	Long: `List the errors watch mode found in this directory across sessions, newest
+first, with whether each has been resolved and how repairs of it went. A
+repair is "unverified" until a build after it has run.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		withDB(func(database *db.DB) error {
+			var paths []string
+			if !watchHistoryAllFlag {
+				cwd, _ := os.Getwd()
+				paths = []string{db.ProjectKey(cwd)}
+			}
+			history, err := database.WatchHistory(paths, watchHistoryLimitFlag)
+			if err != nil {
+				return err
+			}
+			if len(history) == 0 {
+				fmt.Println("No watch mode errors recorded yet. Start watch mode with q watch.")
+				return nil
+			}
+
+			width := util.GetTermSafeMaxWidth()
+			var resolved, repaired, fixed int
+			for _, e := range history {
+				mark := "✗"
+				if e.ResolvedAt != nil {
+					mark = "✓"
+					resolved++
+				}
+				where := e.File
+				if e.Line > 0 {
+					where = fmt.Sprintf("%s:%d", e.File, e.Line)
+				}
+				if e.Target != "" && e.Target != "." {
+					where = e.Target + ": " + where
+				}
+				line := fmt.Sprintf("%s %s  [%s] %s - %s", mark, e.DetectedAt.Local().Format("2006-01-02 15:04"), e.Type, where, e.Message)
+				if e.Occurrences > 1 {
+					line += fmt.Sprintf(" (%s)", plural(e.Occurrences, "time", "times"))
+				}
+				fmt.Println(truncateLine(line, width))
+				if watchHistoryAllFlag && e.ProjectPath != "" {
+					fmt.Println("    " + e.ProjectPath)
+				}
+
+				errorFixed := false
+				for _, r := range e.Repairs {
+					outcome := "unverified"
+					switch {
+					case !r.Success:
+						outcome = "fix failed"
+					case r.Fixed == nil:
+					case *r.Fixed:
+						outcome = "fixed"
+						errorFixed = true
+					default:
+						outcome = "did not fix"
+					}
+					repair := r.Solution
+					if r.Command != "" {
+						repair += " (" + r.Command + ")"
+					}
+					fmt.Println("    " + truncateLine(fmt.Sprintf("%s  %s: %s", r.CreatedAt.Local().Format("15:04"), outcome, repair), width-4))
+				}
+				if len(e.Repairs) > 0 {
+					repaired++
+				}
+				if errorFixed {
+					fixed++
+				}
+			}
+			fmt.Printf("\n%s, %d resolved; repairs were tried on %d and fixed %d.\n",
+				plural(len(history), "error", "errors"), resolved, repaired, fixed)
+			return nil
+		})
+	},
+}
+
+func init() {
+	watchHistoryCmd.Flags().BoolVarP(&watchHistoryAllFlag, "all", "a", false, "Include errors from other directories")
+	watchHistoryCmd.Flags().IntVarP(&watchHistoryLimitFlag, "limit", "n", 20, "Maximum number of errors to show")
+	watchCmd.AddCommand(watchHistoryCmd)
+	RootCmd.AddCommand(watchCmd)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	. "q/types"
+	"strings"
+)
+
+// ResolveModel returns the model of config that name refers to: the model
+// called name, the model the alias name points to, or else the one model
+// whose name, alias or API model name matches name ignoring case, starts
+// with it, or contains it, in that order. Names that match several models
+// are an error listing them.
+func ResolveModel(config AppConfig, name string) (ModelConfig, error) {
+	for _, m := range config.Models {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+	if target, ok := config.Aliases[name]; ok {
+		for _, m := range config.Models {
+			if m.Name == target {
+				return m, nil
+			}
+		}
+		return ModelConfig{}, fmt.Errorf("alias '%s' points to '%s', which is not a configured model", name, target)
+	}
+
+	lower := strings.ToLower(name)
+	matchers := []func(string) bool{
+		func(s string) bool { return strings.ToLower(s) == lower },
+		func(s string) bool { return strings.HasPrefix(strings.ToLower(s), lower) },
+		func(s string) bool { return strings.Contains(strings.ToLower(s), lower) },
+	}
+	for _, match := range matchers {
+		var found []ModelConfig
+		for _, m := range config.Models {
+			if match(m.Name) || match(m.ModelName) || matchesAlias(config.Aliases, m.Name, match) {
+				found = append(found, m)
+			}
+		}
+		if len(found) == 1 {
+			return found[0], nil
+		}
+		if len(found) > 1 {
+			return ModelConfig{}, fmt.Errorf("model '%s' is ambiguous: it matches %s", name, strings.Join(modelNames(found), ", "))
+		}
+	}
+
+	available := strings.Join(modelNames(config.Models), ", ")
+	if len(config.Aliases) > 0 {
+		available += " (aliases: " + strings.Join(sortedKeys(config.Aliases), ", ") + ")"
+	}
+	return ModelConfig{}, fmt.Errorf("model '%s' not found. Available: %s", name, available)
+}
+
+// matchesAlias reports whether match accepts any alias of the model called
+// model.
+func matchesAlias(aliases map[string]string, model string, match func(string) bool) bool {
+	for alias, target := range aliases {
+		if target == model && match(alias) {
+			return true
+		}
+	}
+	return false
+}
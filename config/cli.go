@@ -2,12 +2,20 @@ package config
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"q/db"
+	"q/llm"
 	"q/types"
 	"q/util"
 
@@ -16,6 +24,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
+	"gopkg.in/yaml.v2"
 )
 
 const listHeight = 14
@@ -99,11 +108,58 @@ type configSavedMsg struct{}
 type editorFinishedMsg struct{ err error }
 type setDefaultModelMsg struct{ model string }
 type toggleBoolPrefMsg struct{ field string }
+type editModelMsg struct {
+	// name is the model's name before the edit.
+	name  string
+	field string
+	value string
+	err   error
+}
+type setPrefMsg struct {
+	path  []string
+	value string
+}
 type deleteModelMsg struct{ modelName string }
 type addModelMsg struct{ model types.ModelConfig }
+type addProfileMsg struct{ name string }
+type deleteProfileMsg struct{ name string }
+type setDefaultProfileMsg struct{ name string }
+type setProfileModelMsg struct{ profile, model string }
+type savePromptMsg struct {
+	name string
+	text string
+	err  error
+}
+type renamePromptMsg struct{ from, to string }
+type deletePromptMsg struct{ name string }
+
+// setPromptMsg has the model, or else the profile, use the library prompt
+// called prompt, or no library prompt if it is "".
+type setPromptMsg struct{ prompt, model, profile string }
+type connectionTestingMsg struct{ menuTitle string }
+type listingModelsMsg struct{}
+type apiKeyStoredMsg struct {
+	authEnvVar string
+	removed    bool
+	err        error
+}
+type modelsListedMsg struct {
+	preset types.ProviderPreset
+	models []string
+	err    error
+}
+type connectionTestedMsg struct {
+	menuTitle string
+	result    llm.ConnectionTest
+}
+type dataClearedMsg struct {
+	dataType string
+	err      error
+}
 type setInputModeMsg struct {
 	prompt   string
 	initial  string
+	secret   bool
 	onSubmit func(string) tea.Cmd
 }
 
@@ -134,6 +190,64 @@ func cmdSetDefaultModel(model string) tea.Cmd {
 func cmdTogglePref(field string) tea.Cmd      { return func() tea.Msg { return toggleBoolPrefMsg{field} } }
 func cmdDeleteModel(name string) tea.Cmd      { return func() tea.Msg { return deleteModelMsg{name} } }
 func cmdAddModel(m types.ModelConfig) tea.Cmd { return func() tea.Msg { return addModelMsg{m} } }
+func cmdAddProfile(name string) tea.Cmd       { return func() tea.Msg { return addProfileMsg{name} } }
+func cmdDeleteProfile(name string) tea.Cmd    { return func() tea.Msg { return deleteProfileMsg{name} } }
+func cmdSetDefaultProfile(name string) tea.Cmd {
+	return func() tea.Msg { return setDefaultProfileMsg{name} }
+}
+func cmdSetProfileModel(profile, model string) tea.Cmd {
+	return func() tea.Msg { return setProfileModelMsg{profile, model} }
+}
+func cmdEditModel(name, field, value string) tea.Cmd {
+	return func() tea.Msg { return editModelMsg{name: name, field: field, value: value} }
+}
+func cmdSetPref(path []string, value string) tea.Cmd {
+	return func() tea.Msg { return setPrefMsg{path, value} }
+}
+func cmdRenamePrompt(from, to string) tea.Cmd {
+	return func() tea.Msg { return renamePromptMsg{from, to} }
+}
+func cmdDeletePrompt(name string) tea.Cmd { return func() tea.Msg { return deletePromptMsg{name} } }
+func cmdSetPrompt(prompt, model, profile string) tea.Cmd {
+	return func() tea.Msg { return setPromptMsg{prompt, model, profile} }
+}
+
+// connectionTestTimeout is how long Test Connection waits for a reply.
+const connectionTestTimeout = 30 * time.Second
+
+func cmdTestConnection(menuTitle string, mc types.ModelConfig) tea.Cmd {
+	return tea.Sequence(
+		func() tea.Msg { return connectionTestingMsg{menuTitle} },
+		func() tea.Msg {
+			ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+			defer cancel()
+			return connectionTestedMsg{menuTitle, llm.TestConnection(ctx, mc)}
+		},
+	)
+}
+
+// cmdStoreAPIKey keeps key in the keychain for the models reading
+// authEnvVar, or removes it when key is "".
+func cmdStoreAPIKey(authEnvVar, key string) tea.Cmd {
+	return func() tea.Msg {
+		account := util.APIKeyAccount(authEnvVar)
+		if key == "" {
+			return apiKeyStoredMsg{authEnvVar, true, util.KeychainDelete(util.KeychainService, account)}
+		}
+		return apiKeyStoredMsg{authEnvVar, false, util.KeychainSet(util.KeychainService, account, "shell-ai API key ("+authEnvVar+")", key)}
+	}
+}
+func cmdListModels(preset types.ProviderPreset) tea.Cmd {
+	return tea.Sequence(
+		func() tea.Msg { return listingModelsMsg{} },
+		func() tea.Msg {
+			ctx, cancel := context.WithTimeout(context.Background(), connectionTestTimeout)
+			defer cancel()
+			models, err := llm.ListModels(ctx, types.ModelConfig{Endpoint: preset.Endpoint, Auth: preset.AuthEnvVar, AuthHeader: preset.AuthHeader})
+			return modelsListedMsg{preset, models, err}
+		},
+	)
+}
 func cmdSaveConfig(cfg AppConfig) tea.Cmd {
 	return func() tea.Msg { SaveAppConfig(cfg); return configSavedMsg{} }
 }
@@ -141,9 +255,15 @@ func cmdSetInput(prompt, initial string, onSubmit func(string) tea.Cmd) tea.Cmd
 	return func() tea.Msg { return setInputModeMsg{prompt: prompt, initial: initial, onSubmit: onSubmit} }
 }
 
+// cmdSetSecretInput asks for a value, such as an API key, without showing
+// it.
+func cmdSetSecretInput(prompt string, onSubmit func(string) tea.Cmd) tea.Cmd {
+	return func() tea.Msg { return setInputModeMsg{prompt: prompt, secret: true, onSubmit: onSubmit} }
+}
+
 func openEditor() tea.Cmd {
 	return func() tea.Msg {
-		fullPath, err := FullFilePath(configFilePath)
+		fullPath, err := FullFilePath(configFile())
 		if err != nil {
 			return editorFinishedMsg{err: err}
 		}
@@ -159,6 +279,49 @@ func openEditor() tea.Cmd {
 	}
 }
 
+// cmdEditPrompt opens the system prompt of the model called name in
+// $EDITOR.
+func cmdEditPrompt(name, prompt string) tea.Cmd {
+	return cmdEditText(prompt, func(value string, err error) tea.Msg {
+		return editModelMsg{name: name, field: "prompt", value: value, err: err}
+	})
+}
+
+// cmdEditLibraryPrompt opens the library prompt called name, whose text is
+// text, in $EDITOR, saving it as a new prompt if there is none by that
+// name.
+func cmdEditLibraryPrompt(name, text string) tea.Cmd {
+	return cmdEditText(text, func(value string, err error) tea.Msg {
+		return savePromptMsg{name, value, err}
+	})
+}
+
+// cmdEditText opens text in $EDITOR, handing it the terminal until it
+// exits, and passes what was saved to done.
+func cmdEditText(text string, done func(string, error) tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		f, err := os.CreateTemp("", "q-prompt-*.md")
+		if err != nil {
+			return done("", err)
+		}
+		f.WriteString(text)
+		f.Close()
+		editor := os.Getenv("EDITOR")
+		if editor == "" {
+			editor = "vim"
+		}
+		cmd := exec.Command(editor, f.Name()) //nolint:gosec
+		return tea.ExecProcess(cmd, func(err error) tea.Msg {
+			defer os.Remove(f.Name())
+			if err != nil {
+				return done("", err)
+			}
+			data, err := os.ReadFile(f.Name())
+			return done(strings.TrimSpace(string(data)), err)
+		})()
+	}
+}
+
 func openBrowser(url string) tea.Cmd {
 	return func() tea.Msg {
 		util.OpenBrowser(url)
@@ -205,10 +368,45 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.appConfig.Preferences.ShowToolActivity = !m.appConfig.Preferences.ShowToolActivity
 		case "auto_copy_code":
 			m.appConfig.Preferences.AutoCopyCode = !m.appConfig.Preferences.AutoCopyCode
+		case "summarize_docs":
+			m.appConfig.Preferences.SummarizeDocs = !m.appConfig.Preferences.SummarizeDocs
 		}
 		SaveAppConfig(m.appConfig)
 		m.list = m.state.menu(m.appConfig)
 		return m, nil
+	case editModelMsg:
+		err := msg.err
+		if err == nil {
+			var edited types.ModelConfig
+			if edited, err = editModel(&m.appConfig, msg.name, msg.field, msg.value); err == nil {
+				SaveAppConfig(m.appConfig)
+				// The menu finds its model by name.
+				m.state.menu = modelDetailsMenu(edited)
+			}
+		}
+		m.list = m.state.menu(m.appConfig)
+		m.list.Select(m.state.listIndex)
+		if err != nil {
+			m.list.Title += " · " + styleRed.Render(err.Error())
+		}
+		return m, nil
+	case setPrefMsg:
+		field := prefField(reflect.ValueOf(&m.appConfig.Preferences).Elem(), msg.path)
+		var err error
+		if msg.value == "" {
+			field.Set(reflect.Zero(field.Type()))
+		} else {
+			err = setFromEnv(field, msg.value)
+		}
+		if err == nil {
+			SaveAppConfig(m.appConfig)
+		}
+		m.list = m.state.menu(m.appConfig)
+		m.list.Select(m.state.listIndex)
+		if err != nil {
+			m.list.Title += " · " + styleRed.Render(fmt.Sprintf("%s: %s", strings.Join(msg.path, "."), err))
+		}
+		return m, nil
 	case deleteModelMsg:
 		var newModels []types.ModelConfig
 		for _, mm := range m.appConfig.Models {
@@ -223,6 +421,134 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.appConfig.Models = append(m.appConfig.Models, msg.model)
 		SaveAppConfig(m.appConfig)
 		return m, cmdBack()
+	case addProfileMsg:
+		if msg.name == "" {
+			return m, nil
+		}
+		if m.appConfig.Profiles == nil {
+			m.appConfig.Profiles = make(map[string]Profile)
+		}
+		if _, ok := m.appConfig.Profiles[msg.name]; !ok {
+			m.appConfig.Profiles[msg.name] = Profile{}
+			SaveAppConfig(m.appConfig)
+		}
+		m.list = m.state.menu(m.appConfig)
+		return m, cmdSetMenu(profileDetailsMenu(msg.name))
+	case deleteProfileMsg:
+		delete(m.appConfig.Profiles, msg.name)
+		if m.appConfig.Profile == msg.name {
+			m.appConfig.Profile = ""
+		}
+		SaveAppConfig(m.appConfig)
+		next, cmd := m.Update(backMsg{})
+		m = next.(model)
+		return m, tea.Sequence(cmd, cmdBack())
+	case setDefaultProfileMsg:
+		m.appConfig.Profile = msg.name
+		SaveAppConfig(m.appConfig)
+		m.list = m.state.menu(m.appConfig)
+		return m, nil
+	case setProfileModelMsg:
+		profile := m.appConfig.Profiles[msg.profile]
+		if profile.Preferences == nil {
+			profile.Preferences = make(map[string]interface{})
+		}
+		profile.Preferences["default_model"] = msg.model
+		m.appConfig.Profiles[msg.profile] = profile
+		SaveAppConfig(m.appConfig)
+		return m, cmdBack()
+	case savePromptMsg:
+		err := msg.err
+		_, exists := m.appConfig.Prompts[msg.name]
+		if err == nil && msg.text == "" {
+			err = fmt.Errorf("the prompt is empty, so it was not saved")
+		}
+		if err == nil {
+			if m.appConfig.Prompts == nil {
+				m.appConfig.Prompts = make(map[string]string)
+			}
+			m.appConfig.Prompts[msg.name] = msg.text
+			SaveAppConfig(m.appConfig)
+		}
+		m.list = m.state.menu(m.appConfig)
+		m.list.Select(m.state.listIndex)
+		if err != nil {
+			m.list.Title += " · " + styleRed.Render(err.Error())
+			return m, nil
+		}
+		if !exists {
+			return m, cmdSetMenu(promptDetailsMenu(msg.name))
+		}
+		return m, nil
+	case renamePromptMsg:
+		err := renamePrompt(&m.appConfig, msg.from, msg.to)
+		if err == nil {
+			SaveAppConfig(m.appConfig)
+			// The menu finds its prompt by name.
+			m.state.menu = promptDetailsMenu(msg.to)
+		}
+		m.list = m.state.menu(m.appConfig)
+		m.list.Select(m.state.listIndex)
+		if err != nil {
+			m.list.Title += " · " + styleRed.Render(err.Error())
+		}
+		return m, nil
+	case deletePromptMsg:
+		deletePrompt(&m.appConfig, msg.name)
+		SaveAppConfig(m.appConfig)
+		next, cmd := m.Update(backMsg{})
+		m = next.(model)
+		return m, tea.Sequence(cmd, cmdBack())
+	case setPromptMsg:
+		if msg.model != "" {
+			for i := range m.appConfig.Models {
+				if m.appConfig.Models[i].Name == msg.model {
+					m.appConfig.Models[i].SystemPrompt = msg.prompt
+				}
+			}
+		} else {
+			profile := m.appConfig.Profiles[msg.profile]
+			profile.SystemPrompt = msg.prompt
+			m.appConfig.Profiles[msg.profile] = profile
+		}
+		SaveAppConfig(m.appConfig)
+		m.list = m.state.menu(m.appConfig)
+		m.list.Select(m.state.listIndex)
+		return m, nil
+	case connectionTestingMsg:
+		m.setItemData(msg.menuTitle, "Test Connection", "testing…")
+		return m, nil
+	case connectionTestedMsg:
+		m.setItemData(msg.menuTitle, "Test Connection", connectionTestStatus(msg.result))
+		return m, nil
+	case apiKeyStoredMsg:
+		if msg.err != nil {
+			m.list.Title += " · " + msg.err.Error()
+			return m, nil
+		}
+		source, status := util.AuthSourceKeychain, "key stored in the keychain"
+		if msg.removed {
+			source, status = "", "key removed from the keychain"
+		}
+		setAuthSource(&m.appConfig, msg.authEnvVar, source)
+		SaveAppConfig(m.appConfig)
+		m.list = m.state.menu(m.appConfig)
+		m.list.Select(m.state.listIndex)
+		m.list.Title += " · " + status
+		return m, nil
+	case listingModelsMsg:
+		m.list.Title += " · fetching models…"
+		return m, nil
+	case modelsListedMsg:
+		m.list = m.state.menu(m.appConfig)
+		m.list.Select(m.state.listIndex)
+		if msg.err != nil {
+			return m, modelIDStep(msg.preset, "could not list models: "+truncateString(msg.err.Error(), 50))
+		}
+		if len(msg.models) == 0 {
+			return m, modelIDStep(msg.preset, "the provider listed no models")
+		}
+		return m, cmdSetMenu(pickModelMenu(msg.preset, msg.models))
 	case setInputModeMsg:
 		m.inputMode = inputText
 		m.inputPrompt = msg.prompt
@@ -230,13 +556,31 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		ti := textinput.New()
 		ti.Placeholder = msg.prompt
 		ti.SetValue(msg.initial)
+		if msg.secret {
+			ti.EchoMode = textinput.EchoPassword
+			ti.EchoCharacter = '•'
+		}
 		ti.Focus()
 		ti.Width = 64
 		m.textInput = ti
 		return m, textinput.Blink
+	case dataClearedMsg:
+		next, cmd := m.Update(backMsg{})
+		m = next.(model)
+		status := map[string]string{
+			"history":   "Conversation history cleared.",
+			"knowledge": "Knowledge graph cleared.",
+			"docs":      "Documentation cache cleared.",
+			"all":       "All data deleted.",
+		}[msg.dataType]
+		if msg.err != nil {
+			status = "Failed to clear " + msg.dataType + ": " + msg.err.Error()
+		}
+		m.list.Title += " · " + status
+		return m, cmd
 	case editorFinishedMsg:
 		if msg.err == nil {
-			if cfg, err := LoadAppConfig(); err == nil {
+			if cfg, err := loadConfigFile(); err == nil {
 				m.appConfig = cfg
 				m.list = m.state.menu(m.appConfig)
 			}
@@ -335,8 +679,10 @@ func mainMenu(appConfig AppConfig) list.Model {
 		{title: "Default Model", data: defaultModel, selectCmd: cmdSetMenu(defaultModelSelectMenu)},
 		{title: "Manage Models", data: fmt.Sprintf("%d configured", len(appConfig.Models)), selectCmd: cmdSetMenu(manageModelsMenu)},
 		{title: "Add Provider / Model", selectCmd: cmdSetMenu(addModelProviderMenu)},
+		{title: "Profiles", data: profileSummary(appConfig), selectCmd: cmdSetMenu(profilesMenu)},
+		{title: "Prompt Library", data: fmt.Sprintf("%d saved", len(appConfig.Prompts)), selectCmd: cmdSetMenu(promptsMenu)},
 		{title: "Settings", selectCmd: cmdSetMenu(settingsMenu)},
-		{title: "Edit Config File", data: "~/.shell-ai/config.yaml", selectCmd: openEditor()},
+		{title: "Edit Config File", data: "~/" + filepath.ToSlash(configFile()), selectCmd: openEditor()},
 		{title: "Reset to Defaults", selectCmd: cmdSetMenu(resetConfirmMenu)},
 		{title: "Documentation", selectCmd: openBrowser("https://github.com/ruca-radio/shell-ai")},
 		{title: "Quit", data: "esc", selectCmd: cmdQuit()},
@@ -376,32 +722,220 @@ func manageModelsMenu(appConfig AppConfig) list.Model {
 
 func modelDetailsMenu(mc types.ModelConfig) menuFunc {
 	return func(appConfig AppConfig) list.Model {
+		for _, m := range appConfig.Models {
+			if m.Name == mc.Name {
+				mc = m
+				break
+			}
+		}
 		display := mc.Name
 		if display == "" {
 			display = mc.ModelName
 		}
 		authStatus := "None required"
 		if mc.Auth != "" {
-			if os.Getenv(mc.Auth) != "" {
+			switch {
+			case os.Getenv(mc.Auth) != "":
 				authStatus = mc.Auth + " ✓"
-			} else {
+			case mc.AuthSource == util.AuthSourceKeychain && util.APIKey(mc.Auth, mc.AuthSource) != "":
+				authStatus = mc.Auth + " (in keychain ✓)"
+			default:
 				authStatus = mc.Auth + " (missing)"
 			}
 		}
+		edit := func(field, prompt, current string) tea.Cmd {
+			return cmdSetInput(prompt, current, func(value string) tea.Cmd { return cmdEditModel(mc.Name, field, value) })
+		}
+		authHeader := mc.AuthHeader
+		if authHeader == "" {
+			authHeader = "default"
+		}
+		promptItem := menuItem{title: "System Prompt", data: truncateString(promptSummary(mc), 40), selectCmd: cmdEditPrompt(mc.Name, systemPrompt(mc))}
+		if text, ok := appConfig.Prompts[mc.SystemPrompt]; ok {
+			// The library prompt replaces the model's own, so edit that.
+			promptItem = menuItem{title: "System Prompt", data: truncateString(firstLine(text), 40), selectCmd: cmdEditLibraryPrompt(mc.SystemPrompt, text)}
+		}
 		items := []menuItem{
-			{title: "Name", data: display},
-			{title: "Model ID", data: mc.ModelName},
-			{title: "Endpoint", data: truncateString(mc.Endpoint, 40)},
-			{title: "Auth Env Var", data: authStatus},
-			{title: "Auth Header", data: mc.AuthHeader},
-			{title: "Set as Default", selectCmd: tea.Sequence(cmdSetDefaultModel(mc.Name), cmdBack())},
-			{title: "Delete Model", data: "permanent", selectCmd: cmdSetMenu(deleteModelConfirmMenu(mc.Name))},
-			{title: "← Back", selectCmd: cmdBack()},
+			{title: "Name", data: display, selectCmd: edit("name", "Name (what -m picks it by)", mc.Name)},
+			{title: "Model ID", data: mc.ModelName, selectCmd: edit("model_name", "Model ID (as the API names it)", mc.ModelName)},
+			{title: "Endpoint", data: truncateString(mc.Endpoint, 40), selectCmd: edit("endpoint", "Endpoint URL", mc.Endpoint)},
+			{title: "Auth Env Var", data: authStatus, selectCmd: edit("auth_env_var", "Auth env var (leave blank for none)", mc.Auth)},
+			{title: "Auth Header", data: authHeader, selectCmd: edit("auth_header", "Auth header, such as Authorization or x-api-key (leave blank for the default)", mc.AuthHeader)},
+			promptItem,
+			{title: "Library Prompt", data: libraryPromptStatus(mc.SystemPrompt, "none"), selectCmd: cmdSetMenu(promptPickerMenu(mc.Name, ""))},
+		}
+		if mc.Auth != "" {
+			items = append(items, menuItem{
+				title:     "Store API Key in Keychain",
+				data:      "instead of exporting " + mc.Auth,
+				selectCmd: cmdSetSecretInput("API key for "+mc.Auth+" (kept in the OS keychain)", func(key string) tea.Cmd { return cmdStoreAPIKey(mc.Auth, key) }),
+			})
+			if mc.AuthSource == util.AuthSourceKeychain {
+				items = append(items, menuItem{title: "Remove Key from Keychain", selectCmd: cmdStoreAPIKey(mc.Auth, "")})
+			}
 		}
+		items = append(items,
+			menuItem{title: "Test Connection", data: "sends a tiny prompt", selectCmd: cmdTestConnection("Model: "+display, mc)},
+			menuItem{title: "Set as Default", selectCmd: tea.Sequence(cmdSetDefaultModel(mc.Name), cmdBack())},
+			menuItem{title: "Delete Model", data: "permanent", selectCmd: cmdSetMenu(deleteModelConfirmMenu(mc.Name))},
+			menuItem{title: "← Back", selectCmd: cmdBack()},
+		)
 		return defaultList("Model: "+display, items)
 	}
 }
 
+// editModel sets field, a YAML key, of the model called name to value and
+// returns the edited model. Renaming a model renames it wherever the
+// config refers to it.
+func editModel(appConfig *AppConfig, name, field, value string) (types.ModelConfig, error) {
+	index := -1
+	for i, m := range appConfig.Models {
+		if m.Name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return types.ModelConfig{}, fmt.Errorf("no model is named %q", name)
+	}
+	mc := appConfig.Models[index]
+	switch field {
+	case "name":
+		if value == "" {
+			return mc, fmt.Errorf("the model needs a name")
+		}
+		if value != name && contains(modelNames(appConfig.Models), value) {
+			return mc, fmt.Errorf("another model is already named %q", value)
+		}
+		renameModel(appConfig, name, value)
+		mc.Name = value
+	case "model_name":
+		if value == "" {
+			return mc, fmt.Errorf("the model ID cannot be empty")
+		}
+		mc.ModelName = value
+	case "endpoint":
+		if !validEndpoint(value) {
+			return mc, fmt.Errorf("%q is not an http(s) URL", value)
+		}
+		mc.Endpoint = value
+	case "auth_env_var":
+		if value != "" && !envVarRe.MatchString(value) {
+			return mc, fmt.Errorf("give the name of the environment variable holding the key, not the key")
+		}
+		mc.Auth = value
+		if value == "" {
+			mc.AuthSource = ""
+		}
+	case "auth_header":
+		if strings.ContainsAny(value, " :\t") {
+			return mc, fmt.Errorf("give just the header name, such as Authorization or x-api-key")
+		}
+		mc.AuthHeader = value
+	case "prompt":
+		mc.Prompt = withSystemPrompt(mc.Prompt, value)
+	default:
+		return mc, fmt.Errorf("%s cannot be edited here", field)
+	}
+	appConfig.Models[index] = mc
+	return mc, nil
+}
+
+// renameModel points the default model, aliases, recipes and agents that
+// use the model called from at to instead.
+func renameModel(appConfig *AppConfig, from, to string) {
+	prefs := &appConfig.Preferences
+	if prefs.DefaultModel == from {
+		prefs.DefaultModel = to
+	}
+	for alias, target := range appConfig.Aliases {
+		if target == from {
+			appConfig.Aliases[alias] = to
+		}
+	}
+	for i := range appConfig.Recipes {
+		if appConfig.Recipes[i].Model == from {
+			appConfig.Recipes[i].Model = to
+		}
+	}
+	if prefs.Agents.Model == from {
+		prefs.Agents.Model = to
+	}
+	for role, rc := range prefs.Agents.Roles {
+		if rc.Model == from {
+			rc.Model = to
+			prefs.Agents.Roles[role] = rc
+		}
+	}
+}
+
+// systemPrompt returns the content of the model's system message.
+func systemPrompt(mc types.ModelConfig) string {
+	for _, msg := range mc.Prompt {
+		if msg.Role == "system" {
+			return msg.Content
+		}
+	}
+	return ""
+}
+
+// promptSummary returns the first line of the model's system prompt, or
+// "none".
+func promptSummary(mc types.ModelConfig) string {
+	line := firstLine(systemPrompt(mc))
+	if line == "" {
+		return "none"
+	}
+	return line
+}
+
+// withSystemPrompt returns prompt with its system message set to content,
+// added first if there was none and removed if content is empty. The
+// other messages, such as examples, are kept.
+func withSystemPrompt(prompt []types.Message, content string) []types.Message {
+	var out []types.Message
+	found := false
+	for _, msg := range prompt {
+		if msg.Role == "system" {
+			if found || content == "" {
+				continue
+			}
+			found = true
+			msg.Content = content
+		}
+		out = append(out, msg)
+	}
+	if !found && content != "" {
+		out = append([]types.Message{{Role: "system", Content: content}}, out...)
+	}
+	return out
+}
+
+// setAuthSource sets the auth_source of every model, profiles' included,
+// and of voice and embeddings, that reads its API key from authEnvVar, as
+// they share the keychain entry.
+func setAuthSource(appConfig *AppConfig, authEnvVar, source string) {
+	set := func(models []types.ModelConfig) {
+		for i := range models {
+			if models[i].Auth == authEnvVar {
+				models[i].AuthSource = source
+			}
+		}
+	}
+	set(appConfig.Models)
+	for _, profile := range appConfig.Profiles {
+		set(profile.Models)
+	}
+	// Voice and embeddings default to OpenAI's API and its usual variable.
+	prefs := &appConfig.Preferences
+	if v := prefs.Voice; v.AuthEnvVar == authEnvVar || v.AuthEnvVar == "" && v.TranscribeEndpoint == "" && authEnvVar == "OPENAI_API_KEY" {
+		prefs.Voice.AuthSource = source
+	}
+	if e := prefs.Embeddings; e.AuthEnvVar == authEnvVar || e.AuthEnvVar == "" && e.Endpoint == "" && authEnvVar == "OPENAI_API_KEY" {
+		prefs.Embeddings.AuthSource = source
+	}
+}
+
 func deleteModelConfirmMenu(name string) menuFunc {
 	return func(appConfig AppConfig) list.Model {
 		items := []menuItem{
@@ -412,6 +946,245 @@ func deleteModelConfirmMenu(name string) menuFunc {
 	}
 }
 
+// profileSummary describes the config's profiles for the main menu.
+func profileSummary(appConfig AppConfig) string {
+	switch {
+	case len(appConfig.Profiles) == 0:
+		return "none"
+	case appConfig.Profile != "":
+		return fmt.Sprintf("%d, %s by default", len(appConfig.Profiles), appConfig.Profile)
+	}
+	return fmt.Sprintf("%d configured", len(appConfig.Profiles))
+}
+
+func profilesMenu(appConfig AppConfig) list.Model {
+	var items []menuItem
+	for _, name := range ProfileNames(appConfig) {
+		data := profileModel(appConfig, name)
+		if name == appConfig.Profile {
+			data += ", default ✓"
+		}
+		items = append(items, menuItem{title: name, data: data, selectCmd: cmdSetMenu(profileDetailsMenu(name))})
+	}
+	items = append(items, menuItem{title: "New Profile", selectCmd: cmdSetInput("Profile name (e.g., work, personal, offline)", "", cmdAddProfile)})
+	if appConfig.Profile != "" {
+		items = append(items, menuItem{title: "Use No Profile by Default", selectCmd: cmdSetDefaultProfile("")})
+	}
+	items = append(items, menuItem{title: "← Back", selectCmd: cmdBack()})
+	return defaultList("Profiles · q --profile NAME or Q_PROFILE=NAME picks one", items)
+}
+
+// profileModel returns the default model of the profile called name.
+func profileModel(appConfig AppConfig, name string) string {
+	if model, ok := appConfig.Profiles[name].Preferences["default_model"].(string); ok && model != "" {
+		return model
+	}
+	return "default model unchanged"
+}
+
+// profileModels returns the models the profile called name can use.
+func profileModels(appConfig AppConfig, name string) []types.ModelConfig {
+	if models := appConfig.Profiles[name].Models; len(models) > 0 {
+		return models
+	}
+	return appConfig.Models
+}
+
+func profileDetailsMenu(name string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		profile := appConfig.Profiles[name]
+		models := "the config's"
+		if len(profile.Models) > 0 {
+			models = fmt.Sprintf("%d of its own", len(profile.Models))
+		}
+		isDefault := ""
+		if appConfig.Profile == name {
+			isDefault = "✓"
+		}
+		items := []menuItem{
+			{title: "Use by Default", data: isDefault, selectCmd: cmdSetDefaultProfile(name)},
+			{title: "Default Model", data: profileModel(appConfig, name), selectCmd: cmdSetMenu(profileModelMenu(name))},
+			{title: "Library Prompt", data: libraryPromptStatus(profile.SystemPrompt, "each model's own"), selectCmd: cmdSetMenu(promptPickerMenu("", name))},
+			{title: "Models", data: models},
+			{title: "Preferences", data: fmt.Sprintf("%d overridden; edit the config file to change", len(profile.Preferences))},
+			{title: "Delete Profile", selectCmd: cmdSetMenu(deleteProfileConfirmMenu(name))},
+			{title: "← Back", selectCmd: cmdBack()},
+		}
+		return defaultList("Profile: "+name, items)
+	}
+}
+
+func profileModelMenu(name string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		current := profileModel(appConfig, name)
+		var items []menuItem
+		for _, m := range profileModels(appConfig, name) {
+			marker := ""
+			if m.Name == current {
+				marker = "✓"
+			}
+			items = append(items, menuItem{title: m.Name, data: marker, selectCmd: cmdSetProfileModel(name, m.Name)})
+		}
+		items = append(items, menuItem{title: "← Back", selectCmd: cmdBack()})
+		return defaultList("Default Model for "+name, items)
+	}
+}
+
+func deleteProfileConfirmMenu(name string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		items := []menuItem{
+			{title: "Yes, delete " + name, data: "its models and preferences too", selectCmd: cmdDeleteProfile(name)},
+			{title: "No, cancel", selectCmd: cmdBack()},
+		}
+		return defaultList("Delete profile '"+name+"'?", items)
+	}
+}
+
+func promptsMenu(appConfig AppConfig) list.Model {
+	var items []menuItem
+	for _, name := range sortedKeys(appConfig.Prompts) {
+		items = append(items, menuItem{title: name, data: promptUsage(appConfig, name), selectCmd: cmdSetMenu(promptDetailsMenu(name))})
+	}
+	items = append(items,
+		menuItem{title: "New Prompt", data: "opens $EDITOR", selectCmd: cmdSetInput("Prompt name (e.g., concise, reviewer, teacher)", "", func(name string) tea.Cmd {
+			if name == "" {
+				return nil
+			}
+			return cmdEditLibraryPrompt(name, appConfig.Prompts[name])
+		})},
+		menuItem{title: "← Back", selectCmd: cmdBack()},
+	)
+	return defaultList("Prompt Library · system prompts models and profiles share", items)
+}
+
+// promptUsage says what uses the library prompt called name.
+func promptUsage(appConfig AppConfig, name string) string {
+	users := promptUsers(appConfig, name)
+	if len(users) == 0 {
+		return "unused"
+	}
+	return truncateString("used by "+strings.Join(users, ", "), 40)
+}
+
+func promptDetailsMenu(name string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		text := appConfig.Prompts[name]
+		items := []menuItem{
+			{title: "Text", data: truncateString(firstLine(text), 40), selectCmd: cmdEditLibraryPrompt(name, text)},
+			{title: "Name", data: name, selectCmd: cmdSetInput("Prompt name", name, func(to string) tea.Cmd { return cmdRenamePrompt(name, to) })},
+			{title: "Used By", data: promptUsage(appConfig, name), selectCmd: cmdSetMenu(promptUsersMenu(name))},
+			{title: "Delete Prompt", data: "its models keep their own prompts", selectCmd: cmdSetMenu(deletePromptConfirmMenu(name))},
+			{title: "← Back", selectCmd: cmdBack()},
+		}
+		return defaultList("Prompt: "+name, items)
+	}
+}
+
+// promptUsersMenu lists the models and profiles, with the library prompt
+// each uses, to switch the one called name on or off for each.
+func promptUsersMenu(name string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		var items []menuItem
+		pick := func(title, current, model, profile string) {
+			data, prompt := current, name
+			if current == name {
+				data, prompt = "✓", ""
+			}
+			items = append(items, menuItem{title: title, data: data, selectCmd: cmdSetPrompt(prompt, model, profile)})
+		}
+		for _, m := range appConfig.Models {
+			pick(m.Name, m.SystemPrompt, m.Name, "")
+		}
+		for _, profile := range ProfileNames(appConfig) {
+			pick("Profile "+profile, appConfig.Profiles[profile].SystemPrompt, "", profile)
+		}
+		items = append(items, menuItem{title: "← Back", selectCmd: cmdBack()})
+		return defaultList("Use '"+name+"' for", items)
+	}
+}
+
+// promptPickerMenu picks the library prompt of the model called model, or
+// else of the profile called profile.
+func promptPickerMenu(model, profile string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		current, none, title := appConfig.Profiles[profile].SystemPrompt, "each model's own", "Prompt for Profile "+profile
+		if model != "" {
+			current, none, title = "", "the model's own", "Prompt for "+model
+			for _, m := range appConfig.Models {
+				if m.Name == model {
+					current = m.SystemPrompt
+				}
+			}
+		}
+		marker := func(name string) string {
+			if name == current {
+				return "✓"
+			}
+			return ""
+		}
+		items := []menuItem{{title: "None", data: strings.TrimSpace(none + " " + marker("")), selectCmd: tea.Sequence(cmdSetPrompt("", model, profile), cmdBack())}}
+		for _, name := range sortedKeys(appConfig.Prompts) {
+			data := marker(name)
+			if data == "" {
+				data = truncateString(firstLine(appConfig.Prompts[name]), 40)
+			}
+			items = append(items, menuItem{title: name, data: data, selectCmd: tea.Sequence(cmdSetPrompt(name, model, profile), cmdBack())})
+		}
+		items = append(items, menuItem{title: "← Back", selectCmd: cmdBack()})
+		return defaultList(title, items)
+	}
+}
+
+func deletePromptConfirmMenu(name string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		items := []menuItem{
+			{title: "Yes, delete " + name, data: "cannot undo", selectCmd: cmdDeletePrompt(name)},
+			{title: "No, cancel", selectCmd: cmdBack()},
+		}
+		return defaultList("Delete prompt '"+name+"'?", items)
+	}
+}
+
+// libraryPromptStatus shows the library prompt name, or none if there is
+// none.
+func libraryPromptStatus(name, none string) string {
+	if name == "" {
+		return none
+	}
+	return "from the library: " + name
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
+
+// setItemData shows data beside the item called title, if the menu titled
+// menuTitle is still the one open.
+func (m *model) setItemData(menuTitle, title, data string) {
+	if m.list.Title != menuTitle {
+		return
+	}
+	for i, it := range m.list.Items() {
+		if item, ok := it.(menuItem); ok && item.title == title {
+			item.data = data
+			m.list.SetItem(i, item)
+		}
+	}
+}
+
+// connectionTestStatus sums up a connection test for the model menu.
+func connectionTestStatus(test llm.ConnectionTest) string {
+	latency := test.Latency.Round(time.Millisecond).String()
+	switch {
+	case test.Err != nil && test.Status != "":
+		return truncateString(fmt.Sprintf("✗ %s after %s: %s", test.Status, latency, test.Err), 70)
+	case test.Err != nil:
+		return truncateString("✗ "+test.Err.Error(), 70)
+	}
+	return truncateString(fmt.Sprintf("✓ %s, %s, replied %q", latency, test.Status, test.Sample), 70)
+}
+
 func addModelProviderMenu(appConfig AppConfig) list.Model {
 	var items []menuItem
 	for _, preset := range providerPresets {
@@ -426,21 +1199,14 @@ func addModelProviderMenu(appConfig AppConfig) list.Model {
 	return defaultList("Select Provider", items)
 }
 
+// startAddModelWizard asks for what the provider preset leaves out, then
+// offers the models the provider lists, falling back to asking for a
+// model ID when it lists none.
 func startAddModelWizard(preset types.ProviderPreset) tea.Cmd {
-	return cmdSetInput("Display name (friendly)", preset.Name, func(display string) tea.Cmd {
-		if display == "" {
-			display = preset.Name
-		}
-		return cmdSetInput("Model ID (e.g., gpt-4o, claude-sonnet)", preset.Name, func(modelID string) tea.Cmd {
-			if modelID == "" {
-				modelID = preset.Name
-			}
-			return resolveEndpointStep(preset, display, modelID)
-		})
-	})
+	return resolveEndpointStep(preset)
 }
 
-func resolveEndpointStep(preset types.ProviderPreset, name, modelID string) tea.Cmd {
+func resolveEndpointStep(preset types.ProviderPreset) tea.Cmd {
 	if strings.TrimSpace(preset.Endpoint) == "" {
 		return cmdSetInput("Endpoint URL", "", func(ep string) tea.Cmd {
 			ep = strings.TrimSpace(ep)
@@ -448,20 +1214,68 @@ func resolveEndpointStep(preset types.ProviderPreset, name, modelID string) tea.
 				return cmdBack()
 			}
 			preset.Endpoint = ep
-			return resolveAuthEnvStep(preset, name, modelID)
+			return resolveAuthEnvStep(preset)
 		})
 	}
-	return resolveAuthEnvStep(preset, name, modelID)
+	return resolveAuthEnvStep(preset)
 }
 
-func resolveAuthEnvStep(preset types.ProviderPreset, name, modelID string) tea.Cmd {
+func resolveAuthEnvStep(preset types.ProviderPreset) tea.Cmd {
 	if preset.AuthEnvVar == "" && preset.Name != "Ollama Local" {
 		return cmdSetInput("Auth env var (leave blank for none)", "", func(envVar string) tea.Cmd {
 			preset.AuthEnvVar = strings.TrimSpace(envVar)
-			return resolveAuthHeaderStep(preset, name, modelID)
+			return cmdListModels(preset)
 		})
 	}
-	return resolveAuthHeaderStep(preset, name, modelID)
+	return cmdListModels(preset)
+}
+
+func pickModelMenu(preset types.ProviderPreset, models []string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		configured := make(map[string]bool)
+		for _, m := range appConfig.Models {
+			if m.Endpoint == preset.Endpoint {
+				configured[m.ModelName] = true
+			}
+		}
+		var items []menuItem
+		for _, id := range models {
+			data := ""
+			if configured[id] {
+				data = "already added"
+			}
+			items = append(items, menuItem{title: id, data: data, selectCmd: tea.Sequence(cmdBack(), displayNameStep(preset, id))})
+		}
+		items = append(items,
+			menuItem{title: "Other…", data: "type a model ID", selectCmd: tea.Sequence(cmdBack(), modelIDStep(preset, ""))},
+			menuItem{title: "← Back", selectCmd: cmdBack()},
+		)
+		return defaultList(fmt.Sprintf("Select Model · %d from %s", len(models), preset.Name), items)
+	}
+}
+
+// modelIDStep asks for the model ID, saying why in note if the provider's
+// list was no help.
+func modelIDStep(preset types.ProviderPreset, note string) tea.Cmd {
+	prompt := "Model ID (e.g., gpt-4o, claude-sonnet)"
+	if note != "" {
+		prompt += " · " + note
+	}
+	return cmdSetInput(prompt, "", func(modelID string) tea.Cmd {
+		if modelID == "" {
+			modelID = preset.Name
+		}
+		return displayNameStep(preset, modelID)
+	})
+}
+
+func displayNameStep(preset types.ProviderPreset, modelID string) tea.Cmd {
+	return cmdSetInput("Display name (friendly)", modelID, func(display string) tea.Cmd {
+		if display == "" {
+			display = modelID
+		}
+		return resolveAuthHeaderStep(preset, display, modelID)
+	})
 }
 
 func resolveAuthHeaderStep(preset types.ProviderPreset, name, modelID string) tea.Cmd {
@@ -489,12 +1303,175 @@ func settingsMenu(appConfig AppConfig) list.Model {
 		{title: "Stream Responses", data: boolStatus(appConfig.Preferences.StreamResponses), selectCmd: cmdTogglePref("stream_responses")},
 		{title: "Show Tool Activity", data: boolStatus(appConfig.Preferences.ShowToolActivity), selectCmd: cmdTogglePref("show_tool_activity")},
 		{title: "Auto-copy Code Blocks", data: boolStatus(appConfig.Preferences.AutoCopyCode), selectCmd: cmdTogglePref("auto_copy_code")},
-		{title: "Data & Privacy", selectCmd: cmdSetMenu(dataPrivacyMenu)},
-		{title: "← Back", selectCmd: cmdBack()},
+		{title: "Summarize Docs with the Model", data: boolStatus(appConfig.Preferences.SummarizeDocs), selectCmd: cmdTogglePref("summarize_docs")},
 	}
+	// The booleans above are toggled by hand; the rest of the preferences,
+	// sections included, are listed from their YAML keys.
+	items = append(items, prefItems(appConfig, nil, false)...)
+	items = append(items,
+		menuItem{title: "Data & Privacy", selectCmd: cmdSetMenu(dataPrivacyMenu)},
+		menuItem{title: "← Back", selectCmd: cmdBack()},
+	)
 	return defaultList("Settings", items)
 }
 
+// prefSectionMenu lists the preferences in the section at path, such as
+// memory or watch.notify.
+func prefSectionMenu(path []string) menuFunc {
+	return func(appConfig AppConfig) list.Model {
+		items := append(prefItems(appConfig, path, true), menuItem{title: "← Back", selectCmd: cmdBack()})
+		return defaultList("Settings: "+prefTitle(path[len(path)-1]), items)
+	}
+}
+
+// prefItems returns an item for each preference in the section at path,
+// or at the top level for none: booleans, if bools is set, toggle,
+// sections open their own menu, and the rest are typed in, lists and maps as YAML such as
+// [a, b] or {shell: 60}. Lists and maps of structs, such as agent roles,
+// are left to the config file.
+func prefItems(appConfig AppConfig, path []string, bools bool) []menuItem {
+	section := prefField(reflect.ValueOf(&appConfig.Preferences).Elem(), path)
+	t := section.Type()
+	var items []menuItem
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		fieldPath := append(append([]string(nil), path...), key)
+		field := section.Field(i)
+		title := prefTitle(key)
+		switch {
+		case field.Kind() == reflect.Struct:
+			if len(prefItems(appConfig, fieldPath, true)) > 0 {
+				items = append(items, menuItem{title: title, selectCmd: cmdSetMenu(prefSectionMenu(fieldPath))})
+			}
+		case field.Kind() == reflect.Bool:
+			if !bools {
+				continue
+			}
+			items = append(items, menuItem{title: title, data: boolStatus(field.Bool()), selectCmd: cmdSetPref(fieldPath, strconv.FormatBool(!field.Bool()))})
+		case prefEditable(field.Type()):
+			text := prefText(field)
+			data := text
+			if data == "" {
+				data = "default"
+			}
+			prompt := title + " (leave blank for the default)"
+			if k := field.Type().Kind(); k == reflect.Slice || k == reflect.Map {
+				prompt = title + " as YAML, e.g. [a, b] or {key: value} (leave blank for the default)"
+			}
+			items = append(items, menuItem{title: title, data: truncateString(data, 40), selectCmd: cmdSetInput(prompt, text, func(value string) tea.Cmd {
+				return cmdSetPref(fieldPath, value)
+			})})
+		}
+	}
+	return items
+}
+
+// prefField returns the preference at path, a list of YAML keys, in prefs.
+func prefField(prefs reflect.Value, path []string) reflect.Value {
+	for _, key := range path {
+		t := prefs.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); name == key {
+				prefs = prefs.Field(i)
+				break
+			}
+		}
+	}
+	return prefs
+}
+
+// prefEditable reports whether a preference of type t can be typed in on
+// one line.
+func prefEditable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Ptr, reflect.Slice:
+		return t.Elem().Kind() != reflect.Struct && prefEditable(t.Elem())
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() != reflect.Struct && prefEditable(t.Elem())
+	}
+	return false
+}
+
+// prefText returns a preference as it is typed in, or "" if it is unset.
+func prefText(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return ""
+		}
+		return prefText(v.Elem())
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int64:
+		if v.Int() == 0 {
+			return ""
+		}
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		if v.Float() == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return ""
+		}
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = yamlScalar(v.Index(i))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case reflect.Map:
+		if v.Len() == 0 {
+			return ""
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + ": " + yamlScalar(v.MapIndex(reflect.ValueOf(k)))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return ""
+}
+
+// yamlScalar returns v as YAML in a flow list or map, quoted if it needs
+// to be.
+func yamlScalar(v reflect.Value) string {
+	if v.Kind() == reflect.String && strings.ContainsAny(v.String(), ",[]{}") {
+		return strconv.Quote(v.String())
+	}
+	data, _ := yaml.Marshal(v.Interface())
+	return strings.TrimSpace(string(data))
+}
+
+// prefTitle turns a YAML key such as max_history_days into a menu title.
+func prefTitle(key string) string {
+	words := strings.Split(key, "_")
+	for i, w := range words {
+		switch w {
+		case "db", "url":
+			words[i] = strings.ToUpper(w)
+		case "ms":
+			words[i] = "(ms)"
+		default:
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
 func dataPrivacyMenu(appConfig AppConfig) list.Model {
 	dataDir, _ := FullFilePath(".shell-ai")
 	items := []menuItem{
@@ -528,18 +1505,22 @@ func clearAllDataConfirmMenu(appConfig AppConfig) list.Model {
 	return defaultList("Delete ALL shell-ai data?", items)
 }
 
+// clearDataAction deletes one category of data from the memory database,
+// or the whole data directory for "all".
 func clearDataAction(dataType string) tea.Cmd {
 	return func() tea.Msg {
-		dataDir, _ := FullFilePath(".shell-ai")
-		dbPath := dataDir + "/memory.db"
-		switch dataType {
-		case "all":
+		if dataType == "all" {
+			dataDir, _ := FullFilePath(".shell-ai")
 			os.RemoveAll(dataDir)
 			os.MkdirAll(dataDir, 0700)
-		case "history", "knowledge", "docs":
-			os.Remove(dbPath)
+			return dataClearedMsg{dataType: dataType}
 		}
-		return backMsg{}
+		database, err := db.Open()
+		if err != nil {
+			return dataClearedMsg{dataType: dataType, err: err}
+		}
+		defer database.Close()
+		return dataClearedMsg{dataType: dataType, err: database.Clear(dataType)}
 	}
 }
 
@@ -570,15 +1551,16 @@ func PrintConfigErrorMessage(err error) {
 	r, _ := glamour.NewTermRenderer(glamour.WithAutoStyle())
 
 	msg1 := styleRed.Render("Failed to load config file.")
-	filePath, _ := FullFilePath(configFilePath)
+	filePath, _ := FullFilePath(configFile())
 	msg2 := styleDim.Render(err.Error())
 
 	messageString := fmt.Sprintf(
 		"---\n"+
 			"# Options:\n\n"+
-			"1. Run `q config revert` to load the automatic backup.\n"+
-			"2. Run `q config reset` to reset to defaults.\n"+
-			"3. Fix manually at: `%s`\n\n",
+			"1. Run `q config validate` to see every problem, with line numbers.\n"+
+			"2. Run `q config revert` to load the automatic backup.\n"+
+			"3. Run `q config reset` to reset to defaults.\n"+
+			"4. Fix manually at: `%s`\n\n",
 		filePath)
 
 	msg3, _ := r.Render(messageString)
@@ -635,8 +1617,24 @@ func handleResetOrRevert(arg string) {
 }
 
 func RunConfigProgram(args []string) {
+	if len(args) > 1 && args[1] == "validate" {
+		runConfigValidate()
+		return
+	}
+	if len(args) > 1 && args[1] == "import" {
+		runConfigImport(args[2:])
+		return
+	}
+	if len(args) > 1 && args[1] == "schema" {
+		runConfigSchema()
+		return
+	}
+	if len(args) > 1 && args[1] == "convert" {
+		runConfigConvert(args[2:])
+		return
+	}
 	handleConfigResets(args)
-	appConfig, err := LoadAppConfig()
+	appConfig, err := loadConfigFile()
 	if err != nil {
 		PrintConfigErrorMessage(err)
 		os.Exit(1)
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	. "q/types"
+	"time"
 
 	_ "embed"
 
@@ -14,7 +15,21 @@ import (
 type AppConfig struct {
 	Models      []ModelConfig `yaml:"models"`
 	Preferences Preferences   `yaml:"preferences"`
-	Version     string        `yaml:"config_format_version"`
+	Recipes     []Recipe      `yaml:"recipes,omitempty"`
+	// Aliases are short names for models, such as fast or 4o, that -m and
+	// default_model accept in place of the model's name.
+	Aliases map[string]string `yaml:"aliases,omitempty"`
+	// Prompts is the prompt library: system prompts, by name, that models
+	// and profiles use with system_prompt rather than each holding a copy.
+	Prompts map[string]string `yaml:"prompts,omitempty"`
+	// Profiles are alternative models and preferences, and Profile the one
+	// used unless --profile or Q_PROFILE names another.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+	Profile  string             `yaml:"profile,omitempty"`
+	Version  string             `yaml:"config_format_version"`
+
+	// ActiveProfile is the profile LoadAppConfig applied, if any.
+	ActiveProfile string `yaml:"-"`
 }
 
 // //go:embed config.yaml
@@ -34,14 +49,51 @@ func FullFilePath(relativeFilePath string) (string, error) {
 	return configFilePath, nil
 }
 
-func LoadAppConfig() (config AppConfig, err error) {
-	filePath, err := FullFilePath(configFilePath)
+// LoadAppConfig returns the config with the active profile and the
+// models' library prompts applied.
+func LoadAppConfig() (AppConfig, error) {
+	config, err := loadConfigFile()
+	if err != nil {
+		return config, err
+	}
+	if name := activeProfile(config); name != "" {
+		if config, err = applyProfile(config, name); err != nil {
+			return config, err
+		}
+	}
+	if config, err = applyPrompts(config); err != nil {
+		return config, err
+	}
+	return applyEnvOverrides(config)
+}
+
+// ModTime returns when the config file last changed, or the zero time if
+// there is none.
+func ModTime() time.Time {
+	filePath, err := FullFilePath(configFile())
+	if err != nil {
+		return time.Time{}
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// loadConfigFile returns the config as it is in the file, for changing it.
+func loadConfigFile() (config AppConfig, err error) {
+	filePath, err := FullFilePath(configFile())
 	if err != nil {
 		return config, fmt.Errorf("error getting config file path: %s", err)
 	}
 
-	// if file doesn't exist, create it with defaults
+	// if file doesn't exist, create it with defaults, unless the
+	// environment configures q instead
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if envConfigured() {
+			return defaultConfig()
+		}
 		return createConfigWithDefaults(filePath)
 	}
 	return loadExistingConfig(filePath)
@@ -51,13 +103,33 @@ func SaveAppConfig(config AppConfig) error {
 	return writeConfigToFile(config)
 }
 
+// SaveConfigFile writes the config file back as it is, without the profile,
+// prompts and Q_ overrides LoadAppConfig applies, which also refreshes its
+// backup. With no file, when the environment configures q, there is nothing
+// to save.
+func SaveConfigFile() error {
+	filePath, err := FullFilePath(configFile())
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil
+	}
+	config, err := loadExistingConfig(filePath)
+	if err != nil {
+		return err
+	}
+	return writeConfigToFile(config)
+}
+
 func ResetAppConfigToDefault() error {
 	_, err := createConfigWithDefaults(configFilePath)
 	return err
 }
 
 func RevertAppConfigToBackup() error {
-	fullConfigPath, _ := FullFilePath(configFilePath)
+	file := configFile()
+	fullConfigPath, _ := FullFilePath(file)
 	fullBackupConfigPath, _ := FullFilePath(backupConfigFilePath)
 
 	// delete the file if it exists
@@ -68,10 +140,19 @@ func RevertAppConfigToBackup() error {
 	if err != nil {
 		return err
 	}
-	return writeConfigToFile(config)
+	return writeConfig(file, config)
 }
 
 func createConfigWithDefaults(filePath string) (AppConfig, error) {
+	config, err := defaultConfig()
+	if err != nil {
+		return config, err
+	}
+	return config, writeConfigToFile(config)
+}
+
+// defaultConfig returns the config a new config file starts with.
+func defaultConfig() (AppConfig, error) {
 	config := AppConfig{}
 	err := yaml.Unmarshal(embeddedConfigFile, &config)
 	if err != nil {
@@ -82,17 +163,19 @@ func createConfigWithDefaults(filePath string) (AppConfig, error) {
 	if modelOverride != "" {
 		config.Preferences.DefaultModel = modelOverride
 	}
-
-	return config, writeConfigToFile(config)
+	return config, nil
 }
 
 func loadExistingConfig(filePath string) (AppConfig, error) {
 	config := AppConfig{}
-	yamlFile, err := os.ReadFile(filePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return config, fmt.Errorf("error reading config file: %s", err)
 	}
-	err = yaml.Unmarshal(yamlFile, &config)
+	yamlFile, err := toYAML(filePath, data)
+	if err == nil {
+		err = yaml.Unmarshal(yamlFile, &config)
+	}
 	if err != nil {
 		return config, fmt.Errorf("error unmarshalling config file: %s", err)
 	}
@@ -117,16 +200,26 @@ func SaveBackupConfig(config AppConfig) error {
 }
 
 func writeConfigToFile(config AppConfig) error {
-	filePath, _ := FullFilePath(configFilePath)
+	return writeConfig(configFile(), config)
+}
+
+// writeConfig writes config to file, relative to the home directory, in
+// the file's format, along with the schema it points to.
+func writeConfig(file string, config AppConfig) error {
+	filePath, _ := FullFilePath(file)
 	// Create all directories in the filepath
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("error creating directories: %s", err)
 	}
 	configData, err := yaml.Marshal(config)
+	if err == nil {
+		configData, err = fromYAML(filePath, configData)
+	}
 	if err != nil {
 		return fmt.Errorf("error marshalling config: %s", err)
 	}
+	writeSchemaFile(dir)
 
 	err = os.WriteFile(filePath, configData, 0644)
 	if err != nil {
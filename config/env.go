@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	. "q/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix starts the names of the environment variables that override
+// config values. Each preference has one, named after its YAML key and
+// those of the sections it sits in: Q_DEFAULT_MODEL, Q_SAVE_HISTORY,
+// Q_AGENTS_MAX_CONCURRENT, Q_MEMORY_SCOPE and so on. Maps and lists take
+// YAML, such as Q_TOOL_TIMEOUTS='{shell: 60}'.
+const envPrefix = "Q_"
+
+// Variables that do not map onto a single preference.
+const (
+	// envDisableTools turns off the comma-separated tool categories.
+	envDisableTools = "Q_DISABLE_TOOLS"
+	// envEndpoint, envModelName and envAuthEnvVar override the endpoint,
+	// API model name and API key variable of the default model, adding
+	// it to models if the config has no model by that name.
+	envEndpoint   = "Q_ENDPOINT"
+	envModelName  = "Q_MODEL_NAME"
+	envAuthEnvVar = "Q_AUTH_ENV_VAR"
+)
+
+// envConfigured reports whether any Q_ variable overrides the config.
+func envConfigured() bool {
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == envDisableTools || name == envEndpoint || name == envModelName || name == envAuthEnvVar {
+			return true
+		}
+	}
+	found := false
+	walkEnvFields(reflect.ValueOf(&Preferences{}).Elem(), envPrefix, func(name string, _ reflect.Value) error {
+		if _, ok := os.LookupEnv(name); ok {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// applyEnvOverrides lays the Q_ environment variables over config.
+func applyEnvOverrides(config AppConfig) (AppConfig, error) {
+	err := walkEnvFields(reflect.ValueOf(&config.Preferences).Elem(), envPrefix, func(name string, field reflect.Value) error {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+		if err := setFromEnv(field, value); err != nil {
+			return fmt.Errorf("%s=%q: %s", name, value, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return config, err
+	}
+
+	if value := os.Getenv(envDisableTools); value != "" {
+		toggles := make(map[string]bool, len(config.Preferences.ToolCategories))
+		for name, on := range config.Preferences.ToolCategories {
+			toggles[name] = on
+		}
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(strings.ToLower(name)); name != "" {
+				toggles[name] = false
+			}
+		}
+		config.Preferences.ToolCategories = toggles
+	}
+
+	endpoint, modelName, auth := os.Getenv(envEndpoint), os.Getenv(envModelName), os.Getenv(envAuthEnvVar)
+	if endpoint == "" && modelName == "" && auth == "" {
+		return config, nil
+	}
+	config.Models = append([]ModelConfig(nil), config.Models...)
+	name := config.Preferences.DefaultModel
+	index := -1
+	for i, m := range config.Models {
+		if m.Name == name || (name == "" && i == 0) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		if name == "" {
+			name = modelName
+		}
+		if name == "" {
+			return config, fmt.Errorf("%s, %s and %s need a model to apply to: set %sDEFAULT_MODEL", envEndpoint, envModelName, envAuthEnvVar, envPrefix)
+		}
+		config.Models = append(config.Models, ModelConfig{Name: name, ModelName: name})
+		config.Preferences.DefaultModel = name
+		index = len(config.Models) - 1
+	}
+	model := &config.Models[index]
+	if endpoint != "" {
+		model.Endpoint = endpoint
+	}
+	if modelName != "" {
+		model.ModelName = modelName
+	}
+	if auth != "" {
+		model.Auth = auth
+	}
+	return config, nil
+}
+
+// walkEnvFields calls fn with the variable name of each setting in the
+// struct v, descending into nested sections.
+func walkEnvFields(v reflect.Value, prefix string, fn func(name string, field reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := walkEnvFields(field, name+"_", fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(name, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFromEnv parses value into field.
+func setFromEnv(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("want true or false")
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("want a whole number")
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("want a number")
+		}
+		field.SetFloat(f)
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if err := setFromEnv(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+	default:
+		parsed := reflect.New(field.Type())
+		if err := yaml.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+			return fmt.Errorf("want YAML: %s", err)
+		}
+		field.Set(parsed.Elem())
+	}
+	return nil
+}
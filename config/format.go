@@ -0,0 +1,223 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// The config file may be YAML, TOML or JSON, told apart by its extension.
+// TOML and JSON are read by turning them into YAML, so the same fields and
+// checks apply to all three, and the file is written back in the format
+// it is in.
+
+// configFileNames are the names the config file may have, in the order
+// they are looked for.
+var configFileNames = []string{"config.yaml", "config.toml", "config.json"}
+
+// schemaFileName is the JSON Schema written next to the config file, which
+// the file points editors to.
+const schemaFileName = "config.schema.json"
+
+// configFile returns the config file in use, relative to the home
+// directory: the first of configFileNames that exists, or config.yaml.
+func configFile() string {
+	for _, name := range configFileNames {
+		rel := filepath.Join(filepath.Dir(configFilePath), name)
+		if path, err := FullFilePath(rel); err == nil {
+			if _, err := os.Stat(path); err == nil {
+				return rel
+			}
+		}
+	}
+	return configFilePath
+}
+
+// configFormat returns yaml, toml or json for the config file at path.
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return "toml"
+	case ".json":
+		return "json"
+	}
+	return "yaml"
+}
+
+// toYAML returns the data of the config file at path as YAML. Syntax
+// errors give the line in data.
+func toYAML(path string, data []byte) ([]byte, error) {
+	if configFormat(path) == "yaml" {
+		return data, nil
+	}
+	doc, err := decodeDocument(path, data)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// tomlPrefixRe matches the position TOML parse errors start with, which
+// decodeDocument gives in the form YAML errors do.
+var tomlPrefixRe = regexp.MustCompile(`^toml: line \d+( \(last key .*?\))?: `)
+
+// decodeDocument parses the data of the config file at path into maps and
+// lists, without the $schema key editors use.
+func decodeDocument(path string, data []byte) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	switch configFormat(path) {
+	case "toml":
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			if parseErr, ok := err.(toml.ParseError); ok {
+				return nil, fmt.Errorf("line %d: %s", parseErr.Position.Line, tomlPrefixRe.ReplaceAllString(err.Error(), ""))
+			}
+			return nil, err
+		}
+	case "json":
+		if err := json.Unmarshal(data, &doc); err != nil {
+			if syntaxErr, ok := err.(*json.SyntaxError); ok {
+				return nil, fmt.Errorf("line %d: %s", bytes.Count(data[:syntaxErr.Offset], []byte("\n"))+1, syntaxErr)
+			}
+			return nil, err
+		}
+	default:
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		if m, ok := stringKeys(raw).(map[string]interface{}); ok {
+			doc = m
+		}
+	}
+	doc, _ = stringKeys(doc).(map[string]interface{})
+	delete(doc, "$schema")
+	return doc, nil
+}
+
+// fromYAML turns YAML config data into the format of the config file at
+// path, pointing editors at the schema.
+func fromYAML(path string, data []byte) ([]byte, error) {
+	format := configFormat(path)
+	if format == "yaml" {
+		return append([]byte("# yaml-language-server: $schema=./"+schemaFileName+"\n"), data...), nil
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	doc, _ := stringKeys(raw).(map[string]interface{})
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	if format == "json" {
+		doc["$schema"] = "./" + schemaFileName
+		out, err := json.MarshalIndent(doc, "", "  ")
+		return append(out, '\n'), err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("#:schema ./" + schemaFileName + "\n\n")
+	if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stringKeys turns the map[interface{}]interface{} maps YAML decodes into
+// map[string]interface{}, and TOML's arrays of tables into lists,
+// throughout v, and drops null map values, which TOML cannot hold.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			if item != nil {
+				m[fmt.Sprint(k)] = stringKeys(item)
+			}
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			if item != nil {
+				m[k] = stringKeys(item)
+			}
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = stringKeys(item)
+		}
+		return list
+
+	case []map[string]interface{}:
+		// TOML decodes arrays of tables this way.
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = stringKeys(item)
+		}
+		return list
+	}
+	return v
+}
+
+// writeSchemaFile writes the config's JSON Schema into dir.
+func writeSchemaFile(dir string) error {
+	data, err := json.MarshalIndent(configSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, schemaFileName), append(data, '\n'), 0644)
+}
+
+// runConfigSchema prints the config's JSON Schema, for editors and tools
+// that do not read the one written next to the config file.
+func runConfigSchema() {
+	data, err := json.MarshalIndent(configSchema(), "", "  ")
+	if err != nil {
+		fmt.Println(styleRed.PaddingLeft(2).Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+// runConfigConvert rewrites the config file in the format named by
+// args[0], keeping the old file beside it with a .bak suffix. Comments in
+// the old file are not carried over.
+func runConfigConvert(args []string) {
+	if len(args) != 1 || !contains([]string{"yaml", "toml", "json"}, strings.ToLower(args[0])) {
+		fmt.Println(styleRed.PaddingLeft(2).Render("Usage: q config convert yaml|toml|json"))
+		os.Exit(1)
+	}
+	format := strings.ToLower(args[0])
+	from := configFile()
+	if configFormat(from) == format {
+		fmt.Println(greyStyle.PaddingLeft(2).Render("The config is already " + strings.ToUpper(format) + "."))
+		return
+	}
+	appConfig, err := loadConfigFile()
+	if err != nil {
+		PrintConfigErrorMessage(err)
+		os.Exit(1)
+	}
+	to := filepath.Join(filepath.Dir(from), "config."+format)
+	if err := writeConfig(to, appConfig); err != nil {
+		fmt.Println(styleRed.PaddingLeft(2).Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+	// The old file would otherwise be found first, or be left to go stale.
+	fromPath, _ := FullFilePath(from)
+	if err := os.Rename(fromPath, fromPath+".bak"); err != nil {
+		fmt.Println(styleRed.PaddingLeft(2).Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+	toPath, _ := FullFilePath(to)
+	fmt.Println(greyStyle.PaddingLeft(2).Render(fmt.Sprintf("Wrote %s; the old config is at %s.bak.", toPath, fromPath)))
+}
@@ -0,0 +1,572 @@
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"q/types"
+
+	"gopkg.in/yaml.v2"
+)
+
+// importedConfig is what `q config import` found in another AI CLI's
+// config.
+type importedConfig struct {
+	source string
+	path   string
+	models []types.ModelConfig
+	// defaultModel is the name of the imported model the CLI uses by
+	// default, if known.
+	defaultModel string
+	// notes tell the user what could not be carried over, such as API
+	// keys written into the file.
+	notes []string
+}
+
+// configImporter reads the config of another AI CLI.
+type configImporter struct {
+	name string
+	// paths returns where the CLI keeps its config, most specific first.
+	paths func() []string
+	parse func(path string, data []byte) (importedConfig, error)
+}
+
+var configImporters = []configImporter{
+	{name: "llm", paths: llmPaths, parse: parseLLMConfig},
+	{name: "aichat", paths: aichatPaths, parse: parseAichatConfig},
+	{name: "aider", paths: aiderPaths, parse: parseAiderConfig},
+	{name: "continue", paths: continuePaths, parse: parseContinueConfig},
+}
+
+// providerPresetNames maps the provider names other CLIs use to the
+// presets of the add-model wizard.
+var providerPresetNames = map[string]string{
+	"openai":      "OpenAI",
+	"anthropic":   "Anthropic",
+	"claude":      "Anthropic",
+	"openrouter":  "OpenRouter",
+	"ollama":      "Ollama Local",
+	"groq":        "Groq",
+	"together":    "Together AI",
+	"together_ai": "Together AI",
+	"mistral":     "Mistral AI",
+}
+
+// providerModel returns a model for provider, at apiBase if it is given
+// in place of the provider's usual one. It returns false for providers q
+// does not know that give no apiBase.
+func providerModel(name, modelID, provider, apiBase string) (types.ModelConfig, bool) {
+	provider = strings.ToLower(provider)
+	preset, known := types.ProviderPreset{}, false
+	for _, p := range providerPresets {
+		if p.Name == providerPresetNames[provider] {
+			preset, known = p, true
+		}
+	}
+	if !known && apiBase == "" {
+		return types.ModelConfig{}, false
+	}
+	m := types.ModelConfig{Name: name, ModelName: modelID, Endpoint: preset.Endpoint, Auth: preset.AuthEnvVar, AuthHeader: preset.AuthHeader}
+	if !known {
+		m.Auth = keyVariable(provider)
+		m.AuthHeader = "Authorization"
+	}
+	if apiBase != "" {
+		m.Endpoint = endpointFromBase(apiBase, provider)
+	}
+	return m, true
+}
+
+// endpointFromBase turns an OpenAI-style API base URL into the chat
+// endpoint under it.
+func endpointFromBase(apiBase, provider string) string {
+	base := strings.TrimRight(apiBase, "/")
+	switch {
+	case strings.HasSuffix(base, "/chat/completions") || strings.HasSuffix(base, "/messages"):
+		return base
+	case provider == "anthropic" || provider == "claude":
+		if !strings.HasSuffix(base, "/v1") {
+			base += "/v1"
+		}
+		return base + "/messages"
+	case provider == "ollama" && !strings.HasSuffix(base, "/v1"):
+		base += "/v1"
+	}
+	return base + "/chat/completions"
+}
+
+var nonVariableRe = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// keyVariable names the environment variable for the API key of a
+// provider q has no preset for.
+func keyVariable(provider string) string {
+	name := strings.Trim(nonVariableRe.ReplaceAllString(strings.ToUpper(provider), "_"), "_")
+	if name == "" {
+		name = "CUSTOM"
+	}
+	return name + "_API_KEY"
+}
+
+var nonNameRe = regexp.MustCompile(`[^a-z0-9.:_-]+`)
+
+// modelSlug turns a display title into a name to pick the model by.
+func modelSlug(title string) string {
+	return strings.Trim(nonNameRe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+}
+
+// keyNote tells the user that the API key in path was not copied.
+func keyNote(path, variable string) string {
+	return fmt.Sprintf("%s holds an API key, which is not copied: export %s, or store the key in the keychain with q config", path, variable)
+}
+
+func homePath(parts ...string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(append([]string{home}, parts...)...)
+}
+
+func userConfigPath(parts ...string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(append([]string{dir}, parts...)...)
+}
+
+// llm (Simon Willison's) keeps OpenAI-compatible models in
+// extra-openai-models.yaml and its default in default_model.txt.
+
+// llmOpenAIModelRe matches the OpenAI models llm has built in.
+var llmOpenAIModelRe = regexp.MustCompile(`^(gpt-|chatgpt-|o[134]$|o[134]-)`)
+
+func llmPaths() []string {
+	if dir := os.Getenv("LLM_USER_PATH"); dir != "" {
+		return []string{filepath.Join(dir, "extra-openai-models.yaml")}
+	}
+	return []string{userConfigPath("io.datasette.llm", "extra-openai-models.yaml")}
+}
+
+func parseLLMConfig(path string, data []byte) (importedConfig, error) {
+	result := importedConfig{source: "llm", path: path}
+	var entries []struct {
+		ModelID    string `yaml:"model_id"`
+		ModelName  string `yaml:"model_name"`
+		APIBase    string `yaml:"api_base"`
+		APIKeyName string `yaml:"api_key_name"`
+	}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return result, err
+	}
+	keyNames := make(map[string]bool)
+	for _, e := range entries {
+		if e.ModelID == "" {
+			continue
+		}
+		modelName := e.ModelName
+		if modelName == "" {
+			modelName = e.ModelID
+		}
+		provider := "openai"
+		if e.APIKeyName != "" {
+			provider = e.APIKeyName
+		}
+		m, ok := providerModel(e.ModelID, modelName, provider, e.APIBase)
+		if !ok {
+			m, _ = providerModel(e.ModelID, modelName, "openai", "")
+			m.Auth = keyVariable(provider)
+		}
+		if e.APIKeyName == "" && e.APIBase != "" {
+			m.Auth, m.AuthHeader = "", ""
+		}
+		if e.APIKeyName != "" {
+			keyNames[e.APIKeyName] = true
+		}
+		result.models = append(result.models, m)
+	}
+
+	dir := filepath.Dir(path)
+	if data, err := os.ReadFile(filepath.Join(dir, "default_model.txt")); err == nil {
+		name := strings.TrimSpace(string(data))
+		found := false
+		for _, m := range result.models {
+			found = found || m.Name == name
+		}
+		// llm's own OpenAI models are not in the file.
+		if !found && llmOpenAIModelRe.MatchString(name) {
+			m, _ := providerModel(name, name, "openai", "")
+			result.models = append(result.models, m)
+			found = true
+		}
+		if found {
+			result.defaultModel = name
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keys.json")); err == nil {
+		keyNames["openai"] = true
+		var names []string
+		for name := range keyNames {
+			names = append(names, fmt.Sprintf("%s as %s", name, providerVariable(name)))
+		}
+		sort.Strings(names)
+		result.notes = append(result.notes, fmt.Sprintf("llm keeps its keys in %s, which are not copied: export %s, or store them in the keychain with q config",
+			filepath.Join(dir, "keys.json"), strings.Join(names, ", ")))
+	}
+	return result, nil
+}
+
+// providerVariable names the API key variable of provider, as its preset
+// does where there is one.
+func providerVariable(provider string) string {
+	if m, ok := providerModel("", "", provider, ""); ok && m.Auth != "" {
+		return m.Auth
+	}
+	return keyVariable(provider)
+}
+
+// aichat lists clients, each with a type, optional api_base and models,
+// and names its default model as client:model.
+
+func aichatPaths() []string {
+	if dir := os.Getenv("AICHAT_CONFIG_DIR"); dir != "" {
+		return []string{filepath.Join(dir, "config.yaml")}
+	}
+	return []string{userConfigPath("aichat", "config.yaml")}
+}
+
+func parseAichatConfig(path string, data []byte) (importedConfig, error) {
+	result := importedConfig{source: "aichat", path: path}
+	var config struct {
+		Model   string `yaml:"model"`
+		Clients []struct {
+			Type    string `yaml:"type"`
+			Name    string `yaml:"name"`
+			APIBase string `yaml:"api_base"`
+			APIKey  string `yaml:"api_key"`
+			Models  []struct {
+				Name string `yaml:"name"`
+			} `yaml:"models"`
+		} `yaml:"clients"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return result, err
+	}
+	defaultClient, defaultModel, _ := strings.Cut(config.Model, ":")
+	for _, client := range config.Clients {
+		clientName := client.Name
+		if clientName == "" {
+			clientName = client.Type
+		}
+		provider := client.Type
+		if provider == "openai-compatible" {
+			provider = clientName
+		}
+		var ids []string
+		for _, m := range client.Models {
+			ids = append(ids, m.Name)
+		}
+		if len(ids) == 0 && clientName == defaultClient && defaultModel != "" {
+			ids = append(ids, defaultModel)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		for _, id := range ids {
+			m, ok := providerModel(id, id, provider, client.APIBase)
+			if !ok {
+				result.notes = append(result.notes, fmt.Sprintf("aichat client %s (%s) is not supported; add its models with q config", clientName, client.Type))
+				break
+			}
+			if clientName == defaultClient && id == defaultModel {
+				result.defaultModel = id
+			}
+			result.models = append(result.models, m)
+		}
+		if client.APIKey != "" {
+			result.notes = append(result.notes, keyNote(path, providerVariable(provider)))
+		}
+	}
+	return result, nil
+}
+
+// aider reads .aider.conf.yml from the current directory and the home
+// directory; model names may start with a provider, as in
+// openrouter/anthropic/claude-3.5-sonnet.
+
+func aiderPaths() []string {
+	return []string{".aider.conf.yml", homePath(".aider.conf.yml")}
+}
+
+func parseAiderConfig(path string, data []byte) (importedConfig, error) {
+	result := importedConfig{source: "aider", path: path}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return result, err
+	}
+	get := func(key string) string {
+		s, _ := config[key].(string)
+		return s
+	}
+	apiBase := get("openai-api-base")
+	for _, key := range []string{"model", "editor-model", "weak-model"} {
+		name := get(key)
+		if name == "" {
+			continue
+		}
+		provider, modelID := aiderProvider(name)
+		base := ""
+		if provider == "openai" {
+			base = apiBase
+		}
+		m, ok := providerModel(modelSlug(modelID), modelID, provider, base)
+		if !ok {
+			result.notes = append(result.notes, fmt.Sprintf("aider's %s %s uses a provider q has no preset for; add it with q config", key, name))
+			continue
+		}
+		if key == "model" {
+			result.defaultModel = m.Name
+		}
+		result.models = append(result.models, m)
+	}
+	for _, provider := range []string{"openai", "anthropic"} {
+		if get(provider+"-api-key") != "" {
+			result.notes = append(result.notes, keyNote(path, providerVariable(provider)))
+		}
+	}
+	return result, nil
+}
+
+// aiderProvider splits a model name as aider takes it into the provider
+// and the provider's model ID.
+func aiderProvider(name string) (string, string) {
+	if provider, rest, ok := strings.Cut(name, "/"); ok {
+		switch provider {
+		case "ollama_chat":
+			return "ollama", rest
+		case "openrouter", "ollama", "anthropic", "groq", "mistral", "together_ai", "openai":
+			return provider, rest
+		}
+	}
+	if strings.HasPrefix(name, "claude-") {
+		return "anthropic", name
+	}
+	return "openai", name
+}
+
+// continue.dev lists models, each with a provider, in ~/.continue's
+// config.yaml, or config.json before it.
+
+func continuePaths() []string {
+	return []string{homePath(".continue", "config.yaml"), homePath(".continue", "config.json")}
+}
+
+func parseContinueConfig(path string, data []byte) (importedConfig, error) {
+	result := importedConfig{source: "continue", path: path}
+	type continueModel struct {
+		Title         string   `json:"title" yaml:"title"`
+		Name          string   `json:"name" yaml:"name"`
+		Provider      string   `json:"provider" yaml:"provider"`
+		Model         string   `json:"model" yaml:"model"`
+		APIBase       string   `json:"apiBase" yaml:"apiBase"`
+		APIKey        string   `json:"apiKey" yaml:"apiKey"`
+		Roles         []string `json:"roles" yaml:"roles"`
+		SystemMessage string   `json:"systemMessage" yaml:"systemMessage"`
+		ChatOptions   struct {
+			BaseSystemMessage string `json:"baseSystemMessage" yaml:"baseSystemMessage"`
+		} `json:"chatOptions" yaml:"chatOptions"`
+	}
+	var config struct {
+		Models        []continueModel `json:"models" yaml:"models"`
+		SystemMessage string          `json:"systemMessage" yaml:"systemMessage"`
+	}
+	var err error
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, &config)
+	} else {
+		err = yaml.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	for _, c := range config.Models {
+		if len(c.Roles) > 0 && !contains(c.Roles, "chat") {
+			continue
+		}
+		title := c.Title
+		if title == "" {
+			title = c.Name
+		}
+		if title == "" {
+			title = c.Model
+		}
+		m, ok := providerModel(modelSlug(title), c.Model, c.Provider, c.APIBase)
+		if !ok {
+			result.notes = append(result.notes, fmt.Sprintf("continue model %s uses provider %s, which q has no preset for; add it with q config", title, c.Provider))
+			continue
+		}
+		system := config.SystemMessage
+		for _, s := range []string{c.SystemMessage, c.ChatOptions.BaseSystemMessage} {
+			if s != "" {
+				system = s
+			}
+		}
+		if system != "" {
+			m.Prompt = []types.Message{{Role: "system", Content: system}}
+		}
+		if result.defaultModel == "" {
+			result.defaultModel = m.Name
+		}
+		result.models = append(result.models, m)
+		if c.APIKey != "" {
+			result.notes = append(result.notes, keyNote(path, m.Auth))
+		}
+	}
+	return result, nil
+}
+
+// findImports reads the configs of the CLIs named in only, or of all of
+// them, that exist.
+func findImports(only []string) ([]importedConfig, error) {
+	for _, name := range only {
+		known := false
+		for _, im := range configImporters {
+			known = known || im.name == name
+		}
+		if !known {
+			var names []string
+			for _, im := range configImporters {
+				names = append(names, im.name)
+			}
+			return nil, fmt.Errorf("cannot import from %q (supported: %s)", name, strings.Join(names, ", "))
+		}
+	}
+	var found []importedConfig
+	for _, im := range configImporters {
+		if len(only) > 0 && !contains(only, im.name) {
+			continue
+		}
+		for _, path := range im.paths() {
+			data, err := os.ReadFile(path)
+			if err != nil || path == "" {
+				continue
+			}
+			imported, err := im.parse(path, data)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %s", path, err)
+			}
+			found = append(found, imported)
+			break
+		}
+	}
+	return found, nil
+}
+
+// mergeImports adds the imported models that appConfig does not have yet.
+// A model whose name is taken by a different model is added under the
+// name suffixed with its source. The system prompt of models imported
+// without one is that of the default model, so they know how to work in a
+// terminal; imported system prompts are added to it.
+func mergeImports(appConfig AppConfig, found []importedConfig) (AppConfig, []string) {
+	basePrompt := []types.Message{{Role: "system", Content: "You are a helpful terminal assistant. Be concise and direct."}}
+	for _, m := range appConfig.Models {
+		if m.Name == appConfig.Preferences.DefaultModel && len(m.Prompt) > 0 {
+			basePrompt = m.Prompt
+		}
+	}
+
+	var report []string
+	models := append([]types.ModelConfig(nil), appConfig.Models...)
+	for _, imported := range found {
+		report = append(report, fmt.Sprintf("%s (%s):", imported.source, imported.path))
+		for _, m := range imported.models {
+			existing := -1
+			for i, e := range models {
+				if e.Endpoint == m.Endpoint && e.ModelName == m.ModelName {
+					existing = i
+				}
+			}
+			if existing >= 0 {
+				report = append(report, fmt.Sprintf("  = %s, already configured as %s", m.ModelName, models[existing].Name))
+				continue
+			}
+			original := m.Name
+			for contains(modelNames(models), m.Name) {
+				m.Name += "-" + imported.source
+			}
+			prompt := append([]types.Message(nil), basePrompt...)
+			if len(m.Prompt) > 0 && len(prompt) > 0 && prompt[0].Role == "system" {
+				prompt[0].Content += "\n\n" + m.Prompt[0].Content
+			}
+			m.Prompt = prompt
+			key := "no key"
+			if m.Auth != "" {
+				key = "key from $" + m.Auth
+			}
+			def := ""
+			if original == imported.defaultModel {
+				def = fmt.Sprintf(", %s's default", imported.source)
+			}
+			report = append(report, fmt.Sprintf("  + %s: %s at %s, %s%s", m.Name, m.ModelName, m.Endpoint, key, def))
+			models = append(models, m)
+		}
+		for _, note := range imported.notes {
+			report = append(report, "  ! "+note)
+		}
+	}
+	appConfig.Models = models
+	return appConfig, report
+}
+
+// runConfigImport imports the models of other AI CLIs, named in args or
+// all that are found, once the user confirms.
+func runConfigImport(args []string) {
+	found, err := findImports(args)
+	if err != nil {
+		fmt.Println(styleRed.PaddingLeft(2).Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+	if len(found) == 0 {
+		var names []string
+		for _, im := range configImporters {
+			names = append(names, im.name)
+		}
+		fmt.Println(greyStyle.PaddingLeft(2).Render("No configs found to import from (looked for " + strings.Join(names, ", ") + ")."))
+		return
+	}
+	appConfig, err := loadConfigFile()
+	if err != nil {
+		PrintConfigErrorMessage(err)
+		os.Exit(1)
+	}
+
+	merged, report := mergeImports(appConfig, found)
+	fmt.Println()
+	for _, line := range report {
+		fmt.Println("  " + line)
+	}
+	added := len(merged.Models) - len(appConfig.Models)
+	if added == 0 {
+		fmt.Println("\n" + greyStyle.PaddingLeft(2).Render("Nothing new to import.") + "\n")
+		return
+	}
+	fmt.Print("\n" + greyStyle.PaddingLeft(2).Render(fmt.Sprintf("Add %d model(s) to the config? (y/N):", added)) + " ")
+	response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	response = strings.ToLower(strings.TrimSpace(response))
+	if response != "y" && response != "yes" {
+		fmt.Println("\n" + styleRed.PaddingLeft(2).Render("Operation cancelled.\n"))
+		return
+	}
+	if err := SaveAppConfig(merged); err != nil {
+		fmt.Println(styleRed.PaddingLeft(2).Render("Error: " + err.Error()))
+		os.Exit(1)
+	}
+	fmt.Println("\n" + greyStyle.PaddingLeft(2).Render(fmt.Sprintf("Added %d model(s). Use one with q -m NAME, or make it the default in q config.", added)) + "\n")
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	. "q/types"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Profile is a named set of models and preferences, such as work, personal
+// or offline, laid over the rest of the config when it is active. Models,
+// when given, replace the config's; preferences override just the fields
+// they set, default_model included.
+type Profile struct {
+	Models      []ModelConfig          `yaml:"models,omitempty"`
+	Preferences map[string]interface{} `yaml:"preferences,omitempty"`
+	// SystemPrompt names a prompt in the library that every model uses
+	// while the profile is active.
+	SystemPrompt string `yaml:"system_prompt,omitempty"`
+}
+
+// profileOverride is the profile named with --profile.
+var profileOverride string
+
+// SetProfile selects the profile LoadAppConfig applies, ahead of Q_PROFILE
+// and the profile the config names.
+func SetProfile(name string) {
+	profileOverride = name
+}
+
+// activeProfile returns the name of the profile to use with config, or ""
+// for none.
+func activeProfile(config AppConfig) string {
+	if profileOverride != "" {
+		return profileOverride
+	}
+	if name := os.Getenv("Q_PROFILE"); name != "" {
+		return name
+	}
+	return config.Profile
+}
+
+// ProfileNames returns the names of the config's profiles, sorted.
+func ProfileNames(config AppConfig) []string {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile lays the profile called name over config.
+func applyProfile(config AppConfig, name string) (AppConfig, error) {
+	profile, ok := config.Profiles[name]
+	if !ok {
+		available := "none are configured"
+		if names := ProfileNames(config); len(names) > 0 {
+			available = "available: " + strings.Join(names, ", ")
+		}
+		return config, fmt.Errorf("profile %q not found (%s)", name, available)
+	}
+	if len(profile.Models) > 0 {
+		config.Models = profile.Models
+	}
+	if profile.SystemPrompt != "" {
+		models := make([]ModelConfig, len(config.Models))
+		for i, m := range config.Models {
+			m.SystemPrompt = profile.SystemPrompt
+			models[i] = m
+		}
+		config.Models = models
+	}
+	if len(profile.Preferences) > 0 {
+		data, err := yaml.Marshal(profile.Preferences)
+		if err != nil {
+			return config, fmt.Errorf("error in the preferences of profile %s: %s", name, err)
+		}
+		if err := yaml.Unmarshal(data, &config.Preferences); err != nil {
+			return config, fmt.Errorf("error in the preferences of profile %s: %s", name, err)
+		}
+	}
+	config.ActiveProfile = name
+	return config, nil
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	. "q/types"
+	"strings"
+)
+
+// The prompt library keeps system prompts apart from the models that use
+// them, so that one prompt can serve several models and profiles and be
+// changed in one place. A model or profile names its prompt with
+// system_prompt; LoadAppConfig puts the text in the model's prompt.
+
+// applyPrompts sets the system message of each model that names a prompt
+// in the library to that prompt.
+func applyPrompts(config AppConfig) (AppConfig, error) {
+	models := make([]ModelConfig, len(config.Models))
+	for i, m := range config.Models {
+		if m.SystemPrompt != "" {
+			text, ok := config.Prompts[m.SystemPrompt]
+			if !ok {
+				return config, fmt.Errorf("model %s uses the prompt %q, which is not in the prompt library (%s)", m.Name, m.SystemPrompt, promptList(config))
+			}
+			m.Prompt = withSystemPrompt(m.Prompt, text)
+		}
+		models[i] = m
+	}
+	config.Models = models
+	return config, nil
+}
+
+// promptList names the prompts in the library, for messages.
+func promptList(config AppConfig) string {
+	if len(config.Prompts) == 0 {
+		return "it is empty"
+	}
+	return "prompts: " + strings.Join(sortedKeys(config.Prompts), ", ")
+}
+
+// promptUsers returns the models, and the profiles as "profile NAME", that
+// use the prompt called name.
+func promptUsers(config AppConfig, name string) []string {
+	var users []string
+	for _, m := range config.Models {
+		if m.SystemPrompt == name {
+			users = append(users, m.Name)
+		}
+	}
+	for _, profile := range ProfileNames(config) {
+		if config.Profiles[profile].SystemPrompt == name {
+			users = append(users, "profile "+profile)
+		}
+		for _, m := range config.Profiles[profile].Models {
+			if m.SystemPrompt == name {
+				users = append(users, profile+"/"+m.Name)
+			}
+		}
+	}
+	return users
+}
+
+// renamePrompt renames the prompt called from, and points the models and
+// profiles that use it at its new name.
+func renamePrompt(config *AppConfig, from, to string) error {
+	if to == "" {
+		return fmt.Errorf("the prompt needs a name")
+	}
+	if to == from {
+		return nil
+	}
+	if _, ok := config.Prompts[to]; ok {
+		return fmt.Errorf("another prompt is already named %q", to)
+	}
+	config.Prompts[to] = config.Prompts[from]
+	delete(config.Prompts, from)
+	replacePromptName(config, from, to)
+	return nil
+}
+
+// deletePrompt removes the prompt called name from the library. The models
+// that used it go back to the system message in their own prompt.
+func deletePrompt(config *AppConfig, name string) {
+	delete(config.Prompts, name)
+	replacePromptName(config, name, "")
+}
+
+// replacePromptName sets system_prompt to to wherever it is from.
+func replacePromptName(config *AppConfig, from, to string) {
+	for i := range config.Models {
+		if config.Models[i].SystemPrompt == from {
+			config.Models[i].SystemPrompt = to
+		}
+	}
+	for name, profile := range config.Profiles {
+		if profile.SystemPrompt == from {
+			profile.SystemPrompt = to
+		}
+		for i := range profile.Models {
+			if profile.Models[i].SystemPrompt == from {
+				profile.Models[i].SystemPrompt = to
+			}
+		}
+		config.Profiles[name] = profile
+	}
+}
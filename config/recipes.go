@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	. "q/types"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var recipesDirPath string = ".shell-ai/recipes"
+
+// LoadRecipes returns the recipes defined in config plus any shared recipe
+// files in ~/.shell-ai/recipes. Config entries win over files with the same name.
+func LoadRecipes(appConfig AppConfig) ([]Recipe, error) {
+	recipes := append([]Recipe{}, appConfig.Recipes...)
+	seen := make(map[string]bool)
+	for _, r := range recipes {
+		seen[r.Name] = true
+	}
+
+	dir, err := FullFilePath(recipesDirPath)
+	if err != nil {
+		return recipes, nil
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	ymlFiles, _ := filepath.Glob(filepath.Join(dir, "*.yml"))
+	files = append(files, ymlFiles...)
+	sort.Strings(files)
+
+	for _, file := range files {
+		recipe, err := LoadRecipeFile(file)
+		if err != nil {
+			return recipes, err
+		}
+		if seen[recipe.Name] {
+			continue
+		}
+		seen[recipe.Name] = true
+		recipes = append(recipes, recipe)
+	}
+	return recipes, nil
+}
+
+// LoadRecipeFile reads a single shared recipe. The name defaults to the file name.
+func LoadRecipeFile(path string) (Recipe, error) {
+	var recipe Recipe
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return recipe, fmt.Errorf("error reading recipe %s: %s", path, err)
+	}
+	if err := yaml.Unmarshal(data, &recipe); err != nil {
+		return recipe, fmt.Errorf("error parsing recipe %s: %s", path, err)
+	}
+	if recipe.Name == "" {
+		recipe.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if strings.TrimSpace(recipe.Prompt) == "" {
+		return recipe, fmt.Errorf("recipe %s has no prompt", recipe.Name)
+	}
+	return recipe, nil
+}
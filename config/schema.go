@@ -0,0 +1,222 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"q/llm"
+	"q/util"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// jsonSchema is the part of JSON Schema (draft 7) the config's schema
+// uses.
+type jsonSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Ref         string                 `json:"$ref,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Enum        []string               `json:"enum,omitempty"`
+	Properties  map[string]*jsonSchema `json:"properties,omitempty"`
+	Items       *jsonSchema            `json:"items,omitempty"`
+	Definitions map[string]*jsonSchema `json:"definitions,omitempty"`
+	// AdditionalProperties is false for sections, whose keys are fixed,
+	// or the schema of the values of maps.
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+}
+
+// schemaEnums lists the values of the fields that take one of a few, by
+// the field's type and YAML key.
+var schemaEnums = map[string][]string{
+	"MemoryConfig.scope":           {llm.ScopeProject, llm.ScopeRepo, llm.ScopeParent, llm.ScopeGlobal},
+	"ModelConfig.auth_source":      {util.AuthSourceKeychain},
+	"VoiceConfig.auth_source":      {util.AuthSourceKeychain},
+	"EmbeddingsConfig.auth_source": {util.AuthSourceKeychain},
+	"Message.role":                 {"system", "user", "assistant"},
+}
+
+// configSchema returns the JSON Schema of the config file, worked out
+// from AppConfig so that it always matches what q reads.
+func configSchema() *jsonSchema {
+	defs := make(map[string]*jsonSchema)
+	root := structSchema(reflect.TypeOf(AppConfig{}), defs)
+	root.Schema = "http://json-schema.org/draft-07/schema#"
+	root.Title = "shell-ai config"
+	// Editors read $schema from JSON files themselves.
+	root.Properties["$schema"] = &jsonSchema{Type: "string"}
+	root.Definitions = defs
+	return root
+}
+
+// typeSchema returns the schema of values of type t, adding the structs
+// it refers to to defs.
+func typeSchema(t reflect.Type, defs map[string]*jsonSchema) *jsonSchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), defs)
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice:
+		return &jsonSchema{Type: "array", Items: typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if _, done := defs[t.Name()]; !done {
+			// Reserve the name first, as WatchConfig contains itself.
+			defs[t.Name()] = nil
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return &jsonSchema{Ref: "#/definitions/" + t.Name()}
+	}
+	// interface{}, as in profile preferences: anything.
+	return &jsonSchema{}
+}
+
+func structSchema(t reflect.Type, defs map[string]*jsonSchema) *jsonSchema {
+	s := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		field := typeSchema(t.Field(i).Type, defs)
+		if enum, ok := schemaEnums[t.Name()+"."+key]; ok {
+			field.Enum = enum
+		}
+		s.Properties[key] = field
+	}
+	return s
+}
+
+// checkSchema checks value, at field in the file, against s, returning
+// the problems with the line of their key in lines when it can be found.
+func checkSchema(value interface{}, s, root *jsonSchema, field string, lines []string) []configProblem {
+	if s.Ref != "" {
+		s = root.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	problem := func(message string) []configProblem {
+		return []configProblem{{Line: schemaKeyLine(lines, field), Field: field, Message: message}}
+	}
+	switch s.Type {
+	case "object":
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return problem(fmt.Sprintf("%s should be a table of settings", describeValue(value)))
+		}
+		var problems []configProblem
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			at := k
+			if field != "" {
+				at = field + "." + k
+			}
+			if prop, ok := s.Properties[k]; ok {
+				problems = append(problems, checkSchema(m[k], prop, root, at, lines)...)
+			} else if values, ok := s.AdditionalProperties.(*jsonSchema); ok {
+				problems = append(problems, checkSchema(m[k], values, root, at, lines)...)
+			} else {
+				message := fmt.Sprintf("unknown field %q", k)
+				names := make([]string, 0, len(s.Properties))
+				for name := range s.Properties {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				if near := nearestName(k, names); near != "" {
+					message += fmt.Sprintf("; did you mean %q?", near)
+				}
+				problems = append(problems, configProblem{Line: schemaKeyLine(lines, at), Field: at, Message: message})
+			}
+		}
+		return problems
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return problem(fmt.Sprintf("%s should be a list", describeValue(value)))
+		}
+		var problems []configProblem
+		for i, item := range list {
+			problems = append(problems, checkSchema(item, s.Items, root, fmt.Sprintf("%s[%d]", field, i), lines)...)
+		}
+		return problems
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return problem(fmt.Sprintf("%s should be text", describeValue(value)))
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, text) {
+			return problem(fmt.Sprintf("%q should be one of %s", text, strings.Join(s.Enum, ", ")))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return problem(fmt.Sprintf("%s should be true or false", describeValue(value)))
+		}
+	case "integer":
+		if n, ok := number(value); !ok || n != math.Trunc(n) {
+			return problem(fmt.Sprintf("%s should be a whole number", describeValue(value)))
+		}
+	case "number":
+		if _, ok := number(value); !ok {
+			return problem(fmt.Sprintf("%s should be a number", describeValue(value)))
+		}
+	}
+	return nil
+}
+
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "a table"
+	case []interface{}:
+		return "a list"
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(value))
+}
+
+var indexRe = regexp.MustCompile(`\[\d+\]`)
+
+// schemaKeyLine returns the line of the key at field, such as
+// models[2].endpoint, in a TOML or JSON file, looking for each key of the
+// path after the line of the one before, or 0 if it is not found. List
+// items are not told apart.
+func schemaKeyLine(lines []string, field string) int {
+	line := 0
+	for _, key := range strings.Split(indexRe.ReplaceAllString(field, ""), ".") {
+		keyRe := regexp.MustCompile(`(^|[\s.\[{,])("` + regexp.QuoteMeta(key) + `"|` + regexp.QuoteMeta(key) + `)\s*[:=\].]`)
+		found := false
+		// A key may follow the one before on its line, as in [a.b].
+		for i := max(line-1, 0); i < len(lines); i++ {
+			if keyRe.MatchString(lines[i]) {
+				line, found = i+1, true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+	return line
+}
@@ -0,0 +1,586 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"q/tools"
+	. "q/types"
+	"q/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configProblem is something `q config validate` found wrong with the
+// config file.
+type configProblem struct {
+	// Line is the line of the file it is on, or 0 if it is not known.
+	Line    int
+	Field   string
+	Message string
+	// Warning marks problems q can run with, such as the API key of a
+	// model other than the default not being set.
+	Warning bool
+}
+
+var (
+	yamlLineRe  = regexp.MustCompile(`line (\d+): (.*)`)
+	unknownRe   = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+	wrongTypeRe = regexp.MustCompile("^cannot unmarshal !!\\w+ `(.*)` into (\\S+)$")
+	envVarRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	configTypes = configFieldNames(reflect.TypeOf(AppConfig{}), make(map[string][]string))
+)
+
+// validateConfig checks the data of the config file at path, including
+// how the active profile and Q_ environment variables change it.
+func validateConfig(path string, data []byte) []configProblem {
+	lines := strings.Split(string(data), "\n")
+	var problems []configProblem
+
+	var config AppConfig
+	if configFormat(path) == "yaml" {
+		if err := yaml.UnmarshalStrict(data, &config); err != nil {
+			problems = append(problems, yamlProblems(err, "")...)
+			if _, ok := err.(*yaml.TypeError); !ok {
+				// Without the YAML parsed there is nothing more to check.
+				return problems
+			}
+		}
+	} else {
+		// TOML and JSON are checked against the schema, which finds what
+		// UnmarshalStrict does for YAML. The checks below look keys up as
+		// YAML, so only find the lines of their problems in YAML files.
+		doc, err := decodeDocument(path, data)
+		if err != nil {
+			return yamlProblems(err, "")
+		}
+		schema := configSchema()
+		problems = append(problems, checkSchema(doc, schema, schema, "", lines)...)
+		yamlData, _ := toYAML(path, data)
+		yaml.Unmarshal(yamlData, &config)
+		lines = nil
+	}
+
+	names := modelNames(config.Models)
+	defaultModel := config.Preferences.DefaultModel
+	if defaultModel != "" {
+		if m, err := ResolveModel(config, defaultModel); err != nil {
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, "preferences", "default_model"),
+				Field:   "preferences.default_model",
+				Message: err.Error(),
+			})
+		} else {
+			defaultModel = m.Name
+		}
+	}
+	problems = append(problems, checkModels(config.Models, defaultModel, config.Prompts, lines, "models")...)
+	problems = append(problems, checkPreferences(config.Preferences, names, lines, "preferences")...)
+	for i, recipe := range config.Recipes {
+		if recipe.Model == "" {
+			continue
+		}
+		if _, err := ResolveModel(config, recipe.Model); err != nil {
+			problems = append(problems, configProblem{
+				Line:    fieldLine(lines, listItemLines(lines, "recipes"), i, "model"),
+				Field:   fmt.Sprintf("recipes[%d].model", i),
+				Message: err.Error(),
+			})
+		}
+	}
+	for _, alias := range sortedKeys(config.Aliases) {
+		target := config.Aliases[alias]
+		switch {
+		case !contains(names, target):
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, "aliases", alias),
+				Field:   "aliases." + alias,
+				Message: fmt.Sprintf("no model is named %q (models: %s)", target, strings.Join(names, ", ")),
+			})
+		case contains(names, alias) && alias != target:
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, "aliases", alias),
+				Field:   "aliases." + alias,
+				Message: fmt.Sprintf("a model is named %q too, and -m %s picks that model rather than %s", alias, alias, target),
+				Warning: true,
+			})
+		}
+	}
+
+	for _, name := range sortedKeys(config.Prompts) {
+		if strings.TrimSpace(config.Prompts[name]) == "" {
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, "prompts", name),
+				Field:   "prompts." + name,
+				Message: "the prompt is empty, so the models using it get no system message",
+				Warning: true,
+			})
+		}
+	}
+
+	if config.Profile != "" {
+		if _, ok := config.Profiles[config.Profile]; !ok {
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, "profile"),
+				Field:   "profile",
+				Message: fmt.Sprintf("no profile is named %q (profiles: %s)", config.Profile, strings.Join(ProfileNames(config), ", ")),
+			})
+		}
+	}
+	for _, name := range ProfileNames(config) {
+		problems = append(problems, checkProfile(config, name, lines)...)
+	}
+
+	// The profile and environment apply to every run, so mistakes in
+	// them are as much the config's as those in the file.
+	if name := activeProfile(config); name != "" && name != config.Profile {
+		if _, err := applyProfile(config, name); err != nil {
+			problems = append(problems, configProblem{Field: "--profile / Q_PROFILE", Message: err.Error()})
+		}
+	}
+	if _, err := applyEnvOverrides(config); err != nil {
+		problems = append(problems, configProblem{Field: "environment", Message: err.Error()})
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if (problems[i].Line == 0) != (problems[j].Line == 0) {
+			return problems[j].Line == 0
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// yamlProblems turns a YAML error, which may list several problems each
+// with its line, into problems, suggesting the nearest field for unknown
+// ones.
+func yamlProblems(err error, field string) []configProblem {
+	var messages []string
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	var problems []configProblem
+	for _, message := range messages {
+		p := configProblem{Field: field, Message: message}
+		if m := yamlLineRe.FindStringSubmatch(message); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Message = m[2]
+		}
+		if m := unknownRe.FindStringSubmatch(p.Message); m != nil {
+			p.Message = fmt.Sprintf("unknown field %q", m[1])
+			if near := nearestName(m[1], configTypes[m[2]]); near != "" {
+				p.Message += fmt.Sprintf("; did you mean %q?", near)
+			}
+		}
+		if m := wrongTypeRe.FindStringSubmatch(p.Message); m != nil {
+			want := map[string]string{"int": "a whole number", "float64": "a number", "bool": "true or false", "string": "text"}[m[2]]
+			if want == "" {
+				want = "a " + strings.TrimPrefix(m[2], "types.")
+			}
+			p.Message = fmt.Sprintf("%q should be %s", m[1], want)
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// checkModels checks the models of the config or of a profile. lines is
+// nil when the models' lines cannot be found.
+func checkModels(models []ModelConfig, defaultModel string, prompts map[string]string, lines []string, field string) []configProblem {
+	var problems []configProblem
+	if len(models) == 0 && field == "models" {
+		return append(problems, configProblem{Line: keyLine(lines, "models"), Field: field, Message: "no models are configured; add one with q config"})
+	}
+	items := listItemLines(lines, field)
+	seen := make(map[string]bool)
+	for i, m := range models {
+		at := func(key string) int { return fieldLine(lines, items, i, key) }
+		name := fmt.Sprintf("%s[%d]", field, i)
+		if m.Name != "" {
+			name = fmt.Sprintf("%s[%d] (%s)", field, i, m.Name)
+		}
+		problem := func(key, message string, warning bool) {
+			problems = append(problems, configProblem{Line: at(key), Field: name + "." + key, Message: message, Warning: warning})
+		}
+
+		switch {
+		case m.Name == "":
+			problem("name", "the model has no name to pick it by", false)
+		case seen[m.Name]:
+			problem("name", fmt.Sprintf("another model is already named %q; --model picks only the first", m.Name), false)
+		}
+		seen[m.Name] = true
+
+		if m.Endpoint == "" {
+			problem("endpoint", "no endpoint; give the URL of the chat completions API", false)
+		} else if !validEndpoint(m.Endpoint) {
+			problem("endpoint", fmt.Sprintf("%q is not an http(s) URL, such as https://api.openai.com/v1/chat/completions", m.Endpoint), false)
+		}
+
+		// Only the default model's key is needed to start.
+		isDefault := m.Name == defaultModel || (defaultModel == "" && i == 0)
+		for key, variable := range map[string]string{"auth_env_var": m.Auth, "org_env_var": m.OrgID} {
+			switch {
+			case variable == "":
+			case !envVarRe.MatchString(variable):
+				problem(key, "should name the environment variable holding the value, not hold the value itself", false)
+			case key == "auth_env_var" && util.APIKey(variable, m.AuthSource) == "":
+				message := fmt.Sprintf("%s is not set; export %s=<your API key>, or store the key in the keychain with q config", variable, variable)
+				if m.AuthSource == util.AuthSourceKeychain {
+					message = fmt.Sprintf("%s is not set and the keychain has no key for it; store one with q config", variable)
+				}
+				problem(key, message, !isDefault)
+			}
+		}
+		switch {
+		case m.AuthSource != "" && m.AuthSource != util.AuthSourceKeychain:
+			problem("auth_source", fmt.Sprintf("%q is not an auth source; leave it out, or use %s", m.AuthSource, util.AuthSourceKeychain), false)
+		case m.AuthSource == util.AuthSourceKeychain && m.Auth == "":
+			problem("auth_source", "the keychain entry is named after auth_env_var, which is empty", false)
+		}
+		if m.InputPrice < 0 || m.OutputPrice < 0 {
+			problem("input_price", "prices cannot be negative", false)
+		}
+		if m.SystemPrompt != "" {
+			if _, ok := prompts[m.SystemPrompt]; !ok {
+				problem("system_prompt", missingPrompt(m.SystemPrompt, prompts), false)
+			} else if systemPrompt(m) != "" {
+				problem("system_prompt", "the library prompt replaces the system message in prompt, which is never used", true)
+			}
+		}
+	}
+	return problems
+}
+
+// checkPreferences checks the references preferences make to models and
+// tool categories. section is where they are in the file.
+func checkPreferences(prefs Preferences, models []string, lines []string, section string) []configProblem {
+	var problems []configProblem
+	for _, category := range sortedKeys(prefs.ToolCategories) {
+		if !contains(tools.Categories, category) {
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, section, "tool_categories", category),
+				Field:   section + ".tool_categories." + category,
+				Message: fmt.Sprintf("no tool category is named %q (categories: %s)", category, strings.Join(tools.Categories, ", ")),
+			})
+		}
+	}
+	if model := prefs.Agents.Model; model != "" && !contains(models, model) {
+		problems = append(problems, configProblem{
+			Line:    keyLine(lines, section, "agents", "model"),
+			Field:   section + ".agents.model",
+			Message: fmt.Sprintf("no model is named %q", model),
+		})
+	}
+	for _, role := range sortedKeys(prefs.Agents.Roles) {
+		if model := prefs.Agents.Roles[role].Model; model != "" && !contains(models, model) {
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, section, "agents", "roles", role, "model"),
+				Field:   section + ".agents.roles." + role + ".model",
+				Message: fmt.Sprintf("no model is named %q", model),
+			})
+		}
+	}
+	for event, list := range map[string][]Hook{
+		"pre_query": prefs.Hooks.PreQuery, "post_response": prefs.Hooks.PostResponse,
+		"pre_tool": prefs.Hooks.PreTool, "post_tool": prefs.Hooks.PostTool,
+	} {
+		for i, h := range list {
+			if strings.TrimSpace(h.Run) == "" {
+				problems = append(problems, configProblem{
+					Line:    keyLine(lines, section, "hooks", event),
+					Field:   fmt.Sprintf("%s.hooks.%s[%d].run", section, event, i),
+					Message: "the hook has no script to run",
+				})
+			}
+		}
+	}
+	return problems
+}
+
+// checkProfile checks the profile called name as it would apply.
+func checkProfile(config AppConfig, name string, lines []string) []configProblem {
+	section := "profiles." + name
+	profile := config.Profiles[name]
+	var problems []configProblem
+
+	var prefs Preferences
+	if len(profile.Preferences) > 0 {
+		data, err := yaml.Marshal(profile.Preferences)
+		if err == nil {
+			err = yaml.UnmarshalStrict(data, &prefs)
+		}
+		if err != nil {
+			// The lines are of the re-marshalled preferences, not the file's.
+			for _, p := range yamlProblems(err, section+".preferences") {
+				p.Line = keyLine(lines, "profiles", name, "preferences")
+				problems = append(problems, p)
+			}
+			return problems
+		}
+	}
+
+	if profile.SystemPrompt != "" {
+		if _, ok := config.Prompts[profile.SystemPrompt]; !ok {
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, "profiles", name, "system_prompt"),
+				Field:   section + ".system_prompt",
+				Message: missingPrompt(profile.SystemPrompt, config.Prompts),
+			})
+		}
+	}
+
+	applied, _ := applyProfile(config, name)
+	if len(profile.Models) > 0 {
+		problems = append(problems, checkModels(profile.Models, applied.Preferences.DefaultModel, config.Prompts, nil, section+".models")...)
+	}
+	names := modelNames(applied.Models)
+	if model, ok := profile.Preferences["default_model"].(string); ok && model != "" {
+		if _, err := ResolveModel(applied, model); err != nil {
+			problems = append(problems, configProblem{
+				Line:    keyLine(lines, "profiles", name, "preferences", "default_model"),
+				Field:   section + ".preferences.default_model",
+				Message: err.Error(),
+			})
+		}
+	}
+	problems = append(problems, checkPreferences(prefs, names, lines, section+".preferences")...)
+	return problems
+}
+
+// missingPrompt says that no prompt in the library is called name.
+func missingPrompt(name string, prompts map[string]string) string {
+	names := sortedKeys(prompts)
+	message := fmt.Sprintf("no prompt in the library is named %q", name)
+	if near := nearestName(name, names); near != "" {
+		return message + fmt.Sprintf("; did you mean %q?", near)
+	}
+	if len(names) == 0 {
+		return message + "; add it under prompts"
+	}
+	return message + " (prompts: " + strings.Join(names, ", ") + ")"
+}
+
+// keyLine returns the line of the mapping key at path, such as
+// "preferences", "default_model", or 0 if it is not in lines.
+func keyLine(lines []string, path ...string) int {
+	line, indent := 0, -1
+	for _, key := range path {
+		found := false
+		child := -1
+		for i := line; i < len(lines); i++ {
+			text := strings.TrimLeft(lines[i], " ")
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			in := len(lines[i]) - len(text)
+			if in <= indent {
+				break
+			}
+			if child < 0 {
+				child = in
+			}
+			if in == child && (strings.HasPrefix(text, key+":") || strings.HasPrefix(text, strconv.Quote(key)+":")) {
+				line, indent, found = i+1, in, true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+	return line
+}
+
+// listItemLines returns the index in lines of where each item of the
+// top-level list under key starts.
+func listItemLines(lines []string, key string) []int {
+	start := keyLine(lines, key)
+	if start == 0 {
+		return nil
+	}
+	var items []int
+	indent := -1
+	for i := start; i < len(lines); i++ {
+		text := strings.TrimLeft(lines[i], " ")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		in := len(lines[i]) - len(text)
+		if indent < 0 {
+			indent = in
+		}
+		if in < indent || (in == indent && !strings.HasPrefix(text, "-")) {
+			break
+		}
+		if in == indent {
+			items = append(items, i)
+		}
+	}
+	return items
+}
+
+// fieldLine returns the line of key in the item'th list item, or 0.
+func fieldLine(lines []string, items []int, item int, key string) int {
+	if item >= len(items) {
+		return 0
+	}
+	end := len(lines)
+	if item+1 < len(items) {
+		end = items[item+1]
+	}
+	for i := items[item]; i < end; i++ {
+		text := strings.TrimLeft(strings.TrimPrefix(strings.TrimLeft(lines[i], " "), "-"), " ")
+		if strings.HasPrefix(text, key+":") {
+			return i + 1
+		}
+	}
+	return items[item] + 1
+}
+
+// configFieldNames maps each struct type in the config, by the name YAML
+// errors give it, to its fields' keys.
+func configFieldNames(t reflect.Type, names map[string][]string) map[string][]string {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return configFieldNames(t.Elem(), names)
+	case reflect.Struct:
+		if _, done := names[t.String()]; done {
+			return names
+		}
+		names[t.String()] = nil
+		for i := 0; i < t.NumField(); i++ {
+			key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if key != "" && key != "-" {
+				names[t.String()] = append(names[t.String()], key)
+			}
+			configFieldNames(t.Field(i).Type, names)
+		}
+	}
+	return names
+}
+
+// nearestName returns the name in names closest to name, if it is close
+// enough to be a likely typo.
+func nearestName(name string, names []string) string {
+	best, bestDistance := "", 3
+	for _, n := range names {
+		if d := editDistance(strings.ToLower(name), n); d < bestDistance {
+			best, bestDistance = n, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// validEndpoint reports whether endpoint is an http(s) URL.
+func validEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func modelNames(models []ModelConfig) []string {
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runConfigValidate prints what is wrong with the config file and exits,
+// with status 1 if anything would stop q from running.
+func runConfigValidate() {
+	filePath, err := FullFilePath(configFile())
+	if err != nil {
+		fmt.Println(styleRed.PaddingLeft(2).Render(fmt.Sprintf("Error: %s", err)))
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		fmt.Println(greyStyle.PaddingLeft(2).Render(filePath + " does not exist yet; q creates it with the defaults when first run"))
+		return
+	}
+	if err != nil {
+		fmt.Println(styleRed.PaddingLeft(2).Render(fmt.Sprintf("Error reading config file: %s", err)))
+		os.Exit(1)
+	}
+
+	problems := validateConfig(filePath, data)
+	errors, warnings := 0, 0
+	for _, p := range problems {
+		if p.Warning {
+			warnings++
+		} else {
+			errors++
+		}
+	}
+	if len(problems) == 0 {
+		fmt.Println(greyStyle.PaddingLeft(2).Render(filePath + ": no problems found"))
+		return
+	}
+	fmt.Printf("\n  %s: %d error(s), %d warning(s)\n\n", filePath, errors, warnings)
+	for _, p := range problems {
+		where := "  "
+		if p.Line > 0 {
+			where = fmt.Sprintf("  line %d: ", p.Line)
+		}
+		kind := styleRed.Render("error")
+		if p.Warning {
+			kind = greyStyle.Render("warning")
+		}
+		field := ""
+		if p.Field != "" {
+			field = p.Field + ": "
+		}
+		fmt.Printf("%s%s: %s%s\n", where, kind, field, p.Message)
+	}
+	fmt.Println()
+	if errors > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AgentRun is a sub-agent's run: its task, how it went and, once read with
+// GetAgentRun, the conversation it had.
+type AgentRun struct {
+	ID int64 `json:"id"`
+	// AgentID is the ID the agent had in the session that ran it.
+	AgentID     string `json:"agent_id"`
+	ProjectPath string `json:"project_path,omitempty"`
+	Role        string `json:"role"`
+	Model       string `json:"model"`
+	// Tools are the tools and categories spawn_agent limited the agent
+	// to, nil for no limit.
+	Tools  []string `json:"tools,omitempty"`
+	Task   string   `json:"task"`
+	Status string   `json:"status"`
+	Result string   `json:"result,omitempty"`
+	Error  string   `json:"error,omitempty"`
+	// Transcript is the agent's messages as a JSON array.
+	Transcript string     `json:"transcript,omitempty"`
+	Tokens     int        `json:"tokens"`
+	Iterations int        `json:"iterations"`
+	StartedAt  time.Time  `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	EndedAt    *time.Time `json:"ended_at,omitempty"`
+}
+
+// SaveAgentRun records r, adding it and setting its ID if it has none, and
+// marks it updated now.
+func (db *DB) SaveAgentRun(r *AgentRun) error {
+	r.UpdatedAt = time.Now()
+	if r.StartedAt.IsZero() {
+		r.StartedAt = r.UpdatedAt
+	}
+	var ended interface{}
+	if r.EndedAt != nil {
+		ended = *r.EndedAt
+	}
+	var result, transcript, tools interface{}
+	if r.Result != "" {
+		result = db.seal(r.Result)
+	}
+	if r.Transcript != "" {
+		transcript = db.seal(r.Transcript)
+	}
+	if r.Tools != nil {
+		data, _ := json.Marshal(r.Tools)
+		tools = string(data)
+	}
+
+	if r.ID != 0 {
+		_, err := db.conn.Exec(`
+			UPDATE agent_runs SET status = ?, result = ?, error = ?, transcript = ?, tokens = ?, iterations = ?, updated_at = ?, ended_at = ?
+			WHERE id = ?
+		`, r.Status, result, nullIfEmpty(r.Error), transcript, r.Tokens, r.Iterations, r.UpdatedAt, ended, r.ID)
+		if err != nil {
+			return fmt.Errorf("failed to save agent run: %w", err)
+		}
+		return nil
+	}
+	res, err := db.conn.Exec(`
+		INSERT INTO agent_runs (agent_id, project_path, role, model, tools, task, status, result, error, transcript, tokens, iterations, started_at, updated_at, ended_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.AgentID, nullIfEmpty(r.ProjectPath), r.Role, r.Model, tools, db.seal(r.Task), r.Status, result, nullIfEmpty(r.Error),
+		transcript, r.Tokens, r.Iterations, r.StartedAt, r.UpdatedAt, ended)
+	if err != nil {
+		return fmt.Errorf("failed to save agent run: %w", err)
+	}
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+// AgentRuns returns the agent runs in the given projects (nil paths means
+// every project), newest first, without their transcripts.
+func (db *DB) AgentRuns(paths []string, limit int) ([]AgentRun, error) {
+	where, args := "1=1", []interface{}(nil)
+	if paths != nil {
+		where, args = projectClause(paths)
+	}
+	rows, err := db.conn.Query(`
+		SELECT id, agent_id, project_path, role, model, tools, task, status, result, error, tokens, iterations, started_at, updated_at, ended_at
+		FROM agent_runs WHERE `+where+` ORDER BY started_at DESC, id DESC LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent runs: %w", err)
+	}
+	defer rows.Close()
+	var runs []AgentRun
+	for rows.Next() {
+		r, err := db.scanAgentRun(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// GetAgentRun returns the agent run with the given ID, transcript included.
+func (db *DB) GetAgentRun(id int64) (*AgentRun, error) {
+	var transcript sql.NullString
+	row := db.conn.QueryRow(`
+		SELECT id, agent_id, project_path, role, model, tools, task, status, result, error, tokens, iterations, started_at, updated_at, ended_at, transcript
+		FROM agent_runs WHERE id = ?
+	`, id)
+	r, err := db.scanAgentRun(row, &transcript)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("agent run %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent run: %w", err)
+	}
+	r.Transcript = db.unsealNull(transcript).String
+	return &r, nil
+}
+
+// scanAgentRun reads a row of agent_runs, with its transcript into
+// transcript when it is selected.
+func (db *DB) scanAgentRun(row interface{ Scan(...interface{}) error }, transcript *sql.NullString) (AgentRun, error) {
+	var r AgentRun
+	var pp, tools, result, errText sql.NullString
+	var ended sql.NullTime
+	dest := []interface{}{&r.ID, &r.AgentID, &pp, &r.Role, &r.Model, &tools, &r.Task, &r.Status, &result, &errText,
+		&r.Tokens, &r.Iterations, &r.StartedAt, &r.UpdatedAt, &ended}
+	if transcript != nil {
+		dest = append(dest, transcript)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return r, err
+	}
+	r.ProjectPath, r.Error = pp.String, errText.String
+	r.Task = db.unseal(r.Task)
+	r.Result = db.unsealNull(result).String
+	if tools.Valid {
+		json.Unmarshal([]byte(tools.String), &r.Tools)
+	}
+	if ended.Valid {
+		r.EndedAt = &ended.Time
+	}
+	return r, nil
+}
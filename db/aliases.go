@@ -0,0 +1,286 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func normalizeAlias(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// AddAlias records another name an entity goes by, so that learning or
+// looking up an entity of the same type under that name finds it. It
+// returns false if the entity does not exist.
+func (db *DB) AddAlias(entityID int64, alias string) (bool, error) {
+	alias = normalizeAlias(alias)
+	if alias == "" {
+		return false, fmt.Errorf("alias is empty")
+	}
+	res, err := db.conn.Exec(`
+		INSERT OR IGNORE INTO knowledge_aliases (alias, entity_id, created_at)
+		SELECT ?, id, ? FROM knowledge_entities WHERE id = ?
+	`, alias, time.Now(), entityID)
+	if err != nil {
+		return false, fmt.Errorf("failed to add alias: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return true, nil
+	}
+	e, err := db.GetEntityByID(entityID)
+	return e != nil, err
+}
+
+// RemoveAlias forgets an alias of an entity.
+func (db *DB) RemoveAlias(entityID int64, alias string) (bool, error) {
+	res, err := db.conn.Exec("DELETE FROM knowledge_aliases WHERE alias = ? AND entity_id = ?", normalizeAlias(alias), entityID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove alias: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// Aliases returns the other names of an entity, sorted.
+func (db *DB) Aliases(entityID int64) ([]string, error) {
+	rows, err := db.conn.Query("SELECT alias FROM knowledge_aliases WHERE entity_id = ? ORDER BY alias", entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aliases: %w", err)
+	}
+	defer rows.Close()
+	var aliases []string
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// resolveAlias finds the entity of entityType that name refers to when no
+// entity has that exact name: one with the name in another case, or one
+// with it as an alias. Entities in projectPath are preferred over global
+// ones. It returns 0 if there is none.
+func (db *DB) resolveAlias(entityType, name, projectPath string) (int64, error) {
+	var id int64
+	err := db.conn.QueryRow(`
+		SELECT e.id FROM knowledge_entities e
+		WHERE e.type = ? AND (e.project_path IS ? OR e.project_path IS NULL)
+		  AND (lower(e.name) = ? OR e.id IN (SELECT entity_id FROM knowledge_aliases WHERE alias = ?))
+		ORDER BY e.project_path IS NULL, e.occurrence_count DESC
+		LIMIT 1
+	`, entityType, nullIfEmpty(projectPath), normalizeAlias(name), normalizeAlias(name)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// canonicalSubject returns the name of the entity a fact subject is an
+// alias of, or subject itself.
+func (db *DB) canonicalSubject(subject string) string {
+	var name string
+	err := db.conn.QueryRow(`
+		SELECT e.name FROM knowledge_aliases a JOIN knowledge_entities e ON e.id = a.entity_id
+		WHERE a.alias = ? AND NOT EXISTS (SELECT 1 FROM knowledge_entities WHERE name = ?)
+		ORDER BY e.occurrence_count DESC LIMIT 1
+	`, normalizeAlias(subject), subject).Scan(&name)
+	if err != nil {
+		return subject
+	}
+	return name
+}
+
+// aliasMatches returns entities with an alias that appears in query, for
+// searches that the full-text index, which only covers names and values,
+// would miss.
+func (db *DB) aliasMatches(query, entityType, projectPath string) ([]KnowledgeEntity, error) {
+	rows, err := db.conn.Query("SELECT alias, entity_id FROM knowledge_aliases")
+	if err != nil {
+		return nil, err
+	}
+	text := searchText(query) + " "
+	var ids []int64
+	seen := make(map[int64]bool)
+	for rows.Next() {
+		var alias string
+		var id int64
+		if rows.Scan(&alias, &id) != nil {
+			continue
+		}
+		if words := searchText(alias); words != " " && strings.Contains(text, words+" ") && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	var entities []KnowledgeEntity
+	for _, id := range ids {
+		e, err := db.GetEntityByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil || (entityType != "" && e.Type != entityType) || (projectPath != "" && e.ProjectPath != "" && e.ProjectPath != projectPath) {
+			continue
+		}
+		entities = append(entities, *e)
+	}
+	return entities, nil
+}
+
+// MergeEntities folds duplicate entities into one. Their relations are
+// moved to it (combined with any it already has, and dropped where they
+// would point at itself), facts about their names are rewritten to its name,
+// and their names and aliases become its aliases. Counts are added, the
+// seen dates widened, and the most trusted attribution kept.
+func (db *DB) MergeEntities(intoID int64, fromIDs []int64) (*KnowledgeEntity, error) {
+	into, err := db.GetEntityByID(intoID)
+	if err != nil {
+		return nil, err
+	}
+	if into == nil {
+		return nil, fmt.Errorf("no entity e%d", intoID)
+	}
+
+	var froms []*KnowledgeEntity
+	for _, fromID := range fromIDs {
+		if fromID == intoID {
+			continue
+		}
+		from, err := db.GetEntityByID(fromID)
+		if err != nil {
+			return nil, err
+		}
+		if from == nil {
+			return nil, fmt.Errorf("no entity e%d", fromID)
+		}
+		froms = append(froms, from)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, from := range froms {
+		fromID := from.ID
+		if err := mergeRelations(tx, intoID, fromID); err != nil {
+			return nil, err
+		}
+
+		if from.Name != into.Name {
+			// Only the facts of the duplicate's own project are about it;
+			// other projects may have a different thing of the same name.
+			project := nullIfEmpty(from.ProjectPath)
+			if _, err := tx.Exec("UPDATE OR IGNORE knowledge_facts SET subject = ? WHERE subject = ? AND project_path IS ?", into.Name, from.Name, project); err != nil {
+				return nil, fmt.Errorf("failed to merge facts: %w", err)
+			}
+			// What is left duplicates a fact about the merged entity.
+			if _, err := tx.Exec("DELETE FROM knowledge_facts WHERE subject = ? AND project_path IS ?", from.Name, project); err != nil {
+				return nil, fmt.Errorf("failed to merge facts: %w", err)
+			}
+		}
+
+		if _, err := tx.Exec("UPDATE OR IGNORE knowledge_aliases SET entity_id = ? WHERE entity_id = ?", intoID, fromID); err != nil {
+			return nil, fmt.Errorf("failed to merge aliases: %w", err)
+		}
+		if alias := normalizeAlias(from.Name); alias != normalizeAlias(into.Name) {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO knowledge_aliases (alias, entity_id, created_at) VALUES (?, ?, ?)", alias, intoID, time.Now()); err != nil {
+				return nil, fmt.Errorf("failed to merge aliases: %w", err)
+			}
+		}
+
+		if into.Value == "" {
+			into.Value = from.Value
+		}
+		if from.FirstSeen.Before(into.FirstSeen) {
+			into.FirstSeen = from.FirstSeen
+		}
+		into.LastSeen = later(into.LastSeen, from.LastSeen)
+		into.OccurrenceCount += from.OccurrenceCount
+		if from.Trust > into.Trust {
+			into.Source, into.SessionID, into.Model, into.Trust = from.Source, from.SessionID, from.Model, from.Trust
+		}
+
+		if _, err := tx.Exec("DELETE FROM knowledge_entities WHERE id = ?", fromID); err != nil {
+			return nil, fmt.Errorf("failed to merge entity: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE knowledge_entities SET value = ?, first_seen = ?, last_seen = ?, occurrence_count = ?,
+		source = ?, session_id = ?, model = ?, trust = ? WHERE id = ?`,
+		nullIfEmpty(into.Value), into.FirstSeen, into.LastSeen, into.OccurrenceCount,
+		nullIfEmpty(into.Source), nullIfEmpty(into.SessionID), nullIfEmpty(into.Model), into.Trust, intoID); err != nil {
+		return nil, fmt.Errorf("failed to merge entity: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return db.GetEntityByID(intoID)
+}
+
+// mergeRelations moves fromID's relations to intoID.
+func mergeRelations(tx *sql.Tx, intoID, fromID int64) error {
+	rows, err := tx.Query(`
+		SELECT id, source_id, relation, target_id, confidence, context, last_used, use_count
+		FROM knowledge_relations WHERE source_id = ? OR target_id = ?
+		ORDER BY id
+	`, fromID, fromID)
+	if err != nil {
+		return fmt.Errorf("failed to merge relations: %w", err)
+	}
+	var relations []KnowledgeRelation
+	for rows.Next() {
+		var r KnowledgeRelation
+		var ctx sql.NullString
+		if err := rows.Scan(&r.ID, &r.SourceID, &r.Relation, &r.TargetID, &r.Confidence, &ctx, &r.LastUsed, &r.UseCount); err != nil {
+			rows.Close()
+			return err
+		}
+		r.Context = ctx.String
+		relations = append(relations, r)
+	}
+	rows.Close()
+
+	for _, r := range relations {
+		if r.SourceID == fromID {
+			r.SourceID = intoID
+		}
+		if r.TargetID == fromID {
+			r.TargetID = intoID
+		}
+		if r.SourceID == r.TargetID {
+			if _, err := tx.Exec("DELETE FROM knowledge_relations WHERE id = ?", r.ID); err != nil {
+				return fmt.Errorf("failed to merge relations: %w", err)
+			}
+			continue
+		}
+
+		var existing KnowledgeRelation
+		err := tx.QueryRow("SELECT id, confidence, last_used FROM knowledge_relations WHERE source_id = ? AND relation = ? AND target_id = ?",
+			r.SourceID, r.Relation, r.TargetID).Scan(&existing.ID, &existing.Confidence, &existing.LastUsed)
+		switch {
+		case err == sql.ErrNoRows:
+			_, err = tx.Exec("UPDATE knowledge_relations SET source_id = ?, target_id = ? WHERE id = ?", r.SourceID, r.TargetID, r.ID)
+		case err == nil:
+			if moreConfident(r.Confidence, r.LastUsed, existing.Confidence, existing.LastUsed) {
+				existing.Confidence, existing.LastUsed = r.Confidence, r.LastUsed
+			}
+			_, err = tx.Exec("UPDATE knowledge_relations SET confidence = ?, context = COALESCE(context, ?), last_used = ?, use_count = use_count + ? WHERE id = ?",
+				existing.Confidence, nullIfEmpty(r.Context), existing.LastUsed, r.UseCount, existing.ID)
+			if err == nil {
+				_, err = tx.Exec("DELETE FROM knowledge_relations WHERE id = ?", r.ID)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to merge relations: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultBackups is how many daily backups are kept when the preference is
+// not set.
+const DefaultBackups = 7
+
+const backupTimeFormat = "20060102-150405"
+
+// Backup is a copy of the database in the backups directory.
+type Backup struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// BackupDir returns ~/.shell-ai/backups.
+func BackupDir() (string, error) {
+	dbPath, err := getDBPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(dbPath), "backups"), nil
+}
+
+// Backup writes a compacted, consistent copy of the database to the
+// backups directory and returns its path. It is safe while q is in use.
+func (db *DB) Backup() (string, error) {
+	dir, err := BackupDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	db.Flush()
+
+	path := filepath.Join(dir, "memory-"+time.Now().Format(backupTimeFormat)+".db")
+	// Write under a temporary name so an interrupted backup is never
+	// mistaken for a good one.
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if _, err := db.conn.Exec("VACUUM INTO ?", tmp); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to back up database: %w", err)
+	}
+	os.Chmod(tmp, 0600)
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// AutoBackup makes a backup if none was made in the last day and keeps the
+// newest keep backups. It returns the new backup's path, or "" if none was
+// due.
+func (db *DB) AutoBackup(keep int) (string, error) {
+	last, _ := db.getMeta("last_backup")
+	if t, err := time.Parse(time.RFC3339, last); err == nil && time.Since(t) < 24*time.Hour {
+		return "", nil
+	}
+	path, err := db.Backup()
+	if err != nil {
+		return "", err
+	}
+	db.setMeta(db.conn, "last_backup", time.Now().Format(time.RFC3339))
+	return path, PruneBackups(keep)
+}
+
+// ListBackups returns the backups, newest first.
+func ListBackups() ([]Backup, error) {
+	dir, err := BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "memory-") || !strings.HasSuffix(e.Name(), ".db") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Path: filepath.Join(dir, e.Name()), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ModTime.After(backups[j].ModTime) })
+	return backups, nil
+}
+
+// PruneBackups deletes all but the newest keep backups, along with any
+// left over from interrupted runs.
+func PruneBackups(keep int) error {
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+	for i, b := range backups {
+		if i >= keep {
+			os.Remove(b.Path)
+			os.Remove(b.Path + "-wal")
+		}
+	}
+	dir, _ := BackupDir()
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.db.tmp"))
+	for _, f := range leftovers {
+		os.Remove(f)
+	}
+	return nil
+}
+
+// ResolveBackup turns "latest", a backup file name or a path into the path
+// of a backup, and checks that it is intact.
+func ResolveBackup(name string) (string, error) {
+	path, err := findBackup(name)
+	if err != nil {
+		return "", err
+	}
+	return path, checkBackup(path)
+}
+
+func findBackup(name string) (string, error) {
+	if name == "latest" {
+		backups, err := ListBackups()
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", fmt.Errorf("no backups yet")
+		}
+		return backups[0].Path, nil
+	}
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	dir, err := BackupDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("no backup %q; see q db restore with no arguments", name)
+	}
+	return path, nil
+}
+
+// Restore replaces the database with a backup. No q process may have the
+// database open. The current database is first copied to the backups
+// directory as before-restore-*.db, a name that backup rotation leaves
+// alone, and that path is returned.
+func Restore(backupPath string) (string, error) {
+	if err := checkBackup(backupPath); err != nil {
+		return "", err
+	}
+	dbPath, err := getDBPath()
+	if err != nil {
+		return "", err
+	}
+	dir, err := BackupDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	// Copy the current file as is, WAL included: it may be unreadable,
+	// which is often why it is being restored.
+	var saved string
+	if _, err := os.Stat(dbPath); err == nil {
+		saved = filepath.Join(dir, "before-restore-"+time.Now().Format(backupTimeFormat)+".db")
+		if err := copyFile(dbPath, saved); err != nil {
+			return "", fmt.Errorf("failed to save the current database: %w", err)
+		}
+		if _, err := os.Stat(dbPath + "-wal"); err == nil {
+			if err := copyFile(dbPath+"-wal", saved+"-wal"); err != nil {
+				return "", fmt.Errorf("failed to save the current database: %w", err)
+			}
+		}
+	}
+
+	tmp := dbPath + ".restore"
+	if err := copyFile(backupPath, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	os.Remove(dbPath + "-wal")
+	os.Remove(dbPath + "-shm")
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return "", err
+	}
+	return saved, nil
+}
+
+// checkBackup makes sure a file is an intact q memory database.
+func checkBackup(path string) error {
+	conn, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("%s is not a SQLite database: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s is damaged: %s", path, result)
+	}
+	var tables int
+	conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('sessions', 'messages')").Scan(&tables)
+	if tables != 2 {
+		return fmt.Errorf("%s is not a q memory database", path)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,54 @@
+package db
+
+import "fmt"
+
+// Data categories that can be cleared without touching the others.
+const (
+	DataHistory   = "history"
+	DataKnowledge = "knowledge"
+	DataDocs      = "docs"
+)
+
+// clearTables lists each category's tables, children before parents, and
+// the full-text index to empty with them.
+var clearTables = map[string]struct {
+	tables []string
+	fts    string
+}{
+	DataHistory:   {[]string{"tool_calls", "context_files", "session_tags", "tags", "messages", "sessions", "agent_runs", "notes"}, "messages_fts"},
+	DataKnowledge: {[]string{"watch_repairs", "watch_errors", "command_outcomes", "knowledge_embeddings", "knowledge_relations", "knowledge_aliases", "knowledge_facts", "error_patterns", "knowledge_entities"}, "knowledge_fts"},
+	DataDocs:      {[]string{"docs"}, "docs_fts"},
+}
+
+// Clear deletes one category of data: conversation history, the knowledge
+// graph or the docs cache. Pinned memories, hosts and settings are kept.
+// The file is vacuumed afterwards so the deleted text is gone from disk.
+func (db *DB) Clear(category string) error {
+	target, ok := clearTables[category]
+	if !ok {
+		return fmt.Errorf("unknown data category %q", category)
+	}
+	db.Flush()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range target.tables {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %s(%s) VALUES('delete-all')", target.fts, target.fts)); err != nil {
+		return fmt.Errorf("failed to clear %s: %w", target.fts, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := db.Vacuum(); err != nil {
+		return err
+	}
+	return db.Checkpoint()
+}
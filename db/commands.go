@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CommandOutcome is the record of how a command went in a project.
+type CommandOutcome struct {
+	ID           int64     `json:"id"`
+	Command      string    `json:"command"`
+	ProjectPath  string    `json:"project_path,omitempty"`
+	SuccessCount int       `json:"success_count"`
+	FailureCount int       `json:"failure_count"`
+	LastExitCode int       `json:"last_exit_code"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastCwd      string    `json:"last_cwd,omitempty"`
+	LastRun      time.Time `json:"last_run"`
+}
+
+// Failing reports whether the command should not be suggested again: its
+// last run failed and it has failed at least as often as it has worked.
+func (o CommandOutcome) Failing() bool {
+	return o.LastExitCode != 0 && o.FailureCount >= o.SuccessCount
+}
+
+// maxCommandError caps how much of a failed command's output is kept.
+const maxCommandError = 500
+
+// RecordCommandOutcome counts a run of command in cwd, whose knowledge is
+// kept under projectPath. For a failure, the end of output is kept as the
+// error.
+func (db *DB) RecordCommandOutcome(command, projectPath, cwd string, exitCode int, output string) error {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return nil
+	}
+	success, failure := 1, 0
+	var lastError interface{}
+	if exitCode != 0 {
+		success, failure = 0, 1
+		output = strings.TrimSpace(output)
+		if len(output) > maxCommandError {
+			output = strings.ToValidUTF8(output[len(output)-maxCommandError:], "")
+		}
+		if output != "" {
+			lastError = db.seal(output)
+		}
+	}
+	now := time.Now()
+
+	// Looked up first: ON CONFLICT never fires for a NULL project path, nor
+	// for a sealed command.
+	existing, err := db.CommandOutcome(command, projectPath)
+	switch {
+	case err != nil:
+	case existing == nil:
+		_, err = db.conn.Exec(`
+			INSERT INTO command_outcomes (command, project_path, success_count, failure_count, last_exit_code, last_error, last_cwd, last_run)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, db.seal(command), nullIfEmpty(projectPath), success, failure, exitCode, lastError, nullIfEmpty(cwd), now)
+	default:
+		_, err = db.conn.Exec(`
+			UPDATE command_outcomes SET command = ?, success_count = success_count + ?, failure_count = failure_count + ?,
+				last_exit_code = ?, last_error = ?, last_cwd = ?, last_run = ?
+			WHERE id = ?
+		`, db.seal(command), success, failure, exitCode, lastError, nullIfEmpty(cwd), now, existing.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record command outcome: %w", err)
+	}
+	return nil
+}
+
+// FailingCommands returns the commands that keep failing in the given
+// projects (nil paths means every project), most recently run first.
+func (db *DB) FailingCommands(paths []string, limit int) ([]CommandOutcome, error) {
+	outcomes, err := db.CommandOutcomes(paths, 0)
+	if err != nil {
+		return nil, err
+	}
+	var failing []CommandOutcome
+	for _, o := range outcomes {
+		if o.Failing() && len(failing) < limit {
+			failing = append(failing, o)
+		}
+	}
+	return failing, nil
+}
+
+// CommandOutcome returns the record of command in projectPath, or nil if it
+// has not been run there.
+func (db *DB) CommandOutcome(command, projectPath string) (*CommandOutcome, error) {
+	command = strings.TrimSpace(command)
+	if db.aead == nil {
+		outcomes, err := db.queryCommandOutcomes("WHERE command = ? AND project_path IS ?", command, nullIfEmpty(projectPath))
+		if err != nil || len(outcomes) == 0 {
+			return nil, err
+		}
+		return &outcomes[0], nil
+	}
+	// Sealed commands differ each time they are sealed, so they are
+	// compared once opened.
+	outcomes, err := db.queryCommandOutcomes("WHERE project_path IS ?", nullIfEmpty(projectPath))
+	if err != nil {
+		return nil, err
+	}
+	for i := range outcomes {
+		if outcomes[i].Command == command {
+			return &outcomes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// CommandOutcomes returns the commands run in the given projects (nil paths
+// means every project), most recently run first; limit 0 returns them all.
+func (db *DB) CommandOutcomes(paths []string, limit int) ([]CommandOutcome, error) {
+	where := "WHERE 1=1"
+	var args []interface{}
+	if paths != nil {
+		clause, pathArgs := projectClause(paths)
+		where += " AND " + clause
+		args = pathArgs
+	}
+	where += " ORDER BY last_run DESC"
+	if limit > 0 {
+		where += " LIMIT ?"
+		args = append(args, limit)
+	}
+	return db.queryCommandOutcomes(where, args...)
+}
+
+func (db *DB) queryCommandOutcomes(where string, args ...interface{}) ([]CommandOutcome, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, command, project_path, success_count, failure_count, last_exit_code, last_error, last_cwd, last_run
+		FROM command_outcomes `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command outcomes: %w", err)
+	}
+	defer rows.Close()
+	var outcomes []CommandOutcome
+	for rows.Next() {
+		var o CommandOutcome
+		var pp, lastError, cwd sql.NullString
+		if err := rows.Scan(&o.ID, &o.Command, &pp, &o.SuccessCount, &o.FailureCount, &o.LastExitCode, &lastError, &cwd, &o.LastRun); err != nil {
+			return nil, err
+		}
+		o.Command = db.unseal(o.Command)
+		o.ProjectPath, o.LastError, o.LastCwd = pp.String, db.unsealNull(lastError).String, cwd.String
+		outcomes = append(outcomes, o)
+	}
+	return outcomes, rows.Err()
+}
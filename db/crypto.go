@@ -0,0 +1,426 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"q/util"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encryption is application-level: message content and session titles and
+// summaries are sealed with AES-256-GCM before they are written. The rest of
+// the schema (IDs, timestamps, paths, docs, knowledge) stays in plaintext.
+//
+// The key comes from $Q_DB_KEY, or from the OS keychain (see util's
+// KeychainGet) where `q db encrypt` stores a generated one.
+
+const (
+	// KeyEnvVar holds the database passphrase.
+	KeyEnvVar = "Q_DB_KEY"
+
+	keychainService = util.KeychainService
+	keychainAccount = "memory.db"
+	sealedPrefix    = "enc:v1:"
+	keyCheckText    = "shell-ai key check"
+)
+
+// sessionsUpdatedTrigger matches the trigger in schema.sql.
+const sessionsUpdatedTrigger = `CREATE TRIGGER IF NOT EXISTS sessions_updated_at
+AFTER UPDATE ON sessions
+BEGIN
+    UPDATE sessions SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END`
+
+func (db *DB) getMeta(key string) (string, error) {
+	var value string
+	err := db.conn.QueryRow("SELECT value FROM db_meta WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (db *DB) setMeta(ex execer, key, value string) error {
+	_, err := ex.Exec("INSERT OR REPLACE INTO db_meta (key, value) VALUES (?, ?)", key, value)
+	return err
+}
+
+// Encrypted reports whether content columns are sealed.
+func (db *DB) Encrypted() bool {
+	return db.aead != nil
+}
+
+func deriveKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealWith(aead cipher.AEAD, plaintext string) string {
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+func openWith(aead cipher.AEAD, value string) (string, error) {
+	if !strings.HasPrefix(value, sealedPrefix) {
+		return value, nil
+	}
+	if aead == nil {
+		return "", fmt.Errorf("value is encrypted but no key is loaded")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("corrupt encrypted value")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: wrong key?")
+	}
+	return string(plain), nil
+}
+
+// seal encrypts s when encryption is enabled.
+func (db *DB) seal(s string) string {
+	if db.aead == nil {
+		return s
+	}
+	return sealWith(db.aead, s)
+}
+
+// unseal decrypts s if it is sealed. Values that fail to decrypt are
+// replaced with a marker rather than failing whole queries.
+func (db *DB) unseal(s string) string {
+	plain, err := openWith(db.aead, s)
+	if err != nil {
+		return "[encrypted]"
+	}
+	return plain
+}
+
+// Seal encrypts s, when encryption is enabled, for content kept outside
+// the database such as saved tool output.
+func (db *DB) Seal(s string) string {
+	return db.seal(s)
+}
+
+// Unseal decrypts a value from Seal; plaintext is returned as it is.
+func (db *DB) Unseal(s string) (string, error) {
+	return openWith(db.aead, s)
+}
+
+func (db *DB) sealNull(s sql.NullString) sql.NullString {
+	if !s.Valid {
+		return s
+	}
+	return sql.NullString{String: db.seal(s.String), Valid: true}
+}
+
+func (db *DB) unsealNull(s sql.NullString) sql.NullString {
+	if !s.Valid {
+		return s
+	}
+	return sql.NullString{String: db.unseal(s.String), Valid: true}
+}
+
+// loadEncryption reads the encryption settings at open time and loads the
+// key when the database is encrypted.
+func (db *DB) loadEncryption() error {
+	salt, err := db.getMeta("kdf_salt")
+	if err != nil || salt == "" {
+		return err
+	}
+	passphrase, source := findKey()
+	if passphrase == "" {
+		return fmt.Errorf("the memory database is encrypted; set %s or store the key in the OS keychain (service %q, account %q)", KeyEnvVar, keychainService, keychainAccount)
+	}
+	aead, err := keyFromSalt(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	check, _ := db.getMeta("key_check")
+	if plain, err := openWith(aead, check); err != nil || plain != keyCheckText {
+		return fmt.Errorf("the key from %s does not unlock the memory database", source)
+	}
+	db.aead = aead
+	return nil
+}
+
+func keyFromSalt(passphrase, encodedSalt string) (cipher.AEAD, error) {
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt key salt: %w", err)
+	}
+	return deriveKey(passphrase, salt)
+}
+
+// findKey returns the passphrase and where it came from.
+func findKey() (string, string) {
+	if key := os.Getenv(KeyEnvVar); key != "" {
+		return key, "$" + KeyEnvVar
+	}
+	if key := keychainGet(); key != "" {
+		return key, "the OS keychain"
+	}
+	return "", ""
+}
+
+func keychainGet() string {
+	return util.KeychainGet(keychainService, keychainAccount)
+}
+
+func keychainSet(key string) error {
+	return util.KeychainSet(keychainService, keychainAccount, "shell-ai memory database", key)
+}
+
+// EncryptDatabase encrypts existing content in place. The key is taken from
+// $Q_DB_KEY or the keychain; when neither has one, a random key is generated
+// and stored in the keychain. It returns where the key lives.
+func (db *DB) EncryptDatabase() (string, error) {
+	if db.aead != nil {
+		return "", fmt.Errorf("the memory database is already encrypted")
+	}
+	passphrase, source := findKey()
+	if passphrase == "" {
+		random := make([]byte, 32)
+		rand.Read(random)
+		passphrase = base64.StdEncoding.EncodeToString(random)
+		if err := keychainSet(passphrase); err != nil {
+			return "", fmt.Errorf("%v; set %s to a passphrase instead", err, KeyEnvVar)
+		}
+		source = "the OS keychain"
+	}
+
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	encodedSalt := base64.StdEncoding.EncodeToString(salt)
+	aead, err := keyFromSalt(passphrase, encodedSalt)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.rewriteContent(func(s string) (string, error) {
+		if strings.HasPrefix(s, sealedPrefix) {
+			return s, nil
+		}
+		return sealWith(aead, s), nil
+	}, func(tx *sql.Tx) error {
+		if err := db.setMeta(tx, "kdf_salt", encodedSalt); err != nil {
+			return err
+		}
+		return db.setMeta(tx, "key_check", sealWith(aead, keyCheckText))
+	})
+	if err != nil {
+		return "", err
+	}
+	db.aead = aead
+	return source, nil
+}
+
+// DecryptDatabase turns an encrypted database back into plaintext.
+func (db *DB) DecryptDatabase() error {
+	if db.aead == nil {
+		return fmt.Errorf("the memory database is not encrypted")
+	}
+	aead := db.aead
+	err := db.rewriteContent(func(s string) (string, error) {
+		return openWith(aead, s)
+	}, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM db_meta WHERE key IN ('kdf_salt', 'key_check')")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	db.aead = nil
+	return nil
+}
+
+// rewriteContent applies fn to every sealed column in one transaction, then
+// rebuilds the search index and vacuums so no old copies stay in the file.
+func (db *DB) rewriteContent(fn func(string) (string, error), finish func(tx *sql.Tx) error) error {
+	db.Flush()
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The updated_at trigger would make every session look just used; drop it
+	// for the rewrite and put it back afterwards.
+	if _, err := tx.Exec("DROP TRIGGER IF EXISTS sessions_updated_at"); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "messages", "content", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "sessions", "title", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "sessions", "summary", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "memories", "content", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "tool_calls", "arguments", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "tool_calls", "result", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "command_outcomes", "command", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "command_outcomes", "last_error", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "watch_errors", "message", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "watch_repairs", "diff", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "agent_runs", "task", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "agent_runs", "result", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "agent_runs", "transcript", fn); err != nil {
+		return err
+	}
+	if err := rewriteColumn(tx, "notes", "content", fn); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO messages_fts(messages_fts) VALUES('rebuild')"); err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	if err := finish(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(sessionsUpdatedTrigger); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	_, err = db.conn.Exec("VACUUM")
+	return err
+}
+
+func rewriteColumn(tx *sql.Tx, table, column string, fn func(string) (string, error)) error {
+	rows, err := tx.Query(fmt.Sprintf("SELECT rowid, %s FROM %s WHERE %s IS NOT NULL", column, table, column))
+	if err != nil {
+		return err
+	}
+	values := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		values[id] = value
+	}
+	rows.Close()
+
+	for id, value := range values {
+		updated, err := fn(value)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", table, column, err)
+		}
+		if updated == value {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE rowid = ?", table, column), updated, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchSealedMessages is the search path for encrypted databases, where the
+// FTS index only sees ciphertext: messages are decrypted and matched in Go.
+// Every query term must appear; more occurrences rank higher.
+func (db *DB) searchSealedMessages(query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.conn.Query("SELECT id, session_id, content FROM messages ORDER BY created_at DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	// Like searchFTS, prefer messages with every term and fall back to
+	// messages with any of them.
+	var all, some []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.MessageID, &r.SessionID, &r.Content); err != nil {
+			return nil, err
+		}
+		r.Content = db.unseal(r.Content)
+		lower := strings.ToLower(r.Content)
+		hits, matched := 0, 0
+		for _, t := range terms {
+			n := 0
+			for _, word := range t {
+				c := strings.Count(lower, word)
+				if c == 0 {
+					n = 0
+					break
+				}
+				n += c
+			}
+			if n > 0 {
+				hits += n
+				matched++
+			}
+		}
+		if hits == 0 {
+			continue
+		}
+		// bm25 ranks are negative with lower meaning better; mirror that.
+		r.Rank = -float64(hits)
+		if matched == len(terms) {
+			all = append(all, r)
+		} else {
+			some = append(some, r)
+		}
+	}
+	results := all
+	if len(results) == 0 {
+		results = some
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank < results[j].Rank })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"crypto/cipher"
 	"crypto/sha256"
 	"database/sql"
 	_ "embed"
@@ -18,7 +19,9 @@ import (
 var schemaSQL string
 
 type DB struct {
-	conn *sql.DB
+	conn   *sql.DB
+	aead   cipher.AEAD // nil unless the database is encrypted
+	writer *writer
 }
 
 func getDBPath() (string, error) {
@@ -39,25 +42,39 @@ func Open() (*DB, error) {
 		return nil, fmt.Errorf("failed to get database path: %w", err)
 	}
 
-	conn, err := sql.Open("sqlite", dbPath)
+	// Pragmas in the DSN apply to every pooled connection. WAL lets readers
+	// run while the background writer commits, and busy_timeout makes
+	// concurrent q processes wait for the lock instead of failing.
+	dsn := "file:" + dbPath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	conn, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-
-	if _, err := conn.Exec("PRAGMA foreign_keys = ON"); err != nil {
+	if err := conn.Ping(); err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	if _, err := conn.Exec(schemaSQL); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
+	if err := migrate(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to upgrade schema: %w", err)
+	}
 
-	return &DB{conn: conn}, nil
+	db := &DB{conn: conn}
+	if err := db.loadEncryption(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	db.writer = newWriter(db)
+	return db, nil
 }
 
 func (db *DB) Close() error {
+	db.writer.close()
 	return db.conn.Close()
 }
 
@@ -83,29 +100,44 @@ func (db *DB) CreateSession(projectPath string) (*Session, error) {
 
 func (db *DB) GetSession(id string) (*Session, error) {
 	row := db.conn.QueryRow(
-		"SELECT id, created_at, updated_at, project_path, title, summary FROM sessions WHERE id = ?",
+		"SELECT id, created_at, updated_at, project_path, title, summary, prompt_tokens, completion_tokens, cost FROM sessions WHERE id = ?",
 		id,
 	)
 
 	var s Session
-	err := row.Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt, &s.ProjectPath, &s.Title, &s.Summary)
+	err := row.Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt, &s.ProjectPath, &s.Title, &s.Summary,
+		&s.Usage.PromptTokens, &s.Usage.CompletionTokens, &s.Usage.Cost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
+	s.Title = db.unsealNull(s.Title)
+	s.Summary = db.unsealNull(s.Summary)
 	return &s, nil
 }
 
 func (db *DB) GetRecentSessions(projectPath string, limit int) ([]SessionSummary, error) {
+	return db.GetRecentSessionsIn([]string{projectPath}, limit)
+}
+
+// GetRecentSessionsIn returns the latest sessions from any of the given
+// projects; nil paths means every project.
+func (db *DB) GetRecentSessionsIn(paths []string, limit int) ([]SessionSummary, error) {
+	where := "1=1"
+	var args []interface{}
+	if paths != nil {
+		where, args = projectClause(paths)
+	}
 	query := `
-		SELECT s.id, s.project_path, s.title, s.updated_at, COUNT(m.id) as message_count
+		SELECT s.id, s.project_path, s.title, s.updated_at, COUNT(m.id) as message_count,
+			s.prompt_tokens, s.completion_tokens, s.cost
 		FROM sessions s
 		LEFT JOIN messages m ON s.id = m.session_id
-		WHERE s.project_path = ?
+		WHERE ` + where + `
 		GROUP BY s.id
 		ORDER BY s.updated_at DESC
 		LIMIT ?
 	`
-	rows, err := db.conn.Query(query, projectPath, limit)
+	rows, err := db.conn.Query(query, append(args, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent sessions: %w", err)
 	}
@@ -115,11 +147,12 @@ func (db *DB) GetRecentSessions(projectPath string, limit int) ([]SessionSummary
 	for rows.Next() {
 		var s SessionSummary
 		var title sql.NullString
-		if err := rows.Scan(&s.ID, &s.ProjectPath, &title, &s.UpdatedAt, &s.MessageCount); err != nil {
+		if err := rows.Scan(&s.ID, &s.ProjectPath, &title, &s.UpdatedAt, &s.MessageCount,
+			&s.Usage.PromptTokens, &s.Usage.CompletionTokens, &s.Usage.Cost); err != nil {
 			return nil, err
 		}
 		if title.Valid {
-			s.Title = title.String
+			s.Title = db.unseal(title.String)
 		}
 		sessions = append(sessions, s)
 	}
@@ -127,12 +160,12 @@ func (db *DB) GetRecentSessions(projectPath string, limit int) ([]SessionSummary
 }
 
 func (db *DB) UpdateSessionTitle(id string, title string) error {
-	_, err := db.conn.Exec("UPDATE sessions SET title = ? WHERE id = ?", title, id)
+	_, err := db.conn.Exec("UPDATE sessions SET title = ? WHERE id = ?", db.seal(title), id)
 	return err
 }
 
 func (db *DB) UpdateSessionSummary(id string, summary string) error {
-	_, err := db.conn.Exec("UPDATE sessions SET summary = ? WHERE id = ?", summary, id)
+	_, err := db.conn.Exec("UPDATE sessions SET summary = ? WHERE id = ?", db.seal(summary), id)
 	return err
 }
 
@@ -142,7 +175,7 @@ func (db *DB) AddMessage(sessionID string, role string, content string, tokenCou
 
 	_, err := db.conn.Exec(
 		"INSERT INTO messages (id, session_id, role, content, created_at, token_count) VALUES (?, ?, ?, ?, ?, ?)",
-		id, sessionID, role, content, now, tokenCount,
+		id, sessionID, role, db.seal(content), now, tokenCount,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add message: %w", err)
@@ -160,7 +193,7 @@ func (db *DB) AddMessage(sessionID string, role string, content string, tokenCou
 
 func (db *DB) GetMessages(sessionID string) ([]Message, error) {
 	rows, err := db.conn.Query(
-		"SELECT id, session_id, role, content, created_at, token_count FROM messages WHERE session_id = ? ORDER BY created_at",
+		"SELECT id, session_id, role, content, created_at, token_count, model, latency_ms FROM messages WHERE session_id = ? ORDER BY created_at",
 		sessionID,
 	)
 	if err != nil {
@@ -171,45 +204,61 @@ func (db *DB) GetMessages(sessionID string) ([]Message, error) {
 	var messages []Message
 	for rows.Next() {
 		var m Message
-		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Content, &m.CreatedAt, &m.TokenCount); err != nil {
+		var model sql.NullString
+		var latency sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Content, &m.CreatedAt, &m.TokenCount, &model, &latency); err != nil {
 			return nil, err
 		}
+		m.Content = db.unseal(m.Content)
+		m.Model, m.LatencyMS = model.String, latency.Int64
 		messages = append(messages, m)
 	}
 	return messages, nil
 }
 
 func (db *DB) SearchMessages(query string, limit int) ([]SearchResult, error) {
-	rows, err := db.conn.Query(`
-		SELECT m.id, m.session_id, m.content, bm25(messages_fts) as rank
-		FROM messages_fts
-		JOIN messages m ON messages_fts.rowid = m.rowid
-		WHERE messages_fts MATCH ?
-		ORDER BY rank
-		LIMIT ?
-	`, query, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search messages: %w", err)
+	if db.aead != nil {
+		return db.searchSealedMessages(query, limit)
 	}
-	defer rows.Close()
-
 	var results []SearchResult
-	for rows.Next() {
-		var r SearchResult
-		if err := rows.Scan(&r.MessageID, &r.SessionID, &r.Content, &r.Rank); err != nil {
-			return nil, err
+	err := db.searchFTS("messages_fts", query, func(match string) (int, error) {
+		rows, err := db.conn.Query(`
+			SELECT m.id, m.session_id, m.content, bm25(messages_fts) as rank
+			FROM messages_fts
+			JOIN messages m ON messages_fts.rowid = m.rowid
+			WHERE messages_fts MATCH ?
+			ORDER BY rank
+			LIMIT ?
+		`, match, limit)
+		if err != nil {
+			return 0, fmt.Errorf("failed to search messages: %w", err)
 		}
-		results = append(results, r)
-	}
-	return results, nil
+		defer rows.Close()
+
+		results = nil
+		for rows.Next() {
+			var r SearchResult
+			if err := rows.Scan(&r.MessageID, &r.SessionID, &r.Content, &r.Rank); err != nil {
+				return 0, err
+			}
+			results = append(results, r)
+		}
+		return len(results), rows.Err()
+	})
+	return results, err
+}
+
+// ContentHash is the hash stored for a context file's content.
+func ContentHash(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
 }
 
 func (db *DB) AddContextFile(sessionID string, filePath string, content string) (*ContextFile, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
-	hash := sha256.Sum256([]byte(content))
-	contentHash := hex.EncodeToString(hash[:])
+	contentHash := ContentHash(content)
 
 	_, err := db.conn.Exec(
 		"INSERT OR REPLACE INTO context_files (id, session_id, file_path, content_hash, added_at) VALUES (?, ?, ?, ?, ?)",
@@ -267,6 +316,10 @@ func (db *DB) AddTag(name string) (*Tag, error) {
 }
 
 func (db *DB) TagSession(sessionID string, tagName string) error {
+	tagName = NormalizeTag(tagName)
+	if tagName == "" {
+		return fmt.Errorf("tag name is empty")
+	}
 	tag, err := db.AddTag(tagName)
 	if err != nil {
 		return err
@@ -281,7 +334,8 @@ func (db *DB) TagSession(sessionID string, tagName string) error {
 
 func (db *DB) GetSessionsByTag(tagName string, limit int) ([]SessionSummary, error) {
 	query := `
-		SELECT s.id, s.project_path, s.title, s.updated_at, COUNT(m.id) as message_count
+		SELECT s.id, s.project_path, s.title, s.updated_at, COUNT(m.id) as message_count,
+			s.prompt_tokens, s.completion_tokens, s.cost
 		FROM sessions s
 		JOIN session_tags st ON s.id = st.session_id
 		JOIN tags t ON st.tag_id = t.id
@@ -291,7 +345,7 @@ func (db *DB) GetSessionsByTag(tagName string, limit int) ([]SessionSummary, err
 		ORDER BY s.updated_at DESC
 		LIMIT ?
 	`
-	rows, err := db.conn.Query(query, tagName, limit)
+	rows, err := db.conn.Query(query, NormalizeTag(tagName), limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sessions by tag: %w", err)
 	}
@@ -301,11 +355,12 @@ func (db *DB) GetSessionsByTag(tagName string, limit int) ([]SessionSummary, err
 	for rows.Next() {
 		var s SessionSummary
 		var title sql.NullString
-		if err := rows.Scan(&s.ID, &s.ProjectPath, &title, &s.UpdatedAt, &s.MessageCount); err != nil {
+		if err := rows.Scan(&s.ID, &s.ProjectPath, &title, &s.UpdatedAt, &s.MessageCount,
+			&s.Usage.PromptTokens, &s.Usage.CompletionTokens, &s.Usage.Cost); err != nil {
 			return nil, err
 		}
 		if title.Valid {
-			s.Title = title.String
+			s.Title = db.unseal(title.String)
 		}
 		sessions = append(sessions, s)
 	}
@@ -347,6 +402,7 @@ func (db *DB) GetRelevantContext(projectPath string, query string, limit int) ([
 }
 
 func (db *DB) DeleteSession(id string) error {
+	db.Flush()
 	_, err := db.conn.Exec("DELETE FROM sessions WHERE id = ?", id)
 	return err
 }
@@ -461,32 +517,36 @@ func (db *DB) GetDocByName(name string) (*Doc, error) {
 }
 
 func (db *DB) SearchDocs(query string, limit int) ([]DocSearchResult, error) {
-	rows, err := db.conn.Query(`
-		SELECT d.id, d.name, d.source, d.summary, bm25(docs_fts) as rank
-		FROM docs_fts
-		JOIN docs d ON docs_fts.rowid = d.id
-		WHERE docs_fts MATCH ?
-		ORDER BY rank
-		LIMIT ?
-	`, query, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search docs: %w", err)
-	}
-	defer rows.Close()
-
 	var results []DocSearchResult
-	for rows.Next() {
-		var r DocSearchResult
-		var summary sql.NullString
-		if err := rows.Scan(&r.ID, &r.Name, &r.Source, &summary, &r.Rank); err != nil {
-			return nil, err
+	err := db.searchFTS("docs_fts", query, func(match string) (int, error) {
+		rows, err := db.conn.Query(`
+			SELECT d.id, d.name, d.source, d.summary, bm25(docs_fts) as rank
+			FROM docs_fts
+			JOIN docs d ON docs_fts.rowid = d.id
+			WHERE docs_fts MATCH ?
+			ORDER BY rank
+			LIMIT ?
+		`, match, limit)
+		if err != nil {
+			return 0, fmt.Errorf("failed to search docs: %w", err)
 		}
-		if summary.Valid {
-			r.Summary = summary.String
+		defer rows.Close()
+
+		results = nil
+		for rows.Next() {
+			var r DocSearchResult
+			var summary sql.NullString
+			if err := rows.Scan(&r.ID, &r.Name, &r.Source, &summary, &r.Rank); err != nil {
+				return 0, err
+			}
+			if summary.Valid {
+				r.Summary = summary.String
+			}
+			results = append(results, r)
 		}
-		results = append(results, r)
-	}
-	return results, nil
+		return len(results), rows.Err()
+	})
+	return results, err
 }
 
 func (db *DB) ListDocs(limit int) ([]Doc, error) {
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Confidence in facts and relations fades while they go unconfirmed: the
+// stored value is the confidence as of last_verified (or last_used), and
+// readers see it halved for every confidenceHalfLife since.
+const (
+	confidenceHalfLife = 90 * 24 * time.Hour
+	// contradictionPenalty scales a fact's confidence when a different
+	// value is learned for the same subject and predicate.
+	contradictionPenalty = 0.5
+	// Entries below minConfidence that have not been used for pruneIdle
+	// are removed by Prune.
+	minConfidence = 0.2
+	pruneIdle     = 30 * 24 * time.Hour
+)
+
+// decay returns confidence as it stands now, lastUsed being when it was
+// stored.
+func decay(confidence float64, lastUsed time.Time) float64 {
+	age := time.Since(lastUsed)
+	if age <= 0 {
+		return confidence
+	}
+	return confidence * math.Pow(0.5, float64(age)/float64(confidenceHalfLife))
+}
+
+// moreConfident reports whether confidence a, stored at aUsed, stands
+// higher than b, stored at bUsed, once both have decayed.
+func moreConfident(a float64, aUsed time.Time, b float64, bUsed time.Time) bool {
+	return a*math.Pow(0.5, float64(bUsed.Sub(aUsed))/float64(confidenceHalfLife)) > b
+}
+
+// pruneDecayed deletes facts and relations whose decayed confidence is below
+// minConfidence and that have not been used for pruneIdle. Facts from the
+// user never fade, and rejected ones are kept so they are not learned again.
+func pruneDecayed(tx *sql.Tx, result *PruneResult) error {
+	for _, t := range []struct {
+		table, used, where string
+		count              *int64
+	}{
+		{"knowledge_facts", "last_verified", fmt.Sprintf("WHERE trust < %d AND rejected = 0", TrustUser), &result.Facts},
+		{"knowledge_relations", "last_used", "", &result.Relations},
+	} {
+		rows, err := tx.Query(fmt.Sprintf("SELECT id, confidence, %s FROM %s %s", t.used, t.table, t.where))
+		if err != nil {
+			return fmt.Errorf("retention: %w", err)
+		}
+		var stale []int64
+		for rows.Next() {
+			var id int64
+			var confidence float64
+			var used time.Time
+			if rows.Scan(&id, &confidence, &used) != nil {
+				continue
+			}
+			if time.Since(used) > pruneIdle && decay(confidence, used) < minConfidence {
+				stale = append(stale, id)
+			}
+		}
+		rows.Close()
+		for _, id := range stale {
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", t.table), id); err != nil {
+				return fmt.Errorf("retention: %w", err)
+			}
+		}
+		*t.count += int64(len(stale))
+	}
+	return nil
+}
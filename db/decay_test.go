@@ -0,0 +1,79 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPruneKeepsReviewedFacts checks that decay removes a faded learned
+// fact but never one the user accepted or rejected.
+func TestPruneKeepsReviewedFacts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(KeyEnvVar, "")
+	database, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	old := time.Now().Add(-2 * 365 * 24 * time.Hour)
+	ids := map[string]int64{}
+	for _, subject := range []string{"learned", "accepted", "rejected"} {
+		res, err := database.conn.Exec(`INSERT INTO knowledge_facts (category, subject, predicate, object, confidence, created_at, last_verified)
+			VALUES ('preference', ?, 'uses', 'x', 0.5, ?, ?)`, subject, old, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[subject], _ = res.LastInsertId()
+	}
+	if _, err := database.ReviewFact(ids["accepted"], true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.ReviewFact(ids["rejected"], false); err != nil {
+		t.Fatal(err)
+	}
+	// Reviewed long ago: only trust and rejection should keep them.
+	if _, err := database.conn.Exec("UPDATE knowledge_facts SET last_verified = ?", old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.Prune(0); err != nil {
+		t.Fatal(err)
+	}
+	for subject, id := range ids {
+		var n int
+		database.conn.QueryRow("SELECT COUNT(*) FROM knowledge_facts WHERE id = ?", id).Scan(&n)
+		if want := subject != "learned"; (n == 1) != want {
+			t.Errorf("%s fact kept = %v, want %v", subject, n == 1, want)
+		}
+	}
+}
+
+// TestReviewFactVerifies checks that reviewing a fact restarts its decay.
+func TestReviewFactVerifies(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(KeyEnvVar, "")
+	database, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	old := time.Now().Add(-365 * 24 * time.Hour)
+	res, err := database.conn.Exec(`INSERT INTO knowledge_facts (category, subject, predicate, object, confidence, created_at, last_verified)
+		VALUES ('preference', 'user', 'uses', 'x', 0.5, ?, ?)`, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	if _, err := database.ReviewFact(id, true); err != nil {
+		t.Fatal(err)
+	}
+	var verified time.Time
+	if err := database.conn.QueryRow("SELECT last_verified FROM knowledge_facts WHERE id = ?", id).Scan(&verified); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(verified) > time.Minute {
+		t.Errorf("last_verified = %v, want now", verified)
+	}
+}
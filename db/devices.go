@@ -0,0 +1,61 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KnownDevice maps a MAC address to the last IP and name it was seen with.
+type KnownDevice struct {
+	MAC      string    `json:"mac"`
+	IP       string    `json:"ip,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// SaveDevice records a sighting. An empty name keeps the name already stored,
+// so an anonymous lan_scan hit doesn't erase one learned from SSH.
+func (db *DB) SaveDevice(mac, ip, name, source string) error {
+	mac = strings.ToLower(mac)
+	_, err := db.conn.Exec(`
+		INSERT INTO known_devices (mac, ip, name, source, last_seen)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(mac) DO UPDATE SET
+			ip = excluded.ip,
+			name = COALESCE(NULLIF(excluded.name, ''), known_devices.name),
+			source = excluded.source,
+			last_seen = excluded.last_seen
+	`, mac, ip, name, source, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	return nil
+}
+
+// FindDevice looks a device up by MAC, name or IP, most recently seen first.
+// Names also match without their domain, so "desktop" finds "desktop.lan".
+func (db *DB) FindDevice(query string) (*KnownDevice, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	row := db.conn.QueryRow(`
+		SELECT mac, ip, name, source, last_seen FROM known_devices
+		WHERE mac = ? OR ip = ? OR lower(name) = ? OR lower(name) LIKE ? || '.%'
+		ORDER BY (lower(name) = ? OR mac = ?) DESC, last_seen DESC
+		LIMIT 1
+	`, query, query, query, query, query, query)
+
+	var d KnownDevice
+	var ip, name, source sql.NullString
+	if err := row.Scan(&d.MAC, &ip, &name, &source, &d.LastSeen); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find device: %w", err)
+	}
+	d.IP = ip.String
+	d.Name = name.String
+	d.Source = source.String
+	return &d, nil
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Kinds of knowledge that are embedded.
+const (
+	EmbedEntity = "entity"
+	EmbedFact   = "fact"
+)
+
+// minSimilarity is the cosine similarity below which an embedded item is
+// not taken to be about the query at all.
+const minSimilarity = 0.45
+
+// EmbeddingItem is an entity or fact and the text its vector is made from.
+type EmbeddingItem struct {
+	Kind string
+	ID   int64
+	Text string
+}
+
+// EntityEmbeddingText is what an entity's vector is made from: its type,
+// name and value, e.g. "tool: kubernetes - cluster at k8s.internal".
+func EntityEmbeddingText(e KnowledgeEntity) string {
+	text := e.Type + ": " + e.Name
+	if value := e.Value; value != "" {
+		if len(value) > 500 {
+			value = strings.ToValidUTF8(value[:500], "")
+		}
+		text += " - " + value
+	}
+	return text
+}
+
+// FactEmbeddingText is what a fact's vector is made from: the triple.
+func FactEmbeddingText(f KnowledgeFact) string {
+	return f.Subject + " " + f.Predicate + " " + f.Object
+}
+
+// PendingEmbeddings returns up to limit entities and facts that have no
+// vector from model, or whose text changed since they were embedded, most
+// recently seen first.
+func (db *DB) PendingEmbeddings(model string, limit int) ([]EmbeddingItem, error) {
+	embedded := make(map[EmbeddingItem]bool)
+	rows, err := db.conn.Query("SELECT kind, item_id, text FROM knowledge_embeddings WHERE model = ?", model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embeddings: %w", err)
+	}
+	for rows.Next() {
+		var item EmbeddingItem
+		if rows.Scan(&item.Kind, &item.ID, &item.Text) == nil {
+			embedded[item] = true
+		}
+	}
+	rows.Close()
+
+	var pending []EmbeddingItem
+	add := func(item EmbeddingItem) bool {
+		if !embedded[item] {
+			pending = append(pending, item)
+		}
+		return len(pending) < limit
+	}
+
+	rows, err = db.conn.Query("SELECT " + entityColumns + " FROM knowledge_entities ORDER BY last_seen DESC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list entities: %w", err)
+	}
+	for rows.Next() && len(pending) < limit {
+		e, err := scanEntity(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		add(EmbeddingItem{EmbedEntity, e.ID, EntityEmbeddingText(e)})
+	}
+	rows.Close()
+	if len(pending) >= limit {
+		return pending, nil
+	}
+
+	facts, err := db.ListFacts("", nil, maxFactScan)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range facts {
+		if !add(EmbeddingItem{EmbedFact, f.ID, FactEmbeddingText(f)}) {
+			break
+		}
+	}
+	return pending, nil
+}
+
+// SaveEmbeddings stores the vectors model made for items, in order.
+func (db *DB) SaveEmbeddings(model string, items []EmbeddingItem, vectors [][]float32) error {
+	if len(items) != len(vectors) {
+		return fmt.Errorf("got %d embeddings for %d items", len(vectors), len(items))
+	}
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i, item := range items {
+		_, err := tx.Exec(`
+			INSERT OR REPLACE INTO knowledge_embeddings (kind, item_id, model, text, vector)
+			VALUES (?, ?, ?, ?, ?)
+		`, item.Kind, item.ID, model, item.Text, encodeVector(vectors[i]))
+		if err != nil {
+			return fmt.Errorf("failed to save embedding: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// SemanticMatch is an entity or fact found by meaning, with its cosine
+// similarity to the query.
+type SemanticMatch struct {
+	Entity     *KnowledgeEntity
+	Fact       *KnowledgeFact
+	Similarity float64
+}
+
+// SemanticSearch ranks embedded entities and facts by how close their
+// vectors from model are to query's, leaving out ones too far to be
+// related. entityType, when set, keeps only entities of that type, and
+// projectPath keeps global knowledge and knowledge about that project.
+func (db *DB) SemanticSearch(query []float32, model, entityType, projectPath string, limit int) ([]SemanticMatch, error) {
+	rows, err := db.conn.Query("SELECT kind, item_id, vector FROM knowledge_embeddings WHERE model = ?", model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search embeddings: %w", err)
+	}
+	type scored struct {
+		item       EmbeddingItem
+		similarity float64
+	}
+	var candidates []scored
+	for rows.Next() {
+		var item EmbeddingItem
+		var blob []byte
+		if rows.Scan(&item.Kind, &item.ID, &blob) != nil {
+			continue
+		}
+		if entityType != "" && item.Kind != EmbedEntity {
+			continue
+		}
+		if sim := cosineSimilarity(query, decodeVector(blob)); sim >= minSimilarity {
+			candidates = append(candidates, scored{item, sim})
+		}
+	}
+	rows.Close()
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].similarity > candidates[j].similarity })
+
+	inScope := func(p string) bool { return projectPath == "" || p == "" || p == projectPath }
+	var matches []SemanticMatch
+	for _, c := range candidates {
+		if len(matches) >= limit {
+			break
+		}
+		switch c.item.Kind {
+		case EmbedEntity:
+			e, err := db.GetEntityByID(c.item.ID)
+			if err != nil {
+				return nil, err
+			}
+			if e != nil && inScope(e.ProjectPath) && (entityType == "" || e.Type == entityType) {
+				matches = append(matches, SemanticMatch{Entity: e, Similarity: c.similarity})
+			}
+		case EmbedFact:
+			f, err := db.GetFactByID(c.item.ID)
+			if err != nil {
+				return nil, err
+			}
+			if f != nil && !f.Rejected && inScope(f.ProjectPath) {
+				matches = append(matches, SemanticMatch{Fact: f, Similarity: c.similarity})
+			}
+		}
+	}
+	return matches, nil
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+// cosineSimilarity is 0 for vectors of different lengths, which come from
+// different models.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
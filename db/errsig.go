@@ -0,0 +1,91 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error signatures are normalized when learned and when looked up, so the
+// same error matches whatever file, line, address or identifier it names.
+var signatureReplacements = []struct {
+	re   *regexp.Regexp
+	with string
+}{
+	// A quote opens only after a non-word character, so the apostrophe of
+	// don't is not taken for one.
+	{regexp.MustCompile("(^|\\W)(?:'[^'\\n]*'|\"[^\"\\n]*\"|`[^`\\n]*`|‘[^’\\n]*’)"), "${1}<q>"},
+	{regexp.MustCompile(`[a-z]+://\S+`), "<url>"},
+	{regexp.MustCompile(`(?:[a-z]:)?(?:[\w.~-]*[/\\])+[\w.-]+`), "<path>"},
+	{regexp.MustCompile(`\b[\w-]+\.(?:go|py|js|jsx|ts|tsx|rs|c|h|cc|cpp|hpp|java|kt|rb|php|sh|ya?ml|json|toml|lock)\b`), "<path>"},
+	{regexp.MustCompile(`0x[0-9a-f]+`), "<addr>"},
+	{regexp.MustCompile(`\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b|\b[0-9a-f]{8,}\b`), "<hex>"},
+	{regexp.MustCompile(`\b\d+(\.\d+)*\b`), "<n>"},
+}
+
+// identifierPattern matches camelCase and snake_case names, which are found
+// before lowercasing.
+var identifierPattern = regexp.MustCompile(`\b[a-z]+[A-Z]\w*\b|\b[a-zA-Z]+_\w+\b`)
+
+// maxSignatureLen caps stored signatures; the start of an error says the
+// most about it.
+const maxSignatureLen = 300
+
+// NormalizeErrorSignature reduces error text to its stable part: lowercase,
+// with quoted, camelCase and snake_case names, paths, URLs, addresses,
+// hashes and numbers replaced by placeholders and whitespace collapsed.
+func NormalizeErrorSignature(text string) string {
+	s := strings.ToLower(identifierPattern.ReplaceAllString(text, "<id>"))
+	for _, r := range signatureReplacements {
+		s = r.re.ReplaceAllString(s, r.with)
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxSignatureLen {
+		// Cut at the start of a rune, not in the middle of one.
+		n := maxSignatureLen
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
+	return s
+}
+
+// minErrorSimilarity is how alike an error and a learned signature must be
+// to count as a match.
+const minErrorSimilarity = 0.6
+
+// errorSimilarity scores how well normalized error text matches a
+// normalized signature, from 0 to 1. It weighs how much of the signature
+// the error contains, so a short signature matches a long error log, with
+// overall token overlap breaking ties.
+func errorSimilarity(signature, errorText string) float64 {
+	sig := signatureTokens(signature)
+	text := signatureTokens(errorText)
+	if len(sig) == 0 || len(text) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range sig {
+		if text[t] {
+			common++
+		}
+	}
+	coverage := float64(common) / float64(len(sig))
+	jaccard := float64(common) / float64(len(sig)+len(text)-common)
+	return 0.8*coverage + 0.2*jaccard
+}
+
+// signatureTokens is the set of words in a normalized signature, leaving out
+// placeholders, which match anything.
+func signatureTokens(s string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, t := range strings.FieldsFunc(s, notWordRune) {
+		switch t {
+		case "q", "id", "url", "path", "addr", "hex", "n":
+			continue
+		}
+		tokens[t] = true
+	}
+	return tokens
+}
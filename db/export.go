@@ -0,0 +1,251 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExportVersion is bumped when the export file layout changes.
+const ExportVersion = 1
+
+// SessionExport is the portable form of a session written by `q export` and
+// read by `q import`. Title and summary are plain strings so the JSON stays
+// readable.
+type SessionExport struct {
+	Version      int           `json:"version"`
+	ExportedAt   time.Time     `json:"exported_at"`
+	ID           string        `json:"id"`
+	ProjectPath  string        `json:"project_path"`
+	Title        string        `json:"title,omitempty"`
+	Summary      string        `json:"summary,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	Usage        *Usage        `json:"usage,omitempty"`
+	Tags         []string      `json:"tags,omitempty"`
+	ContextFiles []ContextFile `json:"context_files,omitempty"`
+	Messages     []Message     `json:"messages"`
+	ToolCalls    []ToolCall    `json:"tool_calls,omitempty"`
+}
+
+// GetSessionTags returns the tags applied to a session.
+func (db *DB) GetSessionTags(sessionID string) ([]Tag, error) {
+	rows, err := db.conn.Query(`
+		SELECT t.id, t.name FROM tags t
+		JOIN session_tags st ON st.tag_id = t.id
+		WHERE st.session_id = ?
+		ORDER BY t.name
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// FindSession resolves a full session ID or a unique prefix of one, as shown
+// in shortened form by the CLI.
+func (db *DB) FindSession(idOrPrefix string) (*Session, error) {
+	rows, err := db.conn.Query("SELECT id FROM sessions WHERE id LIKE ? || '%' LIMIT 2", idOrPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find session: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	switch len(ids) {
+	case 0:
+		return nil, fmt.Errorf("no session matching %q", idOrPrefix)
+	case 1:
+		return db.GetSession(ids[0])
+	default:
+		return nil, fmt.Errorf("%q matches more than one session; use more of the ID", idOrPrefix)
+	}
+}
+
+// LatestSession returns the most recently updated session for a project.
+func (db *DB) LatestSession(projectPath string) (*Session, error) {
+	recent, err := db.GetRecentSessions(projectPath, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(recent) == 0 {
+		return nil, fmt.Errorf("no sessions for %s", projectPath)
+	}
+	return db.GetSession(recent[0].ID)
+}
+
+// GetFullSession assembles a session with its messages, tags and context
+// files.
+func (db *DB) GetFullSession(id string) (*FullSession, error) {
+	session, err := db.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := db.GetMessages(id)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := db.GetSessionTags(id)
+	if err != nil {
+		return nil, err
+	}
+	files, err := db.GetContextFiles(id)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := db.GetToolCalls(id)
+	if err != nil {
+		return nil, err
+	}
+	return &FullSession{
+		Session:      *session,
+		Messages:     messages,
+		Tags:         tags,
+		ContextFiles: files,
+		ToolCalls:    calls,
+	}, nil
+}
+
+// ExportSession returns the portable form of a session.
+func (db *DB) ExportSession(id string) (*SessionExport, error) {
+	full, err := db.GetFullSession(id)
+	if err != nil {
+		return nil, err
+	}
+	export := &SessionExport{
+		Version:      ExportVersion,
+		ExportedAt:   time.Now(),
+		ID:           full.ID,
+		ProjectPath:  full.ProjectPath,
+		Title:        full.Title.String,
+		Summary:      full.Summary.String,
+		CreatedAt:    full.CreatedAt,
+		UpdatedAt:    full.UpdatedAt,
+		ContextFiles: full.ContextFiles,
+		Messages:     full.Messages,
+		ToolCalls:    full.ToolCalls,
+	}
+	if full.Usage.Tokens() > 0 {
+		export.Usage = &full.Usage
+	}
+	for _, t := range full.Tags {
+		export.Tags = append(export.Tags, t.Name)
+	}
+	return export, nil
+}
+
+// ImportSession stores an exported session, keeping its IDs and timestamps so
+// importing the same file twice is detected. An existing session with the
+// same ID is an error unless replace is set. projectPath, when not empty,
+// overrides the exported project directory.
+func (db *DB) ImportSession(export *SessionExport, projectPath string, replace bool) error {
+	if export.Version > ExportVersion {
+		return fmt.Errorf("export version %d is newer than this q supports (%d)", export.Version, ExportVersion)
+	}
+	if export.ID == "" {
+		return fmt.Errorf("export has no session id")
+	}
+	if projectPath == "" {
+		projectPath = export.ProjectPath
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	tx.QueryRow("SELECT COUNT(*) FROM sessions WHERE id = ?", export.ID).Scan(&exists)
+	if exists > 0 {
+		if !replace {
+			return fmt.Errorf("session %s already exists; use --replace to overwrite it", export.ID)
+		}
+		if _, err := tx.Exec("DELETE FROM sessions WHERE id = ?", export.ID); err != nil {
+			return fmt.Errorf("failed to replace session: %w", err)
+		}
+	}
+
+	nullable := func(s string) sql.NullString {
+		return db.sealNull(sql.NullString{String: s, Valid: s != ""})
+	}
+	var usage Usage
+	if export.Usage != nil {
+		usage = *export.Usage
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO sessions (id, created_at, updated_at, project_path, title, summary, prompt_tokens, completion_tokens, cost) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		export.ID, export.CreatedAt, export.UpdatedAt, projectPath, nullable(export.Title), nullable(export.Summary),
+		usage.PromptTokens, usage.CompletionTokens, usage.Cost,
+	); err != nil {
+		return fmt.Errorf("failed to import session: %w", err)
+	}
+
+	for _, m := range export.Messages {
+		switch m.Role {
+		case RoleUser, RoleAssistant, RoleSystem:
+		default:
+			return fmt.Errorf("message %s has unknown role %q", m.ID, m.Role)
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO messages (id, session_id, role, content, created_at, token_count, model, latency_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			m.ID, export.ID, m.Role, db.seal(m.Content), m.CreatedAt, m.TokenCount,
+			nullIfEmpty(m.Model), sql.NullInt64{Int64: m.LatencyMS, Valid: m.LatencyMS > 0},
+		); err != nil {
+			return fmt.Errorf("failed to import message: %w", err)
+		}
+	}
+
+	for _, tc := range export.ToolCalls {
+		tc.SessionID = export.ID
+		if _, err := tx.Exec(insertToolCall, db.toolCallArgs(tc)...); err != nil {
+			return fmt.Errorf("failed to import tool call: %w", err)
+		}
+	}
+
+	for _, f := range export.ContextFiles {
+		if _, err := tx.Exec(
+			"INSERT OR REPLACE INTO context_files (id, session_id, file_path, content_hash, added_at) VALUES (?, ?, ?, ?, ?)",
+			f.ID, export.ID, f.FilePath, f.ContentHash, f.AddedAt,
+		); err != nil {
+			return fmt.Errorf("failed to import context file: %w", err)
+		}
+	}
+
+	for _, name := range export.Tags {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", name); err != nil {
+			return fmt.Errorf("failed to import tag: %w", err)
+		}
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO session_tags (session_id, tag_id) SELECT ?, id FROM tags WHERE name = ?",
+			export.ID, name,
+		); err != nil {
+			return fmt.Errorf("failed to import tag: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
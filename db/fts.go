@@ -0,0 +1,166 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Search input is never passed to MATCH as is: FTS5 treats quotes, hyphens,
+// colons and words like NOT as syntax. Each word is quoted instead, and the
+// search widens step by step until something matches.
+
+// stopWords are dropped from searches that have other words, so natural
+// questions match on their content words.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "be": true, "did": true, "do": true,
+	"does": true, "for": true, "how": true, "i": true, "in": true, "is": true, "it": true,
+	"me": true, "my": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "we": true, "what": true, "when": true,
+	"where": true, "why": true, "with": true, "you": true,
+}
+
+// searchTerms splits input the way the FTS tokenizer does. Each term is one
+// word of the input; a word like docker-compose becomes the phrase
+// "docker compose".
+func searchTerms(input string) [][]string {
+	var terms [][]string
+	for _, word := range strings.Fields(strings.ToLower(input)) {
+		parts := strings.FieldsFunc(word, notWordRune)
+		if len(parts) > 0 {
+			terms = append(terms, parts)
+		}
+	}
+	var content [][]string
+	for _, t := range terms {
+		if len(t) > 1 || !stopWords[t[0]] {
+			content = append(content, t)
+		}
+	}
+	if len(content) > 0 {
+		return content
+	}
+	return terms
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+// searchText lowercases s and separates its words with single spaces, so
+// terms from searchTerms can be found in it with strings.Contains.
+func searchText(s string) string {
+	return " " + strings.Join(strings.FieldsFunc(strings.ToLower(s), notWordRune), " ")
+}
+
+// matchExpr builds a MATCH expression from terms, each a quoted prefix
+// phrase, joined with op ("AND" or "OR").
+func matchExpr(terms [][]string, op string) string {
+	phrases := make([]string, len(terms))
+	for i, t := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(strings.Join(t, " "), `"`, `""`) + `"*`
+	}
+	return strings.Join(phrases, " "+op+" ")
+}
+
+// searchFTS runs search with MATCH expressions for input until one finds
+// something: every term, then any term, then any term with misspelled words
+// replaced by the closest words in the index. search returns how many rows
+// it found.
+func (db *DB) searchFTS(ftsTable, input string, search func(match string) (int, error)) error {
+	terms := searchTerms(input)
+	if len(terms) == 0 {
+		return nil
+	}
+	n, err := search(matchExpr(terms, "AND"))
+	if err != nil || n > 0 {
+		return err
+	}
+	if len(terms) > 1 {
+		if n, err = search(matchExpr(terms, "OR")); err != nil || n > 0 {
+			return err
+		}
+	}
+	corrected, changed := db.correctTerms(ftsTable, terms)
+	if !changed {
+		return nil
+	}
+	_, err = search(matchExpr(corrected, "OR"))
+	return err
+}
+
+// correctTerms replaces words missing from the index with the closest
+// indexed word that starts with the same letter, within an edit distance of
+// one for short words and two for longer ones.
+func (db *DB) correctTerms(ftsTable string, terms [][]string) ([][]string, bool) {
+	vocab := ftsTable + "_vocab"
+	changed := false
+	corrected := make([][]string, len(terms))
+	for i, t := range terms {
+		corrected[i] = append([]string(nil), t...)
+		for j, word := range t {
+			var exists int
+			db.conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE term = ?", vocab), word).Scan(&exists)
+			if exists > 0 || len([]rune(word)) < 3 {
+				continue
+			}
+			if best := db.closestTerm(vocab, word); best != "" {
+				corrected[i][j] = best
+				changed = true
+			}
+		}
+	}
+	return corrected, changed
+}
+
+func (db *DB) closestTerm(vocab, word string) string {
+	first := []rune(word)[0]
+	rows, err := db.conn.Query(
+		fmt.Sprintf("SELECT term, doc FROM %s WHERE term >= ? AND term < ? AND length(term) BETWEEN ? AND ?", vocab),
+		string(first), string(first+1), len(word)-2, len(word)+2,
+	)
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+
+	maxDistance := 1
+	if len([]rune(word)) > 5 {
+		maxDistance = 2
+	}
+	best, bestDistance, bestDocs := "", maxDistance+1, 0
+	for rows.Next() {
+		var term string
+		var docs int
+		if rows.Scan(&term, &docs) != nil {
+			continue
+		}
+		d := editDistance(word, term)
+		if d < bestDistance || d == bestDistance && docs > bestDocs {
+			best, bestDistance, bestDocs = term, d, docs
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
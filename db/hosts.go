@@ -0,0 +1,162 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Host struct {
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	User        string    `json:"user,omitempty"`
+	Port        int       `json:"port,omitempty"`
+	KeyPath     string    `json:"key_path,omitempty"`
+	Groups      []string  `json:"groups,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// InGroup reports whether the host belongs to the group or carries it as a tag.
+func (h *Host) InGroup(group string) bool {
+	for _, g := range append(h.Groups, h.Tags...) {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinList(items []string) string {
+	var clean []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		clean = append(clean, item)
+	}
+	sort.Strings(clean)
+	return strings.Join(clean, ",")
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// SaveHost adds a host to the inventory or replaces the entry with the same name.
+func (db *DB) SaveHost(h *Host) error {
+	if h.Name == "" || h.Address == "" {
+		return fmt.Errorf("host name and address are required")
+	}
+	now := time.Now()
+
+	var user, keyPath, description interface{}
+	if h.User != "" {
+		user = h.User
+	}
+	if h.KeyPath != "" {
+		keyPath = h.KeyPath
+	}
+	if h.Description != "" {
+		description = h.Description
+	}
+	var port interface{}
+	if h.Port > 0 {
+		port = h.Port
+	}
+
+	_, err := db.conn.Exec(`
+		INSERT INTO hosts (name, address, user, port, key_path, host_groups, tags, description, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			address = excluded.address,
+			user = excluded.user,
+			port = excluded.port,
+			key_path = excluded.key_path,
+			host_groups = excluded.host_groups,
+			tags = excluded.tags,
+			description = excluded.description,
+			updated_at = excluded.updated_at
+	`, h.Name, h.Address, user, port, keyPath, joinList(h.Groups), joinList(h.Tags), description, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save host: %w", err)
+	}
+	return nil
+}
+
+const hostColumns = "name, address, user, port, key_path, host_groups, tags, description, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanHost(row rowScanner) (*Host, error) {
+	var h Host
+	var user, keyPath, description sql.NullString
+	var port sql.NullInt64
+	var groups, tags string
+	if err := row.Scan(&h.Name, &h.Address, &user, &port, &keyPath, &groups, &tags, &description, &h.CreatedAt, &h.UpdatedAt); err != nil {
+		return nil, err
+	}
+	h.User = user.String
+	h.Port = int(port.Int64)
+	h.KeyPath = keyPath.String
+	h.Description = description.String
+	h.Groups = splitList(groups)
+	h.Tags = splitList(tags)
+	return &h, nil
+}
+
+// GetHost returns the named host, or nil if it isn't in the inventory.
+func (db *DB) GetHost(name string) (*Host, error) {
+	row := db.conn.QueryRow("SELECT "+hostColumns+" FROM hosts WHERE name = ? COLLATE NOCASE", name)
+	h, err := scanHost(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get host: %w", err)
+	}
+	return h, nil
+}
+
+// ListHosts returns inventory hosts sorted by name. A non-empty group limits
+// the result to hosts in that group or with that tag.
+func (db *DB) ListHosts(group string) ([]Host, error) {
+	rows, err := db.conn.Query("SELECT " + hostColumns + " FROM hosts ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hosts: %w", err)
+	}
+	defer rows.Close()
+
+	var hosts []Host
+	for rows.Next() {
+		h, err := scanHost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan host: %w", err)
+		}
+		if group == "" || h.InGroup(group) {
+			hosts = append(hosts, *h)
+		}
+	}
+	return hosts, rows.Err()
+}
+
+func (db *DB) DeleteHost(name string) (bool, error) {
+	result, err := db.conn.Exec("DELETE FROM hosts WHERE name = ? COLLATE NOCASE", name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete host: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
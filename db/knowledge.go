@@ -3,6 +3,8 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -15,6 +17,10 @@ type KnowledgeEntity struct {
 	FirstSeen       time.Time `json:"first_seen"`
 	LastSeen        time.Time `json:"last_seen"`
 	OccurrenceCount int       `json:"occurrence_count"`
+	Source          string    `json:"source,omitempty"`
+	SessionID       string    `json:"session_id,omitempty"`
+	Model           string    `json:"model,omitempty"`
+	Trust           Trust     `json:"trust,omitempty"`
 }
 
 type KnowledgeRelation struct {
@@ -41,6 +47,11 @@ type KnowledgeFact struct {
 	CreatedAt         time.Time `json:"created_at"`
 	LastVerified      time.Time `json:"last_verified"`
 	VerificationCount int       `json:"verification_count"`
+	SessionID         string    `json:"session_id,omitempty"`
+	Model             string    `json:"model,omitempty"`
+	Trust             Trust     `json:"trust,omitempty"`
+	// Rejected facts are kept only so they are not learned again.
+	Rejected bool `json:"rejected,omitempty"`
 }
 
 type ErrorPattern struct {
@@ -56,6 +67,9 @@ type ErrorPattern struct {
 	ProjectPath     string    `json:"project_path,omitempty"`
 	CreatedAt       time.Time `json:"created_at"`
 	LastUsed        time.Time `json:"last_used"`
+	// Similarity is how closely the error looked up matched, from 0 to 1;
+	// set by FindMatchingErrorPatterns.
+	Similarity float64 `json:"similarity,omitempty"`
 }
 
 type RelatedKnowledge struct {
@@ -63,27 +77,62 @@ type RelatedKnowledge struct {
 	Relation KnowledgeRelation `json:"relation"`
 }
 
-func (db *DB) UpsertEntity(entityType, name, value, projectPath string) (*KnowledgeEntity, error) {
+const entityColumns = "id, type, name, value, project_path, first_seen, last_seen, occurrence_count, source, session_id, model, trust"
+
+func scanEntity(row interface{ Scan(...interface{}) error }) (KnowledgeEntity, error) {
+	var e KnowledgeEntity
+	var value, pp, source, session, model sql.NullString
+	err := row.Scan(&e.ID, &e.Type, &e.Name, &value, &pp, &e.FirstSeen, &e.LastSeen, &e.OccurrenceCount, &source, &session, &model, &e.Trust)
+	e.Value, e.ProjectPath = value.String, pp.String
+	e.Source, e.SessionID, e.Model = source.String, session.String, model.String
+	return e, err
+}
+
+// UpsertEntity records seeing an entity, attributed to attr. A name that
+// differs only in case from a known entity's, or is one of its aliases,
+// counts as that entity. The attribution is kept from whichever sighting
+// was the most trusted.
+func (db *DB) UpsertEntity(entityType, name, value, projectPath string, attr Attribution) (*KnowledgeEntity, error) {
 	now := time.Now()
+	trust := attr.trust()
+
+	// Looked up first rather than left to ON CONFLICT, which never fires
+	// for global entities: their NULL project paths all differ.
+	e, err := db.GetEntity(entityType, name, projectPath)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil {
+		attr = attr.over(Attribution{e.Source, e.SessionID, e.Model, e.Trust})
+		_, err = db.conn.Exec(`
+			UPDATE knowledge_entities SET value = COALESCE(?, value), last_seen = ?, occurrence_count = occurrence_count + 1,
+				source = ?, session_id = ?, model = ?, trust = ?
+			WHERE id = ?
+		`, nullIfEmpty(value), now, nullIfEmpty(attr.Source), nullIfEmpty(attr.SessionID), nullIfEmpty(attr.Model), attr.Trust, e.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upsert entity: %w", err)
+		}
+		return db.GetEntityByID(e.ID)
+	}
 
 	var projectPathVal interface{}
 	if projectPath != "" {
 		projectPathVal = projectPath
 	}
 
-	_, err := db.conn.Exec(`
-		INSERT INTO knowledge_entities (type, name, value, project_path, first_seen, last_seen, occurrence_count)
-		VALUES (?, ?, ?, ?, ?, ?, 1)
-		ON CONFLICT(type, name, project_path) DO UPDATE SET
-			value = COALESCE(excluded.value, knowledge_entities.value),
-			last_seen = excluded.last_seen,
-			occurrence_count = knowledge_entities.occurrence_count + 1
-	`, entityType, name, value, projectPathVal, now, now)
+	res, err := db.conn.Exec(`
+		INSERT INTO knowledge_entities (type, name, value, project_path, first_seen, last_seen, occurrence_count, source, session_id, model, trust)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?)
+	`, entityType, name, nullIfEmpty(value), projectPathVal, now, now,
+		nullIfEmpty(attr.Source), nullIfEmpty(attr.SessionID), nullIfEmpty(attr.Model), trust)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upsert entity: %w", err)
 	}
-
-	return db.GetEntity(entityType, name, projectPath)
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return db.GetEntityByID(id)
 }
 
 func (db *DB) GetEntity(entityType, name, projectPath string) (*KnowledgeEntity, error) {
@@ -93,40 +142,33 @@ func (db *DB) GetEntity(entityType, name, projectPath string) (*KnowledgeEntity,
 	}
 
 	row := db.conn.QueryRow(`
-		SELECT id, type, name, value, project_path, first_seen, last_seen, occurrence_count
+		SELECT `+entityColumns+`
 		FROM knowledge_entities
 		WHERE type = ? AND name = ? AND (project_path = ? OR (project_path IS NULL AND ? IS NULL))
 	`, entityType, name, projectPathVal, projectPathVal)
 
-	var e KnowledgeEntity
-	var value, pp sql.NullString
-	err := row.Scan(&e.ID, &e.Type, &e.Name, &value, &pp, &e.FirstSeen, &e.LastSeen, &e.OccurrenceCount)
+	e, err := scanEntity(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, nil
+			id, err := db.resolveAlias(entityType, name, projectPath)
+			if err != nil || id == 0 {
+				return nil, err
+			}
+			return db.GetEntityByID(id)
 		}
 		return nil, fmt.Errorf("failed to get entity: %w", err)
 	}
 
-	if value.Valid {
-		e.Value = value.String
-	}
-	if pp.Valid {
-		e.ProjectPath = pp.String
-	}
-
 	return &e, nil
 }
 
 func (db *DB) GetEntityByID(id int64) (*KnowledgeEntity, error) {
 	row := db.conn.QueryRow(`
-		SELECT id, type, name, value, project_path, first_seen, last_seen, occurrence_count
+		SELECT `+entityColumns+`
 		FROM knowledge_entities WHERE id = ?
 	`, id)
 
-	var e KnowledgeEntity
-	var value, pp sql.NullString
-	err := row.Scan(&e.ID, &e.Type, &e.Name, &value, &pp, &e.FirstSeen, &e.LastSeen, &e.OccurrenceCount)
+	e, err := scanEntity(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -134,75 +176,93 @@ func (db *DB) GetEntityByID(id int64) (*KnowledgeEntity, error) {
 		return nil, fmt.Errorf("failed to get entity: %w", err)
 	}
 
-	if value.Valid {
-		e.Value = value.String
-	}
-	if pp.Valid {
-		e.ProjectPath = pp.String
-	}
-
 	return &e, nil
 }
 
 func (db *DB) SearchEntities(query string, entityType string, projectPath string, limit int) ([]KnowledgeEntity, error) {
 	baseQuery := `
-		SELECT e.id, e.type, e.name, e.value, e.project_path, e.first_seen, e.last_seen, e.occurrence_count
+		SELECT ` + strings.ReplaceAll("e."+entityColumns, ", ", ", e.") + `
 		FROM knowledge_fts f
 		JOIN knowledge_entities e ON f.rowid = e.id
 		WHERE knowledge_fts MATCH ?
 	`
-	args := []interface{}{query}
+	var filters []interface{}
 
 	if entityType != "" {
 		baseQuery += " AND e.type = ?"
-		args = append(args, entityType)
+		filters = append(filters, entityType)
 	}
 
 	if projectPath != "" {
 		baseQuery += " AND (e.project_path = ? OR e.project_path IS NULL)"
-		args = append(args, projectPath)
+		filters = append(filters, projectPath)
 	}
 
 	baseQuery += " ORDER BY e.occurrence_count DESC, e.last_seen DESC LIMIT ?"
-	args = append(args, limit)
-
-	rows, err := db.conn.Query(baseQuery, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search entities: %w", err)
-	}
-	defer rows.Close()
+	filters = append(filters, limit)
 
 	var entities []KnowledgeEntity
-	for rows.Next() {
-		var e KnowledgeEntity
-		var value, pp sql.NullString
-		if err := rows.Scan(&e.ID, &e.Type, &e.Name, &value, &pp, &e.FirstSeen, &e.LastSeen, &e.OccurrenceCount); err != nil {
-			return nil, err
-		}
-		if value.Valid {
-			e.Value = value.String
+	err := db.searchFTS("knowledge_fts", query, func(match string) (int, error) {
+		rows, err := db.conn.Query(baseQuery, append([]interface{}{match}, filters...)...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to search entities: %w", err)
 		}
-		if pp.Valid {
-			e.ProjectPath = pp.String
+		defer rows.Close()
+
+		entities = nil
+		for rows.Next() {
+			e, err := scanEntity(rows)
+			if err != nil {
+				return 0, err
+			}
+			entities = append(entities, e)
 		}
-		entities = append(entities, e)
+		return len(entities), rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return entities, nil
+	// An alias named in the query is as good as a match on the name.
+	byAlias, err := db.aliasMatches(query, entityType, projectPath)
+	if err != nil || len(byAlias) == 0 {
+		return entities, err
+	}
+	seen := make(map[int64]bool)
+	for _, e := range byAlias {
+		seen[e.ID] = true
+	}
+	for _, e := range entities {
+		if !seen[e.ID] {
+			byAlias = append(byAlias, e)
+		}
+	}
+	if limit > 0 && len(byAlias) > limit {
+		byAlias = byAlias[:limit]
+	}
+	return byAlias, nil
 }
 
 func (db *DB) UpsertRelation(sourceID int64, relation string, targetID int64, confidence float64, context string) (*KnowledgeRelation, error) {
 	now := time.Now()
 
-	_, err := db.conn.Exec(`
-		INSERT INTO knowledge_relations (source_id, relation, target_id, confidence, context, created_at, last_used, use_count)
-		VALUES (?, ?, ?, ?, ?, ?, ?, 1)
-		ON CONFLICT(source_id, relation, target_id) DO UPDATE SET
-			confidence = (knowledge_relations.confidence * knowledge_relations.use_count + excluded.confidence) / (knowledge_relations.use_count + 1),
-			context = COALESCE(excluded.context, knowledge_relations.context),
-			last_used = excluded.last_used,
-			use_count = knowledge_relations.use_count + 1
-	`, sourceID, relation, targetID, confidence, context, now, now)
+	existing, err := db.GetRelation(sourceID, relation, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		// Average with the decayed confidence; storing it with last_used
+		// set to now restarts the decay.
+		_, err = db.conn.Exec(`
+			UPDATE knowledge_relations SET confidence = ?, context = COALESCE(?, context), last_used = ?, use_count = use_count + 1
+			WHERE id = ?
+		`, (existing.Confidence*float64(existing.UseCount)+confidence)/float64(existing.UseCount+1), nullIfEmpty(context), now, existing.ID)
+	} else {
+		_, err = db.conn.Exec(`
+			INSERT INTO knowledge_relations (source_id, relation, target_id, confidence, context, created_at, last_used, use_count)
+			VALUES (?, ?, ?, ?, ?, ?, ?, 1)
+		`, sourceID, relation, targetID, confidence, context, now, now)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to upsert relation: %w", err)
 	}
@@ -230,6 +290,7 @@ func (db *DB) GetRelation(sourceID int64, relation string, targetID int64) (*Kno
 	if ctx.Valid {
 		r.Context = ctx.String
 	}
+	r.Confidence = decay(r.Confidence, r.LastUsed)
 
 	return &r, nil
 }
@@ -279,30 +340,80 @@ func (db *DB) GetRelatedEntities(entityID int64, relation string, limit int) ([]
 		if pp.Valid {
 			rk.Entity.ProjectPath = pp.String
 		}
+		rk.Relation.Confidence = decay(rk.Relation.Confidence, rk.Relation.LastUsed)
 		results = append(results, rk)
 	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Relation.Confidence > results[j].Relation.Confidence })
 
 	return results, nil
 }
 
-func (db *DB) UpsertFact(category, subject, predicate, object, projectPath, source string, confidence float64) (*KnowledgeFact, error) {
+// UpsertFact records a fact, attributed to attr. Confirming one averages its
+// confidence with the new one. A different object for the same subject and
+// predicate is a contradiction: a more trusted object replaces the old fact
+// and a less trusted one is ignored; at equal trust the old fact's
+// confidence drops, and the new object replaces it unless the old fact is
+// still the more confident. A fact the user rejected is only learned again
+// if the user adds it; any other object replaces it.
+func (db *DB) UpsertFact(category, subject, predicate, object, projectPath string, attr Attribution, confidence float64) (*KnowledgeFact, error) {
 	now := time.Now()
+	trust := attr.trust()
 
 	var projectPathVal interface{}
 	if projectPath != "" {
 		projectPathVal = projectPath
 	}
 
-	_, err := db.conn.Exec(`
-		INSERT INTO knowledge_facts (category, subject, predicate, object, project_path, confidence, source, created_at, last_verified, verification_count)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
-		ON CONFLICT(category, subject, predicate, project_path) DO UPDATE SET
-			object = excluded.object,
-			confidence = (knowledge_facts.confidence * knowledge_facts.verification_count + excluded.confidence) / (knowledge_facts.verification_count + 1),
-			source = COALESCE(excluded.source, knowledge_facts.source),
-			last_verified = excluded.last_verified,
-			verification_count = knowledge_facts.verification_count + 1
-	`, category, subject, predicate, object, projectPathVal, confidence, source, now, now)
+	subject = db.canonicalSubject(subject)
+	existing, err := db.GetFact(category, subject, predicate, projectPath)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case existing != nil && existing.Rejected && existing.Object == object && trust < TrustUser:
+		// The user said no to this one already.
+		return existing, nil
+	case existing == nil:
+		_, err = db.conn.Exec(`
+			INSERT INTO knowledge_facts (category, subject, predicate, object, project_path, confidence, source, session_id, model, trust, created_at, last_verified, verification_count)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+		`, category, subject, predicate, object, projectPathVal, confidence,
+			nullIfEmpty(attr.Source), nullIfEmpty(attr.SessionID), nullIfEmpty(attr.Model), trust, now, now)
+	case existing.Object == object:
+		// existing.Confidence is decayed; storing the average with
+		// last_verified set to now restarts the decay. A more trusted
+		// confirmation takes over the attribution.
+		n := float64(existing.VerificationCount)
+		attr = attr.over(Attribution{existing.Source, existing.SessionID, existing.Model, existing.Trust})
+		_, err = db.conn.Exec(`
+			UPDATE knowledge_facts SET confidence = ?, source = ?, session_id = ?, model = ?, trust = ?,
+				last_verified = ?, verification_count = verification_count + 1, rejected = 0
+			WHERE id = ?
+		`, (existing.Confidence*n+confidence)/(n+1), nullIfEmpty(attr.Source), nullIfEmpty(attr.SessionID), nullIfEmpty(attr.Model),
+			attr.Trust, now, existing.ID)
+	case trust < existing.Trust && !existing.Rejected:
+		return existing, nil
+	case trust > existing.Trust || existing.Rejected || confidence >= existing.Confidence*contradictionPenalty:
+		_, err = db.conn.Exec(`
+			UPDATE knowledge_facts SET object = ?, confidence = ?, source = ?, session_id = ?, model = ?, trust = ?, last_verified = ?, verification_count = 1, rejected = 0
+			WHERE id = ?
+		`, object, confidence, nullIfEmpty(attr.Source), nullIfEmpty(attr.SessionID), nullIfEmpty(attr.Model), trust, now, existing.ID)
+	default:
+		// Scaling the stored value scales the decayed one alike, so
+		// last_verified is left alone.
+		_, err = db.conn.Exec("UPDATE knowledge_facts SET confidence = confidence * ? WHERE id = ?", contradictionPenalty, existing.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert fact: %w", err)
+	}
+
+	// The same subject and predicate filed under another category
+	// contradicts this fact too, unless it is the more trusted.
+	_, err = db.conn.Exec(`
+		UPDATE knowledge_facts SET confidence = confidence * ?
+		WHERE subject = ? AND predicate = ? AND category != ? AND object != ? AND trust <= ?
+		AND (project_path = ? OR (project_path IS NULL AND ? IS NULL))
+	`, contradictionPenalty, subject, predicate, category, object, trust, projectPathVal, projectPathVal)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upsert fact: %w", err)
 	}
@@ -316,46 +427,44 @@ func (db *DB) GetFact(category, subject, predicate, projectPath string) (*Knowle
 		projectPathVal = projectPath
 	}
 
-	row := db.conn.QueryRow(`
-		SELECT id, category, subject, predicate, object, project_path, confidence, source, created_at, last_verified, verification_count
+	rows, err := db.conn.Query("SELECT "+factColumns+`
 		FROM knowledge_facts
 		WHERE category = ? AND subject = ? AND predicate = ? AND (project_path = ? OR (project_path IS NULL AND ? IS NULL))
 	`, category, subject, predicate, projectPathVal, projectPathVal)
-
-	var f KnowledgeFact
-	var pp, src sql.NullString
-	err := row.Scan(&f.ID, &f.Category, &f.Subject, &f.Predicate, &f.Object, &pp, &f.Confidence, &src, &f.CreatedAt, &f.LastVerified, &f.VerificationCount)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, fmt.Errorf("failed to get fact: %w", err)
 	}
-
-	if pp.Valid {
-		f.ProjectPath = pp.String
-	}
-	if src.Valid {
-		f.Source = src.String
+	defer rows.Close()
+	facts, err := scanFacts(rows)
+	if err != nil || len(facts) == 0 {
+		return nil, err
 	}
-
-	return &f, nil
+	return &facts[0], nil
 }
 
 func (db *DB) GetFactsAbout(subject string, projectPath string, limit int) ([]KnowledgeFact, error) {
-	query := `
-		SELECT id, category, subject, predicate, object, project_path, confidence, source, created_at, last_verified, verification_count
-		FROM knowledge_facts
-		WHERE subject = ?
-	`
-	args := []interface{}{subject}
-
+	var paths []string
 	if projectPath != "" {
-		query += " AND (project_path = ? OR project_path IS NULL)"
-		args = append(args, projectPath)
+		paths = []string{projectPath}
+	}
+	return db.GetFactsAboutIn(subject, paths, limit)
+}
+
+// GetFactsAboutIn is GetFactsAbout for several projects; nil paths means
+// every project. The most trusted facts come first.
+func (db *DB) GetFactsAboutIn(subject string, paths []string, limit int) ([]KnowledgeFact, error) {
+	// Facts about an entity one of whose aliases is subject count too.
+	query := "SELECT " + factColumns + ` FROM knowledge_facts WHERE (subject = ? OR subject IN (
+		SELECT e.name FROM knowledge_aliases a JOIN knowledge_entities e ON e.id = a.entity_id WHERE a.alias = ?)) AND rejected = 0`
+	args := []interface{}{subject, normalizeAlias(subject)}
+
+	if paths != nil {
+		clause, pathArgs := projectClause(paths)
+		query += " AND " + clause
+		args = append(args, pathArgs...)
 	}
 
-	query += " ORDER BY confidence DESC, verification_count DESC LIMIT ?"
+	query += " ORDER BY trust DESC, confidence DESC, verification_count DESC LIMIT ?"
 	args = append(args, limit)
 
 	rows, err := db.conn.Query(query, args...)
@@ -363,28 +472,23 @@ func (db *DB) GetFactsAbout(subject string, projectPath string, limit int) ([]Kn
 		return nil, fmt.Errorf("failed to get facts: %w", err)
 	}
 	defer rows.Close()
-
-	var facts []KnowledgeFact
-	for rows.Next() {
-		var f KnowledgeFact
-		var pp, src sql.NullString
-		if err := rows.Scan(&f.ID, &f.Category, &f.Subject, &f.Predicate, &f.Object, &pp, &f.Confidence, &src, &f.CreatedAt, &f.LastVerified, &f.VerificationCount); err != nil {
-			return nil, err
+	facts, err := scanFacts(rows)
+	// More trusted facts come first, then the most confident once decayed.
+	sort.SliceStable(facts, func(i, j int) bool {
+		if facts[i].Trust != facts[j].Trust {
+			return facts[i].Trust > facts[j].Trust
 		}
-		if pp.Valid {
-			f.ProjectPath = pp.String
-		}
-		if src.Valid {
-			f.Source = src.String
-		}
-		facts = append(facts, f)
-	}
-
-	return facts, nil
+		return facts[i].Confidence > facts[j].Confidence
+	})
+	return facts, err
 }
 
+// UpsertErrorPattern learns how an error was fixed. The signature is
+// normalized first, so later occurrences naming other files or values
+// update the same pattern.
 func (db *DB) UpsertErrorPattern(signature, errorType, language, rootCause, solution, solutionCmd, projectPath string) (*ErrorPattern, error) {
 	now := time.Now()
+	signature = NormalizeErrorSignature(signature)
 
 	var projectPathVal interface{}
 	if projectPath != "" {
@@ -407,6 +511,19 @@ func (db *DB) UpsertErrorPattern(signature, errorType, language, rootCause, solu
 	return db.GetErrorPattern(signature, projectPath)
 }
 
+const errorPatternColumns = "id, error_signature, error_type, language, root_cause, solution, solution_command, success_count, failure_count, project_path, created_at, last_used"
+
+func scanErrorPattern(row interface{ Scan(...interface{}) error }) (ErrorPattern, error) {
+	var ep ErrorPattern
+	var lang, rootCause, solution, solutionCmd, pp sql.NullString
+	err := row.Scan(&ep.ID, &ep.ErrorSignature, &ep.ErrorType, &lang, &rootCause, &solution, &solutionCmd, &ep.SuccessCount, &ep.FailureCount, &pp, &ep.CreatedAt, &ep.LastUsed)
+	ep.Language, ep.RootCause, ep.Solution = lang.String, rootCause.String, solution.String
+	ep.SolutionCommand, ep.ProjectPath = solutionCmd.String, pp.String
+	return ep, err
+}
+
+// GetErrorPattern returns the pattern learned for an error signature, which
+// is normalized first, or nil if there is none.
 func (db *DB) GetErrorPattern(signature, projectPath string) (*ErrorPattern, error) {
 	var projectPathVal interface{}
 	if projectPath != "" {
@@ -414,55 +531,37 @@ func (db *DB) GetErrorPattern(signature, projectPath string) (*ErrorPattern, err
 	}
 
 	row := db.conn.QueryRow(`
-		SELECT id, error_signature, error_type, language, root_cause, solution, solution_command, success_count, failure_count, project_path, created_at, last_used
+		SELECT `+errorPatternColumns+`
 		FROM error_patterns
 		WHERE error_signature = ? AND (project_path = ? OR (project_path IS NULL AND ? IS NULL))
-	`, signature, projectPathVal, projectPathVal)
+	`, NormalizeErrorSignature(signature), projectPathVal, projectPathVal)
 
-	var ep ErrorPattern
-	var lang, rootCause, solution, solutionCmd, pp sql.NullString
-	err := row.Scan(&ep.ID, &ep.ErrorSignature, &ep.ErrorType, &lang, &rootCause, &solution, &solutionCmd, &ep.SuccessCount, &ep.FailureCount, &pp, &ep.CreatedAt, &ep.LastUsed)
+	ep, err := scanErrorPattern(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get error pattern: %w", err)
 	}
-
-	if lang.Valid {
-		ep.Language = lang.String
-	}
-	if rootCause.Valid {
-		ep.RootCause = rootCause.String
-	}
-	if solution.Valid {
-		ep.Solution = solution.String
-	}
-	if solutionCmd.Valid {
-		ep.SolutionCommand = solutionCmd.String
-	}
-	if pp.Valid {
-		ep.ProjectPath = pp.String
-	}
-
 	return &ep, nil
 }
 
-func (db *DB) FindMatchingErrorPatterns(errorText string, projectPath string, limit int) ([]ErrorPattern, error) {
-	query := `
-		SELECT id, error_signature, error_type, language, root_cause, solution, solution_command, success_count, failure_count, project_path, created_at, last_used
-		FROM error_patterns
-		WHERE ? LIKE '%' || error_signature || '%' OR error_signature LIKE '%' || ? || '%'
-	`
-	args := []interface{}{errorText, errorText}
+// maxErrorPatternScan caps how many patterns FindMatchingErrorPatterns
+// scores.
+const maxErrorPatternScan = 2000
 
+// FindMatchingErrorPatterns returns learned patterns similar to errorText,
+// best match first. Both sides are normalized, so errors that differ only
+// in paths, line numbers, addresses or quoted names still match.
+func (db *DB) FindMatchingErrorPatterns(errorText string, projectPath string, limit int) ([]ErrorPattern, error) {
+	query := "SELECT " + errorPatternColumns + " FROM error_patterns"
+	var args []interface{}
 	if projectPath != "" {
-		query += " AND (project_path = ? OR project_path IS NULL)"
+		query += " WHERE project_path = ? OR project_path IS NULL"
 		args = append(args, projectPath)
 	}
-
-	query += " ORDER BY success_count DESC, last_used DESC LIMIT ?"
-	args = append(args, limit)
+	query += " ORDER BY last_used DESC LIMIT ?"
+	args = append(args, maxErrorPatternScan)
 
 	rows, err := db.conn.Query(query, args...)
 	if err != nil {
@@ -470,31 +569,34 @@ func (db *DB) FindMatchingErrorPatterns(errorText string, projectPath string, li
 	}
 	defer rows.Close()
 
+	normalized := NormalizeErrorSignature(errorText)
 	var patterns []ErrorPattern
 	for rows.Next() {
-		var ep ErrorPattern
-		var lang, rootCause, solution, solutionCmd, pp sql.NullString
-		if err := rows.Scan(&ep.ID, &ep.ErrorSignature, &ep.ErrorType, &lang, &rootCause, &solution, &solutionCmd, &ep.SuccessCount, &ep.FailureCount, &pp, &ep.CreatedAt, &ep.LastUsed); err != nil {
+		ep, err := scanErrorPattern(rows)
+		if err != nil {
 			return nil, err
 		}
-		if lang.Valid {
-			ep.Language = lang.String
-		}
-		if rootCause.Valid {
-			ep.RootCause = rootCause.String
+		// Patterns learned before signatures were normalized are
+		// normalized here.
+		ep.Similarity = errorSimilarity(NormalizeErrorSignature(ep.ErrorSignature), normalized)
+		if ep.Similarity >= minErrorSimilarity {
+			patterns = append(patterns, ep)
 		}
-		if solution.Valid {
-			ep.Solution = solution.String
-		}
-		if solutionCmd.Valid {
-			ep.SolutionCommand = solutionCmd.String
-		}
-		if pp.Valid {
-			ep.ProjectPath = pp.String
-		}
-		patterns = append(patterns, ep)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
+	sort.SliceStable(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+		return a.SuccessCount > b.SuccessCount
+	})
+	if len(patterns) > limit {
+		patterns = patterns[:limit]
+	}
 	return patterns, nil
 }
 
@@ -513,16 +615,27 @@ func (db *DB) RecordErrorPatternResult(id int64, success bool) error {
 }
 
 func (db *DB) GetRecentEntities(projectPath string, entityType string, limit int) ([]KnowledgeEntity, error) {
+	var paths []string
+	if projectPath != "" {
+		paths = []string{projectPath}
+	}
+	return db.GetRecentEntitiesIn(paths, entityType, limit)
+}
+
+// GetRecentEntitiesIn is GetRecentEntities for several projects; nil paths
+// means every project.
+func (db *DB) GetRecentEntitiesIn(paths []string, entityType string, limit int) ([]KnowledgeEntity, error) {
 	query := `
-		SELECT id, type, name, value, project_path, first_seen, last_seen, occurrence_count
+		SELECT ` + entityColumns + `
 		FROM knowledge_entities
 		WHERE 1=1
 	`
 	args := []interface{}{}
 
-	if projectPath != "" {
-		query += " AND (project_path = ? OR project_path IS NULL)"
-		args = append(args, projectPath)
+	if paths != nil {
+		clause, pathArgs := projectClause(paths)
+		query += " AND " + clause
+		args = append(args, pathArgs...)
 	}
 
 	if entityType != "" {
@@ -541,17 +654,10 @@ func (db *DB) GetRecentEntities(projectPath string, entityType string, limit int
 
 	var entities []KnowledgeEntity
 	for rows.Next() {
-		var e KnowledgeEntity
-		var value, pp sql.NullString
-		if err := rows.Scan(&e.ID, &e.Type, &e.Name, &value, &pp, &e.FirstSeen, &e.LastSeen, &e.OccurrenceCount); err != nil {
+		e, err := scanEntity(rows)
+		if err != nil {
 			return nil, err
 		}
-		if value.Valid {
-			e.Value = value.String
-		}
-		if pp.Valid {
-			e.ProjectPath = pp.String
-		}
 		entities = append(entities, e)
 	}
 
@@ -610,3 +716,122 @@ func (db *DB) GetKnowledgeSummary(projectPath string) (map[string]interface{}, e
 
 	return summary, nil
 }
+
+const factColumns = "id, category, subject, predicate, object, project_path, confidence, source, created_at, last_verified, verification_count, session_id, model, trust, rejected"
+
+func scanFacts(rows *sql.Rows) ([]KnowledgeFact, error) {
+	var facts []KnowledgeFact
+	for rows.Next() {
+		var f KnowledgeFact
+		var pp, src, session, model sql.NullString
+		if err := rows.Scan(&f.ID, &f.Category, &f.Subject, &f.Predicate, &f.Object, &pp, &f.Confidence, &src, &f.CreatedAt, &f.LastVerified, &f.VerificationCount,
+			&session, &model, &f.Trust, &f.Rejected); err != nil {
+			return nil, err
+		}
+		f.ProjectPath, f.Source, f.SessionID, f.Model = pp.String, src.String, session.String, model.String
+		f.Confidence = decay(f.Confidence, f.LastVerified)
+		facts = append(facts, f)
+	}
+	return facts, rows.Err()
+}
+
+// ListFacts returns the most recently verified facts from the given
+// projects; nil paths means every project. A non-empty query keeps only
+// facts whose subject, predicate or object contains it.
+func (db *DB) ListFacts(query string, paths []string, limit int) ([]KnowledgeFact, error) {
+	q := "SELECT " + factColumns + " FROM knowledge_facts WHERE rejected = 0"
+	var args []interface{}
+	if paths != nil {
+		clause, pathArgs := projectClause(paths)
+		q += " AND " + clause
+		args = append(args, pathArgs...)
+	}
+	if query != "" {
+		q += " AND (subject LIKE ? OR predicate LIKE ? OR object LIKE ?)"
+		like := "%" + query + "%"
+		args = append(args, like, like, like)
+	}
+	q += " ORDER BY last_verified DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.conn.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list facts: %w", err)
+	}
+	defer rows.Close()
+	return scanFacts(rows)
+}
+
+// GetFactByID returns a fact, or nil if there is none with that ID.
+func (db *DB) GetFactByID(id int64) (*KnowledgeFact, error) {
+	rows, err := db.conn.Query("SELECT "+factColumns+" FROM knowledge_facts WHERE id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fact: %w", err)
+	}
+	defer rows.Close()
+	facts, err := scanFacts(rows)
+	if err != nil || len(facts) == 0 {
+		return nil, err
+	}
+	return &facts[0], nil
+}
+
+// DeleteEntity removes an entity along with its relations. It reports
+// whether the entity existed.
+func (db *DB) DeleteEntity(id int64) (bool, error) {
+	res, err := db.conn.Exec("DELETE FROM knowledge_entities WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete entity: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteFact removes a fact. It reports whether the fact existed.
+func (db *DB) DeleteFact(id int64) (bool, error) {
+	res, err := db.conn.Exec("DELETE FROM knowledge_facts WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete fact: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// maxFactScan caps how many facts SearchFacts scores.
+const maxFactScan = 1000
+
+// SearchFacts ranks facts from the given projects (nil paths means every
+// project) by how many words of query they mention, weighted by
+// confidence and trust. Facts mentioning none are left out.
+func (db *DB) SearchFacts(query string, paths []string, limit int) ([]KnowledgeFact, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	facts, err := db.ListFacts("", paths, maxFactScan)
+	if err != nil {
+		return nil, err
+	}
+
+	score := make(map[int64]float64)
+	var matched []KnowledgeFact
+	for _, f := range facts {
+		text := searchText(f.Subject + " " + f.Predicate + " " + f.Object)
+		hits := 0
+		for _, t := range terms {
+			// Match word prefixes, as the full-text searches do.
+			if strings.Contains(text, " "+strings.Join(t, " ")) {
+				hits++
+			}
+		}
+		if hits > 0 {
+			score[f.ID] = float64(hits) * f.Confidence * f.Trust.weight()
+			matched = append(matched, f)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return score[matched[i].ID] > score[matched[j].ID] })
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched, nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Memory is a fact the user pinned with q remember. Unlike learned
+// knowledge it is never pruned and always goes into the system prompt.
+type Memory struct {
+	ID          int64     `json:"id"`
+	ProjectPath string    `json:"project_path,omitempty"` // empty for global memories
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AddMemory pins a fact to a project, or everywhere when projectPath is empty.
+func (db *DB) AddMemory(projectPath, content string) (*Memory, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, fmt.Errorf("nothing to remember")
+	}
+	now := time.Now()
+	result, err := db.conn.Exec(
+		"INSERT INTO memories (project_path, content, created_at) VALUES (?, ?, ?)",
+		nullIfEmpty(projectPath), db.seal(content), now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add memory: %w", err)
+	}
+	id, _ := result.LastInsertId()
+	return &Memory{ID: id, ProjectPath: projectPath, Content: content, CreatedAt: now}, nil
+}
+
+// GetMemories returns the memories that apply in projectPath: global ones
+// first, then the project's own, oldest first.
+func (db *DB) GetMemories(projectPath string) ([]Memory, error) {
+	return db.queryMemories(
+		"SELECT id, project_path, content, created_at FROM memories WHERE project_path IS NULL OR project_path = ? ORDER BY project_path IS NOT NULL, id",
+		projectPath,
+	)
+}
+
+// ListMemories returns every memory, grouped by project.
+func (db *DB) ListMemories() ([]Memory, error) {
+	return db.queryMemories("SELECT id, project_path, content, created_at FROM memories ORDER BY project_path, id")
+}
+
+func (db *DB) queryMemories(query string, args ...interface{}) ([]Memory, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memories: %w", err)
+	}
+	defer rows.Close()
+
+	var memories []Memory
+	for rows.Next() {
+		var m Memory
+		var projectPath sql.NullString
+		if err := rows.Scan(&m.ID, &projectPath, &m.Content, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.ProjectPath = projectPath.String
+		m.Content = db.unseal(m.Content)
+		memories = append(memories, m)
+	}
+	return memories, rows.Err()
+}
+
+// DeleteMemory forgets a memory. It reports false if no memory has that ID.
+func (db *DB) DeleteMemory(id int64) (bool, error) {
+	result, err := db.conn.Exec("DELETE FROM memories WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete memory: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// addedColumns are columns added to tables after their first release.
+// schema.sql creates them for new databases; migrate adds them to older ones,
+// so each must be nullable or have a default.
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"sessions", "prompt_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"sessions", "completion_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"sessions", "cost", "REAL NOT NULL DEFAULT 0"},
+	{"messages", "model", "TEXT"},
+	{"messages", "latency_ms", "INTEGER"},
+	{"knowledge_entities", "source", "TEXT"},
+	{"knowledge_entities", "session_id", "TEXT"},
+	{"knowledge_entities", "model", "TEXT"},
+	{"knowledge_entities", "trust", "INTEGER NOT NULL DEFAULT 1"},
+	{"knowledge_facts", "session_id", "TEXT"},
+	{"knowledge_facts", "model", "TEXT"},
+	{"knowledge_facts", "trust", "INTEGER NOT NULL DEFAULT 1"},
+	{"knowledge_facts", "rejected", "INTEGER NOT NULL DEFAULT 0"},
+	{"agent_runs", "tools", "TEXT"},
+	{"knowledge_entities", "project_dir", "TEXT"},
+	{"knowledge_facts", "project_dir", "TEXT"},
+	{"error_patterns", "project_dir", "TEXT"},
+}
+
+// dataMigrations rewrite existing rows, in order. PRAGMA user_version
+// records how many have run.
+var dataMigrations = []func(*sql.DB) error{
+	keyKnowledgeByProject,
+	trustUserFacts,
+}
+
+// migrate adds any missing addedColumns, then runs dataMigrations that have
+// not run yet.
+func migrate(conn *sql.DB) error {
+	for _, c := range addedColumns {
+		var n int
+		if err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	var version int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(dataMigrations); version++ {
+		if err := dataMigrations[version](conn); err != nil {
+			return fmt.Errorf("failed to migrate data: %w", err)
+		}
+		if _, err := conn.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
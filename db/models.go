@@ -13,6 +13,7 @@ type Session struct {
 	ProjectPath string         `json:"project_path"`
 	Title       sql.NullString `json:"title"`
 	Summary     sql.NullString `json:"summary"`
+	Usage       Usage          `json:"usage"`
 }
 
 // Message represents a single message within a session.
@@ -23,6 +24,23 @@ type Message struct {
 	Content    string    `json:"content"`
 	CreatedAt  time.Time `json:"created_at"`
 	TokenCount int       `json:"token_count"`
+	Model      string    `json:"model,omitempty"`      // assistant replies only
+	LatencyMS  int64     `json:"latency_ms,omitempty"` // assistant replies only
+}
+
+// ToolCall is a tool the model ran while producing an assistant message.
+type ToolCall struct {
+	ID         string    `json:"id"`
+	SessionID  string    `json:"session_id"`
+	MessageID  string    `json:"message_id"` // the assistant reply it led to
+	Seq        int       `json:"seq"`
+	CallID     string    `json:"call_id,omitempty"`
+	Name       string    `json:"name"`
+	Arguments  string    `json:"arguments"`
+	Result     string    `json:"result"`
+	IsError    bool      `json:"is_error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // ContextFile represents a file referenced during a session.
@@ -71,6 +89,7 @@ type FullSession struct {
 	Messages     []Message     `json:"messages"`
 	Tags         []Tag         `json:"tags"`
 	ContextFiles []ContextFile `json:"context_files"`
+	ToolCalls    []ToolCall    `json:"tool_calls"`
 }
 
 // SearchResult represents a full-text search result from messages_fts.
@@ -88,4 +107,22 @@ type SessionSummary struct {
 	Title        string    `json:"title"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	MessageCount int       `json:"message_count"`
+	Usage        Usage     `json:"usage"`
+}
+
+// Usage is the tokens a session has used and their estimated cost in USD.
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Add returns the sum of two usages.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{u.PromptTokens + o.PromptTokens, u.CompletionTokens + o.CompletionTokens, u.Cost + o.Cost}
+}
+
+// Tokens is the total of prompt and completion tokens.
+func (u Usage) Tokens() int {
+	return u.PromptTokens + u.CompletionTokens
 }
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Note is an entry in the scratchpad the model and its sub-agents share.
+type Note struct {
+	Key     string `json:"key"`
+	Content string `json:"content"`
+	// Author is main, or the ID of the agent that last wrote the note.
+	Author    string    `json:"author"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// notesMu serializes writes of notes, so that agents appending to the
+// same note at once do not lose each other's lines.
+var notesMu sync.Mutex
+
+// WriteNote sets the note called key in scope, or adds a line to it when
+// appending. It returns the note as written.
+func (db *DB) WriteNote(scope, key, content, author string, appending bool) (*Note, error) {
+	notesMu.Lock()
+	defer notesMu.Unlock()
+
+	if appending {
+		var existing string
+		err := db.conn.QueryRow("SELECT content FROM notes WHERE scope = ? AND key = ?", scope, key).Scan(&existing)
+		switch {
+		case err == nil:
+			content = db.unseal(existing) + "\n" + content
+		case err != sql.ErrNoRows:
+			return nil, fmt.Errorf("failed to write note: %w", err)
+		}
+	}
+	note := &Note{Key: key, Content: content, Author: author, UpdatedAt: time.Now()}
+	_, err := db.conn.Exec(`
+		INSERT INTO notes (scope, key, content, author, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(scope, key) DO UPDATE SET content = excluded.content, author = excluded.author, updated_at = excluded.updated_at
+	`, scope, key, db.seal(content), author, note.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write note: %w", err)
+	}
+	return note, nil
+}
+
+// ReadNote returns the note called key in scope, or nil if there is none.
+func (db *DB) ReadNote(scope, key string) (*Note, error) {
+	note := &Note{Key: key}
+	err := db.conn.QueryRow("SELECT content, author, updated_at FROM notes WHERE scope = ? AND key = ?", scope, key).
+		Scan(&note.Content, &note.Author, &note.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read note: %w", err)
+	}
+	note.Content = db.unseal(note.Content)
+	return note, nil
+}
+
+// Notes returns the notes in scope, most recently written first.
+func (db *DB) Notes(scope string) ([]Note, error) {
+	rows, err := db.conn.Query("SELECT key, content, author, updated_at FROM notes WHERE scope = ? ORDER BY updated_at DESC, key", scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	defer rows.Close()
+	var notes []Note
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.Key, &n.Content, &n.Author, &n.UpdatedAt); err != nil {
+			return nil, err
+		}
+		n.Content = db.unseal(n.Content)
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// DeleteNote deletes the note called key in scope, reporting whether there
+// was one.
+func (db *DB) DeleteNote(scope, key string) (bool, error) {
+	result, err := db.conn.Exec("DELETE FROM notes WHERE scope = ? AND key = ?", scope, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete note: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
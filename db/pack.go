@@ -0,0 +1,379 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// KnowledgePackVersion is bumped when the knowledge pack layout changes.
+const KnowledgePackVersion = 1
+
+// PackProject is the project_path written to a pack for knowledge about
+// the exported directory. Importing maps it to the directory imported into,
+// so a team can share what applies to a repository wherever it is cloned.
+const PackProject = "."
+
+// KnowledgePack is the portable form of the knowledge graph written by
+// `q knowledge export`. Entities are identified by type, name and project
+// rather than ID, as in a sync bundle.
+type KnowledgePack struct {
+	Version       int               `json:"version"`
+	ExportedAt    time.Time         `json:"exported_at"`
+	Entities      []KnowledgeEntity `json:"entities"`
+	Relations     []SyncRelation    `json:"relations"`
+	Facts         []KnowledgeFact   `json:"facts"`
+	ErrorPatterns []ErrorPattern    `json:"error_patterns"`
+}
+
+// PackImportResult counts what importing a pack changed.
+type PackImportResult struct {
+	Added     int
+	Updated   int
+	Unchanged int
+}
+
+// ExportKnowledge returns the knowledge for project and global knowledge,
+// with project's rows marked PackProject. An empty project exports every
+// directory's knowledge with its paths as they are.
+func (db *DB) ExportKnowledge(project string) (*KnowledgePack, error) {
+	db.Flush()
+	var keep func(string) bool
+	if project != "" {
+		keep = func(p string) bool { return p == "" || p == project }
+	}
+	pack, err := db.collectKnowledge(keep)
+	if err != nil {
+		return nil, err
+	}
+	if project != "" {
+		local := func(p string) string {
+			if p == project {
+				return PackProject
+			}
+			return p
+		}
+		for i := range pack.Entities {
+			pack.Entities[i].ProjectPath = local(pack.Entities[i].ProjectPath)
+		}
+		for i := range pack.Relations {
+			pack.Relations[i].Source.ProjectPath = local(pack.Relations[i].Source.ProjectPath)
+			pack.Relations[i].Target.ProjectPath = local(pack.Relations[i].Target.ProjectPath)
+		}
+		for i := range pack.Facts {
+			pack.Facts[i].ProjectPath = local(pack.Facts[i].ProjectPath)
+		}
+		for i := range pack.ErrorPatterns {
+			pack.ErrorPatterns[i].ProjectPath = local(pack.ErrorPatterns[i].ProjectPath)
+		}
+	}
+	return pack, nil
+}
+
+// collectKnowledge reads the knowledge graph with local IDs dropped, keeping
+// rows whose project path passes keep (all of them when keep is nil).
+func (db *DB) collectKnowledge(keep func(projectPath string) bool) (*KnowledgePack, error) {
+	if keep == nil {
+		keep = func(string) bool { return true }
+	}
+	pack := &KnowledgePack{
+		Version:       KnowledgePackVersion,
+		ExportedAt:    time.Now(),
+		Entities:      []KnowledgeEntity{},
+		Relations:     []SyncRelation{},
+		Facts:         []KnowledgeFact{},
+		ErrorPatterns: []ErrorPattern{},
+	}
+
+	keys := make(map[int64]EntityKey)
+	rows, err := db.conn.Query("SELECT " + entityColumns + " FROM knowledge_entities")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		e, err := scanEntity(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !keep(e.ProjectPath) {
+			continue
+		}
+		keys[e.ID] = EntityKey{e.Type, e.Name, e.ProjectPath}
+		e.ID = 0
+		pack.Entities = append(pack.Entities, e)
+	}
+	rows.Close()
+
+	rows, err = db.conn.Query("SELECT source_id, relation, target_id, confidence, context, created_at, last_used, use_count FROM knowledge_relations")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var r SyncRelation
+		var source, target int64
+		var context sql.NullString
+		if err := rows.Scan(&source, &r.Relation, &target, &r.Confidence, &context, &r.CreatedAt, &r.LastUsed, &r.UseCount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		var ok1, ok2 bool
+		r.Source, ok1 = keys[source]
+		r.Target, ok2 = keys[target]
+		if ok1 && ok2 {
+			r.Context = context.String
+			pack.Relations = append(pack.Relations, r)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.conn.Query("SELECT category, subject, predicate, object, project_path, confidence, source, created_at, last_verified, verification_count, session_id, model, trust FROM knowledge_facts WHERE rejected = 0")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f KnowledgeFact
+		var pp, source, session, model sql.NullString
+		if err := rows.Scan(&f.Category, &f.Subject, &f.Predicate, &f.Object, &pp, &f.Confidence, &source, &f.CreatedAt, &f.LastVerified, &f.VerificationCount,
+			&session, &model, &f.Trust); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		f.ProjectPath, f.Source, f.SessionID, f.Model = pp.String, source.String, session.String, model.String
+		if keep(f.ProjectPath) {
+			pack.Facts = append(pack.Facts, f)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.conn.Query("SELECT error_signature, error_type, language, root_cause, solution, solution_command, success_count, failure_count, project_path, created_at, last_used FROM error_patterns")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p ErrorPattern
+		var lang, cause, solution, cmd, pp sql.NullString
+		if err := rows.Scan(&p.ErrorSignature, &p.ErrorType, &lang, &cause, &solution, &cmd, &p.SuccessCount, &p.FailureCount, &pp, &p.CreatedAt, &p.LastUsed); err != nil {
+			return nil, err
+		}
+		p.Language, p.RootCause, p.Solution, p.SolutionCommand, p.ProjectPath = lang.String, cause.String, solution.String, cmd.String, pp.String
+		if keep(p.ProjectPath) {
+			pack.ErrorPatterns = append(pack.ErrorPatterns, p)
+		}
+	}
+	return pack, rows.Err()
+}
+
+// patternConfidence is how far a learned fix can be trusted, from its
+// record so far. A fix that has never been tried counts as a coin toss.
+func patternConfidence(successes, failures int) float64 {
+	return float64(successes+1) / float64(successes+failures+2)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// ImportKnowledge merges a knowledge pack into the graph, mapping
+// PackProject to project. Rows are matched on their natural keys (an
+// entity's type and name, a fact's category, subject and predicate, an
+// error's normalized signature, each within its project); where both sides
+// have one, the more confident copy wins, counters take the larger value
+// and an entity keeps the more recently seen value. An error pattern's
+// solution command is left behind: auto-repair runs stored commands without
+// asking, and a pack's are someone else's.
+func (db *DB) ImportKnowledge(pack *KnowledgePack, project string) (*PackImportResult, error) {
+	if pack.Version > KnowledgePackVersion {
+		return nil, fmt.Errorf("knowledge pack version %d is newer than this q supports (%d)", pack.Version, KnowledgePackVersion)
+	}
+	db.Flush()
+	result := &PackImportResult{}
+	scope := func(p string) interface{} {
+		if p == PackProject {
+			p = project
+		}
+		return nullIfEmpty(p)
+	}
+
+	// Hand-written packs may leave out timestamps; those entries count as
+	// learned now.
+	now := time.Now()
+	orNow := func(t *time.Time) {
+		if t.IsZero() {
+			*t = now
+		}
+	}
+	for i := range pack.Entities {
+		orNow(&pack.Entities[i].FirstSeen)
+		orNow(&pack.Entities[i].LastSeen)
+	}
+	for i := range pack.Relations {
+		orNow(&pack.Relations[i].CreatedAt)
+		orNow(&pack.Relations[i].LastUsed)
+	}
+	for i := range pack.Facts {
+		orNow(&pack.Facts[i].CreatedAt)
+		orNow(&pack.Facts[i].LastVerified)
+	}
+	for i := range pack.ErrorPatterns {
+		orNow(&pack.ErrorPatterns[i].CreatedAt)
+		orNow(&pack.ErrorPatterns[i].LastUsed)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	// count(&result.Added)(tx.Exec(...)) counts a row changed by the
+	// statement, or one left as it was.
+	count := func(counter *int) func(sql.Result, error) error {
+		return func(res sql.Result, err error) error {
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				*counter++
+			} else {
+				result.Unchanged++
+			}
+			return nil
+		}
+	}
+	entityID := func(k EntityKey) (int64, error) {
+		var id int64
+		err := tx.QueryRow("SELECT id FROM knowledge_entities WHERE type = ? AND name = ? AND project_path IS ?",
+			k.Type, k.Name, scope(k.ProjectPath)).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return id, err
+	}
+
+	for _, e := range pack.Entities {
+		if e.Type == "" || e.Name == "" {
+			continue
+		}
+		var id int64
+		var lastSeen time.Time
+		err := tx.QueryRow("SELECT id, last_seen FROM knowledge_entities WHERE type = ? AND name = ? AND project_path IS ?",
+			e.Type, e.Name, scope(e.ProjectPath)).Scan(&id, &lastSeen)
+		switch {
+		case err == sql.ErrNoRows:
+			err = count(&result.Added)(tx.Exec(`INSERT INTO knowledge_entities (type, name, value, project_path, first_seen, last_seen, occurrence_count, source, session_id, model, trust)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				e.Type, e.Name, nullIfEmpty(e.Value), scope(e.ProjectPath), e.FirstSeen, e.LastSeen, max(e.OccurrenceCount, 1),
+				nullIfEmpty(e.Source), nullIfEmpty(e.SessionID), nullIfEmpty(e.Model), e.Trust.imported()))
+		case err == nil && e.LastSeen.After(lastSeen):
+			err = count(&result.Updated)(tx.Exec(`UPDATE knowledge_entities SET value = COALESCE(?, value), last_seen = ?,
+				occurrence_count = MAX(occurrence_count, ?), trust = MAX(trust, ?) WHERE id = ?`,
+				nullIfEmpty(e.Value), e.LastSeen, e.OccurrenceCount, e.Trust.imported(), id))
+		case err == nil:
+			err = count(&result.Updated)(tx.Exec(`UPDATE knowledge_entities SET value = COALESCE(value, ?),
+				occurrence_count = MAX(occurrence_count, ?), trust = MAX(trust, ?) WHERE id = ? AND (value IS NULL AND ? IS NOT NULL OR occurrence_count < ? OR trust < ?)`,
+				nullIfEmpty(e.Value), e.OccurrenceCount, e.Trust.imported(), id, nullIfEmpty(e.Value), e.OccurrenceCount, e.Trust.imported()))
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to import entity: %w", err)
+		}
+	}
+
+	for _, r := range pack.Relations {
+		source, err := entityID(r.Source)
+		if err != nil {
+			return result, err
+		}
+		target, err := entityID(r.Target)
+		if err != nil {
+			return result, err
+		}
+		if source == 0 || target == 0 {
+			continue
+		}
+		var id int64
+		var confidence float64
+		var lastUsed time.Time
+		err = tx.QueryRow("SELECT id, confidence, last_used FROM knowledge_relations WHERE source_id = ? AND relation = ? AND target_id = ?",
+			source, r.Relation, target).Scan(&id, &confidence, &lastUsed)
+		switch {
+		case err == sql.ErrNoRows:
+			err = count(&result.Added)(tx.Exec(`INSERT INTO knowledge_relations (source_id, relation, target_id, confidence, context, created_at, last_used, use_count)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				source, r.Relation, target, r.Confidence, nullIfEmpty(r.Context), r.CreatedAt, r.LastUsed, r.UseCount))
+		case err == nil && moreConfident(r.Confidence, r.LastUsed, confidence, lastUsed):
+			err = count(&result.Updated)(tx.Exec(`UPDATE knowledge_relations SET confidence = ?, context = COALESCE(?, context), last_used = ?,
+				use_count = MAX(use_count, ?) WHERE id = ?`,
+				r.Confidence, nullIfEmpty(r.Context), r.LastUsed, r.UseCount, id))
+		case err == nil:
+			result.Unchanged++
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to import relation: %w", err)
+		}
+	}
+
+	for _, f := range pack.Facts {
+		if f.Subject == "" || f.Predicate == "" {
+			continue
+		}
+		var id int64
+		var confidence float64
+		var lastVerified time.Time
+		var trust Trust
+		f.Trust = f.Trust.imported()
+		err := tx.QueryRow("SELECT id, confidence, last_verified, trust FROM knowledge_facts WHERE category = ? AND subject = ? AND predicate = ? AND project_path IS ?",
+			f.Category, f.Subject, f.Predicate, scope(f.ProjectPath)).Scan(&id, &confidence, &lastVerified, &trust)
+		switch {
+		case err == sql.ErrNoRows:
+			err = count(&result.Added)(tx.Exec(`INSERT INTO knowledge_facts (category, subject, predicate, object, project_path, confidence, source, created_at, last_verified, verification_count, session_id, model, trust)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				f.Category, f.Subject, f.Predicate, f.Object, scope(f.ProjectPath), f.Confidence, nullIfEmpty(f.Source), f.CreatedAt, f.LastVerified, max(f.VerificationCount, 1),
+				nullIfEmpty(f.SessionID), nullIfEmpty(f.Model), f.Trust))
+		case err == nil && (f.Trust > trust || f.Trust == trust && moreConfident(f.Confidence, f.LastVerified, confidence, lastVerified)):
+			err = count(&result.Updated)(tx.Exec(`UPDATE knowledge_facts SET object = ?, confidence = ?, source = COALESCE(?, source), last_verified = ?,
+				verification_count = MAX(verification_count, ?), session_id = ?, model = ?, trust = ? WHERE id = ?`,
+				f.Object, f.Confidence, nullIfEmpty(f.Source), f.LastVerified, f.VerificationCount,
+				nullIfEmpty(f.SessionID), nullIfEmpty(f.Model), f.Trust, id))
+		case err == nil:
+			result.Unchanged++
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to import fact: %w", err)
+		}
+	}
+
+	for _, p := range pack.ErrorPatterns {
+		signature := NormalizeErrorSignature(p.ErrorSignature)
+		if signature == "" {
+			continue
+		}
+		var id int64
+		var successes, failures int
+		var lastUsed time.Time
+		err := tx.QueryRow("SELECT id, success_count, failure_count, last_used FROM error_patterns WHERE error_signature = ? AND project_path IS ?",
+			signature, scope(p.ProjectPath)).Scan(&id, &successes, &failures, &lastUsed)
+		switch {
+		case err == sql.ErrNoRows:
+			err = count(&result.Added)(tx.Exec(`INSERT INTO error_patterns (error_signature, error_type, language, root_cause, solution, success_count, failure_count, project_path, created_at, last_used)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				signature, p.ErrorType, nullIfEmpty(p.Language), nullIfEmpty(p.RootCause), nullIfEmpty(p.Solution),
+				p.SuccessCount, p.FailureCount, scope(p.ProjectPath), p.CreatedAt, p.LastUsed))
+		case err == nil && patternConfidence(p.SuccessCount, p.FailureCount) > patternConfidence(successes, failures):
+			err = count(&result.Updated)(tx.Exec(`UPDATE error_patterns SET root_cause = COALESCE(?, root_cause), solution = COALESCE(?, solution),
+				success_count = ?, failure_count = ?, last_used = ? WHERE id = ?`,
+				nullIfEmpty(p.RootCause), nullIfEmpty(p.Solution), p.SuccessCount, p.FailureCount, later(p.LastUsed, lastUsed), id))
+		case err == nil:
+			result.Unchanged++
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to import error pattern: %w", err)
+		}
+	}
+
+	return result, tx.Commit()
+}
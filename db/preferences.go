@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// PreferenceCategory is the fact category for how the user likes to work,
+// e.g. "user prefers ripgrep over grep".
+const PreferenceCategory = "preference"
+
+// LearnedPreferences returns the preference facts from the given projects
+// (nil paths means every project), rejected ones included, most recently
+// confirmed first.
+func (db *DB) LearnedPreferences(paths []string) ([]KnowledgeFact, error) {
+	query := "SELECT " + factColumns + " FROM knowledge_facts WHERE category = ?"
+	args := []interface{}{PreferenceCategory}
+	if paths != nil {
+		clause, pathArgs := projectClause(paths)
+		query += " AND " + clause
+		args = append(args, pathArgs...)
+	}
+	rows, err := db.conn.Query(query+" ORDER BY last_verified DESC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list preferences: %w", err)
+	}
+	defer rows.Close()
+	return scanFacts(rows)
+}
+
+// AcceptedPreferences returns the preferences from the given projects that
+// the user accepted or entered.
+func (db *DB) AcceptedPreferences(paths []string) ([]KnowledgeFact, error) {
+	prefs, err := db.LearnedPreferences(paths)
+	if err != nil {
+		return nil, err
+	}
+	var accepted []KnowledgeFact
+	for _, f := range prefs {
+		if f.Trust >= TrustUser && !f.Rejected {
+			accepted = append(accepted, f)
+		}
+	}
+	return accepted, nil
+}
+
+// ReviewFact records the user accepting a fact, which makes it as trusted
+// as one they entered, or rejecting it, which keeps it out of recall and
+// stops it being learned again. It reports whether the fact exists.
+func (db *DB) ReviewFact(id int64, accept bool) (bool, error) {
+	query := "UPDATE knowledge_facts SET trust = ?, rejected = 0, last_verified = ? WHERE id = ?"
+	args := []interface{}{TrustUser, time.Now(), id}
+	if !accept {
+		query = "UPDATE knowledge_facts SET rejected = 1, last_verified = ? WHERE id = ?"
+		args = []interface{}{time.Now(), id}
+	}
+	res, err := db.conn.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to review fact: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// projectKeys caches ProjectKey, which runs git.
+var projectKeys sync.Map
+
+// ProjectKey returns the key knowledge about dir is stored under: its git
+// origin URL as given by GitRemote, so every clone of a repository shares
+// what was learned in any of them, or else dir with symlinks resolved. It
+// is "" for "".
+func ProjectKey(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	if key, ok := projectKeys.Load(dir); ok {
+		return key.(string)
+	}
+	key := GitRemote(dir)
+	if key == "" {
+		key = dir
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			key = resolved
+		}
+	}
+	projectKeys.Store(dir, key)
+	return key
+}
+
+// ProjectKeys maps directories to their project keys, dropping duplicates.
+// nil, meaning every project, stays nil.
+func ProjectKeys(dirs []string) []string {
+	if dirs == nil {
+		return nil
+	}
+	keys := []string{}
+	seen := make(map[string]bool)
+	for _, d := range dirs {
+		if k := ProjectKey(d); !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// GitRemote returns dir's origin URL reduced to host/path, so SSH and HTTPS
+// clones of one repository compare equal, or "" if there is none. A
+// repository whose top is the home directory, such as one tracking
+// dotfiles, counts as none: every project under home would share its key.
+func GitRemote(dir string) string {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	git := func(args ...string) string {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	top := git("rev-parse", "--show-toplevel")
+	if top == "" || isHomeDir(top) {
+		return ""
+	}
+	url := git("remote", "get-url", "origin")
+	if url == "" {
+		return ""
+	}
+	url = strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+		if at := strings.Index(url, "@"); at >= 0 {
+			url = url[at+1:]
+		}
+	} else if at := strings.Index(url, "@"); at >= 0 {
+		// scp-style git@host:owner/repo
+		url = strings.Replace(url[at+1:], ":", "/", 1)
+	}
+	return strings.ToLower(url)
+}
+
+// isHomeDir reports whether dir is the user's home directory.
+func isHomeDir(dir string) bool {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+	if resolved, err := filepath.EvalSymlinks(home); err == nil {
+		home = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return filepath.Clean(dir) == filepath.Clean(home)
+}
+
+// keyKnowledgeByProject rewrites the directories knowledge was stored under
+// to project keys. Where two clones had learned the same entity, fact or
+// error fix, the copies are combined: an entity's relations and counts move
+// to the one kept, and for facts and error fixes the first copy is kept.
+// Each row rewritten keeps its directory in project_dir, so setting
+// project_path back to project_dir undoes the rewrite.
+func keyKnowledgeByProject(conn *sql.DB) error {
+	paths := make(map[string]bool)
+	for _, table := range []string{"knowledge_entities", "knowledge_facts", "error_patterns"} {
+		rows, err := conn.Query(fmt.Sprintf("SELECT DISTINCT project_path FROM %s WHERE project_path IS NOT NULL", table))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var p string
+			if rows.Scan(&p) == nil {
+				paths[p] = true
+			}
+		}
+		rows.Close()
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for path := range paths {
+		key := ProjectKey(path)
+		if key == path {
+			continue
+		}
+		for _, table := range []string{"knowledge_entities", "knowledge_facts", "error_patterns"} {
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE OR IGNORE %s SET project_path = ?, project_dir = COALESCE(project_dir, project_path) WHERE project_path = ?", table), key, path); err != nil {
+				return err
+			}
+		}
+
+		// Entities left behind already exist under the key.
+		rows, err := tx.Query(`
+			SELECT old.id, new.id, old.occurrence_count FROM knowledge_entities old
+			JOIN knowledge_entities new ON new.type = old.type AND new.name = old.name AND new.project_path = ?
+			WHERE old.project_path = ?
+		`, key, path)
+		if err != nil {
+			return err
+		}
+		type dup struct{ from, into int64 }
+		var dups []dup
+		var counts []int
+		for rows.Next() {
+			var d dup
+			var n int
+			if rows.Scan(&d.from, &d.into, &n) == nil {
+				dups = append(dups, d)
+				counts = append(counts, n)
+			}
+		}
+		rows.Close()
+		for i, d := range dups {
+			if err := mergeRelations(tx, d.into, d.from); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE OR IGNORE knowledge_aliases SET entity_id = ? WHERE entity_id = ?", d.into, d.from); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE knowledge_entities SET occurrence_count = occurrence_count + ? WHERE id = ?", counts[i], d.into); err != nil {
+				return err
+			}
+		}
+		for _, table := range []string{"knowledge_entities", "knowledge_facts", "error_patterns"} {
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE project_path = ?", table), path); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
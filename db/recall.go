@@ -0,0 +1,45 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// projectClause matches rows from any of the given projects, plus global
+// rows that have no project.
+func projectClause(paths []string) (string, []interface{}) {
+	if len(paths) == 0 {
+		return "project_path IS NULL", nil
+	}
+	args := make([]interface{}, len(paths))
+	for i, p := range paths {
+		args[i] = p
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(paths)), ", ")
+	return "(project_path IN (" + placeholders + ") OR project_path IS NULL)", args
+}
+
+// ProjectPaths returns the directories that have sessions, most recently
+// used first.
+func (db *DB) ProjectPaths(limit int) ([]string, error) {
+	rows, err := db.conn.Query(`
+		SELECT project_path FROM sessions
+		GROUP BY project_path
+		ORDER BY MAX(updated_at) DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, rows.Err()
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// KnowledgeReport is an overview of what has been learned in some projects,
+// for people to review rather than for the model.
+type KnowledgeReport struct {
+	Entities      int            `json:"entities"`
+	Relations     int            `json:"relations"`
+	Facts         int            `json:"facts"`
+	ErrorPatterns int            `json:"error_patterns"`
+	EntityTypes   map[string]int `json:"entity_types"`
+
+	// TopEntities are the entities seen most often.
+	TopEntities []KnowledgeEntity `json:"top_entities"`
+	// StrongestRelations are the most confident relations, by decayed
+	// confidence.
+	StrongestRelations []ReportRelation `json:"strongest_relations"`
+	// Patterns are the learned error patterns, most used first.
+	Patterns []ErrorPattern `json:"patterns"`
+	// FailingCommands are commands that keep failing.
+	FailingCommands []CommandOutcome `json:"failing_commands"`
+	// StaleFacts have gone unconfirmed for at least confidenceHalfLife and
+	// are the first candidates to correct or delete, least confident first.
+	StaleFacts []KnowledgeFact `json:"stale_facts"`
+}
+
+// ReportRelation is a relation with the entities at either end.
+type ReportRelation struct {
+	Source   KnowledgeEntity   `json:"source"`
+	Relation KnowledgeRelation `json:"relation"`
+	Target   KnowledgeEntity   `json:"target"`
+}
+
+// SuccessRate is the share of uses of an error pattern's fix that worked,
+// or -1 if it has not been tried.
+func (ep ErrorPattern) SuccessRate() float64 {
+	if ep.SuccessCount+ep.FailureCount == 0 {
+		return -1
+	}
+	return float64(ep.SuccessCount) / float64(ep.SuccessCount+ep.FailureCount)
+}
+
+// maxReportRelationScan caps how many relations KnowledgeReport ranks.
+const maxReportRelationScan = 2000
+
+// defaultReportLimit is how many items per section KnowledgeReport lists
+// when given no positive limit.
+const defaultReportLimit = 10
+
+// KnowledgeReport summarizes the knowledge in the given projects (nil
+// paths means every project), listing at most limit items per section.
+func (db *DB) KnowledgeReport(paths []string, limit int) (*KnowledgeReport, error) {
+	if limit <= 0 {
+		limit = defaultReportLimit
+	}
+	where, args := "1=1", []interface{}(nil)
+	if paths != nil {
+		where, args = projectClause(paths)
+	}
+	r := &KnowledgeReport{EntityTypes: make(map[string]int)}
+
+	relationArgs := append(append([]interface{}(nil), args...), args...)
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+		n     *int
+	}{
+		{"SELECT COUNT(*) FROM knowledge_entities WHERE " + where, args, &r.Entities},
+		{"SELECT COUNT(*) FROM knowledge_facts WHERE rejected = 0 AND " + where, args, &r.Facts},
+		{"SELECT COUNT(*) FROM error_patterns WHERE " + where, args, &r.ErrorPatterns},
+		{`SELECT COUNT(*) FROM knowledge_relations WHERE source_id IN (SELECT id FROM knowledge_entities WHERE ` + where + `)
+			AND target_id IN (SELECT id FROM knowledge_entities WHERE ` + where + `)`, relationArgs, &r.Relations},
+	} {
+		if err := db.conn.QueryRow(c.query, c.args...).Scan(c.n); err != nil {
+			return nil, fmt.Errorf("failed to count knowledge: %w", err)
+		}
+	}
+
+	rows, err := db.conn.Query("SELECT type, COUNT(*) FROM knowledge_entities WHERE "+where+" GROUP BY type", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count knowledge: %w", err)
+	}
+	for rows.Next() {
+		var t string
+		var n int
+		if rows.Scan(&t, &n) == nil {
+			r.EntityTypes[t] = n
+		}
+	}
+	rows.Close()
+
+	rows, err = db.conn.Query("SELECT "+entityColumns+" FROM knowledge_entities WHERE "+where+
+		" ORDER BY occurrence_count DESC, last_seen DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top entities: %w", err)
+	}
+	for rows.Next() {
+		e, err := scanEntity(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.TopEntities = append(r.TopEntities, e)
+	}
+	rows.Close()
+
+	if r.StrongestRelations, err = db.strongestRelations(where, relationArgs, limit); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.conn.Query("SELECT "+errorPatternColumns+" FROM error_patterns WHERE "+where+
+		" ORDER BY success_count + failure_count DESC, last_used DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get error patterns: %w", err)
+	}
+	for rows.Next() {
+		ep, err := scanErrorPattern(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Patterns = append(r.Patterns, ep)
+	}
+	rows.Close()
+
+	if r.FailingCommands, err = db.FailingCommands(paths, limit); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.conn.Query("SELECT "+factColumns+" FROM knowledge_facts WHERE rejected = 0 AND last_verified < ? AND "+where,
+		append([]interface{}{time.Now().Add(-confidenceHalfLife)}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stale facts: %w", err)
+	}
+	stale, err := scanFacts(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].Confidence < stale[j].Confidence })
+	if len(stale) > limit {
+		stale = stale[:limit]
+	}
+	r.StaleFacts = stale
+
+	return r, nil
+}
+
+// strongestRelations returns the most confident relations between entities
+// matching where; args are where's arguments twice over.
+func (db *DB) strongestRelations(where string, args []interface{}, limit int) ([]ReportRelation, error) {
+	in := "SELECT id FROM knowledge_entities WHERE " + where
+	rows, err := db.conn.Query(`
+		SELECT id, source_id, relation, target_id, confidence, context, created_at, last_used, use_count
+		FROM knowledge_relations WHERE source_id IN (`+in+`) AND target_id IN (`+in+`)
+		ORDER BY confidence DESC LIMIT ?
+	`, append(append([]interface{}(nil), args...), maxReportRelationScan)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relations: %w", err)
+	}
+	var rels []KnowledgeRelation
+	for rows.Next() {
+		var rel KnowledgeRelation
+		var ctx sql.NullString
+		if err := rows.Scan(&rel.ID, &rel.SourceID, &rel.Relation, &rel.TargetID, &rel.Confidence, &ctx, &rel.CreatedAt, &rel.LastUsed, &rel.UseCount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rel.Context = ctx.String
+		rel.Confidence = decay(rel.Confidence, rel.LastUsed)
+		rels = append(rels, rel)
+	}
+	rows.Close()
+	sort.SliceStable(rels, func(i, j int) bool { return rels[i].Confidence > rels[j].Confidence })
+	if len(rels) > limit {
+		rels = rels[:limit]
+	}
+
+	var ids []int64
+	for _, rel := range rels {
+		ids = append(ids, rel.SourceID, rel.TargetID)
+	}
+	entities, err := db.entitiesByID(ids)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ReportRelation, 0, len(rels))
+	for _, rel := range rels {
+		result = append(result, ReportRelation{Source: entities[rel.SourceID], Relation: rel, Target: entities[rel.TargetID]})
+	}
+	return result, nil
+}
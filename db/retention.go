@@ -0,0 +1,186 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// PruneResult counts what a retention pass removed.
+type PruneResult struct {
+	Sessions      int64
+	Docs          int64
+	Entities      int64
+	Facts         int64
+	Relations     int64
+	ErrorPatterns int64
+	Commands      int64
+	WatchErrors   int64
+	AgentRuns     int64
+	Notes         int64
+	Orphans       int64
+	BytesBefore   int64
+	BytesAfter    int64
+	Vacuumed      bool
+}
+
+// Removed is the total number of rows deleted.
+func (r *PruneResult) Removed() int64 {
+	return r.Sessions + r.Docs + r.Entities + r.Facts + r.Relations + r.ErrorPatterns + r.Commands + r.WatchErrors + r.AgentRuns + r.Notes + r.Orphans
+}
+
+// Reclaimed is how much smaller the database file got.
+func (r *PruneResult) Reclaimed() int64 {
+	if r.BytesAfter >= r.BytesBefore {
+		return 0
+	}
+	return r.BytesBefore - r.BytesAfter
+}
+
+// Size returns the size of the database file in bytes.
+func (db *DB) Size() (int64, error) {
+	var pages, pageSize int64
+	if err := db.conn.QueryRow("PRAGMA page_count").Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := db.conn.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
+
+// Vacuum rebuilds the database file, returning free pages to the OS.
+func (db *DB) Vacuum() error {
+	_, err := db.conn.Exec("VACUUM")
+	return err
+}
+
+// freeFraction is the share of the file that is unused pages.
+func (db *DB) freeFraction() float64 {
+	var pages, free int64
+	db.conn.QueryRow("PRAGMA page_count").Scan(&pages)
+	db.conn.QueryRow("PRAGMA freelist_count").Scan(&free)
+	if pages == 0 {
+		return 0
+	}
+	return float64(free) / float64(pages)
+}
+
+// Prune applies the retention policy: sessions not used within maxAge, and
+// knowledge that was seen rarely and not since the cutoff, are deleted.
+// Expired docs, facts and relations whose confidence has decayed away, and
+// rows orphaned by earlier deletes are always removed.
+// A maxAge of zero keeps sessions and knowledge forever.
+func (db *DB) Prune(maxAge time.Duration) (*PruneResult, error) {
+	result := &PruneResult{}
+	result.BytesBefore, _ = db.Size()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exec := func(count *int64, query string, args ...interface{}) error {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return fmt.Errorf("retention: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		*count += n
+		return nil
+	}
+
+	if maxAge > 0 {
+		cutoff := time.Now().Add(-maxAge)
+		if err := exec(&result.Sessions, "DELETE FROM sessions WHERE updated_at < ?", cutoff); err != nil {
+			return nil, err
+		}
+		// Knowledge that keeps coming up or proved useful is kept however
+		// old it is.
+		if err := exec(&result.Entities, "DELETE FROM knowledge_entities WHERE last_seen < ? AND occurrence_count < 3", cutoff); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.Facts, "DELETE FROM knowledge_facts WHERE last_verified < ? AND verification_count < 2 AND trust < ? AND rejected = 0", cutoff, TrustUser); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.ErrorPatterns, "DELETE FROM error_patterns WHERE last_used < ? AND success_count = 0", cutoff); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.Commands, "DELETE FROM command_outcomes WHERE last_run < ?", cutoff); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.WatchErrors, "DELETE FROM watch_errors WHERE last_seen < ?", cutoff); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.AgentRuns, "DELETE FROM agent_runs WHERE updated_at < ?", cutoff); err != nil {
+			return nil, err
+		}
+		if err := exec(&result.Notes, "DELETE FROM notes WHERE updated_at < ?", cutoff); err != nil {
+			return nil, err
+		}
+	}
+	if err := exec(&result.Docs, "DELETE FROM docs WHERE expires_at < ?", time.Now()); err != nil {
+		return nil, err
+	}
+	if err := pruneDecayed(tx, result); err != nil {
+		return nil, err
+	}
+
+	// Foreign keys are only enforced on connections that enabled them, so
+	// clean up anything a cascade may have missed.
+	for _, query := range []string{
+		"DELETE FROM messages WHERE session_id NOT IN (SELECT id FROM sessions)",
+		"DELETE FROM context_files WHERE session_id NOT IN (SELECT id FROM sessions)",
+		"DELETE FROM tool_calls WHERE message_id NOT IN (SELECT id FROM messages)",
+		"DELETE FROM session_tags WHERE session_id NOT IN (SELECT id FROM sessions)",
+		"DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM session_tags)",
+		"DELETE FROM knowledge_relations WHERE source_id NOT IN (SELECT id FROM knowledge_entities) OR target_id NOT IN (SELECT id FROM knowledge_entities)",
+		"DELETE FROM knowledge_aliases WHERE entity_id NOT IN (SELECT id FROM knowledge_entities)",
+		"DELETE FROM watch_repairs WHERE error_id NOT IN (SELECT id FROM watch_errors)",
+	} {
+		if err := exec(&result.Orphans, query); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	result.BytesAfter, _ = db.Size()
+	return result, nil
+}
+
+// PruneAndVacuum runs Prune and then VACUUM, reporting the size change.
+func (db *DB) PruneAndVacuum(maxAge time.Duration) (*PruneResult, error) {
+	result, err := db.Prune(maxAge)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Vacuum(); err != nil {
+		return result, fmt.Errorf("vacuum failed: %w", err)
+	}
+	result.Vacuumed = true
+	result.BytesAfter, _ = db.Size()
+	return result, nil
+}
+
+// AutoPrune is the startup retention pass. It runs at most once a day and
+// only vacuums when a quarter of the file is free pages, so it stays cheap.
+func (db *DB) AutoPrune(maxAge time.Duration) (*PruneResult, error) {
+	last, _ := db.getMeta("last_prune")
+	if t, err := time.Parse(time.RFC3339, last); err == nil && time.Since(t) < 24*time.Hour {
+		return nil, nil
+	}
+	result, err := db.Prune(maxAge)
+	if err != nil {
+		return nil, err
+	}
+	if db.freeFraction() > 0.25 {
+		if err := db.Vacuum(); err == nil {
+			result.Vacuumed = true
+			result.BytesAfter, _ = db.Size()
+		}
+	}
+	db.setMeta(db.conn, "last_prune", time.Now().Format(time.RFC3339))
+	return result, nil
+}
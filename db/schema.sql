@@ -10,12 +10,15 @@ PRAGMA foreign_keys = ON;
 
 -- Sessions table: Stores conversation sessions
 CREATE TABLE IF NOT EXISTS sessions (
-    id              TEXT PRIMARY KEY,
-    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    project_path    TEXT NOT NULL,
-    title           TEXT,
-    summary         TEXT
+    id                TEXT PRIMARY KEY,
+    created_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    project_path      TEXT NOT NULL,
+    title             TEXT,
+    summary           TEXT,
+    prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost              REAL NOT NULL DEFAULT 0  -- estimated, in USD
 );
 
 -- Messages table: Stores individual messages within sessions
@@ -26,6 +29,8 @@ CREATE TABLE IF NOT EXISTS messages (
     content         TEXT NOT NULL,
     created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     token_count     INTEGER DEFAULT 0,
+    model           TEXT,           -- assistant replies: the model that wrote it
+    latency_ms      INTEGER,        -- assistant replies: time from query to reply
     FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
 );
 
@@ -40,6 +45,23 @@ CREATE TABLE IF NOT EXISTS context_files (
     UNIQUE (session_id, file_path)
 );
 
+-- Tool calls table: Tools run while producing an assistant message, in order
+CREATE TABLE IF NOT EXISTS tool_calls (
+    id              TEXT PRIMARY KEY,
+    session_id      TEXT NOT NULL,
+    message_id      TEXT NOT NULL,
+    seq             INTEGER NOT NULL,
+    call_id         TEXT,
+    name            TEXT NOT NULL,
+    arguments       TEXT NOT NULL,
+    result          TEXT NOT NULL,
+    is_error        INTEGER NOT NULL DEFAULT 0,
+    duration_ms     INTEGER NOT NULL DEFAULT 0,
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
 -- Tags table: Stores tag definitions
 CREATE TABLE IF NOT EXISTS tags (
     id              INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -55,6 +77,12 @@ CREATE TABLE IF NOT EXISTS session_tags (
     FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
 );
 
+-- Database settings, e.g. the key salt and check value when encrypted
+CREATE TABLE IF NOT EXISTS db_meta (
+    key             TEXT PRIMARY KEY,
+    value           TEXT NOT NULL
+);
+
 -- ============================================================================
 -- Full-Text Search (FTS5)
 -- ============================================================================
@@ -66,6 +94,9 @@ CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
     content_rowid='rowid'
 );
 
+-- Terms in the messages index, used to correct misspelled search terms
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts_vocab USING fts5vocab(messages_fts, row);
+
 -- Triggers to keep FTS index synchronized with messages table
 CREATE TRIGGER IF NOT EXISTS messages_ai AFTER INSERT ON messages BEGIN
     INSERT INTO messages_fts(rowid, content) VALUES (NEW.rowid, NEW.content);
@@ -99,6 +130,9 @@ CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(session_id, creat
 -- Context files lookup by session
 CREATE INDEX IF NOT EXISTS idx_context_files_session_id ON context_files(session_id);
 
+-- Tool calls lookup by session, in call order
+CREATE INDEX IF NOT EXISTS idx_tool_calls_session ON tool_calls(session_id, message_id, seq);
+
 -- Tag name lookup
 CREATE INDEX IF NOT EXISTS idx_tags_name ON tags(name);
 
@@ -134,6 +168,9 @@ CREATE VIRTUAL TABLE IF NOT EXISTS docs_fts USING fts5(
     content_rowid='id'
 );
 
+-- Terms in the docs index, used to correct misspelled search terms
+CREATE VIRTUAL TABLE IF NOT EXISTS docs_fts_vocab USING fts5vocab(docs_fts, row);
+
 -- Triggers to keep docs FTS index synchronized
 CREATE TRIGGER IF NOT EXISTS docs_ai AFTER INSERT ON docs BEGIN
     INSERT INTO docs_fts(rowid, name, content, summary) VALUES (NEW.id, NEW.name, NEW.content, NEW.summary);
@@ -167,6 +204,11 @@ CREATE TABLE IF NOT EXISTS knowledge_entities (
     first_seen      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     last_seen       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     occurrence_count INTEGER DEFAULT 1,
+    source          TEXT,           -- tool or command that recorded it
+    session_id      TEXT,           -- session it was learned in
+    model           TEXT,           -- model that asserted it
+    trust           INTEGER NOT NULL DEFAULT 1,  -- 1 ai-asserted, 2 verified by a command, 3 from the user
+    project_dir     TEXT,           -- directory stored under before project keys
     UNIQUE (type, name, project_path)
 );
 
@@ -186,6 +228,16 @@ CREATE TABLE IF NOT EXISTS knowledge_relations (
     UNIQUE (source_id, relation, target_id)
 );
 
+-- Knowledge aliases: other names an entity goes by, e.g. "postgresql" for
+-- "postgres". Looking an entity up by an alias finds the entity.
+CREATE TABLE IF NOT EXISTS knowledge_aliases (
+    alias           TEXT NOT NULL,  -- lowercased
+    entity_id       INTEGER NOT NULL,
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (entity_id) REFERENCES knowledge_entities(id) ON DELETE CASCADE,
+    PRIMARY KEY (alias, entity_id)
+);
+
 -- Knowledge facts: standalone learned facts about the environment
 CREATE TABLE IF NOT EXISTS knowledge_facts (
     id              INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -199,6 +251,11 @@ CREATE TABLE IF NOT EXISTS knowledge_facts (
     created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     last_verified   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     verification_count INTEGER DEFAULT 1,
+    session_id      TEXT,           -- session it was learned in
+    model           TEXT,           -- model that asserted it
+    trust           INTEGER NOT NULL DEFAULT 1,  -- 1 ai-asserted, 2 verified by a command, 3 from the user
+    rejected        INTEGER NOT NULL DEFAULT 0,  -- 1 when the user rejected it; kept so it is not learned again
+    project_dir     TEXT,           -- directory stored under before project keys
     UNIQUE (category, subject, predicate, project_path)
 );
 
@@ -216,9 +273,119 @@ CREATE TABLE IF NOT EXISTS error_patterns (
     project_path    TEXT,           -- NULL = global pattern
     created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
     last_used       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    project_dir     TEXT,           -- directory stored under before project keys
     UNIQUE (error_signature, project_path)
 );
 
+-- Command outcomes: how commands q ran went in each project, so ones that
+-- keep failing are not suggested again
+CREATE TABLE IF NOT EXISTS command_outcomes (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    command         TEXT NOT NULL,  -- encrypted when enabled
+    project_path    TEXT,           -- project key of the directory it ran in
+    success_count   INTEGER NOT NULL DEFAULT 0,
+    failure_count   INTEGER NOT NULL DEFAULT 0,
+    last_exit_code  INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT,           -- end of the output of the last failure; encrypted when enabled
+    last_cwd        TEXT,
+    last_run        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (command, project_path)
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_outcomes_project ON command_outcomes(project_path);
+
+-- Watch history: errors watch mode found and the repairs it tried, kept
+-- across sessions. An error that keeps coming back is one row until it is
+-- resolved.
+CREATE TABLE IF NOT EXISTS watch_errors (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_path    TEXT,
+    target          TEXT,           -- part of a monorepo; NULL for the whole project
+    error_type      TEXT NOT NULL,
+    language        TEXT,
+    file            TEXT,
+    line            INTEGER NOT NULL DEFAULT 0,
+    message         TEXT NOT NULL,  -- encrypted when enabled
+    signature       TEXT NOT NULL,  -- normalized message, to match occurrences
+    occurrences     INTEGER NOT NULL DEFAULT 1,
+    detected_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at     DATETIME        -- when a build of the target no longer had it
+);
+
+CREATE TABLE IF NOT EXISTS watch_repairs (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    error_id        INTEGER NOT NULL,
+    pattern_id      INTEGER,        -- learned error pattern whose fix was run
+    success         INTEGER NOT NULL DEFAULT 0,  -- the fix ran without failing
+    fixed           INTEGER,        -- the next build no longer had the error; NULL until then
+    solution        TEXT,
+    command         TEXT,
+    diff            TEXT,           -- encrypted when enabled
+    duration_ms     INTEGER NOT NULL DEFAULT 0,
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (error_id) REFERENCES watch_errors(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_watch_errors_project ON watch_errors(project_path, detected_at);
+CREATE INDEX IF NOT EXISTS idx_watch_repairs_error ON watch_repairs(error_id);
+
+-- Agent runs: sub-agents' tasks, transcripts and results, kept so long
+-- research outlives the session that started it. updated_at is touched
+-- after every round, so a run still "running" long after it was last
+-- touched was cut off with its process.
+CREATE TABLE IF NOT EXISTS agent_runs (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    agent_id        TEXT NOT NULL,  -- its ID in the session, e.g. agent_2
+    project_path    TEXT,
+    role            TEXT NOT NULL,
+    model           TEXT NOT NULL,
+    tools           TEXT,           -- JSON list of tools spawn_agent limited it to; NULL for no limit
+    task            TEXT NOT NULL,  -- encrypted when enabled
+    status          TEXT NOT NULL,  -- running, completed, failed, cancelled or interrupted
+    result          TEXT,           -- encrypted when enabled
+    error           TEXT,
+    transcript      TEXT,           -- JSON messages; encrypted when enabled
+    tokens          INTEGER NOT NULL DEFAULT 0,
+    iterations      INTEGER NOT NULL DEFAULT 0,
+    started_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at        DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_runs_project ON agent_runs(project_path, started_at);
+
+-- Notes: a scratchpad the model and its sub-agents share while they work,
+-- so parallel agents can pass findings to each other.
+CREATE TABLE IF NOT EXISTS notes (
+    scope           TEXT NOT NULL,  -- the session, or the process when there is none
+    key             TEXT NOT NULL,
+    content         TEXT NOT NULL,  -- encrypted when enabled
+    author          TEXT NOT NULL,  -- main, or the agent that last wrote it
+    updated_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
+
+-- Knowledge embeddings: vectors of entities and facts, for finding them by
+-- meaning when no words match. text is what was embedded, so a changed
+-- entity or fact is embedded again.
+CREATE TABLE IF NOT EXISTS knowledge_embeddings (
+    kind            TEXT NOT NULL,  -- 'entity' or 'fact'
+    item_id         INTEGER NOT NULL,
+    model           TEXT NOT NULL,  -- embedding model; vectors of different models do not compare
+    text            TEXT NOT NULL,
+    vector          BLOB NOT NULL,  -- little-endian float32s
+    PRIMARY KEY (kind, item_id)
+);
+
+CREATE TRIGGER IF NOT EXISTS knowledge_entities_embedding_ad AFTER DELETE ON knowledge_entities BEGIN
+    DELETE FROM knowledge_embeddings WHERE kind = 'entity' AND item_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS knowledge_facts_embedding_ad AFTER DELETE ON knowledge_facts BEGIN
+    DELETE FROM knowledge_embeddings WHERE kind = 'fact' AND item_id = OLD.id;
+END;
+
 -- Knowledge graph FTS for semantic search
 CREATE VIRTUAL TABLE IF NOT EXISTS knowledge_fts USING fts5(
     name,
@@ -227,6 +394,9 @@ CREATE VIRTUAL TABLE IF NOT EXISTS knowledge_fts USING fts5(
     content_rowid='id'
 );
 
+-- Terms in the knowledge index, used to correct misspelled search terms
+CREATE VIRTUAL TABLE IF NOT EXISTS knowledge_fts_vocab USING fts5vocab(knowledge_fts, row);
+
 -- Triggers for knowledge_entities FTS
 CREATE TRIGGER IF NOT EXISTS knowledge_entities_ai AFTER INSERT ON knowledge_entities BEGIN
     INSERT INTO knowledge_fts(rowid, name, value) VALUES (NEW.id, NEW.name, NEW.value);
@@ -248,6 +418,7 @@ CREATE INDEX IF NOT EXISTS idx_ke_name ON knowledge_entities(name);
 CREATE INDEX IF NOT EXISTS idx_kr_source ON knowledge_relations(source_id);
 CREATE INDEX IF NOT EXISTS idx_kr_target ON knowledge_relations(target_id);
 CREATE INDEX IF NOT EXISTS idx_kr_relation ON knowledge_relations(relation);
+CREATE INDEX IF NOT EXISTS idx_ka_entity ON knowledge_aliases(entity_id);
 CREATE INDEX IF NOT EXISTS idx_kf_category ON knowledge_facts(category);
 CREATE INDEX IF NOT EXISTS idx_kf_subject ON knowledge_facts(subject);
 CREATE INDEX IF NOT EXISTS idx_kf_project ON knowledge_facts(project_path);
@@ -255,6 +426,49 @@ CREATE INDEX IF NOT EXISTS idx_ep_signature ON error_patterns(error_signature);
 CREATE INDEX IF NOT EXISTS idx_ep_type ON error_patterns(error_type);
 CREATE INDEX IF NOT EXISTS idx_ep_language ON error_patterns(language);
 
+-- ============================================================================
+-- Host Inventory
+-- ============================================================================
+
+-- Remote hosts known by name; groups and tags are comma-separated lists
+CREATE TABLE IF NOT EXISTS hosts (
+    name            TEXT PRIMARY KEY,
+    address         TEXT NOT NULL,
+    user            TEXT,
+    port            INTEGER,
+    key_path        TEXT,
+    host_groups     TEXT NOT NULL DEFAULT '',
+    tags            TEXT NOT NULL DEFAULT '',
+    description     TEXT,
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Devices seen on the LAN, for Wake-on-LAN by name
+CREATE TABLE IF NOT EXISTS known_devices (
+    mac             TEXT PRIMARY KEY,
+    ip              TEXT,
+    name            TEXT,
+    source          TEXT,
+    last_seen       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_known_devices_ip ON known_devices(ip);
+
+-- ============================================================================
+-- Pinned Memories
+-- ============================================================================
+
+-- Facts the user asked to remember; a NULL project_path applies everywhere
+CREATE TABLE IF NOT EXISTS memories (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_path    TEXT,
+    content         TEXT NOT NULL,
+    created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_memories_project ON memories(project_path);
+
 -- ============================================================================
 -- Trigger for updated_at
 -- ============================================================================
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TableStat is the size of one table, including its indexes.
+type TableStat struct {
+	Name  string
+	Rows  int64
+	Bytes int64
+}
+
+// SessionSize is a session ranked by how much message text it holds.
+type SessionSize struct {
+	ID       string
+	Title    string
+	Messages int64
+	Bytes    int64
+}
+
+// Stats describes what is in the database and how much space it uses.
+type Stats struct {
+	Path            string
+	Size            int64 // main file, from the page count
+	WALSize         int64 // write-ahead log not yet checkpointed
+	Pages           int64
+	FreePages       int64
+	FTSBytes        int64 // all full-text index tables
+	Encrypted       bool
+	Tables          []TableStat
+	LargestSessions []SessionSize
+}
+
+// Fragmentation is the share of the file that VACUUM would reclaim.
+func (s *Stats) Fragmentation() float64 {
+	if s.Pages == 0 {
+		return 0
+	}
+	return float64(s.FreePages) / float64(s.Pages)
+}
+
+// Path returns the database file path.
+func (db *DB) Path() string {
+	var seq int
+	var name, file string
+	db.conn.QueryRow("PRAGMA database_list").Scan(&seq, &name, &file)
+	return file
+}
+
+// Stats gathers size and row counts. Row counts come from COUNT(*), so this
+// reads every table once.
+func (db *DB) Stats() (*Stats, error) {
+	db.Flush()
+	stats := &Stats{Path: db.Path(), Encrypted: db.Encrypted()}
+	var err error
+	if stats.Size, err = db.Size(); err != nil {
+		return nil, err
+	}
+	db.conn.QueryRow("PRAGMA page_count").Scan(&stats.Pages)
+	db.conn.QueryRow("PRAGMA freelist_count").Scan(&stats.FreePages)
+	if info, err := os.Stat(stats.Path + "-wal"); err == nil {
+		stats.WALSize = info.Size()
+	}
+
+	// dbstat attributes index pages to the index name; map them back to
+	// their table.
+	owner := make(map[string]string)
+	rows, err := db.conn.Query("SELECT name, tbl_name FROM sqlite_master WHERE type IN ('table', 'index')")
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var name, table string
+		if err := rows.Scan(&name, &table); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		owner[name] = table
+		if name == table && !strings.HasPrefix(name, "sqlite_") && !strings.Contains(name, "_fts") {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+
+	bytes := make(map[string]int64)
+	rows, err = db.conn.Query("SELECT name, SUM(pgsize) FROM dbstat GROUP BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page stats: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if strings.Contains(name, "_fts") {
+			stats.FTSBytes += size
+			continue
+		}
+		if table, ok := owner[name]; ok {
+			name = table
+		}
+		bytes[name] += size
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		t := TableStat{Name: table, Bytes: bytes[table]}
+		if err := db.conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %q", table)).Scan(&t.Rows); err != nil {
+			return nil, err
+		}
+		stats.Tables = append(stats.Tables, t)
+	}
+
+	rows, err = db.conn.Query(`
+		SELECT s.id, s.title, COUNT(m.id), COALESCE(SUM(LENGTH(m.content)), 0) AS bytes
+		FROM sessions s
+		JOIN messages m ON m.session_id = s.id
+		GROUP BY s.id
+		ORDER BY bytes DESC
+		LIMIT 5
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s SessionSize
+		var title *string
+		if err := rows.Scan(&s.ID, &title, &s.Messages, &s.Bytes); err != nil {
+			return nil, err
+		}
+		if title != nil {
+			s.Title = db.unseal(*title)
+		}
+		stats.LargestSessions = append(stats.LargestSessions, s)
+	}
+	return stats, nil
+}
+
+// Verify runs SQLite's integrity and foreign key checks and the full-text
+// index checks. It returns the problems found; none means healthy.
+func (db *DB) Verify() ([]string, error) {
+	db.Flush()
+	var problems []string
+
+	rows, err := db.conn.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.conn.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var table, parent string
+		var rowid, fkid interface{}
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		problems = append(problems, fmt.Sprintf("%s row %v points at a missing %s row", table, rowid, parent))
+	}
+	rows.Close()
+
+	for _, fts := range []string{"messages_fts", "docs_fts", "knowledge_fts"} {
+		if _, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %s(%s) VALUES('integrity-check')", fts, fts)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v (fix with q db vacuum --rebuild-index)", fts, err))
+		}
+	}
+	return problems, nil
+}
+
+// RebuildSearchIndexes regenerates the full-text indexes from their tables.
+func (db *DB) RebuildSearchIndexes() error {
+	for _, fts := range []string{"messages_fts", "docs_fts", "knowledge_fts"} {
+		if _, err := db.conn.Exec(fmt.Sprintf("INSERT INTO %s(%s) VALUES('rebuild')", fts, fts)); err != nil {
+			return fmt.Errorf("failed to rebuild %s: %w", fts, err)
+		}
+	}
+	return nil
+}
+
+// Checkpoint folds the write-ahead log back into the main file.
+func (db *DB) Checkpoint() error {
+	_, err := db.conn.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
@@ -0,0 +1,314 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SyncVersion is bumped when the sync bundle layout changes.
+const SyncVersion = 1
+
+// SyncBundle is everything `q sync` shares between machines: sessions and
+// the knowledge graph. Knowledge rows have local integer IDs, so they are
+// matched on their natural keys instead.
+type SyncBundle struct {
+	Version       int               `json:"version"`
+	Machine       string            `json:"machine"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Sessions      []SessionExport   `json:"sessions"`
+	Entities      []KnowledgeEntity `json:"entities"`
+	Relations     []SyncRelation    `json:"relations"`
+	Facts         []KnowledgeFact   `json:"facts"`
+	ErrorPatterns []ErrorPattern    `json:"error_patterns"`
+}
+
+// EntityKey identifies a knowledge entity across databases.
+type EntityKey struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	ProjectPath string `json:"project_path,omitempty"`
+}
+
+// SyncRelation is a knowledge relation with its ends given by key.
+type SyncRelation struct {
+	Source     EntityKey `json:"source"`
+	Relation   string    `json:"relation"`
+	Target     EntityKey `json:"target"`
+	Confidence float64   `json:"confidence"`
+	Context    string    `json:"context,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsed   time.Time `json:"last_used"`
+	UseCount   int       `json:"use_count"`
+}
+
+// sealedBundle is a sync file sealed with a key derived from the database
+// passphrase and a salt of its own, so that any machine with the same
+// passphrase can open it whatever its database's salt.
+type sealedBundle struct {
+	Sealed string `json:"sealed"`
+	Salt   string `json:"salt"`
+}
+
+// EncodeBundle serializes bundle for the sync remote, sealing it with the
+// database passphrase when seal is set.
+func EncodeBundle(bundle *SyncBundle, seal bool) ([]byte, error) {
+	data, err := json.Marshal(bundle)
+	if err != nil || !seal {
+		return data, err
+	}
+	passphrase, _ := findKey()
+	if passphrase == "" {
+		return nil, fmt.Errorf("no passphrase to encrypt the sync file with; set %s", KeyEnvVar)
+	}
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	encodedSalt := base64.StdEncoding.EncodeToString(salt)
+	aead, err := keyFromSalt(passphrase, encodedSalt)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealedBundle{Sealed: sealWith(aead, string(data)), Salt: encodedSalt})
+}
+
+// DecodeBundle parses a sync file, opening it with the database passphrase
+// if it is sealed, and reports whether it was.
+func DecodeBundle(data []byte) (*SyncBundle, bool, error) {
+	var sealed sealedBundle
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, false, err
+	}
+	if sealed.Sealed != "" {
+		passphrase, _ := findKey()
+		if passphrase == "" {
+			return nil, true, fmt.Errorf("the sync file is encrypted; set %s to the passphrase of the machines that wrote it", KeyEnvVar)
+		}
+		aead, err := keyFromSalt(passphrase, sealed.Salt)
+		if err != nil {
+			return nil, true, err
+		}
+		plain, err := openWith(aead, sealed.Sealed)
+		if err != nil {
+			return nil, true, fmt.Errorf("cannot decrypt the sync file; every machine needs the same %s", KeyEnvVar)
+		}
+		data = []byte(plain)
+	}
+	var bundle SyncBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, sealed.Sealed != "", err
+	}
+	return &bundle, sealed.Sealed != "", nil
+}
+
+// MergeResult counts what a merge changed locally.
+type MergeResult struct {
+	SessionsAdded   int
+	SessionsUpdated int
+	Knowledge       int
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// ExportBundle collects all sessions and knowledge for syncing.
+func (db *DB) ExportBundle(machine string) (*SyncBundle, error) {
+	db.Flush()
+	bundle := &SyncBundle{Version: SyncVersion, Machine: machine, UpdatedAt: time.Now()}
+
+	rows, err := db.conn.Query("SELECT id FROM sessions ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		export, err := db.ExportSession(id)
+		if err != nil {
+			return nil, err
+		}
+		bundle.Sessions = append(bundle.Sessions, *export)
+	}
+
+	pack, err := db.collectKnowledge(nil)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Entities, bundle.Relations = pack.Entities, pack.Relations
+	bundle.Facts, bundle.ErrorPatterns = pack.Facts, pack.ErrorPatterns
+	return bundle, nil
+}
+
+// MergeBundle merges another machine's bundle into this database. The most
+// recently updated copy of each session or knowledge row wins; counters take
+// the larger value. Sessions last updated before since are skipped so
+// retention pruning is not undone.
+func (db *DB) MergeBundle(bundle *SyncBundle, since time.Time) (*MergeResult, error) {
+	if bundle.Version > SyncVersion {
+		return nil, fmt.Errorf("sync data version %d is newer than this q supports (%d)", bundle.Version, SyncVersion)
+	}
+	db.Flush()
+	result := &MergeResult{}
+
+	for i := range bundle.Sessions {
+		s := &bundle.Sessions[i]
+		if s.UpdatedAt.Before(since) {
+			continue
+		}
+		var local time.Time
+		err := db.conn.QueryRow("SELECT updated_at FROM sessions WHERE id = ?", s.ID).Scan(&local)
+		switch {
+		case err == sql.ErrNoRows:
+			if err := db.ImportSession(s, "", false); err != nil {
+				return result, err
+			}
+			result.SessionsAdded++
+		case err != nil:
+			return result, err
+		case s.UpdatedAt.After(local):
+			if err := db.ImportSession(s, "", true); err != nil {
+				return result, err
+			}
+			result.SessionsUpdated++
+		}
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	entityID := func(k EntityKey) (int64, time.Time, error) {
+		var id int64
+		var lastSeen time.Time
+		err := tx.QueryRow("SELECT id, last_seen FROM knowledge_entities WHERE type = ? AND name = ? AND project_path IS ?",
+			k.Type, k.Name, nullIfEmpty(k.ProjectPath)).Scan(&id, &lastSeen)
+		if err == sql.ErrNoRows {
+			return 0, lastSeen, nil
+		}
+		return id, lastSeen, err
+	}
+	count := func(res sql.Result, err error) error {
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Knowledge++
+		}
+		return nil
+	}
+
+	for _, e := range bundle.Entities {
+		id, lastSeen, err := entityID(EntityKey{e.Type, e.Name, e.ProjectPath})
+		if err != nil {
+			return result, err
+		}
+		if id == 0 {
+			err = count(tx.Exec(`INSERT INTO knowledge_entities (type, name, value, project_path, first_seen, last_seen, occurrence_count, source, session_id, model, trust)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				e.Type, e.Name, nullIfEmpty(e.Value), nullIfEmpty(e.ProjectPath), e.FirstSeen, e.LastSeen, e.OccurrenceCount,
+				nullIfEmpty(e.Source), nullIfEmpty(e.SessionID), nullIfEmpty(e.Model), e.Trust.imported()))
+		} else if e.LastSeen.After(lastSeen) {
+			err = count(tx.Exec(`UPDATE knowledge_entities SET value = COALESCE(?, value), last_seen = ?,
+				occurrence_count = MAX(occurrence_count, ?), source = COALESCE(?, source), session_id = COALESCE(?, session_id),
+				model = COALESCE(?, model), trust = MAX(trust, ?) WHERE id = ?`,
+				nullIfEmpty(e.Value), e.LastSeen, e.OccurrenceCount,
+				nullIfEmpty(e.Source), nullIfEmpty(e.SessionID), nullIfEmpty(e.Model), e.Trust.imported(), id))
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to merge entity: %w", err)
+		}
+	}
+
+	for _, r := range bundle.Relations {
+		source, _, err := entityID(r.Source)
+		if err != nil {
+			return result, err
+		}
+		target, _, err := entityID(r.Target)
+		if err != nil {
+			return result, err
+		}
+		if source == 0 || target == 0 {
+			continue
+		}
+		var id int64
+		var lastUsed time.Time
+		err = tx.QueryRow("SELECT id, last_used FROM knowledge_relations WHERE source_id = ? AND relation = ? AND target_id = ?",
+			source, r.Relation, target).Scan(&id, &lastUsed)
+		switch {
+		case err == sql.ErrNoRows:
+			err = count(tx.Exec(`INSERT INTO knowledge_relations (source_id, relation, target_id, confidence, context, created_at, last_used, use_count)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				source, r.Relation, target, r.Confidence, nullIfEmpty(r.Context), r.CreatedAt, r.LastUsed, r.UseCount))
+		case err == nil && r.LastUsed.After(lastUsed):
+			err = count(tx.Exec(`UPDATE knowledge_relations SET confidence = ?, context = COALESCE(?, context), last_used = ?,
+				use_count = MAX(use_count, ?) WHERE id = ?`,
+				r.Confidence, nullIfEmpty(r.Context), r.LastUsed, r.UseCount, id))
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to merge relation: %w", err)
+		}
+	}
+
+	for _, f := range bundle.Facts {
+		var id int64
+		var lastVerified time.Time
+		err := tx.QueryRow("SELECT id, last_verified FROM knowledge_facts WHERE category = ? AND subject = ? AND predicate = ? AND project_path IS ?",
+			f.Category, f.Subject, f.Predicate, nullIfEmpty(f.ProjectPath)).Scan(&id, &lastVerified)
+		switch {
+		case err == sql.ErrNoRows:
+			err = count(tx.Exec(`INSERT INTO knowledge_facts (category, subject, predicate, object, project_path, confidence, source, created_at, last_verified, verification_count, session_id, model, trust)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				f.Category, f.Subject, f.Predicate, f.Object, nullIfEmpty(f.ProjectPath), f.Confidence, nullIfEmpty(f.Source), f.CreatedAt, f.LastVerified, f.VerificationCount,
+				nullIfEmpty(f.SessionID), nullIfEmpty(f.Model), f.Trust.imported()))
+		case err == nil && f.LastVerified.After(lastVerified):
+			err = count(tx.Exec(`UPDATE knowledge_facts SET object = ?, confidence = ?, last_verified = ?,
+				verification_count = MAX(verification_count, ?), source = ?, session_id = ?, model = ?, trust = ? WHERE id = ?`,
+				f.Object, f.Confidence, f.LastVerified, f.VerificationCount,
+				nullIfEmpty(f.Source), nullIfEmpty(f.SessionID), nullIfEmpty(f.Model), f.Trust.imported(), id))
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to merge fact: %w", err)
+		}
+	}
+
+	for _, p := range bundle.ErrorPatterns {
+		var id int64
+		var lastUsed time.Time
+		err := tx.QueryRow("SELECT id, last_used FROM error_patterns WHERE error_signature = ? AND project_path IS ?",
+			p.ErrorSignature, nullIfEmpty(p.ProjectPath)).Scan(&id, &lastUsed)
+		switch {
+		case err == sql.ErrNoRows:
+			err = count(tx.Exec(`INSERT INTO error_patterns (error_signature, error_type, language, root_cause, solution, solution_command, success_count, failure_count, project_path, created_at, last_used)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				p.ErrorSignature, p.ErrorType, nullIfEmpty(p.Language), nullIfEmpty(p.RootCause), nullIfEmpty(p.Solution), nullIfEmpty(p.SolutionCommand),
+				p.SuccessCount, p.FailureCount, nullIfEmpty(p.ProjectPath), p.CreatedAt, p.LastUsed))
+		case err == nil && p.LastUsed.After(lastUsed):
+			err = count(tx.Exec(`UPDATE error_patterns SET root_cause = COALESCE(?, root_cause), solution = COALESCE(?, solution),
+				solution_command = COALESCE(?, solution_command), success_count = MAX(success_count, ?),
+				failure_count = MAX(failure_count, ?), last_used = ? WHERE id = ?`,
+				nullIfEmpty(p.RootCause), nullIfEmpty(p.Solution), nullIfEmpty(p.SolutionCommand), p.SuccessCount, p.FailureCount, p.LastUsed, id))
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to merge error pattern: %w", err)
+		}
+	}
+
+	return result, tx.Commit()
+}
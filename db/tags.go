@@ -0,0 +1,133 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tagKeywords suggests a tag when any of its words shows up in a session.
+var tagKeywords = map[string][]string{
+	"docker":     {"docker", "dockerfile", "container", "compose"},
+	"kubernetes": {"kubectl", "kubernetes", "k8s", "helm", "pod"},
+	"git":        {"git", "commit", "rebase", "merge", "branch"},
+	"database":   {"sql", "postgres", "mysql", "sqlite", "query", "migration"},
+	"ssh":        {"ssh", "scp", "remote"},
+	"network":    {"dns", "ping", "port", "firewall", "curl"},
+	"debugging":  {"error", "panic", "traceback", "exception", "crash", "fails"},
+	"testing":    {"test", "tests", "coverage"},
+	"deploy":     {"deploy", "deployment", "release", "rollback"},
+	"refactor":   {"refactor", "rename", "cleanup"},
+	"ci":         {"pipeline", "workflow", "actions", "jenkins"},
+}
+
+// NormalizeTag lowercases a tag and joins its words with dashes.
+func NormalizeTag(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
+
+// UntagSession removes a tag from a session. It reports false if the
+// session did not have the tag.
+func (db *DB) UntagSession(sessionID, tagName string) (bool, error) {
+	result, err := db.conn.Exec(
+		"DELETE FROM session_tags WHERE session_id = ? AND tag_id = (SELECT id FROM tags WHERE name = ?)",
+		sessionID, NormalizeTag(tagName),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to untag session: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// TagCount is a tag and how many sessions carry it.
+type TagCount struct {
+	Name     string `json:"name"`
+	Sessions int    `json:"sessions"`
+}
+
+// ListTags returns tags in use, most used first.
+func (db *DB) ListTags() ([]TagCount, error) {
+	rows, err := db.conn.Query(`
+		SELECT t.name, COUNT(st.session_id) AS n
+		FROM tags t
+		JOIN session_tags st ON st.tag_id = t.id
+		GROUP BY t.id
+		ORDER BY n DESC, t.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []TagCount
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.Name, &t.Sessions); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// SuggestTags proposes tags for a session from the words in its messages.
+// Tags already used on other sessions are preferred when they appear, so
+// suggestions follow the user's own vocabulary; the built-in keyword list
+// fills in the rest. Tags the session already has are left out.
+func (db *DB) SuggestTags(sessionID string, limit int) ([]string, error) {
+	messages, err := db.GetMessages(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	words := make(map[string]int)
+	for _, m := range messages {
+		for _, w := range strings.FieldsFunc(strings.ToLower(m.Content), func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+		}) {
+			words[w]++
+		}
+	}
+
+	applied := make(map[string]bool)
+	current, err := db.GetSessionTags(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range current {
+		applied[t.Name] = true
+	}
+
+	scores := make(map[string]int)
+	existing, err := db.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range existing {
+		if n := words[t.Name]; n > 0 {
+			scores[t.Name] += 2 * n
+		}
+	}
+	for tag, keywords := range tagKeywords {
+		for _, k := range keywords {
+			scores[tag] += words[k]
+		}
+	}
+
+	var suggestions []string
+	for tag, score := range scores {
+		if score >= 2 && !applied[tag] {
+			suggestions = append(suggestions, tag)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if scores[suggestions[i]] != scores[suggestions[j]] {
+			return scores[suggestions[i]] > scores[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
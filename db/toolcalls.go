@@ -0,0 +1,55 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// maxStoredResult caps how much of a tool's output is kept. Results such as
+// whole files or long command output are cut, with a note saying so.
+const maxStoredResult = 64 << 10
+
+const insertToolCall = "INSERT INTO tool_calls (id, session_id, message_id, seq, call_id, name, arguments, result, is_error, duration_ms, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+func truncateResult(result string) string {
+	if len(result) <= maxStoredResult {
+		return result
+	}
+	return result[:maxStoredResult] + fmt.Sprintf("\n[truncated; %d bytes in total]", len(result))
+}
+
+func (db *DB) toolCallArgs(tc ToolCall) []interface{} {
+	return []interface{}{
+		tc.ID, tc.SessionID, tc.MessageID, tc.Seq, nullIfEmpty(tc.CallID), tc.Name,
+		db.seal(tc.Arguments), db.seal(truncateResult(tc.Result)), tc.IsError, tc.DurationMS, tc.CreatedAt,
+	}
+}
+
+// GetToolCalls returns a session's tool calls, grouped by the message they
+// led to and in the order they ran.
+func (db *DB) GetToolCalls(sessionID string) ([]ToolCall, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, session_id, message_id, seq, call_id, name, arguments, result, is_error, duration_ms, created_at
+		FROM tool_calls
+		WHERE session_id = ?
+		ORDER BY message_id, seq
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool calls: %w", err)
+	}
+	defer rows.Close()
+
+	var calls []ToolCall
+	for rows.Next() {
+		var tc ToolCall
+		var callID sql.NullString
+		if err := rows.Scan(&tc.ID, &tc.SessionID, &tc.MessageID, &tc.Seq, &callID, &tc.Name, &tc.Arguments, &tc.Result, &tc.IsError, &tc.DurationMS, &tc.CreatedAt); err != nil {
+			return nil, err
+		}
+		tc.CallID = callID.String
+		tc.Arguments = db.unseal(tc.Arguments)
+		tc.Result = db.unseal(tc.Result)
+		calls = append(calls, tc)
+	}
+	return calls, rows.Err()
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxTraversalHops bounds TraverseKnowledge; past a few hops everything is
+// connected to everything.
+const maxTraversalHops = 4
+
+// defaultTraversalLimit is how many entities TraverseKnowledge returns when
+// given no positive limit.
+const defaultTraversalLimit = 20
+
+// TraversalStep is one relation followed from the previous entity on a path.
+type TraversalStep struct {
+	Relation KnowledgeRelation `json:"relation"`
+	Entity   KnowledgeEntity   `json:"entity"`
+	// Incoming is set when the relation points from Entity back to the
+	// previous entity rather than away from it.
+	Incoming bool `json:"incoming,omitempty"`
+}
+
+// KnowledgePath is the shortest path found from the start entity to
+// another; the last step's entity is the one reached.
+type KnowledgePath struct {
+	Steps []TraversalStep `json:"steps"`
+	// Confidence is the product of the relations' decayed confidences.
+	Confidence float64 `json:"confidence"`
+}
+
+// Reached is the entity the path leads to.
+func (p KnowledgePath) Reached() KnowledgeEntity {
+	return p.Steps[len(p.Steps)-1].Entity
+}
+
+// TraverseKnowledge walks relations in both directions from an entity,
+// breadth first, up to maxHops away, following only the given relation
+// types when any are given. It returns the shortest path to each entity
+// reached, nearest and most confident first, at most limit of them.
+func (db *DB) TraverseKnowledge(startID int64, maxHops int, relations []string, limit int) ([]KnowledgePath, error) {
+	maxHops = min(max(maxHops, 1), maxTraversalHops)
+	if limit <= 0 {
+		limit = defaultTraversalLimit
+	}
+
+	paths := map[int64]KnowledgePath{startID: {Confidence: 1}}
+	var reached []int64
+	frontier := []int64{startID}
+	for hop := 0; hop < maxHops && len(frontier) > 0 && len(reached) < limit; hop++ {
+		rels, err := db.relationsTouching(frontier, relations)
+		if err != nil {
+			return nil, err
+		}
+
+		var next []int64
+		for _, r := range rels {
+			for _, end := range []struct {
+				from, to int64
+				incoming bool
+			}{{r.SourceID, r.TargetID, false}, {r.TargetID, r.SourceID, true}} {
+				from, ok := paths[end.from]
+				if !ok || len(from.Steps) != hop {
+					continue
+				}
+				if _, seen := paths[end.to]; seen {
+					continue
+				}
+				steps := append(append([]TraversalStep(nil), from.Steps...), TraversalStep{
+					Relation: r,
+					Entity:   KnowledgeEntity{ID: end.to},
+					Incoming: end.incoming,
+				})
+				paths[end.to] = KnowledgePath{Steps: steps, Confidence: from.Confidence * r.Confidence}
+				next = append(next, end.to)
+			}
+		}
+
+		entities, err := db.entitiesByID(next)
+		if err != nil {
+			return nil, err
+		}
+		// Paths found on the next hop copy these steps, entities and all.
+		for _, id := range next {
+			if e, ok := entities[id]; ok {
+				paths[id].Steps[hop].Entity = e
+			}
+		}
+		reached = append(reached, next...)
+		frontier = next
+	}
+
+	result := make([]KnowledgePath, 0, len(reached))
+	for _, id := range reached {
+		result = append(result, paths[id])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if len(a.Steps) != len(b.Steps) {
+			return len(a.Steps) < len(b.Steps)
+		}
+		return a.Confidence > b.Confidence
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// relationsTouching returns the relations into or out of any of ids, with
+// decayed confidences, strongest first.
+func (db *DB) relationsTouching(ids []int64, relations []string) ([]KnowledgeRelation, error) {
+	in := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	query := fmt.Sprintf(`
+		SELECT id, source_id, relation, target_id, confidence, context, created_at, last_used, use_count
+		FROM knowledge_relations WHERE (source_id IN (%s) OR target_id IN (%s))`, in, in)
+	var args []interface{}
+	for range 2 {
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	if len(relations) > 0 {
+		query += " AND relation IN (" + strings.TrimSuffix(strings.Repeat("?,", len(relations)), ",") + ")"
+		for _, r := range relations {
+			args = append(args, r)
+		}
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to traverse knowledge: %w", err)
+	}
+	defer rows.Close()
+	var rels []KnowledgeRelation
+	for rows.Next() {
+		var r KnowledgeRelation
+		var ctx sql.NullString
+		if err := rows.Scan(&r.ID, &r.SourceID, &r.Relation, &r.TargetID, &r.Confidence, &ctx, &r.CreatedAt, &r.LastUsed, &r.UseCount); err != nil {
+			return nil, err
+		}
+		r.Context = ctx.String
+		r.Confidence = decay(r.Confidence, r.LastUsed)
+		rels = append(rels, r)
+	}
+	sort.SliceStable(rels, func(i, j int) bool { return rels[i].Confidence > rels[j].Confidence })
+	return rels, rows.Err()
+}
+
+// entitiesByID loads entities by ID.
+func (db *DB) entitiesByID(ids []int64) (map[int64]KnowledgeEntity, error) {
+	entities := make(map[int64]KnowledgeEntity, len(ids))
+	for _, id := range ids {
+		e, err := db.GetEntityByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			entities[id] = *e
+		}
+	}
+	return entities, nil
+}
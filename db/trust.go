@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// Trust says how far learned knowledge can be relied on. Higher levels win
+// over lower ones: a fact the user entered is not replaced by one the model
+// asserts, and is recalled ahead of it.
+type Trust int
+
+const (
+	TrustAsserted Trust = 1 // stated by the model
+	TrustVerified Trust = 2 // borne out by the output of a command q ran
+	TrustUser     Trust = 3 // entered or corrected by the user
+)
+
+func (t Trust) String() string {
+	switch {
+	case t >= TrustUser:
+		return "user"
+	case t == TrustVerified:
+		return "verified"
+	default:
+		return "ai-asserted"
+	}
+}
+
+// imported clamps the trust claimed by knowledge from a pack or another
+// machine. Only the user at this machine makes knowledge user-trusted, so
+// an imported preference is not injected into every prompt.
+func (t Trust) imported() Trust {
+	return min(max(t, TrustAsserted), TrustVerified)
+}
+
+// weight scales relevance scores so more trusted knowledge ranks higher.
+func (t Trust) weight() float64 {
+	return 1 + 0.25*float64(max(t, TrustAsserted)-TrustAsserted)
+}
+
+// Attribution records where a piece of knowledge came from.
+type Attribution struct {
+	Source    string // tool or command that recorded it, e.g. learn_fact
+	SessionID string
+	Model     string
+	Trust     Trust
+}
+
+// trust is a's trust level, ai-asserted when unset.
+func (a Attribution) trust() Trust {
+	return max(a.Trust, TrustAsserted)
+}
+
+// over returns the attribution to keep when a records knowledge already
+// attributed to old: the more trusted of the two, or at equal trust a with
+// any blanks filled from old.
+func (a Attribution) over(old Attribution) Attribution {
+	a.Trust = a.trust()
+	switch {
+	case a.Trust < old.Trust:
+		return old
+	case a.Trust == old.Trust:
+		if a.Source == "" {
+			a.Source = old.Source
+		}
+		if a.SessionID == "" {
+			a.SessionID = old.SessionID
+		}
+		if a.Model == "" {
+			a.Model = old.Model
+		}
+	}
+	return a
+}
+
+// trustUserFacts marks facts the user entered before trust was recorded.
+func trustUserFacts(conn *sql.DB) error {
+	_, err := conn.Exec("UPDATE knowledge_facts SET trust = ? WHERE source = 'user'", TrustUser)
+	return err
+}
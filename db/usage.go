@@ -0,0 +1,182 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// UsageStats summarizes how q has been used over a period, for `q stats`.
+// Everything comes from the local database.
+type UsageStats struct {
+	Since    time.Time
+	Queries  int
+	Sessions int
+	Usage    Usage        // tokens and cost of sessions active in the period
+	Days     []DayCount   // queries per day, oldest first, including idle days
+	Tools    []ToolUsage  // most used first
+	Models   []ModelUsage // most used first
+	Repairs  []ErrorRepair
+}
+
+// DayCount is the number of queries asked on one day.
+type DayCount struct {
+	Day     time.Time
+	Queries int
+}
+
+// ToolUsage is how often a tool ran and how it went.
+type ToolUsage struct {
+	Name       string
+	Calls      int
+	Errors     int
+	AvgLatency time.Duration
+}
+
+// ModelUsage is how many replies a model wrote and how long they took.
+type ModelUsage struct {
+	Model      string
+	Replies    int
+	AvgLatency time.Duration
+}
+
+// ErrorRepair is an error pattern whose learned fix has worked.
+type ErrorRepair struct {
+	Signature string
+	Type      string
+	Fixes     int
+}
+
+// UsageStats gathers usage over the last days days, in local time.
+func (db *DB) UsageStats(days int) (*UsageStats, error) {
+	db.Flush()
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	stats := &UsageStats{Since: today.AddDate(0, 0, 1-days)}
+
+	perDay := make(map[string]int)
+	rows, err := db.conn.Query("SELECT created_at FROM messages WHERE role = ?", RoleUser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+	for rows.Next() {
+		var t time.Time
+		if rows.Scan(&t) != nil || t.Before(stats.Since) {
+			continue
+		}
+		stats.Queries++
+		perDay[t.Local().Format("2006-01-02")]++
+	}
+	rows.Close()
+	for d := stats.Since; !d.After(today); d = d.AddDate(0, 0, 1) {
+		stats.Days = append(stats.Days, DayCount{Day: d, Queries: perDay[d.Format("2006-01-02")]})
+	}
+
+	rows, err = db.conn.Query("SELECT updated_at, prompt_tokens, completion_tokens, cost FROM sessions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %w", err)
+	}
+	for rows.Next() {
+		var t time.Time
+		var u Usage
+		if rows.Scan(&t, &u.PromptTokens, &u.CompletionTokens, &u.Cost) != nil || t.Before(stats.Since) {
+			continue
+		}
+		stats.Sessions++
+		stats.Usage = stats.Usage.Add(u)
+	}
+	rows.Close()
+
+	tools := make(map[string]*ToolUsage)
+	toolTime := make(map[string]int64)
+	rows, err = db.conn.Query("SELECT name, is_error, duration_ms, created_at FROM tool_calls")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tool calls: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		var isError bool
+		var ms int64
+		var t time.Time
+		if rows.Scan(&name, &isError, &ms, &t) != nil || t.Before(stats.Since) {
+			continue
+		}
+		tu := tools[name]
+		if tu == nil {
+			tu = &ToolUsage{Name: name}
+			tools[name] = tu
+		}
+		tu.Calls++
+		if isError {
+			tu.Errors++
+		}
+		toolTime[name] += ms
+	}
+	rows.Close()
+	for name, tu := range tools {
+		tu.AvgLatency = time.Duration(toolTime[name]/int64(tu.Calls)) * time.Millisecond
+		stats.Tools = append(stats.Tools, *tu)
+	}
+	sort.Slice(stats.Tools, func(i, j int) bool {
+		if stats.Tools[i].Calls != stats.Tools[j].Calls {
+			return stats.Tools[i].Calls > stats.Tools[j].Calls
+		}
+		return stats.Tools[i].Name < stats.Tools[j].Name
+	})
+
+	models := make(map[string]*ModelUsage)
+	// Replies saved before latency was recorded count, but only timed ones
+	// go into the average.
+	modelTime := make(map[string]int64)
+	modelTimed := make(map[string]int64)
+	rows, err = db.conn.Query("SELECT model, latency_ms, created_at FROM messages WHERE role = ? AND model IS NOT NULL", RoleAssistant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+	for rows.Next() {
+		var model string
+		var ms sql.NullInt64
+		var t time.Time
+		if rows.Scan(&model, &ms, &t) != nil || t.Before(stats.Since) {
+			continue
+		}
+		mu := models[model]
+		if mu == nil {
+			mu = &ModelUsage{Model: model}
+			models[model] = mu
+		}
+		mu.Replies++
+		if ms.Valid {
+			modelTime[model] += ms.Int64
+			modelTimed[model]++
+		}
+	}
+	rows.Close()
+	for name, mu := range models {
+		if modelTimed[name] > 0 {
+			mu.AvgLatency = time.Duration(modelTime[name]/modelTimed[name]) * time.Millisecond
+		}
+		stats.Models = append(stats.Models, *mu)
+	}
+	sort.Slice(stats.Models, func(i, j int) bool { return stats.Models[i].Replies > stats.Models[j].Replies })
+
+	rows, err = db.conn.Query(`
+		SELECT error_signature, error_type, success_count, last_used FROM error_patterns
+		WHERE success_count > 0
+		ORDER BY success_count DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read error patterns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r ErrorRepair
+		var t time.Time
+		if rows.Scan(&r.Signature, &r.Type, &r.Fixes, &t) != nil || t.Before(stats.Since) {
+			continue
+		}
+		stats.Repairs = append(stats.Repairs, r)
+	}
+	return stats, rows.Err()
+}
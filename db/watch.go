@@ -0,0 +1,210 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WatchError is an error watch mode found, from when it first turned up
+// until a build of its target no longer had it.
+type WatchError struct {
+	ID          int64      `json:"id"`
+	ProjectPath string     `json:"project_path,omitempty"`
+	Target      string     `json:"target,omitempty"`
+	Type        string     `json:"type"`
+	Language    string     `json:"language,omitempty"`
+	File        string     `json:"file,omitempty"`
+	Line        int        `json:"line,omitempty"`
+	Message     string     `json:"message"`
+	Occurrences int        `json:"occurrences"`
+	DetectedAt  time.Time  `json:"detected_at"`
+	LastSeen    time.Time  `json:"last_seen"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	// Repairs are the attempts to repair it, oldest first.
+	Repairs []WatchRepair `json:"repairs,omitempty"`
+}
+
+// WatchRepair is an attempt by watch mode to repair an error.
+type WatchRepair struct {
+	ID      int64 `json:"id"`
+	ErrorID int64 `json:"error_id"`
+	// PatternID is the learned error pattern whose fix was run, if any.
+	PatternID int64 `json:"pattern_id,omitempty"`
+	// Success is whether the fix ran without failing.
+	Success bool `json:"success"`
+	// Fixed is whether the next build no longer had the error, or nil
+	// until there has been one.
+	Fixed     *bool         `json:"fixed,omitempty"`
+	Solution  string        `json:"solution,omitempty"`
+	Command   string        `json:"command,omitempty"`
+	Diff      string        `json:"diff,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// RecordWatchError records an occurrence of an error in a build of target
+// in projectPath and returns its ID. An error already recorded there and
+// not resolved since is counted again rather than added.
+func (db *DB) RecordWatchError(projectPath, target, errorType, language, file string, line int, message string) (int64, error) {
+	signature := NormalizeErrorSignature(message)
+	now := time.Now()
+
+	var id int64
+	err := db.conn.QueryRow(`
+		SELECT id FROM watch_errors
+		WHERE project_path IS ? AND target IS ? AND signature = ? AND resolved_at IS NULL
+		ORDER BY id DESC LIMIT 1
+	`, nullIfEmpty(projectPath), nullIfEmpty(target), signature).Scan(&id)
+	switch {
+	case err == nil:
+		_, err = db.conn.Exec(`
+			UPDATE watch_errors SET occurrences = occurrences + 1, last_seen = ?, file = ?, line = ?, message = ?
+			WHERE id = ?
+		`, now, nullIfEmpty(file), line, db.seal(message), id)
+	case err == sql.ErrNoRows:
+		var res sql.Result
+		res, err = db.conn.Exec(`
+			INSERT INTO watch_errors (project_path, target, error_type, language, file, line, message, signature, detected_at, last_seen)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, nullIfEmpty(projectPath), nullIfEmpty(target), errorType, nullIfEmpty(language), nullIfEmpty(file), line,
+			db.seal(message), signature, now, now)
+		if err == nil {
+			id, err = res.LastInsertId()
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to record watch error: %w", err)
+	}
+	return id, nil
+}
+
+// ResolveWatchErrors marks the unresolved errors of target in projectPath
+// resolved, except those with the IDs in current, which the latest build
+// still had.
+func (db *DB) ResolveWatchErrors(projectPath, target string, current []int64) error {
+	query := "UPDATE watch_errors SET resolved_at = ? WHERE project_path IS ? AND target IS ? AND resolved_at IS NULL"
+	args := []interface{}{time.Now(), nullIfEmpty(projectPath), nullIfEmpty(target)}
+	if len(current) > 0 {
+		query += " AND id NOT IN (?" + strings.Repeat(", ?", len(current)-1) + ")"
+		for _, id := range current {
+			args = append(args, id)
+		}
+	}
+	if _, err := db.conn.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to resolve watch errors: %w", err)
+	}
+	return nil
+}
+
+// RecordWatchRepair records an attempt to repair an error, setting its ID.
+func (db *DB) RecordWatchRepair(r *WatchRepair) error {
+	var fixed interface{}
+	if r.Fixed != nil {
+		fixed = *r.Fixed
+	}
+	var patternID interface{}
+	if r.PatternID != 0 {
+		patternID = r.PatternID
+	}
+	var diff interface{}
+	if r.Diff != "" {
+		diff = db.seal(r.Diff)
+	}
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	res, err := db.conn.Exec(`
+		INSERT INTO watch_repairs (error_id, pattern_id, success, fixed, solution, command, diff, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.ErrorID, patternID, r.Success, fixed, nullIfEmpty(r.Solution), nullIfEmpty(r.Command), diff,
+		r.Duration.Milliseconds(), r.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record watch repair: %w", err)
+	}
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+// SetWatchRepairFixed records whether the build after a repair still had
+// the error.
+func (db *DB) SetWatchRepairFixed(id int64, fixed bool) error {
+	if _, err := db.conn.Exec("UPDATE watch_repairs SET fixed = ? WHERE id = ?", fixed, id); err != nil {
+		return fmt.Errorf("failed to update watch repair: %w", err)
+	}
+	return nil
+}
+
+// WatchHistory returns the errors watch mode found in the given projects
+// (nil paths means every project), newest first, with their repairs.
+func (db *DB) WatchHistory(paths []string, limit int) ([]WatchError, error) {
+	where, args := "1=1", []interface{}(nil)
+	if paths != nil {
+		where, args = projectClause(paths)
+	}
+	rows, err := db.conn.Query(`
+		SELECT id, project_path, target, error_type, language, file, line, message, occurrences, detected_at, last_seen, resolved_at
+		FROM watch_errors WHERE `+where+` ORDER BY detected_at DESC, id DESC LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watch history: %w", err)
+	}
+	var history []WatchError
+	index := make(map[int64]int)
+	for rows.Next() {
+		var e WatchError
+		var pp, target, lang, file sql.NullString
+		var resolved sql.NullTime
+		if err := rows.Scan(&e.ID, &pp, &target, &e.Type, &lang, &file, &e.Line, &e.Message, &e.Occurrences, &e.DetectedAt, &e.LastSeen, &resolved); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.ProjectPath, e.Target, e.Language, e.File = pp.String, target.String, lang.String, file.String
+		e.Message = db.unseal(e.Message)
+		if resolved.Valid {
+			e.ResolvedAt = &resolved.Time
+		}
+		index[e.ID] = len(history)
+		history = append(history, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]interface{}, 0, len(history))
+	for _, e := range history {
+		ids = append(ids, e.ID)
+	}
+	rows, err = db.conn.Query(`
+		SELECT id, error_id, pattern_id, success, fixed, solution, command, diff, duration_ms, created_at
+		FROM watch_repairs WHERE error_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`) ORDER BY id
+	`, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watch repairs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r WatchRepair
+		var patternID sql.NullInt64
+		var fixed sql.NullBool
+		var solution, command, diff sql.NullString
+		var ms int64
+		if err := rows.Scan(&r.ID, &r.ErrorID, &patternID, &r.Success, &fixed, &solution, &command, &diff, &ms, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.PatternID, r.Solution, r.Command = patternID.Int64, solution.String, command.String
+		r.Diff = db.unsealNull(diff).String
+		r.Duration = time.Duration(ms) * time.Millisecond
+		if fixed.Valid {
+			r.Fixed = &fixed.Bool
+		}
+		e := &history[index[r.ErrorID]]
+		e.Repairs = append(e.Repairs, r)
+	}
+	return history, rows.Err()
+}
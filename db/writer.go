@@ -0,0 +1,273 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Writes that nobody waits on (chat history, pattern results) go through a
+// background writer so saving them never delays a response. Queued
+// statements are grouped into one transaction per batch.
+
+const (
+	writeQueueSize = 256
+	writeBatchMax  = 100
+	writeBatchWait = 20 * time.Millisecond
+)
+
+// WriteStats describes the background writer's work so far.
+type WriteStats struct {
+	Queued       int64         // statements handed to the writer
+	Written      int64         // statements committed
+	Failed       int64         // statements that returned an error
+	Batches      int64         // transactions committed
+	LargestBatch int           // most statements in one transaction
+	EnqueueTime  time.Duration // total time callers spent queueing
+	CommitTime   time.Duration // total time spent writing batches
+	MaxLag       time.Duration // longest a statement waited before commit
+	LastError    string
+}
+
+func (s WriteStats) String() string {
+	if s.Queued == 0 {
+		return "no background writes"
+	}
+	line := fmt.Sprintf("%d writes in %d batches (largest %d), %d failed; callers waited %s in total, commits took %s, max lag %s",
+		s.Written, s.Batches, s.LargestBatch, s.Failed,
+		s.EnqueueTime.Round(time.Microsecond), s.CommitTime.Round(time.Microsecond), s.MaxLag.Round(time.Millisecond))
+	if s.LastError != "" {
+		line += "; last error: " + s.LastError
+	}
+	return line
+}
+
+type writeOp struct {
+	query  string
+	args   []interface{}
+	queued time.Time
+}
+
+type writer struct {
+	db      *DB
+	ops     chan writeOp
+	flushes chan chan struct{}
+	done    chan struct{}
+
+	sendMu sync.Mutex // guards closed and sends on ops
+	closed bool
+
+	mu    sync.Mutex // guards stats
+	stats WriteStats
+}
+
+func newWriter(db *DB) *writer {
+	w := &writer{
+		db:      db,
+		ops:     make(chan writeOp, writeQueueSize),
+		flushes: make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// enqueue hands a statement to the writer. After Close it runs inline.
+func (w *writer) enqueue(query string, args ...interface{}) {
+	start := time.Now()
+	op := writeOp{query: query, args: args, queued: start}
+	w.sendMu.Lock()
+	if w.closed {
+		w.sendMu.Unlock()
+		w.commit([]writeOp{op})
+		return
+	}
+	// Sending under the lock keeps close from racing the send; the channel
+	// is buffered, so this only blocks when the writer is far behind.
+	w.ops <- op
+	w.sendMu.Unlock()
+
+	w.mu.Lock()
+	w.stats.Queued++
+	w.stats.EnqueueTime += time.Since(start)
+	w.mu.Unlock()
+}
+
+func (w *writer) run() {
+	defer close(w.done)
+	for {
+		select {
+		case op, ok := <-w.ops:
+			if !ok {
+				return
+			}
+			w.commit(w.collect(op))
+		case reply := <-w.flushes:
+			w.commit(w.drain(nil))
+			close(reply)
+		}
+	}
+}
+
+// collect gathers whatever else arrives shortly after first.
+func (w *writer) collect(first writeOp) []writeOp {
+	batch := []writeOp{first}
+	timer := time.NewTimer(writeBatchWait)
+	defer timer.Stop()
+	for len(batch) < writeBatchMax {
+		select {
+		case op, ok := <-w.ops:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, op)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// drain takes everything already queued without waiting.
+func (w *writer) drain(batch []writeOp) []writeOp {
+	for {
+		select {
+		case op, ok := <-w.ops:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, op)
+		default:
+			return batch
+		}
+	}
+}
+
+func (w *writer) commit(batch []writeOp) {
+	if len(batch) == 0 {
+		return
+	}
+	start := time.Now()
+	var written, failed int64
+	var lastErr error
+	tx, err := w.db.conn.Begin()
+	if err != nil {
+		failed, lastErr = int64(len(batch)), err
+	} else {
+		for _, op := range batch {
+			if _, err := tx.Exec(op.query, op.args...); err != nil {
+				failed++
+				lastErr = err
+				continue
+			}
+			written++
+		}
+		if err := tx.Commit(); err != nil {
+			failed, written, lastErr = int64(len(batch)), 0, err
+		}
+	}
+	end := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats.Written += written
+	w.stats.Failed += failed
+	w.stats.Batches++
+	w.stats.CommitTime += end.Sub(start)
+	if len(batch) > w.stats.LargestBatch {
+		w.stats.LargestBatch = len(batch)
+	}
+	if lag := end.Sub(batch[0].queued); lag > w.stats.MaxLag {
+		w.stats.MaxLag = lag
+	}
+	if lastErr != nil {
+		w.stats.LastError = lastErr.Error()
+	}
+}
+
+// flush returns once everything queued before the call is committed.
+func (w *writer) flush() {
+	w.sendMu.Lock()
+	closed := w.closed
+	w.sendMu.Unlock()
+	if closed {
+		return
+	}
+	reply := make(chan struct{})
+	select {
+	case w.flushes <- reply:
+		<-reply
+	case <-w.done:
+	}
+}
+
+// close writes what is queued and stops the writer.
+func (w *writer) close() {
+	w.sendMu.Lock()
+	if w.closed {
+		w.sendMu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.ops)
+	w.sendMu.Unlock()
+	<-w.done
+}
+
+// Flush waits for queued background writes to be committed.
+func (db *DB) Flush() {
+	db.writer.flush()
+}
+
+// WriteStats reports what the background writer has done so far.
+func (db *DB) WriteStats() WriteStats {
+	db.writer.mu.Lock()
+	defer db.writer.mu.Unlock()
+	return db.writer.stats
+}
+
+// QueueMessage saves a message in the background and returns its ID. The
+// session must already exist; use AddMessage when the caller needs the
+// stored row.
+func (db *DB) QueueMessage(sessionID, role, content string, tokenCount int) string {
+	id := uuid.New().String()
+	db.writer.enqueue(
+		"INSERT INTO messages (id, session_id, role, content, created_at, token_count) VALUES (?, ?, ?, ?, ?, ?)",
+		id, sessionID, role, db.seal(content), time.Now(), tokenCount,
+	)
+	return id
+}
+
+// QueueReply is QueueMessage for an assistant reply, recording which model
+// wrote it and how long the query took.
+func (db *DB) QueueReply(sessionID, content string, tokenCount int, model string, latency time.Duration) string {
+	id := uuid.New().String()
+	db.writer.enqueue(
+		"INSERT INTO messages (id, session_id, role, content, created_at, token_count, model, latency_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		id, sessionID, RoleAssistant, db.seal(content), time.Now(), tokenCount, nullIfEmpty(model), latency.Milliseconds(),
+	)
+	return id
+}
+
+// QueueToolCall saves a tool call in the background. Queue it after the
+// message it belongs to; the writer keeps statements in order.
+func (db *DB) QueueToolCall(tc ToolCall) {
+	if tc.ID == "" {
+		tc.ID = uuid.New().String()
+	}
+	if tc.CreatedAt.IsZero() {
+		tc.CreatedAt = time.Now()
+	}
+	db.writer.enqueue(insertToolCall, db.toolCallArgs(tc)...)
+}
+
+// QueueUsage adds one exchange's tokens and cost to a session's totals in
+// the background.
+func (db *DB) QueueUsage(sessionID string, u Usage) {
+	db.writer.enqueue(
+		"UPDATE sessions SET prompt_tokens = prompt_tokens + ?, completion_tokens = completion_tokens + ?, cost = cost + ? WHERE id = ?",
+		u.PromptTokens, u.CompletionTokens, u.Cost, sessionID,
+	)
+}
@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	. "q/types"
+	"q/util"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConnectionTest is how a model answered TestConnection.
+type ConnectionTest struct {
+	Latency time.Duration
+	// Status is the HTTP status, or "" if the endpoint did not answer.
+	Status string
+	// Sample is the start of the model's reply.
+	Sample string
+	Err    error
+}
+
+// TestConnection sends the model in cfg a tiny prompt and reports how long
+// it took and what came back. cfg is as in the config: Auth and OrgID name
+// environment variables.
+func TestConnection(ctx context.Context, cfg ModelConfig) ConnectionTest {
+	if cfg.ModelName == "" {
+		cfg.ModelName = cfg.Name
+	}
+	cfg, err := resolveAuth(cfg)
+	if err != nil {
+		return ConnectionTest{Err: err}
+	}
+	c := &LLMClient{config: cfg, httpClient: &http.Client{}}
+
+	messages := []Message{{Role: "user", Content: "Reply with just the word: ok"}}
+	var payload interface{} = map[string]interface{}{"model": cfg.ModelName, "messages": messages, "stream": false}
+	if c.isOllamaCloud() {
+		payload = OllamaPayload{Model: cfg.ModelName, Messages: messages}
+	}
+	req, err := c.createRequest(ctx, payload)
+	if err != nil {
+		return ConnectionTest{Err: err}
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ConnectionTest{Latency: time.Since(start), Err: err}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	test := ConnectionTest{Latency: time.Since(start), Status: resp.Status}
+	if resp.StatusCode != http.StatusOK {
+		test.Err = fmt.Errorf("%s", apiErrorMessage(body))
+		return test
+	}
+
+	if c.isOllamaCloud() {
+		var reply OllamaResponse
+		if err := json.Unmarshal(body, &reply); err != nil {
+			test.Err = fmt.Errorf("unexpected response: %s", truncate(string(body), 200))
+			return test
+		}
+		test.Sample = strings.TrimSpace(reply.Message.Content)
+		return test
+	}
+	var reply ToolCallResponse
+	if err := json.Unmarshal(body, &reply); err != nil || len(reply.Choices) == 0 {
+		test.Err = fmt.Errorf("unexpected response: %s", truncate(string(body), 200))
+		return test
+	}
+	test.Sample = strings.TrimSpace(reply.Choices[0].Message.Content)
+	return test
+}
+
+// ListModels returns the IDs of the models the endpoint in cfg serves,
+// sorted, from the provider's OpenAI-compatible /models endpoint or
+// Ollama's /api/tags. cfg is as in the config.
+func ListModels(ctx context.Context, cfg ModelConfig) ([]string, error) {
+	cfg, err := resolveAuth(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &LLMClient{config: cfg, httpClient: &http.Client{}}
+	listURL, ollama := modelsURL(cfg.Endpoint)
+	if listURL == "" {
+		return nil, fmt.Errorf("cannot tell where %s lists its models", cfg.Endpoint)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", listURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setAuthHeaders(req)
+	if strings.Contains(cfg.Endpoint, "/v1/messages") {
+		req.Header.Set("anthropic-version", "2023-06-01")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, apiErrorMessage(body))
+	}
+
+	var listed struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &listed); err != nil {
+		return nil, fmt.Errorf("unexpected response: %s", truncate(string(body), 200))
+	}
+	var ids []string
+	for _, m := range listed.Data {
+		ids = append(ids, m.ID)
+	}
+	if ollama {
+		for _, m := range listed.Models {
+			ids = append(ids, m.Name)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// modelsURL returns the URL that lists the models served at endpoint, and
+// whether it is Ollama's, or "" if it cannot be worked out.
+func modelsURL(endpoint string) (string, bool) {
+	if i := strings.Index(endpoint, "/api/chat"); i >= 0 {
+		return endpoint[:i] + "/api/tags", true
+	}
+	if i := strings.Index(endpoint, "/chat/completions"); i >= 0 {
+		return endpoint[:i] + "/models", false
+	}
+	if i := strings.Index(endpoint, "/v1/messages"); i >= 0 {
+		return endpoint[:i] + "/v1/models", false
+	}
+	return "", false
+}
+
+// resolveAuth replaces the names of the environment variables in cfg's
+// Auth and OrgID with their values, taking the API key from the keychain
+// if that is where cfg keeps it.
+func resolveAuth(cfg ModelConfig) (ModelConfig, error) {
+	if name := cfg.Auth; name != "" {
+		if cfg.Auth = util.APIKey(name, cfg.AuthSource); cfg.Auth == "" {
+			return cfg, fmt.Errorf("%s is not set", name)
+		}
+	}
+	if name := cfg.OrgID; name != "" {
+		if cfg.OrgID = os.Getenv(name); cfg.OrgID == "" {
+			return cfg, fmt.Errorf("%s is not set", name)
+		}
+	}
+	return cfg, nil
+}
+
+// apiErrorMessage returns the message of an API error body, which is
+// usually {"error": {"message": ...}} or {"error": "..."}.
+func apiErrorMessage(body []byte) string {
+	var parsed struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && len(parsed.Error) > 0 {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(parsed.Error, &nested) == nil && nested.Message != "" {
+			return nested.Message
+		}
+		var text string
+		if json.Unmarshal(parsed.Error, &text) == nil && text != "" {
+			return text
+		}
+	}
+	return truncate(strings.TrimSpace(string(body)), 200)
+}
@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"q/db"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileTools are the tools whose path argument is a file the model has seen.
+var fileTools = map[string]bool{
+	"read_file":   true,
+	"write_file":  true,
+	"append_file": true,
+}
+
+// maxChangedFiles caps how many changed files are listed in the prompt.
+const maxChangedFiles = 10
+
+// trackContextFile records the content hash of a file the model read or
+// wrote, so the next session can tell whether it changed in between.
+func (c *LLMClient) trackContextFile(toolName, arguments string) {
+	if !fileTools[toolName] {
+		return
+	}
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args.Path == "" {
+		return
+	}
+	path, err := filepath.Abs(args.Path)
+	if err != nil {
+		return
+	}
+	c.noteSeenFile(path)
+	c.recordContextFile(path)
+}
+
+// noteSeenFile adds path to the files of this conversation, which agents
+// spawned with its context are told about.
+func (c *LLMClient) noteSeenFile(path string) {
+	path = c.displayPath(path)
+	for _, seen := range c.seenFiles {
+		if seen == path {
+			return
+		}
+	}
+	c.seenFiles = append(c.seenFiles, path)
+}
+
+func (c *LLMClient) recordContextFile(path string) {
+	content, err := os.ReadFile(path)
+	if err != nil || !c.ensureSession() {
+		return
+	}
+	c.db.AddContextFile(c.sessionID, path, string(content))
+}
+
+// loadChangedFiles re-hashes the files referenced in earlier sessions and
+// lists the ones that changed or disappeared since they were last seen.
+func (c *LLMClient) loadChangedFiles(sessions []db.SessionSummary, builder *strings.Builder) {
+	latest := make(map[string]db.ContextFile)
+	for _, sess := range sessions {
+		files, err := c.db.GetContextFiles(sess.ID)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if seen, ok := latest[f.FilePath]; !ok || f.AddedAt.After(seen.AddedAt) {
+				latest[f.FilePath] = f
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(latest))
+	for path := range latest {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, path := range paths {
+		if len(lines) >= maxChangedFiles {
+			break
+		}
+		f := latest[path]
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			lines = append(lines, fmt.Sprintf("- %s was deleted", c.displayPath(path)))
+			continue
+		}
+		if err != nil || db.ContentHash(string(content)) == f.ContentHash {
+			continue
+		}
+		line := fmt.Sprintf("- %s changed", c.displayPath(path))
+		if commits := gitCommitsSince(path, f.AddedAt); commits != "" {
+			line += " (commits since: " + commits + ")"
+		}
+		lines = append(lines, line)
+		// Note the new version in this session so the change is reported once.
+		c.refreshFiles = append(c.refreshFiles, path)
+	}
+	if len(lines) == 0 {
+		return
+	}
+	builder.WriteString("\n[Files changed since our last conversation (read them again before relying on what you remember):]\n")
+	builder.WriteString(strings.Join(lines, "\n"))
+	builder.WriteString("\n")
+}
+
+// displayPath shows paths inside the project relative to it.
+func (c *LLMClient) displayPath(path string) string {
+	if rel, err := filepath.Rel(c.projectPath, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// gitCommitsSince summarizes commits touching path after since, or returns
+// "" when the file is not in a git repository.
+func gitCommitsSince(path string, since time.Time) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "log", "--format=%h %s", "-n", "3",
+		"--since="+since.Format(time.RFC3339), "--", filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	commits := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if commits[0] == "" {
+		return ""
+	}
+	for i, commit := range commits {
+		commits[i] = truncate(commit, 60)
+	}
+	return strings.Join(commits, "; ")
+}
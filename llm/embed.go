@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"q/types"
+	"q/util"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEmbeddingsEndpoint = "https://api.openai.com/v1/embeddings"
+	defaultEmbeddingsModel    = "text-embedding-3-small"
+)
+
+// embeddings is the embeddings preference.
+var embeddings types.EmbeddingsConfig
+
+// SetEmbeddings configures the embeddings API used to recall knowledge by
+// meaning; it is off unless cfg.Enabled is set.
+func SetEmbeddings(cfg types.EmbeddingsConfig) {
+	embeddings = cfg
+}
+
+// embedder returns the model and a function embedding texts with it, or
+// nil when embeddings are off or their API key is missing.
+func embedder() (string, func(ctx context.Context, texts []string) ([][]float32, error)) {
+	if !embeddings.Enabled {
+		return "", nil
+	}
+	endpoint, authEnv := embeddings.Endpoint, embeddings.AuthEnvVar
+	if endpoint == "" {
+		endpoint = defaultEmbeddingsEndpoint
+		if authEnv == "" {
+			authEnv = "OPENAI_API_KEY"
+		}
+	}
+	model := embeddings.Model
+	if model == "" {
+		model = defaultEmbeddingsModel
+	}
+	apiKey := ""
+	if authEnv != "" {
+		if apiKey = util.APIKey(authEnv, embeddings.AuthSource); apiKey == "" {
+			return "", nil
+		}
+	}
+	return model, func(ctx context.Context, texts []string) ([][]float32, error) {
+		return Embed(ctx, endpoint, model, apiKey, texts)
+	}
+}
+
+// Embed sends texts to an OpenAI-compatible /embeddings endpoint and
+// returns their vectors, in order.
+func Embed(ctx context.Context, endpoint, model, apiKey string, texts []string) ([][]float32, error) {
+	payload, err := json.Marshal(map[string]interface{}{"model": model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings failed: HTTP %d: %s", resp.StatusCode, truncate(strings.TrimSpace(string(data)), 300))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse embeddings: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings failed: got %d vectors for %d texts", len(result.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embeddings failed: unexpected index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
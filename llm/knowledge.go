@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"fmt"
+	"q/db"
+	"sort"
+	"strings"
+)
+
+// knowledgeItems is how many entities and facts are added to the system
+// prompt for each query when enable_knowledge is set.
+const knowledgeItems = 8
+
+// knowledgeInjection is the enable_knowledge preference.
+var knowledgeInjection bool
+
+// SetKnowledgeInjection turns on adding the knowledge most relevant to each
+// query to the system prompt, in place of the recent knowledge added once at
+// startup.
+func SetKnowledgeInjection(enabled bool) {
+	knowledgeInjection = enabled
+}
+
+// injectKnowledge replaces the knowledge block in the system prompt with
+// one for query.
+func (c *LLMClient) injectKnowledge(query string) {
+	if !knowledgeInjection || c.db == nil || len(c.messages) == 0 || c.messages[0].Role != "system" {
+		return
+	}
+	if c.basePrompt == "" {
+		c.basePrompt = c.messages[0].Content
+		c.knowledgePaths = db.ProjectKeys(c.recallPaths())
+	}
+	c.knowledgeContext = c.relevantKnowledge(query)
+	c.messages[0].Content = c.basePrompt + c.knowledgeContext
+}
+
+// relevantKnowledge lists the entities and facts that best match query,
+// topped up with the most confident facts about the user and project. More
+// trusted entities come first, and trusted lines are marked as such.
+func (c *LLMClient) relevantKnowledge(query string) string {
+	paths := c.knowledgePaths
+	inScope := func(projectPath string) bool {
+		if paths == nil || projectPath == "" {
+			return true
+		}
+		for _, p := range paths {
+			if p == projectPath {
+				return true
+			}
+		}
+		return false
+	}
+
+	var lines []string
+	seen := make(map[string]bool)
+	add := func(line string) {
+		if len(lines) < knowledgeItems && !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+
+	if entities, err := c.db.SearchEntities(query, "", "", knowledgeItems*3); err == nil {
+		sort.SliceStable(entities, func(i, j int) bool { return entities[i].Trust > entities[j].Trust })
+		// Leave at least half the block for facts.
+		for _, e := range entities {
+			if len(lines) >= knowledgeItems/2 {
+				break
+			}
+			if !inScope(e.ProjectPath) {
+				continue
+			}
+			line := fmt.Sprintf("- [%s] %s", e.Type, e.Name)
+			if e.Value != "" {
+				line += ": " + truncate(e.Value, 80)
+			}
+			add(line + trustTag(e.Trust) + c.knowledgeSource(e.ProjectPath))
+		}
+	}
+	facts, _ := c.db.SearchFacts(query, paths, knowledgeItems)
+	for _, subject := range []string{"user", "project"} {
+		more, _ := c.db.GetFactsAboutIn(subject, paths, knowledgeItems)
+		facts = append(facts, more...)
+	}
+	for _, f := range facts {
+		add(fmt.Sprintf("- %s %s %s%s%s", f.Subject, f.Predicate, f.Object, trustTag(f.Trust), c.knowledgeSource(f.ProjectPath)))
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n[What I know about this environment:]\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// trustTag marks knowledge the model can rely on more than its own earlier
+// assertions.
+func trustTag(t db.Trust) string {
+	switch {
+	case t >= db.TrustUser:
+		return " (from the user)"
+	case t == db.TrustVerified:
+		return " (verified)"
+	}
+	return ""
+}
@@ -3,6 +3,7 @@ package llm
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	. "q/types"
 	"q/util"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
@@ -27,8 +29,48 @@ type LLMClient struct {
 	ToolCallback     func(string, string)
 	httpClient       *http.Client
 	db               *db.DB
+	dbOnce           sync.Once
 	sessionID        string
 	projectPath      string
+	refreshFiles     []string      // changed context files to record once the session exists
+	seenFiles        []string      // files read or written in this conversation
+	memoryContext    string        // what loadContextualMemory added to the system prompt
+	backupDone       chan struct{} // closed when the daily backup finishes
+	toolCalls        []db.ToolCall // tools run for the current query, saved with its reply
+	queryUsage       db.Usage      // tokens reported by the API for the current query
+	noStreamUsage    bool          // the server rejected stream_options
+	usage            db.Usage      // totals for this conversation
+	basePrompt       string        // system prompt without the per-query knowledge block
+	knowledgePaths   []string      // recalled project keys, for the knowledge block
+	knowledgeContext string        // knowledge block added for the current query
+}
+
+// historyRetention is how long sessions are kept; zero keeps them forever.
+var historyRetention time.Duration
+
+// dbBackups is how many daily database backups to keep; negative disables
+// automatic backups.
+var dbBackups = db.DefaultBackups
+
+// SetDBBackups sets the db_backups preference; zero keeps the default.
+func SetDBBackups(keep int) {
+	if keep != 0 {
+		dbBackups = keep
+	}
+}
+
+// memoryLoading limits how much of earlier sessions is loaded at startup.
+var memoryLoading MemoryConfig
+
+// SetMemoryLoading applies the memory preferences.
+func SetMemoryLoading(cfg MemoryConfig) {
+	memoryLoading = cfg
+}
+
+// SetHistoryRetention sets the max_history_days preference. Old history is
+// pruned the first time a client opens the memory database each day.
+func SetHistoryRetention(days int) {
+	historyRetention = time.Duration(days) * 24 * time.Hour
 }
 
 func NewLLMClient(cfg ModelConfig) *LLMClient {
@@ -66,23 +108,84 @@ func NewLLMClient(cfg ModelConfig) *LLMClient {
 	client.initialPromptLen = len(msgs)
 	client.projectPath, _ = os.Getwd()
 
-	database, err := db.Open()
-	if err == nil {
-		client.db = database
-		session, err := database.CreateSession(client.projectPath)
-		if err == nil {
-			client.sessionID = session.ID
-		}
-		client.loadContextualMemory()
-	}
-
 	tools.InitAgentConfig(cfg.Endpoint, cfg.ModelName, cfg.Auth, cfg.AuthHeader)
-	tools.InitDocsDB(client.db)
-	tools.InitKnowledgeDB(client.db)
+	tools.SetConversationSource(client.conversation)
 
 	return client
 }
 
+// SetModel switches the client to cfg, with its API key resolved, for the
+// queries that follow. The conversation, system prompt included, carries
+// on as it is.
+func (c *LLMClient) SetModel(cfg ModelConfig) {
+	if cfg.ModelName == "" && cfg.Name != "" {
+		cfg.ModelName = cfg.Name
+	}
+	c.config = cfg
+	tools.InitAgentConfig(cfg.Endpoint, cfg.ModelName, cfg.Auth, cfg.AuthHeader)
+}
+
+// ensureDB opens the memory database and wires up the docs/knowledge tools on
+// first use, so startup never waits on SQLite before the prompt is shown.
+func (c *LLMClient) ensureDB() {
+	c.dbOnce.Do(func() {
+		database, err := db.Open()
+		if err != nil {
+			return
+		}
+		c.db = database
+		if historyRetention > 0 {
+			c.db.AutoPrune(historyRetention)
+		}
+		if dbBackups > 0 {
+			// A backup can take a moment on a large database; Close waits
+			// for it so the process never exits mid-copy.
+			c.backupDone = make(chan struct{})
+			go func() {
+				defer close(c.backupDone)
+				c.db.AutoBackup(dbBackups)
+			}()
+		}
+		tools.InitDocsDB(c.db)
+		tools.InitKnowledgeDB(c.db)
+		tools.SetKnowledgeSource(func() (string, string) { return c.sessionID, c.config.ModelName })
+		tools.SetEmbedder(embedder())
+		tools.InitHostsDB(c.db)
+		c.loadContextualMemory()
+	})
+}
+
+// OpenMemory opens the memory database straight away, for commands that
+// run tools without querying the model first.
+func (c *LLMClient) OpenMemory() {
+	c.ensureDB()
+}
+
+// conversation returns the messages of the conversation so far, without
+// the prompt it started with, and the files read or written in it.
+func (c *LLMClient) conversation() ([]Message, []string) {
+	return append([]Message(nil), c.messages[c.initialPromptLen:]...), append([]string(nil), c.seenFiles...)
+}
+
+// ensureSession creates the session row lazily, when the first message is saved.
+func (c *LLMClient) ensureSession() bool {
+	if c.db == nil {
+		return false
+	}
+	if c.sessionID == "" {
+		session, err := c.db.CreateSession(c.projectPath)
+		if err != nil {
+			return false
+		}
+		c.sessionID = session.ID
+		for _, path := range c.refreshFiles {
+			c.recordContextFile(path)
+		}
+		c.refreshFiles = nil
+	}
+	return true
+}
+
 func (c *LLMClient) loadContextualMemory() {
 	if c.db == nil {
 		return
@@ -90,44 +193,121 @@ func (c *LLMClient) loadContextualMemory() {
 
 	var contextBuilder strings.Builder
 
-	sessions, err := c.db.GetRecentSessions(c.projectPath, 5)
-	if err == nil && len(sessions) > 0 {
-		contextBuilder.WriteString("\n\n[Previous conversations in this directory:]\n")
-		messagesAdded := 0
-		maxMessages := 10
+	// Pinned memories come first: the user wrote them, so they outrank
+	// anything remembered or learned.
+	memories, err := c.db.GetMemories(c.projectPath)
+	if err == nil && len(memories) > 0 {
+		contextBuilder.WriteString("\n\n[Pinned by the user; always follow these:]\n")
+		for _, m := range memories {
+			contextBuilder.WriteString("- " + m.Content + "\n")
+		}
+	}
+
+	paths := c.recallPaths()
+
+	// Preferences the user accepted count as theirs, whichever way
+	// knowledge is added.
+	if prefs, err := c.db.AcceptedPreferences(db.ProjectKeys(paths)); err == nil && len(prefs) > 0 {
+		contextBuilder.WriteString("\n\n[Preferences the user confirmed; follow these:]\n")
+		for _, f := range prefs {
+			contextBuilder.WriteString(fmt.Sprintf("- %s %s %s%s\n", f.Subject, f.Predicate, f.Object, c.knowledgeSource(f.ProjectPath)))
+		}
+	}
+
+	if !memoryLoading.Disabled {
+		c.loadPreviousSessions(&contextBuilder, paths)
+	}
+
+	if !knowledgeInjection {
+		c.loadKnowledgeContext(&contextBuilder, paths)
+	}
+	c.loadFailingCommands(&contextBuilder, paths)
+
+	if contextBuilder.Len() > 0 && len(c.messages) > 0 {
+		c.messages[0].Content += contextBuilder.String()
+		c.memoryContext = contextBuilder.String()
+	}
+}
+
+// loadPreviousSessions adds messages from recent sessions in the recalled
+// directories, within the limits set by the memory preferences.
+func (c *LLMClient) loadPreviousSessions(builder *strings.Builder, paths []string) {
+	sessionLimit := memoryLoading.Sessions
+	if sessionLimit <= 0 {
+		sessionLimit = 5
+	}
+	maxMessages := memoryLoading.Messages
+	if maxMessages <= 0 {
+		maxMessages = 10
+	}
+	sessions, err := c.db.GetRecentSessionsIn(paths, sessionLimit)
+	if err != nil {
+		return
+	}
+	if memoryLoading.MaxAgeDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -memoryLoading.MaxAgeDays)
+		var recent []db.SessionSummary
 		for _, sess := range sessions {
-			if sess.ID == c.sessionID {
-				continue
+			if sess.UpdatedAt.After(cutoff) {
+				recent = append(recent, sess)
 			}
-			msgs, err := c.db.GetMessages(sess.ID)
-			if err != nil {
-				continue
+		}
+		sessions = recent
+	}
+	if len(sessions) == 0 {
+		return
+	}
+
+	if len(paths) == 1 {
+		builder.WriteString("\n\n[Previous conversations in this directory:]\n")
+	} else {
+		builder.WriteString("\n\n[Previous conversations in this and related directories:]\n")
+	}
+	var own []db.SessionSummary
+	messagesAdded := 0
+	for _, sess := range sessions {
+		if sess.ProjectPath == c.projectPath {
+			own = append(own, sess)
+		}
+		if sess.ID == c.sessionID || messagesAdded >= maxMessages {
+			continue
+		}
+		msgs, err := c.db.GetMessages(sess.ID)
+		if err != nil {
+			continue
+		}
+		header := false
+		for _, m := range msgs {
+			if messagesAdded >= maxMessages {
+				break
 			}
-			for _, m := range msgs {
-				if messagesAdded >= maxMessages {
-					break
-				}
-				if m.Role == "user" || m.Role == "assistant" {
-					contextBuilder.WriteString(fmt.Sprintf("- %s: %s\n", m.Role, truncate(m.Content, 200)))
-					messagesAdded++
+			if m.Role == "user" || m.Role == "assistant" {
+				if !header {
+					builder.WriteString(fmt.Sprintf("Session of %s%s:\n", sess.UpdatedAt.Local().Format("2006-01-02 15:04"), c.recallSource(sess.ProjectPath)))
+					header = true
 				}
+				builder.WriteString(fmt.Sprintf("- %s: %s\n", m.Role, truncate(m.Content, 200)))
+				messagesAdded++
 			}
 		}
 	}
+	c.loadChangedFiles(own, builder)
+}
 
-	c.loadKnowledgeContext(&contextBuilder)
-
-	if contextBuilder.Len() > 0 && len(c.messages) > 0 {
-		c.messages[0].Content += contextBuilder.String()
-	}
+// MemoryContext returns what was added to the system prompt from memory:
+// pinned facts, earlier messages, changed files and learned knowledge.
+func (c *LLMClient) MemoryContext() string {
+	c.ensureDB()
+	return c.memoryContext + c.knowledgeContext
 }
 
-func (c *LLMClient) loadKnowledgeContext(builder *strings.Builder) {
+func (c *LLMClient) loadKnowledgeContext(builder *strings.Builder, paths []string) {
 	if c.db == nil {
 		return
 	}
+	paths = db.ProjectKeys(paths)
 
-	recentEntities, err := c.db.GetRecentEntities(c.projectPath, "", 10)
+	recentEntities, err := c.db.GetRecentEntitiesIn(paths, "", 10)
 	if err == nil && len(recentEntities) > 0 {
 		builder.WriteString("\n[Recently learned knowledge:]\n")
 		for _, e := range recentEntities {
@@ -135,24 +315,41 @@ func (c *LLMClient) loadKnowledgeContext(builder *strings.Builder) {
 			if e.Value != "" {
 				builder.WriteString(fmt.Sprintf(": %s", truncate(e.Value, 80)))
 			}
-			builder.WriteString("\n")
+			builder.WriteString(trustTag(e.Trust) + c.knowledgeSource(e.ProjectPath) + "\n")
 		}
 	}
 
-	facts, err := c.db.GetFactsAbout("user", c.projectPath, 5)
+	facts, err := c.db.GetFactsAboutIn("user", paths, 5)
 	if err == nil && len(facts) > 0 {
 		builder.WriteString("\n[Known user preferences:]\n")
 		for _, f := range facts {
-			builder.WriteString(fmt.Sprintf("- %s %s %s\n", f.Subject, f.Predicate, f.Object))
+			builder.WriteString(fmt.Sprintf("- %s %s %s%s%s\n", f.Subject, f.Predicate, f.Object, trustTag(f.Trust), c.knowledgeSource(f.ProjectPath)))
 		}
 	}
 
-	projectFacts, err := c.db.GetFactsAbout("project", c.projectPath, 5)
+	projectFacts, err := c.db.GetFactsAboutIn("project", paths, 5)
 	if err == nil && len(projectFacts) > 0 {
 		builder.WriteString("\n[Known project facts:]\n")
 		for _, f := range projectFacts {
-			builder.WriteString(fmt.Sprintf("- %s %s %s\n", f.Subject, f.Predicate, f.Object))
+			builder.WriteString(fmt.Sprintf("- %s %s %s%s%s\n", f.Subject, f.Predicate, f.Object, trustTag(f.Trust), c.knowledgeSource(f.ProjectPath)))
+		}
+	}
+}
+
+// loadFailingCommands lists commands that keep failing in the recalled
+// directories, so the model does not suggest them again.
+func (c *LLMClient) loadFailingCommands(builder *strings.Builder, paths []string) {
+	failing, err := c.db.FailingCommands(db.ProjectKeys(paths), 5)
+	if err != nil || len(failing) == 0 {
+		return
+	}
+	builder.WriteString("\n[Commands that failed here before; avoid them unless the cause was fixed:]\n")
+	for _, o := range failing {
+		builder.WriteString(fmt.Sprintf("- %s (exit %d, failed %d of %d times)", truncate(util.RedactSecrets(o.Command), 120), o.LastExitCode, o.FailureCount, o.FailureCount+o.SuccessCount))
+		if lines := strings.Split(strings.TrimSpace(o.LastError), "\n"); lines[len(lines)-1] != "" {
+			builder.WriteString(": " + truncate(util.RedactSecrets(lines[len(lines)-1]), 120))
 		}
+		builder.WriteString(c.knowledgeSource(o.ProjectPath) + "\n")
 	}
 }
 
@@ -163,17 +360,50 @@ func truncate(s string, maxLen int) string {
 	return s[:maxLen] + "..."
 }
 
-func (c *LLMClient) saveMessage(role, content string) {
-	if c.db == nil || c.sessionID == "" {
-		return
+// saveMessage queues a message for the session and returns its ID, or ""
+// when there is no memory database.
+func (c *LLMClient) saveMessage(role, content string) string {
+	if !c.ensureSession() {
+		return ""
 	}
 	tokenCount := len(content) / 4
-	c.db.AddMessage(c.sessionID, role, content, tokenCount)
+	return c.db.QueueMessage(c.sessionID, role, content, tokenCount)
 }
 
+// saveReply queues the assistant's reply with the model that wrote it and
+// how long the query took, and returns its ID.
+func (c *LLMClient) saveReply(content string, latency time.Duration) string {
+	if !c.ensureSession() {
+		return ""
+	}
+	return c.db.QueueReply(c.sessionID, content, len(content)/4, c.config.ModelName, latency)
+}
+
+// saveToolCalls stores the tools run for the reply that was just saved.
+func (c *LLMClient) saveToolCalls(messageID string) {
+	if messageID == "" {
+		return
+	}
+	for i, tc := range c.toolCalls {
+		tc.SessionID = c.sessionID
+		tc.MessageID = messageID
+		tc.Seq = i
+		c.db.QueueToolCall(tc)
+	}
+}
+
+// Close writes any queued history and closes the database. With
+// Q_DB_STATS set it reports what the background writer did.
 func (c *LLMClient) Close() {
 	if c.db != nil {
+		tools.InterruptAgents()
+		if c.backupDone != nil {
+			<-c.backupDone
+		}
 		c.db.Close()
+		if os.Getenv("Q_DB_STATS") != "" {
+			fmt.Fprintln(os.Stderr, "memory db:", c.db.WriteStats())
+		}
 	}
 }
 
@@ -203,7 +433,11 @@ type ToolCallPayload struct {
 }
 
 type ToolCallResponse struct {
-	ID      string `json:"id"`
+	ID    string `json:"id"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 	Choices []struct {
 		Index   int `json:"index"`
 		Message struct {
@@ -226,22 +460,32 @@ type OllamaPayload struct {
 }
 
 type OllamaResponse struct {
-	Model     string  `json:"model"`
-	CreatedAt string  `json:"created_at"`
-	Message   Message `json:"message"`
-	Done      bool    `json:"done"`
+	Model           string  `json:"model"`
+	CreatedAt       string  `json:"created_at"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
 }
 
-func (c *LLMClient) createRequest(payload interface{}) (*http.Request, error) {
+func (c *LLMClient) createRequest(ctx context.Context, payload interface{}) (*http.Request, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
-	req, err := http.NewRequest("POST", c.config.Endpoint, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.Endpoint, bytes.NewBuffer(payloadBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	c.setAuthHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// setAuthHeaders adds the API key and organization headers the model's
+// endpoint expects.
+func (c *LLMClient) setAuthHeaders(req *http.Request) {
 	if c.config.Auth != "" {
 		if c.config.AuthHeader != "" {
 			headerName := c.config.AuthHeader
@@ -262,39 +506,68 @@ func (c *LLMClient) createRequest(payload interface{}) (*http.Request, error) {
 	if c.config.OrgID != "" {
 		req.Header.Set("OpenAI-Organization", c.config.OrgID)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	return req, nil
 }
 
 func (c *LLMClient) Query(query string) (string, error) {
+	return c.QueryContext(context.Background(), query)
+}
+
+// QueryContext is Query with cancellation: cancelling ctx aborts the API
+// request and any tool call in flight. The query and reply pass through
+// the pre_query and post_response hooks.
+func (c *LLMClient) QueryContext(ctx context.Context, query string) (string, error) {
+	query, err := tools.RunPreQueryHooks(ctx, c.config.Name, query)
+	if err != nil {
+		return "", err
+	}
+	c.ensureDB()
+	c.injectKnowledge(query)
 	c.messages = append(c.messages, Message{Role: "user", Content: query})
+	c.toolCalls = nil
+	c.queryUsage = db.Usage{}
+	start := time.Now()
 
 	var finalContent string
-	var err error
 
-	if c.supportsTools() {
-		finalContent, err = c.queryWithTools()
+	if c.supportsTools() && len(tools.EnabledTools()) > 0 {
+		finalContent, err = c.queryWithTools(ctx)
 	} else if c.isOllamaCloud() || c.isOllamaLocal() {
-		finalContent, err = c.queryOllama()
+		finalContent, err = c.queryOllama(ctx)
 	} else {
-		finalContent, err = c.queryOpenAI()
+		finalContent, err = c.queryOpenAI(ctx)
+	}
+	if err == nil && ctx.Err() != nil {
+		// Streams end quietly when the request is cancelled mid-response.
+		err = ctx.Err()
 	}
 
 	if err != nil {
+		c.messages = c.messages[:len(c.messages)-1]
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
 		return "", err
 	}
 
-	c.messages = append(c.messages, Message{Role: "assistant", Content: finalContent})
+	finalContent = tools.RunPostResponseHooks(ctx, c.config.Name, query, finalContent)
 	c.saveMessage("user", query)
-	c.saveMessage("assistant", finalContent)
+	c.saveToolCalls(c.saveReply(finalContent, time.Since(start)))
+	c.finishUsage(finalContent)
+	c.messages = append(c.messages, Message{Role: "assistant", Content: finalContent})
 	return finalContent, nil
 }
 
-func (c *LLMClient) queryWithTools() (string, error) {
+func (c *LLMClient) queryWithTools(ctx context.Context) (string, error) {
 	maxIterations := 10
 	var toolMessages []interface{}
+	enabledTools := tools.EnabledTools()
 
 	for i := 0; i < maxIterations; i++ {
+		// Sub-agents can send main messages while it works, as they can
+		// each other.
+		if notice := tools.MainMailNotice(); notice != "" {
+			toolMessages = append(toolMessages, map[string]string{"role": "user", "content": notice})
+		}
 		var msgInterfaces []interface{}
 		for _, m := range c.messages {
 			msgInterfaces = append(msgInterfaces, map[string]string{
@@ -307,13 +580,13 @@ func (c *LLMClient) queryWithTools() (string, error) {
 		payload := ToolCallPayload{
 			Model:       c.config.ModelName,
 			Messages:    msgInterfaces,
-			Tools:       tools.AvailableTools,
+			Tools:       enabledTools,
 			ToolChoice:  "auto",
 			Temperature: 0,
 			Stream:      false,
 		}
 
-		req, err := c.createRequest(payload)
+		req, err := c.createRequest(ctx, payload)
 		if err != nil {
 			return "", err
 		}
@@ -334,6 +607,7 @@ func (c *LLMClient) queryWithTools() (string, error) {
 		if err := json.Unmarshal(body, &toolResp); err != nil {
 			return "", fmt.Errorf("failed to parse response: %w", err)
 		}
+		c.addUsage(toolResp.Usage.PromptTokens, toolResp.Usage.CompletionTokens)
 
 		if len(toolResp.Choices) == 0 {
 			return "", fmt.Errorf("no choices in response")
@@ -363,10 +637,22 @@ func (c *LLMClient) queryWithTools() (string, error) {
 				c.ToolCallback(tc.Function.Name, tc.Function.Arguments)
 			}
 
-			result, execErr := tools.ExecuteTool(tc.Function.Name, tc.Function.Arguments)
+			start := time.Now()
+			result, execErr := tools.ExecuteTool(ctx, tc.Function.Name, tc.Function.Arguments)
 			if execErr != nil {
 				result = fmt.Sprintf("Error: %v", execErr)
+			} else {
+				c.trackContextFile(tc.Function.Name, tc.Function.Arguments)
 			}
+			c.toolCalls = append(c.toolCalls, db.ToolCall{
+				CallID:     tc.ID,
+				Name:       tc.Function.Name,
+				Arguments:  tc.Function.Arguments,
+				Result:     result,
+				IsError:    execErr != nil,
+				DurationMS: time.Since(start).Milliseconds(),
+				CreatedAt:  start,
+			})
 
 			toolMsg := map[string]interface{}{
 				"role":         "tool",
@@ -380,31 +666,43 @@ func (c *LLMClient) queryWithTools() (string, error) {
 	return "", fmt.Errorf("max tool iterations reached")
 }
 
-func (c *LLMClient) queryOpenAI() (string, error) {
+func (c *LLMClient) queryOpenAI(ctx context.Context) (string, error) {
 	payload := Payload{
 		Model:       c.config.ModelName,
 		Messages:    c.messages,
 		Temperature: 0,
 		Stream:      true,
 	}
-
-	req, err := c.createRequest(payload)
-	if err != nil {
-		return "", err
+	if !c.noStreamUsage {
+		payload.StreamOptions = &StreamOptions{IncludeUsage: true}
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make API request: %w", err)
-	}
-	defer resp.Body.Close()
+	for {
+		req, err := c.createRequest(ctx, payload)
+		if err != nil {
+			return "", err
+		}
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed (%s): %s", resp.Status, string(body))
-	}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to make API request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			body, _ := io.ReadAll(resp.Body)
+			// Some OpenAI-compatible servers reject stream_options; ask
+			// them again without it, and their usage is estimated.
+			if resp.StatusCode == http.StatusBadRequest && payload.StreamOptions != nil && strings.Contains(string(body), "stream_options") {
+				c.noStreamUsage = true
+				payload.StreamOptions = nil
+				continue
+			}
+			return "", fmt.Errorf("API request failed (%s): %s", resp.Status, string(body))
+		}
 
-	return c.processOpenAIStream(resp)
+		return c.processOpenAIStream(resp)
+	}
 }
 
 func (c *LLMClient) processOpenAIStream(resp *http.Response) (string, error) {
@@ -429,6 +727,7 @@ func (c *LLMClient) processOpenAIStream(resp *http.Response) (string, error) {
 			if err := json.Unmarshal([]byte(payload), &responseData); err != nil {
 				continue
 			}
+			c.addUsage(responseData.Usage.PromptTokens, responseData.Usage.CompletionTokens)
 			if len(responseData.Choices) == 0 {
 				continue
 			}
@@ -442,14 +741,14 @@ func (c *LLMClient) processOpenAIStream(resp *http.Response) (string, error) {
 	return totalData, nil
 }
 
-func (c *LLMClient) queryOllama() (string, error) {
+func (c *LLMClient) queryOllama(ctx context.Context) (string, error) {
 	payload := OllamaPayload{
 		Model:    c.config.ModelName,
 		Messages: c.messages,
 		Stream:   true,
 	}
 
-	req, err := c.createRequest(payload)
+	req, err := c.createRequest(ctx, payload)
 	if err != nil {
 		return "", err
 	}
@@ -492,6 +791,7 @@ func (c *LLMClient) processOllamaStream(resp *http.Response) (string, error) {
 		}
 
 		if ollamaResp.Done {
+			c.addUsage(ollamaResp.PromptEvalCount, ollamaResp.EvalCount)
 			break
 		}
 	}
@@ -500,8 +800,42 @@ func (c *LLMClient) processOllamaStream(resp *http.Response) (string, error) {
 
 func (c *LLMClient) ClearMemory() error {
 	c.messages = c.messages[:c.initialPromptLen]
+	c.usage = db.Usage{}
 	if c.db != nil && c.sessionID != "" {
-		return c.db.DeleteSession(c.sessionID)
+		err := c.db.DeleteSession(c.sessionID)
+		c.sessionID = ""
+		return err
 	}
 	return nil
 }
+
+// TagSession tags the current conversation, starting its session if needed.
+func (c *LLMClient) TagSession(tag string) error {
+	c.ensureDB()
+	if !c.ensureSession() {
+		return fmt.Errorf("memory database is unavailable")
+	}
+	return c.db.TagSession(c.sessionID, tag)
+}
+
+// SessionTags returns the current conversation's tags and suggestions for
+// more, based on what has been said so far.
+func (c *LLMClient) SessionTags() (tags, suggested []string, err error) {
+	c.ensureDB()
+	if c.db == nil {
+		return nil, nil, fmt.Errorf("memory database is unavailable")
+	}
+	if c.sessionID == "" {
+		return nil, nil, nil
+	}
+	c.db.Flush()
+	current, err := c.db.GetSessionTags(c.sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range current {
+		tags = append(tags, t.Name)
+	}
+	suggested, err = c.db.SuggestTags(c.sessionID, 5)
+	return tags, suggested, err
+}
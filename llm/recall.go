@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"q/db"
+	"strings"
+)
+
+// Memory scopes, set with preferences.memory.scope.
+const (
+	ScopeProject = "project" // this directory only (default)
+	ScopeRepo    = "repo"    // directories that are clones of the same git remote
+	ScopeParent  = "parent"  // this directory's parent and everything under it
+	ScopeGlobal  = "global"  // every directory
+)
+
+// maxRecallProjects caps how many known directories are checked when
+// widening the scope to a repository or parent directory.
+const maxRecallProjects = 50
+
+// recallPaths returns the project paths whose memory is loaded, this one
+// first, or nil when every project is in scope.
+func (c *LLMClient) recallPaths() []string {
+	paths := []string{c.projectPath}
+	match := func(string) bool { return false }
+
+	switch memoryLoading.Scope {
+	case ScopeGlobal:
+		return nil
+	case ScopeParent:
+		parent := filepath.Dir(c.projectPath)
+		match = func(p string) bool {
+			return p == parent || strings.HasPrefix(p, parent+string(filepath.Separator))
+		}
+	case ScopeRepo:
+		remote := db.GitRemote(c.projectPath)
+		if remote == "" {
+			return paths
+		}
+		match = func(p string) bool { return db.GitRemote(p) == remote }
+	default:
+		return paths
+	}
+
+	known, err := c.db.ProjectPaths(maxRecallProjects)
+	if err != nil {
+		return paths
+	}
+	for _, p := range known {
+		if p != c.projectPath && match(p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// recallSource labels memory that came from somewhere other than this
+// directory, e.g. " (from ~/work/api)". It is empty for this directory.
+func (c *LLMClient) recallSource(projectPath string) string {
+	if projectPath == "" || projectPath == c.projectPath {
+		return ""
+	}
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(projectPath, home+string(filepath.Separator)) {
+		projectPath = "~" + projectPath[len(home):]
+	}
+	return " (from " + projectPath + ")"
+}
+
+// knowledgeSource labels knowledge stored under another project key than
+// this directory's, like recallSource.
+func (c *LLMClient) knowledgeSource(projectKey string) string {
+	if projectKey == db.ProjectKey(c.projectPath) {
+		return ""
+	}
+	return c.recallSource(projectKey)
+}
@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"q/db"
+	"strings"
+)
+
+// modelPrices are USD per million prompt and completion tokens for models
+// whose config sets no price, by model name prefix.
+var modelPrices = []struct {
+	prefix        string
+	input, output float64
+}{
+	{"gpt-4o-mini", 0.15, 0.60},
+	{"gpt-4o", 2.50, 10.00},
+	{"gpt-4.1-nano", 0.10, 0.40},
+	{"gpt-4.1-mini", 0.40, 1.60},
+	{"gpt-4.1", 2.00, 8.00},
+	{"gpt-4.5", 75.00, 150.00},
+	{"gpt-4-turbo", 10.00, 30.00},
+	{"gpt-4", 30.00, 60.00},
+	{"gpt-3.5-turbo", 0.50, 1.50},
+	{"o4-mini", 1.10, 4.40},
+	{"o3-mini", 1.10, 4.40},
+	{"o3", 2.00, 8.00},
+	{"o1-mini", 1.10, 4.40},
+	{"o1", 15.00, 60.00},
+}
+
+// prices returns the model's USD per million prompt and completion tokens,
+// or zeros when unknown. Local models are free.
+func (c *LLMClient) prices() (input, output float64) {
+	if c.config.InputPrice != 0 || c.config.OutputPrice != 0 {
+		return c.config.InputPrice, c.config.OutputPrice
+	}
+	if c.isOllamaLocal() {
+		return 0, 0
+	}
+	name := strings.ToLower(c.config.ModelName)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:] // e.g. openai/gpt-4o on OpenRouter
+	}
+	// The longest prefix that ends at a word wins, so gpt-4o-mini is not
+	// priced as gpt-4o, nor gpt-4o or gpt-4.5 as gpt-4.
+	best := -1
+	for i, p := range modelPrices {
+		rest, ok := strings.CutPrefix(name, p.prefix)
+		if !ok || rest != "" && rest[0] != '-' && rest[0] != ':' {
+			continue
+		}
+		if best < 0 || len(p.prefix) > len(modelPrices[best].prefix) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, 0
+	}
+	return modelPrices[best].input, modelPrices[best].output
+}
+
+// addUsage records tokens reported by the API for the current query.
+func (c *LLMClient) addUsage(prompt, completion int) {
+	c.queryUsage.PromptTokens += prompt
+	c.queryUsage.CompletionTokens += completion
+}
+
+// finishUsage prices the query that produced reply, estimating tokens at
+// four characters each when the API reported none, and adds it to the
+// session's totals.
+func (c *LLMClient) finishUsage(reply string) {
+	u := c.queryUsage
+	if u.Tokens() == 0 {
+		for _, m := range c.messages {
+			u.PromptTokens += len(m.Content) / 4
+		}
+		u.CompletionTokens = len(reply) / 4
+	}
+	input, output := c.prices()
+	u.Cost = (float64(u.PromptTokens)*input + float64(u.CompletionTokens)*output) / 1e6
+
+	c.usage = c.usage.Add(u)
+	if c.db != nil && c.sessionID != "" {
+		c.db.QueueUsage(c.sessionID, u)
+	}
+}
+
+// Usage returns the tokens used and estimated cost of this conversation.
+func (c *LLMClient) Usage() db.Usage {
+	return c.usage
+}
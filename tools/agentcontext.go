@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"fmt"
+	"q/types"
+	"strings"
+	"sync"
+)
+
+var conversationSource func() (messages []types.Message, files []string)
+
+// SetConversationSource installs the callback spawn_agent reads the
+// conversation so far from, without its system prompt, along with the
+// files read or written in it, when an agent is to be told about them.
+func SetConversationSource(source func() (messages []types.Message, files []string)) {
+	approvalMu.Lock()
+	conversationSource = source
+	approvalMu.Unlock()
+}
+
+const (
+	// agentContextBudget is how much of the conversation, in bytes, an
+	// agent is given as it is; longer conversations are summarized.
+	agentContextBudget = 6000
+	// agentContextInput caps how much of a long conversation, keeping the
+	// end, is sent to be summarized.
+	agentContextInput = 60000
+	// agentContextFiles caps how many of the conversation's files are
+	// listed.
+	agentContextFiles = 30
+)
+
+// conversationExcerpt returns the conversation so far and the files it
+// touched as text for an agent's prompt, or "" if there is none.
+func conversationExcerpt() string {
+	approvalMu.Lock()
+	source := conversationSource
+	approvalMu.Unlock()
+	if source == nil {
+		return ""
+	}
+	messages, files := source()
+
+	var b strings.Builder
+	for _, m := range messages {
+		if strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		who := "User"
+		if m.Role == "assistant" {
+			who = "Assistant"
+		}
+		b.WriteString(fmt.Sprintf("%s: %s\n\n", who, strings.TrimSpace(m.Content)))
+	}
+	excerpt := b.String()
+	if len(files) > 0 {
+		if len(files) > agentContextFiles {
+			files = files[len(files)-agentContextFiles:]
+		}
+		excerpt += "Files read or written so far: " + strings.Join(files, ", ") + "\n"
+	}
+	return strings.TrimSpace(excerpt)
+}
+
+var (
+	// parentSummaries caches summaries of conversations, so that agents
+	// spawned together do not each have the same one written.
+	parentSummaries   = make(map[string]string)
+	parentSummariesMu sync.Mutex
+)
+
+// parentContext fits excerpt into an agent's prompt, having the session's
+// model summarize it when it is long. Should that fail, the end of the
+// conversation is kept.
+func parentContext(excerpt string) string {
+	if len(excerpt) <= agentContextBudget {
+		return excerpt
+	}
+	parentSummariesMu.Lock()
+	defer parentSummariesMu.Unlock()
+	if summary, ok := parentSummaries[excerpt]; ok {
+		return summary
+	}
+
+	input := excerpt
+	if len(input) > agentContextInput {
+		input = "..." + input[len(input)-agentContextInput:]
+	}
+	summary, err := Complete("Summarize this conversation between a user and an assistant for a sub-agent the assistant is handing part of the work to. "+
+		"Keep what has been decided, the user's requirements and preferences, what was found out, and the files and commands involved; leave out chatter. "+
+		"Write it as notes, in at most 400 words.", input)
+	if err != nil || summary == "" {
+		return "..." + excerpt[len(excerpt)-agentContextBudget:]
+	}
+	parentSummaries[excerpt] = summary
+	return summary
+}
@@ -0,0 +1,186 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"q/types"
+	"q/util"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	agentPrefs   types.AgentsConfig
+	agentModels  []types.ModelConfig
+	agentPrefsMu sync.Mutex
+)
+
+// SetAgentPreferences installs the agents: preferences, with the models
+// from the config that they and spawn_agent may name.
+func SetAgentPreferences(prefs types.AgentsConfig, models []types.ModelConfig) {
+	agentPrefsMu.Lock()
+	agentPrefs = prefs
+	agentModels = models
+	agentPrefsMu.Unlock()
+}
+
+// agentRolePreset returns the preset for role, with the default model
+// filled in when it names none. It fails if the preset lists a tool or
+// category that does not exist.
+func agentRolePreset(role string) (types.AgentRoleConfig, error) {
+	agentPrefsMu.Lock()
+	preset := agentPrefs.Roles[role]
+	if preset.Model == "" {
+		preset.Model = agentPrefs.Model
+	}
+	agentPrefsMu.Unlock()
+
+	for _, name := range preset.Tools {
+		if !isCategory(name) && !toolRegistered(name) {
+			return preset, fmt.Errorf("role %s lists unknown tool or category %q", role, name)
+		}
+	}
+	return preset, nil
+}
+
+// resolveAgentModel returns the configured model called name, with its
+// API key from the environment, or the session's model if name is empty or
+// names it.
+func resolveAgentModel(name string) (agentModel, error) {
+	if name == "" || (name == agentConfig.name && !configuredAgentModel(name)) {
+		if agentConfig.endpoint == "" || agentConfig.apiKey == "" {
+			return agentModel{}, fmt.Errorf("agent config not initialized - API endpoint and key required")
+		}
+		return agentConfig, nil
+	}
+
+	agentPrefsMu.Lock()
+	defer agentPrefsMu.Unlock()
+	var available []string
+	for _, m := range agentModels {
+		if m.Name != name {
+			available = append(available, m.Name)
+			continue
+		}
+		model := agentModel{name: m.Name, endpoint: m.Endpoint, modelName: m.ModelName, authHeader: m.AuthHeader}
+		if m.Auth != "" {
+			if model.apiKey = util.APIKey(m.Auth, m.AuthSource); model.apiKey == "" {
+				return agentModel{}, fmt.Errorf("model %s needs %s to be set", name, m.Auth)
+			}
+		}
+		return model, nil
+	}
+	sort.Strings(available)
+	return agentModel{}, fmt.Errorf("model %q not found. Available: %s", name, strings.Join(available, ", "))
+}
+
+// configuredAgentModel reports whether the config has a model called name.
+func configuredAgentModel(name string) bool {
+	agentPrefsMu.Lock()
+	defer agentPrefsMu.Unlock()
+	for _, m := range agentModels {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// roleAllowsTool reports whether a role limited to allowed, a list of
+// tools and tool categories, may use the tool called name.
+func roleAllowsTool(allowed []string, name string) bool {
+	registryMu.RLock()
+	category := toolCategoryOf[name]
+	registryMu.RUnlock()
+	for _, a := range allowed {
+		if a == name || a == category {
+			return true
+		}
+	}
+	return false
+}
+
+// agentToolScope returns the tools an agent may use, given its role
+// preset's tools and those spawn_agent asked for, each a list of tool and
+// category names or nil for no limit. An agent with both may only use
+// tools that are in both.
+func agentToolScope(preset, requested []string) ([]string, error) {
+	for _, name := range requested {
+		if !isCategory(name) && !toolRegistered(name) {
+			return nil, fmt.Errorf("unknown tool or category %q", name)
+		}
+	}
+	switch {
+	case requested == nil:
+		return preset, nil
+	case preset == nil:
+		return requested, nil
+	}
+
+	registryMu.RLock()
+	names := make([]string, 0, len(toolCategoryOf))
+	for name := range toolCategoryOf {
+		names = append(names, name)
+	}
+	registryMu.RUnlock()
+	sort.Strings(names)
+	kept := []string{}
+	for _, name := range names {
+		if roleAllowsTool(preset, name) && roleAllowsTool(requested, name) {
+			kept = append(kept, name)
+		}
+	}
+	return kept, nil
+}
+
+type toolScopeKey struct{}
+
+// toolScope is the tools an agent is limited to.
+type toolScope struct {
+	role    string
+	allowed []string
+}
+
+// withToolScope limits the tools run under ctx to allowed, a list of tool
+// and category names, for an agent in role.
+func withToolScope(ctx context.Context, role string, allowed []string) context.Context {
+	return context.WithValue(ctx, toolScopeKey{}, toolScope{role: role, allowed: allowed})
+}
+
+// checkToolScope fails if ctx is limited to tools that do not include the
+// one called name. The categories enabled for the session apply as well,
+// so a scope can only narrow them.
+func checkToolScope(ctx context.Context, name string) error {
+	scope, ok := ctx.Value(toolScopeKey{}).(toolScope)
+	if !ok || scopeExempt(name) || roleAllowsTool(scope.allowed, name) {
+		return nil
+	}
+	if len(scope.allowed) == 0 {
+		return fmt.Errorf("this %s agent may not use any tools", scope.role)
+	}
+	return fmt.Errorf("this %s agent may not use %s, only %s", scope.role, name, strings.Join(scope.allowed, ", "))
+}
+
+// scopeExempt reports whether name is one of the tools agents share notes
+// and messages or ask the user with, which every agent may use whatever
+// tools it is limited to.
+func scopeExempt(name string) bool {
+	switch name {
+	case "write_note", "read_note", "ask_user", "send_to_agent", "read_inbox":
+		return true
+	}
+	return false
+}
+
+// filterRoleTools keeps the tools an agent limited to allowed may use,
+// along with those every agent has.
+func filterRoleTools(tools []Tool, allowed []string) []Tool {
+	var kept []Tool
+	for _, t := range tools {
+		if scopeExempt(t.Function.Name) || roleAllowsTool(allowed, t.Function.Name) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"q/db"
 	"strings"
 	"sync"
 	"time"
@@ -25,7 +27,130 @@ type AgentTask struct {
 	EndTime    time.Time
 	Done       bool
 	TokensUsed int
-	cancel     context.CancelFunc
+	// Iteration is the round of the agent's loop it is in, CurrentTool the
+	// tool it is running, if any, and Finding the latest of what it has
+	// said along the way.
+	Iteration   int
+	CurrentTool string
+	Finding     string
+	// Attempt is 2 once the agent has failed and is trying again.
+	Attempt int
+	// Model is the name of the model the agent runs on.
+	Model string
+	// ctx is what the agent runs under once it leaves the queue.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// model is what the agent calls and prompt comes from its role's
+	// preset. tools is what it may use, from the preset and spawn_agent,
+	// nil for everything; requestedTools is what spawn_agent asked for.
+	model          agentModel
+	prompt         string
+	tools          []string
+	requestedTools []string
+	// runID is the agent's row in agent_runs, project the project it was
+	// spawned in, and transcript its messages so far.
+	runID      int64
+	project    string
+	transcript []interface{}
+	// calls are the tools the agent has run, in order.
+	calls []agentToolCall
+	// parent is the conversation the agent was spawned from, when it is
+	// to be told about it.
+	parent string
+}
+
+// agentToolCall is a tool an agent ran, for get_agent_result to show what
+// it did.
+type agentToolCall struct {
+	name     string
+	args     string
+	duration time.Duration
+	err      string
+	attempt  int
+}
+
+// agentMaxIterations is how many rounds of tool calls an agent gets.
+const agentMaxIterations = 15
+
+// AgentEvent is a snapshot of a sub-agent's progress, sent whenever it
+// moves on.
+type AgentEvent struct {
+	ID     string
+	Role   string
+	Model  string
+	Task   string
+	Status string
+	// Iteration counts rounds of the agent's loop, of MaxIterations.
+	Iteration     int
+	MaxIterations int
+	// Tool is the tool being run, if any, with its arguments.
+	Tool string
+	Args string
+	// Finding is what the agent has said so far, or once it is Done, its
+	// result or error.
+	Finding string
+	Tokens  int
+	Started time.Time
+	Done    bool
+	// RunID is the agent's row in the database, if it is kept there.
+	RunID int64
+	// QueuePosition is the agent's place in the queue, from 1, while it
+	// waits for another to finish.
+	QueuePosition int
+}
+
+// agentEvents carries AgentEvents to the TUI. Sending never blocks an
+// agent; progress nobody reads in time is dropped, while an agent's last
+// event waits up to agentDoneWait for room, so the TUI does not go on
+// showing it running.
+var agentEvents = make(chan AgentEvent, 64)
+
+// agentDoneWait is how long a finished agent's last event waits to be
+// read; without a TUI reading them, nothing does.
+const agentDoneWait = 10 * time.Second
+
+// AgentEvents returns the channel sub-agents report their progress on.
+func AgentEvents() <-chan AgentEvent {
+	return agentEvents
+}
+
+type agentIDKey struct{}
+
+// agentIDOf returns the ID of the agent running tools under ctx, or "" in
+// the main conversation.
+func agentIDOf(ctx context.Context) string {
+	id, _ := ctx.Value(agentIDKey{}).(string)
+	return id
+}
+
+// reportAgent sends agent's progress, with args for the tool it is
+// running.
+func reportAgent(agent *AgentTask, args string) {
+	agentMutex.RLock()
+	event := AgentEvent{ID: agent.ID, Role: agent.Role, Model: agent.Model, Task: agent.Task, Status: agent.Status,
+		Iteration: agent.Iteration, MaxIterations: agentMaxIterations, Tool: agent.CurrentTool, Args: args,
+		Finding: agent.Finding, Tokens: agent.TokensUsed, Started: agent.StartTime, Done: agent.Done, RunID: agent.runID,
+		QueuePosition: queuePosition(agent)}
+	if agent.Done {
+		event.Finding = agent.Result
+		if agent.Error != "" {
+			event.Finding = agent.Error
+		}
+	}
+	agentMutex.RUnlock()
+
+	select {
+	case agentEvents <- event:
+	default:
+		if event.Done {
+			go func() {
+				select {
+				case agentEvents <- event:
+				case <-time.After(agentDoneWait):
+				}
+			}()
+		}
+	}
 }
 
 var (
@@ -34,14 +159,187 @@ var (
 	agentCounter int
 )
 
-var agentConfig struct {
+// defaultMaxConcurrentAgents is how many agents run at once unless the
+// config says otherwise.
+const defaultMaxConcurrentAgents = 4
+
+var (
+	// agentQueue holds the agents waiting to start, oldest first, and
+	// agentsRunning counts those started and not yet finished. Both are
+	// guarded by agentMutex.
+	agentQueue    []*AgentTask
+	agentsRunning int
+)
+
+// maxConcurrentAgents returns how many agents may run at once, 0 for no
+// limit.
+func maxConcurrentAgents() int {
+	agentPrefsMu.Lock()
+	n := agentPrefs.MaxConcurrent
+	agentPrefsMu.Unlock()
+	switch {
+	case n < 0:
+		return 0
+	case n == 0:
+		return defaultMaxConcurrentAgents
+	}
+	return n
+}
+
+// startQueuedAgents starts agents from the front of the queue while there
+// are free slots, and reports where the rest now stand.
+func startQueuedAgents() {
+	limit := maxConcurrentAgents()
+	var started []*AgentTask
+	agentMutex.Lock()
+	for len(agentQueue) > 0 && (limit == 0 || agentsRunning < limit) {
+		agent := agentQueue[0]
+		agentQueue = agentQueue[1:]
+		agent.Status = "running"
+		agentsRunning++
+		started = append(started, agent)
+	}
+	waiting := append([]*AgentTask(nil), agentQueue...)
+	agentMutex.Unlock()
+
+	for _, agent := range started {
+		reportAgent(agent, "")
+		go runAgent(agent.ctx, agent)
+	}
+	for _, agent := range waiting {
+		reportAgent(agent, "")
+	}
+}
+
+// queuePosition returns agent's place in the queue, from 1, or 0 if it is
+// not waiting. agentMutex must be held.
+func queuePosition(agent *AgentTask) int {
+	for i, queued := range agentQueue {
+		if queued == agent {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// stopAgent cancels agent, taking it off the queue if it has not started.
+// It reports false if the agent had already finished.
+func stopAgent(agent *AgentTask) bool {
+	agentMutex.Lock()
+	if agent.Done {
+		agentMutex.Unlock()
+		return false
+	}
+	queued := false
+	if i := queuePosition(agent) - 1; i >= 0 {
+		agentQueue = append(agentQueue[:i:i], agentQueue[i+1:]...)
+		agent.Status = "cancelled"
+		agent.Error = "Cancelled by user"
+		agent.EndTime = time.Now()
+		agent.Done = true
+		dropMailbox(agent.ID)
+		queued = true
+	}
+	if agent.cancel != nil {
+		agent.cancel()
+	}
+	agentMutex.Unlock()
+
+	if queued {
+		saveAgentRun(agent)
+		reportAgent(agent, "")
+		startQueuedAgents()
+	}
+	return true
+}
+
+var (
+	// agentSaveMu orders writes of agent runs with InterruptAgents, after
+	// which agentsInterrupted stops them, the database being about to close.
+	agentSaveMu       sync.Mutex
+	agentsInterrupted bool
+)
+
+// saveAgentRun records agent's progress in the database, so that it
+// outlives the session.
+func saveAgentRun(agent *AgentTask) {
+	if knowledgeDB == nil {
+		return
+	}
+	agentMutex.RLock()
+	run := agentRunOf(agent)
+	agentMutex.RUnlock()
+
+	agentSaveMu.Lock()
+	defer agentSaveMu.Unlock()
+	if agentsInterrupted || knowledgeDB.SaveAgentRun(&run) != nil {
+		return
+	}
+	agentMutex.Lock()
+	agent.runID = run.ID
+	agentMutex.Unlock()
+}
+
+// agentRunOf returns agent as a row of agent_runs. agentMutex must be held.
+func agentRunOf(agent *AgentTask) db.AgentRun {
+	run := db.AgentRun{ID: agent.runID, AgentID: agent.ID, ProjectPath: agent.project, Role: agent.Role,
+		Model: agent.Model, Task: agent.Task, Status: agent.Status, Result: agent.Result, Error: agent.Error,
+		Tools: agent.requestedTools, Tokens: agent.TokensUsed, Iterations: agent.Iteration, StartedAt: agent.StartTime}
+	if agent.Done {
+		ended := agent.EndTime
+		run.EndedAt = &ended
+	}
+	if len(agent.transcript) > 0 {
+		if data, err := json.Marshal(agent.transcript); err == nil {
+			run.Transcript = string(data)
+		}
+	}
+	return run
+}
+
+// InterruptAgents records the agents still running as interrupted, since
+// the session is ending and they end with it. Nothing more is saved of
+// them afterwards, so it must run before the database is closed.
+func InterruptAgents() {
+	agentSaveMu.Lock()
+	defer agentSaveMu.Unlock()
+	agentsInterrupted = true
+	if knowledgeDB == nil {
+		return
+	}
+
+	var runs []db.AgentRun
+	agentMutex.RLock()
+	for _, agent := range agentTasks {
+		if agent.Done || agent.runID == 0 {
+			continue
+		}
+		run := agentRunOf(agent)
+		now := time.Now()
+		run.Status, run.Error, run.EndedAt = "interrupted", "The session ended before the agent finished", &now
+		runs = append(runs, run)
+	}
+	agentMutex.RUnlock()
+	for i := range runs {
+		knowledgeDB.SaveAgentRun(&runs[i])
+	}
+}
+
+// agentModel is a model sub-agents and Complete can call.
+type agentModel struct {
+	// name is the model's name in the config, or its model name.
+	name       string
 	endpoint   string
 	modelName  string
 	apiKey     string
 	authHeader string
 }
 
+// agentConfig is the session's model, which agents use by default.
+var agentConfig agentModel
+
 func InitAgentConfig(endpoint, modelName, apiKey, authHeader string) {
+	agentConfig.name = modelName
 	agentConfig.endpoint = endpoint
 	agentConfig.modelName = modelName
 	agentConfig.apiKey = apiKey
@@ -58,7 +356,10 @@ var AgentTools = []Tool{
 				"type": "object",
 				"properties": {
 					"task": {"type": "string", "description": "Detailed task description for the agent"},
-					"role": {"type": "string", "description": "Agent role/specialty (e.g., 'researcher', 'coder', 'reviewer')"}
+					"role": {"type": "string", "description": "Agent role/specialty (e.g., 'researcher', 'coder', 'reviewer'). Roles with a preset in the config bring their own model, prompt and tools."},
+					"model": {"type": "string", "description": "Name of a configured model to run the agent on, instead of the role's or the default"},
+					"tools": {"type": "array", "items": {"type": "string"}, "description": "Tools and tool categories the agent may use, e.g. [read_file, search_files, git_diff] for a reviewer that changes nothing (default all, or the role's)"},
+					"with_context": {"type": "boolean", "description": "Give the agent a summary of this conversation and the files read in it, when the task builds on what has been established"}
 				},
 				"required": ["task"],
 				"additionalProperties": false
@@ -85,7 +386,8 @@ var AgentTools = []Tool{
 			Parameters: json.RawMessage(`{
 				"type": "object",
 				"properties": {
-					"agent_id": {"type": "string", "description": "Agent ID to get result from"}
+					"agent_id": {"type": "string", "description": "Agent ID to get result from"},
+					"transcript": {"type": "boolean", "description": "Also list every tool call the agent made, with its arguments and how long it took"}
 				},
 				"required": ["agent_id"],
 				"additionalProperties": false
@@ -101,7 +403,8 @@ var AgentTools = []Tool{
 				"type": "object",
 				"properties": {
 					"agent_id": {"type": "string", "description": "Agent ID to wait for"},
-					"timeout_seconds": {"type": "integer", "description": "Max seconds to wait (default 120)"}
+					"timeout_seconds": {"type": "integer", "description": "Max seconds to wait (default 120)"},
+					"transcript": {"type": "boolean", "description": "Also list every tool call the agent made"}
 				},
 				"required": ["agent_id"],
 				"additionalProperties": false
@@ -126,7 +429,7 @@ var AgentTools = []Tool{
 }
 
 func init() {
-	AvailableTools = append(AvailableTools, AgentTools...)
+	RegisterTools("agents", AgentTools...)
 }
 
 type agentMessage struct {
@@ -159,17 +462,67 @@ type agentResponse struct {
 
 func spawnAgent(args map[string]interface{}) (string, error) {
 	task, _ := args["task"].(string)
+	role, _ := args["role"].(string)
+	modelName, _ := args["model"].(string)
+	var tools []string
+	if list, ok := args["tools"].([]interface{}); ok {
+		tools = []string{}
+		for _, t := range list {
+			if name, ok := t.(string); ok {
+				tools = append(tools, name)
+			}
+		}
+	}
+	withContext, _ := args["with_context"].(bool)
+	agentID, err := SpawnAgent(task, role, modelName, tools, withContext)
+	if err != nil {
+		return "", err
+	}
+
+	agentMutex.RLock()
+	agent := agentTasks[agentID]
+	position := queuePosition(agent)
+	agentMutex.RUnlock()
+
+	spawned := fmt.Sprintf("Spawned %s (role: %s, model: %s)", agentID, agent.Role, agent.Model)
+	if position > 0 {
+		spawned += fmt.Sprintf("\nQueued at position %d: %d agents run at once, and it starts when one before it finishes", position, maxConcurrentAgents())
+	}
+	return fmt.Sprintf("%s\nTask: %s", spawned, truncateStr(task, 100)), nil
+}
+
+// SpawnAgent starts a sub-agent on task in the background, or queues it
+// while as many agents as may run at once are running, and returns its ID. role defaults to assistant, and modelName to the role's model or the
+// session's. tools limits the agent to those tools and categories, within
+// what its role allows; nil leaves it to the role. withContext tells the
+// agent about the conversation so far.
+func SpawnAgent(task, role, modelName string, tools []string, withContext bool) (string, error) {
 	if task == "" {
 		return "", fmt.Errorf("task required")
 	}
-
-	role := "assistant"
-	if r, ok := args["role"].(string); ok && r != "" {
-		role = r
+	if role == "" {
+		role = "assistant"
 	}
 
-	if agentConfig.endpoint == "" || agentConfig.apiKey == "" {
-		return "", fmt.Errorf("agent config not initialized - API endpoint and key required")
+	preset, err := agentRolePreset(role)
+	if err != nil {
+		return "", err
+	}
+	if modelName == "" {
+		modelName = preset.Model
+	}
+	model, err := resolveAgentModel(modelName)
+	if err != nil {
+		return "", err
+	}
+	scope, err := agentToolScope(preset.Tools, tools)
+	if err != nil {
+		return "", err
+	}
+	cwd, _ := os.Getwd()
+	var parent string
+	if withContext {
+		parent = conversationExcerpt()
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -178,19 +531,32 @@ func spawnAgent(args map[string]interface{}) (string, error) {
 	agentCounter++
 	agentID := fmt.Sprintf("agent_%d", agentCounter)
 	agent := &AgentTask{
-		ID:        agentID,
-		Task:      task,
-		Role:      role,
-		Status:    "running",
-		StartTime: time.Now(),
-		cancel:    cancel,
+		ID:             agentID,
+		Task:           task,
+		Role:           role,
+		Status:         "queued",
+		StartTime:      time.Now(),
+		Model:          model.name,
+		ctx:            ctx,
+		cancel:         cancel,
+		model:          model,
+		prompt:         preset.Prompt,
+		tools:          scope,
+		project:        db.ProjectKey(cwd),
+		requestedTools: tools,
+		parent:         parent,
 	}
 	agentTasks[agentID] = agent
 	agentMutex.Unlock()
 
-	go runAgent(ctx, agent)
-
-	return fmt.Sprintf("Spawned %s (role: %s)\nTask: %s", agentID, role, truncateStr(task, 100)), nil
+	// Saved before it is queued, so that it has its row before anything
+	// else records it.
+	saveAgentRun(agent)
+	agentMutex.Lock()
+	agentQueue = append(agentQueue, agent)
+	agentMutex.Unlock()
+	startQueuedAgents()
+	return agentID, nil
 }
 
 func truncateStr(s string, n int) string {
@@ -201,26 +567,78 @@ func truncateStr(s string, n int) string {
 }
 
 func runAgent(ctx context.Context, agent *AgentTask) {
+	// previous holds the messages of a failed attempt, once the agent
+	// is retried.
+	var previous, messages, toolMessages []interface{}
+	transcript := func() []interface{} {
+		return append(append(append([]interface{}{}, previous...), messages...), toolMessages...)
+	}
 	defer func() {
 		agentMutex.Lock()
 		agent.EndTime = time.Now()
 		agent.Done = true
+		agent.CurrentTool = ""
+		agent.transcript = transcript()
+		agentsRunning--
+		dropMailbox(agent.ID)
 		agentMutex.Unlock()
+		saveAgentRun(agent)
+		reportAgent(agent, "")
+		startQueuedAgents()
 	}()
 
-	systemPrompt := fmt.Sprintf(`You are a focused sub-agent with role: %s
+	ctx = context.WithValue(ctx, agentIDKey{}, agent.ID)
+	// The task is sent to the model like any query, so the pre_query hooks
+	// guard it too.
+	task, err := RunPreQueryHooks(ctx, agent.Model, agent.Task)
+	if err != nil {
+		agentMutex.Lock()
+		agent.Status = "failed"
+		agent.Error = err.Error()
+		agentMutex.Unlock()
+		return
+	}
+	agentToolsForSubagent := filterAgentTools(EnabledTools())
+	if agent.tools != nil {
+		agentToolsForSubagent = filterRoleTools(agentToolsForSubagent, agent.tools)
+		ctx = withToolScope(ctx, agent.Role, agent.tools)
+	}
+
+	role := "You are a focused sub-agent with role: " + agent.Role
+	if agent.prompt != "" {
+		role = "You are a focused sub-agent. " + agent.prompt
+	}
+	toolsLine := "You have access to tools for file operations, commands, git, SSH, and network tasks."
+	if agent.tools != nil {
+		var names []string
+		for _, t := range agentToolsForSubagent {
+			names = append(names, t.Function.Name)
+		}
+		toolsLine = "You have access to these tools: " + strings.Join(names, ", ") + "."
+		if len(names) == 0 {
+			toolsLine = "You have no tools; work from the task and what you know."
+		}
+	}
+	systemPrompt := fmt.Sprintf(`%s
 
 Your task: %s
 
-You have access to tools for file operations, commands, git, SSH, and network tasks.
+%s
 Work autonomously to complete your task. Be thorough but efficient.
-When done, provide a clear summary of what you accomplished or found.`, agent.Role, agent.Task)
-
-	agentToolsForSubagent := filterAgentTools(AvailableTools)
+Other agents may be working alongside you: write findings they could use
+to a note with write_note as you go, and check read_note for theirs.
+To tell one of them, or main (who spawned you), something directly, use
+send_to_agent; you will be told when messages arrive for you.
+If the task leaves open a choice that matters, ask the user with ask_user
+rather than guessing.
+When done, provide a clear summary of what you accomplished or found.`, role, task, toolsLine)
+	if agent.parent != "" {
+		systemPrompt += "\n\nYou were spawned from this conversation, which the task builds on:\n\n" + parentContext(agent.parent)
+	}
 
-	messages := []interface{}{
+	messages = []interface{}{
 		map[string]string{"role": "system", "content": systemPrompt},
-		map[string]string{"role": "user", "content": agent.Task},
+		map[string]string{"role": "user", "content": task},
 	}
 
 	retryClient := retryablehttp.NewClient()
@@ -231,142 +649,278 @@ When done, provide a clear summary of what you accomplished or found.`, agent.Ro
 	httpClient := retryClient.StandardClient()
 	httpClient.Timeout = 5 * time.Minute
 
-	maxIterations := 15
-	var toolMessages []interface{}
 	var totalTokens int
 
-	for i := 0; i < maxIterations; i++ {
-		select {
-		case <-ctx.Done():
+	for attempt := 1; ; attempt++ {
+		failure := "Agent reached maximum iterations without final response"
+		for i := 0; i < agentMaxIterations; i++ {
+			select {
+			case <-ctx.Done():
+				agentMutex.Lock()
+				agent.Status = "cancelled"
+				agent.Error = "Cancelled by user"
+				agentMutex.Unlock()
+				return
+			default:
+			}
+
+			if notice := newMailNotice(agent.ID); notice != "" {
+				toolMessages = append(toolMessages, map[string]string{"role": "user", "content": notice})
+			}
+
 			agentMutex.Lock()
-			agent.Status = "cancelled"
-			agent.Error = "Cancelled by user"
+			agent.Iteration = i + 1
+			agent.CurrentTool = ""
+			agent.transcript = transcript()
 			agentMutex.Unlock()
-			return
-		default:
-		}
+			saveAgentRun(agent)
+			reportAgent(agent, "")
+
+			allMessages := append(messages, toolMessages...)
+
+			payload := agentPayload{
+				Model:       agent.model.modelName,
+				Messages:    allMessages,
+				Tools:       agentToolsForSubagent,
+				ToolChoice:  "auto",
+				Temperature: 0,
+				Stream:      false,
+			}
 
-		allMessages := append(messages, toolMessages...)
+			req, err := newAgentRequest(ctx, agent.model, payload)
+			if err != nil {
+				failure = err.Error()
+				break
+			}
 
-		payload := agentPayload{
-			Model:       agentConfig.modelName,
-			Messages:    allMessages,
-			Tools:       agentToolsForSubagent,
-			ToolChoice:  "auto",
-			Temperature: 0,
-			Stream:      false,
-		}
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				failure = err.Error()
+				break
+			}
 
-		payloadBytes, _ := json.Marshal(payload)
-		req, err := http.NewRequestWithContext(ctx, "POST", agentConfig.endpoint, bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			agentMutex.Lock()
-			agent.Status = "failed"
-			agent.Error = err.Error()
-			agentMutex.Unlock()
-			return
-		}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
 
-		if agentConfig.authHeader != "" {
-			if strings.ToLower(agentConfig.authHeader) == "authorization" {
-				req.Header.Set(agentConfig.authHeader, "Bearer "+agentConfig.apiKey)
-			} else {
-				req.Header.Set(agentConfig.authHeader, agentConfig.apiKey)
+			if resp.StatusCode != 200 {
+				failure = fmt.Sprintf("API error %d: %s", resp.StatusCode, string(body))
+				break
 			}
-		} else {
-			req.Header.Set("Authorization", "Bearer "+agentConfig.apiKey)
-		}
-		req.Header.Set("Content-Type", "application/json")
 
-		resp, err := httpClient.Do(req)
-		if err != nil {
+			var apiResp agentResponse
+			if err := json.Unmarshal(body, &apiResp); err != nil {
+				failure = "Failed to parse API response"
+				break
+			}
+
+			totalTokens += apiResp.Usage.TotalTokens
 			agentMutex.Lock()
-			agent.Status = "failed"
-			agent.Error = err.Error()
+			agent.TokensUsed = totalTokens
 			agentMutex.Unlock()
-			return
-		}
 
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
+			if len(apiResp.Choices) == 0 {
+				failure = "No response choices"
+				break
+			}
 
-		if resp.StatusCode != 200 {
-			agentMutex.Lock()
-			agent.Status = "failed"
-			agent.Error = fmt.Sprintf("API error %d: %s", resp.StatusCode, string(body))
-			agentMutex.Unlock()
-			return
+			choice := apiResp.Choices[0]
+
+			if len(choice.Message.ToolCalls) == 0 {
+				toolMessages = append(toolMessages, map[string]string{"role": "assistant", "content": choice.Message.Content})
+				agentMutex.Lock()
+				agent.Status = "completed"
+				agent.Result = choice.Message.Content
+				agent.TokensUsed = totalTokens
+				agentMutex.Unlock()
+				return
+			}
+
+			assistantMsg := map[string]interface{}{
+				"role":       "assistant",
+				"tool_calls": choice.Message.ToolCalls,
+			}
+			if choice.Message.Content != "" {
+				assistantMsg["content"] = choice.Message.Content
+				agentMutex.Lock()
+				agent.Finding = choice.Message.Content
+				agentMutex.Unlock()
+			}
+			toolMessages = append(toolMessages, assistantMsg)
+
+			for _, tc := range choice.Message.ToolCalls {
+				if isAgentTool(tc.Function.Name) {
+					toolMsg := map[string]interface{}{
+						"role":         "tool",
+						"tool_call_id": tc.ID,
+						"content":      "Sub-agents cannot spawn other agents",
+					}
+					toolMessages = append(toolMessages, toolMsg)
+					continue
+				}
+
+				agentMutex.Lock()
+				agent.CurrentTool = tc.Function.Name
+				agentMutex.Unlock()
+				reportAgent(agent, tc.Function.Arguments)
+
+				started := time.Now()
+				result, execErr := ExecuteTool(ctx, tc.Function.Name, tc.Function.Arguments)
+				call := agentToolCall{name: tc.Function.Name, args: tc.Function.Arguments,
+					duration: time.Since(started), attempt: attempt}
+				if execErr != nil {
+					result = fmt.Sprintf("Error: %v", execErr)
+					call.err = execErr.Error()
+				}
+				agentMutex.Lock()
+				agent.calls = append(agent.calls, call)
+				agentMutex.Unlock()
+
+				toolMsg := map[string]interface{}{
+					"role":         "tool",
+					"tool_call_id": tc.ID,
+					"content":      result,
+				}
+				toolMessages = append(toolMessages, toolMsg)
+			}
 		}
 
-		var apiResp agentResponse
-		if err := json.Unmarshal(body, &apiResp); err != nil {
+		if attempt > 1 || ctx.Err() != nil || !agentRetries() {
 			agentMutex.Lock()
 			agent.Status = "failed"
-			agent.Error = "Failed to parse API response"
+			agent.Error = failure
+			agent.TokensUsed = totalTokens
 			agentMutex.Unlock()
 			return
 		}
 
-		totalTokens += apiResp.Usage.TotalTokens
-
-		if len(apiResp.Choices) == 0 {
-			agentMutex.Lock()
-			agent.Status = "failed"
-			agent.Error = "No response choices"
-			agentMutex.Unlock()
-			return
+		// Once more from the start, told what went wrong and what the
+		// failed attempt did so it can pick up from there.
+		retry := agentRetryPrompt(agent.Task, failure, toolMessages)
+		previous = append(previous, append(messages, toolMessages...)...)
+		messages = []interface{}{
+			messages[0],
+			map[string]string{"role": "user", "content": retry},
 		}
+		toolMessages = nil
+		agentMutex.Lock()
+		agent.Attempt = attempt + 1
+		agent.Finding = "Retrying after: " + failure
+		agentMutex.Unlock()
+	}
+}
 
-		choice := apiResp.Choices[0]
+// agentRetries reports whether a failed agent gets another attempt.
+func agentRetries() bool {
+	agentPrefsMu.Lock()
+	defer agentPrefsMu.Unlock()
+	return agentPrefs.Retry == nil || *agentPrefs.Retry
+}
 
-		if len(choice.Message.ToolCalls) == 0 {
-			agentMutex.Lock()
-			agent.Status = "completed"
-			agent.Result = choice.Message.Content
-			agent.TokensUsed = totalTokens
-			agentMutex.Unlock()
-			return
+// agentRetryContext caps how much of a failed attempt a retry is told, in
+// bytes, keeping the end.
+const agentRetryContext = 8000
+
+// agentRetryPrompt asks for task again, saying why the last attempt failed
+// and what it did along the way.
+func agentRetryPrompt(task, failure string, attempt []interface{}) string {
+	var b strings.Builder
+	for _, m := range attempt {
+		msg, ok := m.(map[string]interface{})
+		if !ok {
+			continue
 		}
+		content, _ := msg["content"].(string)
+		switch msg["role"] {
+		case "assistant":
+			if content != "" {
+				b.WriteString("You said: " + content + "\n")
+			}
+			calls, _ := msg["tool_calls"].([]ToolCall)
+			for _, tc := range calls {
+				b.WriteString(fmt.Sprintf("You ran %s %s\n", tc.Function.Name, strings.Join(strings.Fields(tc.Function.Arguments), " ")))
+			}
+		case "tool":
+			b.WriteString("Result: " + truncateStr(content, 500) + "\n")
+		}
+	}
 
-		assistantMsg := map[string]interface{}{
-			"role":       "assistant",
-			"tool_calls": choice.Message.ToolCalls,
+	prompt := fmt.Sprintf("%s\n\nA previous attempt at this task failed: %s", task, truncateStr(failure, 500))
+	if history := b.String(); history != "" {
+		if len(history) > agentRetryContext {
+			history = "..." + history[len(history)-agentRetryContext:]
 		}
-		if choice.Message.Content != "" {
-			assistantMsg["content"] = choice.Message.Content
+		prompt += "\n\nThis is what it did. Build on it rather than starting over, and avoid what made it fail:\n" + history
+	}
+	return prompt
+}
+
+func newAgentRequest(ctx context.Context, model agentModel, payload agentPayload) (*http.Request, error) {
+	payloadBytes, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", model.endpoint, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	if model.authHeader != "" {
+		if strings.ToLower(model.authHeader) == "authorization" {
+			req.Header.Set(model.authHeader, "Bearer "+model.apiKey)
+		} else {
+			req.Header.Set(model.authHeader, model.apiKey)
 		}
-		toolMessages = append(toolMessages, assistantMsg)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+model.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
 
-		for _, tc := range choice.Message.ToolCalls {
-			if isAgentTool(tc.Function.Name) {
-				toolMsg := map[string]interface{}{
-					"role":         "tool",
-					"tool_call_id": tc.ID,
-					"content":      "Sub-agents cannot spawn other agents",
-				}
-				toolMessages = append(toolMessages, toolMsg)
-				continue
-			}
+// Complete sends a single prompt to the configured model without tools and
+// returns the reply. It is used for small generation tasks like commit messages.
+func Complete(systemPrompt, prompt string) (string, error) {
+	if agentConfig.endpoint == "" {
+		return "", fmt.Errorf("no model configured")
+	}
 
-			result, execErr := ExecuteTool(tc.Function.Name, tc.Function.Arguments)
-			if execErr != nil {
-				result = fmt.Sprintf("Error: %v", execErr)
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
 
-			toolMsg := map[string]interface{}{
-				"role":         "tool",
-				"tool_call_id": tc.ID,
-				"content":      result,
-			}
-			toolMessages = append(toolMessages, toolMsg)
-		}
+	prompt, err := RunPreQueryHooks(ctx, agentConfig.modelName, prompt)
+	if err != nil {
+		return "", err
 	}
 
-	agentMutex.Lock()
-	agent.Status = "completed"
-	agent.Result = "Agent reached maximum iterations without final response"
-	agent.TokensUsed = totalTokens
-	agentMutex.Unlock()
+	payload := agentPayload{
+		Model: agentConfig.modelName,
+		Messages: []interface{}{
+			map[string]string{"role": "system", "content": systemPrompt},
+			map[string]string{"role": "user", "content": prompt},
+		},
+		Stream: false,
+	}
+	req, err := newAgentRequest(ctx, agentConfig, payload)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	var apiResp agentResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return "", fmt.Errorf("failed to parse API response")
+	}
+	if len(apiResp.Choices) == 0 {
+		return "", fmt.Errorf("no response choices")
+	}
+	return strings.TrimSpace(apiResp.Choices[0].Message.Content), nil
 }
 
 func filterAgentTools(tools []Tool) []Tool {
@@ -386,6 +940,7 @@ func isAgentTool(name string) bool {
 		"get_agent_result": true,
 		"wait_for_agent":   true,
 		"cancel_agent":     true,
+		"run_pipeline":     true,
 	}
 	return agentToolNames[name]
 }
@@ -399,17 +954,43 @@ func listAgents(args map[string]interface{}) (string, error) {
 	}
 
 	var result strings.Builder
-	result.WriteString("Agents:\n")
+	if limit := maxConcurrentAgents(); limit > 0 {
+		result.WriteString(fmt.Sprintf("Agents (%d running, %d queued, %d at a time):\n", agentsRunning, len(agentQueue), limit))
+	} else {
+		result.WriteString("Agents:\n")
+	}
 	for _, agent := range agentTasks {
 		duration := time.Since(agent.StartTime).Truncate(time.Second)
 		if agent.Done {
 			duration = agent.EndTime.Sub(agent.StartTime).Truncate(time.Second)
 		}
-		result.WriteString(fmt.Sprintf("  %s [%s] (%s) - %s\n",
-			agent.ID, agent.Status, duration, truncateStr(agent.Task, 50)))
+		result.WriteString(fmt.Sprintf("  %s [%s] (%s, %s on %s) - %s\n",
+			agent.ID, agent.Status, duration, agent.Role, agent.Model, truncateStr(agent.Task, 50)))
+		if position := queuePosition(agent); position > 0 {
+			result.WriteString(fmt.Sprintf("    Queue position %d of %d\n", position, len(agentQueue)))
+		}
+		if !agent.Done && agent.Iteration > 0 {
+			progress := fmt.Sprintf("    Iteration %d/%d", agent.Iteration, agentMaxIterations)
+			if agent.Attempt > 1 {
+				progress += fmt.Sprintf(" of attempt %d", agent.Attempt)
+			}
+			if agent.CurrentTool != "" {
+				progress += ", running " + agent.CurrentTool
+			}
+			result.WriteString(progress + "\n")
+		}
+		if agent.tools != nil {
+			result.WriteString(fmt.Sprintf("    Tools: %s\n", formatToolScope(agent.tools)))
+		}
 		if agent.TokensUsed > 0 {
 			result.WriteString(fmt.Sprintf("    Tokens: %d\n", agent.TokensUsed))
 		}
+		if n := unreadMail(agent.ID); n > 0 && !agent.Done {
+			result.WriteString(fmt.Sprintf("    Inbox: %d unread\n", n))
+		}
+	}
+	if n := unreadMail(mainInbox); n > 0 {
+		result.WriteString(fmt.Sprintf("\nYou have %d unread message(s) from agents; read them with read_inbox.\n", n))
 	}
 
 	return result.String(), nil
@@ -423,7 +1004,14 @@ func getAgentResult(args map[string]interface{}) (string, error) {
 
 	agentMutex.RLock()
 	agent, exists := agentTasks[agentID]
+	position := 0
+	var calls []agentToolCall
+	if exists {
+		position = queuePosition(agent)
+		calls = append(calls, agent.calls...)
+	}
 	agentMutex.RUnlock()
+	transcript, _ := args["transcript"].(bool)
 
 	if !exists {
 		return "", fmt.Errorf("agent %s not found", agentID)
@@ -432,8 +1020,18 @@ func getAgentResult(args map[string]interface{}) (string, error) {
 	var result strings.Builder
 	result.WriteString(fmt.Sprintf("Agent: %s\n", agent.ID))
 	result.WriteString(fmt.Sprintf("Role: %s\n", agent.Role))
+	result.WriteString(fmt.Sprintf("Model: %s\n", agent.Model))
+	if agent.tools != nil {
+		result.WriteString(fmt.Sprintf("Tools: %s\n", formatToolScope(agent.tools)))
+	}
 	result.WriteString(fmt.Sprintf("Status: %s\n", agent.Status))
+	if agent.Attempt > 1 {
+		result.WriteString(fmt.Sprintf("Attempt: %d, after the first failed\n", agent.Attempt))
+	}
 	result.WriteString(fmt.Sprintf("Task: %s\n", agent.Task))
+	if len(calls) > 0 && !transcript {
+		result.WriteString(fmt.Sprintf("Tool calls: %d (transcript: true lists them)\n", len(calls)))
+	}
 
 	if agent.Done {
 		result.WriteString(fmt.Sprintf("Duration: %s\n", agent.EndTime.Sub(agent.StartTime).Truncate(time.Second)))
@@ -441,11 +1039,23 @@ func getAgentResult(args map[string]interface{}) (string, error) {
 		if agent.Error != "" {
 			result.WriteString(fmt.Sprintf("Error: %s\n", agent.Error))
 		}
+		if transcript {
+			result.WriteString(formatAgentCalls(calls))
+		}
 		if agent.Result != "" {
 			result.WriteString(fmt.Sprintf("\nResult:\n%s", agent.Result))
 		}
+	} else if position > 0 {
+		result.WriteString(fmt.Sprintf("Queued for: %s, at position %d\n", time.Since(agent.StartTime).Truncate(time.Second), position))
 	} else {
 		result.WriteString(fmt.Sprintf("Running for: %s\n", time.Since(agent.StartTime).Truncate(time.Second)))
+		result.WriteString(fmt.Sprintf("Iteration: %d/%d\n", agent.Iteration, agentMaxIterations))
+		if transcript {
+			result.WriteString(formatAgentCalls(calls))
+		}
+		if agent.Finding != "" {
+			result.WriteString(fmt.Sprintf("\nSo far:\n%s", agent.Finding))
+		}
 	}
 
 	return result.String(), nil
@@ -491,18 +1101,15 @@ func cancelAgent(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("agent_id required")
 	}
 
-	agentMutex.Lock()
+	agentMutex.RLock()
 	agent, exists := agentTasks[agentID]
-	if exists && !agent.Done && agent.cancel != nil {
-		agent.cancel()
-	}
-	agentMutex.Unlock()
+	agentMutex.RUnlock()
 
 	if !exists {
 		return "", fmt.Errorf("agent %s not found", agentID)
 	}
 
-	if agent.Done {
+	if !stopAgent(agent) {
 		return fmt.Sprintf("Agent %s already finished with status: %s", agentID, agent.Status), nil
 	}
 
@@ -530,8 +1137,44 @@ func ClearCompletedAgents() int {
 	for id, agent := range agentTasks {
 		if agent.Done {
 			delete(agentTasks, id)
+			dropMailbox(id)
 			cleared++
 		}
 	}
 	return cleared
 }
+
+// formatAgentCalls lists the tool calls an agent made, for the transcript
+// section of get_agent_result.
+func formatAgentCalls(calls []agentToolCall) string {
+	if len(calls) == 0 {
+		return "\nTranscript: no tool calls\n"
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("\nTranscript (%d tool calls):\n", len(calls)))
+	attempt := 1
+	for i, c := range calls {
+		if c.attempt != attempt {
+			attempt = c.attempt
+			b.WriteString(fmt.Sprintf("  Attempt %d:\n", attempt))
+		}
+		line := fmt.Sprintf("  %d. %s", i+1, c.name)
+		if args := strings.Join(strings.Fields(c.args), " "); args != "" && args != "{}" {
+			line += " " + truncateStr(args, 150)
+		}
+		line += fmt.Sprintf(" (%s)", c.duration.Round(time.Millisecond))
+		if c.err != "" {
+			line += " failed: " + truncateStr(c.err, 150)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// formatToolScope lists the tools an agent is limited to.
+func formatToolScope(tools []string) string {
+	if len(tools) == 0 {
+		return "none"
+	}
+	return strings.Join(tools, ", ")
+}
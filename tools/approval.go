@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	approvalHandler func(tool, action string) bool
+	approvalMu      sync.Mutex
+)
+
+// SetApprovalHandler installs the callback consulted before a tool performs a
+// state-changing action (applying manifests, installing packages, pushing).
+// The handler returns true to proceed. With no handler installed, such actions
+// are refused.
+func SetApprovalHandler(handler func(tool, action string) bool) {
+	approvalMu.Lock()
+	approvalHandler = handler
+	approvalMu.Unlock()
+}
+
+// requireApproval asks the user to confirm an action. Requests are serialized
+// so concurrent agents never interleave prompts.
+func requireApproval(tool, action string) error {
+	approvalMu.Lock()
+	defer approvalMu.Unlock()
+
+	if approvalHandler == nil {
+		return fmt.Errorf("%s requires approval but no approval prompt is available", tool)
+	}
+	approvalsPending.Add(1)
+	approved := approvalHandler(tool, action)
+	approvalsPending.Add(-1)
+	if !approved {
+		return fmt.Errorf("%s was not approved by the user: %s", tool, action)
+	}
+	return nil
+}
+
+var inputHandler func(prompt string, secret bool) (string, bool)
+
+// SetInputHandler installs the callback used when a tool needs a value from
+// the user, such as a key passphrase. secret asks for the input to be masked.
+// The handler returns false when the user cancels.
+func SetInputHandler(handler func(prompt string, secret bool) (string, bool)) {
+	approvalMu.Lock()
+	inputHandler = handler
+	approvalMu.Unlock()
+}
+
+// requestInput asks the user for a value, sharing approval prompts'
+// serialization and pausing tool timeouts while waiting.
+func requestInput(prompt string, secret bool) (string, error) {
+	approvalMu.Lock()
+	defer approvalMu.Unlock()
+
+	if inputHandler == nil {
+		return "", fmt.Errorf("no prompt is available to ask: %s", prompt)
+	}
+	approvalsPending.Add(1)
+	value, ok := inputHandler(prompt, secret)
+	approvalsPending.Add(-1)
+	if !ok {
+		return "", fmt.Errorf("cancelled by the user: %s", prompt)
+	}
+	return value, nil
+}
+
+var progressHandler func(tool, status string)
+
+// SetProgressHandler installs the callback long-running tools use to report
+// progress, such as files transferred so far.
+func SetProgressHandler(handler func(tool, status string)) {
+	approvalMu.Lock()
+	progressHandler = handler
+	approvalMu.Unlock()
+}
+
+func reportProgress(tool, status string) {
+	if handler := progressHandler; handler != nil {
+		handler(tool, status)
+	}
+}
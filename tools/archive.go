@@ -0,0 +1,524 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ArchiveTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "create_archive",
+			Description: "Create a .tar.gz, .tar, or .zip archive from files and directories.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"paths": {"type": "array", "items": {"type": "string"}, "description": "Files or directories to include"},
+					"output": {"type": "string", "description": "Archive path; format is taken from the extension (.tar.gz, .tgz, .tar, .zip)"},
+					"max_size_mb": {"type": "integer", "description": "Refuse if the input totals more than this (default 1024)"}
+				},
+				"required": ["paths", "output"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "extract_archive",
+			Description: "Safely extract a .tar.gz, .tar, or .zip archive. Rejects entries that would escape the destination.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"archive": {"type": "string", "description": "Archive file to extract"},
+					"dest": {"type": "string", "description": "Destination directory (default: current directory)"},
+					"max_size_mb": {"type": "integer", "description": "Abort if extracted data exceeds this (default 1024)"},
+					"list_only": {"type": "boolean", "description": "List contents without extracting"}
+				},
+				"required": ["archive"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("files", ArchiveTools...)
+}
+
+const maxArchiveEntries = 10000
+
+func archiveFormat(path string) (string, error) {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", nil
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	}
+	return "", fmt.Errorf("unsupported archive format: %s (use .tar.gz, .tgz, .tar, or .zip)", path)
+}
+
+func archiveSizeLimit(args map[string]interface{}) int64 {
+	limit := int64(1024)
+	if m, ok := args["max_size_mb"].(float64); ok && m > 0 {
+		limit = int64(m)
+	}
+	return limit * 1024 * 1024
+}
+
+// safeArchivePath resolves an entry name inside dest, rejecting absolute
+// paths and any ".." that would climb out of it.
+func safeArchivePath(dest, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) {
+		return "", fmt.Errorf("refusing absolute path in archive: %s", name)
+	}
+	target := filepath.Join(dest, name)
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing path outside destination: %s", name)
+	}
+	return target, nil
+}
+
+func createArchive(args map[string]interface{}) (string, error) {
+	output, _ := args["output"].(string)
+	if output == "" {
+		return "", fmt.Errorf("output required")
+	}
+	output = expandPath(output)
+
+	var paths []string
+	if raw, ok := args["paths"].([]interface{}); ok {
+		for _, p := range raw {
+			if s, ok := p.(string); ok && s != "" {
+				paths = append(paths, expandPath(s))
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("paths required")
+	}
+
+	format, err := archiveFormat(output)
+	if err != nil {
+		return "", err
+	}
+
+	limit := archiveSizeLimit(args)
+	var total int64
+	for _, p := range paths {
+		err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				total += info.Size()
+			}
+			if total > limit {
+				return fmt.Errorf("input exceeds %d MB limit", limit/1024/1024)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer f.Close()
+
+	var count int
+	switch format {
+	case "zip":
+		count, err = writeZip(f, paths, output)
+	case "tar.gz":
+		gz := gzip.NewWriter(f)
+		count, err = writeTar(gz, paths, output)
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+	default:
+		count, err = writeTar(f, paths, output)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(output)
+		return "", err
+	}
+
+	info, _ := f.Stat()
+	var size int64
+	if info != nil {
+		size = info.Size()
+	}
+	return fmt.Sprintf("Created %s (%d files, %s from %s)", output, count, formatBytes(size), formatBytes(total)), nil
+}
+
+// walkArchiveInputs calls fn for every file and directory under paths with the
+// name it should have inside the archive, skipping the archive itself.
+func walkArchiveInputs(paths []string, output string, fn func(path, name string, info os.FileInfo) error) error {
+	absOutput, _ := filepath.Abs(output)
+	for _, root := range paths {
+		base := filepath.Dir(filepath.Clean(root))
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if abs, _ := filepath.Abs(path); abs == absOutput {
+				return nil
+			}
+			name, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+			return fn(path, filepath.ToSlash(name), info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTar(w io.Writer, paths []string, output string) (int, error) {
+	tw := tar.NewWriter(w)
+	count := 0
+	err := walkArchiveInputs(paths, output, func(path, name string, info os.FileInfo) error {
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, _ = os.Readlink(path)
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.Copy(tw, src); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, tw.Close()
+}
+
+func writeZip(w io.Writer, paths []string, output string) (int, error) {
+	zw := zip.NewWriter(w)
+	count := 0
+	err := walkArchiveInputs(paths, output, func(path, name string, info os.FileInfo) error {
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+		dst, err := zw.CreateHeader(hdr)
+		if err != nil || info.IsDir() {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.Copy(dst, src); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, zw.Close()
+}
+
+func extractArchive(args map[string]interface{}) (string, error) {
+	archive, _ := args["archive"].(string)
+	if archive == "" {
+		return "", fmt.Errorf("archive required")
+	}
+	archive = expandPath(archive)
+
+	dest := "."
+	if d, ok := args["dest"].(string); ok && d != "" {
+		dest = expandPath(d)
+	}
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return "", err
+	}
+
+	format, err := archiveFormat(archive)
+	if err != nil {
+		return "", err
+	}
+
+	listOnly, _ := args["list_only"].(bool)
+	ex := &archiveExtractor{dest: dest, limit: archiveSizeLimit(args), listOnly: listOnly}
+
+	switch format {
+	case "zip":
+		err = ex.extractZip(archive)
+	default:
+		err = ex.extractTar(archive, format == "tar.gz")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if listOnly {
+		return fmt.Sprintf("%s (%d entries, %s uncompressed):\n%s",
+			archive, len(ex.entries), formatBytes(ex.written), strings.Join(ex.entries, "\n")), nil
+	}
+	return fmt.Sprintf("Extracted %d entries (%s) to %s", len(ex.entries), formatBytes(ex.written), dest), nil
+}
+
+type archiveExtractor struct {
+	dest     string
+	limit    int64
+	listOnly bool
+	written  int64
+	entries  []string
+}
+
+func (ex *archiveExtractor) add(name string, size int64) error {
+	ex.entries = append(ex.entries, name)
+	if len(ex.entries) > maxArchiveEntries {
+		return fmt.Errorf("archive has more than %d entries", maxArchiveEntries)
+	}
+	ex.written += size
+	if ex.written > ex.limit {
+		return fmt.Errorf("archive exceeds %d MB uncompressed limit", ex.limit/1024/1024)
+	}
+	return nil
+}
+
+// noSymlinks refuses target if it or a directory between it and dest is a
+// symlink. Each link is checked against its own entry when it is extracted,
+// but a chain of them, such as a -> . then a/b -> .., can still lead out of
+// dest, so nothing is written through a link.
+func (ex *archiveExtractor) noSymlinks(target string) error {
+	rel, err := filepath.Rel(ex.dest, target)
+	if err != nil {
+		return err
+	}
+	path := ex.dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to extract through symlink %s", path)
+		}
+	}
+	return nil
+}
+
+// writeFile copies at most the remaining size budget, so a lying header
+// cannot be used to decompress past the limit. declared is the size already
+// counted for this entry by add.
+func (ex *archiveExtractor) writeFile(target string, r io.Reader, mode os.FileMode, declared int64) error {
+	if err := ex.noSymlinks(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// A file already there is replaced rather than written through, so
+	// the file is always created anew.
+	if info, err := os.Lstat(target); err == nil && info.Mode().IsRegular() {
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY|openNoFollow, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	remaining := ex.limit - ex.written + declared
+	n, err := io.Copy(f, io.LimitReader(r, remaining+1))
+	if err != nil {
+		return err
+	}
+	if n > remaining {
+		f.Close()
+		os.Remove(target)
+		return fmt.Errorf("archive exceeds %d MB uncompressed limit", ex.limit/1024/1024)
+	}
+	return nil
+}
+
+func (ex *archiveExtractor) extractTar(path string, gzipped bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("invalid gzip data: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar data: %w", err)
+		}
+
+		target, err := safeArchivePath(ex.dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := ex.add(hdr.Name, hdr.Size); err != nil {
+			return err
+		}
+		if ex.listOnly {
+			continue
+		}
+
+		if err := ex.noSymlinks(target); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := ex.writeFile(target, tr, os.FileMode(hdr.Mode), hdr.Size); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			linkTarget := hdr.Linkname
+			if !filepath.IsAbs(linkTarget) {
+				linkTarget = filepath.Join(filepath.Dir(hdr.Name), linkTarget)
+			}
+			if _, err := safeArchivePath(ex.dest, linkTarget); err != nil {
+				return fmt.Errorf("refusing symlink %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			os.MkdirAll(filepath.Dir(target), 0755)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			// Hard links, devices and FIFOs are skipped.
+		}
+	}
+}
+
+func (ex *archiveExtractor) extractZip(path string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		target, err := safeArchivePath(ex.dest, zf.Name)
+		if err != nil {
+			return err
+		}
+		if err := ex.add(zf.Name, int64(zf.UncompressedSize64)); err != nil {
+			return err
+		}
+		if ex.listOnly {
+			continue
+		}
+
+		if zf.FileInfo().IsDir() {
+			if err := ex.noSymlinks(target); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = ex.writeFile(target, rc, zf.Mode(), int64(zf.UncompressedSize64))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
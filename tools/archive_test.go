@@ -0,0 +1,47 @@
+package tools
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestExtractTarSymlinkChain checks that a chain of symlinks, each harmless
+// on its own, cannot be used to write outside the destination.
+func TestExtractTarSymlinkChain(t *testing.T) {
+	root := t.TempDir()
+	dest := filepath.Join(root, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(root, "evil.tar")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for _, h := range []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "."},
+		{Name: "a/b", Typeflag: tar.TypeSymlink, Linkname: ".."},
+	} {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := []byte("pwned")
+	if err := tw.WriteHeader(&tar.Header{Name: "b/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write(content)
+	tw.Close()
+	f.Close()
+
+	_, err = extractArchive(map[string]interface{}{"archive": archive, "dest": dest})
+	if err == nil {
+		t.Error("extracting through a chain of symlinks succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(root, "evil")); err == nil {
+		t.Error("a file was written outside the destination")
+	}
+}
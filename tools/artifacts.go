@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ArtifactTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "open_artifact",
+			Description: "Page through or search a saved tool output artifact. Large tool results are stored as artifacts and referenced by path.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"path": {"type": "string", "description": "Artifact path as given in the tool result"},
+					"offset": {"type": "integer", "description": "First line to show, 1-based (default 1)"},
+					"limit": {"type": "integer", "description": "Number of lines to show (default 200)"},
+					"pattern": {"type": "string", "description": "Only show lines matching this regular expression"}
+				},
+				"required": ["path"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("files", ArtifactTools...)
+}
+
+const (
+	// Tool results longer than this are saved as artifacts.
+	artifactThreshold = 16 * 1024
+	artifactPreview   = 40
+	artifactMaxAge    = 7 * 24 * time.Hour
+)
+
+var (
+	artifactSession string
+	artifactCounter int
+	artifactMu      sync.Mutex
+)
+
+func artifactsRoot() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".shell-ai", "artifacts")
+}
+
+// sessionArtifactDir creates this process's artifact directory on first use
+// and clears out sessions older than a week.
+func sessionArtifactDir() (string, error) {
+	root := artifactsRoot()
+	if artifactSession == "" {
+		artifactSession = fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid())
+		if entries, err := os.ReadDir(root); err == nil {
+			for _, e := range entries {
+				if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > artifactMaxAge {
+					os.RemoveAll(filepath.Join(root, e.Name()))
+				}
+			}
+		}
+	}
+	dir := filepath.Join(root, artifactSession)
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// storeArtifact saves a large tool result and returns a short preview that
+// points at the saved file. Small results are returned unchanged.
+func storeArtifact(tool, output string) string {
+	if len(output) <= artifactThreshold || tool == "open_artifact" {
+		return output
+	}
+
+	artifactMu.Lock()
+	dir, err := sessionArtifactDir()
+	artifactCounter++
+	n := artifactCounter
+	artifactMu.Unlock()
+	if err != nil {
+		return output
+	}
+
+	// With an encrypted database, output kept outside it is sealed too.
+	stored := output
+	if knowledgeDB != nil {
+		stored = knowledgeDB.Seal(output)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%03d-%s.txt", n, tool))
+	if err := os.WriteFile(path, []byte(stored), 0600); err != nil {
+		return output
+	}
+
+	lines := strings.Split(output, "\n")
+	preview := lines
+	if len(preview) > artifactPreview {
+		preview = preview[:artifactPreview]
+	}
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Output saved to artifact %s (%d lines, %s). First %d lines:\n\n",
+		path, len(lines), formatBytes(int64(len(output))), len(preview)))
+	for _, line := range preview {
+		result.WriteString(truncate(line, 300) + "\n")
+	}
+	result.WriteString("\nUse open_artifact with this path to read more or search it.")
+	return result.String()
+}
+
+func openArtifact(args map[string]interface{}) (string, error) {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return "", fmt.Errorf("path required")
+	}
+	path = expandPath(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(artifactsRoot(), path)
+	}
+	root := artifactsRoot()
+	if rel, err := filepath.Rel(root, filepath.Clean(path)); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not an artifact under %s", path, root)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read artifact: %w", err)
+	}
+	content := string(data)
+	if knowledgeDB != nil {
+		if content, err = knowledgeDB.Unseal(content); err != nil {
+			return "", fmt.Errorf("failed to read artifact: %w", err)
+		}
+	}
+	lines := strings.Split(content, "\n")
+
+	offset := 1
+	if o, ok := args["offset"].(float64); ok && o > 0 {
+		offset = int(o)
+	}
+	limit := 200
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+
+	var re *regexp.Regexp
+	if pattern, _ := args["pattern"].(string); pattern != "" {
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+
+	var result strings.Builder
+	shown := 0
+	last := 0
+	for i := offset - 1; i < len(lines) && shown < limit; i++ {
+		if re != nil && !re.MatchString(lines[i]) {
+			continue
+		}
+		result.WriteString(fmt.Sprintf("%6d  %s\n", i+1, truncate(lines[i], 500)))
+		shown++
+		last = i + 1
+	}
+
+	if shown == 0 {
+		if re != nil {
+			return fmt.Sprintf("No lines matching %q after line %d (%d lines total)", re.String(), offset, len(lines)), nil
+		}
+		return fmt.Sprintf("Offset %d is past the end (%d lines total)", offset, len(lines)), nil
+	}
+	if last < len(lines) {
+		result.WriteString(fmt.Sprintf("\n(%d lines total; continue with offset %d)", len(lines), last+1))
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var AskTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ask_user",
+			Description: "Ask the user a clarifying question and wait for the answer, rather than guessing when a choice matters and the task does not settle it. Give options when there are a few likely answers, and a default to go with if the user does not answer in time.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"question": {"type": "string", "description": "The question, with what the user needs to know to answer it"},
+					"options": {"type": "array", "items": {"type": "string"}, "description": "Likely answers to choose from; the user may still answer otherwise"},
+					"default": {"type": "string", "description": "Answer to go with if the user does not answer in time"},
+					"timeout_seconds": {"type": "integer", "description": "How long to wait for an answer (default 300)"}
+				},
+				"required": ["question"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("agents", AskTools...)
+}
+
+// defaultAskTimeout is how long ask_user waits for an answer unless told
+// otherwise.
+const defaultAskTimeout = 5 * time.Minute
+
+// Question is a question ask_user puts to the user.
+type Question struct {
+	// From is the ID of the agent asking, or "" for the main conversation.
+	From    string
+	Text    string
+	Options []string
+	Default string
+	// Deadline is when the question is given up on, with Default as the
+	// answer.
+	Deadline time.Time
+}
+
+var questionHandler func(ctx context.Context, q Question) (string, bool)
+
+// SetQuestionHandler installs the callback ask_user puts questions to the
+// user with. The handler returns the answer, or false when the user
+// declines to answer, and must give up once ctx is done. With no handler
+// installed, questions get their default answer at once.
+func SetQuestionHandler(handler func(ctx context.Context, q Question) (string, bool)) {
+	approvalMu.Lock()
+	questionHandler = handler
+	approvalMu.Unlock()
+}
+
+func askUser(ctx context.Context, args map[string]interface{}) (string, error) {
+	text, _ := args["question"].(string)
+	if text = strings.TrimSpace(text); text == "" {
+		return "", fmt.Errorf("question required")
+	}
+	q := Question{From: agentIDOf(ctx), Text: text}
+	if list, ok := args["options"].([]interface{}); ok {
+		for _, o := range list {
+			if option, ok := o.(string); ok && strings.TrimSpace(option) != "" {
+				q.Options = append(q.Options, strings.TrimSpace(option))
+			}
+		}
+	}
+	q.Default, _ = args["default"].(string)
+	timeout := defaultAskTimeout
+	if t, ok := args["timeout_seconds"].(float64); ok && t > 0 {
+		timeout = time.Duration(t) * time.Second
+	}
+
+	// Questions share approval prompts' serialization, so the user is
+	// asked one thing at a time, and pause tool timeouts while waiting.
+	approvalMu.Lock()
+	defer approvalMu.Unlock()
+	if questionHandler == nil {
+		return noAnswer(q, "There is no one to ask in this session"), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	q.Deadline, _ = ctx.Deadline()
+	approvalsPending.Add(1)
+	answer, ok := questionHandler(ctx, q)
+	approvalsPending.Add(-1)
+
+	switch {
+	case ctx.Err() != nil:
+		return noAnswer(q, fmt.Sprintf("The user did not answer within %s", timeout)), nil
+	case !ok:
+		return noAnswer(q, "The user chose not to answer"), nil
+	case strings.TrimSpace(answer) == "" && q.Default != "":
+		return fmt.Sprintf("The user accepted the default: %s", q.Default), nil
+	case strings.TrimSpace(answer) == "":
+		return noAnswer(q, "The user gave an empty answer"), nil
+	}
+	return "The user answered: " + answer, nil
+}
+
+// noAnswer tells the model why there is no answer and what to go on with.
+func noAnswer(q Question, why string) string {
+	if q.Default != "" {
+		return fmt.Sprintf("%s; going with the default: %s", why, q.Default)
+	}
+	return why + ". Decide for yourself, and say what you assumed."
+}
@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"fmt"
+	"q/db"
+	"sort"
+	"strings"
+)
+
+const (
+	// askDocsSources is how many of the best matching docs ask_docs reads.
+	askDocsSources = 5
+	// askDocsContext caps the excerpts of them the model is given, and
+	// askDocsChunk the size of each, in bytes.
+	askDocsContext = 12000
+	askDocsChunk   = 1500
+)
+
+const askDocsPrompt = `You answer questions about commands and tools using only the documentation excerpts you are given, each headed with the doc it is from.
+Quote the commands and flags they show rather than recalling your own. Name the doc an answer comes from in brackets, like [tar].
+If the excerpts do not answer the question, say so plainly and do not guess.`
+
+// askDocs answers a question from the cached docs that best match it:
+// their passages sharing the most words with the question go to the model
+// as the only context it may answer from.
+func askDocs(args map[string]interface{}) (string, error) {
+	question, _ := args["question"].(string)
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return "", fmt.Errorf("question required")
+	}
+	if docsDB == nil {
+		return "Documentation database not initialized", nil
+	}
+
+	results, err := docsDB.SearchDocs(question, askDocsSources)
+	if err != nil {
+		return "", err
+	}
+	var docs []*db.Doc
+	for _, r := range results {
+		if d, err := docsDB.GetDoc(r.Name, r.Source); err == nil && d != nil {
+			docs = append(docs, d)
+		}
+	}
+	if len(docs) == 0 {
+		return fmt.Sprintf("No cached docs match '%s'. Use get_docs or fetch_web_docs to cache the documentation first.", question), nil
+	}
+
+	excerpts, sources := docExcerpts(question, docs)
+	answer, err := Complete(askDocsPrompt, excerpts+"\nQuestion: "+question)
+	if err != nil {
+		return "", fmt.Errorf("asking the model: %w", err)
+	}
+	return fmt.Sprintf("%s\n\n[Sources: %s]", answer, strings.Join(sources, ", ")), nil
+}
+
+// docChunk is a passage of a doc.
+type docChunk struct {
+	doc, index int
+	text       string
+	score      int
+}
+
+// docExcerpts picks the passages of docs that share the most words with
+// question, up to askDocsContext bytes, and returns them under the names of
+// their docs, in the order they come in each, along with those names.
+func docExcerpts(question string, docs []*db.Doc) (string, []string) {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(question), isNotWordRune) {
+		if len(w) > 2 {
+			words[w] = true
+		}
+	}
+
+	var chunks []docChunk
+	for i, d := range docs {
+		for j, text := range splitDoc(d.Content) {
+			lower := strings.ToLower(text)
+			score := 0
+			for w := range words {
+				if strings.Contains(lower, w) {
+					score++
+				}
+			}
+			// The opening of a doc says what it is.
+			if j == 0 {
+				score++
+			}
+			chunks = append(chunks, docChunk{doc: i, index: j, text: text, score: score})
+		}
+	}
+	// Ties go to the docs the search ranked higher.
+	sort.SliceStable(chunks, func(a, b int) bool { return chunks[a].score > chunks[b].score })
+
+	var picked []docChunk
+	size := 0
+	for _, c := range chunks {
+		if size+len(c.text) > askDocsContext {
+			continue
+		}
+		picked = append(picked, c)
+		size += len(c.text)
+	}
+	sort.Slice(picked, func(a, b int) bool {
+		if picked[a].doc != picked[b].doc {
+			return picked[a].doc < picked[b].doc
+		}
+		return picked[a].index < picked[b].index
+	})
+
+	var b strings.Builder
+	var sources []string
+	for i, c := range picked {
+		if i == 0 || picked[i-1].doc != c.doc {
+			d := docs[c.doc]
+			b.WriteString(fmt.Sprintf("=== %s (%s) ===\n", d.Name, d.Source))
+			sources = append(sources, d.Name)
+		}
+		b.WriteString(c.text + "\n\n")
+	}
+	return b.String(), sources
+}
+
+// splitDoc cuts content into passages of about askDocsChunk bytes, at
+// blank lines where it can.
+func splitDoc(content string) []string {
+	var chunks []string
+	var cur strings.Builder
+	for _, para := range strings.Split(content, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		for len(para) > askDocsChunk {
+			if cur.Len() > 0 {
+				chunks = append(chunks, cur.String())
+				cur.Reset()
+			}
+			chunks = append(chunks, para[:askDocsChunk])
+			para = para[askDocsChunk:]
+		}
+		if cur.Len() > 0 && cur.Len()+len(para) > askDocsChunk {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+		if cur.Len() > 0 {
+			cur.WriteString("\n\n")
+		}
+		cur.WriteString(para)
+	}
+	if cur.Len() > 0 {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks
+}
+
+func isNotWordRune(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_')
+}
@@ -0,0 +1,322 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var CaptureTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "packet_capture",
+			Description: "Capture network traffic briefly with tcpdump and summarize it: protocols, top conversations and ports, unanswered SYNs and resets. Use to debug why a service gets no traffic. Requires user approval and root (non-interactive sudo).",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"filter": {"type": "string", "description": "BPF filter expression, e.g. 'tcp port 8080' or 'host 10.0.0.5 and udp'"},
+					"interface": {"type": "string", "description": "Interface to capture on (default: any)"},
+					"duration": {"type": "integer", "description": "Seconds to capture (default 10, max 120)"},
+					"max_packets": {"type": "integer", "description": "Stop after this many packets (default 2000, max 20000)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("network", CaptureTools...)
+}
+
+// tcpdump -nn -tt lines, with the interface/direction prefix "-i any" adds.
+var (
+	captureLinePattern = regexp.MustCompile(`^(\d+\.\d+)\s+(?:(\S+)\s+(?:In|Out|P|M|B)\s+)?(IP6?|ARP|Request|Reply),?\s+(.*)$`)
+	captureFlowPattern = regexp.MustCompile(`^(\S+) > (\S+): (.*)$`)
+	captureFlagPattern = regexp.MustCompile(`Flags \[([^\]]*)\]`)
+	interfacePattern   = regexp.MustCompile(`^[A-Za-z0-9_.:@-]+$`)
+)
+
+type captureSummary struct {
+	packets       int
+	first, last   float64
+	protocols     map[string]int
+	conversations map[string]int
+	dstPorts      map[string]int
+	synSent       map[string]int // "src > dst" flows that sent a bare SYN
+	synAcked      map[string]bool
+	resets        map[string]int
+}
+
+func newCaptureSummary() *captureSummary {
+	return &captureSummary{
+		protocols:     make(map[string]int),
+		conversations: make(map[string]int),
+		dstPorts:      make(map[string]int),
+		synSent:       make(map[string]int),
+		synAcked:      make(map[string]bool),
+		resets:        make(map[string]int),
+	}
+}
+
+// splitAddrPort splits tcpdump's "10.0.0.1.443" (or "fe80::1.443") form.
+func splitAddrPort(s string) (string, string) {
+	s = strings.TrimSuffix(s, ":")
+	i := strings.LastIndex(s, ".")
+	if i < 0 {
+		return s, ""
+	}
+	addr, port := s[:i], s[i+1:]
+	if strings.Contains(addr, ":") || strings.Count(addr, ".") == 3 {
+		return addr, port
+	}
+	return s, ""
+}
+
+func (c *captureSummary) add(line string) {
+	m := captureLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	ts, _ := strconv.ParseFloat(m[1], 64)
+	if c.packets == 0 {
+		c.first = ts
+	}
+	c.last = ts
+	c.packets++
+
+	if m[3] != "IP" && m[3] != "IP6" {
+		c.protocols["ARP"]++
+		return
+	}
+	flow := captureFlowPattern.FindStringSubmatch(m[4])
+	if flow == nil {
+		c.protocols["other"]++
+		return
+	}
+	src, _ := splitAddrPort(flow[1])
+	dst, dstPort := splitAddrPort(flow[2])
+	info := flow[3]
+
+	proto := "UDP"
+	switch {
+	case strings.Contains(info, "Flags ["):
+		proto = "TCP"
+	case strings.HasPrefix(info, "ICMP"):
+		proto = "ICMP"
+	case dstPort == "":
+		proto = "other"
+	}
+	c.protocols[proto]++
+
+	target := dst
+	if dstPort != "" {
+		target = dst + ":" + dstPort
+		// Replies go to ephemeral ports; only count well-known-looking ones.
+		if p, err := strconv.Atoi(dstPort); err == nil && p < 32768 {
+			c.dstPorts[proto+"/"+dstPort]++
+		}
+	}
+	c.conversations[fmt.Sprintf("%s %s > %s", proto, src, target)]++
+
+	if proto != "TCP" {
+		return
+	}
+	flags := ""
+	if f := captureFlagPattern.FindStringSubmatch(info); f != nil {
+		flags = f[1]
+	}
+	key := flow[1] + " > " + strings.TrimSuffix(flow[2], ":")
+	switch {
+	case flags == "S":
+		c.synSent[key]++
+	case flags == "S.":
+		// A SYN-ACK answers the reverse flow.
+		c.synAcked[strings.TrimSuffix(flow[2], ":")+" > "+flow[1]] = true
+	case strings.Contains(flags, "R"):
+		c.resets[fmt.Sprintf("%s > %s", src, target)]++
+	}
+}
+
+// topCounts returns the n largest entries as "count  key" lines.
+func topCounts(counts map[string]int, n int) []string {
+	type kv struct {
+		key   string
+		count int
+	}
+	var list []kv
+	for k, v := range counts {
+		list = append(list, kv{k, v})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].count != list[j].count {
+			return list[i].count > list[j].count
+		}
+		return list[i].key < list[j].key
+	})
+	var lines []string
+	for i, e := range list {
+		if i >= n {
+			lines = append(lines, fmt.Sprintf("  ... %d more", len(list)-n))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %6d  %s", e.count, e.key))
+	}
+	return lines
+}
+
+func (c *captureSummary) String() string {
+	var b strings.Builder
+	if c.packets == 0 {
+		b.WriteString("No packets matched. Either nothing was sent, the filter is too narrow, or traffic uses another interface.\n")
+		return b.String()
+	}
+	b.WriteString(fmt.Sprintf("%d packets over %.1fs\n", c.packets, c.last-c.first))
+
+	var protos []string
+	for _, line := range topCounts(c.protocols, 10) {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			protos = append(protos, fields[1]+" "+fields[0])
+		}
+	}
+	b.WriteString("Protocols: " + strings.Join(protos, ", ") + "\n")
+
+	b.WriteString("\nTop conversations (packets):\n")
+	b.WriteString(strings.Join(topCounts(c.conversations, 15), "\n") + "\n")
+	if len(c.dstPorts) > 0 {
+		b.WriteString("\nTop destination ports:\n")
+		b.WriteString(strings.Join(topCounts(c.dstPorts, 10), "\n") + "\n")
+	}
+
+	unanswered := make(map[string]int)
+	for flow, n := range c.synSent {
+		if !c.synAcked[flow] {
+			unanswered[flow] = n
+		}
+	}
+	if len(unanswered) > 0 {
+		b.WriteString("\nSYNs with no SYN-ACK (nothing listening, firewalled, or reply on another path):\n")
+		b.WriteString(strings.Join(topCounts(unanswered, 10), "\n") + "\n")
+	}
+	if len(c.resets) > 0 {
+		b.WriteString("\nTCP resets (connection refused or aborted):\n")
+		b.WriteString(strings.Join(topCounts(c.resets, 10), "\n") + "\n")
+	}
+	return b.String()
+}
+
+func packetCapture(ctx context.Context, args map[string]interface{}) (string, error) {
+	if _, err := exec.LookPath("tcpdump"); err != nil {
+		return "", fmt.Errorf("tcpdump is not installed (try package_install with tcpdump)")
+	}
+
+	iface, _ := args["interface"].(string)
+	if iface == "" {
+		iface = "any"
+	}
+	if !interfacePattern.MatchString(iface) {
+		return "", fmt.Errorf("invalid interface %q", iface)
+	}
+	filter, _ := args["filter"].(string)
+	filter = strings.TrimSpace(filter)
+	// tcpdump's getopt takes options from anywhere among its arguments,
+	// so none of the filter's words may look like one.
+	filterWords := strings.Fields(filter)
+	for _, w := range filterWords {
+		if strings.HasPrefix(w, "-") {
+			return "", fmt.Errorf("filter must be a BPF expression, not tcpdump options")
+		}
+	}
+	duration := 10
+	if d, ok := args["duration"].(float64); ok && d > 0 {
+		duration = int(d)
+	}
+	if duration > 120 {
+		duration = 120
+	}
+	maxPackets := 2000
+	if n, ok := args["max_packets"].(float64); ok && n > 0 {
+		maxPackets = int(n)
+	}
+	if maxPackets > 20000 {
+		maxPackets = 20000
+	}
+
+	// Headers only: -s keeps payloads (and any secrets in them) out of the capture.
+	cmdArgs := []string{"tcpdump", "-i", iface, "-nn", "-tt", "-l", "-s", "128", "-c", strconv.Itoa(maxPackets)}
+	if len(filterWords) > 0 {
+		cmdArgs = append(append(cmdArgs, "--"), filterWords...)
+	}
+	if os.Geteuid() != 0 {
+		if _, err := exec.LookPath("sudo"); err != nil {
+			return "", fmt.Errorf("capturing needs root and sudo is not available")
+		}
+		cmdArgs = append([]string{"sudo", "-n"}, cmdArgs...)
+	}
+
+	if err := requireApproval("packet_capture", fmt.Sprintf("%s (for %ds)", strings.Join(cmdArgs, " "), duration)); err != nil {
+		return "", err
+	}
+
+	captureCtx, cancel := context.WithTimeout(ctx, time.Duration(duration)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(captureCtx, cmdArgs[0], cmdArgs[1:]...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 3 * time.Second
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start tcpdump: %w", err)
+	}
+
+	summary := newCaptureSummary()
+	var sample []string
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		summary.add(line)
+		if len(sample) < 25 {
+			sample = append(sample, line)
+		}
+		if summary.packets%200 == 0 {
+			reportProgress("packet_capture", fmt.Sprintf("%d packets", summary.packets))
+		}
+	}
+	err = cmd.Wait()
+
+	errText := strings.TrimSpace(stderr.String())
+	if summary.packets == 0 && err != nil && captureCtx.Err() == nil {
+		if strings.Contains(errText, "a password is required") {
+			return "", fmt.Errorf("sudo needs a password; run `sudo -v` in your shell first, then retry")
+		}
+		return "", fmt.Errorf("tcpdump failed: %v\n%s", err, truncate(errText, 2000))
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Capture on %s", iface))
+	if filter != "" {
+		result.WriteString(fmt.Sprintf(" (filter: %s)", filter))
+	}
+	result.WriteString("\n")
+	result.WriteString(summary.String())
+	if len(sample) > 0 {
+		result.WriteString(fmt.Sprintf("\nFirst %d packets:\n%s\n", len(sample), strings.Join(sample, "\n")))
+	}
+	if summary.packets >= maxPackets {
+		result.WriteString(fmt.Sprintf("\nStopped at the %d packet limit.\n", maxPackets))
+	}
+	return result.String(), nil
+}
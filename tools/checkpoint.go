@@ -0,0 +1,226 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// repairCheckpointRef points at a commit of the working tree after the
+// last automatic repair that changed files; its parent is the working tree
+// before it. Neither is on any branch, and the index, stash and HEAD are
+// left alone.
+const repairCheckpointRef = "refs/shell-ai/last-repair"
+
+func init() {
+	RegisterTools("watch",
+		Tool{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        "revert_last_repair",
+				Description: "Undo the last automatic repair from watch mode, trigger_build or diagnose_error, restoring the files it changed to how they were before. Files edited since the repair are left alone unless force is set.",
+				Parameters: json.RawMessage(`{
+					"type": "object",
+					"properties": {
+						"force": {"type": "boolean", "description": "Also restore files that were edited after the repair, discarding those edits"}
+					},
+					"additionalProperties": false
+				}`),
+			},
+		},
+	)
+}
+
+// checkpointGit runs git in the current repository. With index set, git
+// uses that file as its index instead of the real one.
+func checkpointGit(index string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=shell-ai", "GIT_AUTHOR_EMAIL=shell-ai@localhost",
+		"GIT_COMMITTER_NAME=shell-ai", "GIT_COMMITTER_EMAIL=shell-ai@localhost")
+	if index != "" {
+		cmd.Env = append(cmd.Env, "GIT_INDEX_FILE="+index)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// snapshotWorkingTree commits the working tree as it is, untracked files
+// included but not ignored ones, on top of parent (or HEAD when parent is
+// empty). It returns the commit, or "" outside a git repository.
+func snapshotWorkingTree(parent, message string) string {
+	tree := snapshotTree()
+	if tree == "" {
+		return ""
+	}
+	if parent == "" {
+		parent, _ = checkpointGit("", "rev-parse", "--verify", "-q", "HEAD")
+	}
+	args := []string{"commit-tree", tree, "-m", message}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	commit, err := checkpointGit("", args...)
+	if err != nil {
+		return ""
+	}
+	return commit
+}
+
+// snapshotTree writes the working tree as it is to a tree object, as
+// snapshotWorkingTree does, and returns it.
+func snapshotTree() string {
+	top, err := checkpointGit("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return ""
+	}
+
+	// A copy of the real index saves hashing files that have not changed.
+	tmp, err := os.CreateTemp("", "shell-ai-index-*")
+	if err != nil {
+		return ""
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if realIndex, err := checkpointGit("", "rev-parse", "--path-format=absolute", "--git-path", "index"); err == nil {
+		if data, err := os.ReadFile(realIndex); err == nil {
+			os.WriteFile(tmp.Name(), data, 0600)
+		} else {
+			os.Remove(tmp.Name())
+		}
+	}
+
+	if _, err := checkpointGit(tmp.Name(), "-C", top, "add", "-A"); err != nil {
+		return ""
+	}
+	tree, err := checkpointGit(tmp.Name(), "write-tree")
+	if err != nil {
+		return ""
+	}
+	return tree
+}
+
+// saveRepairCheckpoint records what a repair of e changed, from the
+// snapshot before it, and returns the diff. It returns "" and records
+// nothing if the repair changed no files.
+func saveRepairCheckpoint(before string, e ErrorEvent, solution string) string {
+	message := "shell-ai repair: " + solution + "\n\n" + e.Message
+	after := snapshotWorkingTree(before, message)
+	if after == "" {
+		return ""
+	}
+	diff, err := checkpointGit("", "diff", "--no-color", "--no-renames", before, after)
+	if err != nil || diff == "" {
+		return ""
+	}
+	if _, err := checkpointGit("", "update-ref", "-m", "shell-ai repair", repairCheckpointRef, after); err != nil {
+		return ""
+	}
+	return diff + "\n"
+}
+
+func revertLastRepair(args map[string]interface{}) (string, error) {
+	force, _ := args["force"].(bool)
+	return RevertLastRepair(force)
+}
+
+// RevertLastRepair restores the files the last recorded repair changed to
+// how they were before it, and removes files it created. Files edited
+// since the repair are skipped unless force is set.
+func RevertLastRepair(force bool) (string, error) {
+	top, err := checkpointGit("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not in a git repository")
+	}
+	after, err := checkpointGit("", "rev-parse", "--verify", "-q", repairCheckpointRef)
+	if err != nil || after == "" {
+		return "No repair to revert.", nil
+	}
+	before, err := checkpointGit("", "rev-parse", after+"^")
+	if err != nil {
+		return "", err
+	}
+	subject, _ := checkpointGit("", "log", "-1", "--format=%s%n%n%b", after)
+	now := snapshotWorkingTree("", "shell-ai revert check")
+
+	changes, err := checkpointGit("", "diff", "--name-status", "--no-renames", "-z", before, after)
+	if err != nil {
+		return "", err
+	}
+	var restore, remove, skipped []string
+	fields := strings.Split(strings.TrimSuffix(changes, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status, path := fields[i], fields[i+1]
+		if !force && now != "" {
+			if _, err := checkpointGit("", "-C", top, "diff", "--quiet", after, now, "--", path); err != nil {
+				skipped = append(skipped, path)
+				continue
+			}
+		}
+		if status == "A" {
+			remove = append(remove, path)
+		} else {
+			restore = append(restore, path)
+		}
+	}
+	if len(restore)+len(remove) == 0 {
+		if len(skipped) > 0 {
+			return fmt.Sprintf("Nothing reverted: every file the repair changed has been edited since (%s). Use force to discard those edits.", strings.Join(skipped, ", ")), nil
+		}
+		return "No repair to revert.", nil
+	}
+
+	name := strings.TrimPrefix(strings.SplitN(subject, "\n", 2)[0], "shell-ai ")
+	desc := fmt.Sprintf("undo %s in %s, restoring %s", name, top, strings.Join(append(append([]string{}, restore...), remove...), ", "))
+	if err := requireApproval("revert_last_repair", desc); err != nil {
+		return "", err
+	}
+
+	if len(restore) > 0 {
+		if _, err := checkpointGit("", append([]string{"-C", top, "restore", "--source", before, "--worktree", "--"}, restore...)...); err != nil {
+			return "", err
+		}
+	}
+	for _, path := range remove {
+		if err := os.Remove(filepath.Join(top, path)); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	checkpointGit("", "update-ref", "-d", repairCheckpointRef)
+
+	// Left to itself, watch mode would apply the same repair again.
+	if parts := strings.SplitN(subject, "\n\n", 2); len(parts) == 2 {
+		watcherMu.Lock()
+		if w := activeWatcher; w != nil {
+			w.giveUpRepairing(strings.TrimSpace(parts[1]))
+		}
+		watcherMu.Unlock()
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Reverted %s\n", name))
+	if len(restore) > 0 {
+		result.WriteString(fmt.Sprintf("Restored: %s\n", strings.Join(restore, ", ")))
+	}
+	if len(remove) > 0 {
+		result.WriteString(fmt.Sprintf("Removed: %s\n", strings.Join(remove, ", ")))
+	}
+	if len(skipped) > 0 {
+		result.WriteString(fmt.Sprintf("Left alone, edited since the repair: %s (use force to revert them too)\n", strings.Join(skipped, ", ")))
+	}
+	return result.String(), nil
+}
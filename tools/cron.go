@@ -0,0 +1,355 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var CronTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "list_cron",
+			Description: "List scheduled jobs: the user's crontab and systemd timers.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"source": {"type": "string", "enum": ["all", "crontab", "systemd"], "description": "Which schedulers to list (default all)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "add_cron",
+			Description: "Schedule a recurring job in the user's crontab or as a systemd user timer. Requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"name": {"type": "string", "description": "Short job name (letters, digits, - and _)"},
+					"command": {"type": "string", "description": "Command to run"},
+					"schedule": {"type": "string", "description": "For crontab: 5-field expression or @daily/@hourly/@reboot. For systemd: OnCalendar value, e.g. daily or *-*-* 02:00:00"},
+					"type": {"type": "string", "enum": ["crontab", "systemd"], "description": "Scheduler to use (default crontab)"}
+				},
+				"required": ["name", "command", "schedule"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "remove_cron",
+			Description: "Remove a scheduled job added by name, or crontab lines matching a pattern. Requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"name": {"type": "string", "description": "Job name used with add_cron, or systemd timer name"},
+					"match": {"type": "string", "description": "Remove crontab lines containing this text (crontab only)"},
+					"type": {"type": "string", "enum": ["crontab", "systemd"], "description": "Scheduler (default crontab)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("system", CronTools...)
+}
+
+const cronTagPrefix = "# shell-ai: "
+
+var (
+	cronJobName   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	cronFieldExpr = regexp.MustCompile(`^[0-9*/,\-A-Za-z]+$`)
+)
+
+func validCronSchedule(schedule string) bool {
+	if strings.HasPrefix(schedule, "@") {
+		switch schedule {
+		case "@reboot", "@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly":
+			return true
+		}
+		return false
+	}
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return false
+	}
+	for _, f := range fields {
+		if !cronFieldExpr.MatchString(f) {
+			return false
+		}
+	}
+	return true
+}
+
+func runScheduler(stdin string, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	output, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
+
+func readCrontab() (string, error) {
+	if _, err := exec.LookPath("crontab"); err != nil {
+		return "", fmt.Errorf("crontab not found in PATH")
+	}
+	output, err := runScheduler("", "crontab", "-l")
+	if err != nil {
+		// An empty crontab exits non-zero with "no crontab for <user>".
+		if strings.Contains(output, "no crontab") {
+			return "", nil
+		}
+		return "", fmt.Errorf("crontab -l failed: %s", output)
+	}
+	return output, nil
+}
+
+func writeCrontab(content string) error {
+	content = strings.TrimRight(content, "\n") + "\n"
+	if output, err := runScheduler(content, "crontab", "-"); err != nil {
+		return fmt.Errorf("failed to install crontab: %s", output)
+	}
+	return nil
+}
+
+func systemdUserDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "systemd", "user")
+}
+
+func listCron(args map[string]interface{}) (string, error) {
+	source, _ := args["source"].(string)
+	if source == "" {
+		source = "all"
+	}
+
+	var result strings.Builder
+	if source == "all" || source == "crontab" {
+		result.WriteString("User crontab:\n")
+		content, err := readCrontab()
+		switch {
+		case err != nil:
+			result.WriteString(fmt.Sprintf("  (%v)\n", err))
+		case strings.TrimSpace(content) == "":
+			result.WriteString("  (empty)\n")
+		default:
+			for _, line := range strings.Split(content, "\n") {
+				result.WriteString("  " + line + "\n")
+			}
+		}
+	}
+
+	if source == "all" || source == "systemd" {
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			if source == "systemd" {
+				return "", fmt.Errorf("systemctl not found; systemd timers are not available")
+			}
+			return result.String(), nil
+		}
+		for _, scope := range []string{"--user", "--system"} {
+			output, err := runScheduler("", "systemctl", scope, "list-timers", "--all", "--no-pager")
+			result.WriteString(fmt.Sprintf("\nsystemd timers (%s):\n", strings.TrimPrefix(scope, "--")))
+			if err != nil && output == "" {
+				result.WriteString("  (unavailable)\n")
+				continue
+			}
+			result.WriteString(output + "\n")
+		}
+	}
+
+	return result.String(), nil
+}
+
+func addCron(args map[string]interface{}) (string, error) {
+	name, _ := args["name"].(string)
+	command, _ := args["command"].(string)
+	schedule, _ := args["schedule"].(string)
+	schedule = strings.TrimSpace(schedule)
+	if name == "" || command == "" || schedule == "" {
+		return "", fmt.Errorf("name, command, and schedule required")
+	}
+	if !cronJobName.MatchString(name) {
+		return "", fmt.Errorf("invalid name %q: use letters, digits, - and _", name)
+	}
+
+	jobType, _ := args["type"].(string)
+	if jobType == "systemd" {
+		return addSystemdTimer(name, command, schedule)
+	}
+
+	if !validCronSchedule(schedule) {
+		return "", fmt.Errorf("invalid cron schedule %q: expected 5 fields (min hour dom mon dow) or @daily/@hourly/...", schedule)
+	}
+	if strings.Contains(command, "\n") {
+		return "", fmt.Errorf("command must be a single line")
+	}
+
+	current, err := readCrontab()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(current, cronTagPrefix+name+"\n") || strings.HasSuffix(current, cronTagPrefix+name) {
+		return "", fmt.Errorf("a job named %s already exists; remove it first", name)
+	}
+
+	// cron turns unescaped % into newlines.
+	entry := fmt.Sprintf("%s%s\n%s %s", cronTagPrefix, name, schedule, strings.ReplaceAll(command, "%", `\%`))
+	if err := requireApproval("add_cron", fmt.Sprintf("add to crontab:\n%s", entry)); err != nil {
+		return "", err
+	}
+
+	updated := entry
+	if strings.TrimSpace(current) != "" {
+		updated = strings.TrimRight(current, "\n") + "\n" + entry
+	}
+	if err := writeCrontab(updated); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Added crontab job %s: %s %s", name, schedule, command), nil
+}
+
+// systemdQuote quotes s as one word of a unit file command line, where
+// systemd would otherwise expand $VAR and %-specifiers in it.
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", "$$", "%", "%%")
+	return `"` + r.Replace(s) + `"`
+}
+
+func addSystemdTimer(name, command, schedule string) (string, error) {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return "", fmt.Errorf("systemctl not found; use type crontab instead")
+	}
+	if output, err := runScheduler("", "systemd-analyze", "calendar", schedule); err != nil {
+		return "", fmt.Errorf("invalid OnCalendar schedule %q: %s", schedule, output)
+	}
+
+	dir := systemdUserDir()
+	unit := "shell-ai-" + name
+	servicePath := filepath.Join(dir, unit+".service")
+	timerPath := filepath.Join(dir, unit+".timer")
+	if _, err := os.Stat(timerPath); err == nil {
+		return "", fmt.Errorf("timer %s already exists; remove it first", unit)
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	service := fmt.Sprintf("[Unit]\nDescription=%s (added by shell-ai)\n\n[Service]\nType=oneshot\nExecStart=%s -c %s\n", name, systemdQuote(shell), systemdQuote(command))
+	timer := fmt.Sprintf("[Unit]\nDescription=Timer for %s\n\n[Timer]\nOnCalendar=%s\nPersistent=true\n\n[Install]\nWantedBy=timers.target\n", name, schedule)
+
+	if err := requireApproval("add_cron", fmt.Sprintf("install systemd user timer %s (OnCalendar=%s) running: %s", unit, schedule, command)); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(servicePath, []byte(service), 0644); err != nil {
+		return "", fmt.Errorf("failed to write service: %w", err)
+	}
+	if err := os.WriteFile(timerPath, []byte(timer), 0644); err != nil {
+		return "", fmt.Errorf("failed to write timer: %w", err)
+	}
+
+	runScheduler("", "systemctl", "--user", "daemon-reload")
+	if output, err := runScheduler("", "systemctl", "--user", "enable", "--now", unit+".timer"); err != nil {
+		return "", fmt.Errorf("failed to enable timer: %s", output)
+	}
+	return fmt.Sprintf("Installed and started %s.timer (OnCalendar=%s)", unit, schedule), nil
+}
+
+func removeCron(args map[string]interface{}) (string, error) {
+	name, _ := args["name"].(string)
+	match, _ := args["match"].(string)
+	jobType, _ := args["type"].(string)
+
+	if jobType == "systemd" {
+		if name == "" {
+			return "", fmt.Errorf("name required")
+		}
+		return removeSystemdTimer(name)
+	}
+	if name == "" && match == "" {
+		return "", fmt.Errorf("name or match required")
+	}
+
+	current, err := readCrontab()
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(current, "\n")
+	var kept, removed []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if name != "" && strings.TrimSpace(line) == cronTagPrefix+name {
+			removed = append(removed, line)
+			if i+1 < len(lines) {
+				i++
+				removed = append(removed, lines[i])
+			}
+			continue
+		}
+		if match != "" && !strings.HasPrefix(strings.TrimSpace(line), "#") && strings.Contains(line, match) {
+			removed = append(removed, line)
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	if len(removed) == 0 {
+		return "No matching crontab entries", nil
+	}
+
+	if err := requireApproval("remove_cron", fmt.Sprintf("remove from crontab:\n%s", strings.Join(removed, "\n"))); err != nil {
+		return "", err
+	}
+	if err := writeCrontab(strings.Join(kept, "\n")); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Removed %d crontab line(s):\n%s", len(removed), strings.Join(removed, "\n")), nil
+}
+
+func removeSystemdTimer(name string) (string, error) {
+	unit := strings.TrimSuffix(name, ".timer")
+	if !cronJobName.MatchString(unit) {
+		return "", fmt.Errorf("invalid timer name %q", name)
+	}
+	dir := systemdUserDir()
+	timerPath := filepath.Join(dir, unit+".timer")
+	if _, err := os.Stat(timerPath); err != nil {
+		unit = "shell-ai-" + unit
+		timerPath = filepath.Join(dir, unit+".timer")
+		if _, err := os.Stat(timerPath); err != nil {
+			return "", fmt.Errorf("no user timer named %s in %s", name, dir)
+		}
+	}
+
+	if err := requireApproval("remove_cron", fmt.Sprintf("disable and delete systemd user timer %s", unit)); err != nil {
+		return "", err
+	}
+
+	runScheduler("", "systemctl", "--user", "disable", "--now", unit+".timer")
+	os.Remove(timerPath)
+	os.Remove(filepath.Join(dir, unit+".service"))
+	runScheduler("", "systemctl", "--user", "daemon-reload")
+	return fmt.Sprintf("Removed %s.timer", unit), nil
+}
@@ -0,0 +1,393 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// lanDevice collects what discovery learned about one address.
+type lanDevice struct {
+	ip       string
+	mac      string
+	names    []string
+	services []string
+}
+
+func (d *lanDevice) addName(name string) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" {
+		return
+	}
+	for _, n := range d.names {
+		if strings.EqualFold(n, name) {
+			return
+		}
+	}
+	d.names = append(d.names, name)
+}
+
+func (d *lanDevice) addService(service string) {
+	for _, s := range d.services {
+		if s == service {
+			return
+		}
+	}
+	d.services = append(d.services, service)
+}
+
+// lanDevices is a concurrency-safe set of devices keyed by IP.
+type lanDevices struct {
+	mu      sync.Mutex
+	devices map[string]*lanDevice
+}
+
+func newLANDevices() *lanDevices {
+	return &lanDevices{devices: make(map[string]*lanDevice)}
+}
+
+func (l *lanDevices) update(ip string, fn func(d *lanDevice)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	d, ok := l.devices[ip]
+	if !ok {
+		d = &lanDevice{ip: ip}
+		l.devices[ip] = d
+	}
+	fn(d)
+}
+
+// sorted returns devices in numeric IP order.
+func (l *lanDevices) sorted() []*lanDevice {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var list []*lanDevice
+	for _, d := range l.devices {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := net.ParseIP(list[i].ip).To4(), net.ParseIP(list[j].ip).To4()
+		if a == nil || b == nil {
+			return list[i].ip < list[j].ip
+		}
+		return binary.BigEndian.Uint32(a) < binary.BigEndian.Uint32(b)
+	})
+	return list
+}
+
+var arpLinePattern = regexp.MustCompile(`\(([\d.]+)\) at ([0-9a-fA-F:]+)`)
+
+// readARPTable returns the kernel's IP -> MAC neighbour entries.
+func readARPTable() map[string]string {
+	table := make(map[string]string)
+	if f, err := os.Open("/proc/net/arp"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			// Flags 0x0 means the entry is incomplete.
+			if len(fields) >= 4 && fields[2] != "0x0" && fields[3] != "00:00:00:00:00:00" {
+				table[fields[0]] = strings.ToLower(fields[3])
+			}
+		}
+		return table
+	}
+
+	// macOS and the BSDs: "? (192.168.1.1) at a0:b1:c2:d3:e4:f5 on en0 ..."
+	output, err := exec.Command("arp", "-an").Output()
+	if err != nil {
+		return table
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if m := arpLinePattern.FindStringSubmatch(line); m != nil {
+			table[m[1]] = normalizeMAC(m[2])
+		}
+	}
+	return table
+}
+
+// normalizeMAC zero-pads octets, since BSD arp prints "a:b:c:d:e:f".
+func normalizeMAC(mac string) string {
+	parts := strings.Split(strings.ToLower(mac), ":")
+	for i, p := range parts {
+		if len(p) == 1 {
+			parts[i] = "0" + p
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// Common OUI prefixes, used when no system OUI database is installed.
+var builtinOUIs = map[string]string{
+	"b8:27:eb": "Raspberry Pi", "dc:a6:32": "Raspberry Pi", "e4:5f:01": "Raspberry Pi", "d8:3a:dd": "Raspberry Pi",
+	"00:1b:63": "Apple", "00:1f:f3": "Apple", "f0:18:98": "Apple", "ac:bc:32": "Apple",
+	"00:50:56": "VMware", "00:0c:29": "VMware", "08:00:27": "VirtualBox", "52:54:00": "QEMU/KVM",
+	"00:15:5d": "Microsoft Hyper-V", "00:16:3e": "Xen", "02:42:ac": "Docker",
+	"00:11:32": "Synology", "00:08:9b": "QNAP",
+	"24:a4:3c": "Ubiquiti", "78:8a:20": "Ubiquiti", "fc:ec:da": "Ubiquiti",
+	"00:17:88": "Philips Hue", "5c:aa:fd": "Sonos", "b8:e9:37": "Sonos",
+	"18:b4:30": "Nest", "70:ee:50": "Netatmo",
+	"24:0a:c4": "Espressif", "30:ae:a4": "Espressif",
+	"00:1b:21": "Intel", "00:e0:4c": "Realtek", "00:0d:b9": "PC Engines",
+	"00:80:77": "Brother", "00:00:48": "Epson",
+}
+
+var (
+	ouiOnce sync.Once
+	ouiDB   map[string]string
+)
+
+// Files shipped by ieee-data, nmap and wireshark; the first one found is used.
+var ouiFiles = []string{
+	"/usr/share/ieee-data/oui.txt",
+	"/usr/share/misc/oui.txt",
+	"/usr/share/nmap/nmap-mac-prefixes",
+	"/usr/share/wireshark/manuf",
+	"/opt/homebrew/share/nmap/nmap-mac-prefixes",
+	"/usr/local/share/nmap/nmap-mac-prefixes",
+}
+
+var (
+	ouiTxtPattern   = regexp.MustCompile(`^([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})\s+\(hex\)\s+(.+)$`)
+	ouiNmapPattern  = regexp.MustCompile(`^([0-9A-Fa-f]{6})\s+(.+)$`)
+	ouiManufPattern = regexp.MustCompile(`^([0-9A-Fa-f]{2}):([0-9A-Fa-f]{2}):([0-9A-Fa-f]{2})\s+(\S+)(?:\s+(.+))?$`)
+)
+
+func loadOUIDatabase() map[string]string {
+	for _, path := range ouiFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		db := make(map[string]string)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if m := ouiTxtPattern.FindStringSubmatch(line); m != nil {
+				db[strings.ToLower(m[1]+":"+m[2]+":"+m[3])] = strings.TrimSpace(m[4])
+			} else if m := ouiNmapPattern.FindStringSubmatch(line); m != nil {
+				p := strings.ToLower(m[1])
+				db[p[0:2]+":"+p[2:4]+":"+p[4:6]] = strings.TrimSpace(m[2])
+			} else if m := ouiManufPattern.FindStringSubmatch(line); m != nil {
+				vendor := m[4]
+				if m[5] != "" {
+					vendor = m[5]
+				}
+				db[strings.ToLower(m[1]+":"+m[2]+":"+m[3])] = strings.TrimSpace(vendor)
+			}
+		}
+		f.Close()
+		if len(db) > 0 {
+			return db
+		}
+	}
+	return nil
+}
+
+// macVendor names the manufacturer for a MAC address, if known.
+func macVendor(mac string) string {
+	if len(mac) < 8 {
+		return ""
+	}
+	prefix := strings.ToLower(mac[:8])
+	ouiOnce.Do(func() { ouiDB = loadOUIDatabase() })
+	if vendor, ok := ouiDB[prefix]; ok {
+		return vendor
+	}
+	if vendor, ok := builtinOUIs[prefix]; ok {
+		return vendor
+	}
+	// Locally administered addresses are randomized by phones and laptops.
+	if b, err := strconv.ParseUint(prefix[:2], 16, 8); err == nil && b&0x02 != 0 {
+		return "private/randomized"
+	}
+	return ""
+}
+
+// Service types asked for over mDNS, with the label shown for each.
+var mdnsServices = map[string]string{
+	"_services._dns-sd._udp.local.": "",
+	"_workstation._tcp.local.":      "workstation",
+	"_ssh._tcp.local.":              "SSH",
+	"_sftp-ssh._tcp.local.":         "SFTP",
+	"_http._tcp.local.":             "HTTP",
+	"_smb._tcp.local.":              "SMB",
+	"_afpovertcp._tcp.local.":       "AFP",
+	"_ipp._tcp.local.":              "printer",
+	"_printer._tcp.local.":          "printer",
+	"_airplay._tcp.local.":          "AirPlay",
+	"_raop._tcp.local.":             "AirPlay audio",
+	"_googlecast._tcp.local.":       "Chromecast",
+	"_spotify-connect._tcp.local.":  "Spotify Connect",
+	"_homekit._tcp.local.":          "HomeKit",
+	"_hap._tcp.local.":              "HomeKit",
+	"_device-info._tcp.local.":      "",
+}
+
+// discoverMDNS sends one multicast DNS query for common service types and
+// records host names and advertised services from the answers.
+func discoverMDNS(ctx context.Context, devices *lanDevices, inRange func(string) bool) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	builder.EnableCompression()
+	builder.StartQuestions()
+	for service := range mdnsServices {
+		name, err := dnsmessage.NewName(service)
+		if err != nil {
+			continue
+		}
+		// The top bit of the class asks for a unicast reply to our port.
+		builder.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET | 1<<15})
+	}
+	query, err := builder.Finish()
+	if err != nil {
+		return
+	}
+	group := &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	if _, err := conn.WriteToUDP(query, group); err != nil {
+		return
+	}
+
+	readResponses(ctx, conn, func(from *net.UDPAddr, packet []byte) {
+		var msg dnsmessage.Message
+		if err := msg.Unpack(packet); err != nil {
+			return
+		}
+		source := from.IP.String()
+		records := append(msg.Answers, msg.Additionals...)
+		for _, rr := range records {
+			switch body := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				ip := net.IP(body.A[:]).String()
+				if inRange(ip) {
+					devices.update(ip, func(d *lanDevice) { d.addName(rr.Header.Name.String()) })
+				}
+			case *dnsmessage.PTRResource:
+				if label := mdnsServices[rr.Header.Name.String()]; label != "" && inRange(source) {
+					devices.update(source, func(d *lanDevice) { d.addService(label) })
+				}
+			}
+		}
+	})
+}
+
+// discoverSSDP sends a UPnP M-SEARCH and records each responder's server string.
+func discoverSSDP(ctx context.Context, devices *lanDevices, inRange func(string) bool) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: ssdp:all\r\n\r\n"
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+	if _, err := conn.WriteToUDP([]byte(search), group); err != nil {
+		return
+	}
+
+	readResponses(ctx, conn, func(from *net.UDPAddr, packet []byte) {
+		ip := from.IP.String()
+		if !inRange(ip) {
+			return
+		}
+		for _, line := range strings.Split(string(packet), "\r\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "server") && strings.TrimSpace(value) != "" {
+				devices.update(ip, func(d *lanDevice) { d.addService("UPnP: " + strings.TrimSpace(value)) })
+				return
+			}
+		}
+		devices.update(ip, func(d *lanDevice) { d.addService("UPnP") })
+	})
+}
+
+// readResponses hands each datagram to handle until ctx ends.
+func readResponses(ctx context.Context, conn *net.UDPConn, handle func(from *net.UDPAddr, packet []byte)) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(3 * time.Second)
+	}
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		handle(from, buf[:n])
+	}
+}
+
+// netbiosName asks a host for its NetBIOS name table (what Windows and
+// Samba machines call themselves) and returns the workstation name.
+func netbiosName(ip string, timeout time.Duration) string {
+	conn, err := net.DialTimeout("udp4", net.JoinHostPort(ip, "137"), timeout)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+
+	// Node status request for the wildcard name "*".
+	query := []byte{0x13, 0x37, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20}
+	query = append(query, 'C', 'K')
+	for i := 0; i < 15; i++ {
+		query = append(query, 'A', 'A')
+	}
+	query = append(query, 0x00, 0x00, 0x21, 0x00, 0x01)
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(query); err != nil {
+		return ""
+	}
+	resp := make([]byte, 1024)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return ""
+	}
+	return parseNetBIOSNames(resp[:n])
+}
+
+func parseNetBIOSNames(resp []byte) string {
+	// Skip the header and the echoed question name.
+	pos := 12
+	for pos < len(resp) && resp[pos] != 0 {
+		pos += int(resp[pos]) + 1
+	}
+	pos += 1 + 10 // terminator, type, class, TTL, data length
+	if pos >= len(resp) {
+		return ""
+	}
+	count := int(resp[pos])
+	pos++
+	for i := 0; i < count && pos+18 <= len(resp); i++ {
+		entry := resp[pos : pos+18]
+		pos += 18
+		suffix := entry[15]
+		group := entry[16]&0x80 != 0
+		if suffix == 0x00 && !group {
+			return strings.TrimSpace(string(entry[:15]))
+		}
+	}
+	return ""
+}
@@ -12,6 +12,7 @@ import (
 	"q/db"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,12 +27,12 @@ var DocsTools = []Tool{
 		Type: "function",
 		Function: ToolFunction{
 			Name:        "get_docs",
-			Description: "Get documentation for a command, program, or topic. Fetches from man pages, --help, tldr, cheat.sh, or cache.",
+			Description: "Get documentation for a command, program, topic, or a package or symbol of the project's language (e.g. 'context.WithTimeout', 'os.path.join', 'express', 'tokio::spawn'). Fetches from man pages, --help, tldr, cheat.sh, go doc, pydoc, the npm registry, crates.io, or cache.",
 			Parameters: json.RawMessage(`{
 				"type": "object",
 				"properties": {
 					"name": {"type": "string", "description": "Command or topic name (e.g., 'git', 'docker', 'systemctl')"},
-					"source": {"type": "string", "description": "Preferred source: 'man', 'help', 'tldr', 'cheat', 'info', 'auto' (default: auto)"}
+					"source": {"type": "string", "description": "Preferred source: 'man', 'help', 'tldr', 'cheat', 'info', 'go', 'python', 'npm', 'crate', 'auto' (default: auto, which tries the project's language first for names like pkg.Symbol)"}
 				},
 				"required": ["name"],
 				"additionalProperties": false
@@ -53,6 +54,21 @@ var DocsTools = []Tool{
 			}`),
 		},
 	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ask_docs",
+			Description: "Answer a question from cached documentation alone, quoting what it says. Use get_docs or fetch_web_docs first to cache the docs the question needs.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"question": {"type": "string", "description": "The question, e.g. 'how do I extract a single file from a tar archive?'"}
+				},
+				"required": ["question"],
+				"additionalProperties": false
+			}`),
+		},
+	},
 	{
 		Type: "function",
 		Function: ToolFunction{
@@ -100,7 +116,16 @@ var DocsTools = []Tool{
 }
 
 func init() {
-	AvailableTools = append(AvailableTools, DocsTools...)
+	RegisterTools("docs", DocsTools...)
+}
+
+// summarizeDocs is set when the model writes the summaries of fetched docs.
+var summarizeDocs atomic.Bool
+
+// SetSummarizeDocs turns summaries of fetched docs written by the model on
+// or off.
+func SetSummarizeDocs(on bool) {
+	summarizeDocs.Store(on)
 }
 
 func getDocs(args map[string]interface{}) (string, error) {
@@ -114,7 +139,9 @@ func getDocs(args map[string]interface{}) (string, error) {
 		source = s
 	}
 
-	name = strings.TrimSpace(strings.ToLower(name))
+	// Package docs are case-sensitive; the cache is not.
+	query := strings.TrimSpace(name)
+	name = strings.ToLower(query)
 
 	if docsDB != nil {
 		cached, err := docsDB.GetDoc(name, source)
@@ -142,15 +169,19 @@ func getDocs(args map[string]interface{}) (string, error) {
 	case "info":
 		content, err = fetchInfo(name)
 		docSource = "info"
+	case "go", "python", "npm", "crate":
+		lang, _ := langDocsFor(source)
+		content, err = lang.fetch(query)
+		docSource = lang.label
 	default:
-		content, docSource, err = fetchAuto(name)
+		content, docSource, err = fetchAuto(query)
 	}
 
 	if err != nil {
 		return "", err
 	}
 
-	summary = generateSummary(content)
+	summary = summarizeDoc(name, content)
 
 	if docsDB != nil {
 		ttl := 7 * 24 * time.Hour
@@ -160,7 +191,18 @@ func getDocs(args map[string]interface{}) (string, error) {
 	return fmt.Sprintf("[Source: %s]\n\n%s", docSource, content), nil
 }
 
-func fetchAuto(name string) (string, string, error) {
+// fetchAuto tries each source for query in turn. The docs of the project's
+// language come first for names like context.WithTimeout, and last for
+// others, so that a command such as tar is not taken for a package.
+func fetchAuto(query string) (string, string, error) {
+	name := strings.ToLower(query)
+	lang, hasLang := projectLangDocs()
+	if hasLang && qualifiedName(query) {
+		if content, err := lang.fetch(query); err == nil && content != "" {
+			return content, lang.label, nil
+		}
+	}
+
 	if content, err := fetchTLDR(name); err == nil && content != "" {
 		return content, "tldr", nil
 	}
@@ -177,7 +219,13 @@ func fetchAuto(name string) (string, string, error) {
 		return content, "man", nil
 	}
 
-	return "", "", fmt.Errorf("no documentation found for '%s'", name)
+	if hasLang && !qualifiedName(query) {
+		if content, err := lang.fetch(query); err == nil && content != "" {
+			return content, lang.label, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("no documentation found for '%s'", query)
 }
 
 func fetchManPage(name string) (string, error) {
@@ -224,6 +272,11 @@ func fetchHelp(name string) (string, error) {
 }
 
 func fetchTLDR(name string) (string, error) {
+	// Once q docs sync-tldr has run, pages come from its copy alone.
+	if page, synced, err := cachedTLDR(name); synced {
+		return page, err
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -407,7 +460,7 @@ func fetchWebDocs(args map[string]interface{}) (string, error) {
 	content = stripHTML(content)
 	content = strings.TrimSpace(content)
 
-	summary := generateSummary(content)
+	summary := summarizeDoc(name, content)
 
 	if docsDB != nil {
 		ttl := 24 * time.Hour
@@ -594,6 +647,26 @@ func formatDocResult(doc *db.Doc) string {
 	return sb.String()
 }
 
+// docSummaryInput caps how much of a doc the model reads to summarize it,
+// in bytes.
+const docSummaryInput = 12000
+
+// summarizeDoc returns a one-line summary of content, the docs for name:
+// the model's when summarize_docs is on, or else the first line that reads
+// like one, which is also used if the model cannot be reached.
+func summarizeDoc(name, content string) string {
+	if summarizeDocs.Load() {
+		summary, err := Complete(
+			"Summarize the documentation you are given in one sentence of under 30 words: what the command or topic is for and its most common use. Reply with the sentence alone.",
+			fmt.Sprintf("Documentation for %s:\n\n%s", name, truncateStr(content, docSummaryInput)),
+		)
+		if err == nil && strings.TrimSpace(summary) != "" {
+			return strings.Join(strings.Fields(summary), " ")
+		}
+	}
+	return generateSummary(content)
+}
+
 func generateSummary(content string) string {
 	lines := strings.Split(content, "\n")
 	for _, line := range lines {
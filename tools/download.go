@@ -0,0 +1,191 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var DownloadTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "download_file",
+			Description: "Download a URL to a local file with a size limit, optional sha256 verification, and resume of interrupted downloads.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"url": {"type": "string", "description": "http(s) URL to download"},
+					"path": {"type": "string", "description": "Destination file or directory (default: current directory, named after the URL)"},
+					"sha256": {"type": "string", "description": "Expected SHA-256 checksum (hex); the file is deleted if it does not match"},
+					"max_size_mb": {"type": "integer", "description": "Abort if the file is larger than this (default 2048)"},
+					"overwrite": {"type": "boolean", "description": "Replace an existing file at path"}
+				},
+				"required": ["url"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("network", DownloadTools...)
+}
+
+// downloadDest picks the file to write: path itself, or the URL's base name
+// inside path when path is a directory or empty.
+func downloadDest(rawURL, dest string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid url %q: only http and https are supported", rawURL)
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." || name == "" {
+		name = "download"
+	}
+
+	if dest == "" {
+		return name, nil
+	}
+	dest = expandPath(dest)
+	if info, err := os.Stat(dest); (err == nil && info.IsDir()) || strings.HasSuffix(dest, string(filepath.Separator)) {
+		return filepath.Join(dest, name), nil
+	}
+	return dest, nil
+}
+
+func downloadFile(ctx context.Context, args map[string]interface{}) (string, error) {
+	rawURL, _ := args["url"].(string)
+	if rawURL == "" {
+		return "", fmt.Errorf("url required")
+	}
+	dest, _ := args["path"].(string)
+	dest, err := downloadDest(rawURL, dest)
+	if err != nil {
+		return "", err
+	}
+	overwrite, _ := args["overwrite"].(bool)
+	if _, err := os.Stat(dest); err == nil && !overwrite {
+		return "", fmt.Errorf("%s already exists; set overwrite to replace it", dest)
+	}
+
+	expected, _ := args["sha256"].(string)
+	expected = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(expected, "sha256:")))
+	if expected != "" {
+		if b, err := hex.DecodeString(expected); err != nil || len(b) != sha256.Size {
+			return "", fmt.Errorf("sha256 must be 64 hex characters")
+		}
+	}
+
+	maxSize := int64(2048) << 20
+	if m, ok := args["max_size_mb"].(float64); ok && m > 0 {
+		maxSize = int64(m) << 20
+	}
+
+	if dir := filepath.Dir(dest); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	// Partial downloads are kept in <dest>.part and resumed with a Range request.
+	partPath := dest + ".part"
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "shell-ai/1.0")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The part file is already complete.
+		flags = 0
+	case resp.StatusCode == http.StatusOK:
+		offset = 0
+		flags |= os.O_TRUNC
+	default:
+		return "", fmt.Errorf("download failed: HTTP %d", resp.StatusCode)
+	}
+
+	if flags != 0 {
+		if resp.ContentLength > 0 && offset+resp.ContentLength > maxSize {
+			return "", fmt.Errorf("file is %s, over the %s limit", formatBytes(offset+resp.ContentLength), formatBytes(maxSize))
+		}
+		f, err := os.OpenFile(partPath, flags, 0644)
+		if err != nil {
+			return "", fmt.Errorf("failed to open %s: %w", partPath, err)
+		}
+		written, err := io.Copy(f, io.LimitReader(resp.Body, maxSize-offset+1))
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("download interrupted after %s (rerun to resume): %w", formatBytes(offset+written), err)
+		}
+		if offset+written > maxSize {
+			os.Remove(partPath)
+			return "", fmt.Errorf("download exceeded the %s limit", formatBytes(maxSize))
+		}
+	}
+
+	sum, size, err := fileSHA256(partPath)
+	if err != nil {
+		return "", err
+	}
+	if expected != "" && sum != expected {
+		os.Remove(partPath)
+		return "", fmt.Errorf("checksum mismatch: expected %s, got %s (file deleted)", expected, sum)
+	}
+	if err := os.Rename(partPath, dest); err != nil {
+		return "", fmt.Errorf("failed to move download into place: %w", err)
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Downloaded %s to %s (%s)\n", rawURL, dest, formatBytes(size)))
+	if offset > 0 {
+		result.WriteString(fmt.Sprintf("Resumed from %s\n", formatBytes(offset)))
+	}
+	result.WriteString(fmt.Sprintf("sha256: %s", sum))
+	if expected != "" {
+		result.WriteString(" (verified)")
+	}
+	return result.String(), nil
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,249 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+var EnvTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "env_vars",
+			Description: "List environment variables. Values of secrets (keys, tokens, passwords) are redacted.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"filter": {"type": "string", "description": "Only show variables whose name contains this (case-insensitive)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "analyze_path",
+			Description: "Analyze PATH: missing or duplicate entries, and where a command resolves or why it isn't found.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"command": {"type": "string", "description": "Command to look for (optional)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("system", EnvTools...)
+}
+
+var secretNameParts = map[string]bool{
+	"KEY": true, "APIKEY": true, "TOKEN": true, "SECRET": true, "PASSWORD": true,
+	"PASSWD": true, "PASS": true, "PWD": true, "CREDENTIAL": true, "CREDENTIALS": true,
+	"AUTH": true, "COOKIE": true, "PRIVATE": true, "DSN": true,
+}
+
+// secretNameWords mark a secret wherever they appear in a name, as in
+// PGPASSWORD, NPMTOKEN or SECRETKEY.
+var secretNameWords = []string{"PASSWORD", "PASSWD", "TOKEN", "SECRET", "APIKEY", "API_KEY", "CREDENTIAL", "PRIVATE"}
+
+var urlUserinfo = regexp.MustCompile(`://([^/:@\s]+):([^/@\s]+)@`)
+
+// isSecretEnvName reports whether a variable should have its value hidden.
+// Short parts like KEY and PASS must be whole name segments, so KEYBOARD
+// and PASSAGE stay visible, and so does a token limit like MAX_TOKENS.
+func isSecretEnvName(name string) bool {
+	upper := strings.ToUpper(name)
+	switch upper {
+	case "PWD", "OLDPWD", "SSH_AUTH_SOCK":
+		return false
+	case "DATABASE_URL":
+		return true
+	}
+	words := strings.ReplaceAll(upper, "MAX_TOKENS", "")
+	for _, w := range secretNameWords {
+		if strings.Contains(words, w) {
+			return true
+		}
+	}
+	for _, part := range strings.FieldsFunc(upper, func(r rune) bool { return r == '_' || r == '-' }) {
+		if secretNameParts[part] {
+			return true
+		}
+	}
+	return false
+}
+
+func redactEnvValue(name, value string) string {
+	if isSecretEnvName(name) {
+		if value == "" {
+			return ""
+		}
+		return fmt.Sprintf("[redacted, %d chars]", len(value))
+	}
+	return urlUserinfo.ReplaceAllString(value, "://$1:[redacted]@")
+}
+
+func envVars(args map[string]interface{}) (string, error) {
+	filter, _ := args["filter"].(string)
+	filter = strings.ToLower(filter)
+
+	env := os.Environ()
+	sort.Strings(env)
+
+	var result strings.Builder
+	count := 0
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if filter != "" && !strings.Contains(strings.ToLower(name), filter) {
+			continue
+		}
+		result.WriteString(fmt.Sprintf("%s=%s\n", name, truncate(redactEnvValue(name, value), 300)))
+		count++
+	}
+
+	if count == 0 {
+		if filter != "" {
+			return fmt.Sprintf("No environment variables matching '%s'", filter), nil
+		}
+		return "Environment is empty", nil
+	}
+	return result.String(), nil
+}
+
+func commonBinDirs() []string {
+	home, _ := os.UserHomeDir()
+	dirs := []string{"/usr/local/bin", "/usr/bin", "/bin", "/usr/sbin", "/sbin", "/snap/bin"}
+	if runtime.GOOS == "darwin" {
+		dirs = append(dirs, "/opt/homebrew/bin", "/opt/homebrew/sbin")
+	}
+	if home != "" {
+		dirs = append(dirs,
+			filepath.Join(home, ".local", "bin"),
+			filepath.Join(home, "bin"),
+			filepath.Join(home, "go", "bin"),
+			filepath.Join(home, ".cargo", "bin"),
+			filepath.Join(home, ".npm-global", "bin"),
+			filepath.Join(home, ".deno", "bin"),
+			filepath.Join(home, ".bun", "bin"),
+		)
+	}
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		dirs = append(dirs, filepath.Join(gopath, "bin"))
+	}
+	return dirs
+}
+
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return info.Mode()&0111 != 0
+}
+
+func analyzePath(args map[string]interface{}) (string, error) {
+	command, _ := args["command"].(string)
+	entries := filepath.SplitList(os.Getenv("PATH"))
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("PATH has %d entries:\n", len(entries)))
+
+	seen := make(map[string]bool)
+	inPath := make(map[string]bool)
+	for i, dir := range entries {
+		var notes []string
+		if dir == "" {
+			notes = append(notes, "empty entry (means current directory)")
+		} else if seen[dir] {
+			notes = append(notes, "duplicate")
+		} else if info, err := os.Stat(dir); err != nil {
+			notes = append(notes, "missing")
+		} else if !info.IsDir() {
+			notes = append(notes, "not a directory")
+		}
+		seen[dir] = true
+		if abs, err := filepath.Abs(dir); err == nil {
+			inPath[abs] = true
+		}
+
+		line := fmt.Sprintf("  %2d. %s", i+1, dir)
+		if len(notes) > 0 {
+			line += "  [" + strings.Join(notes, ", ") + "]"
+		}
+		result.WriteString(line + "\n")
+	}
+
+	if command == "" {
+		return result.String(), nil
+	}
+
+	result.WriteString(fmt.Sprintf("\nLooking for '%s':\n", command))
+	var matches []string
+	checked := make(map[string]bool)
+	for _, dir := range entries {
+		if dir == "" || checked[dir] {
+			continue
+		}
+		checked[dir] = true
+		candidate := filepath.Join(dir, command)
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		if isExecutableFile(candidate) {
+			matches = append(matches, candidate)
+		} else {
+			result.WriteString(fmt.Sprintf("  %s exists but is not executable (chmod +x)\n", candidate))
+		}
+	}
+
+	if resolved, err := exec.LookPath(command); err == nil {
+		result.WriteString(fmt.Sprintf("  Resolves to: %s\n", resolved))
+		if len(matches) > 1 {
+			result.WriteString("  Also found (shadowed by the first match):\n")
+			for _, m := range matches[1:] {
+				result.WriteString(fmt.Sprintf("    %s\n", m))
+			}
+		}
+		return result.String(), nil
+	}
+
+	result.WriteString("  Not found in PATH\n")
+	var outside []string
+	for _, dir := range commonBinDirs() {
+		abs, _ := filepath.Abs(dir)
+		if inPath[abs] {
+			continue
+		}
+		if candidate := filepath.Join(dir, command); isExecutableFile(candidate) {
+			outside = append(outside, dir)
+		}
+	}
+	if len(outside) > 0 {
+		result.WriteString("  Found outside PATH in:\n")
+		for _, dir := range outside {
+			result.WriteString(fmt.Sprintf("    %s  (add with: export PATH=\"%s:$PATH\")\n", dir, dir))
+		}
+	} else {
+		result.WriteString("  Not found in common install locations either; it may not be installed.\n")
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell != "" {
+		result.WriteString(fmt.Sprintf("  Note: if you just installed it, run 'hash -r' or open a new %s session.\n", filepath.Base(shell)))
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,399 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorParser finds the errors in the output of one language's build and
+// test tools.
+type ErrorParser struct {
+	// Language is what detectLanguage reports for projects in it.
+	Language string
+	// Markers are files, or globs, in a project's root that show it is in
+	// Language.
+	Markers []string
+	Parse   func(output string) []ErrorEvent
+}
+
+var (
+	errorParsers   []ErrorParser
+	errorParsersMu sync.RWMutex
+)
+
+func init() {
+	for _, p := range []ErrorParser{
+		{Language: "go", Markers: []string{"go.mod"}, Parse: parseGoErrors},
+		{Language: "rust", Markers: []string{"Cargo.toml"}, Parse: parseRustErrors},
+		{Language: "javascript", Markers: []string{"package.json"}, Parse: parseJSErrors},
+		{Language: "typescript", Parse: parseJSErrors},
+		{Language: "python", Markers: []string{"requirements.txt"}, Parse: parsePythonErrors},
+		{Language: "java", Markers: []string{"pom.xml", "build.gradle", "build.gradle.kts"}, Parse: parseJavaErrors},
+		{Language: "csharp", Markers: []string{"*.csproj", "*.sln"}, Parse: parseDotnetErrors},
+		{Language: "cpp", Markers: []string{"CMakeLists.txt"}, Parse: parseGCCErrors},
+	} {
+		RegisterErrorParser(p)
+	}
+}
+
+// RegisterErrorParser adds a parser for a language, replacing any parser
+// already registered for it. Projects are detected by the first parser
+// registered whose markers match.
+func RegisterErrorParser(p ErrorParser) {
+	errorParsersMu.Lock()
+	defer errorParsersMu.Unlock()
+	for i := range errorParsers {
+		if errorParsers[i].Language == p.Language {
+			errorParsers[i] = p
+			return
+		}
+	}
+	errorParsers = append(errorParsers, p)
+}
+
+func detectLanguage(dir string) string {
+	errorParsersMu.RLock()
+	defer errorParsersMu.RUnlock()
+	for _, p := range errorParsers {
+		for _, marker := range p.Markers {
+			if matches, _ := filepath.Glob(filepath.Join(dir, marker)); len(matches) > 0 {
+				return p.Language
+			}
+		}
+	}
+
+	return "unknown"
+}
+
+// parseErrorOutput finds the errors in output with the parser for
+// language. Without one, it looks for errors in the GNU format most
+// compilers share, then for anything that mentions an error.
+func parseErrorOutput(output string, language string) []ErrorEvent {
+	var parse func(string) []ErrorEvent
+	errorParsersMu.RLock()
+	for _, p := range errorParsers {
+		if p.Language == language {
+			parse = p.Parse
+		}
+	}
+	errorParsersMu.RUnlock()
+
+	var errors []ErrorEvent
+	if parse != nil {
+		errors = parse(output)
+	} else if errors = parseGNUErrors(output); len(errors) == 0 {
+		errors = parseGenericErrors(output)
+	}
+
+	// Build tools such as Maven and MSBuild repeat errors in a summary.
+	seen := make(map[string]bool)
+	unique := errors[:0]
+	for _, e := range errors {
+		key := fmt.Sprintf("%s:%d:%s", e.File, e.Line, e.Message)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, e)
+		}
+	}
+	return unique
+}
+
+func parseGoErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	goErrorRe := regexp.MustCompile(`^(.+\.go):(\d+):(\d+):\s*(.+)$`)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		matches := goErrorRe.FindStringSubmatch(line)
+		if len(matches) == 5 {
+			lineNum := 0
+			fmt.Sscanf(matches[2], "%d", &lineNum)
+			errors = append(errors, ErrorEvent{
+				Type:       "compile",
+				File:       matches[1],
+				Line:       lineNum,
+				Message:    matches[4],
+				Language:   "go",
+				DetectedAt: time.Now(),
+			})
+		}
+	}
+
+	return errors
+}
+
+func parseRustErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	rustErrorRe := regexp.MustCompile(`error\[E\d+\]:\s*(.+)\n\s*-->\s*(.+):(\d+):(\d+)`)
+	matches := rustErrorRe.FindAllStringSubmatch(output, -1)
+
+	for _, m := range matches {
+		if len(m) >= 4 {
+			lineNum := 0
+			fmt.Sscanf(m[3], "%d", &lineNum)
+			errors = append(errors, ErrorEvent{
+				Type:       "compile",
+				File:       m[2],
+				Line:       lineNum,
+				Message:    m[1],
+				Language:   "rust",
+				DetectedAt: time.Now(),
+			})
+		}
+	}
+
+	return errors
+}
+
+func parseJSErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	tsErrorRe := regexp.MustCompile(`(.+\.tsx?)\((\d+),(\d+)\):\s*error\s+TS\d+:\s*(.+)`)
+	matches := tsErrorRe.FindAllStringSubmatch(output, -1)
+
+	for _, m := range matches {
+		if len(m) >= 5 {
+			lineNum := 0
+			fmt.Sscanf(m[2], "%d", &lineNum)
+			errors = append(errors, ErrorEvent{
+				Type:       "compile",
+				File:       m[1],
+				Line:       lineNum,
+				Message:    m[4],
+				Language:   "typescript",
+				DetectedAt: time.Now(),
+			})
+		}
+	}
+
+	return errors
+}
+
+func parsePythonErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	pyErrorRe := regexp.MustCompile(`File "(.+)", line (\d+)`)
+	syntaxRe := regexp.MustCompile(`SyntaxError:\s*(.+)`)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	var lastFile string
+	var lastLine int
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		fileMatch := pyErrorRe.FindStringSubmatch(line)
+		if len(fileMatch) >= 3 {
+			lastFile = fileMatch[1]
+			fmt.Sscanf(fileMatch[2], "%d", &lastLine)
+		}
+
+		syntaxMatch := syntaxRe.FindStringSubmatch(line)
+		if len(syntaxMatch) >= 2 && lastFile != "" {
+			errors = append(errors, ErrorEvent{
+				Type:       "syntax",
+				File:       lastFile,
+				Line:       lastLine,
+				Message:    syntaxMatch[1],
+				Language:   "python",
+				DetectedAt: time.Now(),
+			})
+		}
+	}
+
+	return errors
+}
+
+func parseJavaErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	// javac, and Gradle running it
+	javacRe := regexp.MustCompile(`^(.+\.(?:java|groovy|scala)):(\d+):\s*error:\s*(.+)$`)
+	// Maven
+	mavenRe := regexp.MustCompile(`^\[ERROR\]\s+(.+\.(?:java|kt|groovy|scala)):\[(\d+),\d+\]\s*(.+)$`)
+	// kotlinc, in its current and older formats
+	kotlinRe := regexp.MustCompile(`^e:\s+(?:file://)?(.+\.kts?):(?:(\d+):\d+|\s*\((\d+),\s*\d+\):)\s*(.+)$`)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var file, lineStr, message string
+		if m := javacRe.FindStringSubmatch(line); m != nil {
+			file, lineStr, message = m[1], m[2], m[3]
+		} else if m := mavenRe.FindStringSubmatch(line); m != nil {
+			file, lineStr, message = m[1], m[2], m[3]
+		} else if m := kotlinRe.FindStringSubmatch(line); m != nil {
+			file, lineStr, message = m[1], m[2]+m[3], m[4]
+		} else {
+			continue
+		}
+		lineNum := 0
+		fmt.Sscanf(lineStr, "%d", &lineNum)
+		errors = append(errors, ErrorEvent{
+			Type:       "compile",
+			File:       file,
+			Line:       lineNum,
+			Message:    message,
+			Language:   "java",
+			DetectedAt: time.Now(),
+		})
+	}
+
+	return errors
+}
+
+func parseDotnetErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	// Program.cs(12,5): error CS0103: The name 'x' does not exist [/src/app.csproj]
+	dotnetRe := regexp.MustCompile(`^(.+?)\((\d+),\d+\):\s*error\s+([A-Z]+\d+):\s*(.+?)(?:\s+\[[^\]]+\])?$`)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	for scanner.Scan() {
+		m := dotnetRe.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		lineNum := 0
+		fmt.Sscanf(m[2], "%d", &lineNum)
+		errors = append(errors, ErrorEvent{
+			Type:       "compile",
+			File:       m[1],
+			Line:       lineNum,
+			Message:    m[3] + ": " + m[4],
+			Language:   "csharp",
+			DetectedAt: time.Now(),
+		})
+	}
+
+	return errors
+}
+
+func parseGCCErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	gccErrorRe := regexp.MustCompile(`^(.+?):(\d+):(?:\d+:)?\s*(?:fatal )?error:\s*(.+)$`)
+	linkErrorRe := regexp.MustCompile(`(undefined reference to .+|Undefined symbols for architecture .+|multiple definition of .+)$`)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := gccErrorRe.FindStringSubmatch(line); m != nil {
+			lineNum := 0
+			fmt.Sscanf(m[2], "%d", &lineNum)
+			errors = append(errors, ErrorEvent{
+				Type:       "compile",
+				File:       m[1],
+				Line:       lineNum,
+				Message:    m[3],
+				Language:   "cpp",
+				DetectedAt: time.Now(),
+			})
+		} else if m := linkErrorRe.FindStringSubmatch(line); m != nil {
+			errors = append(errors, ErrorEvent{
+				Type:       "link",
+				Message:    strings.TrimSuffix(m[1], ":"),
+				Language:   "cpp",
+				DetectedAt: time.Now(),
+			})
+		}
+	}
+
+	return errors
+}
+
+// parseGNUErrors finds errors in the file:line:column: message format of
+// the GNU coding standards, which most compilers and linters use. Warnings
+// and notes are left out.
+func parseGNUErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	gnuErrorRe := regexp.MustCompile(`^([^\s:]+\.\w+):(\d+)(?::\d+)?:\s*(?:(fatal error|error|warning|note|remark):\s*)?(.+)$`)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	for scanner.Scan() {
+		m := gnuErrorRe.FindStringSubmatch(scanner.Text())
+		if m == nil || m[3] == "warning" || m[3] == "note" || m[3] == "remark" {
+			continue
+		}
+		lineNum := 0
+		fmt.Sscanf(m[2], "%d", &lineNum)
+		errors = append(errors, ErrorEvent{
+			Type:       "compile",
+			File:       m[1],
+			Line:       lineNum,
+			Message:    m[4],
+			DetectedAt: time.Now(),
+		})
+	}
+
+	return errors
+}
+
+// parseLintOutput finds the errors linters report, in ESLint's default
+// format, a file name followed by indented line:column problems, or in
+// the file:line:column: message format of golangci-lint, ruff and most
+// others. Warnings are left out.
+func parseLintOutput(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	eslintFileRe := regexp.MustCompile(`^(\S.*\.\w+)$`)
+	eslintProblemRe := regexp.MustCompile(`^\s+(\d+):\d+\s+(error|warning)\s+(.+?)(?:\s{2,}(\S+))?$`)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+
+	file := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := eslintFileRe.FindStringSubmatch(line); m != nil {
+			file = m[1]
+			continue
+		}
+		m := eslintProblemRe.FindStringSubmatch(line)
+		if m == nil || file == "" || m[2] != "error" {
+			continue
+		}
+		lineNum := 0
+		fmt.Sscanf(m[1], "%d", &lineNum)
+		message := m[3]
+		if m[4] != "" {
+			message += " (" + m[4] + ")"
+		}
+		errors = append(errors, ErrorEvent{
+			File:       file,
+			Line:       lineNum,
+			Message:    message,
+			DetectedAt: time.Now(),
+		})
+	}
+
+	if len(errors) == 0 {
+		errors = parseGNUErrors(output)
+	}
+	for i := range errors {
+		errors[i].Type = "lint"
+	}
+	return errors
+}
+
+func parseGenericErrors(output string) []ErrorEvent {
+	var errors []ErrorEvent
+
+	if strings.Contains(strings.ToLower(output), "error") {
+		errors = append(errors, ErrorEvent{
+			Type:       "unknown",
+			Message:    truncate(output, 500),
+			FullOutput: output,
+			DetectedAt: time.Now(),
+		})
+	}
+
+	return errors
+}
@@ -0,0 +1,832 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var ForgeTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "list_issues",
+			Description: "List issues on the GitHub or GitLab project for the current repo (or a given repo).",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"repo": {"type": "string", "description": "owner/name (default: from the origin remote)"},
+					"state": {"type": "string", "enum": ["open", "closed", "all"], "description": "Issue state (default open)"},
+					"labels": {"type": "string", "description": "Comma-separated labels to filter by"},
+					"limit": {"type": "integer", "description": "Maximum issues (default 20)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "create_issue",
+			Description: "Open a new issue on GitHub or GitLab. Requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"title": {"type": "string", "description": "Issue title"},
+					"body": {"type": "string", "description": "Issue description (markdown)"},
+					"labels": {"type": "string", "description": "Comma-separated labels"},
+					"repo": {"type": "string", "description": "owner/name (default: from the origin remote)"}
+				},
+				"required": ["title"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "list_prs",
+			Description: "List pull requests (GitHub) or merge requests (GitLab).",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"repo": {"type": "string", "description": "owner/name (default: from the origin remote)"},
+					"state": {"type": "string", "enum": ["open", "closed", "merged", "all"], "description": "State (default open)"},
+					"base": {"type": "string", "description": "Only PRs targeting this branch"},
+					"limit": {"type": "integer", "description": "Maximum PRs (default 20)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "create_pr",
+			Description: "Open a pull request (GitHub) or merge request (GitLab). The head branch must already be pushed. Requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"title": {"type": "string", "description": "PR title"},
+					"body": {"type": "string", "description": "PR description (markdown)"},
+					"head": {"type": "string", "description": "Source branch (default: current branch)"},
+					"base": {"type": "string", "description": "Target branch (default: main)"},
+					"draft": {"type": "boolean", "description": "Open as draft"},
+					"repo": {"type": "string", "description": "owner/name (default: from the origin remote)"}
+				},
+				"required": ["title"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "get_pr_diff",
+			Description: "Get the diff of a pull/merge request.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"number": {"type": "integer", "description": "PR/MR number"},
+					"repo": {"type": "string", "description": "owner/name (default: from the origin remote)"}
+				},
+				"required": ["number"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "get_pr_comments",
+			Description: "Get discussion and review comments on a pull/merge request.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"number": {"type": "integer", "description": "PR/MR number"},
+					"repo": {"type": "string", "description": "owner/name (default: from the origin remote)"}
+				},
+				"required": ["number"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ci_status",
+			Description: "Show CI check/pipeline status for a branch or commit.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"ref": {"type": "string", "description": "Branch, tag, or SHA (default: current branch)"},
+					"repo": {"type": "string", "description": "owner/name (default: from the origin remote)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("git", ForgeTools...)
+}
+
+type forgeRepo struct {
+	provider string // "github" or "gitlab"
+	host     string
+	path     string // owner/name, may contain subgroups on GitLab
+}
+
+// parseRemoteURL handles scp-style (git@host:owner/repo.git), ssh:// and
+// https:// remotes.
+func parseRemoteURL(remote string) (host, path string, ok bool) {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return "", "", false
+	}
+	if !strings.Contains(remote, "://") {
+		at := strings.Index(remote, "@")
+		colon := strings.Index(remote, ":")
+		if colon < 0 || colon < at {
+			return "", "", false
+		}
+		host = remote[at+1 : colon]
+		path = remote[colon+1:]
+	} else {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", "", false
+		}
+		host = u.Hostname()
+		path = u.Path
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return host, path, host != "" && strings.Contains(path, "/")
+}
+
+func detectForgeRepo(args map[string]interface{}) (forgeRepo, error) {
+	var repo forgeRepo
+
+	remote, _ := runGit(".", "remote", "get-url", "origin")
+	if host, path, ok := parseRemoteURL(remote); ok {
+		repo.host, repo.path = host, path
+	}
+
+	if r, ok := args["repo"].(string); ok && r != "" {
+		if host, path, ok := parseRemoteURL(r); ok {
+			repo.host, repo.path = host, path
+		} else {
+			repo.path = strings.Trim(r, "/")
+		}
+	}
+
+	if repo.path == "" {
+		return repo, fmt.Errorf("could not determine repository; pass repo as owner/name")
+	}
+	if repo.host == "" {
+		repo.host = "github.com"
+		if h := envHost("GITLAB_HOST"); h != "" && os.Getenv("GITHUB_TOKEN") == "" {
+			repo.host = h
+		}
+	}
+
+	repo.provider = "github"
+	if strings.Contains(repo.host, "gitlab") || repo.host == envHost("GITLAB_HOST") {
+		repo.provider = "gitlab"
+	}
+	return repo, nil
+}
+
+func envHost(name string) string {
+	h := strings.TrimPrefix(strings.TrimPrefix(os.Getenv(name), "https://"), "http://")
+	return strings.TrimSuffix(h, "/")
+}
+
+// knownHost reports whether the token from the environment may be sent to
+// r.host: the public forge, or the self-hosted one the user named. The host
+// otherwise comes from a remote or a repo argument, and could be anyone's.
+func (r forgeRepo) knownHost() bool {
+	if r.provider == "gitlab" {
+		return r.host == "gitlab.com" || r.host == envHost("GITLAB_HOST")
+	}
+	return r.host == "github.com" || r.host == envHost("GH_HOST")
+}
+
+func (r forgeRepo) projectID() string {
+	return url.PathEscape(r.path)
+}
+
+func (r forgeRepo) token() string {
+	if !r.knownHost() {
+		return ""
+	}
+	if r.provider == "gitlab" {
+		return firstEnv("GITLAB_TOKEN", "GL_TOKEN")
+	}
+	return firstEnv("GITHUB_TOKEN", "GH_TOKEN")
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// api calls the forge REST API with the token from the environment, or through
+// the gh/glab CLI (which carries the user's login) when no token is set.
+func (r forgeRepo) api(method, endpoint string, body interface{}, accept string) ([]byte, error) {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cli := "gh"
+	if r.provider == "gitlab" {
+		cli = "glab"
+	}
+	if _, err := exec.LookPath(cli); err == nil && r.token() == "" {
+		cliArgs := []string{"api", "--method", method, "--hostname", r.host}
+		if accept != "" {
+			cliArgs = append(cliArgs, "-H", "Accept: "+accept)
+		}
+		if payload != nil {
+			cliArgs = append(cliArgs, "--input", "-")
+		}
+		cliArgs = append(cliArgs, endpoint)
+
+		cmd := exec.CommandContext(ctx, cli, cliArgs...)
+		if payload != nil {
+			cmd.Stdin = bytes.NewReader(payload)
+		}
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s api failed: %s", cli, strings.TrimSpace(stderr.String()+" "+string(output)))
+		}
+		return output, nil
+	}
+
+	token := r.token()
+	if token == "" {
+		if !r.knownHost() {
+			env := "GH_HOST"
+			if r.provider == "gitlab" {
+				env = "GITLAB_HOST"
+			}
+			return nil, fmt.Errorf("not sending a token to %s; install %s or set %s=%s", r.host, cli, env, r.host)
+		}
+		if r.provider == "gitlab" {
+			return nil, fmt.Errorf("install glab or set GITLAB_TOKEN")
+		}
+		return nil, fmt.Errorf("install gh or set GITHUB_TOKEN")
+	}
+
+	base := "https://api.github.com/"
+	if r.provider == "gitlab" {
+		base = fmt.Sprintf("https://%s/api/v4/", r.host)
+	} else if r.host != "github.com" {
+		base = fmt.Sprintf("https://%s/api/v3/", r.host)
+	}
+
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+strings.TrimPrefix(endpoint, "/"), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if r.provider == "gitlab" {
+		req.Header.Set("PRIVATE-TOKEN", token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 5*1024*1024))
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, truncate(string(data), 500))
+	}
+	return data, nil
+}
+
+func forgeLimit(args map[string]interface{}) int {
+	limit := 20
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	return limit
+}
+
+func forgeNumber(args map[string]interface{}) (int, error) {
+	n, ok := args["number"].(float64)
+	if !ok || n <= 0 {
+		return 0, fmt.Errorf("number required")
+	}
+	return int(n), nil
+}
+
+type forgeItem struct {
+	Number       int    `json:"number"`
+	IID          int    `json:"iid"`
+	Title        string `json:"title"`
+	State        string `json:"state"`
+	HTMLURL      string `json:"html_url"`
+	WebURL       string `json:"web_url"`
+	Draft        bool   `json:"draft"`
+	UpdatedAt    string `json:"updated_at"`
+	MergedAt     string `json:"merged_at"`
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+	User         struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Author struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	Head struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	Labels      json.RawMessage `json:"labels"`
+	PullRequest json.RawMessage `json:"pull_request"`
+}
+
+func (it forgeItem) number() int {
+	if it.IID != 0 {
+		return it.IID
+	}
+	return it.Number
+}
+
+func (it forgeItem) author() string {
+	if it.Author.Username != "" {
+		return it.Author.Username
+	}
+	return it.User.Login
+}
+
+func (it forgeItem) url() string {
+	if it.WebURL != "" {
+		return it.WebURL
+	}
+	return it.HTMLURL
+}
+
+func (it forgeItem) labelNames() []string {
+	var names []string
+	var gh []struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(it.Labels, &gh) == nil {
+		for _, l := range gh {
+			names = append(names, l.Name)
+		}
+		return names
+	}
+	json.Unmarshal(it.Labels, &names)
+	return names
+}
+
+func listIssues(args map[string]interface{}) (string, error) {
+	repo, err := detectForgeRepo(args)
+	if err != nil {
+		return "", err
+	}
+	state, _ := args["state"].(string)
+	if state == "" {
+		state = "open"
+	}
+	labels, _ := args["labels"].(string)
+	limit := forgeLimit(args)
+
+	q := url.Values{}
+	q.Set("per_page", fmt.Sprint(limit))
+	if labels != "" {
+		q.Set("labels", labels)
+	}
+	var endpoint string
+	if repo.provider == "gitlab" {
+		if state == "open" {
+			state = "opened"
+		}
+		if state != "all" {
+			q.Set("state", state)
+		}
+		endpoint = fmt.Sprintf("projects/%s/issues?%s", repo.projectID(), q.Encode())
+	} else {
+		q.Set("state", state)
+		endpoint = fmt.Sprintf("repos/%s/issues?%s", repo.path, q.Encode())
+	}
+
+	data, err := repo.api("GET", endpoint, nil, "")
+	if err != nil {
+		return "", err
+	}
+	var items []forgeItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return "", fmt.Errorf("unexpected API response: %w", err)
+	}
+
+	var result strings.Builder
+	count := 0
+	for _, it := range items {
+		// GitHub's issues endpoint also returns pull requests.
+		if len(it.PullRequest) > 0 && string(it.PullRequest) != "null" {
+			continue
+		}
+		result.WriteString(fmt.Sprintf("#%d %s [%s] by %s", it.number(), it.Title, it.State, it.author()))
+		if l := it.labelNames(); len(l) > 0 {
+			result.WriteString(" (" + strings.Join(l, ", ") + ")")
+		}
+		result.WriteString("\n")
+		count++
+	}
+	if count == 0 {
+		return fmt.Sprintf("No %s issues in %s", state, repo.path), nil
+	}
+	return fmt.Sprintf("Issues in %s (%s):\n%s", repo.path, state, result.String()), nil
+}
+
+func createIssue(args map[string]interface{}) (string, error) {
+	repo, err := detectForgeRepo(args)
+	if err != nil {
+		return "", err
+	}
+	title, _ := args["title"].(string)
+	if title == "" {
+		return "", fmt.Errorf("title required")
+	}
+	body, _ := args["body"].(string)
+	labels, _ := args["labels"].(string)
+
+	if err := requireApproval("create_issue", fmt.Sprintf("open issue on %s: %s", repo.path, title)); err != nil {
+		return "", err
+	}
+
+	var endpoint string
+	payload := map[string]interface{}{"title": title}
+	if repo.provider == "gitlab" {
+		endpoint = fmt.Sprintf("projects/%s/issues", repo.projectID())
+		payload["description"] = body
+		if labels != "" {
+			payload["labels"] = labels
+		}
+	} else {
+		endpoint = fmt.Sprintf("repos/%s/issues", repo.path)
+		payload["body"] = body
+		if labels != "" {
+			payload["labels"] = strings.Split(labels, ",")
+		}
+	}
+
+	data, err := repo.api("POST", endpoint, payload, "")
+	if err != nil {
+		return "", err
+	}
+	var it forgeItem
+	json.Unmarshal(data, &it)
+	return fmt.Sprintf("Created issue #%d: %s", it.number(), it.url()), nil
+}
+
+func listPRs(args map[string]interface{}) (string, error) {
+	repo, err := detectForgeRepo(args)
+	if err != nil {
+		return "", err
+	}
+	state, _ := args["state"].(string)
+	if state == "" {
+		state = "open"
+	}
+	base, _ := args["base"].(string)
+
+	q := url.Values{}
+	q.Set("per_page", fmt.Sprint(forgeLimit(args)))
+	var endpoint string
+	if repo.provider == "gitlab" {
+		switch state {
+		case "open":
+			q.Set("state", "opened")
+		case "all":
+		default:
+			q.Set("state", state)
+		}
+		if base != "" {
+			q.Set("target_branch", base)
+		}
+		endpoint = fmt.Sprintf("projects/%s/merge_requests?%s", repo.projectID(), q.Encode())
+	} else {
+		ghState := state
+		if state == "merged" {
+			ghState = "closed"
+		}
+		q.Set("state", ghState)
+		if base != "" {
+			q.Set("base", base)
+		}
+		endpoint = fmt.Sprintf("repos/%s/pulls?%s", repo.path, q.Encode())
+	}
+
+	data, err := repo.api("GET", endpoint, nil, "")
+	if err != nil {
+		return "", err
+	}
+	var items []forgeItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return "", fmt.Errorf("unexpected API response: %w", err)
+	}
+	if len(items) == 0 {
+		return fmt.Sprintf("No %s pull requests in %s", state, repo.path), nil
+	}
+
+	var result strings.Builder
+	for _, it := range items {
+		if repo.provider == "github" && state == "merged" && it.MergedAt == "" {
+			continue
+		}
+		head, baseRef := it.Head.Ref, it.Base.Ref
+		if it.SourceBranch != "" {
+			head, baseRef = it.SourceBranch, it.TargetBranch
+		}
+		draft := ""
+		if it.Draft {
+			draft = " [draft]"
+		}
+		result.WriteString(fmt.Sprintf("#%d %s%s\n    %s -> %s by %s, updated %s\n",
+			it.number(), it.Title, draft, head, baseRef, it.author(), it.UpdatedAt))
+	}
+	return result.String(), nil
+}
+
+func createPR(args map[string]interface{}) (string, error) {
+	repo, err := detectForgeRepo(args)
+	if err != nil {
+		return "", err
+	}
+	title, _ := args["title"].(string)
+	if title == "" {
+		return "", fmt.Errorf("title required")
+	}
+	body, _ := args["body"].(string)
+	head, _ := args["head"].(string)
+	if head == "" {
+		head = currentGitBranch(".")
+	}
+	base, _ := args["base"].(string)
+	if base == "" {
+		base = "main"
+	}
+	draft, _ := args["draft"].(bool)
+
+	if err := requireApproval("create_pr", fmt.Sprintf("open PR on %s: %s (%s -> %s)", repo.path, title, head, base)); err != nil {
+		return "", err
+	}
+
+	var endpoint string
+	var payload map[string]interface{}
+	if repo.provider == "gitlab" {
+		if draft {
+			title = "Draft: " + title
+		}
+		endpoint = fmt.Sprintf("projects/%s/merge_requests", repo.projectID())
+		payload = map[string]interface{}{"title": title, "description": body, "source_branch": head, "target_branch": base}
+	} else {
+		endpoint = fmt.Sprintf("repos/%s/pulls", repo.path)
+		payload = map[string]interface{}{"title": title, "body": body, "head": head, "base": base, "draft": draft}
+	}
+
+	data, err := repo.api("POST", endpoint, payload, "")
+	if err != nil {
+		return "", err
+	}
+	var it forgeItem
+	json.Unmarshal(data, &it)
+	return fmt.Sprintf("Created #%d: %s", it.number(), it.url()), nil
+}
+
+func getPRDiff(args map[string]interface{}) (string, error) {
+	repo, err := detectForgeRepo(args)
+	if err != nil {
+		return "", err
+	}
+	n, err := forgeNumber(args)
+	if err != nil {
+		return "", err
+	}
+
+	if repo.provider == "github" {
+		data, err := repo.api("GET", fmt.Sprintf("repos/%s/pulls/%d", repo.path, n), nil, "application/vnd.github.diff")
+		if err != nil {
+			return "", err
+		}
+		return truncate(string(data), 50000), nil
+	}
+
+	data, err := repo.api("GET", fmt.Sprintf("projects/%s/merge_requests/%d/changes", repo.projectID(), n), nil, "")
+	if err != nil {
+		return "", err
+	}
+	var mr struct {
+		Changes []struct {
+			OldPath string `json:"old_path"`
+			NewPath string `json:"new_path"`
+			Diff    string `json:"diff"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(data, &mr); err != nil {
+		return "", fmt.Errorf("unexpected API response: %w", err)
+	}
+	var result strings.Builder
+	for _, c := range mr.Changes {
+		result.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n%s\n", c.OldPath, c.NewPath, c.Diff))
+	}
+	return truncate(result.String(), 50000), nil
+}
+
+type forgeComment struct {
+	Body      string `json:"body"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	CreatedAt string `json:"created_at"`
+	System    bool   `json:"system"`
+	User      struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Author struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	Position struct {
+		NewPath string `json:"new_path"`
+		NewLine int    `json:"new_line"`
+	} `json:"position"`
+}
+
+func getPRComments(args map[string]interface{}) (string, error) {
+	repo, err := detectForgeRepo(args)
+	if err != nil {
+		return "", err
+	}
+	n, err := forgeNumber(args)
+	if err != nil {
+		return "", err
+	}
+
+	var endpoints []string
+	if repo.provider == "gitlab" {
+		endpoints = []string{fmt.Sprintf("projects/%s/merge_requests/%d/notes?per_page=100&sort=asc", repo.projectID(), n)}
+	} else {
+		endpoints = []string{
+			fmt.Sprintf("repos/%s/issues/%d/comments?per_page=100", repo.path, n),
+			fmt.Sprintf("repos/%s/pulls/%d/comments?per_page=100", repo.path, n),
+		}
+	}
+
+	var result strings.Builder
+	count := 0
+	for _, endpoint := range endpoints {
+		data, err := repo.api("GET", endpoint, nil, "")
+		if err != nil {
+			return "", err
+		}
+		var comments []forgeComment
+		if err := json.Unmarshal(data, &comments); err != nil {
+			return "", fmt.Errorf("unexpected API response: %w", err)
+		}
+		for _, c := range comments {
+			if c.System {
+				continue
+			}
+			author := c.User.Login
+			if c.Author.Username != "" {
+				author = c.Author.Username
+			}
+			path, line := c.Path, c.Line
+			if c.Position.NewPath != "" {
+				path, line = c.Position.NewPath, c.Position.NewLine
+			}
+			loc := ""
+			if path != "" {
+				loc = fmt.Sprintf(" on %s:%d", path, line)
+			}
+			result.WriteString(fmt.Sprintf("--- %s%s (%s)\n%s\n\n", author, loc, c.CreatedAt, strings.TrimSpace(c.Body)))
+			count++
+		}
+	}
+	if count == 0 {
+		return fmt.Sprintf("No comments on #%d", n), nil
+	}
+	return truncate(result.String(), 30000), nil
+}
+
+func ciStatus(args map[string]interface{}) (string, error) {
+	repo, err := detectForgeRepo(args)
+	if err != nil {
+		return "", err
+	}
+	ref, _ := args["ref"].(string)
+	if ref == "" {
+		ref = currentGitBranch(".")
+	}
+	if ref == "" {
+		return "", fmt.Errorf("ref required")
+	}
+
+	var result strings.Builder
+	if repo.provider == "github" {
+		data, err := repo.api("GET", fmt.Sprintf("repos/%s/commits/%s/check-runs?per_page=100", repo.path, url.PathEscape(ref)), nil, "")
+		if err != nil {
+			return "", err
+		}
+		var checks struct {
+			CheckRuns []struct {
+				Name       string `json:"name"`
+				Status     string `json:"status"`
+				Conclusion string `json:"conclusion"`
+				HTMLURL    string `json:"html_url"`
+			} `json:"check_runs"`
+		}
+		if err := json.Unmarshal(data, &checks); err != nil {
+			return "", fmt.Errorf("unexpected API response: %w", err)
+		}
+		if len(checks.CheckRuns) == 0 {
+			return fmt.Sprintf("No CI checks for %s", ref), nil
+		}
+		result.WriteString(fmt.Sprintf("Checks for %s:\n", ref))
+		for _, c := range checks.CheckRuns {
+			state := c.Status
+			if c.Conclusion != "" {
+				state = c.Conclusion
+			}
+			result.WriteString(fmt.Sprintf("  %-10s %s\n", state, c.Name))
+			if state == "failure" {
+				result.WriteString(fmt.Sprintf("             %s\n", c.HTMLURL))
+			}
+		}
+		return result.String(), nil
+	}
+
+	data, err := repo.api("GET", fmt.Sprintf("projects/%s/pipelines?ref=%s&per_page=1", repo.projectID(), url.QueryEscape(ref)), nil, "")
+	if err != nil {
+		return "", err
+	}
+	var pipelines []struct {
+		ID     int    `json:"id"`
+		Status string `json:"status"`
+		WebURL string `json:"web_url"`
+	}
+	if err := json.Unmarshal(data, &pipelines); err != nil {
+		return "", fmt.Errorf("unexpected API response: %w", err)
+	}
+	if len(pipelines) == 0 {
+		return fmt.Sprintf("No pipelines for %s", ref), nil
+	}
+	p := pipelines[0]
+	result.WriteString(fmt.Sprintf("Pipeline #%d for %s: %s\n%s\n", p.ID, ref, p.Status, p.WebURL))
+
+	data, err = repo.api("GET", fmt.Sprintf("projects/%s/pipelines/%d/jobs?per_page=100", repo.projectID(), p.ID), nil, "")
+	if err == nil {
+		var jobs []struct {
+			Name   string `json:"name"`
+			Stage  string `json:"stage"`
+			Status string `json:"status"`
+		}
+		json.Unmarshal(data, &jobs)
+		for _, j := range jobs {
+			result.WriteString(fmt.Sprintf("  %-10s %s/%s\n", j.Status, j.Stage, j.Name))
+		}
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,438 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var GitTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "git_add",
+			Description: "Stage files for commit. Requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"files": {"type": "array", "items": {"type": "string"}, "description": "Files or pathspecs to stage"},
+					"all": {"type": "boolean", "description": "Stage all changes including untracked files"},
+					"path": {"type": "string", "description": "Repository path (default: current directory)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "git_commit",
+			Description: "Commit staged changes. Leave message empty to generate a conventional commit message from the staged diff. Requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"message": {"type": "string", "description": "Commit message (generated from the diff if empty)"},
+					"all": {"type": "boolean", "description": "Stage modified tracked files before committing (git commit -a)"},
+					"path": {"type": "string", "description": "Repository path (default: current directory)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "git_branch",
+			Description: "List, create, or delete branches. Creating and deleting require user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"action": {"type": "string", "enum": ["list", "create", "delete"], "description": "Action (default list)"},
+					"name": {"type": "string", "description": "Branch name for create/delete"},
+					"start_point": {"type": "string", "description": "Commit or branch to create from (default HEAD)"},
+					"path": {"type": "string", "description": "Repository path (default: current directory)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "git_checkout",
+			Description: "Switch to a branch or commit, optionally creating the branch. Requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"ref": {"type": "string", "description": "Branch, tag, or commit"},
+					"create": {"type": "boolean", "description": "Create the branch (git switch -c)"},
+					"path": {"type": "string", "description": "Repository path (default: current directory)"}
+				},
+				"required": ["ref"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "git_stash",
+			Description: "Stash or restore uncommitted changes. Anything other than list requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"action": {"type": "string", "enum": ["list", "push", "pop", "apply", "drop"], "description": "Action (default list)"},
+					"message": {"type": "string", "description": "Message for push"},
+					"index": {"type": "integer", "description": "Stash index for pop/apply/drop (default 0)"},
+					"include_untracked": {"type": "boolean", "description": "Include untracked files when pushing"},
+					"path": {"type": "string", "description": "Repository path (default: current directory)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "git_push",
+			Description: "Push commits to a remote. Requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"remote": {"type": "string", "description": "Remote name (default origin)"},
+					"branch": {"type": "string", "description": "Branch to push (default current branch)"},
+					"set_upstream": {"type": "boolean", "description": "Set upstream tracking (-u)"},
+					"force": {"type": "boolean", "description": "Force push with --force-with-lease"},
+					"path": {"type": "string", "description": "Repository path (default: current directory)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("git", GitTools...)
+}
+
+func gitRepoPath(args map[string]interface{}) string {
+	if p, ok := args["path"].(string); ok && p != "" {
+		return expandPath(p)
+	}
+	return "."
+}
+
+func runGit(repo string, gitArgs ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo}, gitArgs...)...)
+	output, err := cmd.CombinedOutput()
+	result := strings.TrimSpace(string(output))
+	if ctx.Err() == context.DeadlineExceeded {
+		return result, fmt.Errorf("git %s timed out", gitArgs[0])
+	}
+	if err != nil {
+		return result, fmt.Errorf("git %s failed: %s", gitArgs[0], result)
+	}
+	return result, nil
+}
+
+func gitRefExists(repo, ref string) bool {
+	_, err := runGit(repo, "rev-parse", "--verify", "--quiet", "--end-of-options", ref)
+	return err == nil
+}
+
+func currentGitBranch(repo string) string {
+	branch, err := runGit(repo, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return branch
+}
+
+const commitMessagePrompt = `You write git commit messages in the Conventional Commits format.
+Reply with only the commit message: a subject line of at most 72 characters
+("type(scope): summary", imperative mood), then optionally a blank line and a
+short body explaining why. No code fences, no quotes.`
+
+// GenerateCommitMessage asks the model for a conventional commit message
+// describing diff.
+func GenerateCommitMessage(diff string) (string, error) {
+	msg, err := Complete(commitMessagePrompt, "Write a commit message for this diff:\n\n"+truncate(diff, 30000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate commit message: %w", err)
+	}
+	msg = strings.TrimSpace(strings.Trim(strings.TrimSpace(msg), "`"))
+	if msg == "" {
+		return "", fmt.Errorf("model returned an empty commit message")
+	}
+	return msg, nil
+}
+
+func gitAdd(args map[string]interface{}) (string, error) {
+	repo := gitRepoPath(args)
+
+	var files []string
+	if raw, ok := args["files"].([]interface{}); ok {
+		for _, f := range raw {
+			if s, ok := f.(string); ok && s != "" {
+				files = append(files, s)
+			}
+		}
+	}
+	all, _ := args["all"].(bool)
+	if len(files) == 0 && !all {
+		return "", fmt.Errorf("files or all required")
+	}
+
+	gitArgs := []string{"add"}
+	desc := "git add " + strings.Join(files, " ")
+	if all {
+		gitArgs = append(gitArgs, "--all")
+		desc = "git add --all"
+	} else {
+		gitArgs = append(gitArgs, "--")
+		gitArgs = append(gitArgs, files...)
+	}
+
+	if err := requireApproval("git_add", desc+" in "+repo); err != nil {
+		return "", err
+	}
+	if _, err := runGit(repo, gitArgs...); err != nil {
+		return "", err
+	}
+
+	staged, _ := runGit(repo, "diff", "--cached", "--stat")
+	if staged == "" {
+		return "Nothing staged", nil
+	}
+	return "Staged:\n" + staged, nil
+}
+
+func gitCommit(args map[string]interface{}) (string, error) {
+	repo := gitRepoPath(args)
+	all, _ := args["all"].(bool)
+	message, _ := args["message"].(string)
+
+	diffArgs := []string{"diff", "--cached"}
+	if all {
+		diffArgs = []string{"diff", "HEAD"}
+	}
+	stat, err := runGit(repo, append(diffArgs, "--stat")...)
+	if err != nil {
+		return "", err
+	}
+	if stat == "" {
+		return "Nothing to commit (stage changes with git_add first)", nil
+	}
+
+	if strings.TrimSpace(message) == "" {
+		diff, err := runGit(repo, diffArgs...)
+		if err != nil {
+			return "", err
+		}
+		message, err = GenerateCommitMessage(diff)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := requireApproval("git_commit", fmt.Sprintf("commit in %s:\n\n%s\n\n%s", repo, message, stat)); err != nil {
+		return "", err
+	}
+
+	gitArgs := []string{"commit", "-m", message}
+	if all {
+		gitArgs = append(gitArgs, "-a")
+	}
+	output, err := runGit(repo, gitArgs...)
+	if err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+func gitBranch(args map[string]interface{}) (string, error) {
+	repo := gitRepoPath(args)
+	action, _ := args["action"].(string)
+	name, _ := args["name"].(string)
+
+	switch action {
+	case "", "list":
+		return runGit(repo, "branch", "-vv", "--all")
+	case "create":
+		if name == "" {
+			return "", fmt.Errorf("name required")
+		}
+		if strings.HasPrefix(name, "-") {
+			return "", fmt.Errorf("invalid branch name %q", name)
+		}
+		desc := "create branch " + name
+		gitArgs := []string{"branch", "--end-of-options", name}
+		if sp, ok := args["start_point"].(string); ok && sp != "" {
+			if strings.HasPrefix(sp, "-") {
+				return "", fmt.Errorf("invalid start_point %q", sp)
+			}
+			desc += " at " + sp
+			gitArgs = append(gitArgs, sp)
+		}
+		if err := requireApproval("git_branch", desc); err != nil {
+			return "", err
+		}
+		if _, err := runGit(repo, gitArgs...); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Created branch %s", name), nil
+	case "delete":
+		if name == "" {
+			return "", fmt.Errorf("name required")
+		}
+		if strings.HasPrefix(name, "-") {
+			return "", fmt.Errorf("invalid branch name %q", name)
+		}
+		if err := requireApproval("git_branch", "delete branch "+name); err != nil {
+			return "", err
+		}
+		// -d refuses to delete unmerged work; the user can force it by hand.
+		return runGit(repo, "branch", "-d", "--end-of-options", name)
+	default:
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+func gitCheckout(args map[string]interface{}) (string, error) {
+	repo := gitRepoPath(args)
+	ref, _ := args["ref"].(string)
+	if ref == "" {
+		return "", fmt.Errorf("ref required")
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid ref %q", ref)
+	}
+	create, _ := args["create"].(bool)
+
+	// git switch, unlike checkout, never takes ref for a path to overwrite,
+	// and refuses to drop uncommitted changes.
+	desc := fmt.Sprintf("switch %s from %s to %s", repo, currentGitBranch(repo), ref)
+	gitArgs := []string{"switch", "--end-of-options", ref}
+	if create {
+		desc = fmt.Sprintf("create and switch to branch %s in %s", ref, repo)
+		gitArgs = []string{"switch", "-c", ref}
+	} else if !gitRefExists(repo, "refs/heads/"+ref) && gitRefExists(repo, ref+"^{commit}") {
+		// A tag or commit; a remote branch name is left to switch, which
+		// creates a branch tracking it.
+		gitArgs = []string{"switch", "--detach", "--end-of-options", ref}
+	}
+	if err := requireApproval("git_checkout", desc); err != nil {
+		return "", err
+	}
+
+	output, err := runGit(repo, gitArgs...)
+	if err != nil {
+		return "", err
+	}
+	if output == "" {
+		output = "Switched to " + ref
+	}
+	return output, nil
+}
+
+func gitStash(args map[string]interface{}) (string, error) {
+	repo := gitRepoPath(args)
+	action, _ := args["action"].(string)
+
+	index := 0
+	if i, ok := args["index"].(float64); ok {
+		index = int(i)
+	}
+	ref := fmt.Sprintf("stash@{%d}", index)
+
+	var gitArgs []string
+	var desc string
+	switch action {
+	case "", "list":
+		output, err := runGit(repo, "stash", "list")
+		if err != nil {
+			return "", err
+		}
+		if output == "" {
+			return "No stashes", nil
+		}
+		return output, nil
+	case "push":
+		gitArgs = []string{"stash", "push"}
+		if untracked, _ := args["include_untracked"].(bool); untracked {
+			gitArgs = append(gitArgs, "--include-untracked")
+		}
+		if msg, ok := args["message"].(string); ok && msg != "" {
+			gitArgs = append(gitArgs, "-m", msg)
+		}
+		desc = "stash uncommitted changes in " + repo
+	case "pop", "apply", "drop":
+		gitArgs = []string{"stash", action, ref}
+		desc = fmt.Sprintf("git stash %s %s in %s", action, ref, repo)
+	default:
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+
+	if err := requireApproval("git_stash", desc); err != nil {
+		return "", err
+	}
+	return runGit(repo, gitArgs...)
+}
+
+func gitPush(args map[string]interface{}) (string, error) {
+	repo := gitRepoPath(args)
+
+	remote := "origin"
+	if r, ok := args["remote"].(string); ok && r != "" {
+		remote = r
+	}
+	branch, _ := args["branch"].(string)
+	if branch == "" {
+		branch = currentGitBranch(repo)
+	}
+	if branch == "" || branch == "HEAD" {
+		return "", fmt.Errorf("could not determine branch to push")
+	}
+	if strings.HasPrefix(remote, "-") {
+		return "", fmt.Errorf("invalid remote %q", remote)
+	}
+	if strings.HasPrefix(branch, "-") {
+		return "", fmt.Errorf("invalid branch %q", branch)
+	}
+
+	gitArgs := []string{"push"}
+	if up, _ := args["set_upstream"].(bool); up {
+		gitArgs = append(gitArgs, "-u")
+	}
+	force, _ := args["force"].(bool)
+	if force {
+		gitArgs = append(gitArgs, "--force-with-lease")
+	}
+	gitArgs = append(gitArgs, "--end-of-options", remote, branch)
+
+	desc := fmt.Sprintf("push %s to %s in %s", branch, remote, repo)
+	if force {
+		desc = "FORCE " + desc
+	}
+	if err := requireApproval("git_push", desc); err != nil {
+		return "", err
+	}
+
+	// Listed only once approved, so nothing runs with the model's remote
+	// and branch before the user has seen them.
+	ahead, _ := runGit(repo, "log", "--oneline", "--end-of-options", fmt.Sprintf("%s/%s..%s", remote, branch, branch))
+	output, err := runGit(repo, gitArgs...)
+	if err != nil {
+		return "", err
+	}
+	if ahead != "" {
+		output = strings.TrimSpace("Pushed:\n" + truncate(ahead, 2000) + "\n" + output)
+	}
+	return output, nil
+}
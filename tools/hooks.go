@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"q/types"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHookTimeout bounds how long a hook may run unless it sets its own
+// timeout.
+const defaultHookTimeout = 30 * time.Second
+
+var (
+	hooksMu sync.RWMutex
+	hooks   types.HooksConfig
+)
+
+// SetHooks installs the hooks preferences.
+func SetHooks(cfg types.HooksConfig) {
+	hooksMu.Lock()
+	hooks = cfg
+	hooksMu.Unlock()
+}
+
+// BlockedError is returned for a query or tool call a hook refused.
+type BlockedError struct {
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return "blocked by hook: " + e.Reason
+}
+
+// hookEvent is what a hook gets on stdin.
+type hookEvent struct {
+	// Event is pre_query, post_response, pre_tool or post_tool.
+	Event     string                 `json:"event"`
+	Model     string                 `json:"model,omitempty"`
+	Prompt    string                 `json:"prompt,omitempty"`
+	Response  string                 `json:"response,omitempty"`
+	Tool      string                 `json:"tool,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Result    string                 `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Dir       string                 `json:"cwd"`
+}
+
+// hookReply is what a hook may print on stdout. Fields it leaves out
+// change nothing.
+type hookReply struct {
+	Block     bool                   `json:"block"`
+	Reason    string                 `json:"reason"`
+	Prompt    *string                `json:"prompt"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Result    *string                `json:"result"`
+	Response  *string                `json:"response"`
+}
+
+// RunPreQueryHooks runs the pre_query hooks, each on the prompt the one
+// before left, and returns the prompt to send. A hook that blocks the
+// query, or fails, stops it with a *BlockedError.
+func RunPreQueryHooks(ctx context.Context, model, prompt string) (string, error) {
+	hooksMu.RLock()
+	list := hooks.PreQuery
+	hooksMu.RUnlock()
+	for _, h := range list {
+		reply, err := runHook(ctx, h, hookEvent{Event: "pre_query", Model: model, Prompt: prompt})
+		if err != nil {
+			return "", &BlockedError{Reason: err.Error()}
+		}
+		if reply.Block {
+			return "", &BlockedError{Reason: blockReason(h, reply)}
+		}
+		if reply.Prompt != nil {
+			prompt = *reply.Prompt
+		}
+	}
+	return prompt, nil
+}
+
+// RunPostResponseHooks runs the post_response hooks, each on the response
+// the one before left, and returns the response to show. Hooks that fail
+// leave it as it was.
+func RunPostResponseHooks(ctx context.Context, model, prompt, response string) string {
+	hooksMu.RLock()
+	list := hooks.PostResponse
+	hooksMu.RUnlock()
+	for _, h := range list {
+		reply, err := runHook(ctx, h, hookEvent{Event: "post_response", Model: model, Prompt: prompt, Response: response})
+		if err == nil && reply.Response != nil {
+			response = *reply.Response
+		}
+	}
+	return response
+}
+
+// preToolHooks runs the pre_tool hooks for a call of the tool called name
+// and returns the arguments to call it with, or a *BlockedError if a hook
+// refuses the call or fails.
+func preToolHooks(ctx context.Context, name string, args map[string]interface{}) (map[string]interface{}, error) {
+	for _, h := range toolHooks(name, false) {
+		reply, err := runHook(ctx, h, hookEvent{Event: "pre_tool", Tool: name, Arguments: args})
+		if err != nil {
+			return nil, &BlockedError{Reason: err.Error()}
+		}
+		if reply.Block {
+			return nil, &BlockedError{Reason: blockReason(h, reply)}
+		}
+		if reply.Arguments != nil {
+			args = reply.Arguments
+		}
+	}
+	return args, nil
+}
+
+// postToolHooks runs the post_tool hooks for a call of the tool called
+// name that returned result and callErr, and returns the result to give
+// the model. Hooks see failed calls too, but cannot replace their result.
+func postToolHooks(ctx context.Context, name string, args map[string]interface{}, result string, callErr error) string {
+	for _, h := range toolHooks(name, true) {
+		event := hookEvent{Event: "post_tool", Tool: name, Arguments: args, Result: result}
+		if callErr != nil {
+			event.Error = callErr.Error()
+		}
+		reply, err := runHook(ctx, h, event)
+		if err == nil && callErr == nil && reply.Result != nil {
+			result = *reply.Result
+		}
+	}
+	return result
+}
+
+// toolHooks returns the pre_tool, or for post the post_tool, hooks that
+// apply to the tool called name.
+func toolHooks(name string, post bool) []types.Hook {
+	hooksMu.RLock()
+	list := hooks.PreTool
+	if post {
+		list = hooks.PostTool
+	}
+	hooksMu.RUnlock()
+	var matched []types.Hook
+	for _, h := range list {
+		if len(h.Tools) == 0 || roleAllowsTool(h.Tools, name) {
+			matched = append(matched, h)
+		}
+	}
+	return matched
+}
+
+func blockReason(h types.Hook, reply hookReply) string {
+	if reply.Reason != "" {
+		return reply.Reason
+	}
+	return h.Run
+}
+
+// runHook runs h's script with event as JSON on stdin and parses what it
+// prints. A script that exits non-zero fails with what it wrote to stderr.
+func runHook(ctx context.Context, h types.Hook, event hookEvent) (hookReply, error) {
+	var reply hookReply
+	event.Dir, _ = os.Getwd()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return reply, err
+	}
+
+	timeout := defaultHookTimeout
+	if h.Timeout > 0 {
+		timeout = time.Duration(h.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "bash"
+	}
+	cmd := exec.CommandContext(ctx, shell, "-c", h.Run)
+	cmd.Env = append(os.Environ(), "SHELL_AI_HOOK_EVENT="+event.Event)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return reply, fmt.Errorf("%s hook %q timed out after %s", event.Event, h.Run, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return reply, fmt.Errorf("%s", msg)
+		}
+		return reply, fmt.Errorf("%s hook %q failed: %w", event.Event, h.Run, err)
+	}
+
+	out := bytes.TrimSpace(stdout.Bytes())
+	if len(out) == 0 {
+		return reply, nil
+	}
+	if err := json.Unmarshal(out, &reply); err != nil {
+		return reply, fmt.Errorf("%s hook %q printed something other than a JSON object: %s", event.Event, h.Run, truncate(string(out), 100))
+	}
+	return reply, nil
+}
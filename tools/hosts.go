@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"q/db"
+	"strings"
+)
+
+var hostsDB *db.DB
+
+func InitHostsDB(database *db.DB) {
+	hostsDB = database
+}
+
+// inventoryHost returns the inventory entry for name, or nil when there is
+// none or the database isn't open.
+func inventoryHost(name string) *db.Host {
+	if hostsDB == nil {
+		return nil
+	}
+	h, err := hostsDB.GetHost(name)
+	if err != nil {
+		return nil
+	}
+	return h
+}
+
+// inventoryGroup returns the hosts in a group (or with a tag).
+func inventoryGroup(group string) ([]db.Host, error) {
+	if hostsDB == nil {
+		return nil, fmt.Errorf("host inventory not available")
+	}
+	hosts, err := hostsDB.ListHosts(group)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no inventory hosts in group %q (add them with `q hosts add`)", group)
+	}
+	return hosts, nil
+}
+
+// DescribeHost renders one inventory line, shared by ssh_hosts and `q hosts list`.
+func DescribeHost(h db.Host) string {
+	var b strings.Builder
+	b.WriteString(h.Name)
+	target := h.Address
+	if h.User != "" {
+		target = h.User + "@" + target
+	}
+	if h.Port > 0 && h.Port != 22 {
+		target = fmt.Sprintf("%s:%d", target, h.Port)
+	}
+	b.WriteString(" -> " + target)
+	if len(h.Groups) > 0 {
+		b.WriteString(" [" + strings.Join(h.Groups, ", ") + "]")
+	}
+	if len(h.Tags) > 0 {
+		b.WriteString(" #" + strings.Join(h.Tags, " #"))
+	}
+	if h.Description != "" {
+		b.WriteString(" - " + h.Description)
+	}
+	return b.String()
+}
+
+// sshExecGroup runs a command on every host in an inventory group, as
+// ssh_exec_multi does, logging in with the call's user, port and key.
+func sshExecGroup(ctx context.Context, group, command string, args map[string]interface{}) (string, error) {
+	members, err := inventoryGroup(group)
+	if err != nil {
+		return "", err
+	}
+	hosts := make([]string, len(members))
+	for i, h := range members {
+		hosts[i] = h.Name
+	}
+
+	var login sshLogin
+	login.user, _ = args["user"].(string)
+	login.keyPath, _ = args["key_path"].(string)
+	login.usePassword, _ = args["password_auth"].(bool)
+	if p, ok := args["port"].(float64); ok {
+		login.port = int(p)
+	}
+
+	results := runSSHMulti(ctx, hosts, command, login, defaultSSHParallel, defaultSSHHostTimeout)
+	return formatSSHMulti(command, results), nil
+}
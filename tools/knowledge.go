@@ -1,11 +1,13 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"q/db"
 	"strings"
+	"sync"
 )
 
 var knowledgeDB *db.DB
@@ -14,8 +16,157 @@ func InitKnowledgeDB(database *db.DB) {
 	knowledgeDB = database
 }
 
+var knowledgeSource func() (sessionID, model string)
+
+// SetKnowledgeSource installs the callback naming the session and model
+// that learned knowledge is attributed to.
+func SetKnowledgeSource(source func() (sessionID, model string)) {
+	approvalMu.Lock()
+	knowledgeSource = source
+	approvalMu.Unlock()
+}
+
+var (
+	embeddingModel string
+	embed          func(ctx context.Context, texts []string) ([][]float32, error)
+)
+
+// SetEmbedder installs the function recall_knowledge embeds text with to
+// find knowledge by meaning, and the model it uses. A nil embed leaves
+// recall to keyword search.
+func SetEmbedder(model string, fn func(ctx context.Context, texts []string) ([][]float32, error)) {
+	approvalMu.Lock()
+	embeddingModel, embed = model, fn
+	approvalMu.Unlock()
+}
+
+const (
+	// embedBatch is how many texts go in one embeddings request, and
+	// embedPerRecall caps how many new ones a recall embeds before
+	// searching, so a large backlog is caught up over several recalls.
+	embedBatch     = 64
+	embedPerRecall = 256
+)
+
+// semanticRecall embeds knowledge not yet embedded, then finds what is
+// closest in meaning to query.
+func semanticRecall(ctx context.Context, query, entityType, projectPath string, limit int) ([]db.SemanticMatch, error) {
+	model, fn := embeddingModel, embed
+	if fn == nil {
+		return nil, nil
+	}
+	pending, err := knowledgeDB.PendingEmbeddings(model, embedPerRecall)
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(pending); start += embedBatch {
+		batch := pending[start:min(start+embedBatch, len(pending))]
+		texts := make([]string, len(batch))
+		for i, item := range batch {
+			texts[i] = item.Text
+		}
+		vectors, err := fn(ctx, texts)
+		if err != nil {
+			return nil, err
+		}
+		if err := knowledgeDB.SaveEmbeddings(model, batch, vectors); err != nil {
+			return nil, err
+		}
+	}
+	vectors, err := fn(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return knowledgeDB.SemanticSearch(vectors[0], model, entityType, projectPath, limit)
+}
+
+// recordCommandOutcome remembers whether command worked in the current
+// project. For a command that keeps failing it returns a note to add to
+// the output, so the model tries something else.
+func recordCommandOutcome(command string, exitCode int, output string) string {
+	if knowledgeDB == nil {
+		return ""
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	project := db.ProjectKey(cwd)
+	if knowledgeDB.RecordCommandOutcome(command, project, cwd, exitCode, output) != nil || exitCode == 0 {
+		return ""
+	}
+	o, err := knowledgeDB.CommandOutcome(command, project)
+	if err != nil || o == nil || o.FailureCount < 2 || !o.Failing() {
+		return ""
+	}
+	return fmt.Sprintf("\n[This command has failed %d of %d times here; try a different approach]", o.FailureCount, o.FailureCount+o.SuccessCount)
+}
+
+const (
+	recentOutputCount = 20
+	recentOutputMax   = 64 * 1024
+)
+
+var (
+	recentOutputs   []string
+	recentOutputsMu sync.Mutex
+)
+
+// noteToolOutput keeps the latest tool outputs, so that knowledge the model
+// learns can be checked against what commands actually printed.
+func noteToolOutput(tool, output string) {
+	registryMu.RLock()
+	category := toolCategoryOf[tool]
+	registryMu.RUnlock()
+	if category == "knowledge" || output == "" {
+		return
+	}
+	if len(output) > recentOutputMax {
+		output = output[len(output)-recentOutputMax:]
+	}
+	recentOutputsMu.Lock()
+	recentOutputs = append(recentOutputs, strings.ToLower(output))
+	if len(recentOutputs) > recentOutputCount {
+		recentOutputs = recentOutputs[len(recentOutputs)-recentOutputCount:]
+	}
+	recentOutputsMu.Unlock()
+}
+
+// seenInOutput reports whether s appears in a recent tool output. Strings
+// too short to mean anything never do.
+func seenInOutput(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) < 3 {
+		return false
+	}
+	recentOutputsMu.Lock()
+	defer recentOutputsMu.Unlock()
+	for _, out := range recentOutputs {
+		if strings.Contains(out, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// attribution credits knowledge learned through tool to the current
+// session and model. It counts as verified when every piece of evidence
+// appears in a recent tool output, and as merely asserted otherwise.
+func attribution(tool string, evidence ...string) db.Attribution {
+	attr := db.Attribution{Source: tool, Trust: db.TrustVerified}
+	if source := knowledgeSource; source != nil {
+		attr.SessionID, attr.Model = source()
+	}
+	for _, e := range evidence {
+		if !seenInOutput(e) {
+			attr.Trust = db.TrustAsserted
+		}
+	}
+	return attr
+}
+
 func init() {
-	AvailableTools = append(AvailableTools,
+	RegisterTools("knowledge",
 		Tool{
 			Type: "function",
 			Function: ToolFunction{
@@ -97,7 +248,7 @@ func init() {
 			Type: "function",
 			Function: ToolFunction{
 				Name:        "recall_knowledge",
-				Description: "Search the knowledge graph for relevant information about a topic.",
+				Description: "Search the knowledge graph for relevant information about a topic. Finds entities and facts by meaning as well as by words when embeddings are enabled.",
 				Parameters: json.RawMessage(`{
 					"type": "object",
 					"properties": {
@@ -159,6 +310,42 @@ func init() {
 				}`),
 			},
 		},
+		Tool{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        "explore_knowledge",
+				Description: "Explore the knowledge graph around an entity: what is connected to it within a few hops, in either direction, and via which relations (e.g. which services depend on something that uses postgres).",
+				Parameters: json.RawMessage(`{
+					"type": "object",
+					"properties": {
+						"entity_name": {"type": "string", "description": "Entity to start from"},
+						"entity_type": {"type": "string", "description": "Entity type, if the name alone is ambiguous"},
+						"max_hops": {"type": "integer", "description": "How many relations away to look (default 2, at most 4)"},
+						"relations": {"type": "array", "items": {"type": "string"}, "description": "Only follow these relations, e.g. depends_on"},
+						"limit": {"type": "integer", "description": "Max entities (default 20)"}
+					},
+					"required": ["entity_name"],
+					"additionalProperties": false
+				}`),
+			},
+		},
+		Tool{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        "merge_entities",
+				Description: "Record that several names refer to the same entity (e.g. postgres, postgresql, Postgres 15). Entities under the other names are merged into it, with their relations and facts, and every name becomes an alias so it is recognized from then on.",
+				Parameters: json.RawMessage(`{
+					"type": "object",
+					"properties": {
+						"entity_type": {"type": "string", "description": "Entity type"},
+						"entity_name": {"type": "string", "description": "The name to keep"},
+						"other_names": {"type": "array", "items": {"type": "string"}, "description": "Other names for the same entity"}
+					},
+					"required": ["entity_type", "entity_name", "other_names"],
+					"additionalProperties": false
+				}`),
+			},
+		},
 		Tool{
 			Type: "function",
 			Function: ToolFunction{
@@ -193,12 +380,12 @@ func learnEntity(args map[string]interface{}) (string, error) {
 		projectPath = getCurrentProjectPath()
 	}
 
-	entity, err := knowledgeDB.UpsertEntity(entityType, name, value, projectPath)
+	entity, err := knowledgeDB.UpsertEntity(entityType, name, value, projectPath, attribution("learn_entity", name))
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("Learned entity: [%s] %s (seen %d times)", entity.Type, entity.Name, entity.OccurrenceCount), nil
+	return fmt.Sprintf("Learned entity: [%s] %s (seen %d times, trust: %s)", entity.Type, entity.Name, entity.OccurrenceCount, entity.Trust), nil
 }
 
 func learnRelation(args map[string]interface{}) (string, error) {
@@ -215,12 +402,12 @@ func learnRelation(args map[string]interface{}) (string, error) {
 
 	projectPath := getCurrentProjectPath()
 
-	source, err := knowledgeDB.UpsertEntity(sourceType, sourceName, "", projectPath)
+	source, err := knowledgeDB.UpsertEntity(sourceType, sourceName, "", projectPath, attribution("learn_relation", sourceName))
 	if err != nil {
 		return "", fmt.Errorf("failed to ensure source entity: %w", err)
 	}
 
-	target, err := knowledgeDB.UpsertEntity(targetType, targetName, "", projectPath)
+	target, err := knowledgeDB.UpsertEntity(targetType, targetName, "", projectPath, attribution("learn_relation", targetName))
 	if err != nil {
 		return "", fmt.Errorf("failed to ensure target entity: %w", err)
 	}
@@ -250,13 +437,24 @@ func learnFact(args map[string]interface{}) (string, error) {
 		projectPath = getCurrentProjectPath()
 	}
 
-	fact, err := knowledgeDB.UpsertFact(category, subject, predicate, object, projectPath, "ai_learned", 1.0)
+	fact, err := knowledgeDB.UpsertFact(category, subject, predicate, object, projectPath, attribution("learn_fact", object), 1.0)
 	if err != nil {
 		return "", err
 	}
+	if fact.Object != object {
+		return fmt.Sprintf("Not learned: the known fact %s %s %s (%s, confidence: %.2f) outweighs it",
+			fact.Subject, fact.Predicate, fact.Object, fact.Trust, fact.Confidence), nil
+	}
 
-	return fmt.Sprintf("Learned fact: %s %s %s (verified %d times)",
-		fact.Subject, fact.Predicate, fact.Object, fact.VerificationCount), nil
+	if fact.Rejected {
+		return fmt.Sprintf("Not learned: the user rejected %s %s %s", fact.Subject, fact.Predicate, fact.Object), nil
+	}
+	learned := fmt.Sprintf("Learned fact: %s %s %s (verified %d times, trust: %s)",
+		fact.Subject, fact.Predicate, fact.Object, fact.VerificationCount, fact.Trust)
+	if fact.Category == db.PreferenceCategory && fact.Trust < db.TrustUser {
+		learned += fmt.Sprintf(". The user can accept or reject it with q preferences learned (f%d)", fact.ID)
+	}
+	return learned, nil
 }
 
 func learnErrorPattern(args map[string]interface{}) (string, error) {
@@ -286,7 +484,7 @@ func learnErrorPattern(args map[string]interface{}) (string, error) {
 		pattern.ErrorType, truncate(pattern.ErrorSignature, 50), pattern.RootCause, pattern.Solution), nil
 }
 
-func recallKnowledge(args map[string]interface{}) (string, error) {
+func recallKnowledge(ctx context.Context, args map[string]interface{}) (string, error) {
 	if knowledgeDB == nil {
 		return "", fmt.Errorf("knowledge database not initialized")
 	}
@@ -294,7 +492,7 @@ func recallKnowledge(args map[string]interface{}) (string, error) {
 	query, _ := args["query"].(string)
 	entityType, _ := args["entity_type"].(string)
 	limit := 10
-	if l, ok := args["limit"].(float64); ok {
+	if l, ok := args["limit"].(float64); ok && l > 0 {
 		limit = int(l)
 	}
 
@@ -308,19 +506,60 @@ func recallKnowledge(args map[string]interface{}) (string, error) {
 		return "", err
 	}
 
-	if len(entities) == 0 {
+	// Keyword matches come first; ones found only by meaning fill the rest.
+	similarity := make(map[int64]float64)
+	var facts []db.KnowledgeFact
+	matches, semanticErr := semanticRecall(ctx, query, entityType, projectPath, limit*2)
+	seen := make(map[int64]bool)
+	for _, e := range entities {
+		seen[e.ID] = true
+	}
+	for _, m := range matches {
+		switch {
+		case m.Entity != nil && !seen[m.Entity.ID] && len(entities) < limit:
+			seen[m.Entity.ID] = true
+			similarity[m.Entity.ID] = m.Similarity
+			entities = append(entities, *m.Entity)
+		case m.Fact != nil && len(facts) < limit:
+			facts = append(facts, *m.Fact)
+		}
+	}
+
+	if len(entities) == 0 && len(facts) == 0 {
+		if semanticErr != nil {
+			return fmt.Sprintf("No relevant knowledge found (search by meaning failed: %v).", semanticErr), nil
+		}
 		return "No relevant knowledge found.", nil
 	}
 
 	var result strings.Builder
-	result.WriteString(fmt.Sprintf("Found %d relevant entities:\n\n", len(entities)))
+	if len(entities) > 0 {
+		result.WriteString(fmt.Sprintf("Found %d relevant entities:\n\n", len(entities)))
+	}
 
 	for _, e := range entities {
 		result.WriteString(fmt.Sprintf("[%s] %s", e.Type, e.Name))
 		if e.Value != "" {
 			result.WriteString(fmt.Sprintf(": %s", truncate(e.Value, 100)))
 		}
-		result.WriteString(fmt.Sprintf(" (seen %d times)\n", e.OccurrenceCount))
+		result.WriteString(fmt.Sprintf(" (seen %d times, %s", e.OccurrenceCount, e.Trust))
+		if sim, ok := similarity[e.ID]; ok {
+			result.WriteString(fmt.Sprintf(", %.0f%% similar", sim*100))
+		}
+		result.WriteString(")\n")
+	}
+
+	if len(facts) > 0 {
+		if len(entities) > 0 {
+			result.WriteString("\n")
+		}
+		result.WriteString("Related facts:\n\n")
+		for _, f := range facts {
+			result.WriteString(fmt.Sprintf("- %s %s %s [%s, confidence: %.2f]\n", f.Subject, f.Predicate, f.Object, f.Trust, f.Confidence))
+		}
+	}
+	if semanticErr != nil {
+		result.WriteString(fmt.Sprintf("\n(Search by meaning failed: %v)\n", semanticErr))
 	}
 
 	return result.String(), nil
@@ -359,8 +598,8 @@ func recallFacts(args map[string]interface{}) (string, error) {
 		if f.ProjectPath != "" {
 			scope = "project"
 		}
-		result.WriteString(fmt.Sprintf("- %s %s %s [%s, confidence: %.2f]\n",
-			f.Subject, f.Predicate, f.Object, scope, f.Confidence))
+		result.WriteString(fmt.Sprintf("- %s %s %s [%s, %s, confidence: %.2f]\n",
+			f.Subject, f.Predicate, f.Object, scope, f.Trust, f.Confidence))
 	}
 
 	return result.String(), nil
@@ -390,7 +629,7 @@ func findErrorSolution(args map[string]interface{}) (string, error) {
 	result.WriteString(fmt.Sprintf("Found %d matching error patterns:\n\n", len(patterns)))
 
 	for i, p := range patterns {
-		result.WriteString(fmt.Sprintf("%d. [%s] %s\n", i+1, p.ErrorType, truncate(p.ErrorSignature, 60)))
+		result.WriteString(fmt.Sprintf("%d. [%s] %s (%.0f%% match)\n", i+1, p.ErrorType, truncate(p.ErrorSignature, 60), p.Similarity*100))
 		if p.RootCause != "" {
 			result.WriteString(fmt.Sprintf("   Root cause: %s\n", p.RootCause))
 		}
@@ -448,6 +687,132 @@ func getRelated(args map[string]interface{}) (string, error) {
 	return result.String(), nil
 }
 
+func exploreKnowledge(args map[string]interface{}) (string, error) {
+	if knowledgeDB == nil {
+		return "", fmt.Errorf("knowledge database not initialized")
+	}
+
+	entityName, _ := args["entity_name"].(string)
+	entityType, _ := args["entity_type"].(string)
+	if entityName == "" {
+		return "", fmt.Errorf("entity_name is required")
+	}
+	maxHops := 2
+	if h, ok := args["max_hops"].(float64); ok {
+		maxHops = int(h)
+	}
+	limit := 20
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+	var relations []string
+	if rs, ok := args["relations"].([]interface{}); ok {
+		for _, r := range rs {
+			if r, ok := r.(string); ok && r != "" {
+				relations = append(relations, r)
+			}
+		}
+	}
+
+	projectPath := getCurrentProjectPath()
+	var entity *db.KnowledgeEntity
+	var err error
+	if entityType != "" {
+		entity, err = knowledgeDB.GetEntity(entityType, entityName, projectPath)
+	} else {
+		var found []db.KnowledgeEntity
+		found, err = knowledgeDB.SearchEntities(entityName, "", projectPath, 1)
+		if len(found) > 0 {
+			entity = &found[0]
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if entity == nil {
+		return fmt.Sprintf("Entity '%s' not found.", entityName), nil
+	}
+
+	paths, err := knowledgeDB.TraverseKnowledge(entity.ID, maxHops, relations, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return fmt.Sprintf("Nothing is connected to [%s] %s.", entity.Type, entity.Name), nil
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Connected to [%s] %s:\n\n", entity.Type, entity.Name))
+	for _, p := range paths {
+		reached := p.Reached()
+		result.WriteString(fmt.Sprintf("- [%s] %s: %s", reached.Type, reached.Name, entity.Name))
+		for _, step := range p.Steps {
+			if step.Incoming {
+				result.WriteString(fmt.Sprintf(" <-[%s]- %s", step.Relation.Relation, step.Entity.Name))
+			} else {
+				result.WriteString(fmt.Sprintf(" -[%s]-> %s", step.Relation.Relation, step.Entity.Name))
+			}
+		}
+		result.WriteString(fmt.Sprintf(" (%d hop", len(p.Steps)))
+		if len(p.Steps) > 1 {
+			result.WriteString("s")
+		}
+		result.WriteString(fmt.Sprintf(", confidence: %.2f)\n", p.Confidence))
+	}
+
+	return result.String(), nil
+}
+
+func mergeEntities(args map[string]interface{}) (string, error) {
+	if knowledgeDB == nil {
+		return "", fmt.Errorf("knowledge database not initialized")
+	}
+
+	entityType, _ := args["entity_type"].(string)
+	entityName, _ := args["entity_name"].(string)
+	others, _ := args["other_names"].([]interface{})
+	if entityType == "" || entityName == "" || len(others) == 0 {
+		return "", fmt.Errorf("entity_type, entity_name and other_names are required")
+	}
+
+	projectPath := getCurrentProjectPath()
+	entity, err := knowledgeDB.GetEntity(entityType, entityName, projectPath)
+	if err != nil {
+		return "", err
+	}
+	if entity == nil {
+		if entity, err = knowledgeDB.UpsertEntity(entityType, entityName, "", projectPath, attribution("merge_entities", entityName)); err != nil {
+			return "", err
+		}
+	}
+
+	var duplicates []int64
+	var aliases []string
+	for _, o := range others {
+		name, _ := o.(string)
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		dup, err := knowledgeDB.GetEntity(entityType, name, projectPath)
+		if err != nil {
+			return "", err
+		}
+		if dup != nil && dup.ID != entity.ID {
+			duplicates = append(duplicates, dup.ID)
+		}
+		if _, err := knowledgeDB.AddAlias(entity.ID, name); err != nil {
+			return "", err
+		}
+		aliases = append(aliases, name)
+	}
+	if entity, err = knowledgeDB.MergeEntities(entity.ID, duplicates); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("[%s] %s is also known as %s (%d duplicate entities merged, seen %d times)",
+		entity.Type, entity.Name, strings.Join(aliases, ", "), len(duplicates), entity.OccurrenceCount), nil
+}
+
 func knowledgeSummary(args map[string]interface{}) (string, error) {
 	if knowledgeDB == nil {
 		return "", fmt.Errorf("knowledge database not initialized")
@@ -477,9 +842,11 @@ func knowledgeSummary(args map[string]interface{}) (string, error) {
 	return result.String(), nil
 }
 
+// getCurrentProjectPath returns the project key knowledge about the
+// current directory is stored under.
 func getCurrentProjectPath() string {
 	if cwd, err := os.Getwd(); err == nil {
-		return cwd
+		return db.ProjectKey(cwd)
 	}
 	return ""
 }
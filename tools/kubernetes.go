@@ -0,0 +1,285 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var KubernetesTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "k8s_get",
+			Description: "List Kubernetes resources (pods, deployments, services, nodes, events, ...) via kubectl.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"kind": {"type": "string", "description": "Resource kind, e.g. pods, deployments, svc"},
+					"name": {"type": "string", "description": "Resource name (optional)"},
+					"namespace": {"type": "string", "description": "Namespace (default from context)"},
+					"all_namespaces": {"type": "boolean", "description": "List across all namespaces"},
+					"selector": {"type": "string", "description": "Label selector, e.g. app=web"},
+					"output": {"type": "string", "description": "Output format: wide (default), yaml, json"},
+					"context": {"type": "string", "description": "kubeconfig context to use"},
+					"kubeconfig": {"type": "string", "description": "Path to kubeconfig (default KUBECONFIG or ~/.kube/config)"}
+				},
+				"required": ["kind"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "k8s_describe",
+			Description: "Describe a Kubernetes resource, including recent events. Useful for diagnosing failing pods.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"kind": {"type": "string", "description": "Resource kind, e.g. pod, deployment"},
+					"name": {"type": "string", "description": "Resource name"},
+					"namespace": {"type": "string", "description": "Namespace (default from context)"},
+					"context": {"type": "string", "description": "kubeconfig context to use"},
+					"kubeconfig": {"type": "string", "description": "Path to kubeconfig"}
+				},
+				"required": ["kind", "name"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "k8s_logs",
+			Description: "Get logs from a pod container.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"pod": {"type": "string", "description": "Pod name (or deployment/name, job/name)"},
+					"container": {"type": "string", "description": "Container name (optional)"},
+					"namespace": {"type": "string", "description": "Namespace (default from context)"},
+					"tail": {"type": "integer", "description": "Number of lines from the end (default 200)"},
+					"since": {"type": "string", "description": "Only logs newer than a duration, e.g. 10m, 1h"},
+					"previous": {"type": "boolean", "description": "Logs from the previous terminated container"},
+					"context": {"type": "string", "description": "kubeconfig context to use"},
+					"kubeconfig": {"type": "string", "description": "Path to kubeconfig"}
+				},
+				"required": ["pod"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "k8s_apply",
+			Description: "Apply a manifest to the cluster. Always runs a server-side dry run first; the real apply requires user approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"file": {"type": "string", "description": "Path to manifest file or directory"},
+					"manifest": {"type": "string", "description": "Inline YAML manifest (used if file is empty)"},
+					"namespace": {"type": "string", "description": "Namespace (default from context)"},
+					"dry_run": {"type": "boolean", "description": "Only validate, do not change the cluster"},
+					"context": {"type": "string", "description": "kubeconfig context to use"},
+					"kubeconfig": {"type": "string", "description": "Path to kubeconfig"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "k8s_contexts",
+			Description: "List kubeconfig contexts and show which one is current.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"kubeconfig": {"type": "string", "description": "Path to kubeconfig"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("kubernetes", KubernetesTools...)
+}
+
+// kubectlArgs builds the global flags shared by every k8s tool.
+func kubectlArgs(args map[string]interface{}) []string {
+	var flags []string
+	if kc, ok := args["kubeconfig"].(string); ok && kc != "" {
+		flags = append(flags, "--kubeconfig", expandPath(kc))
+	}
+	if ctx, ok := args["context"].(string); ok && ctx != "" {
+		flags = append(flags, "--context", ctx)
+	}
+	if ns, ok := args["namespace"].(string); ok && ns != "" {
+		flags = append(flags, "--namespace", ns)
+	}
+	return flags
+}
+
+func runKubectl(stdin string, cmdArgs ...string) (string, error) {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return "", fmt.Errorf("kubectl not found in PATH")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "kubectl", cmdArgs...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("kubectl timed out after 30s")
+	}
+	if err != nil {
+		return "", fmt.Errorf("kubectl %s failed: %s", cmdArgs[0], strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func k8sGet(args map[string]interface{}) (string, error) {
+	kind, ok := args["kind"].(string)
+	if !ok || kind == "" {
+		return "", fmt.Errorf("kind required")
+	}
+
+	cmdArgs := []string{"get", kind}
+	if name, ok := args["name"].(string); ok && name != "" {
+		cmdArgs = append(cmdArgs, name)
+	}
+	cmdArgs = append(cmdArgs, kubectlArgs(args)...)
+	if all, ok := args["all_namespaces"].(bool); ok && all {
+		cmdArgs = append(cmdArgs, "--all-namespaces")
+	}
+	if sel, ok := args["selector"].(string); ok && sel != "" {
+		cmdArgs = append(cmdArgs, "--selector", sel)
+	}
+
+	output := "wide"
+	if o, ok := args["output"].(string); ok && o != "" {
+		output = o
+	}
+	cmdArgs = append(cmdArgs, "-o", output)
+
+	result, err := runKubectl("", cmdArgs...)
+	if err != nil {
+		return "", err
+	}
+	if result == "" {
+		return "No resources found", nil
+	}
+	return truncate(result, 20000), nil
+}
+
+func k8sDescribe(args map[string]interface{}) (string, error) {
+	kind, _ := args["kind"].(string)
+	name, _ := args["name"].(string)
+	if kind == "" || name == "" {
+		return "", fmt.Errorf("kind and name required")
+	}
+
+	cmdArgs := append([]string{"describe", kind, name}, kubectlArgs(args)...)
+	result, err := runKubectl("", cmdArgs...)
+	if err != nil {
+		return "", err
+	}
+	return truncate(result, 20000), nil
+}
+
+func k8sLogs(args map[string]interface{}) (string, error) {
+	pod, ok := args["pod"].(string)
+	if !ok || pod == "" {
+		return "", fmt.Errorf("pod required")
+	}
+
+	tail := 200
+	if t, ok := args["tail"].(float64); ok && t > 0 {
+		tail = int(t)
+	}
+
+	cmdArgs := append([]string{"logs", pod}, kubectlArgs(args)...)
+	cmdArgs = append(cmdArgs, fmt.Sprintf("--tail=%d", tail))
+	if c, ok := args["container"].(string); ok && c != "" {
+		cmdArgs = append(cmdArgs, "--container", c)
+	}
+	if since, ok := args["since"].(string); ok && since != "" {
+		cmdArgs = append(cmdArgs, "--since", since)
+	}
+	if prev, ok := args["previous"].(bool); ok && prev {
+		cmdArgs = append(cmdArgs, "--previous")
+	}
+
+	result, err := runKubectl("", cmdArgs...)
+	if err != nil {
+		return "", err
+	}
+	if result == "" {
+		return "No log output", nil
+	}
+	return truncate(result, 20000), nil
+}
+
+func k8sApply(args map[string]interface{}) (string, error) {
+	file, _ := args["file"].(string)
+	manifest, _ := args["manifest"].(string)
+	if file == "" && manifest == "" {
+		return "", fmt.Errorf("file or manifest required")
+	}
+
+	cmdArgs := append([]string{"apply"}, kubectlArgs(args)...)
+	source := "inline manifest"
+	if file != "" {
+		file = expandPath(file)
+		cmdArgs = append(cmdArgs, "-f", file)
+		source = file
+		manifest = ""
+	} else {
+		cmdArgs = append(cmdArgs, "-f", "-")
+	}
+
+	preview, err := runKubectl(manifest, append(cmdArgs, "--dry-run=server")...)
+	if err != nil {
+		return "", err
+	}
+
+	if dry, ok := args["dry_run"].(bool); ok && dry {
+		return fmt.Sprintf("Dry run (server):\n%s", preview), nil
+	}
+
+	target := "current context"
+	if ctx, ok := args["context"].(string); ok && ctx != "" {
+		target = "context " + ctx
+	}
+	if err := requireApproval("k8s_apply", fmt.Sprintf("kubectl apply %s to %s\n%s", source, target, preview)); err != nil {
+		return "", err
+	}
+
+	result, err := runKubectl(manifest, cmdArgs...)
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+func k8sContexts(args map[string]interface{}) (string, error) {
+	result, err := runKubectl("", append([]string{"config", "get-contexts"}, kubectlArgs(args)...)...)
+	if err != nil {
+		return "", err
+	}
+	if result == "" {
+		return "No contexts configured", nil
+	}
+	return result, nil
+}
@@ -0,0 +1,243 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// langDocs is where the docs of a language's packages and symbols come
+// from.
+type langDocs struct {
+	// source is the get_docs source that asks for them, and label how
+	// results from it are marked.
+	source string
+	label  string
+	fetch  func(name string) (string, error)
+}
+
+// langDocSources are the package docs of each language detectLanguage
+// reports.
+var langDocSources = map[string]langDocs{
+	"go":         {source: "go", label: "go doc", fetch: fetchGoDoc},
+	"python":     {source: "python", label: "pydoc", fetch: fetchPydoc},
+	"javascript": {source: "npm", label: "npm", fetch: fetchNpm},
+	"typescript": {source: "npm", label: "npm", fetch: fetchNpm},
+	"rust":       {source: "crate", label: "crates.io", fetch: fetchCrate},
+}
+
+// langDocsFor returns the docs source called source, such as go or npm.
+func langDocsFor(source string) (langDocs, bool) {
+	for _, l := range langDocSources {
+		if l.source == source {
+			return l, true
+		}
+	}
+	return langDocs{}, false
+}
+
+// projectLangDocs returns the docs source for the language of the project
+// in the current directory, if it has one.
+func projectLangDocs() (langDocs, bool) {
+	dir, _ := os.Getwd()
+	lang := detectLanguage(dir)
+	if lang == "unknown" {
+		// detectLanguage knows Python projects by requirements.txt alone.
+		for _, marker := range []string{"pyproject.toml", "setup.py"} {
+			if _, err := os.Stat(marker); err == nil {
+				lang = "python"
+			}
+		}
+	}
+	l, ok := langDocSources[lang]
+	return l, ok
+}
+
+// qualifiedName reports whether name looks like a package or symbol, such
+// as context.WithTimeout, tokio::spawn or @types/node, rather than a
+// command, which the project's language docs are tried for first.
+func qualifiedName(name string) bool {
+	return strings.ContainsAny(name, "./:@")
+}
+
+// blockEndRe matches the ends of HTML blocks, such as paragraphs.
+var blockEndRe = regexp.MustCompile(`(?i)</(p|h[1-6]|li|pre|div|tr|table|ul|ol|blockquote)>|<br\s*/?>`)
+
+// maxLangDoc caps the docs kept from a language source, in bytes.
+const maxLangDoc = 50000
+
+func fetchGoDoc(name string) (string, error) {
+	if strings.HasPrefix(name, "-") {
+		return "", fmt.Errorf("'%s' is not a Go package or symbol", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// Run in the current directory, so the module's own packages and
+	// dependencies are found.
+	output, err := exec.CommandContext(ctx, "go", "doc", "--", name).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("go doc found nothing for '%s': %s", name, strings.TrimSpace(string(output)))
+	}
+	return truncateStr(strings.TrimSpace(string(output)), maxLangDoc), nil
+}
+
+// pythonNameRe matches a dotted Python name, such as os.path.join.
+var pythonNameRe = regexp.MustCompile(`^[A-Za-z_]\w*(\.[A-Za-z_]\w*)*$`)
+
+func fetchPydoc(name string) (string, error) {
+	// pydoc takes anything else for a file or an option, some of which
+	// start a server.
+	if !pythonNameRe.MatchString(name) {
+		return "", fmt.Errorf("'%s' is not a Python module or name", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	python := "python3"
+	if _, err := exec.LookPath(python); err != nil {
+		python = "python"
+	}
+	// pydoc imports what it documents, and python -m looks for modules in
+	// the directory it runs in first; an empty one keeps it from running
+	// the project's code.
+	dir, err := os.MkdirTemp("", "shell-ai-pydoc-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	cmd := exec.CommandContext(ctx, python, "-m", "pydoc", "--", name)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PAGER=cat")
+	output, err := cmd.CombinedOutput()
+	content := strings.TrimSpace(string(output))
+	if err != nil || strings.HasPrefix(content, "No Python documentation found") {
+		return "", fmt.Errorf("pydoc found nothing for '%s'", name)
+	}
+	return truncateStr(content, maxLangDoc), nil
+}
+
+// fetchNpm returns the description and README of the npm package called
+// name from the registry. For a name like express.Router, with no package
+// of its own, it returns the docs of express.
+func fetchNpm(name string) (string, error) {
+	var pkg struct {
+		Name        string            `json:"name"`
+		Description string            `json:"description"`
+		DistTags    map[string]string `json:"dist-tags"`
+		Homepage    string            `json:"homepage"`
+		Readme      string            `json:"readme"`
+	}
+	status, err := getDocJSON("https://registry.npmjs.org/"+url.PathEscape(name), &pkg)
+	if status == http.StatusNotFound && !strings.HasPrefix(name, "@") && strings.Contains(name, ".") {
+		base, _, _ := strings.Cut(name, ".")
+		status, err = getDocJSON("https://registry.npmjs.org/"+url.PathEscape(base), &pkg)
+	}
+	if status == http.StatusNotFound {
+		return "", fmt.Errorf("no npm package is named '%s'", name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s %s: %s\n", pkg.Name, pkg.DistTags["latest"], pkg.Description))
+	if pkg.Homepage != "" {
+		sb.WriteString("Homepage: " + pkg.Homepage + "\n")
+	}
+	if pkg.Readme != "" {
+		sb.WriteString("\n" + pkg.Readme)
+	}
+	return truncateStr(strings.TrimSpace(sb.String()), maxLangDoc), nil
+}
+
+// fetchCrate returns the description and README of the crate name, or the
+// crate of a path such as tokio::spawn, from crates.io.
+func fetchCrate(name string) (string, error) {
+	crate, item, _ := strings.Cut(name, "::")
+	var info struct {
+		Crate struct {
+			Name          string `json:"name"`
+			Description   string `json:"description"`
+			Version       string `json:"max_stable_version"`
+			MaxVersion    string `json:"max_version"`
+			Documentation string `json:"documentation"`
+			Repository    string `json:"repository"`
+		} `json:"crate"`
+	}
+	status, err := getDocJSON("https://crates.io/api/v1/crates/"+url.PathEscape(crate), &info)
+	if status == http.StatusNotFound {
+		return "", fmt.Errorf("no crate is named '%s'", crate)
+	}
+	if err != nil {
+		return "", err
+	}
+	c := info.Crate
+	if c.Version == "" {
+		c.Version = c.MaxVersion
+	}
+	if c.Documentation == "" {
+		c.Documentation = fmt.Sprintf("https://docs.rs/%s", c.Name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s %s: %s\n", c.Name, c.Version, strings.TrimSpace(c.Description)))
+	sb.WriteString("Docs: " + c.Documentation + "\n")
+	if item != "" {
+		sb.WriteString(fmt.Sprintf("API docs for %s: https://docs.rs/%s/latest/%s/?search=%s\n", item, c.Name, strings.ReplaceAll(c.Name, "-", "_"), url.QueryEscape(item)))
+	}
+	if c.Repository != "" {
+		sb.WriteString("Repository: " + c.Repository + "\n")
+	}
+	if readme, _, err := getDoc(fmt.Sprintf("https://crates.io/api/v1/crates/%s/%s/readme", url.PathEscape(c.Name), url.PathEscape(c.Version))); err == nil {
+		// Keep the README's blocks on lines of their own.
+		html := blockEndRe.ReplaceAllString(string(readme), "$0\n")
+		sb.WriteString("\n" + strings.TrimSpace(stripHTML(html)))
+	}
+	return truncateStr(strings.TrimSpace(sb.String()), maxLangDoc), nil
+}
+
+// getDocJSON decodes the JSON at url into v and returns the HTTP status.
+func getDocJSON(url string, v interface{}) (int, error) {
+	body, status, err := getDoc(url)
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return status, fmt.Errorf("unexpected reply from %s: %w", url, err)
+	}
+	return status, nil
+}
+
+// getDoc fetches url, failing unless it answers 200, and returns the body
+// and the HTTP status.
+func getDoc(url string) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	// crates.io refuses requests that do not say who is asking.
+	req.Header.Set("User-Agent", "shell-ai (https://github.com/ruca-radio/shell-ai)")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("failed to fetch %s: HTTP %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	return body, resp.StatusCode, err
+}
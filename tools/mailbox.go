@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var MailboxTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "send_to_agent",
+			Description: "Send a message to a running agent, or from a sub-agent to main (the conversation that spawned it), e.g. a reviewer passing findings to the coder while both are still working. The agent is told it has mail at its next step.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"agent_id": {"type": "string", "description": "Agent to send to, or main"},
+					"message": {"type": "string", "description": "What to tell it"}
+				},
+				"required": ["agent_id", "message"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "read_inbox",
+			Description: "Read the messages other agents have sent you with send_to_agent. Messages are removed once read.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("agents", MailboxTools...)
+}
+
+// mainInbox is the mailbox of the main conversation.
+const mainInbox = "main"
+
+// mailMessage is a message waiting in an agent's inbox.
+type mailMessage struct {
+	from string
+	text string
+	sent time.Time
+}
+
+var (
+	// mailboxes holds the unread messages of each agent, and of main, and
+	// mailAnnounced how many of them the agent has been told about.
+	// Both are guarded by agentMutex.
+	mailboxes     = make(map[string][]mailMessage)
+	mailAnnounced = make(map[string]int)
+)
+
+// mailboxOf returns the mailbox of whoever runs tools under ctx.
+func mailboxOf(ctx context.Context) string {
+	if id := agentIDOf(ctx); id != "" {
+		return id
+	}
+	return mainInbox
+}
+
+func sendToAgent(ctx context.Context, args map[string]interface{}) (string, error) {
+	to, _ := args["agent_id"].(string)
+	message, _ := args["message"].(string)
+	if to = strings.TrimSpace(to); to == "" {
+		return "", fmt.Errorf("agent_id required")
+	}
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("message required")
+	}
+	from := mailboxOf(ctx)
+	if to == from {
+		return "", fmt.Errorf("%s cannot send a message to itself", from)
+	}
+
+	agentMutex.Lock()
+	defer agentMutex.Unlock()
+	if to != mainInbox {
+		agent, ok := agentTasks[to]
+		if !ok {
+			return "", fmt.Errorf("agent %s not found", to)
+		}
+		if agent.Done {
+			return "", fmt.Errorf("agent %s has already finished (%s), so it would never read the message", to, agent.Status)
+		}
+	}
+	mailboxes[to] = append(mailboxes[to], mailMessage{from: from, text: message, sent: time.Now()})
+	return fmt.Sprintf("Sent to %s (%d unread in its inbox)", to, len(mailboxes[to])), nil
+}
+
+func readInbox(ctx context.Context) (string, error) {
+	box := mailboxOf(ctx)
+	agentMutex.Lock()
+	messages := mailboxes[box]
+	delete(mailboxes, box)
+	delete(mailAnnounced, box)
+	agentMutex.Unlock()
+
+	if len(messages) == 0 {
+		return "No new messages", nil
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%d new message(s):\n", len(messages)))
+	for _, m := range messages {
+		b.WriteString(fmt.Sprintf("\nFrom %s at %s:\n%s\n", m.from, m.sent.Format("15:04:05"), m.text))
+	}
+	return b.String(), nil
+}
+
+// newMailNotice returns a line telling an agent about messages that have
+// arrived since it was last told, or "" if none have.
+func newMailNotice(id string) string {
+	agentMutex.Lock()
+	defer agentMutex.Unlock()
+	waiting := len(mailboxes[id])
+	fresh := waiting - mailAnnounced[id]
+	if fresh <= 0 {
+		return ""
+	}
+	mailAnnounced[id] = waiting
+	senders := make(map[string]bool)
+	var names []string
+	for _, m := range mailboxes[id][waiting-fresh:] {
+		if !senders[m.from] {
+			senders[m.from] = true
+			names = append(names, m.from)
+		}
+	}
+	return fmt.Sprintf("You have %d new message(s) from %s; read them with read_inbox.", fresh, strings.Join(names, ", "))
+}
+
+// MainMailNotice returns a line telling the main conversation about
+// messages sub-agents have sent it since it was last told, or "" if none
+// have.
+func MainMailNotice() string {
+	return newMailNotice(mainInbox)
+}
+
+// dropMailbox throws away a finished agent's unread messages. agentMutex
+// must be held.
+func dropMailbox(id string) {
+	delete(mailboxes, id)
+	delete(mailAnnounced, id)
+}
+
+// unreadMail returns how many messages wait in box. agentMutex must be
+// held.
+func unreadMail(box string) int {
+	return len(mailboxes[box])
+}
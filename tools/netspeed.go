@@ -0,0 +1,259 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var NetSpeedTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "net_speed",
+			Description: "Test internet connectivity: DNS and TCP latency to a few endpoints, plus HTTP download and upload throughput. Answers 'is my connection the problem?'.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"tests": {"type": "array", "items": {"type": "string", "enum": ["latency", "download", "upload"]}, "description": "Tests to run (default: all)"},
+					"latency_hosts": {"type": "array", "items": {"type": "string"}, "description": "host:port targets for latency (default 1.1.1.1:443, 8.8.8.8:443, speed.cloudflare.com:443)"},
+					"download_url": {"type": "string", "description": "URL to download; {bytes} is replaced with the size (default Cloudflare speed test)"},
+					"upload_url": {"type": "string", "description": "URL to POST to (default Cloudflare speed test)"},
+					"size_mb": {"type": "integer", "description": "Download size in MB (default 25, at most 100; upload uses 40% of it)"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("network", NetSpeedTools...)
+}
+
+const (
+	defaultDownloadURL = "https://speed.cloudflare.com/__down?bytes={bytes}"
+	defaultUploadURL   = "https://speed.cloudflare.com/__up"
+	speedTestLimit     = 20 * time.Second
+	// maxSpeedTestMB bounds size_mb, so a test cannot eat a metered link.
+	maxSpeedTestMB = 100
+)
+
+var defaultLatencyHosts = []string{"1.1.1.1:443", "8.8.8.8:443", "speed.cloudflare.com:443"}
+
+// measureLatency makes several TCP connections and returns the sorted
+// connect times, plus how many attempts failed.
+func measureLatency(ctx context.Context, target string, attempts int) ([]time.Duration, int) {
+	var times []time.Duration
+	failed := 0
+	dialer := net.Dialer{Timeout: 3 * time.Second}
+	for i := 0; i < attempts; i++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			failed++
+			continue
+		}
+		times = append(times, time.Since(start))
+		conn.Close()
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times, failed
+}
+
+func formatMs(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+}
+
+// mbps converts bytes moved in a duration to megabits per second.
+func mbps(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) * 8 / d.Seconds() / 1e6
+}
+
+// measureDownload reads the body for at most speedTestLimit, timing from the
+// first byte so connection setup doesn't skew the rate.
+func measureDownload(ctx context.Context, url string) (float64, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, speedTestLimit+10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0, 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	buf := make([]byte, 64*1024)
+	var total int64
+	var start time.Time
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 && start.IsZero() {
+			start = time.Now()
+		} else {
+			total += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, total, err
+		}
+		if !start.IsZero() && time.Since(start) > speedTestLimit {
+			break
+		}
+	}
+	return mbps(total, time.Since(start)), total, nil
+}
+
+func measureUpload(ctx context.Context, url string, size int64) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, speedTestLimit+10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(make([]byte, size)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return mbps(size, time.Since(start)), nil
+}
+
+func stringList(v interface{}) []string {
+	var list []string
+	if items, ok := v.([]interface{}); ok {
+		for _, item := range items {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+func netSpeed(ctx context.Context, args map[string]interface{}) (string, error) {
+	tests := map[string]bool{"latency": true, "download": true, "upload": true}
+	if selected := stringList(args["tests"]); len(selected) > 0 {
+		tests = make(map[string]bool)
+		for _, t := range selected {
+			tests[t] = true
+		}
+	}
+	latencyHosts := stringList(args["latency_hosts"])
+	if len(latencyHosts) == 0 {
+		latencyHosts = defaultLatencyHosts
+	}
+	downloadURL, _ := args["download_url"].(string)
+	if downloadURL == "" {
+		downloadURL = defaultDownloadURL
+	}
+	uploadURL, _ := args["upload_url"].(string)
+	if uploadURL == "" {
+		uploadURL = defaultUploadURL
+	}
+	sizeMB := 25
+	if s, ok := args["size_mb"].(float64); ok && s > 0 {
+		if s > maxSpeedTestMB {
+			return "", fmt.Errorf("size_mb is at most %d", maxSpeedTestMB)
+		}
+		sizeMB = int(s)
+	}
+	size := int64(sizeMB) << 20
+
+	var result strings.Builder
+	var problems []string
+
+	if tests["latency"] {
+		reportProgress("net_speed", "latency")
+		result.WriteString("Latency (TCP connect, 5 tries):\n")
+		for _, target := range latencyHosts {
+			if !strings.Contains(target, ":") {
+				target = net.JoinHostPort(target, "443")
+			}
+			host, _, _ := net.SplitHostPort(target)
+			if net.ParseIP(host) == nil {
+				start := time.Now()
+				if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+					result.WriteString(fmt.Sprintf("  %-28s DNS failed: %v\n", target, err))
+					problems = append(problems, "DNS lookups are failing")
+					continue
+				}
+				result.WriteString(fmt.Sprintf("  %-28s DNS %s\n", host, formatMs(time.Since(start))))
+			}
+			times, failed := measureLatency(ctx, target, 5)
+			if len(times) == 0 {
+				result.WriteString(fmt.Sprintf("  %-28s unreachable\n", target))
+				problems = append(problems, target+" is unreachable")
+				continue
+			}
+			line := fmt.Sprintf("  %-28s min %s  median %s  max %s", target, formatMs(times[0]), formatMs(times[len(times)/2]), formatMs(times[len(times)-1]))
+			if failed > 0 {
+				line += fmt.Sprintf("  (%d/5 failed)", failed)
+				problems = append(problems, fmt.Sprintf("packet loss to %s", target))
+			}
+			result.WriteString(line + "\n")
+			if times[len(times)/2] > 150*time.Millisecond {
+				problems = append(problems, fmt.Sprintf("high latency to %s", target))
+			}
+		}
+	}
+
+	if tests["download"] {
+		reportProgress("net_speed", "download")
+		url := strings.ReplaceAll(downloadURL, "{bytes}", fmt.Sprint(size))
+		rate, n, err := measureDownload(ctx, url)
+		if err != nil {
+			result.WriteString(fmt.Sprintf("Download: failed: %v\n", err))
+			problems = append(problems, "download test failed")
+		} else {
+			result.WriteString(fmt.Sprintf("Download: %.1f Mbps (%s)\n", rate, formatBytes(n)))
+			if rate < 5 {
+				problems = append(problems, "download is slow")
+			}
+		}
+	}
+
+	if tests["upload"] {
+		reportProgress("net_speed", "upload")
+		rate, err := measureUpload(ctx, uploadURL, size*2/5)
+		if err != nil {
+			result.WriteString(fmt.Sprintf("Upload: failed: %v\n", err))
+			problems = append(problems, "upload test failed")
+		} else {
+			result.WriteString(fmt.Sprintf("Upload: %.1f Mbps (%s)\n", rate, formatBytes(size*2/5)))
+			if rate < 1 {
+				problems = append(problems, "upload is slow")
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		result.WriteString("\nConnection looks healthy.")
+	} else {
+		result.WriteString("\nPossible problems: " + strings.Join(problems, "; "))
+	}
+	return result.String(), nil
+}
@@ -4,21 +4,26 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-ping/ping"
 	"github.com/kevinburke/ssh_config"
 	"github.com/melbahja/goph"
-	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 var NetworkTools = []Tool{
@@ -26,15 +31,18 @@ var NetworkTools = []Tool{
 		Type: "function",
 		Function: ToolFunction{
 			Name:        "ssh_exec",
-			Description: "Execute a command on a remote host via SSH. Supports ~/.ssh/config aliases.",
+			Description: "Execute a command on a remote host via SSH. Output is shown live; set background for long jobs. Supports ~/.ssh/config aliases and host inventory names; use @group to run on every inventory host in a group or with a tag.",
 			Parameters: json.RawMessage(`{
 				"type": "object",
 				"properties": {
-					"host": {"type": "string", "description": "Hostname, IP, or SSH config alias"},
+					"host": {"type": "string", "description": "Hostname, IP, SSH config alias, inventory name, or @group"},
 					"command": {"type": "string", "description": "Command to execute"},
 					"user": {"type": "string", "description": "Username (optional if in ssh config)"},
 					"port": {"type": "integer", "description": "SSH port (default 22)"},
-					"key_path": {"type": "string", "description": "Path to private key (optional)"}
+					"key_path": {"type": "string", "description": "Path to private key (optional)"},
+					"password_auth": {"type": "boolean", "description": "Also allow password login; the user is prompted for the password"},
+					"background": {"type": "boolean", "description": "Run as a background task for long jobs; follow it with check_task and stop it with kill_task"},
+					"description": {"type": "string", "description": "Brief description of a background task"}
 				},
 				"required": ["host", "command"],
 				"additionalProperties": false
@@ -45,14 +53,15 @@ var NetworkTools = []Tool{
 		Type: "function",
 		Function: ToolFunction{
 			Name:        "ssh_upload",
-			Description: "Upload a file to a remote host via SFTP.",
+			Description: "Upload a file, or a directory recursively, to a remote host via SFTP.",
 			Parameters: json.RawMessage(`{
 				"type": "object",
 				"properties": {
 					"host": {"type": "string", "description": "Hostname, IP, or SSH config alias"},
-					"local_path": {"type": "string", "description": "Local file path"},
+					"local_path": {"type": "string", "description": "Local file or directory path"},
 					"remote_path": {"type": "string", "description": "Remote destination path"},
-					"user": {"type": "string", "description": "Username (optional)"}
+					"user": {"type": "string", "description": "Username (optional)"},
+					"password_auth": {"type": "boolean", "description": "Also allow password login; the user is prompted for the password"}
 				},
 				"required": ["host", "local_path", "remote_path"],
 				"additionalProperties": false
@@ -63,14 +72,15 @@ var NetworkTools = []Tool{
 		Type: "function",
 		Function: ToolFunction{
 			Name:        "ssh_download",
-			Description: "Download a file from a remote host via SFTP.",
+			Description: "Download a file, or a directory recursively, from a remote host via SFTP.",
 			Parameters: json.RawMessage(`{
 				"type": "object",
 				"properties": {
 					"host": {"type": "string", "description": "Hostname, IP, or SSH config alias"},
-					"remote_path": {"type": "string", "description": "Remote file path"},
+					"remote_path": {"type": "string", "description": "Remote file or directory path"},
 					"local_path": {"type": "string", "description": "Local destination path"},
-					"user": {"type": "string", "description": "Username (optional)"}
+					"user": {"type": "string", "description": "Username (optional)"},
+					"password_auth": {"type": "boolean", "description": "Also allow password login; the user is prompted for the password"}
 				},
 				"required": ["host", "remote_path", "local_path"],
 				"additionalProperties": false
@@ -97,12 +107,15 @@ var NetworkTools = []Tool{
 		Type: "function",
 		Function: ToolFunction{
 			Name:        "port_scan",
-			Description: "Scan common ports on a host to see which services are running.",
+			Description: "Scan TCP ports on a host to see which services are running. Supports port lists, ranges up to the full 1-65535, and banner grabbing to identify services on non-standard ports.",
 			Parameters: json.RawMessage(`{
 				"type": "object",
 				"properties": {
 					"host": {"type": "string", "description": "Hostname or IP to scan"},
-					"ports": {"type": "string", "description": "Comma-separated ports or 'common' (default)"}
+					"ports": {"type": "string", "description": "'common' (default), 'all' (1-65535), or a list of ports and ranges like '22,80,8000-9000'"},
+					"banner": {"type": "boolean", "description": "Read the first bytes each open port sends (or answers to an HTTP request) to identify the service"},
+					"timeout_ms": {"type": "integer", "description": "Connect timeout per port in milliseconds (default 1000)"},
+					"concurrency": {"type": "integer", "description": "Ports probed at once (default 200, max 1000)"}
 				},
 				"required": ["host"],
 				"additionalProperties": false
@@ -113,7 +126,7 @@ var NetworkTools = []Tool{
 		Type: "function",
 		Function: ToolFunction{
 			Name:        "lan_scan",
-			Description: "Scan local network for active hosts. Requires network interface or CIDR.",
+			Description: "Scan the local network for active hosts. Combines a TCP sweep with the ARP table, mDNS and SSDP discovery, and reverse DNS/NetBIOS lookups to show device names, MAC addresses, vendors and advertised services.",
 			Parameters: json.RawMessage(`{
 				"type": "object",
 				"properties": {
@@ -127,14 +140,16 @@ var NetworkTools = []Tool{
 		Type: "function",
 		Function: ToolFunction{
 			Name:        "wake_on_lan",
-			Description: "Send Wake-on-LAN magic packet to wake a sleeping machine.",
+			Description: "Send a Wake-on-LAN magic packet to wake a sleeping machine, then wait for it to come up. Accepts a MAC address, or a host name/IP whose MAC was learned from lan_scan or SSH.",
 			Parameters: json.RawMessage(`{
 				"type": "object",
 				"properties": {
 					"mac": {"type": "string", "description": "MAC address (e.g., 00:11:22:33:44:55)"},
-					"broadcast": {"type": "string", "description": "Broadcast address (default 255.255.255.255)"}
+					"host": {"type": "string", "description": "Host name, inventory name or IP to wake, instead of a MAC"},
+					"broadcast": {"type": "string", "description": "Broadcast address (default 255.255.255.255)"},
+					"verify": {"type": "boolean", "description": "Poll the host with ping/SSH until it answers (default true)"},
+					"wait_seconds": {"type": "integer", "description": "How long to wait for the host to answer (default 120)"}
 				},
-				"required": ["mac"],
 				"additionalProperties": false
 			}`),
 		},
@@ -143,10 +158,12 @@ var NetworkTools = []Tool{
 		Type: "function",
 		Function: ToolFunction{
 			Name:        "ssh_hosts",
-			Description: "List configured SSH hosts from ~/.ssh/config.",
+			Description: "List known SSH hosts: the host inventory (with groups, tags and descriptions) and ~/.ssh/config.",
 			Parameters: json.RawMessage(`{
 				"type": "object",
-				"properties": {},
+				"properties": {
+					"group": {"type": "string", "description": "Only list inventory hosts in this group or with this tag"}
+				},
 				"additionalProperties": false
 			}`),
 		},
@@ -154,10 +171,28 @@ var NetworkTools = []Tool{
 }
 
 func init() {
-	AvailableTools = append(AvailableTools, NetworkTools...)
+	RegisterTools("network", NetworkTools...)
 }
 
+// resolveSSHConfig looks a host up in the inventory, then in ~/.ssh/config.
+// Inventory settings win; the inventory address may itself be an ssh alias.
 func resolveSSHConfig(alias string) (hostname string, port int, username string, keyPath string) {
+	inv := inventoryHost(alias)
+	if inv != nil {
+		alias = inv.Address
+		defer func() {
+			if inv.Port > 0 {
+				port = inv.Port
+			}
+			if inv.User != "" {
+				username = inv.User
+			}
+			if inv.KeyPath != "" {
+				keyPath = expandPath(inv.KeyPath)
+			}
+		}()
+	}
+
 	hostname = alias
 	port = 22
 	username = ""
@@ -221,7 +256,59 @@ func getDefaultKeyPath() string {
 	return ""
 }
 
-func createSSHClient(host string, username string, port int, keyPath string) (*goph.Client, error) {
+var knownHostsMu sync.Mutex
+
+// sshHostKeyCallback checks host keys against ~/.ssh/known_hosts, as ssh
+// does. A changed key is refused; a host not seen before is asked about
+// once, with its fingerprint, and remembered.
+func sshHostKeyCallback() (ssh.HostKeyCallback, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(home, ".ssh", "known_hosts")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key for %s has changed (now %s %s); if that is expected, remove the old key from %s",
+				hostname, key.Type(), fingerprint, path)
+		}
+
+		if err := requireApproval("ssh", fmt.Sprintf("trust unknown host %s (%s %s)", hostname, key.Type(), fingerprint)); err != nil {
+			return err
+		}
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}, nil
+}
+
+func createSSHClient(host string, username string, port int, keyPath string, usePassword bool) (*goph.Client, error) {
 	resolvedHost, resolvedPort, resolvedUser, resolvedKey := resolveSSHConfig(host)
 
 	if username == "" {
@@ -243,37 +330,38 @@ func createSSHClient(host string, username string, port int, keyPath string) (*g
 		keyPath = getDefaultKeyPath()
 	}
 
-	var auth goph.Auth
-	var err error
+	auth, err := sshAuthMethods(username, host, expandPath(keyPath), usePassword)
+	if err != nil {
+		return nil, err
+	}
 
-	if keyPath != "" {
-		auth, err = goph.Key(keyPath, "")
-		if err != nil {
-			return nil, fmt.Errorf("failed to load key %s: %w", keyPath, err)
-		}
-	} else {
-		return nil, fmt.Errorf("no SSH key found. Specify key_path or add IdentityFile to ~/.ssh/config")
+	hostKeys, err := sshHostKeyCallback()
+	if err != nil {
+		return nil, err
 	}
 
 	client, err := goph.NewConn(&goph.Config{
 		User:     username,
 		Addr:     resolvedHost,
 		Port:     uint(port),
-		Auth:     auth,
+		Auth:     goph.Auth(auth),
 		Timeout:  10 * time.Second,
-		Callback: ssh.InsecureIgnoreHostKey(),
+		Callback: hostKeys,
 	})
+	if err == nil {
+		learnSSHDevice(host, client)
+	}
 
 	return client, err
 }
 
-func sshExec(args map[string]interface{}) (string, error) {
+func sshExec(ctx context.Context, args map[string]interface{}) (string, error) {
 	host, _ := args["host"].(string)
 	command, _ := args["command"].(string)
 	username, _ := args["user"].(string)
 	keyPath, _ := args["key_path"].(string)
 
-	port := 22
+	port := 0
 	if p, ok := args["port"].(float64); ok {
 		port = int(p)
 	}
@@ -281,62 +369,62 @@ func sshExec(args map[string]interface{}) (string, error) {
 	if host == "" || command == "" {
 		return "", fmt.Errorf("host and command required")
 	}
+	if group, ok := strings.CutPrefix(host, "@"); ok {
+		return sshExecGroup(ctx, group, command, args)
+	}
 
-	client, err := createSSHClient(host, username, port, keyPath)
+	usePassword, _ := args["password_auth"].(bool)
+	client, err := createSSHClient(host, username, port, keyPath, usePassword)
 	if err != nil {
 		return "", err
 	}
-	defer client.Close()
 
-	output, err := client.Run(command)
-	if err != nil {
-		return string(output) + "\n[Error: " + err.Error() + "]", nil
+	if background, _ := args["background"].(bool); background {
+		desc, _ := args["description"].(string)
+		if desc == "" {
+			desc = "Remote task"
+		}
+		return startRemoteBackground(client, host, command, desc)
 	}
+	defer client.Close()
 
-	return string(output), nil
+	return runSSHStreaming(ctx, client, command)
 }
 
 func sshUpload(args map[string]interface{}) (string, error) {
 	host, _ := args["host"].(string)
 	localPath, _ := args["local_path"].(string)
 	remotePath, _ := args["remote_path"].(string)
-	username, _ := args["user"].(string)
 
 	if host == "" || localPath == "" || remotePath == "" {
 		return "", fmt.Errorf("host, local_path, and remote_path required")
 	}
 
 	localPath = expandPath(localPath)
-
-	client, err := createSSHClient(host, username, 0, "")
+	info, err := os.Stat(localPath)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to open local file: %w", err)
 	}
-	defer client.Close()
 
-	sftpClient, err := sftp.NewClient(client.Client)
+	client, sftpClient, err := openSFTP(args)
 	if err != nil {
-		return "", fmt.Errorf("SFTP connection failed: %w", err)
+		return "", err
 	}
+	defer client.Close()
 	defer sftpClient.Close()
 
-	localFile, err := os.Open(localPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open local file: %w", err)
-	}
-	defer localFile.Close()
-
-	remoteFile, err := sftpClient.Create(remotePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create remote file: %w", err)
+	if info.IsDir() {
+		stats := &transferStats{tool: "ssh_upload"}
+		if err := uploadTree(sftpClient, localPath, remotePath, stats); err != nil {
+			return "", fmt.Errorf("upload failed after %s: %w", stats, err)
+		}
+		return fmt.Sprintf("Uploaded %s to %s:%s", stats, host, remotePath), nil
 	}
-	defer remoteFile.Close()
 
-	written, err := remoteFile.ReadFrom(localFile)
+	written, err := uploadFile(sftpClient, localPath, remotePath, info)
 	if err != nil {
-		return "", fmt.Errorf("upload failed: %w", err)
+		return "", err
 	}
-
 	return fmt.Sprintf("Uploaded %d bytes to %s:%s", written, host, remotePath), nil
 }
 
@@ -344,7 +432,6 @@ func sshDownload(args map[string]interface{}) (string, error) {
 	host, _ := args["host"].(string)
 	remotePath, _ := args["remote_path"].(string)
 	localPath, _ := args["local_path"].(string)
-	username, _ := args["user"].(string)
 
 	if host == "" || remotePath == "" || localPath == "" {
 		return "", fmt.Errorf("host, remote_path, and local_path required")
@@ -352,39 +439,30 @@ func sshDownload(args map[string]interface{}) (string, error) {
 
 	localPath = expandPath(localPath)
 
-	client, err := createSSHClient(host, username, 0, "")
+	client, sftpClient, err := openSFTP(args)
 	if err != nil {
 		return "", err
 	}
 	defer client.Close()
-
-	sftpClient, err := sftp.NewClient(client.Client)
-	if err != nil {
-		return "", fmt.Errorf("SFTP connection failed: %w", err)
-	}
 	defer sftpClient.Close()
 
-	remoteFile, err := sftpClient.Open(remotePath)
+	info, err := sftpClient.Stat(remotePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open remote file: %w", err)
 	}
-	defer remoteFile.Close()
-
-	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
-		return "", err
-	}
 
-	localFile, err := os.Create(localPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create local file: %w", err)
+	if info.IsDir() {
+		stats := &transferStats{tool: "ssh_download"}
+		if err := downloadTree(sftpClient, remotePath, localPath, stats); err != nil {
+			return "", fmt.Errorf("download failed after %s: %w", stats, err)
+		}
+		return fmt.Sprintf("Downloaded %s from %s:%s to %s", stats, host, remotePath, localPath), nil
 	}
-	defer localFile.Close()
 
-	written, err := localFile.ReadFrom(remoteFile)
+	written, err := fetchRemoteFile(sftpClient, remotePath, localPath, info)
 	if err != nil {
-		return "", fmt.Errorf("download failed: %w", err)
+		return "", err
 	}
-
 	return fmt.Sprintf("Downloaded %d bytes from %s:%s to %s", written, host, remotePath, localPath), nil
 }
 
@@ -436,57 +514,191 @@ var commonPorts = map[int]string{
 	3389: "RDP", 5900: "VNC", 8443: "HTTPS-Alt", 9090: "Prometheus",
 }
 
-func portScan(args map[string]interface{}) (string, error) {
+var commonScanPorts = []int{21, 22, 23, 25, 53, 80, 110, 143, 443, 3306, 3389, 5432, 5900, 6379, 8080, 8443, 9090, 27017}
+
+// parsePortSpec turns "common", "all" or "22,80,8000-9000" into a sorted,
+// de-duplicated port list.
+func parsePortSpec(spec string) ([]int, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "", "common":
+		return commonScanPorts, nil
+	case "all":
+		spec = "1-65535"
+	}
+
+	seen := make(map[int]bool)
+	var ports []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+		start, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		end, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port or range %q (use 1-65535)", part)
+		}
+		for p := start; p <= end; p++ {
+			if !seen[p] {
+				seen[p] = true
+				ports = append(ports, p)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports to scan")
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// grabBanner reads what a service volunteers on connect. Silent services
+// get an HTTP request, which most web servers and proxies answer.
+func grabBanner(conn net.Conn, host string) string {
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(1500 * time.Millisecond))
+	n, _ := conn.Read(buf)
+	if n == 0 {
+		fmt.Fprintf(conn, "HEAD / HTTP/1.0\r\nHost: %s\r\n\r\n", host)
+		conn.SetReadDeadline(time.Now().Add(1500 * time.Millisecond))
+		n, _ = conn.Read(buf)
+	}
+	return cleanBanner(buf[:n])
+}
+
+// cleanBanner keeps the first line of printable text, or notes binary data.
+func cleanBanner(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if data[0] == 0x15 || data[0] == 0x16 {
+		return "(TLS)"
+	}
+	line := string(data)
+	if i := strings.IndexAny(line, "\r\n"); i >= 0 {
+		line = line[:i]
+	}
+	printable := 0
+	for _, r := range line {
+		if r >= 0x20 && r < 0x7f {
+			printable++
+		}
+	}
+	if line == "" || printable*10 < len(line)*8 {
+		return fmt.Sprintf("(%d bytes binary)", len(data))
+	}
+	return truncate(strings.TrimSpace(line), 120)
+}
+
+func portScan(ctx context.Context, args map[string]interface{}) (string, error) {
 	host, _ := args["host"].(string)
 	if host == "" {
 		return "", fmt.Errorf("host required")
 	}
 
-	ports := []int{22, 80, 443, 21, 23, 25, 53, 110, 143, 3306, 5432, 6379, 8080, 3389, 5900}
-
-	if portsStr, ok := args["ports"].(string); ok && portsStr != "" && portsStr != "common" {
-		ports = []int{}
-		for _, p := range strings.Split(portsStr, ",") {
-			var port int
-			if _, err := fmt.Sscanf(strings.TrimSpace(p), "%d", &port); err == nil {
-				ports = append(ports, port)
-			}
-		}
+	spec, _ := args["ports"].(string)
+	ports, err := parsePortSpec(spec)
+	if err != nil {
+		return "", err
+	}
+	banner, _ := args["banner"].(bool)
+	timeout := time.Second
+	if t, ok := args["timeout_ms"].(float64); ok && t > 0 {
+		timeout = time.Duration(t) * time.Millisecond
+	}
+	concurrency := 200
+	if c, ok := args["concurrency"].(float64); ok && c > 0 {
+		concurrency = int(c)
+	}
+	if concurrency > 1000 {
+		concurrency = 1000
 	}
 
-	var result strings.Builder
-	result.WriteString(fmt.Sprintf("Port scan for %s:\n", host))
+	// Resolve once so every probe doesn't repeat the DNS lookup.
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s: %w", host, err)
+	}
+	target := addrs[0]
 
+	type openPort struct {
+		port   int
+		banner string
+	}
+	var (
+		mu      sync.Mutex
+		open    []openPort
+		scanned int
+	)
+	jobs := make(chan int)
 	var wg sync.WaitGroup
-	results := make(chan string, len(ports))
-
-	for _, port := range ports {
+	dialer := net.Dialer{Timeout: timeout}
+	for i := 0; i < concurrency && i < len(ports); i++ {
 		wg.Add(1)
-		go func(p int) {
+		go func() {
 			defer wg.Done()
-			address := fmt.Sprintf("%s:%d", host, p)
-			conn, err := net.DialTimeout("tcp", address, 2*time.Second)
-			if err == nil {
-				conn.Close()
-				service := commonPorts[p]
-				if service == "" {
-					service = "unknown"
+			for p := range jobs {
+				conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target, strconv.Itoa(p)))
+				if err == nil {
+					found := openPort{port: p}
+					if banner {
+						found.banner = grabBanner(conn, host)
+					}
+					conn.Close()
+					mu.Lock()
+					open = append(open, found)
+					mu.Unlock()
 				}
-				results <- fmt.Sprintf("  %d/tcp open (%s)\n", p, service)
+				mu.Lock()
+				scanned++
+				if len(ports) > 1000 && scanned%2000 == 0 {
+					reportProgress("port_scan", fmt.Sprintf("%d/%d ports, %d open", scanned, len(ports), len(open)))
+				}
+				mu.Unlock()
 			}
-		}(port)
+		}()
+	}
+feed:
+	for _, p := range ports {
+		select {
+		case jobs <- p:
+		case <-ctx.Done():
+			break feed
+		}
 	}
-
+	close(jobs)
 	wg.Wait()
-	close(results)
 
-	openCount := 0
-	for r := range results {
-		result.WriteString(r)
-		openCount++
+	sort.Slice(open, func(i, j int) bool { return open[i].port < open[j].port })
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Port scan for %s", host))
+	if target != host {
+		result.WriteString(fmt.Sprintf(" (%s)", target))
 	}
+	result.WriteString(fmt.Sprintf(": %d ports scanned", scanned))
+	if ctx.Err() != nil {
+		result.WriteString(fmt.Sprintf(" of %d (stopped early)", len(ports)))
+	}
+	result.WriteString("\n")
 
-	if openCount == 0 {
+	for _, o := range open {
+		service := commonPorts[o.port]
+		if service == "" {
+			service = "unknown"
+		}
+		line := fmt.Sprintf("  %d/tcp open (%s)", o.port, service)
+		if o.banner != "" {
+			line += "  " + o.banner
+		}
+		result.WriteString(line + "\n")
+	}
+	if len(open) == 0 {
 		result.WriteString("  No open ports found in scanned range\n")
 	}
 
@@ -539,16 +751,31 @@ func lanScan(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("CIDR range too large (max /24). Got %d hosts", len(hosts))
 	}
 
-	var result strings.Builder
-	result.WriteString(fmt.Sprintf("Scanning %s (%d hosts)...\n", cidr, len(hosts)))
+	devices := newLANDevices()
+	inRange := func(ip string) bool {
+		parsed := net.ParseIP(ip)
+		return parsed != nil && ipnet.Contains(parsed)
+	}
+
+	// mDNS and SSDP listen while the TCP sweep runs.
+	var discovery sync.WaitGroup
+	discoveryCtx, cancelDiscovery := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancelDiscovery()
+	discovery.Add(2)
+	go func() { defer discovery.Done(); discoverMDNS(discoveryCtx, devices, inRange) }()
+	go func() { defer discovery.Done(); discoverSSDP(discoveryCtx, devices, inRange) }()
 
 	var wg sync.WaitGroup
-	results := make(chan string, len(hosts))
 	sem := make(chan struct{}, 50)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	probes := []struct {
+		port    string
+		service string
+	}{{"22", "SSH"}, {"80", "HTTP"}, {"443", "HTTPS"}}
+
 	for _, h := range hosts {
 		wg.Add(1)
 		go func(host string) {
@@ -560,42 +787,102 @@ func lanScan(args map[string]interface{}) (string, error) {
 				defer func() { <-sem }()
 			}
 
-			conn, err := net.DialTimeout("tcp", host+":22", 500*time.Millisecond)
-			if err == nil {
-				conn.Close()
-				results <- fmt.Sprintf("  %s (SSH)\n", host)
-				return
-			}
-
-			conn, err = net.DialTimeout("tcp", host+":80", 500*time.Millisecond)
-			if err == nil {
-				conn.Close()
-				results <- fmt.Sprintf("  %s (HTTP)\n", host)
-				return
-			}
-
-			conn, err = net.DialTimeout("tcp", host+":443", 500*time.Millisecond)
-			if err == nil {
-				conn.Close()
-				results <- fmt.Sprintf("  %s (HTTPS)\n", host)
-				return
+			for _, probe := range probes {
+				conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, probe.port), 500*time.Millisecond)
+				if err == nil {
+					conn.Close()
+					devices.update(host, func(d *lanDevice) { d.addService(probe.service) })
+					return
+				}
+				// A refused connection still proves the host is up.
+				if errors.Is(err, syscall.ECONNREFUSED) {
+					devices.update(host, func(d *lanDevice) {})
+				}
 			}
 		}(h)
 	}
 
 	wg.Wait()
-	close(results)
+	discovery.Wait()
+
+	// The sweep fills the neighbour cache, so read it afterwards; this also
+	// finds hosts that answer ARP but drop every TCP probe.
+	for ip, mac := range readARPTable() {
+		if inRange(ip) {
+			devices.update(ip, func(d *lanDevice) { d.mac = mac })
+		}
+	}
+
+	found := devices.sorted()
+	resolveLANNames(found)
+	for _, d := range found {
+		name := ""
+		if len(d.names) > 0 {
+			name = d.names[0]
+		}
+		rememberDevice(d.mac, d.ip, name, "lan_scan")
+	}
+
+	local := make(map[string]bool)
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				local[ipnet.IP.String()] = true
+			}
+		}
+	}
 
-	found := 0
-	for r := range results {
-		result.WriteString(r)
-		found++
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Scanned %s (%d hosts)\n\n", cidr, len(hosts)))
+	w := tabwriter.NewWriter(&result, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IP\tNAME\tMAC\tVENDOR\tSERVICES")
+	for _, d := range found {
+		name := strings.Join(d.names, ", ")
+		if local[d.ip] {
+			name = strings.TrimPrefix(name+", this machine", ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.ip, dashIfEmpty(name), dashIfEmpty(d.mac), dashIfEmpty(macVendor(d.mac)), strings.Join(d.services, ", "))
 	}
+	w.Flush()
 
-	result.WriteString(fmt.Sprintf("\nFound %d active hosts\n", found))
+	result.WriteString(fmt.Sprintf("\nFound %d active hosts\n", len(found)))
 	return result.String(), nil
 }
 
+// resolveLANNames adds reverse DNS and NetBIOS names to each device.
+func resolveLANNames(devices []*lanDevice) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 32)
+	for _, d := range devices {
+		wg.Add(1)
+		go func(d *lanDevice) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			names, _ := net.DefaultResolver.LookupAddr(ctx, d.ip)
+			cancel()
+			nb := netbiosName(d.ip, 700*time.Millisecond)
+
+			for _, n := range names {
+				d.addName(n)
+			}
+			if nb != "" {
+				d.addName(nb)
+			}
+		}(d)
+	}
+	wg.Wait()
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 func incrementIP(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
 		ip[j]++
@@ -605,10 +892,27 @@ func incrementIP(ip net.IP) {
 	}
 }
 
-func wakeOnLan(args map[string]interface{}) (string, error) {
+func wakeOnLan(ctx context.Context, args map[string]interface{}) (string, error) {
 	macStr, _ := args["mac"].(string)
+	host, _ := args["host"].(string)
+	if macStr == "" && host == "" {
+		return "", fmt.Errorf("mac or host required")
+	}
+
+	// The IP is only needed to check that the machine woke up.
+	targetIP := ""
 	if macStr == "" {
-		return "", fmt.Errorf("MAC address required")
+		device, err := lookupWakeTarget(host)
+		if err != nil {
+			return "", err
+		}
+		macStr, targetIP = device.MAC, device.IP
+	} else if host != "" {
+		targetIP = resolveIPv4(host)
+	} else if hostsDB != nil {
+		if device, _ := hostsDB.FindDevice(normalizeMAC(strings.ReplaceAll(macStr, "-", ":"))); device != nil {
+			targetIP = device.IP
+		}
 	}
 
 	broadcast := "255.255.255.255"
@@ -616,6 +920,8 @@ func wakeOnLan(args map[string]interface{}) (string, error) {
 		broadcast = b
 	}
 
+	macDisplay := macStr
+
 	// Parse MAC address - accept formats like 00:11:22:33:44:55 or 00-11-22-33-44-55
 	macStr = regexp.MustCompile(`[:-]`).ReplaceAllString(macStr, "")
 	if len(macStr) != 12 {
@@ -653,10 +959,55 @@ func wakeOnLan(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("failed to send WoL packet: %w", err)
 	}
 
-	return fmt.Sprintf("Wake-on-LAN packet sent to %s (broadcast: %s)", args["mac"], broadcast), nil
+	sent := fmt.Sprintf("Wake-on-LAN packet sent to %s (broadcast: %s)", macDisplay, broadcast)
+	if host != "" {
+		sent = fmt.Sprintf("Wake-on-LAN packet sent to %s [%s] (broadcast: %s)", host, macDisplay, broadcast)
+	}
+
+	if verify, ok := args["verify"].(bool); ok && !verify {
+		return sent, nil
+	}
+	if targetIP == "" {
+		return sent + "\nNo known IP for this machine, so it was not checked.", nil
+	}
+	wait := 120 * time.Second
+	if w, ok := args["wait_seconds"].(float64); ok && w > 0 {
+		wait = time.Duration(w) * time.Second
+	}
+	up, elapsed := waitForHost(ctx, targetIP, wait)
+	if up {
+		return fmt.Sprintf("%s\n%s is up after %s.", sent, targetIP, elapsed.Round(time.Second)), nil
+	}
+	return fmt.Sprintf("%s\n%s did not answer within %s. It may still be booting, have WoL disabled in its BIOS/NIC settings, or block ping and common ports.", sent, targetIP, wait), nil
 }
 
 func sshHosts(args map[string]interface{}) (string, error) {
+	var result strings.Builder
+	if hostsDB != nil {
+		group, _ := args["group"].(string)
+		hosts, err := hostsDB.ListHosts(group)
+		if err != nil {
+			return "", err
+		}
+		if group != "" {
+			if len(hosts) == 0 {
+				return fmt.Sprintf("No inventory hosts in group %q", group), nil
+			}
+			result.WriteString(fmt.Sprintf("Inventory hosts in @%s:\n", group))
+			for _, h := range hosts {
+				result.WriteString("  " + DescribeHost(h) + "\n")
+			}
+			return result.String(), nil
+		}
+		if len(hosts) > 0 {
+			result.WriteString("Host Inventory:\n")
+			for _, h := range hosts {
+				result.WriteString("  " + DescribeHost(h) + "\n")
+			}
+			result.WriteString("\n")
+		}
+	}
+
 	usr, err := user.Current()
 	if err != nil {
 		return "", fmt.Errorf("could not get user: %w", err)
@@ -665,7 +1016,7 @@ func sshHosts(args map[string]interface{}) (string, error) {
 	configPath := filepath.Join(usr.HomeDir, ".ssh", "config")
 	f, err := os.Open(configPath)
 	if err != nil {
-		return "No ~/.ssh/config found", nil
+		return result.String() + "No ~/.ssh/config found", nil
 	}
 	defer f.Close()
 
@@ -674,7 +1025,6 @@ func sshHosts(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("failed to parse SSH config: %w", err)
 	}
 
-	var result strings.Builder
 	result.WriteString("SSH Configured Hosts:\n")
 
 	seen := make(map[string]bool)
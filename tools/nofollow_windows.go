@@ -0,0 +1,4 @@
+package tools
+
+// openNoFollow is O_NOFOLLOW where there is one; Windows has none.
+const openNoFollow = 0
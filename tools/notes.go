@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var NoteTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "write_note",
+			Description: "Write a note to the scratchpad shared with sub-agents (or, from a sub-agent, with the main conversation and the other agents), so findings can be passed on while work is in progress. Use append to add a line to a note several agents write to.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"key": {"type": "string", "description": "Name of the note, e.g. 'auth-findings'"},
+					"content": {"type": "string", "description": "What to write; empty deletes the note"},
+					"append": {"type": "boolean", "description": "Add content as a new line instead of replacing the note"}
+				},
+				"required": ["key", "content"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "read_note",
+			Description: "Read a note from the scratchpad shared by the main conversation and its sub-agents, or list the notes when no key is given.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"key": {"type": "string", "description": "Name of the note to read; omit to list them all"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("agents", NoteTools...)
+}
+
+// processNoteScope holds the notes written outside a saved session.
+var processNoteScope = fmt.Sprintf("process-%d-%d", os.Getpid(), time.Now().Unix())
+
+// noteScope returns the scope notes are kept in: the session, whose
+// sub-agents share it.
+func noteScope() string {
+	if source := knowledgeSource; source != nil {
+		if session, _ := source(); session != "" {
+			return session
+		}
+	}
+	return processNoteScope
+}
+
+func writeNote(ctx context.Context, args map[string]interface{}) (string, error) {
+	if knowledgeDB == nil {
+		return "", fmt.Errorf("notes are not available: memory database not initialized")
+	}
+	key, _ := args["key"].(string)
+	if key = strings.TrimSpace(key); key == "" {
+		return "", fmt.Errorf("key required")
+	}
+	content, _ := args["content"].(string)
+	appending, _ := args["append"].(bool)
+
+	if content == "" && !appending {
+		removed, err := knowledgeDB.DeleteNote(noteScope(), key)
+		if err != nil {
+			return "", err
+		}
+		if !removed {
+			return fmt.Sprintf("There is no note %s", key), nil
+		}
+		return fmt.Sprintf("Deleted note %s", key), nil
+	}
+
+	author := agentIDOf(ctx)
+	if author == "" {
+		author = "main"
+	}
+	note, err := knowledgeDB.WriteNote(noteScope(), key, content, author, appending)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Wrote note %s (%s)", key, noteLines(note.Content)), nil
+}
+
+func readNote(args map[string]interface{}) (string, error) {
+	if knowledgeDB == nil {
+		return "", fmt.Errorf("notes are not available: memory database not initialized")
+	}
+	key, _ := args["key"].(string)
+	key = strings.TrimSpace(key)
+
+	if key == "" {
+		notes, err := knowledgeDB.Notes(noteScope())
+		if err != nil {
+			return "", err
+		}
+		if len(notes) == 0 {
+			return "No notes yet", nil
+		}
+		var b strings.Builder
+		b.WriteString("Notes:\n")
+		for _, n := range notes {
+			first, _, _ := strings.Cut(n.Content, "\n")
+			b.WriteString(fmt.Sprintf("  %s (%s, %s by %s): %s\n", n.Key, noteLines(n.Content),
+				n.UpdatedAt.Format("15:04:05"), n.Author, truncateStr(first, 80)))
+		}
+		return b.String(), nil
+	}
+
+	note, err := knowledgeDB.ReadNote(noteScope(), key)
+	if err != nil {
+		return "", err
+	}
+	if note == nil {
+		return fmt.Sprintf("There is no note %s; read_note without a key lists them", key), nil
+	}
+	return fmt.Sprintf("%s (written %s by %s):\n%s", note.Key, note.UpdatedAt.Format("15:04:05"), note.Author, note.Content), nil
+}
+
+func noteLines(content string) string {
+	if n := strings.Count(content, "\n") + 1; n > 1 {
+		return fmt.Sprintf("%d lines", n)
+	}
+	return "1 line"
+}
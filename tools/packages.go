@@ -0,0 +1,325 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var PackageTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "package_search",
+			Description: "Search for packages with a package manager (apt, dnf, pacman, brew, npm, pip). Defaults to the system package manager.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"query": {"type": "string", "description": "Package name or keyword"},
+					"manager": {"type": "string", "enum": ["apt", "dnf", "pacman", "brew", "npm", "pip"], "description": "Package manager (default: detected system manager)"}
+				},
+				"required": ["query"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "package_info",
+			Description: "Check whether a package is installed and which version, across all detected package managers or one.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"name": {"type": "string", "description": "Package name"},
+					"manager": {"type": "string", "enum": ["apt", "dnf", "pacman", "brew", "npm", "pip"], "description": "Only check this manager"}
+				},
+				"required": ["name"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "package_install",
+			Description: "Install packages with a package manager. Requires user approval. System managers use non-interactive sudo when not root.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"packages": {"type": "array", "items": {"type": "string"}, "description": "Packages to install (pip/npm accept version specifiers)"},
+					"manager": {"type": "string", "enum": ["apt", "dnf", "pacman", "brew", "npm", "pip"], "description": "Package manager (default: detected system manager)"},
+					"global": {"type": "boolean", "description": "npm: install globally instead of into the current project"}
+				},
+				"required": ["packages"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("system", PackageTools...)
+}
+
+type packageManager struct {
+	name   string
+	binary string
+	system bool // needs root to install
+	search func(query string) []string
+	info   func(name string) []string
+	// install returns the command for the given packages.
+	install func(pkgs []string, global bool) []string
+}
+
+var packageManagers = []packageManager{
+	{
+		name: "apt", binary: "apt-get", system: true,
+		search:  func(q string) []string { return []string{"apt-cache", "search", "--names-only", q} },
+		info:    func(n string) []string { return []string{"dpkg-query", "-W", "-f", "${Version}", n} },
+		install: func(p []string, _ bool) []string { return append([]string{"apt-get", "install", "-y"}, p...) },
+	},
+	{
+		name: "dnf", binary: "dnf", system: true,
+		search:  func(q string) []string { return []string{"dnf", "-q", "search", q} },
+		info:    func(n string) []string { return []string{"rpm", "-q", "--qf", "%{VERSION}-%{RELEASE}", n} },
+		install: func(p []string, _ bool) []string { return append([]string{"dnf", "install", "-y"}, p...) },
+	},
+	{
+		name: "pacman", binary: "pacman", system: true,
+		search: func(q string) []string { return []string{"pacman", "-Ss", q} },
+		info:   func(n string) []string { return []string{"pacman", "-Q", n} },
+		install: func(p []string, _ bool) []string {
+			return append([]string{"pacman", "-S", "--noconfirm", "--needed"}, p...)
+		},
+	},
+	{
+		name: "brew", binary: "brew",
+		search:  func(q string) []string { return []string{"brew", "search", q} },
+		info:    func(n string) []string { return []string{"brew", "list", "--versions", n} },
+		install: func(p []string, _ bool) []string { return append([]string{"brew", "install"}, p...) },
+	},
+	{
+		name: "npm", binary: "npm",
+		search: func(q string) []string { return []string{"npm", "search", "--parseable", q} },
+		info:   func(n string) []string { return []string{"npm", "ls", "--depth=0", n} },
+		install: func(p []string, global bool) []string {
+			if global {
+				return append([]string{"npm", "install", "-g"}, p...)
+			}
+			return append([]string{"npm", "install"}, p...)
+		},
+	},
+	{
+		name: "pip", binary: "python3",
+		search:  func(q string) []string { return []string{"python3", "-m", "pip", "index", "versions", q} },
+		info:    func(n string) []string { return []string{"python3", "-m", "pip", "show", n} },
+		install: func(p []string, _ bool) []string { return append([]string{"python3", "-m", "pip", "install"}, p...) },
+	},
+}
+
+// Package names and pip/npm specifiers; a leading "-" would be read as a flag.
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9@][A-Za-z0-9@._+/:=<>!~,-]*$`)
+
+func findPackageManager(name string) (packageManager, error) {
+	for _, pm := range packageManagers {
+		if pm.name != name {
+			continue
+		}
+		if _, err := exec.LookPath(pm.binary); err != nil {
+			return pm, fmt.Errorf("%s is not installed", pm.name)
+		}
+		return pm, nil
+	}
+	return packageManager{}, fmt.Errorf("unknown package manager %q", name)
+}
+
+// systemPackageManager returns the first installed OS package manager,
+// falling back to brew (macOS).
+func systemPackageManager() (packageManager, error) {
+	for _, pm := range packageManagers {
+		if !pm.system && pm.name != "brew" {
+			continue
+		}
+		if _, err := exec.LookPath(pm.binary); err == nil {
+			return pm, nil
+		}
+	}
+	return packageManager{}, fmt.Errorf("no system package manager found (apt, dnf, pacman, brew)")
+}
+
+func resolvePackageManager(args map[string]interface{}) (packageManager, error) {
+	if name, _ := args["manager"].(string); name != "" {
+		return findPackageManager(name)
+	}
+	return systemPackageManager()
+}
+
+func runPackageCommand(timeout time.Duration, cmdArgs []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive", "HOMEBREW_NO_AUTO_UPDATE=1")
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return string(output), fmt.Errorf("%s timed out after %s", cmdArgs[0], timeout)
+	}
+	return strings.TrimSpace(string(output)), err
+}
+
+func packageSearch(args map[string]interface{}) (string, error) {
+	query, _ := args["query"].(string)
+	if query == "" {
+		return "", fmt.Errorf("query required")
+	}
+	if !packageNamePattern.MatchString(query) {
+		return "", fmt.Errorf("invalid query %q", query)
+	}
+	pm, err := resolvePackageManager(args)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := runPackageCommand(90*time.Second, pm.search(query))
+	if err != nil && output == "" {
+		return "", fmt.Errorf("%s search failed: %v", pm.name, err)
+	}
+	if output == "" {
+		return fmt.Sprintf("No %s packages found for %q", pm.name, query), nil
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) > 60 {
+		output = strings.Join(lines[:60], "\n") + fmt.Sprintf("\n... (%d more results)", len(lines)-60)
+	}
+	return fmt.Sprintf("%s search %q:\n%s", pm.name, query, output), nil
+}
+
+func packageInfo(args map[string]interface{}) (string, error) {
+	name, _ := args["name"].(string)
+	if name == "" {
+		return "", fmt.Errorf("name required")
+	}
+	if !packageNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid package name %q", name)
+	}
+
+	managers := packageManagers
+	if m, _ := args["manager"].(string); m != "" {
+		pm, err := findPackageManager(m)
+		if err != nil {
+			return "", err
+		}
+		managers = []packageManager{pm}
+	}
+
+	var result strings.Builder
+	checked := 0
+	for _, pm := range managers {
+		if _, err := exec.LookPath(pm.binary); err != nil {
+			continue
+		}
+		checked++
+		output, err := runPackageCommand(30*time.Second, pm.info(name))
+		if err != nil || output == "" {
+			result.WriteString(fmt.Sprintf("%s: not installed\n", pm.name))
+			continue
+		}
+		result.WriteString(fmt.Sprintf("%s: %s\n", pm.name, packageVersion(pm.name, output)))
+	}
+	if checked == 0 {
+		return "", fmt.Errorf("no supported package managers found")
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		result.WriteString(fmt.Sprintf("executable: %s\n", path))
+	}
+	return result.String(), nil
+}
+
+// packageVersion pulls the version out of each manager's info output.
+func packageVersion(manager, output string) string {
+	switch manager {
+	case "pip":
+		for _, line := range strings.Split(output, "\n") {
+			if v, ok := strings.CutPrefix(line, "Version: "); ok {
+				return "installed " + v
+			}
+		}
+	case "npm":
+		for _, line := range strings.Split(output, "\n") {
+			if i := strings.LastIndex(line, "@"); i > 0 && (strings.Contains(line, "── ") || strings.Contains(line, "-- ")) {
+				return "installed " + line[i+1:]
+			}
+		}
+		return "not installed in this project"
+	case "pacman", "brew":
+		if fields := strings.Fields(output); len(fields) >= 2 {
+			return "installed " + strings.Join(fields[1:], " ")
+		}
+	}
+	return "installed " + strings.TrimSpace(output)
+}
+
+func packageInstall(args map[string]interface{}) (string, error) {
+	var pkgs []string
+	switch v := args["packages"].(type) {
+	case []interface{}:
+		for _, p := range v {
+			if s, ok := p.(string); ok && s != "" {
+				pkgs = append(pkgs, s)
+			}
+		}
+	case string:
+		pkgs = strings.Fields(v)
+	}
+	if len(pkgs) == 0 {
+		return "", fmt.Errorf("packages required")
+	}
+	for _, p := range pkgs {
+		if !packageNamePattern.MatchString(p) {
+			return "", fmt.Errorf("invalid package name %q", p)
+		}
+	}
+
+	pm, err := resolvePackageManager(args)
+	if err != nil {
+		return "", err
+	}
+	global, _ := args["global"].(bool)
+	return installPackages(pm, pkgs, global)
+}
+
+// installPackages asks for approval and runs the install. It is shared by
+// package_install and watch mode's dependency repair.
+func installPackages(pm packageManager, pkgs []string, global bool) (string, error) {
+	cmdArgs := pm.install(pkgs, global)
+	if pm.system && pm.name != "brew" && os.Geteuid() != 0 {
+		if _, err := exec.LookPath("sudo"); err != nil {
+			return "", fmt.Errorf("installing with %s needs root and sudo is not available", pm.name)
+		}
+		// -n: never prompt, since there is no terminal to answer on.
+		cmdArgs = append([]string{"sudo", "-n"}, cmdArgs...)
+	}
+
+	if err := requireApproval("package_install", strings.Join(cmdArgs, " ")); err != nil {
+		return "", err
+	}
+
+	output, err := runPackageCommand(10*time.Minute, cmdArgs)
+	if err != nil {
+		if strings.Contains(output, "a password is required") {
+			return "", fmt.Errorf("sudo needs a password; run `sudo -v` in your shell first, then retry")
+		}
+		return "", fmt.Errorf("install failed: %v\n%s", err, truncate(output, 3000))
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) > 20 {
+		output = strings.Join(lines[len(lines)-20:], "\n")
+	}
+	return fmt.Sprintf("Installed %s with %s\n%s", strings.Join(pkgs, ", "), pm.name, output), nil
+}
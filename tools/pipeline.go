@@ -0,0 +1,325 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"q/types"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var PipelineTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "run_pipeline",
+			Description: "Run agents as a pipeline whose steps feed each other, e.g. research → plan → implement → review, and return when it is done. Give the name of a pipeline from the config, or the steps. A step's task uses {{input}} for the pipeline's input and {{step_name}} for an earlier step's result, and waits for the steps it uses; steps that use none run in parallel. A failing step stops the pipeline unless it is optional.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"pipeline": {"type": "string", "description": "Name of a pipeline from the config"},
+					"input": {"type": "string", "description": "Input to the pipeline, used by steps as {{input}}"},
+					"steps": {
+						"type": "array",
+						"description": "Steps of an ad hoc pipeline, when no pipeline is named",
+						"items": {
+							"type": "object",
+							"properties": {
+								"name": {"type": "string", "description": "Step name, used as {{name}} by later steps"},
+								"role": {"type": "string", "description": "Agent role (default assistant)"},
+								"model": {"type": "string", "description": "Model to run the step on, instead of the role's or the default"},
+								"task": {"type": "string", "description": "Task for the step's agent"},
+								"tools": {"type": "array", "items": {"type": "string"}, "description": "Tools and tool categories the step's agent may use"},
+								"after": {"type": "array", "items": {"type": "string"}, "description": "Steps to wait for besides those the task uses"},
+								"optional": {"type": "boolean", "description": "Go on if this step fails"}
+							},
+							"required": ["name", "task"]
+						}
+					}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("agents", PipelineTools...)
+}
+
+var pipelineRefRe = regexp.MustCompile(`\{\{\s*([\w-]+)\s*\}\}`)
+
+// pipelineStep is a step of a running pipeline.
+type pipelineStep struct {
+	types.PipelineStep
+	// deps are the indexes of the steps it waits for.
+	deps    []int
+	status  string
+	agentID string
+	output  string
+	elapsed time.Duration
+}
+
+type pipelineDone struct {
+	index   int
+	agentID string
+	status  string
+	output  string
+	elapsed time.Duration
+}
+
+func runPipeline(ctx context.Context, args map[string]interface{}) (string, error) {
+	name, _ := args["pipeline"].(string)
+	input, _ := args["input"].(string)
+
+	var config []types.PipelineStep
+	if name != "" {
+		agentPrefsMu.Lock()
+		pipeline, ok := agentPrefs.Pipelines[name]
+		available := make([]string, 0, len(agentPrefs.Pipelines))
+		for n := range agentPrefs.Pipelines {
+			available = append(available, n)
+		}
+		agentPrefsMu.Unlock()
+		if !ok {
+			sort.Strings(available)
+			return "", fmt.Errorf("pipeline %q not found. Configured: %s", name, strings.Join(available, ", "))
+		}
+		config = pipeline.Steps
+	} else if raw, ok := args["steps"]; ok {
+		data, _ := json.Marshal(raw)
+		if err := json.Unmarshal(data, &config); err != nil {
+			return "", fmt.Errorf("invalid steps: %w", err)
+		}
+	}
+	if len(config) == 0 {
+		return "", fmt.Errorf("name a pipeline or give its steps")
+	}
+
+	steps, err := planPipeline(config)
+	if err != nil {
+		return "", err
+	}
+	failed := executePipeline(ctx, steps, input)
+	return formatPipeline(name, steps, failed), nil
+}
+
+// planPipeline checks the steps and works out what each waits for. A step
+// may only use steps before it, so the pipeline cannot go round in a
+// circle.
+func planPipeline(config []types.PipelineStep) ([]*pipelineStep, error) {
+	index := make(map[string]int)
+	steps := make([]*pipelineStep, len(config))
+	for i, c := range config {
+		if c.Name == "" || c.Name == "input" {
+			return nil, fmt.Errorf("step %d needs a name other than input", i+1)
+		}
+		if _, ok := index[c.Name]; ok {
+			return nil, fmt.Errorf("two steps are called %s", c.Name)
+		}
+		if strings.TrimSpace(c.Task) == "" {
+			return nil, fmt.Errorf("step %s has no task", c.Name)
+		}
+		if c.Role == "" {
+			c.Role = "assistant"
+		}
+		preset, err := agentRolePreset(c.Role)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", c.Name, err)
+		}
+		model := c.Model
+		if model == "" {
+			model = preset.Model
+		}
+		if _, err := resolveAgentModel(model); err != nil {
+			return nil, fmt.Errorf("step %s: %w", c.Name, err)
+		}
+		if _, err := agentToolScope(preset.Tools, c.Tools); err != nil {
+			return nil, fmt.Errorf("step %s: %w", c.Name, err)
+		}
+
+		step := &pipelineStep{PipelineStep: c, status: "pending"}
+		uses := append([]string{}, c.After...)
+		for _, m := range pipelineRefRe.FindAllStringSubmatch(c.Task, -1) {
+			uses = append(uses, m[1])
+		}
+		seen := make(map[int]bool)
+		for _, u := range uses {
+			if u == "input" {
+				continue
+			}
+			dep, ok := index[u]
+			if !ok {
+				return nil, fmt.Errorf("step %s uses %s, which is not a step before it", c.Name, u)
+			}
+			if !seen[dep] {
+				seen[dep] = true
+				step.deps = append(step.deps, dep)
+			}
+		}
+		index[c.Name] = i
+		steps[i] = step
+	}
+	return steps, nil
+}
+
+// executePipeline runs each step once the steps it waits for are done,
+// until all have run or one that is not optional fails, which cancels the
+// rest. It returns the step that failed, if any.
+func executePipeline(ctx context.Context, steps []*pipelineStep, input string) *pipelineStep {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan pipelineDone)
+	running := 0
+	var failed *pipelineStep
+	for {
+		if failed == nil && ctx.Err() == nil {
+			for i, step := range steps {
+				if step.status != "pending" || !pipelineReady(steps, step) {
+					continue
+				}
+				step.status = "running"
+				running++
+				go func(i int, task string) {
+					done <- runPipelineStep(ctx, i, steps[i].PipelineStep, task)
+				}(i, expandPipelineTask(steps, step.Task, input))
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		d := <-done
+		running--
+		step := steps[d.index]
+		step.status, step.agentID, step.output, step.elapsed = d.status, d.agentID, d.output, d.elapsed
+		if d.status != "completed" && !step.Optional && failed == nil {
+			failed = step
+			cancel()
+		}
+	}
+
+	for _, step := range steps {
+		if step.status == "pending" {
+			step.status = "skipped"
+		}
+	}
+	if failed == nil && ctx.Err() != nil {
+		for _, step := range steps {
+			if step.status != "completed" && !step.Optional {
+				return step
+			}
+		}
+	}
+	return failed
+}
+
+// pipelineReady reports whether every step that step waits for is done,
+// optional steps counting as done however they went.
+func pipelineReady(steps []*pipelineStep, step *pipelineStep) bool {
+	for _, dep := range step.deps {
+		d := steps[dep]
+		if d.status != "completed" && !(d.Optional && d.status != "pending" && d.status != "running") {
+			return false
+		}
+	}
+	return true
+}
+
+// expandPipelineTask fills in the input and the results of earlier steps
+// used by task.
+func expandPipelineTask(steps []*pipelineStep, task, input string) string {
+	return pipelineRefRe.ReplaceAllStringFunc(task, func(ref string) string {
+		name := pipelineRefRe.FindStringSubmatch(ref)[1]
+		if name == "input" {
+			return input
+		}
+		for _, s := range steps {
+			if s.Name != name {
+				continue
+			}
+			if s.status != "completed" {
+				return fmt.Sprintf("(step %s %s: %s)", s.Name, s.status, s.output)
+			}
+			return s.output
+		}
+		return ref
+	})
+}
+
+// runPipelineStep runs a step's agent and waits for it to finish,
+// cancelling it if ctx is done first.
+func runPipelineStep(ctx context.Context, index int, step types.PipelineStep, task string) pipelineDone {
+	start := time.Now()
+	id, err := SpawnAgent(task, step.Role, step.Model, step.Tools, false)
+	if err != nil {
+		return pipelineDone{index: index, status: "failed", output: err.Error(), elapsed: time.Since(start)}
+	}
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	cancelled := ctx.Done()
+	for {
+		agentMutex.RLock()
+		agent := agentTasks[id]
+		finished, status, result, agentErr := agent.Done, agent.Status, agent.Result, agent.Error
+		agentMutex.RUnlock()
+		if finished {
+			output := result
+			if status != "completed" {
+				output = agentErr
+			}
+			return pipelineDone{index: index, agentID: id, status: status, output: output, elapsed: time.Since(start)}
+		}
+
+		select {
+		case <-cancelled:
+			stopAgent(agent)
+			cancelled = nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// formatPipeline reports how each step went, with the results of the
+// steps no other step used in full.
+func formatPipeline(name string, steps []*pipelineStep, failed *pipelineStep) string {
+	used := make(map[int]bool)
+	for _, step := range steps {
+		for _, dep := range step.deps {
+			used[dep] = true
+		}
+	}
+
+	title := "Pipeline"
+	if name != "" {
+		title += " " + name
+	}
+	var b strings.Builder
+	if failed != nil {
+		b.WriteString(fmt.Sprintf("%s failed at step %s\n", title, failed.Name))
+	} else {
+		b.WriteString(title + " completed\n")
+	}
+	for _, step := range steps {
+		line := fmt.Sprintf("  %s [%s] (%s)", step.Name, step.status, step.Role)
+		if step.agentID != "" {
+			line += fmt.Sprintf(" %s, %s", step.agentID, step.elapsed.Truncate(time.Second))
+		}
+		if step.status != "completed" && step.output != "" {
+			line += ": " + truncateStr(step.output, 200)
+		}
+		b.WriteString(line + "\n")
+	}
+	for i, step := range steps {
+		if step.status == "completed" && !used[i] {
+			b.WriteString(fmt.Sprintf("\nResult of %s:\n%s\n", step.Name, step.output))
+		}
+	}
+	b.WriteString("\nEvery step's full result is available with get_agent_result.")
+	return b.String()
+}
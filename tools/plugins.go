@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PluginManifest describes an external tool in ~/.shell-ai/plugins/<name>.json.
+// The command receives the tool arguments as JSON on stdin and its stdout is
+// returned to the model.
+type PluginManifest struct {
+	Name            string          `json:"name"`
+	Description     string          `json:"description"`
+	Parameters      json.RawMessage `json:"parameters,omitempty"`
+	Command         string          `json:"command"`
+	Args            []string        `json:"args,omitempty"`
+	Timeout         int             `json:"timeout,omitempty"`
+	RequireApproval bool            `json:"require_approval,omitempty"`
+}
+
+var (
+	plugins       = make(map[string]PluginManifest)
+	pluginName    = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	pluginsLoaded bool
+)
+
+// PluginDir returns the directory plugins are loaded from.
+func PluginDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".shell-ai", "plugins")
+}
+
+// LoadPlugins registers every valid manifest in dir as a tool in the
+// "plugins" category. Invalid manifests are skipped and reported.
+func LoadPlugins(dir string) []error {
+	if pluginsLoaded {
+		return nil
+	}
+	pluginsLoaded = true
+
+	manifests, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(manifests) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, path := range manifests {
+		manifest, err := readPluginManifest(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", filepath.Base(path), err))
+			continue
+		}
+		plugins[manifest.Name] = manifest
+		if manifest.Timeout > 0 {
+			SetToolTimeouts(0, map[string]int{manifest.Name: manifest.Timeout})
+		}
+		RegisterTools("plugins", Tool{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        manifest.Name,
+				Description: manifest.Description,
+				Parameters:  manifest.Parameters,
+			},
+		})
+	}
+	return errs
+}
+
+func readPluginManifest(path string) (PluginManifest, error) {
+	var manifest PluginManifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	if manifest.Name == "" {
+		manifest.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	if !pluginName.MatchString(manifest.Name) {
+		return manifest, fmt.Errorf("invalid name %q: use letters, digits, - and _", manifest.Name)
+	}
+	if toolRegistered(manifest.Name) {
+		return manifest, fmt.Errorf("name %s is already used by another tool", manifest.Name)
+	}
+	if manifest.Description == "" {
+		return manifest, fmt.Errorf("description required")
+	}
+	if manifest.Command == "" {
+		return manifest, fmt.Errorf("command required")
+	}
+	if len(manifest.Parameters) == 0 {
+		manifest.Parameters = json.RawMessage(`{"type": "object", "properties": {}}`)
+	} else if !json.Valid(manifest.Parameters) {
+		return manifest, fmt.Errorf("parameters is not valid JSON schema")
+	}
+
+	// Relative commands resolve against the plugins directory first, then PATH.
+	manifest.Command = expandPath(manifest.Command)
+	if !filepath.IsAbs(manifest.Command) {
+		local := filepath.Join(filepath.Dir(path), manifest.Command)
+		if _, err := os.Stat(local); err == nil {
+			manifest.Command = local
+		}
+	}
+	if _, err := exec.LookPath(manifest.Command); err != nil {
+		return manifest, fmt.Errorf("command %s is not an executable", manifest.Command)
+	}
+	return manifest, nil
+}
+
+func isPlugin(name string) bool {
+	_, ok := plugins[name]
+	return ok
+}
+
+func runPlugin(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	manifest := plugins[name]
+	input, err := json.Marshal(args)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode arguments: %w", err)
+	}
+
+	if manifest.RequireApproval {
+		if err := requireApproval(name, fmt.Sprintf("run plugin %s with %s", manifest.Command, truncate(string(input), 500))); err != nil {
+			return "", err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, manifest.Command, manifest.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), "Q_PLUGIN_NAME="+name)
+	cmd.WaitDelay = 2 * time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	output := strings.TrimSpace(stdout.String())
+	if err != nil {
+		detail := strings.TrimSpace(stderr.String())
+		if detail == "" {
+			detail = output
+		}
+		return "", fmt.Errorf("plugin %s failed: %v: %s", name, err, truncate(detail, 2000))
+	}
+	if output == "" {
+		return "(no output)", nil
+	}
+	return truncate(output, 50000), nil
+}
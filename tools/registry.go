@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Categories lists the tool categories in the order their tools are sent
+// to the model.
+var Categories = []string{
+	"files",
+	"shell",
+	"git",
+	"network",
+	"system",
+	"kubernetes",
+	"database",
+	"watch",
+	"agents",
+	"knowledge",
+	"docs",
+	"plugins",
+}
+
+var (
+	registeredTools  = make(map[string][]Tool)
+	toolCategoryOf   = make(map[string]string)
+	enabledByDefault = true
+	categoryEnabled  = make(map[string]bool)
+	registryMu       sync.RWMutex
+)
+
+// RegisterTools adds tools to a category. Called from init() in each tool file.
+func RegisterTools(category string, tools ...Tool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registeredTools[category] = append(registeredTools[category], tools...)
+	for _, t := range tools {
+		toolCategoryOf[t.Function.Name] = category
+	}
+}
+
+// SetToolCategories applies the category toggles from Preferences and the
+// --tools flag. When only is non-empty, just those categories are enabled;
+// otherwise every category is enabled unless toggles sets it to false.
+func SetToolCategories(toggles map[string]bool, only []string) error {
+	for _, name := range only {
+		if !isCategory(name) {
+			return fmt.Errorf("unknown tool category %q (available: %s)", name, strings.Join(Categories, ", "))
+		}
+	}
+	for name := range toggles {
+		if !isCategory(name) {
+			return fmt.Errorf("unknown tool category %q in preferences (available: %s)", name, strings.Join(Categories, ", "))
+		}
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	categoryEnabled = make(map[string]bool)
+	if len(only) > 0 {
+		enabledByDefault = false
+		for _, name := range only {
+			categoryEnabled[name] = true
+		}
+		return nil
+	}
+	enabledByDefault = true
+	for name, on := range toggles {
+		categoryEnabled[name] = on
+	}
+	return nil
+}
+
+// ParseCategories splits a comma-separated --tools value.
+func ParseCategories(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(strings.ToLower(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func isCategory(name string) bool {
+	for _, c := range Categories {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func categoryOn(category string) bool {
+	if on, ok := categoryEnabled[category]; ok {
+		return on
+	}
+	return enabledByDefault
+}
+
+// EnabledTools returns the tool definitions to send to the model.
+func EnabledTools() []Tool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var tools []Tool
+	for _, category := range Categories {
+		if categoryOn(category) {
+			tools = append(tools, registeredTools[category]...)
+		}
+	}
+	return tools
+}
+
+func toolRegistered(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := toolCategoryOf[name]
+	return ok
+}
+
+// ToolEnabled reports whether a tool exists and its category is enabled.
+func ToolEnabled(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	category, ok := toolCategoryOf[name]
+	return ok && categoryOn(category)
+}
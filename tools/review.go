@@ -0,0 +1,263 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyTree is git's empty tree, the base of a repository with no commits.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// Defaults for ReviewConfig.
+const (
+	defaultReviewInterval = 5 * time.Second
+	defaultReviewMinLines = 5
+)
+
+const reviewPrompt = `You review uncommitted code changes the way a careful colleague would before
+they are committed. Point out likely bugs, missing error handling, unhandled
+edge cases, races and resource leaks in the changed lines. Skip style, naming
+and formatting unless they hide a bug, and do not describe what the change
+does. Each line of the diff that is in the new file starts with its line
+number there.
+
+Reply with only a JSON array, one object per comment:
+{"file": "path as in the diff", "line": 12, "severity": "bug" | "warning" | "nit", "comment": "one or two sentences"}
+Reply [] when there is nothing worth saying.`
+
+// ReviewComment is a remark from a review on a line of the changes.
+type ReviewComment struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// Severity is bug, warning or nit.
+	Severity string `json:"severity"`
+	Comment  string `json:"comment"`
+}
+
+// Review is the outcome of one review of the working tree.
+type Review struct {
+	Comments []ReviewComment
+	// Files and Lines count what had changed since HEAD.
+	Files int
+	Lines int
+	At    time.Time
+	Err   error
+}
+
+// ReviewConfig configures WatchForReview.
+type ReviewConfig struct {
+	// Interval is how often the working tree is checked (default 5s).
+	Interval time.Duration
+	// MinLines is how many lines must have changed since the last review
+	// for another (default 5).
+	MinLines int
+	// Now asks for a review straight away.
+	Now <-chan struct{}
+
+	OnReviewing func()
+	OnReview    func(Review)
+}
+
+// WatchForReview reviews the uncommitted changes in the current repository
+// whenever they have changed significantly and then stayed the same for an
+// interval, so that a review is not spent on a half-typed edit. It returns
+// when ctx is done.
+func WatchForReview(ctx context.Context, config ReviewConfig) {
+	if config.Interval <= 0 {
+		config.Interval = defaultReviewInterval
+	}
+	if config.MinLines <= 0 {
+		config.MinLines = defaultReviewMinLines
+	}
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	reviewed, previous := "", ""
+	first := true
+	for {
+		// The changes there are when the review starts are reviewed
+		// straight away.
+		force := first
+		if !first {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-config.Now:
+				force = true
+			}
+		}
+
+		diff, err := WorkingTreeDiff()
+		first = false
+		if err != nil {
+			if config.OnReview != nil {
+				config.OnReview(Review{At: time.Now(), Err: err})
+			}
+			continue
+		}
+		stable := diff == previous
+		previous = diff
+		if !force && (!stable || diffChurn(reviewed, diff) < config.MinLines) {
+			continue
+		}
+
+		if config.OnReviewing != nil {
+			config.OnReviewing()
+		}
+		// A failed review counts too: sending the same diff again each
+		// interval would only fail again. It is retried once the diff grows
+		// or the user asks.
+		review := ReviewDiff(diff)
+		reviewed = diff
+		if config.OnReview != nil {
+			config.OnReview(review)
+		}
+	}
+}
+
+// WorkingTreeDiff returns the changes in the current repository since
+// HEAD to files git tracks, staged new files included. Untracked files are
+// left out: scratch files may hold secrets, and are not for review until
+// they are added.
+func WorkingTreeDiff() (string, error) {
+	top, err := checkpointGit("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not in a git repository")
+	}
+	base, err := checkpointGit("", "rev-parse", "--verify", "-q", "HEAD")
+	if err != nil || base == "" {
+		base = emptyTree
+	}
+	return checkpointGit("", "-C", top, "diff", "--no-color", "--no-renames", base)
+}
+
+// ReviewDiff asks the model to review diff.
+func ReviewDiff(diff string) Review {
+	review := Review{At: time.Now()}
+	if strings.TrimSpace(diff) == "" {
+		return review
+	}
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			review.Files++
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"), strings.HasPrefix(line, "-"):
+			review.Lines++
+		}
+	}
+
+	reply, err := Complete(reviewPrompt, "Review these changes:\n\n"+truncate(numberDiffLines(diff), 30000))
+	if err != nil {
+		review.Err = fmt.Errorf("review failed: %w", err)
+		return review
+	}
+	review.Comments, review.Err = parseReviewComments(reply)
+	sort.SliceStable(review.Comments, func(i, j int) bool {
+		a, b := review.Comments[i], review.Comments[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return review
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// numberDiffLines puts the line number in the new file in front of each
+// line of diff that is in it, so comments can point at lines reliably.
+func numberDiffLines(diff string) string {
+	var b strings.Builder
+	line := 0
+	for _, l := range strings.Split(diff, "\n") {
+		if m := hunkHeaderRe.FindStringSubmatch(l); m != nil {
+			fmt.Sscanf(m[1], "%d", &line)
+			b.WriteString(l + "\n")
+			continue
+		}
+		switch {
+		case line == 0, strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"):
+			b.WriteString(l + "\n")
+		case strings.HasPrefix(l, "-"):
+			b.WriteString(fmt.Sprintf("%6s %s\n", "", l))
+		case strings.HasPrefix(l, "+"), strings.HasPrefix(l, " "):
+			b.WriteString(fmt.Sprintf("%6d %s\n", line, l))
+			line++
+		default:
+			// A new file's header ends the hunk.
+			line = 0
+			b.WriteString(l + "\n")
+		}
+	}
+	return b.String()
+}
+
+// parseReviewComments reads the JSON array of comments in reply, which
+// models sometimes wrap in a code fence or a sentence.
+func parseReviewComments(reply string) ([]ReviewComment, error) {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("review reply was not a list of comments: %s", truncate(reply, 200))
+	}
+	var comments []ReviewComment
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &comments); err != nil {
+		return nil, fmt.Errorf("could not read review comments: %w", err)
+	}
+	kept := comments[:0]
+	for _, c := range comments {
+		if strings.TrimSpace(c.Comment) == "" {
+			continue
+		}
+		switch c.Severity {
+		case "bug", "warning", "nit":
+		default:
+			c.Severity = "warning"
+		}
+		kept = append(kept, c)
+	}
+	return kept, nil
+}
+
+// diffChurn counts the changed lines that differ between two diffs of the
+// same tree, a measure of how much was edited between them.
+func diffChurn(old, new string) int {
+	counts := make(map[string]int)
+	changed := func(diff string, delta int) {
+		for _, line := range strings.Split(diff, "\n") {
+			if strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---") {
+				continue
+			}
+			if strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+				counts[line] += delta
+			}
+		}
+	}
+	changed(old, -1)
+	changed(new, 1)
+
+	churn := 0
+	for _, n := range counts {
+		if n < 0 {
+			n = -n
+		}
+		churn += n
+	}
+	return churn
+}
+
+// FormatReviewComments writes comments one per line in the
+// file:line: severity: comment format editors can jump through.
+func FormatReviewComments(comments []ReviewComment) string {
+	var b strings.Builder
+	for _, c := range comments {
+		b.WriteString(fmt.Sprintf("%s:%d: %s: %s\n", c.File, c.Line, c.Severity, strings.Join(strings.Fields(c.Comment), " ")))
+	}
+	return b.String()
+}
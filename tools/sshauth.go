@@ -0,0 +1,110 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var (
+	// Decrypted keys are kept for the session so a passphrase is asked once.
+	keySigners   = make(map[string]ssh.Signer)
+	keySignersMu sync.Mutex
+
+	agentOnce   sync.Once
+	agentClient agent.ExtendedAgent
+)
+
+// sshAgent connects to the running ssh-agent, if SSH_AUTH_SOCK points at one.
+func sshAgent() agent.ExtendedAgent {
+	agentOnce.Do(func() {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return
+		}
+		agentClient = agent.NewClient(conn)
+	})
+	return agentClient
+}
+
+// loadKeySigner parses a private key, asking the user for the passphrase
+// when the key is encrypted.
+func loadKeySigner(keyPath string) (ssh.Signer, error) {
+	keySignersMu.Lock()
+	defer keySignersMu.Unlock()
+	if signer, ok := keySigners[keyPath]; ok {
+		return signer, nil
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %w", keyPath, err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, perr := requestInput(fmt.Sprintf("Passphrase for %s:", keyPath), true)
+		if perr != nil {
+			return nil, perr
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key %s: %w", keyPath, err)
+	}
+	keySigners[keyPath] = signer
+	return signer, nil
+}
+
+// sshAuthMethods tries ssh-agent first, then the key file, then a password
+// if allowed. Key passphrases and passwords are only asked for when the
+// server gets to that method, so agent logins never prompt.
+func sshAuthMethods(username, host, keyPath string, usePassword bool) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	if a := sshAgent(); a != nil {
+		methods = append(methods, ssh.PublicKeysCallback(a.Signers))
+	}
+	if keyPath != "" {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signer, err := loadKeySigner(keyPath)
+			if err != nil {
+				return nil, err
+			}
+			return []ssh.Signer{signer}, nil
+		}))
+	}
+
+	if len(methods) == 0 && !usePassword {
+		return nil, fmt.Errorf("no SSH key or ssh-agent found. Specify key_path, add IdentityFile to ~/.ssh/config, or set password_auth")
+	}
+	if usePassword {
+		prompt := fmt.Sprintf("Password for %s@%s:", username, host)
+		methods = append(methods,
+			ssh.PasswordCallback(func() (string, error) {
+				return requestInput(prompt, true)
+			}),
+			ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i, q := range questions {
+					answer, err := requestInput(fmt.Sprintf("%s@%s %s", username, host, q), !echos[i])
+					if err != nil {
+						return nil, err
+					}
+					answers[i] = answer
+				}
+				return answers, nil
+			}),
+		)
+	}
+	return methods, nil
+}
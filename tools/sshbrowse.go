@@ -0,0 +1,224 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+var SSHBrowseTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ssh_ls",
+			Description: "List a remote directory over SFTP with sizes, permissions and modification times. Use it to find the right paths before ssh_download.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"host": {"type": "string", "description": "Hostname, IP, SSH config alias or inventory name"},
+					"path": {"type": "string", "description": "Remote directory (default: home directory)"},
+					"all": {"type": "boolean", "description": "Include hidden entries"},
+					"recursive": {"type": "boolean", "description": "Descend into subdirectories (up to 500 entries)"},
+					"sort": {"type": "string", "enum": ["name", "size", "time"], "description": "Sort order (default name; size and time are largest/newest first)"},
+					"user": {"type": "string", "description": "Username (optional)"},
+					"password_auth": {"type": "boolean", "description": "Also allow password login; the user is prompted for the password"}
+				},
+				"required": ["host"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ssh_stat",
+			Description: "Show details of a remote file or directory over SFTP: type, size, permissions, owner, modification time and symlink target.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"host": {"type": "string", "description": "Hostname, IP, SSH config alias or inventory name"},
+					"path": {"type": "string", "description": "Remote path"},
+					"user": {"type": "string", "description": "Username (optional)"},
+					"password_auth": {"type": "boolean", "description": "Also allow password login; the user is prompted for the password"}
+				},
+				"required": ["host", "path"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("network", SSHBrowseTools...)
+}
+
+const sshListLimit = 500
+
+type remoteEntry struct {
+	path string
+	info fs.FileInfo
+}
+
+func formatRemoteEntry(sc *sftp.Client, name string, full string, info fs.FileInfo) string {
+	size := formatBytes(info.Size())
+	if info.IsDir() {
+		name += "/"
+		size = "-"
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if target, err := sc.ReadLink(full); err == nil {
+			name += " -> " + target
+		}
+	}
+	return fmt.Sprintf("%s  %9s  %s  %s", info.Mode(), size, info.ModTime().Format("2006-01-02 15:04"), name)
+}
+
+func sshLs(args map[string]interface{}) (string, error) {
+	host, _ := args["host"].(string)
+	if host == "" {
+		return "", fmt.Errorf("host required")
+	}
+	client, sc, err := openSFTP(args)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	defer sc.Close()
+
+	dir, _ := args["path"].(string)
+	if dir == "" || dir == "~" {
+		dir = "."
+	}
+	dir = strings.TrimPrefix(dir, "~/")
+	if resolved, err := sc.RealPath(dir); err == nil {
+		dir = resolved
+	}
+	all, _ := args["all"].(bool)
+	recursive, _ := args["recursive"].(bool)
+	order, _ := args["sort"].(string)
+
+	info, err := sc.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("%s:%s: %w", host, dir, err)
+	}
+	if !info.IsDir() {
+		return formatRemoteEntry(sc, path.Base(dir), dir, info), nil
+	}
+
+	var entries []remoteEntry
+	truncated := false
+	var walk func(d string) error
+	walk = func(d string) error {
+		list, err := sc.ReadDir(d)
+		if err != nil {
+			return err
+		}
+		for _, fi := range list {
+			if !all && strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			if len(entries) >= sshListLimit {
+				truncated = true
+				return nil
+			}
+			full := path.Join(d, fi.Name())
+			entries = append(entries, remoteEntry{full, fi})
+			// Unreadable subdirectories are listed but not entered.
+			if recursive && fi.IsDir() {
+				walk(full)
+			}
+		}
+		return nil
+	}
+	if err := walk(dir); err != nil {
+		return "", fmt.Errorf("%s:%s: %w", host, dir, err)
+	}
+
+	switch order {
+	case "size":
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].info.Size() > entries[j].info.Size() })
+	case "time":
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].info.ModTime().After(entries[j].info.ModTime()) })
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("%s:%s\n", host, dir))
+	var total int64
+	for _, e := range entries {
+		rel := strings.TrimPrefix(strings.TrimPrefix(e.path, dir), "/")
+		result.WriteString(formatRemoteEntry(sc, rel, e.path, e.info) + "\n")
+		if !e.info.IsDir() {
+			total += e.info.Size()
+		}
+	}
+	if len(entries) == 0 {
+		result.WriteString("(empty)\n")
+	}
+	result.WriteString(fmt.Sprintf("%d entries, %s in files", len(entries), formatBytes(total)))
+	if truncated {
+		result.WriteString(fmt.Sprintf(" (stopped at %d entries; list a subdirectory for more)", sshListLimit))
+	}
+	return result.String(), nil
+}
+
+func sshStat(args map[string]interface{}) (string, error) {
+	host, _ := args["host"].(string)
+	target, _ := args["path"].(string)
+	if host == "" || target == "" {
+		return "", fmt.Errorf("host and path required")
+	}
+	client, sc, err := openSFTP(args)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	defer sc.Close()
+
+	target = strings.TrimPrefix(target, "~/")
+	info, err := sc.Lstat(target)
+	if err != nil {
+		return "", fmt.Errorf("%s:%s: %w", host, target, err)
+	}
+	full := target
+	if resolved, err := sc.RealPath(target); err == nil {
+		full = resolved
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Path: %s:%s\n", host, full))
+	kind := "file"
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		kind = "symlink"
+		if link, err := sc.ReadLink(target); err == nil {
+			kind += " -> " + link
+		}
+	case info.IsDir():
+		kind = "directory"
+	case info.Mode()&fs.ModeNamedPipe != 0:
+		kind = "named pipe"
+	case info.Mode()&fs.ModeSocket != 0:
+		kind = "socket"
+	case info.Mode()&fs.ModeDevice != 0:
+		kind = "device"
+	}
+	result.WriteString(fmt.Sprintf("Type: %s\n", kind))
+	result.WriteString(fmt.Sprintf("Size: %s (%d bytes)\n", formatBytes(info.Size()), info.Size()))
+	result.WriteString(fmt.Sprintf("Mode: %s (%04o)\n", info.Mode(), info.Mode().Perm()))
+	if st, ok := info.Sys().(*sftp.FileStat); ok {
+		result.WriteString(fmt.Sprintf("Owner: uid %d, gid %d\n", st.UID, st.GID))
+	}
+	result.WriteString(fmt.Sprintf("Modified: %s (%s ago)\n", info.ModTime().Format(time.RFC3339), time.Since(info.ModTime()).Round(time.Second)))
+	if info.IsDir() {
+		if list, err := sc.ReadDir(target); err == nil {
+			result.WriteString(fmt.Sprintf("Entries: %d\n", len(list)))
+		}
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,281 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var SSHMultiTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ssh_exec_multi",
+			Description: "Run a command on many hosts at once with bounded parallelism. Hosts can be names, addresses, ssh config aliases, inventory names or @group. Returns a table of exit codes plus each host's output.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"hosts": {"type": "array", "items": {"type": "string"}, "description": "Hosts to run on; @name expands to every inventory host in that group or with that tag"},
+					"command": {"type": "string", "description": "Command to execute on every host"},
+					"user": {"type": "string", "description": "Username for all hosts (default: per-host inventory or ssh config)"},
+					"parallel": {"type": "integer", "description": "Hosts to run at once (default 8, max 32)"},
+					"timeout": {"type": "integer", "description": "Per-host timeout in seconds (default 120)"},
+					"password_auth": {"type": "boolean", "description": "Also allow password login; the user is prompted for each host's password"}
+				},
+				"required": ["hosts", "command"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("network", SSHMultiTools...)
+}
+
+const (
+	defaultSSHParallel = 8
+	maxSSHParallel     = 32
+	sshMultiOutputMax  = 4000
+	// defaultSSHHostTimeout bounds each host's run.
+	defaultSSHHostTimeout = 120 * time.Second
+)
+
+// sshLogin is how every host of a multi-host run is logged in to; zero
+// fields fall back to each host's inventory and ssh config settings.
+type sshLogin struct {
+	user        string
+	port        int
+	keyPath     string
+	usePassword bool
+}
+
+type sshHostResult struct {
+	host     string
+	output   string
+	code     int
+	err      error
+	duration time.Duration
+}
+
+// expandHostTargets resolves @group entries through the inventory and drops
+// duplicates, keeping the order given.
+func expandHostTargets(targets []string) ([]string, error) {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			hosts = append(hosts, name)
+		}
+	}
+	for _, t := range targets {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if group, ok := strings.CutPrefix(t, "@"); ok {
+			members, err := inventoryGroup(group)
+			if err != nil {
+				return nil, err
+			}
+			for _, h := range members {
+				add(h.Name)
+			}
+			continue
+		}
+		add(t)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts given")
+	}
+	return hosts, nil
+}
+
+// runOnHost runs a command on one host, closing the session if ctx ends first.
+func runOnHost(ctx context.Context, host string, login sshLogin, command string) sshHostResult {
+	start := time.Now()
+	result := sshHostResult{host: host, code: -1}
+
+	client, err := createSSHClient(host, login.user, login.port, login.keyPath, login.usePassword)
+	if err != nil {
+		result.err = err
+		result.duration = time.Since(start)
+		return result
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		result.err = fmt.Errorf("failed to open session: %w", err)
+		result.duration = time.Since(start)
+		return result
+	}
+	defer session.Close()
+
+	type runOutput struct {
+		data []byte
+		err  error
+	}
+	done := make(chan runOutput, 1)
+	go func() {
+		data, err := session.CombinedOutput(command)
+		done <- runOutput{data, err}
+	}()
+
+	select {
+	case out := <-done:
+		result.output = string(out.data)
+		var exitErr *ssh.ExitError
+		switch {
+		case out.err == nil:
+			result.code = 0
+		case errors.As(out.err, &exitErr):
+			result.code = exitErr.ExitStatus()
+		default:
+			result.err = out.err
+		}
+	case <-ctx.Done():
+		session.Close()
+		if ctx.Err() == context.DeadlineExceeded {
+			result.err = fmt.Errorf("timed out")
+		} else {
+			result.err = fmt.Errorf("cancelled")
+		}
+	}
+	result.duration = time.Since(start)
+	return result
+}
+
+// runSSHMulti runs command on every host, at most parallel at a time.
+func runSSHMulti(ctx context.Context, hosts []string, command string, login sshLogin, parallel int, timeout time.Duration) []sshHostResult {
+	results := make([]sshHostResult, len(hosts))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	finished := 0
+
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = sshHostResult{host: host, code: -1, err: fmt.Errorf("cancelled")}
+				return
+			}
+			defer func() { <-sem }()
+
+			hostCtx, cancel := context.WithTimeout(ctx, timeout)
+			results[i] = runOnHost(hostCtx, host, login, command)
+			cancel()
+
+			mu.Lock()
+			finished++
+			reportProgress("ssh_exec_multi", fmt.Sprintf("%d/%d hosts done", finished, len(hosts)))
+			mu.Unlock()
+		}(i, host)
+	}
+	wg.Wait()
+	return results
+}
+
+// formatSSHMulti renders a summary table followed by each host's output.
+// Hosts that printed exactly the same thing share one output block.
+func formatSSHMulti(command string, results []sshHostResult) string {
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("$ %s\n\n", command))
+
+	w := tabwriter.NewWriter(&result, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tEXIT\tTIME\tOUTPUT")
+	failed := 0
+	for _, r := range results {
+		exit := fmt.Sprintf("%d", r.code)
+		summary := firstLine(r.output)
+		if r.err != nil {
+			exit = "ERR"
+			summary = r.err.Error()
+		}
+		if r.err != nil || r.code != 0 {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.host, exit, r.duration.Round(100*time.Millisecond), truncate(summary, 80))
+	}
+	w.Flush()
+	result.WriteString(fmt.Sprintf("\n%d hosts, %d ok, %d failed\n", len(results), len(results)-failed, failed))
+
+	outputs := make(map[string][]string)
+	var order []string
+	for _, r := range results {
+		out := strings.TrimRight(r.output, "\n")
+		if r.err != nil || out == "" {
+			continue
+		}
+		if _, ok := outputs[out]; !ok {
+			order = append(order, out)
+		}
+		outputs[out] = append(outputs[out], r.host)
+	}
+	for _, out := range order {
+		hosts := outputs[out]
+		sort.Strings(hosts)
+		result.WriteString(fmt.Sprintf("\n--- %s ---\n%s\n", strings.Join(hosts, ", "), truncate(out, sshMultiOutputMax)))
+	}
+	return result.String()
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
+
+func sshExecMulti(ctx context.Context, args map[string]interface{}) (string, error) {
+	command, _ := args["command"].(string)
+	if command == "" {
+		return "", fmt.Errorf("command required")
+	}
+	var targets []string
+	switch v := args["hosts"].(type) {
+	case []interface{}:
+		for _, h := range v {
+			if s, ok := h.(string); ok {
+				targets = append(targets, s)
+			}
+		}
+	case string:
+		targets = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	hosts, err := expandHostTargets(targets)
+	if err != nil {
+		return "", err
+	}
+
+	var login sshLogin
+	login.user, _ = args["user"].(string)
+	login.usePassword, _ = args["password_auth"].(bool)
+	parallel := defaultSSHParallel
+	if p, ok := args["parallel"].(float64); ok && p > 0 {
+		parallel = int(p)
+	}
+	if parallel > maxSSHParallel {
+		parallel = maxSSHParallel
+	}
+	timeout := defaultSSHHostTimeout
+	if t, ok := args["timeout"].(float64); ok && t > 0 {
+		timeout = time.Duration(t) * time.Second
+	}
+
+	results := runSSHMulti(ctx, hosts, command, login, parallel, timeout)
+	return formatSSHMulti(command, results), nil
+}
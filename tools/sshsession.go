@@ -0,0 +1,345 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+var SSHSessionTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ssh_session_start",
+			Description: "Open a persistent shell on a remote host. Working directory, exported variables and activated virtualenvs persist across ssh_session_exec calls.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"host": {"type": "string", "description": "Hostname, IP, or SSH config alias"},
+					"user": {"type": "string", "description": "Username (optional if in ssh config)"},
+					"port": {"type": "integer", "description": "SSH port (default 22)"},
+					"key_path": {"type": "string", "description": "Path to private key (optional)"},
+					"password_auth": {"type": "boolean", "description": "Also allow password login; the user is prompted for the password"},
+					"cwd": {"type": "string", "description": "Directory to start in"}
+				},
+				"required": ["host"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ssh_session_exec",
+			Description: "Run a command in a persistent remote shell opened with ssh_session_start. Returns combined output and exit code.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"session_id": {"type": "string", "description": "Session ID from ssh_session_start"},
+					"command": {"type": "string", "description": "Command to run"}
+				},
+				"required": ["session_id", "command"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ssh_session_close",
+			Description: "Close a persistent remote shell, or list open sessions when no session_id is given.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"session_id": {"type": "string", "description": "Session ID to close"}
+				},
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("network", SSHSessionTools...)
+}
+
+const (
+	sshSessionIdle  = 30 * time.Minute
+	maxSSHSessions  = 8
+	sshSessionLimit = 200000
+)
+
+type sshShell struct {
+	id       string
+	host     string
+	client   *goph.Client
+	session  *ssh.Session
+	stdin    io.WriteCloser
+	lines    chan string
+	lastUsed time.Time
+	mu       sync.Mutex // one command at a time
+}
+
+var (
+	sshShells   = make(map[string]*sshShell)
+	sshShellsMu sync.Mutex
+)
+
+func (s *sshShell) close() {
+	s.stdin.Close()
+	s.session.Close()
+	s.client.Close()
+}
+
+// reapIdleSSHShells closes sessions unused for longer than sshSessionIdle.
+func reapIdleSSHShells() {
+	sshShellsMu.Lock()
+	defer sshShellsMu.Unlock()
+	for id, s := range sshShells {
+		if time.Since(s.lastUsed) > sshSessionIdle {
+			s.close()
+			delete(sshShells, id)
+		}
+	}
+}
+
+func sshSessionStart(args map[string]interface{}) (string, error) {
+	host, _ := args["host"].(string)
+	if host == "" {
+		return "", fmt.Errorf("host required")
+	}
+	username, _ := args["user"].(string)
+	keyPath, _ := args["key_path"].(string)
+	usePassword, _ := args["password_auth"].(bool)
+	port := 0
+	if p, ok := args["port"].(float64); ok {
+		port = int(p)
+	}
+
+	reapIdleSSHShells()
+	sshShellsMu.Lock()
+	count := len(sshShells)
+	sshShellsMu.Unlock()
+	if count >= maxSSHSessions {
+		return "", fmt.Errorf("too many open sessions (%d); close one with ssh_session_close", count)
+	}
+
+	client, err := createSSHClient(host, username, port, keyPath, usePassword)
+	if err != nil {
+		return "", err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return "", fmt.Errorf("failed to open session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return "", err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return "", err
+	}
+	// Prefer bash so `source venv/bin/activate` and friends work; stderr is
+	// folded into stdout so output keeps its order.
+	if err := session.Start(`command -v bash >/dev/null 2>&1 && exec bash --noprofile --norc 2>&1; exec sh 2>&1`); err != nil {
+		client.Close()
+		return "", fmt.Errorf("failed to start remote shell: %w", err)
+	}
+
+	lines := make(chan string, 256)
+	go func() {
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" {
+				lines <- strings.TrimRight(line, "\r\n")
+			}
+			if err != nil {
+				close(lines)
+				return
+			}
+		}
+	}()
+
+	shell := &sshShell{
+		id:       newSSHSessionID(),
+		host:     host,
+		client:   client,
+		session:  session,
+		stdin:    stdin,
+		lines:    lines,
+		lastUsed: time.Now(),
+	}
+
+	cwd, _ := args["cwd"].(string)
+	setup := "cd ~"
+	if cwd != "" {
+		setup = "cd " + shellQuote(cwd)
+	}
+	output, code, err := shell.run(context.Background(), setup+" && pwd", 15*time.Second)
+	if err != nil {
+		shell.close()
+		return "", err
+	}
+	if code != 0 {
+		shell.close()
+		return "", fmt.Errorf("failed to cd to %s: %s", cwd, output)
+	}
+
+	sshShellsMu.Lock()
+	sshShells[shell.id] = shell
+	sshShellsMu.Unlock()
+	return fmt.Sprintf("Session %s open on %s in %s. Use ssh_session_exec with this session_id.", shell.id, host, strings.TrimSpace(output)), nil
+}
+
+func newSSHSessionID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return "ssh-" + hex.EncodeToString(b)
+}
+
+// shellQuote wraps s in single quotes for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// run sends a command followed by a marker that echoes its exit code, then
+// reads output until the marker appears.
+func (s *sshShell) run(ctx context.Context, command string, timeout time.Duration) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUsed = time.Now()
+
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	marker := "__Q_DONE_" + hex.EncodeToString(nonce) + "_"
+
+	// The command runs in a group so a trailing comment can't swallow the
+	// marker, and stdin is detached so it can't eat later input. The marker
+	// starts on a fresh line even when the output lacks a final newline.
+	script := fmt.Sprintf("{ %s\n} < /dev/null\nprintf '\\n%s%%d\\n' \"$?\"\n", command, marker)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		return "", 0, fmt.Errorf("session %s is closed: %w", s.id, err)
+	}
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+	var lines []string
+	size := 0
+	collected := func() string { return strings.Join(lines, "\n") }
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				return collected(), 0, fmt.Errorf("remote shell exited")
+			}
+			if rest, found := strings.CutPrefix(line, marker); found {
+				// Drop the blank line left by the marker's leading newline.
+				if n := len(lines); n > 0 && lines[n-1] == "" {
+					lines = lines[:n-1]
+				}
+				code, _ := strconv.Atoi(rest)
+				return collected(), code, nil
+			}
+			if size < sshSessionLimit {
+				lines = append(lines, line)
+				size += len(line) + 1
+			}
+		case <-ctx.Done():
+			return collected(), 0, fmt.Errorf("cancelled")
+		case <-timer:
+			return collected(), 0, fmt.Errorf("timed out after %s", timeout)
+		}
+	}
+}
+
+func sshSessionExec(ctx context.Context, args map[string]interface{}) (string, error) {
+	id, _ := args["session_id"].(string)
+	command, _ := args["command"].(string)
+	if id == "" || command == "" {
+		return "", fmt.Errorf("session_id and command required")
+	}
+
+	sshShellsMu.Lock()
+	shell, ok := sshShells[id]
+	sshShellsMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("no open session %s (%s)", id, describeSSHShells())
+	}
+
+	output, code, err := shell.run(ctx, command, 0)
+	if err != nil {
+		// The shell's state is unknown once a command is abandoned.
+		closeSSHShell(id)
+		return "", fmt.Errorf("session %s closed: command %v\n%s", id, err, truncate(output, 5000))
+	}
+
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		output = "(no output)"
+	}
+	if code != 0 {
+		return fmt.Sprintf("%s\n[exit code %d]", output, code), nil
+	}
+	return output, nil
+}
+
+func closeSSHShell(id string) bool {
+	sshShellsMu.Lock()
+	defer sshShellsMu.Unlock()
+	shell, ok := sshShells[id]
+	if ok {
+		shell.close()
+		delete(sshShells, id)
+	}
+	return ok
+}
+
+func describeSSHShells() string {
+	sshShellsMu.Lock()
+	defer sshShellsMu.Unlock()
+	if len(sshShells) == 0 {
+		return "no sessions open"
+	}
+	var ids []string
+	for id := range sshShells {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var parts []string
+	for _, id := range ids {
+		s := sshShells[id]
+		parts = append(parts, fmt.Sprintf("%s on %s, idle %s", id, s.host, time.Since(s.lastUsed).Round(time.Second)))
+	}
+	return "open: " + strings.Join(parts, "; ")
+}
+
+func sshSessionClose(args map[string]interface{}) (string, error) {
+	reapIdleSSHShells()
+	id, _ := args["session_id"].(string)
+	if id == "" {
+		return describeSSHShells(), nil
+	}
+	if !closeSSHShell(id) {
+		return "", fmt.Errorf("no open session %s (%s)", id, describeSSHShells())
+	}
+	return fmt.Sprintf("Closed session %s", id), nil
+}
@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+// remoteOutputLimit caps what a remote command keeps in memory.
+const remoteOutputLimit = 200000
+
+// streamSSHCommand runs command in a new session, passing each output line
+// to onLine as it arrives. Cancelling ctx signals and closes the session.
+// With pty set the remote side gets a terminal, so closing the session
+// hangs up the command instead of leaving it running.
+func streamSSHCommand(ctx context.Context, client *goph.Client, command string, pty bool, onLine func(string)) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	if pty {
+		modes := ssh.TerminalModes{ssh.ECHO: 0}
+		if err := session.RequestPty("xterm", 50, 200, modes); err != nil {
+			return "", fmt.Errorf("failed to request a terminal: %w", err)
+		}
+	}
+
+	pr, pw := io.Pipe()
+	session.Stdout = pw
+	session.Stderr = pw
+
+	var output strings.Builder
+	var mu sync.Mutex
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), "\r")
+			mu.Lock()
+			if output.Len() < remoteOutputLimit {
+				output.WriteString(line + "\n")
+			}
+			mu.Unlock()
+			if onLine != nil {
+				onLine(line)
+			}
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	if err := session.Start(command); err != nil {
+		pw.Close()
+		return "", fmt.Errorf("failed to start command: %w", err)
+	}
+
+	waitDone := make(chan error, 1)
+	go func() { waitDone <- session.Wait() }()
+
+	var runErr error
+	select {
+	case runErr = <-waitDone:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGTERM)
+		session.Close()
+		runErr = ctx.Err()
+	}
+	pw.Close()
+	<-readDone
+
+	mu.Lock()
+	defer mu.Unlock()
+	return output.String(), runErr
+}
+
+// describeRemoteExit turns a session error into the "[Error: ...]" suffix
+// ssh_exec has always appended.
+func describeRemoteExit(err error) string {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Sprintf("[Error: exit status %d]", exitErr.ExitStatus())
+	}
+	return "[Error: " + err.Error() + "]"
+}
+
+// runSSHStreaming is the foreground ssh_exec path: output lines are shown as
+// progress while the command runs.
+func runSSHStreaming(ctx context.Context, client *goph.Client, command string) (string, error) {
+	var last time.Time
+	output, err := streamSSHCommand(ctx, client, command, false, func(line string) {
+		if time.Since(last) > 200*time.Millisecond && strings.TrimSpace(line) != "" {
+			last = time.Now()
+			reportProgress("ssh_exec", truncate(line, 120))
+		}
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return output + "\n[Stopped: the remote command was interrupted; use background for long jobs]", nil
+		}
+		return output + "\n" + describeRemoteExit(err), nil
+	}
+	return output, nil
+}
+
+// startRemoteBackground runs command on the host as a background task, so
+// check_task, list_tasks and kill_task work the same as for local commands.
+func startRemoteBackground(client *goph.Client, host, command, desc string) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	taskMutex.Lock()
+	taskCounter++
+	taskID := fmt.Sprintf("task_%d", taskCounter)
+	task := &BackgroundTask{
+		ID:        taskID,
+		Command:   command,
+		Host:      host,
+		Status:    "running",
+		StartTime: time.Now(),
+		cancel:    cancel,
+	}
+	backgroundTasks[taskID] = task
+	taskMutex.Unlock()
+
+	go func() {
+		defer client.Close()
+		output, err := streamSSHCommand(ctx, client, command, true, func(line string) {
+			taskMutex.Lock()
+			if len(task.Output) < remoteOutputLimit {
+				task.Output += line + "\n"
+			}
+			taskMutex.Unlock()
+		})
+
+		taskMutex.Lock()
+		task.Output = output
+		task.EndTime = time.Now()
+		task.Done = true
+		if ctx.Err() == context.Canceled {
+			task.Status = "killed"
+			task.Error = "Killed by user"
+		} else if err != nil {
+			task.Status = "failed"
+			task.Error = strings.Trim(describeRemoteExit(err), "[]")
+		} else {
+			task.Status = "completed"
+		}
+		taskMutex.Unlock()
+	}()
+
+	return fmt.Sprintf("Started background task %s on %s: %s\nCommand: %s\nUse check_task to see output so far, kill_task to stop it.", taskID, host, desc, command), nil
+}
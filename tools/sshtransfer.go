@@ -0,0 +1,392 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/melbahja/goph"
+	"github.com/pkg/sftp"
+)
+
+var SSHSyncTools = []Tool{
+	{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "ssh_sync",
+			Description: "Sync a local directory to a remote host over SFTP, rsync-style: only new or changed files are copied (by size and mtime, or checksum). Deleting remote extras requires approval.",
+			Parameters: json.RawMessage(`{
+				"type": "object",
+				"properties": {
+					"host": {"type": "string", "description": "Hostname, IP, or SSH config alias"},
+					"local_path": {"type": "string", "description": "Local directory to sync from"},
+					"remote_path": {"type": "string", "description": "Remote directory to sync to"},
+					"user": {"type": "string", "description": "Username (optional)"},
+					"checksum": {"type": "boolean", "description": "Compare SHA-256 checksums instead of size and mtime"},
+					"delete": {"type": "boolean", "description": "Delete remote files that do not exist locally"},
+					"exclude": {"type": "array", "items": {"type": "string"}, "description": "Glob patterns to skip, matched against relative paths and base names (e.g. node_modules, *.log)"},
+					"dry_run": {"type": "boolean", "description": "Only report what would change"},
+					"password_auth": {"type": "boolean", "description": "Also allow password login; the user is prompted for the password"}
+				},
+				"required": ["host", "local_path", "remote_path"],
+				"additionalProperties": false
+			}`),
+		},
+	},
+}
+
+func init() {
+	RegisterTools("network", SSHSyncTools...)
+}
+
+type transferStats struct {
+	tool     string
+	files    int
+	bytes    int64
+	lastSent time.Time
+}
+
+func (t *transferStats) add(n int64) {
+	t.files++
+	t.bytes += n
+	if time.Since(t.lastSent) > 500*time.Millisecond {
+		t.lastSent = time.Now()
+		reportProgress(t.tool, fmt.Sprintf("%d files, %s", t.files, formatBytes(t.bytes)))
+	}
+}
+
+func (t *transferStats) String() string {
+	return fmt.Sprintf("%d files, %s", t.files, formatBytes(t.bytes))
+}
+
+func openSFTP(args map[string]interface{}) (*goph.Client, *sftp.Client, error) {
+	host, _ := args["host"].(string)
+	username, _ := args["user"].(string)
+	usePassword, _ := args["password_auth"].(bool)
+
+	client, err := createSSHClient(host, username, 0, "", usePassword)
+	if err != nil {
+		return nil, nil, err
+	}
+	sftpClient, err := sftp.NewClient(client.Client)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("SFTP connection failed: %w", err)
+	}
+	return client, sftpClient, nil
+}
+
+// uploadFile copies one file and carries over its mode and mtime, which
+// ssh_sync relies on to skip unchanged files next time.
+func uploadFile(sc *sftp.Client, localPath, remotePath string, info fs.FileInfo) (int64, error) {
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer localFile.Close()
+
+	remoteFile, err := sc.Create(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", remotePath, err)
+	}
+	written, err := remoteFile.ReadFrom(localFile)
+	remoteFile.Close()
+	if err != nil {
+		return written, fmt.Errorf("upload of %s failed: %w", localPath, err)
+	}
+	sc.Chmod(remotePath, info.Mode().Perm())
+	sc.Chtimes(remotePath, info.ModTime(), info.ModTime())
+	return written, nil
+}
+
+func fetchRemoteFile(sc *sftp.Client, remotePath, localPath string, info fs.FileInfo) (int64, error) {
+	remoteFile, err := sc.Open(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", remotePath, err)
+	}
+	defer remoteFile.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return 0, err
+	}
+	localFile, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm()|0200)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+	written, err := io.Copy(localFile, remoteFile)
+	localFile.Close()
+	if err != nil {
+		return written, fmt.Errorf("download of %s failed: %w", remotePath, err)
+	}
+	os.Chtimes(localPath, info.ModTime(), info.ModTime())
+	return written, nil
+}
+
+func uploadTree(sc *sftp.Client, localRoot, remoteRoot string, stats *transferStats) error {
+	return filepath.WalkDir(localRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(localRoot, p)
+		remote := path.Join(remoteRoot, filepath.ToSlash(rel))
+		if d.IsDir() {
+			return sc.MkdirAll(remote)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		n, err := uploadFile(sc, p, remote, info)
+		if err != nil {
+			return err
+		}
+		stats.add(n)
+		return nil
+	})
+}
+
+func downloadTree(sc *sftp.Client, remoteRoot, localRoot string, stats *transferStats) error {
+	remoteRoot = path.Clean(remoteRoot)
+	walker := sc.Walk(remoteRoot)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), remoteRoot), "/")
+		local := filepath.Join(localRoot, filepath.FromSlash(rel))
+		info := walker.Stat()
+		if info.IsDir() {
+			if err := os.MkdirAll(local, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		n, err := fetchRemoteFile(sc, walker.Path(), local, info)
+		if err != nil {
+			return err
+		}
+		stats.add(n)
+	}
+	return nil
+}
+
+func syncExcluded(rel string, patterns []string) bool {
+	base := path.Base(rel)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+		// A directory pattern excludes everything below it.
+		if strings.HasPrefix(rel, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+		for _, part := range strings.Split(path.Dir(rel), "/") {
+			if ok, _ := path.Match(p, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// remoteChecksums hashes every file under root in one remote command.
+func remoteChecksums(client *goph.Client, root string) (map[string]string, error) {
+	cmd := fmt.Sprintf("cd %s 2>/dev/null || exit 0; if command -v sha256sum >/dev/null; then find . -type f -exec sha256sum {} +; else find . -type f -exec shasum -a 256 {} +; fi", shellQuote(root))
+	output, err := client.Run(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("remote checksum failed: %s", strings.TrimSpace(string(output)))
+	}
+	sums := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if ok {
+			sums[strings.TrimPrefix(name, "./")] = sum
+		}
+	}
+	return sums, nil
+}
+
+func sshSync(args map[string]interface{}) (string, error) {
+	host, _ := args["host"].(string)
+	localRoot, _ := args["local_path"].(string)
+	remoteRoot, _ := args["remote_path"].(string)
+	if host == "" || localRoot == "" || remoteRoot == "" {
+		return "", fmt.Errorf("host, local_path, and remote_path required")
+	}
+	localRoot = expandPath(localRoot)
+	if info, err := os.Stat(localRoot); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a local directory", localRoot)
+	}
+	useChecksum, _ := args["checksum"].(bool)
+	deleteExtra, _ := args["delete"].(bool)
+	dryRun, _ := args["dry_run"].(bool)
+	var excludes []string
+	if list, ok := args["exclude"].([]interface{}); ok {
+		for _, e := range list {
+			if s, ok := e.(string); ok && s != "" {
+				excludes = append(excludes, s)
+			}
+		}
+	}
+
+	client, sc, err := openSFTP(args)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	defer sc.Close()
+
+	if strings.HasPrefix(remoteRoot, "~/") {
+		if home, err := sc.Getwd(); err == nil {
+			remoteRoot = path.Join(home, remoteRoot[2:])
+		}
+	}
+	remoteRoot = path.Clean(remoteRoot)
+
+	// Index the remote side.
+	remoteFiles := make(map[string]fs.FileInfo)
+	walker := sc.Walk(remoteRoot)
+	for walker.Step() {
+		if walker.Err() != nil {
+			continue
+		}
+		if walker.Stat().Mode().IsRegular() {
+			rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), remoteRoot), "/")
+			remoteFiles[rel] = walker.Stat()
+		}
+	}
+	var remoteSums map[string]string
+	if useChecksum && len(remoteFiles) > 0 {
+		if remoteSums, err = remoteChecksums(client, remoteRoot); err != nil {
+			return "", err
+		}
+	}
+
+	// Compare with the local tree.
+	var toCopy []string
+	localFiles := make(map[string]fs.FileInfo)
+	unchanged := 0
+	err = filepath.WalkDir(localRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(localRoot, p)
+		rel = filepath.ToSlash(rel)
+		if rel != "." && syncExcluded(rel, excludes) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		localFiles[rel] = info
+
+		remote, exists := remoteFiles[rel]
+		switch {
+		case !exists:
+			toCopy = append(toCopy, rel)
+		case useChecksum:
+			sum, _, err := fileSHA256(p)
+			if err != nil {
+				return err
+			}
+			if sum != remoteSums[rel] {
+				toCopy = append(toCopy, rel)
+			} else {
+				unchanged++
+			}
+		case remote.Size() != info.Size() || !remote.ModTime().Equal(info.ModTime().Truncate(time.Second)):
+			toCopy = append(toCopy, rel)
+		default:
+			unchanged++
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to scan %s: %w", localRoot, err)
+	}
+
+	var toDelete []string
+	if deleteExtra {
+		for rel := range remoteFiles {
+			if _, ok := localFiles[rel]; !ok && !syncExcluded(rel, excludes) {
+				toDelete = append(toDelete, rel)
+			}
+		}
+		sort.Strings(toDelete)
+	}
+
+	var result strings.Builder
+	if dryRun {
+		result.WriteString(fmt.Sprintf("Dry run: %d to copy, %d to delete, %d unchanged\n", len(toCopy), len(toDelete), unchanged))
+		for _, rel := range toCopy {
+			result.WriteString("  copy   " + rel + "\n")
+		}
+		for _, rel := range toDelete {
+			result.WriteString("  delete " + rel + "\n")
+		}
+		return result.String(), nil
+	}
+
+	if len(toDelete) > 0 {
+		preview := toDelete
+		if len(preview) > 20 {
+			preview = preview[:20]
+		}
+		action := fmt.Sprintf("delete %d files under %s:%s not present locally:\n%s", len(toDelete), host, remoteRoot, strings.Join(preview, "\n"))
+		if len(toDelete) > len(preview) {
+			action += fmt.Sprintf("\n... and %d more", len(toDelete)-len(preview))
+		}
+		if err := requireApproval("ssh_sync", action); err != nil {
+			return "", err
+		}
+	}
+
+	stats := &transferStats{tool: "ssh_sync"}
+	for _, rel := range toCopy {
+		remote := path.Join(remoteRoot, rel)
+		if err := sc.MkdirAll(path.Dir(remote)); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w (copied %s so far)", path.Dir(remote), err, stats)
+		}
+		n, err := uploadFile(sc, filepath.Join(localRoot, filepath.FromSlash(rel)), remote, localFiles[rel])
+		if err != nil {
+			return "", fmt.Errorf("%w (copied %s so far)", err, stats)
+		}
+		stats.add(n)
+	}
+	deleted := 0
+	for _, rel := range toDelete {
+		if err := sc.Remove(path.Join(remoteRoot, rel)); err == nil {
+			deleted++
+		}
+	}
+
+	result.WriteString(fmt.Sprintf("Synced %s to %s:%s\n", localRoot, host, remoteRoot))
+	result.WriteString(fmt.Sprintf("Copied %s, %d unchanged", stats, unchanged))
+	if deleteExtra {
+		result.WriteString(fmt.Sprintf(", %d deleted", deleted))
+	}
+	return result.String(), nil
+}
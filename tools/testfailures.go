@@ -0,0 +1,336 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FailedTest is a test that failed, as found in a test command's output.
+type FailedTest struct {
+	// Name is what the test runner calls it, e.g. TestParse,
+	// tests/test_calc.py::test_add or "sum › adds numbers".
+	Name string
+	// File is the test's file and Subject the file of the code it tests,
+	// if one was found, both relative to the directory the tests ran in.
+	File    string
+	Subject string
+	// Command runs just this test, from that directory.
+	Command string
+}
+
+var (
+	goTestFailRe     = regexp.MustCompile(`^--- FAIL: (\S+)`)
+	goTestPackageRe  = regexp.MustCompile(`^(?:FAIL|ok)\s+(\S+)\s`)
+	goTestLocationRe = regexp.MustCompile(`^\s+(\S+_test\.go):(\d+): (.+)$`)
+
+	pytestSectionRe  = regexp.MustCompile(`^_{3,} (.+?) _{3,}$`)
+	pytestSummaryRe  = regexp.MustCompile(`^FAILED (\S+?)(?: - (.+))?$`)
+	pytestLocationRe = regexp.MustCompile(`^(\S+\.py):(\d+): \w+`)
+
+	jestFileRe     = regexp.MustCompile(`^\s*FAIL\s+(\S+)`)
+	jestTestRe     = regexp.MustCompile(`^\s+● (.+)$`)
+	jestSourceRe   = regexp.MustCompile(`^\s*>\s*(\d+) \|`)
+	jestSectionEnd = regexp.MustCompile(`^\s*(?:PASS|FAIL)\s|^Test Suites:`)
+)
+
+// parseFailedTests finds the tests that failed in the output of go test,
+// pytest or jest run in dir, each as an error with only its own output and
+// the command that reruns it alone.
+func parseFailedTests(dir, output string) []ErrorEvent {
+	if tests := parseGoTestFailures(dir, output); len(tests) > 0 {
+		return tests
+	}
+	if tests := parsePytestFailures(dir, output); len(tests) > 0 {
+		return tests
+	}
+	return parseJestFailures(dir, output)
+}
+
+// parseGoTestFailures finds failed tests in go test output, where each
+// --- FAIL line is followed by the test's log and, once a package is
+// done, a FAIL line naming it.
+func parseGoTestFailures(dir, output string) []ErrorEvent {
+	var errors []ErrorEvent
+	module := goModulePath(dir)
+	done := 0 // errors before this have their package
+	var current *strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "FAIL" || line == "PASS" {
+			current = nil
+			continue
+		}
+		if m := goTestFailRe.FindStringSubmatch(line); m != nil {
+			errors = append(errors, ErrorEvent{
+				Type:       "test",
+				Language:   "go",
+				DetectedAt: time.Now(),
+				Test:       &FailedTest{Name: m[1]},
+			})
+			current = &strings.Builder{}
+		}
+		if m := goTestPackageRe.FindStringSubmatch(line); m != nil {
+			pkg := m[1]
+			if m[1] == module {
+				pkg = "."
+			} else if module != "" && strings.HasPrefix(m[1], module+"/") {
+				pkg = "./" + strings.TrimPrefix(m[1], module+"/")
+			}
+			for i := done; i < len(errors); i++ {
+				finishGoTest(&errors[i], dir, pkg)
+			}
+			done = len(errors)
+			current = nil
+			continue
+		}
+		if current != nil {
+			current.WriteString(line + "\n")
+			e := &errors[len(errors)-1]
+			e.FullOutput = current.String()
+			if e.Message != "" {
+				continue
+			}
+			if m := goTestLocationRe.FindStringSubmatch(line); m != nil {
+				e.File = m[1]
+				fmt.Sscanf(m[2], "%d", &e.Line)
+				e.Message = m[3]
+			} else if strings.HasPrefix(line, "panic: ") {
+				e.Message = strings.TrimSuffix(line, " [recovered]")
+			}
+		}
+	}
+
+	for i := done; i < len(errors); i++ {
+		finishGoTest(&errors[i], dir, ".")
+	}
+	return errors
+}
+
+// finishGoTest fills in what is known of e once its package, as a path
+// relative to dir, is.
+func finishGoTest(e *ErrorEvent, dir, pkg string) {
+	test := e.Test
+	test.Command = "go test -run " + shellQuote("^"+regexp.QuoteMeta(test.Name)+"$") + " " + shellQuote(pkg)
+	if e.Message == "" {
+		e.Message = test.Name + " failed"
+	}
+	if e.File != "" {
+		e.File = filepath.Join(pkg, e.File)
+		test.File = e.File
+		subject := strings.TrimSuffix(e.File, "_test.go") + ".go"
+		if _, err := os.Stat(filepath.Join(dir, subject)); err == nil {
+			test.Subject = subject
+		}
+	}
+	e.Message = fmt.Sprintf("%s: %s", test.Name, e.Message)
+}
+
+// testRepairErrors returns the errors in a failed test's own output that
+// are in the test's file or the file it tests, for repairs that should not
+// reach past them. Their paths are made absolute.
+func testRepairErrors(e ErrorEvent) []ErrorEvent {
+	var errors []ErrorEvent
+	for _, te := range parseErrorOutput(e.FullOutput, e.Language) {
+		file := te.File
+		if filepath.IsAbs(file) {
+			if rel, err := filepath.Rel(e.Dir, file); err == nil {
+				file = rel
+			}
+		}
+		file = filepath.Clean(file)
+		if file != e.Test.File && file != e.Test.Subject {
+			continue
+		}
+		te.File, te.Dir, te.Language = filepath.Join(e.Dir, file), e.Dir, e.Language
+		errors = append(errors, te)
+	}
+	return errors
+}
+
+// goModulePath returns the module path declared in dir's go.mod.
+func goModulePath(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// parsePytestFailures finds failed tests in pytest's short test summary,
+// taking their location and output from the section pytest prints for
+// each failure.
+func parsePytestFailures(dir, output string) []ErrorEvent {
+	sections := make(map[string]string)
+	var failed [][]string
+	name := ""
+	var section strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := pytestSectionRe.FindStringSubmatch(line); m != nil {
+			name = m[1]
+			section.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, "===") {
+			name = ""
+		}
+		if m := pytestSummaryRe.FindStringSubmatch(line); m != nil {
+			failed = append(failed, m)
+			continue
+		}
+		if name != "" {
+			section.WriteString(line + "\n")
+			sections[name] = section.String()
+		}
+	}
+
+	var errors []ErrorEvent
+	for _, m := range failed {
+		nodeID, message := m[1], m[2]
+		file, test, _ := strings.Cut(nodeID, "::")
+		out := sections[strings.ReplaceAll(test, "::", ".")]
+		e := ErrorEvent{
+			Type:       "test",
+			File:       file,
+			Message:    message,
+			FullOutput: out,
+			Language:   "python",
+			DetectedAt: time.Now(),
+			Test: &FailedTest{
+				Name:    nodeID,
+				File:    file,
+				Subject: findTestSubject(dir, file),
+				Command: "pytest " + shellQuote(nodeID),
+			},
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if l := pytestLocationRe.FindStringSubmatch(line); l != nil && l[1] == file {
+				fmt.Sscanf(l[2], "%d", &e.Line)
+			}
+			if e.Message == "" && strings.HasPrefix(line, "E ") {
+				e.Message = strings.TrimSpace(line[1:])
+			}
+		}
+		if e.Message == "" {
+			e.Message = "failed"
+		}
+		e.Message = fmt.Sprintf("%s: %s", test, e.Message)
+		errors = append(errors, e)
+	}
+	return errors
+}
+
+// parseJestFailures finds failed tests in jest's output, where a FAIL line
+// names each failing file and a ● line starts each failing test in it.
+// Failures repeated in the summary at the end are left out.
+func parseJestFailures(dir, output string) []ErrorEvent {
+	var errors []ErrorEvent
+	seen := make(map[string]bool)
+	file := ""
+	var current *strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := jestFileRe.FindStringSubmatch(line); m != nil {
+			file = m[1]
+			current = nil
+			continue
+		}
+		if jestSectionEnd.MatchString(line) {
+			current = nil
+			continue
+		}
+		if m := jestTestRe.FindStringSubmatch(line); m != nil && file != "" {
+			name := m[1]
+			if seen[file+"\x00"+name] {
+				current = nil
+				continue
+			}
+			seen[file+"\x00"+name] = true
+			command := "npx jest " + shellQuote(file)
+			if name != "Test suite failed to run" {
+				command += " -t " + shellQuote("^"+regexp.QuoteMeta(strings.ReplaceAll(name, " › ", " "))+"$")
+			}
+			errors = append(errors, ErrorEvent{
+				Type:       "test",
+				File:       file,
+				Language:   "javascript",
+				DetectedAt: time.Now(),
+				Test: &FailedTest{
+					Name:    name,
+					File:    file,
+					Subject: findTestSubject(dir, file),
+					Command: command,
+				},
+			})
+			current = &strings.Builder{}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		current.WriteString(line + "\n")
+		e := &errors[len(errors)-1]
+		e.FullOutput = current.String()
+		if e.Message == "" && strings.TrimSpace(line) != "" {
+			e.Message = fmt.Sprintf("%s: %s", e.Test.Name, strings.TrimSpace(line))
+		}
+		if m := jestSourceRe.FindStringSubmatch(line); m != nil && e.Line == 0 {
+			fmt.Sscanf(m[1], "%d", &e.Line)
+		}
+	}
+
+	for i := range errors {
+		if errors[i].Message == "" {
+			errors[i].Message = errors[i].Test.Name + " failed"
+		}
+	}
+	return errors
+}
+
+// findTestSubject guesses the file whose code a test file tests, such as
+// calc.py for tests/test_calc.py or sum.ts for __tests__/sum.test.ts,
+// looking beside it, in the directory above and in src.
+func findTestSubject(dir, testFile string) string {
+	base := filepath.Base(testFile)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	for _, affix := range []string{".test", ".spec", "_test"} {
+		name = strings.TrimSuffix(name, affix)
+	}
+	name = strings.TrimPrefix(name, "test_")
+	if name == strings.TrimSuffix(base, ext) {
+		return ""
+	}
+
+	exts := []string{ext}
+	switch ext {
+	case ".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs":
+		exts = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"}
+	}
+	testDir := filepath.Dir(testFile)
+	for _, d := range []string{testDir, filepath.Dir(testDir), "src", "."} {
+		for _, ext := range exts {
+			candidate := filepath.Join(d, name+ext)
+			if _, err := os.Stat(filepath.Join(dir, candidate)); err == nil {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	defaultToolTimeout = 60 * time.Second
+	toolTimeouts       = map[string]time.Duration{
+		"wait_for_agent":   11 * time.Minute,
+		"run_pipeline":     time.Hour,
+		"trigger_build":    10 * time.Minute,
+		"lan_scan":         3 * time.Minute,
+		"port_scan":        15 * time.Minute,
+		"fetch_web_docs":   2 * time.Minute,
+		"git_push":         3 * time.Minute,
+		"db_query":         2 * time.Minute,
+		"create_archive":   10 * time.Minute,
+		"extract_archive":  10 * time.Minute,
+		"download_file":    30 * time.Minute,
+		"package_install":  11 * time.Minute,
+		"package_search":   2 * time.Minute,
+		"ssh_session_exec": 5 * time.Minute,
+		"ssh_upload":       30 * time.Minute,
+		"ssh_download":     30 * time.Minute,
+		"ssh_sync":         30 * time.Minute,
+		"ssh_exec_multi":   15 * time.Minute,
+		"wake_on_lan":      11 * time.Minute,
+		"net_speed":        2 * time.Minute,
+		"packet_capture":   3 * time.Minute,
+	}
+	timeoutMu sync.RWMutex
+
+	// approvalsPending pauses tool timeouts while the user is being asked.
+	approvalsPending atomic.Int32
+)
+
+// SetToolTimeouts applies timeouts from config, in seconds. defaultSeconds
+// applies to tools without their own entry; zero values are ignored.
+func SetToolTimeouts(defaultSeconds int, perTool map[string]int) {
+	timeoutMu.Lock()
+	defer timeoutMu.Unlock()
+	if defaultSeconds > 0 {
+		defaultToolTimeout = time.Duration(defaultSeconds) * time.Second
+	}
+	for name, secs := range perTool {
+		if secs > 0 {
+			toolTimeouts[name] = time.Duration(secs) * time.Second
+		}
+	}
+}
+
+// callTimeout is the timeout of one call. ssh_exec on an @group runs its
+// hosts as ssh_exec_multi does, so it gets that tool's time.
+func callTimeout(name string, args map[string]interface{}) time.Duration {
+	if host, _ := args["host"].(string); name == "ssh_exec" && strings.HasPrefix(host, "@") {
+		return toolTimeout("ssh_exec_multi")
+	}
+	return toolTimeout(name)
+}
+
+func toolTimeout(name string) time.Duration {
+	timeoutMu.RLock()
+	defer timeoutMu.RUnlock()
+	if t, ok := toolTimeouts[name]; ok {
+		return t
+	}
+	return defaultToolTimeout
+}
+
+type toolResult struct {
+	output string
+	err    error
+}
+
+// runWithTimeout runs the call to tool name under timeout and returns early when ctx
+// is cancelled. Handlers that honor ctx stop their work; others are abandoned.
+func runWithTimeout(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) (string, error)) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan toolResult, 1)
+	go func() {
+		out, err := fn(ctx)
+		done <- toolResult{out, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case r := <-done:
+			return r.output, r.err
+		case <-ctx.Done():
+			return "", fmt.Errorf("%s cancelled", name)
+		case <-timer.C:
+			if approvalsPending.Load() > 0 {
+				timer.Reset(timeout)
+				continue
+			}
+			return "", fmt.Errorf("%s timed out after %s", name, timeout)
+		}
+	}
+}
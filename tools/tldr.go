@@ -0,0 +1,165 @@
+package tools
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// TLDRArchiveURL is where q docs sync-tldr downloads the tldr pages from:
+// every page of every platform, in one zip.
+const TLDRArchiveURL = "https://github.com/tldr-pages/tldr/releases/latest/download/tldr.zip"
+
+// maxTLDRArchive bounds the size of the archive read, in bytes.
+const maxTLDRArchive = 200 << 20
+
+// tldrPagePath matches the English pages in the archive, as
+// pages/<platform>/<command>.md, or <platform>/<command>.md in the archives
+// of a single language.
+var tldrPagePath = regexp.MustCompile(`^(?:pages/)?([a-z0-9-]+)/([^/]+)\.md$`)
+
+// TLDRDir returns the directory q docs sync-tldr keeps the pages in.
+func TLDRDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".shell-ai", "tldr")
+}
+
+// SyncTLDR replaces the local tldr pages with those in the archive at
+// source, a URL or a zip file already downloaded, and returns how many
+// pages it holds.
+func SyncTLDR(ctx context.Context, source string) (int, error) {
+	archive := source
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		f, err := downloadTLDR(ctx, source)
+		if err != nil {
+			return 0, err
+		}
+		defer os.Remove(f)
+		archive = f
+	}
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return 0, fmt.Errorf("reading the tldr archive: %w", err)
+	}
+	defer r.Close()
+
+	// Unpack beside the old pages, so they stay until the new ones are
+	// all there.
+	dir := TLDRDir()
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".tldr-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+
+	pages := 0
+	for _, f := range r.File {
+		m := tldrPagePath.FindStringSubmatch(f.Name)
+		if m == nil {
+			continue
+		}
+		if err := unpackTLDRPage(f, filepath.Join(tmp, m[1], m[2]+".md")); err != nil {
+			return 0, err
+		}
+		pages++
+	}
+	if pages == 0 {
+		return 0, fmt.Errorf("%s has no tldr pages in it", source)
+	}
+
+	old := dir + ".old"
+	os.RemoveAll(old)
+	if err := os.Rename(dir, old); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.Rename(old, dir)
+		return 0, err
+	}
+	os.RemoveAll(old)
+	return pages, nil
+}
+
+// downloadTLDR saves the archive at url to a temporary file, whose name it
+// returns.
+func downloadTLDR(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("downloading the tldr pages: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading the tldr pages: HTTP %d from %s", resp.StatusCode, url)
+	}
+
+	f, err := os.CreateTemp("", "q-tldr-*.zip")
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, io.LimitReader(resp.Body, maxTLDRArchive+1))
+	f.Close()
+	if err == nil && n > maxTLDRArchive {
+		err = fmt.Errorf("the tldr archive is over %d MB", maxTLDRArchive>>20)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func unpackTLDRPage(f *zip.File, path string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.LimitReader(rc, 1<<20)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// cachedTLDR returns the synced tldr page for name, preferring the pages
+// common to every platform and then those of this one. ok is false if the
+// pages were never synced, in which case they are fetched one at a time.
+func cachedTLDR(name string) (page string, ok bool, err error) {
+	dir := TLDRDir()
+	if _, err := os.Stat(dir); err != nil {
+		return "", false, nil
+	}
+	platform := map[string]string{"darwin": "osx", "solaris": "sunos"}[runtime.GOOS]
+	if platform == "" {
+		platform = runtime.GOOS
+	}
+	// Pages of subcommands are named like git-commit.
+	file := strings.ReplaceAll(filepath.Base(name), " ", "-") + ".md"
+	for _, p := range []string{"common", platform, "linux", "osx"} {
+		if data, err := os.ReadFile(filepath.Join(dir, p, file)); err == nil {
+			return string(data), true, nil
+		}
+	}
+	return "", true, fmt.Errorf("tldr page not found for '%s'", name)
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -35,6 +36,7 @@ type ToolCall struct {
 type BackgroundTask struct {
 	ID        string
 	Command   string
+	Host      string // remote host for ssh_exec background tasks
 	Status    string
 	Output    string
 	Error     string
@@ -51,7 +53,7 @@ var (
 	taskCounter     int
 )
 
-var AvailableTools = []Tool{
+var coreTools = []Tool{
 	{
 		Type: "function",
 		Function: ToolFunction{
@@ -264,12 +266,50 @@ var AvailableTools = []Tool{
 	},
 }
 
-func ExecuteTool(name string, arguments string) (string, error) {
+func init() {
+	for _, t := range coreTools {
+		category := "files"
+		switch name := t.Function.Name; {
+		case strings.HasPrefix(name, "git_"):
+			category = "git"
+		case name == "run_command" || name == "run_background" || strings.HasSuffix(name, "_task") || name == "list_tasks":
+			category = "shell"
+		}
+		RegisterTools(category, t)
+	}
+}
+
+// ExecuteTool runs a tool call under its timeout, passing it through the
+// pre_tool and post_tool hooks. Cancelling ctx abandons the call and stops
+// any command it started.
+func ExecuteTool(ctx context.Context, name string, arguments string) (string, error) {
 	var args map[string]interface{}
 	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
 		return "", fmt.Errorf("invalid arguments: %w", err)
 	}
+	if !ToolEnabled(name) {
+		return "", fmt.Errorf("tool %s is not enabled", name)
+	}
+	if err := checkToolScope(ctx, name); err != nil {
+		return "", err
+	}
+	args, err := preToolHooks(ctx, name, args)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := runWithTimeout(ctx, name, callTimeout(name, args), func(ctx context.Context) (string, error) {
+		return dispatchTool(ctx, name, args)
+	})
+	result = postToolHooks(ctx, name, args, result, err)
+	if err != nil {
+		return result, err
+	}
+	noteToolOutput(name, result)
+	return storeArtifact(name, result), nil
+}
 
+func dispatchTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
 	switch name {
 	case "read_file":
 		return readFile(args)
@@ -278,7 +318,7 @@ func ExecuteTool(name string, arguments string) (string, error) {
 	case "append_file":
 		return appendFile(args)
 	case "run_command":
-		return runCommand(args)
+		return runCommand(ctx, args)
 	case "run_background":
 		return runBackground(args)
 	case "check_task":
@@ -299,8 +339,20 @@ func ExecuteTool(name string, arguments string) (string, error) {
 		return gitDiff(args)
 	case "git_log":
 		return gitLog(args)
+	case "git_add":
+		return gitAdd(args)
+	case "git_commit":
+		return gitCommit(args)
+	case "git_branch":
+		return gitBranch(args)
+	case "git_checkout":
+		return gitCheckout(args)
+	case "git_stash":
+		return gitStash(args)
+	case "git_push":
+		return gitPush(args)
 	case "ssh_exec":
-		return sshExec(args)
+		return sshExec(ctx, args)
 	case "ssh_upload":
 		return sshUpload(args)
 	case "ssh_download":
@@ -308,11 +360,21 @@ func ExecuteTool(name string, arguments string) (string, error) {
 	case "ping_host":
 		return pingHost(args)
 	case "port_scan":
-		return portScan(args)
+		return portScan(ctx, args)
 	case "lan_scan":
 		return lanScan(args)
 	case "wake_on_lan":
-		return wakeOnLan(args)
+		return wakeOnLan(ctx, args)
+	case "ssh_exec_multi":
+		return sshExecMulti(ctx, args)
+	case "net_speed":
+		return netSpeed(ctx, args)
+	case "ssh_ls":
+		return sshLs(args)
+	case "ssh_stat":
+		return sshStat(args)
+	case "packet_capture":
+		return packetCapture(ctx, args)
 	case "ssh_hosts":
 		return sshHosts(args)
 	case "spawn_agent":
@@ -325,10 +387,24 @@ func ExecuteTool(name string, arguments string) (string, error) {
 		return waitForAgent(args)
 	case "cancel_agent":
 		return cancelAgent(args)
+	case "run_pipeline":
+		return runPipeline(ctx, args)
+	case "write_note":
+		return writeNote(ctx, args)
+	case "read_note":
+		return readNote(args)
+	case "ask_user":
+		return askUser(ctx, args)
+	case "send_to_agent":
+		return sendToAgent(ctx, args)
+	case "read_inbox":
+		return readInbox(ctx)
 	case "get_docs":
 		return getDocs(args)
 	case "search_docs":
 		return searchDocs(args)
+	case "ask_docs":
+		return askDocs(args)
 	case "list_docs":
 		return listDocs(args)
 	case "fetch_web_docs":
@@ -344,13 +420,17 @@ func ExecuteTool(name string, arguments string) (string, error) {
 	case "learn_error_pattern":
 		return learnErrorPattern(args)
 	case "recall_knowledge":
-		return recallKnowledge(args)
+		return recallKnowledge(ctx, args)
 	case "recall_facts":
 		return recallFacts(args)
 	case "find_error_solution":
 		return findErrorSolution(args)
 	case "get_related":
 		return getRelated(args)
+	case "explore_knowledge":
+		return exploreKnowledge(args)
+	case "merge_entities":
+		return mergeEntities(args)
 	case "knowledge_summary":
 		return knowledgeSummary(args)
 	case "start_watch":
@@ -361,9 +441,72 @@ func ExecuteTool(name string, arguments string) (string, error) {
 		return watchStatus(args)
 	case "trigger_build":
 		return triggerBuild(args)
+	case "k8s_get":
+		return k8sGet(args)
+	case "k8s_describe":
+		return k8sDescribe(args)
+	case "k8s_logs":
+		return k8sLogs(args)
+	case "k8s_apply":
+		return k8sApply(args)
+	case "k8s_contexts":
+		return k8sContexts(args)
+	case "db_query":
+		return dbQuery(args)
+	case "create_archive":
+		return createArchive(args)
+	case "extract_archive":
+		return extractArchive(args)
+	case "env_vars":
+		return envVars(args)
+	case "analyze_path":
+		return analyzePath(args)
+	case "list_cron":
+		return listCron(args)
+	case "add_cron":
+		return addCron(args)
+	case "remove_cron":
+		return removeCron(args)
+	case "list_issues":
+		return listIssues(args)
+	case "create_issue":
+		return createIssue(args)
+	case "list_prs":
+		return listPRs(args)
+	case "create_pr":
+		return createPR(args)
+	case "get_pr_diff":
+		return getPRDiff(args)
+	case "get_pr_comments":
+		return getPRComments(args)
+	case "ci_status":
+		return ciStatus(args)
 	case "diagnose_error":
 		return diagnoseError(args)
+	case "revert_last_repair":
+		return revertLastRepair(args)
+	case "open_artifact":
+		return openArtifact(args)
+	case "download_file":
+		return downloadFile(ctx, args)
+	case "ssh_sync":
+		return sshSync(args)
+	case "ssh_session_start":
+		return sshSessionStart(args)
+	case "ssh_session_exec":
+		return sshSessionExec(ctx, args)
+	case "ssh_session_close":
+		return sshSessionClose(args)
+	case "package_search":
+		return packageSearch(args)
+	case "package_info":
+		return packageInfo(args)
+	case "package_install":
+		return packageInstall(args)
 	default:
+		if isPlugin(name) {
+			return runPlugin(ctx, name, args)
+		}
 		return "", fmt.Errorf("unknown tool: %s", name)
 	}
 }
@@ -477,7 +620,7 @@ func getFileInfo(args map[string]interface{}) (string, error) {
 	return result.String(), nil
 }
 
-func runCommand(args map[string]interface{}) (string, error) {
+func runCommand(ctx context.Context, args map[string]interface{}) (string, error) {
 	command, ok := args["command"].(string)
 	if !ok {
 		return "", fmt.Errorf("command required")
@@ -488,7 +631,7 @@ func runCommand(args map[string]interface{}) (string, error) {
 		shell = "bash"
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, shell, "-c", command)
@@ -501,6 +644,16 @@ func runCommand(args map[string]interface{}) (string, error) {
 		result += fmt.Sprintf("\n[Exit: %v]", err)
 	}
 
+	// Timeouts and interruptions say nothing about whether the command works.
+	var exitErr *exec.ExitError
+	if ctx.Err() == nil && (err == nil || errors.As(err, &exitErr)) {
+		exitCode := 0
+		if exitErr != nil {
+			exitCode = exitErr.ExitCode()
+		}
+		result += recordCommandOutcome(command, exitCode, string(output))
+	}
+
 	return result, nil
 }
 
@@ -567,8 +720,8 @@ func checkTask(args map[string]interface{}) (string, error) {
 	}
 
 	taskMutex.RLock()
+	defer taskMutex.RUnlock()
 	task, exists := backgroundTasks[taskID]
-	taskMutex.RUnlock()
 
 	if !exists {
 		return "", fmt.Errorf("task %s not found", taskID)
@@ -577,6 +730,9 @@ func checkTask(args map[string]interface{}) (string, error) {
 	var result strings.Builder
 	result.WriteString(fmt.Sprintf("Task: %s\n", task.ID))
 	result.WriteString(fmt.Sprintf("Status: %s\n", task.Status))
+	if task.Host != "" {
+		result.WriteString(fmt.Sprintf("Host: %s\n", task.Host))
+	}
 	result.WriteString(fmt.Sprintf("Command: %s\n", task.Command))
 	result.WriteString(fmt.Sprintf("Started: %s\n", task.StartTime.Format(time.RFC3339)))
 
@@ -591,6 +747,13 @@ func checkTask(args map[string]interface{}) (string, error) {
 		}
 	} else {
 		result.WriteString(fmt.Sprintf("Running for: %s\n", time.Since(task.StartTime)))
+		if task.Output != "" {
+			lines := strings.Split(strings.TrimRight(task.Output, "\n"), "\n")
+			if len(lines) > 50 {
+				lines = lines[len(lines)-50:]
+			}
+			result.WriteString(fmt.Sprintf("\nOutput so far (last %d lines):\n%s\n", len(lines), strings.Join(lines, "\n")))
+		}
 	}
 
 	return result.String(), nil
@@ -611,7 +774,11 @@ func listTasks() (string, error) {
 		if !task.Done {
 			status = fmt.Sprintf("running (%s)", time.Since(task.StartTime).Truncate(time.Second))
 		}
-		result.WriteString(fmt.Sprintf("  %s: %s - %s\n", task.ID, status, truncate(task.Command, 50)))
+		command := truncate(task.Command, 50)
+		if task.Host != "" {
+			command = task.Host + ": " + command
+		}
+		result.WriteString(fmt.Sprintf("  %s: %s - %s\n", task.ID, status, command))
 	}
 
 	return result.String(), nil
@@ -624,12 +791,8 @@ func killTask(args map[string]interface{}) (string, error) {
 	}
 
 	taskMutex.Lock()
+	defer taskMutex.Unlock()
 	task, exists := backgroundTasks[taskID]
-	if exists && !task.Done && task.cancel != nil {
-		task.cancel()
-	}
-	taskMutex.Unlock()
-
 	if !exists {
 		return "", fmt.Errorf("task %s not found", taskID)
 	}
@@ -637,6 +800,9 @@ func killTask(args map[string]interface{}) (string, error) {
 	if task.Done {
 		return fmt.Sprintf("Task %s already finished with status: %s", taskID, task.Status), nil
 	}
+	if task.cancel != nil {
+		task.cancel()
+	}
 
 	return fmt.Sprintf("Task %s killed", taskID), nil
 }
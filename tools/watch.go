@@ -1,25 +1,91 @@
 package tools
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"q/db"
+	"q/types"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 type WatchConfig struct {
-	Patterns         []string
-	BuildCommand     string
-	TestCommand      string
+	// Patterns, BuildCommand and TestCommand describe a single target at
+	// the root of the project. Targets takes precedence over them.
+	Patterns     []string
+	BuildCommand string
+	TestCommand  string
+	LintCommand  string
+	FixCommand   string
+	Targets      []WatchTarget
+	// Ignore lists globs of files and directories not to watch.
+	Ignore   []string
+	Debounce time.Duration
+	// NoAutoRepair only reports errors.
+	NoAutoRepair bool
+	// MaxRepairAttempts is how many times an error is repaired before it
+	// is left alone until the build passes.
+	MaxRepairAttempts int
+	// MaxRepairsPerHour caps repairs across all errors (-1 for no cap),
+	// MaxLoad puts builds off while the load average is above it, and
+	// BuildTimeout bounds each command.
+	MaxRepairsPerHour int
+	MaxLoad           float64
+	BuildTimeout      time.Duration
+	Notify            types.WatchNotifyConfig
+	Hooks             types.WatchHooksConfig
+
+	OnBuildCallback  func(BuildEvent)
 	OnErrorCallback  func(ErrorEvent)
 	OnRepairCallback func(RepairResult)
+	// ConfirmRepairs asks through the approval handler before running a
+	// learned fix command. Installing a missing module always asks.
+	ConfirmRepairs bool
+}
+
+// WatchTarget is a part of the project built and tested on its own, such
+// as the frontend or the backend in a monorepo.
+type WatchTarget struct {
+	// Name labels the target's builds and errors. It defaults to Dir when
+	// there is more than one target.
+	Name string
+	// Dir is the target's directory relative to the project; commands run
+	// there.
+	Dir          string
+	BuildCommand string
+	TestCommand  string
+	// LintCommand runs once the build passes. FixCommand, if set, is the
+	// first repair tried for lint errors, such as eslint --fix.
+	LintCommand string
+	FixCommand  string
+	// Patterns are matched against file names and paths relative to Dir.
+	Patterns []string
+	// Language picks the error parser.
+	Language string
+}
+
+// BuildEvent reports a build or test command starting (Running) or
+// finishing.
+type BuildEvent struct {
+	Target string
+	// Cycle counts the watcher's build cycles; a target's events in the
+	// same cycle belong together.
+	Cycle    int
+	Command  string
+	Running  bool
+	Success  bool
+	Output   string
+	Duration time.Duration
 }
 
 type ErrorEvent struct {
@@ -30,6 +96,13 @@ type ErrorEvent struct {
 	FullOutput string
 	DetectedAt time.Time
 	Language   string
+	// Target is the name of the target whose build found the error, and
+	// Dir the directory its commands ran in.
+	Target string
+	Dir    string
+	// Test is the test that failed, for errors from a test command whose
+	// runner watch mode understands.
+	Test *FailedTest
 }
 
 type RepairResult struct {
@@ -40,17 +113,64 @@ type RepairResult struct {
 	Command  string
 	Output   string
 	Duration time.Duration
+	// Diff is what the repair changed, if anything; revert_last_repair
+	// undoes it.
+	Diff string
+	// PatternID is the learned error pattern whose fix ran, if any.
+	PatternID int64
 }
 
 type Watcher struct {
-	config        WatchConfig
-	ctx           context.Context
-	cancel        context.CancelFunc
-	mu            sync.Mutex
-	running       bool
-	lastBuild     time.Time
+	config WatchConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+	// root is the project directory being watched.
+	root        string
+	mu          sync.Mutex
+	running     bool
+	lastBuild   time.Time
+	lastChange  string
+	watchedDirs int
+	rebuild     chan struct{}
+	cycle       int
+	// pending are the targets with changes since they were last built.
+	pending map[int]bool
+	results []targetResult
+	// project is root's key in the knowledge database, and unverified the
+	// repairs whose target has not been built since.
+	project    string
+	unverified []unverifiedRepair
+	// repairs counts attempts to repair each error, by signature, since
+	// the build last passed, and seen the errors reported since then.
+	repairs       map[string]int
+	seen          map[string]bool
+	failing       bool
 	errorHistory  []ErrorEvent
 	repairHistory []RepairResult
+	// repairTimes are when the repairs of the last hour ran, against
+	// MaxRepairsPerHour.
+	repairTimes []time.Time
+	counters    watchCounters
+}
+
+// unverifiedRepair is a repair that ran, to be checked against the next
+// build of its target.
+type unverifiedRepair struct {
+	target    string
+	signature string
+	// id is the repair's row in the watch history, if it was recorded.
+	id        int64
+	patternID int64
+	// lint is set for repairs of lint errors, which only a build that
+	// gets as far as the linter can verify.
+	lint bool
+}
+
+// targetResult is how a target's last build and tests went.
+type targetResult struct {
+	ran    bool
+	passed bool
+	errors int
 }
 
 var (
@@ -59,7 +179,7 @@ var (
 )
 
 func init() {
-	AvailableTools = append(AvailableTools,
+	RegisterTools("watch",
 		Tool{
 			Type: "function",
 			Function: ToolFunction{
@@ -70,7 +190,26 @@ func init() {
 					"properties": {
 						"build_command": {"type": "string", "description": "Build command to run (auto-detected if not provided)"},
 						"test_command": {"type": "string", "description": "Test command to run"},
-						"patterns": {"type": "array", "items": {"type": "string"}, "description": "File patterns to watch (e.g., *.go, *.py)"}
+						"lint_command": {"type": "string", "description": "Linter to run after a successful build (auto-detected from linter config files if not provided)"},
+						"fix_command": {"type": "string", "description": "Command that fixes lint errors automatically, e.g. eslint --fix ."},
+						"patterns": {"type": "array", "items": {"type": "string"}, "description": "File patterns to watch (e.g., *.go, *.py)"},
+						"targets": {
+							"type": "array",
+							"description": "Parts of a monorepo to build and test separately, instead of the single project set by the other arguments (detected if not provided)",
+							"items": {
+								"type": "object",
+								"properties": {
+									"name": {"type": "string"},
+									"dir": {"type": "string", "description": "Directory relative to the project"},
+									"build_command": {"type": "string"},
+									"test_command": {"type": "string"},
+									"lint_command": {"type": "string"},
+									"fix_command": {"type": "string"},
+									"patterns": {"type": "array", "items": {"type": "string"}}
+								},
+								"required": ["dir"]
+							}
+						}
 					},
 					"additionalProperties": false
 				}`),
@@ -104,7 +243,7 @@ func init() {
 			Type: "function",
 			Function: ToolFunction{
 				Name:        "trigger_build",
-				Description: "Manually trigger a build/test cycle and auto-repair if errors found.",
+				Description: "Manually trigger a build/test cycle, linting if the build passes, and auto-repair if errors found.",
 				Parameters: json.RawMessage(`{
 					"type": "object",
 					"properties": {
@@ -134,78 +273,295 @@ func init() {
 }
 
 func startWatch(args map[string]interface{}) (string, error) {
-	watcherMu.Lock()
-	defer watcherMu.Unlock()
+	config := WatchConfig{}
+	config.BuildCommand, _ = args["build_command"].(string)
+	config.TestCommand, _ = args["test_command"].(string)
+	config.LintCommand, _ = args["lint_command"].(string)
+	config.FixCommand, _ = args["fix_command"].(string)
+	config.Patterns = stringList(args["patterns"])
+	if targets, ok := args["targets"].([]interface{}); ok {
+		for _, t := range targets {
+			if m, ok := t.(map[string]interface{}); ok {
+				target := WatchTarget{Patterns: stringList(m["patterns"])}
+				target.Name, _ = m["name"].(string)
+				target.Dir, _ = m["dir"].(string)
+				target.BuildCommand, _ = m["build_command"].(string)
+				target.TestCommand, _ = m["test_command"].(string)
+				target.LintCommand, _ = m["lint_command"].(string)
+				target.FixCommand, _ = m["fix_command"].(string)
+				config.Targets = append(config.Targets, target)
+			}
+		}
+	}
 
-	if activeWatcher != nil && activeWatcher.running {
+	watcher, err := StartWatcher(config)
+	if err != nil {
 		return "Watcher already running. Use stop_watch first.", nil
 	}
+	config = watcher.config
 
-	config := WatchConfig{}
-
-	if cmd, ok := args["build_command"].(string); ok && cmd != "" {
-		config.BuildCommand = cmd
-	} else {
-		config.BuildCommand = detectBuildCommand()
+	var result strings.Builder
+	result.WriteString("Watch mode started\n")
+	for _, t := range config.Targets {
+		indent := ""
+		if len(config.Targets) > 1 {
+			result.WriteString(fmt.Sprintf("\n%s (%s):\n", t.Name, t.Dir))
+			indent = "  "
+		}
+		result.WriteString(fmt.Sprintf("%sBuild command: %s\n", indent, t.BuildCommand))
+		if t.TestCommand != "" {
+			result.WriteString(fmt.Sprintf("%sTest command: %s\n", indent, t.TestCommand))
+		}
+		if t.LintCommand != "" {
+			result.WriteString(fmt.Sprintf("%sLint command: %s\n", indent, t.LintCommand))
+		}
+		if t.FixCommand != "" {
+			result.WriteString(fmt.Sprintf("%sLint fix command: %s\n", indent, t.FixCommand))
+		}
+		result.WriteString(fmt.Sprintf("%sWatching patterns: %v\n", indent, t.Patterns))
 	}
-
-	if cmd, ok := args["test_command"].(string); ok && cmd != "" {
-		config.TestCommand = cmd
+	if config.NoAutoRepair {
+		result.WriteString("\nErrors will be automatically detected; auto-repair is off.")
 	} else {
-		config.TestCommand = detectTestCommand()
+		result.WriteString("\nErrors will be automatically detected and repairs attempted.")
 	}
 
-	if patterns, ok := args["patterns"].([]interface{}); ok {
-		for _, p := range patterns {
-			if s, ok := p.(string); ok {
-				config.Patterns = append(config.Patterns, s)
-			}
-		}
+	return result.String(), nil
+}
+
+// StartWatcher starts watching the current directory, building whenever
+// watched files change. What config leaves unset comes from the watch:
+// preferences for the directory, and commands and patterns not set there
+// either are detected from the project. Only one watcher runs at a time.
+func StartWatcher(config WatchConfig) (*Watcher, error) {
+	watcherMu.Lock()
+	defer watcherMu.Unlock()
+
+	if activeWatcher != nil && activeWatcher.running {
+		return nil, fmt.Errorf("a watcher is already running")
 	}
 
-	if len(config.Patterns) == 0 {
-		config.Patterns = detectWatchPatterns()
+	root, _ := os.Getwd()
+	prefs := watchPreferencesFor(root)
+	config.Targets = watchTargets(root, config, prefs)
+	config.Ignore = append(config.Ignore, prefs.Ignore...)
+	if config.Debounce == 0 {
+		config.Debounce = time.Duration(prefs.DebounceMs) * time.Millisecond
+	}
+	if config.Debounce <= 0 {
+		config.Debounce = watchDebounce
+	}
+	if prefs.AutoRepair != nil && !*prefs.AutoRepair {
+		config.NoAutoRepair = true
+	}
+	if config.MaxRepairAttempts == 0 {
+		config.MaxRepairAttempts = prefs.MaxRepairAttempts
+	}
+	if config.MaxRepairAttempts <= 0 {
+		config.MaxRepairAttempts = defaultMaxRepairAttempts
+	}
+	if config.MaxRepairsPerHour == 0 {
+		config.MaxRepairsPerHour = prefs.MaxRepairsPerHour
+	}
+	if config.MaxRepairsPerHour == 0 {
+		config.MaxRepairsPerHour = defaultMaxRepairsPerHour
+	}
+	if config.MaxLoad == 0 {
+		config.MaxLoad = prefs.MaxLoad
+	}
+	if config.BuildTimeout == 0 {
+		config.BuildTimeout = time.Duration(prefs.BuildTimeout) * time.Second
+	}
+	if config.BuildTimeout <= 0 {
+		config.BuildTimeout = defaultBuildTimeout
+	}
+	if config.Notify == (types.WatchNotifyConfig{}) {
+		config.Notify = prefs.Notify
+	}
+	if !hasWatchHooks(config.Hooks) {
+		config.Hooks = prefs.Hooks
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	watcher := &Watcher{
-		config: config,
-		ctx:    ctx,
-		cancel: cancel,
+		root:    root,
+		config:  config,
+		ctx:     ctx,
+		cancel:  cancel,
+		rebuild: make(chan struct{}, 1),
+		repairs: make(map[string]int),
+		seen:    make(map[string]bool),
+		pending: make(map[int]bool),
+		project: db.ProjectKey(root),
+		results: make([]targetResult, len(config.Targets)),
+		running: true,
 	}
 
 	activeWatcher = watcher
 	go watcher.run()
+	return watcher, nil
+}
 
-	var result strings.Builder
-	result.WriteString("Watch mode started\n")
-	result.WriteString(fmt.Sprintf("Build command: %s\n", config.BuildCommand))
-	if config.TestCommand != "" {
-		result.WriteString(fmt.Sprintf("Test command: %s\n", config.TestCommand))
+// watchTargets works out what to build in root. Targets given in config
+// win, then a single target given there, then the targets and then the
+// commands from preferences; without any of those, targets are detected.
+// Whatever a target leaves unset is detected from its directory.
+func watchTargets(root string, config WatchConfig, prefs types.WatchConfig) []WatchTarget {
+	single := WatchTarget{Dir: ".", BuildCommand: config.BuildCommand, TestCommand: config.TestCommand,
+		LintCommand: config.LintCommand, FixCommand: config.FixCommand, Patterns: config.Patterns}
+	targets := append([]WatchTarget(nil), config.Targets...)
+	if len(targets) == 0 && single.BuildCommand == "" && single.TestCommand == "" && len(single.Patterns) == 0 {
+		for _, t := range prefs.Targets {
+			targets = append(targets, WatchTarget{Name: t.Name, Dir: t.Dir, BuildCommand: t.BuildCommand, TestCommand: t.TestCommand,
+				LintCommand: t.LintCommand, FixCommand: t.FixCommand, Patterns: t.Patterns, Language: t.Language})
+		}
+		if len(targets) == 0 && prefs.BuildCommand == "" && prefs.TestCommand == "" {
+			targets = detectWatchTargets(root)
+		}
+	}
+	if len(targets) == 0 {
+		if single.BuildCommand == "" {
+			single.BuildCommand = prefs.BuildCommand
+		}
+		if single.TestCommand == "" {
+			single.TestCommand = prefs.TestCommand
+		}
+		if single.LintCommand == "" {
+			single.LintCommand, single.FixCommand = prefs.LintCommand, prefs.FixCommand
+		}
+		if len(single.Patterns) == 0 {
+			single.Patterns = prefs.Patterns
+		}
+		targets = []WatchTarget{single}
 	}
-	result.WriteString(fmt.Sprintf("Watching patterns: %v\n", config.Patterns))
-	result.WriteString("\nErrors will be automatically detected and repairs attempted.")
 
-	return result.String(), nil
+	for i := range targets {
+		t := &targets[i]
+		t.Dir = filepath.Clean(t.Dir)
+		if filepath.IsAbs(t.Dir) {
+			if rel, err := filepath.Rel(root, t.Dir); err == nil {
+				t.Dir = rel
+			}
+		}
+		if t.Name == "" && len(targets) > 1 {
+			t.Name = t.Dir
+		}
+		dir := filepath.Join(root, t.Dir)
+		if t.BuildCommand == "" {
+			t.BuildCommand = detectBuildCommand(dir)
+		}
+		if t.TestCommand == "" {
+			t.TestCommand = detectTestCommand(dir)
+		}
+		if prefs.Lint != nil && !*prefs.Lint {
+			t.LintCommand, t.FixCommand = "", ""
+		} else if t.LintCommand == "" {
+			t.LintCommand, t.FixCommand = detectLintCommand(dir)
+		}
+		if len(t.Patterns) == 0 {
+			t.Patterns = detectWatchPatterns(dir)
+		}
+		if t.Language == "" {
+			t.Language = detectLanguage(dir)
+		}
+	}
+	return targets
+}
+
+// watchTargetDepth is how deep below the project detectWatchTargets looks.
+const watchTargetDepth = 2
+
+// detectWatchTargets finds the projects in root and the directories below
+// it, for monorepos that keep, say, a Go backend and an npm frontend side
+// by side. A directory only becomes a target if it is in a different
+// language from the one it is in, so a workspace's packages are built from
+// its root. It returns nil when root is a single project, or none.
+func detectWatchTargets(root string) []WatchTarget {
+	var targets []WatchTarget
+	languages := make(map[string]string)
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if rel != "." {
+			if skipWatchDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			if strings.Count(rel, string(filepath.Separator)) >= watchTargetDepth {
+				return filepath.SkipDir
+			}
+		}
+		lang := detectLanguage(path)
+		if lang == "unknown" {
+			return nil
+		}
+		for dir := filepath.Dir(rel); rel != "."; dir = filepath.Dir(dir) {
+			if enclosing, ok := languages[dir]; ok {
+				if enclosing == lang {
+					return nil
+				}
+				break
+			}
+			if dir == "." {
+				break
+			}
+		}
+		languages[rel] = lang
+		targets = append(targets, WatchTarget{Dir: rel})
+		return nil
+	})
+	if len(targets) == 1 && targets[0].Dir == "." {
+		return nil
+	}
+	return targets
 }
 
 func stopWatch(args map[string]interface{}) (string, error) {
 	watcherMu.Lock()
-	defer watcherMu.Unlock()
+	w := activeWatcher
+	watcherMu.Unlock()
 
-	if activeWatcher == nil || !activeWatcher.running {
+	if w == nil {
 		return "No watcher running.", nil
 	}
+	w.mu.Lock()
+	running := w.running
+	w.mu.Unlock()
+	if !running {
+		return "No watcher running.", nil
+	}
+	w.Stop()
 
-	activeWatcher.cancel()
-	activeWatcher.running = false
+	w.mu.Lock()
+	repairs := len(w.repairHistory)
+	errors := len(w.errorHistory)
+	w.mu.Unlock()
 
-	repairs := len(activeWatcher.repairHistory)
-	errors := len(activeWatcher.errorHistory)
+	return fmt.Sprintf("Watcher stopped. Detected %d errors, attempted %d repairs during session.", errors, repairs), nil
+}
 
-	activeWatcher = nil
+// Stop stops the watcher. A build in progress runs to completion.
+func (w *Watcher) Stop() {
+	watcherMu.Lock()
+	defer watcherMu.Unlock()
 
-	return fmt.Sprintf("Watcher stopped. Detected %d errors, attempted %d repairs during session.", errors, repairs), nil
+	w.cancel()
+	w.mu.Lock()
+	w.running = false
+	w.mu.Unlock()
+	if activeWatcher == w {
+		activeWatcher = nil
+	}
+}
+
+// Rebuild runs a build cycle as soon as the one in progress, if any,
+// finishes.
+func (w *Watcher) Rebuild() {
+	select {
+	case w.rebuild <- struct{}{}:
+	default:
+	}
 }
 
 func watchStatus(args map[string]interface{}) (string, error) {
@@ -219,9 +575,59 @@ func watchStatus(args map[string]interface{}) (string, error) {
 	var result strings.Builder
 	result.WriteString("Watch Mode Status: ACTIVE\n")
 	result.WriteString("========================\n\n")
-	result.WriteString(fmt.Sprintf("Build command: %s\n", activeWatcher.config.BuildCommand))
-	result.WriteString(fmt.Sprintf("Patterns: %v\n", activeWatcher.config.Patterns))
+	activeWatcher.mu.Lock()
+	targets := activeWatcher.config.Targets
+	if len(targets) == 1 {
+		result.WriteString(fmt.Sprintf("Build command: %s\n", targets[0].BuildCommand))
+		if targets[0].LintCommand != "" {
+			result.WriteString(fmt.Sprintf("Lint command: %s\n", targets[0].LintCommand))
+		}
+		result.WriteString(fmt.Sprintf("Patterns: %v\n", targets[0].Patterns))
+	} else {
+		result.WriteString("Targets:\n")
+		for i, t := range targets {
+			state := "not built yet"
+			if r := activeWatcher.results[i]; r.passed {
+				state = "passing"
+			} else if r.ran {
+				state = fmt.Sprintf("failing, %d error(s)", r.errors)
+			}
+			result.WriteString(fmt.Sprintf("  %s (%s): %s, %s\n", t.Name, t.Dir, t.BuildCommand, state))
+		}
+	}
+	if activeWatcher.config.NoAutoRepair {
+		result.WriteString("Auto-repair: off\n")
+	}
+	if activeWatcher.watchedDirs > 0 {
+		result.WriteString(fmt.Sprintf("Watching: %d directories for changes\n", activeWatcher.watchedDirs))
+	} else {
+		result.WriteString(fmt.Sprintf("Watching: polling every %s for changes\n", watchPollInterval))
+	}
 	result.WriteString(fmt.Sprintf("Last build: %s\n", activeWatcher.lastBuild.Format(time.RFC3339)))
+	if activeWatcher.lastChange != "" {
+		result.WriteString(fmt.Sprintf("Last change: %s\n", activeWatcher.lastChange))
+	}
+	config, counters := activeWatcher.config, activeWatcher.counters
+	result.WriteString(fmt.Sprintf("Build cycles: %d (commands time out after %s)\n", counters.cycles, config.BuildTimeout))
+	if config.MaxLoad > 0 {
+		load := "unknown"
+		if l, ok := loadAverage(); ok {
+			load = fmt.Sprintf("%.2f", l)
+		}
+		result.WriteString(fmt.Sprintf("Load average: %s, builds put off above %.2f: %d\n", load, config.MaxLoad, counters.deferred))
+	}
+	if counters.timeouts > 0 {
+		result.WriteString(fmt.Sprintf("Commands timed out: %d\n", counters.timeouts))
+	}
+	if config.MaxRepairsPerHour > 0 {
+		result.WriteString(fmt.Sprintf("Repairs in the last hour: %d of %d, at most %d per error", activeWatcher.repairsThisHour(),
+			config.MaxRepairsPerHour, config.MaxRepairAttempts))
+		if counters.capped > 0 {
+			result.WriteString(fmt.Sprintf(", %d held back by the cap", counters.capped))
+		}
+		result.WriteString("\n")
+	}
+	activeWatcher.mu.Unlock()
 	result.WriteString(fmt.Sprintf("Errors detected: %d\n", len(activeWatcher.errorHistory)))
 	result.WriteString(fmt.Sprintf("Repairs attempted: %d\n", len(activeWatcher.repairHistory)))
 
@@ -242,7 +648,11 @@ func watchStatus(args map[string]interface{}) (string, error) {
 			start = 0
 		}
 		for _, e := range activeWatcher.errorHistory[start:] {
-			result.WriteString(fmt.Sprintf("  [%s] %s:%d - %s\n", e.Type, e.File, e.Line, truncate(e.Message, 60)))
+			target := ""
+			if e.Target != "" {
+				target = e.Target + ": "
+			}
+			result.WriteString(fmt.Sprintf("  [%s] %s%s:%d - %s\n", e.Type, target, e.File, e.Line, truncate(e.Message, 60)))
 		}
 	}
 
@@ -250,35 +660,133 @@ func watchStatus(args map[string]interface{}) (string, error) {
 }
 
 func triggerBuild(args map[string]interface{}) (string, error) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+
 	command, _ := args["command"].(string)
+	root, _ := os.Getwd()
+	targets := []WatchTarget{{Dir: ".", BuildCommand: command, Language: detectLanguage(root)}}
 	if command == "" {
-		command = detectBuildCommand()
+		targets = watchTargets(root, WatchConfig{}, watchPreferencesFor(root))
 	}
 
-	output, err := runBuildCommand(command)
-	if err != nil {
-		errors := parseErrorOutput(output, detectLanguage())
-		if len(errors) > 0 {
-			var result strings.Builder
-			result.WriteString(fmt.Sprintf("Build failed with %d error(s):\n\n", len(errors)))
-
-			for i, e := range errors {
-				result.WriteString(fmt.Sprintf("%d. [%s] %s:%d\n   %s\n\n", i+1, e.Type, e.File, e.Line, e.Message))
-
-				repairResult := attemptRepair(e)
-				if repairResult.Success {
-					result.WriteString(fmt.Sprintf("   AUTO-REPAIRED: %s\n\n", repairResult.Solution))
-				} else {
-					result.WriteString("   Could not auto-repair. Manual intervention needed.\n\n")
-				}
+	var result strings.Builder
+	changed := false
+	for _, t := range targets {
+		if len(targets) > 1 {
+			result.WriteString(fmt.Sprintf("== %s (%s) ==\n", t.Name, t.BuildCommand))
+		}
+		output, err := runBuildCommand(filepath.Join(root, t.Dir), t.BuildCommand)
+		if err == nil {
+			result.WriteString(fmt.Sprintf("Build successful:\n%s\n", output))
+			if t.LintCommand != "" {
+				changed = triggerLint(root, t, &result) || changed
 			}
+			continue
+		}
+		errors := targetErrors(root, t, output)
+		if len(errors) == 0 {
+			result.WriteString(fmt.Sprintf("Build failed:\n%s\n", output))
+			continue
+		}
+		result.WriteString(fmt.Sprintf("Build failed with %d error(s):\n\n", len(errors)))
+		for i, e := range errors {
+			result.WriteString(fmt.Sprintf("%d. [%s] %s:%d\n   %s\n\n", i+1, e.Type, e.File, e.Line, e.Message))
 
-			return result.String(), nil
+			repairResult := attemptRepair(e, false)
+			changed = changed || repairResult.Diff != ""
+			if repairResult.Success {
+				result.WriteString(fmt.Sprintf("   AUTO-REPAIRED: %s\n\n", repairResult.Solution))
+			} else {
+				result.WriteString("   Could not auto-repair. Manual intervention needed.\n\n")
+			}
 		}
-		return fmt.Sprintf("Build failed:\n%s", output), nil
 	}
+	if changed {
+		result.WriteString("Undo the last repair with revert_last_repair.\n")
+	}
+
+	return strings.TrimRight(result.String(), "\n") + "\n", nil
+}
 
-	return fmt.Sprintf("Build successful:\n%s", output), nil
+// triggerLint runs t's linter for trigger_build, then its fix command if
+// there are errors, and describes the errors left in result. It reports
+// whether the fix command changed any files.
+func triggerLint(root string, t WatchTarget, result *strings.Builder) bool {
+	dir := filepath.Join(root, t.Dir)
+	output, err := runBuildCommand(dir, t.LintCommand)
+	if err == nil {
+		result.WriteString("Lint passed.\n")
+		return false
+	}
+	errors := targetLintErrors(root, t, output)
+	changed := false
+	if len(errors) > 0 && t.FixCommand != "" {
+		repair := runFixCommand(root, t, errors, false)
+		changed = repair.Diff != ""
+		if repair.Success {
+			result.WriteString(fmt.Sprintf("AUTO-REPAIRED: ran %s for %d lint error(s)\n", t.FixCommand, len(errors)))
+			if output, err = runBuildCommand(dir, t.LintCommand); err == nil {
+				result.WriteString("Lint passed.\n")
+				return changed
+			}
+			errors = targetLintErrors(root, t, output)
+		}
+	}
+	if len(errors) == 0 {
+		result.WriteString(fmt.Sprintf("Lint failed:\n%s\n", output))
+		return changed
+	}
+	result.WriteString(fmt.Sprintf("Lint failed with %d error(s):\n\n", len(errors)))
+	for i, e := range errors {
+		result.WriteString(fmt.Sprintf("%d. [%s] %s:%d\n   %s\n\n", i+1, e.Type, e.File, e.Line, e.Message))
+	}
+	return changed
+}
+
+// targetErrors parses the errors in the output of one of t's build or test
+// commands, making their file paths relative to root.
+func targetErrors(root string, t WatchTarget, output string) []ErrorEvent {
+	return inTarget(root, t, parseErrorOutput(output, t.Language))
+}
+
+// targetLintErrors parses the errors in the output of t's linter, making
+// their file paths relative to root.
+func targetLintErrors(root string, t WatchTarget, output string) []ErrorEvent {
+	errors := parseLintOutput(output)
+	for i := range errors {
+		errors[i].Language = t.Language
+	}
+	return inTarget(root, t, errors)
+}
+
+// targetTestErrors finds the failed tests in the output of t's test
+// command, or failing that, the errors in it.
+func targetTestErrors(root string, t WatchTarget, output string) []ErrorEvent {
+	errors := parseFailedTests(filepath.Join(root, t.Dir), output)
+	if len(errors) == 0 {
+		errors = parseErrorOutput(output, t.Language)
+		for i := range errors {
+			errors[i].Type = "test"
+		}
+	}
+	return inTarget(root, t, errors)
+}
+
+// inTarget attributes errors found by t's commands to it.
+func inTarget(root string, t WatchTarget, errors []ErrorEvent) []ErrorEvent {
+	for i := range errors {
+		errors[i].Target = t.Name
+		errors[i].Dir = filepath.Join(root, t.Dir)
+		if file := errors[i].File; filepath.IsAbs(file) {
+			if rel, err := filepath.Rel(root, file); err == nil && !strings.HasPrefix(rel, "..") {
+				errors[i].File = rel
+			}
+		} else if file != "" {
+			errors[i].File = filepath.Join(t.Dir, file)
+		}
+	}
+	return errors
 }
 
 func diagnoseError(args map[string]interface{}) (string, error) {
@@ -289,7 +797,11 @@ func diagnoseError(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("error_text is required")
 	}
 
-	errors := parseErrorOutput(errorText, detectLanguage())
+	cwd, _ := os.Getwd()
+	errors := parseFailedTests(cwd, errorText)
+	if len(errors) == 0 {
+		errors = parseErrorOutput(errorText, detectLanguage(cwd))
+	}
 	if len(errors) == 0 {
 		errors = append(errors, ErrorEvent{
 			Type:    "unknown",
@@ -300,12 +812,19 @@ func diagnoseError(args map[string]interface{}) (string, error) {
 	var result strings.Builder
 	result.WriteString(fmt.Sprintf("Diagnosed %d error(s):\n\n", len(errors)))
 
+	changed := false
 	for i, e := range errors {
 		result.WriteString(fmt.Sprintf("%d. Type: %s\n", i+1, e.Type))
 		if e.File != "" {
 			result.WriteString(fmt.Sprintf("   File: %s:%d\n", e.File, e.Line))
 		}
 		result.WriteString(fmt.Sprintf("   Message: %s\n", e.Message))
+		if e.Test != nil {
+			if e.Test.Subject != "" {
+				result.WriteString(fmt.Sprintf("   Code under test: %s\n", e.Test.Subject))
+			}
+			result.WriteString(fmt.Sprintf("   Rerun just this test: %s\n", e.Test.Command))
+		}
 
 		if knowledgeDB != nil {
 			patterns, err := knowledgeDB.FindMatchingErrorPatterns(e.Message, getCurrentProjectPath(), 3)
@@ -318,9 +837,17 @@ func diagnoseError(args map[string]interface{}) (string, error) {
 		}
 
 		if autoRepair {
-			repairResult := attemptRepair(e)
+			repairResult := attemptRepair(e, false)
+			changed = changed || repairResult.Diff != ""
 			if repairResult.Success {
 				result.WriteString(fmt.Sprintf("\n   AUTO-REPAIRED: %s\n", repairResult.Solution))
+				if e.Test != nil {
+					if _, err := runBuildCommand(e.Dir, e.Test.Command); err == nil {
+						result.WriteString("   The test passes now.\n")
+					} else {
+						result.WriteString("   The test still fails.\n")
+					}
+				}
 			} else {
 				result.WriteString("\n   Auto-repair failed or no solution found.\n")
 			}
@@ -328,318 +855,862 @@ func diagnoseError(args map[string]interface{}) (string, error) {
 
 		result.WriteString("\n")
 	}
+	if changed {
+		result.WriteString("Undo the last repair with revert_last_repair.\n")
+	}
 
 	return result.String(), nil
 }
 
-func (w *Watcher) run() {
-	w.mu.Lock()
-	w.running = true
-	w.mu.Unlock()
+// watchDebounce is how long the watcher waits by default after a change
+// for others to follow, so that saving several files, or an editor's
+// write-rename-chmod dance, rebuilds once.
+const watchDebounce = 300 * time.Millisecond
 
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// watchPollInterval is how often the watcher looks for changes when the
+// platform cannot notify it of them.
+const watchPollInterval = 5 * time.Second
 
-	w.runBuildCycle()
+// watchBuildSettle is how long after a build the watcher goes on ignoring
+// changes, for notifications of the build's own writes still on their way.
+const watchBuildSettle = 200 * time.Millisecond
+
+// run builds once, then again whenever watched files change. Changes made
+// while a build runs are ignored: with a pattern like * they include the
+// build's own output, which would set off the next build, and so on. Files
+// a repair changed are rebuilt anyway, as repairs mark their target.
+func (w *Watcher) run() {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.runBuildCycle(w.allTargets())
+		w.poll()
+		return
+	}
+	defer fsw.Close()
+	w.addDirs(fsw, w.root)
+
+	debounce := time.NewTimer(w.config.Debounce)
+	debounce.Stop()
+	var quiet time.Time
+	build := func(targets []int) {
+		w.runBuildCycle(targets)
+		quiet = time.Now().Add(watchBuildSettle)
+		if len(w.pendingTargets()) > 0 {
+			debounce.Reset(w.config.Debounce)
+		}
+	}
+	build(w.allTargets())
 
 	for {
 		select {
 		case <-w.ctx.Done():
 			return
-		case <-ticker.C:
-			if w.hasFileChanges() {
-				w.runBuildCycle()
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					w.addDirs(fsw, ev.Name)
+					continue
+				}
+			}
+			if ev.Op == fsnotify.Chmod || time.Now().Before(quiet) {
+				continue
+			}
+			target := w.targetFor(ev.Name)
+			if target < 0 {
+				continue
+			}
+			w.mu.Lock()
+			w.lastChange = ev.Name
+			w.pending[target] = true
+			w.mu.Unlock()
+			debounce.Reset(w.config.Debounce)
+		case <-fsw.Errors:
+			// An overflowed queue loses events, so rebuild to be safe.
+			w.mu.Lock()
+			for _, i := range w.allTargets() {
+				w.pending[i] = true
+			}
+			w.mu.Unlock()
+			debounce.Reset(w.config.Debounce)
+		case <-debounce.C:
+			// Changes stay pending while the machine is busy.
+			if w.overloaded() {
+				debounce.Reset(watchLoadRetry)
+				continue
 			}
+			targets := w.pendingTargets()
+			w.mu.Lock()
+			clear(w.pending)
+			w.mu.Unlock()
+			build(targets)
+		case <-w.rebuild:
+			debounce.Stop()
+			w.mu.Lock()
+			clear(w.pending)
+			w.mu.Unlock()
+			build(w.allTargets())
 		}
 	}
 }
 
-func (w *Watcher) hasFileChanges() bool {
-	return true
-}
-
-func (w *Watcher) runBuildCycle() {
+// pendingTargets returns the indexes of the targets with changes since they
+// were last built.
+func (w *Watcher) pendingTargets() []int {
 	w.mu.Lock()
-	w.lastBuild = time.Now()
-	w.mu.Unlock()
+	defer w.mu.Unlock()
+	var targets []int
+	for _, i := range w.allTargets() {
+		if w.pending[i] {
+			targets = append(targets, i)
+		}
+	}
+	return targets
+}
 
-	output, err := runBuildCommand(w.config.BuildCommand)
-	if err != nil {
-		errors := parseErrorOutput(output, detectLanguage())
-		for _, e := range errors {
-			w.mu.Lock()
-			w.errorHistory = append(w.errorHistory, e)
-			w.mu.Unlock()
+// poll rebuilds whenever a watched file's modification time moves on, for
+// when file system notifications are unavailable.
+func (w *Watcher) poll() {
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
 
-			if w.config.OnErrorCallback != nil {
-				w.config.OnErrorCallback(e)
+	last := w.latestChange()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if w.overloaded() {
+				continue
+			}
+			// What changed during a build, the build's output included,
+			// does not count as a change.
+			if latest := w.latestChange(); latest.After(last) || len(w.pendingTargets()) > 0 {
+				w.mu.Lock()
+				clear(w.pending)
+				w.mu.Unlock()
+				w.runBuildCycle(w.allTargets())
+				last = w.latestChange()
 			}
+		case <-w.rebuild:
+			w.runBuildCycle(w.allTargets())
+			last = w.latestChange()
+		}
+	}
+}
 
-			result := attemptRepair(e)
+// addDirs watches dir and the directories under it, except those search
+// skips, such as .git and node_modules.
+func (w *Watcher) addDirs(fsw *fsnotify.Watcher, dir string) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != w.root && w.skipDir(path) {
+			return filepath.SkipDir
+		}
+		if fsw.Add(path) == nil {
 			w.mu.Lock()
-			w.repairHistory = append(w.repairHistory, result)
+			w.watchedDirs++
 			w.mu.Unlock()
-
-			if w.config.OnRepairCallback != nil {
-				w.config.OnRepairCallback(result)
-			}
 		}
-	}
+		return nil
+	})
+}
 
-	if w.config.TestCommand != "" {
-		output, err := runBuildCommand(w.config.TestCommand)
+// latestChange returns when a watched file last changed.
+func (w *Watcher) latestChange() time.Time {
+	var latest time.Time
+	filepath.WalkDir(w.root, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
-			errors := parseErrorOutput(output, detectLanguage())
-			for _, e := range errors {
-				e.Type = "test"
-				w.mu.Lock()
-				w.errorHistory = append(w.errorHistory, e)
-				w.mu.Unlock()
+			return nil
+		}
+		if d.IsDir() {
+			if path != w.root && w.skipDir(path) {
+				return filepath.SkipDir
 			}
+			return nil
 		}
-	}
+		if w.targetFor(path) < 0 {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
 }
 
-func runBuildCommand(command string) (string, error) {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "bash"
+// allTargets returns the indexes of every target.
+func (w *Watcher) allTargets() []int {
+	all := make([]int, len(w.config.Targets))
+	for i := range all {
+		all[i] = i
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, shell, "-c", command)
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+	return all
 }
 
-func detectBuildCommand() string {
-	cwd, _ := os.Getwd()
+// targetFor returns the index of the target a change to path should
+// rebuild, or -1 if none: the innermost target path is in, if it matches
+// one of that target's patterns by file name or by path relative to the
+// target, and neither it nor a directory it is in is skipped or ignored.
+func (w *Watcher) targetFor(path string) int {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return -1
+	}
+	dirs := strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/")
+	for _, d := range dirs {
+		if d != "." && skipWatchDir(d) {
+			return -1
+		}
+	}
+	if w.ignored(rel) {
+		return -1
+	}
 
-	if _, err := os.Stat(filepath.Join(cwd, "go.mod")); err == nil {
-		return "go build ./..."
+	best := -1
+	for i, t := range w.config.Targets {
+		if t.Dir != "." && !strings.HasPrefix(rel, t.Dir+string(filepath.Separator)) {
+			continue
+		}
+		if best < 0 || len(t.Dir) > len(w.config.Targets[best].Dir) || w.config.Targets[best].Dir == "." {
+			best = i
+		}
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "Cargo.toml")); err == nil {
-		return "cargo build"
+	if best < 0 {
+		return -1
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "package.json")); err == nil {
-		if _, err := os.Stat(filepath.Join(cwd, "node_modules", ".bin", "tsc")); err == nil {
-			return "npx tsc --noEmit"
+	inTarget, _ := filepath.Rel(w.config.Targets[best].Dir, rel)
+	for _, p := range w.config.Targets[best].Patterns {
+		if ok, _ := filepath.Match(p, filepath.Base(path)); ok {
+			return best
+		}
+		if ok, _ := filepath.Match(p, filepath.ToSlash(inTarget)); ok {
+			return best
 		}
-		return "npm run build"
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "requirements.txt")); err == nil {
-		return "python -m py_compile *.py"
+	return -1
+}
+
+// skipDir reports whether the watcher leaves out the directory at path.
+func (w *Watcher) skipDir(path string) bool {
+	if skipWatchDir(filepath.Base(path)) {
+		return true
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "Makefile")); err == nil {
-		return "make"
+	rel, err := filepath.Rel(w.root, path)
+	return err == nil && w.ignored(rel)
+}
+
+// ignored reports whether rel, a path relative to the project, or a
+// directory it is in matches an Ignore glob, by name or by path.
+func (w *Watcher) ignored(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		for _, glob := range w.config.Ignore {
+			glob = strings.TrimSuffix(filepath.ToSlash(glob), "/")
+			if ok, _ := path.Match(glob, part); ok {
+				return true
+			}
+			if ok, _ := path.Match(glob, prefix); ok {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	return "echo 'No build command detected'"
+// skipWatchDir reports whether the watcher ignores a directory: the ones
+// search skips, hidden ones, and the build output of Rust and .NET.
+func skipWatchDir(name string) bool {
+	return skipDirs[name] || strings.HasPrefix(name, ".") || name == "target" || name == "bin" || name == "obj"
 }
 
-func detectTestCommand() string {
-	cwd, _ := os.Getwd()
+// runBuildCycle builds and tests the given targets, one after another,
+// once no other build is running.
+func (w *Watcher) runBuildCycle(targets []int) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
 
-	if _, err := os.Stat(filepath.Join(cwd, "go.mod")); err == nil {
-		return "go test ./..."
+	w.mu.Lock()
+	w.lastBuild = time.Now()
+	w.cycle++
+	cycle := w.cycle
+	w.counters.cycles++
+	w.mu.Unlock()
+
+	for _, i := range targets {
+		w.buildTarget(i, cycle)
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "Cargo.toml")); err == nil {
-		return "cargo test"
+
+	w.mu.Lock()
+	passed := true
+	for _, r := range w.results {
+		if r.ran && !r.passed {
+			passed = false
+		}
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "package.json")); err == nil {
-		return "npm test"
+	recovered := passed && w.failing
+	w.failing = !passed
+	if passed {
+		clear(w.repairs)
+		clear(w.seen)
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "pytest.ini")); err == nil {
-		return "pytest"
+	w.mu.Unlock()
+	if recovered {
+		if w.config.Notify.Recovered {
+			notify(w.config.Notify, "Watch mode", "The build passes again")
+		}
+		w.hookOnGreen()
 	}
-
-	return ""
 }
 
-func detectWatchPatterns() []string {
-	cwd, _ := os.Getwd()
-
-	if _, err := os.Stat(filepath.Join(cwd, "go.mod")); err == nil {
-		return []string{"*.go"}
+// buildTarget runs a target's build, its linter if the build passes, and
+// whether or not it does, its tests, repairing build and lint errors.
+// Errors and repairs go into the watch history, where errors the target no
+// longer has are marked resolved.
+func (w *Watcher) buildTarget(i int, cycle int) {
+	t := w.config.Targets[i]
+	verify := w.takeUnverified(t.Name)
+	result := targetResult{ran: true, passed: true}
+	// Without knowing a failed command's errors, nothing can be said about
+	// which were resolved or repaired.
+	unrecognized := false
+	var current []int64
+	// repaired is set when a repair changed files, which the watcher does
+	// not notice during a build.
+	repaired := false
+
+	output, err := w.runCommand(t, t.BuildCommand, cycle)
+	var errors []ErrorEvent
+	if err != nil {
+		result.passed = false
+		errors = targetErrors(w.root, t, output)
+		unrecognized = len(errors) == 0
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "Cargo.toml")); err == nil {
-		return []string{"*.rs"}
+	result.errors += len(errors)
+	for _, e := range errors {
+		id := w.report(e)
+		current = append(current, id)
+		repaired = w.repair(e, id) || repaired
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "package.json")); err == nil {
-		return []string{"*.js", "*.ts", "*.jsx", "*.tsx"}
+
+	linted := result.passed && t.LintCommand != ""
+	if linted {
+		lintErrors, ids, failed := w.lint(t, cycle)
+		if failed {
+			result.passed = false
+			unrecognized = unrecognized || len(lintErrors) == 0
+		}
+		result.errors += len(lintErrors)
+		current = append(current, ids...)
+		for i, e := range lintErrors {
+			repaired = w.repair(e, ids[i]) || repaired
+		}
+		errors = append(errors, lintErrors...)
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "requirements.txt")); err == nil {
-		return []string{"*.py"}
+
+	if unrecognized {
+		w.mu.Lock()
+		w.unverified = append(w.unverified, verify...)
+		w.mu.Unlock()
+	} else {
+		w.verifyRepairs(verify, errors, linted)
 	}
 
-	return []string{"*"}
+	if t.TestCommand != "" {
+		output, err := w.runCommand(t, t.TestCommand, cycle)
+		if err != nil {
+			result.passed = false
+			errors := targetTestErrors(w.root, t, output)
+			unrecognized = unrecognized || len(errors) == 0
+			result.errors += len(errors)
+			for _, e := range errors {
+				id := w.report(e)
+				current = append(current, id)
+				if e.Test != nil {
+					repaired = w.repair(e, id) || repaired
+				}
+			}
+		}
+	}
+
+	w.mu.Lock()
+	w.results[i] = result
+	if repaired {
+		w.pending[i] = true
+	}
+	w.mu.Unlock()
+	if knowledgeDB != nil && !unrecognized {
+		knowledgeDB.ResolveWatchErrors(w.project, t.Name, current)
+	}
 }
 
-func detectLanguage() string {
-	cwd, _ := os.Getwd()
+// lint runs t's linter and reports the errors it finds. When errors turn
+// up that t's fix command has not been tried on, it is run first to fix
+// what it can, and the linter runs again. lint returns the errors left,
+// their IDs in the watch history, and whether the linter still failed.
+func (w *Watcher) lint(t WatchTarget, cycle int) ([]ErrorEvent, []int64, bool) {
+	output, err := w.runCommand(t, t.LintCommand, cycle)
+	if err == nil {
+		return nil, nil, false
+	}
+	errors := targetLintErrors(w.root, t, output)
+	ids := make(map[string]int64)
+	for _, e := range errors {
+		ids[db.NormalizeErrorSignature(e.Message)] = w.report(e)
+	}
 
-	if _, err := os.Stat(filepath.Join(cwd, "go.mod")); err == nil {
-		return "go"
+	var fresh []string
+	if t.FixCommand != "" && !w.config.NoAutoRepair {
+		w.mu.Lock()
+		for _, e := range errors {
+			key := "fix:" + db.NormalizeErrorSignature(e.Message)
+			if w.repairs[key] == 0 {
+				fresh = append(fresh, key)
+			}
+			w.repairs[key]++
+		}
+		w.mu.Unlock()
+	}
+	if len(fresh) > 0 && !w.spendRepairBudget() {
+		// The fix command is tried on these errors once the budget allows.
+		w.mu.Lock()
+		for _, key := range fresh {
+			w.repairs[key] = 0
+		}
+		w.mu.Unlock()
+		fresh = nil
+	}
+	if len(fresh) > 0 {
+		repair := runFixCommand(w.root, t, errors, w.config.ConfirmRepairs)
+		if repair.Attempts > 0 {
+			output, err = w.runCommand(t, t.LintCommand, cycle)
+			var remaining []ErrorEvent
+			if err != nil {
+				remaining = targetLintErrors(w.root, t, output)
+			}
+			left := make(map[string]bool)
+			for _, e := range remaining {
+				left[db.NormalizeErrorSignature(e.Message)] = true
+			}
+			// Whether the fix command worked is known at once.
+			for _, e := range errors {
+				signature := db.NormalizeErrorSignature(e.Message)
+				fixed := !left[signature]
+				w.recordRepair(ids[signature], repair, &fixed)
+			}
+			w.reportRepair(repair)
+			errors = remaining
+		}
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "Cargo.toml")); err == nil {
-		return "rust"
+
+	current := make([]int64, len(errors))
+	for i, e := range errors {
+		id, ok := ids[db.NormalizeErrorSignature(e.Message)]
+		if !ok {
+			id = w.report(e)
+		}
+		current[i] = id
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "package.json")); err == nil {
-		return "javascript"
+	return errors, current, err != nil
+}
+
+// runFixCommand runs t's fix command for the lint errors its linter found,
+// checkpointing the working tree first like any other repair.
+func runFixCommand(root string, t WatchTarget, errors []ErrorEvent, confirm bool) RepairResult {
+	e := errors[0]
+	if len(errors) > 1 {
+		e = ErrorEvent{Type: "lint", Message: fmt.Sprintf("%d lint errors", len(errors)), DetectedAt: time.Now(),
+			Language: t.Language, Target: t.Name, Dir: filepath.Join(root, t.Dir)}
 	}
-	if _, err := os.Stat(filepath.Join(cwd, "requirements.txt")); err == nil {
-		return "python"
+	result := RepairResult{Error: e, Solution: "Ran the linter's fix command", Command: t.FixCommand}
+	if confirm && requireApproval("watch", fmt.Sprintf("run %s to fix %s", t.FixCommand, truncate(e.Message, 80))) != nil {
+		return result
 	}
 
-	return "unknown"
+	start := time.Now()
+	before := snapshotWorkingTree("", "shell-ai checkpoint")
+	result.Attempts = 1
+	output, err := runBuildCommand(filepath.Join(root, t.Dir), t.FixCommand)
+	result.Output = output
+	if before != "" {
+		result.Diff = saveRepairCheckpoint(before, e, t.FixCommand)
+	}
+	// Fix commands fail when they leave errors they cannot fix.
+	result.Success = err == nil || result.Diff != ""
+	result.Duration = time.Since(start)
+	return result
 }
 
-func parseErrorOutput(output string, language string) []ErrorEvent {
-	var errors []ErrorEvent
+// report adds an error to the watch history and passes it on to
+// OnErrorCallback, and to the on_error hooks if it is new since the build
+// last passed. It returns the error's ID in the history.
+func (w *Watcher) report(e ErrorEvent) int64 {
+	id := w.record(e)
+	key := e.Target + "\x00" + db.NormalizeErrorSignature(e.Message)
+	w.mu.Lock()
+	w.errorHistory = append(w.errorHistory, e)
+	seen := w.seen[key]
+	w.seen[key] = true
+	w.mu.Unlock()
 
-	switch language {
-	case "go":
-		errors = parseGoErrors(output)
-	case "rust":
-		errors = parseRustErrors(output)
-	case "javascript", "typescript":
-		errors = parseJSErrors(output)
-	case "python":
-		errors = parsePythonErrors(output)
-	default:
-		errors = parseGenericErrors(output)
+	if w.config.OnErrorCallback != nil {
+		w.config.OnErrorCallback(e)
 	}
+	if !seen {
+		w.hookOnError(e)
+	}
+	return id
+}
 
-	return errors
+// reportRepair adds a repair to the repair history and passes it on to
+// OnRepairCallback and the on_repair hooks.
+func (w *Watcher) reportRepair(r RepairResult) {
+	w.mu.Lock()
+	w.repairHistory = append(w.repairHistory, r)
+	w.mu.Unlock()
+
+	if w.config.OnRepairCallback != nil {
+		w.config.OnRepairCallback(r)
+	}
+	w.hookOnRepair(r)
 }
 
-func parseGoErrors(output string) []ErrorEvent {
-	var errors []ErrorEvent
+// record adds an error to the watch history, returning its ID there, or 0
+// if it could not be.
+func (w *Watcher) record(e ErrorEvent) int64 {
+	if knowledgeDB == nil {
+		return 0
+	}
+	id, err := knowledgeDB.RecordWatchError(w.project, e.Target, e.Type, e.Language, e.File, e.Line, e.Message)
+	if err != nil {
+		return 0
+	}
+	return id
+}
 
-	goErrorRe := regexp.MustCompile(`^(.+\.go):(\d+):(\d+):\s*(.+)$`)
-	scanner := bufio.NewScanner(strings.NewReader(output))
+// recordRepair adds a repair of the error with errorID to the watch
+// history, with whether the error is gone if that is known yet, returning
+// its ID there, or 0 if it could not be.
+func (w *Watcher) recordRepair(errorID int64, r RepairResult, fixed *bool) int64 {
+	if knowledgeDB == nil || errorID == 0 {
+		return 0
+	}
+	repair := db.WatchRepair{ErrorID: errorID, PatternID: r.PatternID, Success: r.Success,
+		Solution: r.Solution, Command: r.Command, Diff: r.Diff, Duration: r.Duration, Fixed: fixed}
+	if !r.Success {
+		failed := false
+		repair.Fixed = &failed
+	}
+	if knowledgeDB.RecordWatchRepair(&repair) != nil {
+		return 0
+	}
+	return repair.ID
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		matches := goErrorRe.FindStringSubmatch(line)
-		if len(matches) == 5 {
-			lineNum := 0
-			fmt.Sscanf(matches[2], "%d", &lineNum)
-			errors = append(errors, ErrorEvent{
-				Type:       "compile",
-				File:       matches[1],
-				Line:       lineNum,
-				Message:    matches[4],
-				Language:   "go",
-				DetectedAt: time.Now(),
-			})
+// takeUnverified returns the repairs made since target was last built,
+// to be checked against the errors its build has now.
+func (w *Watcher) takeUnverified(target string) []unverifiedRepair {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var taken []unverifiedRepair
+	kept := w.unverified[:0]
+	for _, r := range w.unverified {
+		if r.target == target {
+			taken = append(taken, r)
+		} else {
+			kept = append(kept, r)
 		}
 	}
+	w.unverified = kept
+	return taken
+}
 
-	return errors
+// verifyRepairs checks repairs against the errors a build of their target
+// has now. A learned fix only counts as having worked if its error is
+// gone. Repairs of lint errors wait for the linter to run again.
+func (w *Watcher) verifyRepairs(repairs []unverifiedRepair, errors []ErrorEvent, linted bool) {
+	remaining := make(map[string]bool)
+	for _, e := range errors {
+		remaining[db.NormalizeErrorSignature(e.Message)] = true
+	}
+	for _, r := range repairs {
+		if r.lint && !linted {
+			w.mu.Lock()
+			w.unverified = append(w.unverified, r)
+			w.mu.Unlock()
+			continue
+		}
+		if knowledgeDB == nil {
+			continue
+		}
+		fixed := !remaining[r.signature]
+		if r.id != 0 {
+			knowledgeDB.SetWatchRepairFixed(r.id, fixed)
+		}
+		if r.patternID != 0 {
+			knowledgeDB.RecordErrorPatternResult(r.patternID, fixed)
+		}
+	}
 }
 
-func parseRustErrors(output string) []ErrorEvent {
-	var errors []ErrorEvent
+// repair attempts to repair a build or lint error, recorded in the watch history
+// as errorID, up to MaxRepairAttempts times while it keeps coming back,
+// and tells the user the first time one cannot be repaired. It reports
+// whether the repair changed any files.
+func (w *Watcher) repair(e ErrorEvent, errorID int64) bool {
+	key := db.NormalizeErrorSignature(e.Message)
+	w.mu.Lock()
+	w.repairs[key]++
+	attempt := w.repairs[key]
+	w.mu.Unlock()
 
-	rustErrorRe := regexp.MustCompile(`error\[E\d+\]:\s*(.+)\n\s*-->\s*(.+):(\d+):(\d+)`)
-	matches := rustErrorRe.FindAllStringSubmatch(output, -1)
+	if !w.config.NoAutoRepair && attempt <= w.config.MaxRepairAttempts && !w.spendRepairBudget() {
+		// Past the hourly cap, the error waits for a later build without
+		// using up an attempt.
+		w.mu.Lock()
+		w.repairs[key]--
+		w.mu.Unlock()
+		return false
+	}
+	if w.config.NoAutoRepair || attempt > w.config.MaxRepairAttempts {
+		if attempt == 1 {
+			notify(w.config.Notify, "Build error", truncate(e.Message, 200))
+		}
+		return false
+	}
 
-	for _, m := range matches {
-		if len(m) >= 4 {
-			lineNum := 0
-			fmt.Sscanf(m[3], "%d", &lineNum)
-			errors = append(errors, ErrorEvent{
-				Type:       "compile",
-				File:       m[2],
-				Line:       lineNum,
-				Message:    m[1],
-				Language:   "rust",
-				DetectedAt: time.Now(),
-			})
+	result := checkpointedRepair(e, w.config.ConfirmRepairs)
+	var fixed *bool
+	if result.Success && e.Test != nil && e.Test.Command != "" {
+		// A failed test is quicker to check on its own than in the next
+		// run of the whole suite.
+		_, err := runBuildCommand(e.Dir, e.Test.Command)
+		passes := err == nil
+		fixed = &passes
+		if result.PatternID != 0 && knowledgeDB != nil {
+			knowledgeDB.RecordErrorPatternResult(result.PatternID, passes)
 		}
 	}
+	var repairID int64
+	if result.Attempts > 0 {
+		repairID = w.recordRepair(errorID, result, fixed)
+	}
+	if result.Success && fixed == nil {
+		w.mu.Lock()
+		w.unverified = append(w.unverified, unverifiedRepair{target: e.Target, signature: key, id: repairID,
+			patternID: result.PatternID, lint: e.Type == "lint"})
+		w.mu.Unlock()
+	}
+	w.reportRepair(result)
+	if !result.Success && attempt == 1 {
+		notify(w.config.Notify, "Could not repair build error", truncate(e.Message, 200))
+	}
+	return result.Diff != ""
+}
 
-	return errors
+// giveUpRepairing stops watch mode repairing the error with message again
+// until the build passes, after the user undid its repair.
+func (w *Watcher) giveUpRepairing(message string) {
+	w.mu.Lock()
+	w.repairs[db.NormalizeErrorSignature(message)] = w.config.MaxRepairAttempts
+	w.mu.Unlock()
 }
 
-func parseJSErrors(output string) []ErrorEvent {
-	var errors []ErrorEvent
+// runCommand runs one of t's build or test commands in its directory,
+// reporting it to OnBuildCallback.
+func (w *Watcher) runCommand(t WatchTarget, command string, cycle int) (string, error) {
+	event := BuildEvent{Target: t.Name, Cycle: cycle, Command: command}
+	if w.config.OnBuildCallback != nil {
+		running := event
+		running.Running = true
+		w.config.OnBuildCallback(running)
+	}
+	start := time.Now()
+	output, err := runBuildCommandWithin(filepath.Join(w.root, t.Dir), command, w.config.BuildTimeout)
+	if errors.Is(err, context.DeadlineExceeded) {
+		w.mu.Lock()
+		w.counters.timeouts++
+		w.mu.Unlock()
+	}
+	if w.config.OnBuildCallback != nil {
+		event.Success, event.Output, event.Duration = err == nil, output, time.Since(start)
+		w.config.OnBuildCallback(event)
+	}
+	return output, err
+}
 
-	tsErrorRe := regexp.MustCompile(`(.+\.tsx?)\((\d+),(\d+)\):\s*error\s+TS\d+:\s*(.+)`)
-	matches := tsErrorRe.FindAllStringSubmatch(output, -1)
+// runBuildCommand runs command in dir, or the current directory if dir is
+// empty.
+func runBuildCommand(dir, command string) (string, error) {
+	return runBuildCommandWithin(dir, command, defaultBuildTimeout)
+}
 
-	for _, m := range matches {
-		if len(m) >= 5 {
-			lineNum := 0
-			fmt.Sscanf(m[2], "%d", &lineNum)
-			errors = append(errors, ErrorEvent{
-				Type:       "compile",
-				File:       m[1],
-				Line:       lineNum,
-				Message:    m[4],
-				Language:   "typescript",
-				DetectedAt: time.Now(),
-			})
+func detectBuildCommand(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		return "go build ./..."
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Cargo.toml")); err == nil {
+		return "cargo build"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+		if _, err := os.Stat(filepath.Join(dir, "node_modules", ".bin", "tsc")); err == nil {
+			return "npx tsc --noEmit"
 		}
+		return "npm run build"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "requirements.txt")); err == nil {
+		return "python -m py_compile *.py"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gradlew")); err == nil {
+		return "./gradlew build -x test"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build.gradle")); err == nil {
+		return "gradle build -x test"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build.gradle.kts")); err == nil {
+		return "gradle build -x test"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pom.xml")); err == nil {
+		return "mvn -q compile"
+	}
+	if detectLanguage(dir) == "csharp" {
+		return "dotnet build"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "CMakeLists.txt")); err == nil {
+		return "cmake -S . -B build && cmake --build build"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Makefile")); err == nil {
+		return "make"
 	}
 
-	return errors
+	return "echo 'No build command detected'"
 }
 
-func parsePythonErrors(output string) []ErrorEvent {
-	var errors []ErrorEvent
-
-	pyErrorRe := regexp.MustCompile(`File "(.+)", line (\d+)`)
-	syntaxRe := regexp.MustCompile(`SyntaxError:\s*(.+)`)
-
-	scanner := bufio.NewScanner(strings.NewReader(output))
-	var lastFile string
-	var lastLine int
+func detectTestCommand(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		return "go test ./..."
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Cargo.toml")); err == nil {
+		return "cargo test"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+		return "npm test"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pytest.ini")); err == nil {
+		return "pytest"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gradlew")); err == nil {
+		return "./gradlew test"
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pom.xml")); err == nil {
+		return "mvn -q test"
+	}
+	switch detectLanguage(dir) {
+	case "java":
+		return "gradle test"
+	case "csharp":
+		return "dotnet test --no-build"
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	return ""
+}
 
-		fileMatch := pyErrorRe.FindStringSubmatch(line)
-		if len(fileMatch) >= 3 {
-			lastFile = fileMatch[1]
-			fmt.Sscanf(fileMatch[2], "%d", &lastLine)
+// detectLintCommand returns the command that runs the linter configured in
+// dir and the one that fixes what it can, if the linter is installed.
+func detectLintCommand(dir string) (lint, fix string) {
+	configured := func(globs ...string) bool {
+		for _, glob := range globs {
+			if matches, _ := filepath.Glob(filepath.Join(dir, glob)); len(matches) > 0 {
+				return true
+			}
 		}
+		return false
+	}
+	installed := func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	}
 
-		syntaxMatch := syntaxRe.FindStringSubmatch(line)
-		if len(syntaxMatch) >= 2 && lastFile != "" {
-			errors = append(errors, ErrorEvent{
-				Type:       "syntax",
-				File:       lastFile,
-				Line:       lastLine,
-				Message:    syntaxMatch[1],
-				Language:   "python",
-				DetectedAt: time.Now(),
-			})
-		}
+	if configured(".golangci.*") && installed("golangci-lint") {
+		return "golangci-lint run ./...", "golangci-lint run --fix ./..."
+	}
+	if configured("eslint.config.*", ".eslintrc*") && configured(filepath.Join("node_modules", ".bin", "eslint")) {
+		return "npx eslint .", "npx eslint --fix ."
+	}
+	ruff := configured("ruff.toml", ".ruff.toml")
+	if data, err := os.ReadFile(filepath.Join(dir, "pyproject.toml")); err == nil && strings.Contains(string(data), "[tool.ruff") {
+		ruff = true
+	}
+	if ruff && installed("ruff") {
+		return "ruff check .", "ruff check --fix ."
 	}
 
-	return errors
+	return "", ""
 }
 
-func parseGenericErrors(output string) []ErrorEvent {
-	var errors []ErrorEvent
+func detectWatchPatterns(dir string) []string {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		return []string{"*.go"}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Cargo.toml")); err == nil {
+		return []string{"*.rs"}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+		return []string{"*.js", "*.ts", "*.jsx", "*.tsx"}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "requirements.txt")); err == nil {
+		return []string{"*.py"}
+	}
+	switch detectLanguage(dir) {
+	case "java":
+		return []string{"*.java", "*.kt", "*.gradle", "*.gradle.kts", "pom.xml"}
+	case "csharp":
+		return []string{"*.cs", "*.csproj"}
+	case "cpp":
+		return []string{"*.c", "*.cc", "*.cpp", "*.cxx", "*.h", "*.hpp", "CMakeLists.txt"}
+	}
 
-	if strings.Contains(strings.ToLower(output), "error") {
-		errors = append(errors, ErrorEvent{
-			Type:       "unknown",
-			Message:    truncate(output, 500),
-			FullOutput: output,
-			DetectedAt: time.Now(),
-		})
+	return []string{"*"}
+}
+
+// attemptRepair tries a learned fix for e, then the common fixes for its
+// language. With confirm set, a learned fix command is only run once the
+// user approves it. With no later build to check against, a learned fix
+// that runs is counted as having worked.
+func attemptRepair(e ErrorEvent, confirm bool) RepairResult {
+	result := checkpointedRepair(e, confirm)
+	if result.Success && result.PatternID != 0 && knowledgeDB != nil {
+		knowledgeDB.RecordErrorPatternResult(result.PatternID, true)
 	}
+	return result
+}
 
-	return errors
+// checkpointedRepair is attemptRepair without counting a learned fix that
+// ran as working. The working tree is checkpointed first, so that whatever
+// a repair changes can be shown and undone with revert_last_repair.
+func checkpointedRepair(e ErrorEvent, confirm bool) RepairResult {
+	before := snapshotWorkingTree("", "shell-ai checkpoint")
+	result := tryRepair(e, confirm)
+	if result.Attempts > 0 && before != "" {
+		solution := result.Command
+		if solution == "" {
+			solution = result.Solution
+		}
+		if solution == "" {
+			solution = "failed repair"
+		}
+		result.Diff = saveRepairCheckpoint(before, e, solution)
+	}
+	return result
 }
 
-func attemptRepair(e ErrorEvent) RepairResult {
+func tryRepair(e ErrorEvent, confirm bool) RepairResult {
 	start := time.Now()
 	result := RepairResult{
 		Error:    e,
@@ -650,17 +1721,21 @@ func attemptRepair(e ErrorEvent) RepairResult {
 		patterns, err := knowledgeDB.FindMatchingErrorPatterns(e.Message, getCurrentProjectPath(), 1)
 		if err == nil && len(patterns) > 0 {
 			pattern := patterns[0]
-			if pattern.SolutionCommand != "" {
+			approved := true
+			if confirm && pattern.SolutionCommand != "" {
+				approved = requireApproval("watch", fmt.Sprintf("run %s to fix %s", pattern.SolutionCommand, truncate(e.Message, 80))) == nil
+			}
+			if pattern.SolutionCommand != "" && approved {
 				result.Attempts++
-				output, err := runBuildCommand(pattern.SolutionCommand)
+				output, err := runBuildCommand(e.Dir, pattern.SolutionCommand)
 				result.Output = output
 
 				if err == nil {
 					result.Success = true
 					result.Solution = pattern.Solution
 					result.Command = pattern.SolutionCommand
+					result.PatternID = pattern.ID
 					result.Duration = time.Since(start)
-					knowledgeDB.RecordErrorPatternResult(pattern.ID, true)
 					return result
 				}
 				knowledgeDB.RecordErrorPatternResult(pattern.ID, false)
@@ -668,10 +1743,18 @@ func attemptRepair(e ErrorEvent) RepairResult {
 		}
 	}
 
-	if e.File != "" && e.Line > 0 {
+	// A failed test is repaired from its own output, and only in the test
+	// and the code it tests.
+	candidates := []ErrorEvent{e}
+	if e.Test != nil {
+		candidates = testRepairErrors(e)
+	}
+	for _, c := range candidates {
+		if c.File == "" || c.Line <= 0 {
+			continue
+		}
 		result.Attempts++
-		repaired := tryCommonFixes(e)
-		if repaired {
+		if tryCommonFixes(c) {
 			result.Success = true
 			result.Solution = "Applied common fix pattern"
 			result.Duration = time.Since(start)
@@ -698,17 +1781,15 @@ func tryCommonFixes(e ErrorEvent) bool {
 	case "javascript", "typescript":
 		if strings.Contains(e.Message, "Cannot find module") {
 			moduleName := extractModuleName(e.Message)
-			if moduleName != "" {
-				_, err := runBuildCommand(fmt.Sprintf("npm install %s", moduleName))
-				return err == nil
+			if moduleName != "" && !strings.HasPrefix(moduleName, ".") {
+				return installMissingDependency("npm", npmPackageName(moduleName), e.Dir)
 			}
 		}
 	case "python":
 		if strings.Contains(e.Message, "ModuleNotFoundError") {
 			moduleName := extractPythonModule(e.Message)
 			if moduleName != "" {
-				_, err := runBuildCommand(fmt.Sprintf("pip install %s", moduleName))
-				return err == nil
+				return installMissingDependency("pip", strings.Split(moduleName, ".")[0], e.Dir)
 			}
 		}
 	}
@@ -716,6 +1797,27 @@ func tryCommonFixes(e ErrorEvent) bool {
 	return false
 }
 
+// installMissingDependency installs a module the build could not find,
+// going through package_install's validation and approval. npm installs
+// into the project in dir, when given, such as a monorepo's frontend.
+func installMissingDependency(manager, name, dir string) bool {
+	if !packageNamePattern.MatchString(name) {
+		return false
+	}
+	pm, err := findPackageManager(manager)
+	if err != nil {
+		return false
+	}
+	if manager == "npm" && dir != "" {
+		install := pm.install
+		pm.install = func(pkgs []string, global bool) []string {
+			return append(install(pkgs, global), "--prefix", dir)
+		}
+	}
+	_, err = installPackages(pm, []string{name}, false)
+	return err == nil
+}
+
 func removeUnusedImport(file, message string) bool {
 	importRe := regexp.MustCompile(`"(.+)" imported and not used`)
 	matches := importRe.FindStringSubmatch(message)
@@ -735,6 +1837,16 @@ func extractModuleName(message string) string {
 	return ""
 }
 
+// npmPackageName trims a module path like lodash/fp or @scope/pkg/sub to
+// the package that provides it.
+func npmPackageName(module string) string {
+	parts := strings.Split(module, "/")
+	if strings.HasPrefix(module, "@") && len(parts) >= 2 {
+		return parts[0] + "/" + parts[1]
+	}
+	return parts[0]
+}
+
 func extractPythonModule(message string) string {
 	re := regexp.MustCompile(`No module named '([^']+)'`)
 	matches := re.FindStringSubmatch(message)
@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"q/types"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// defaultMaxRepairAttempts is how many times watch mode repairs an error
+// before leaving it to the user.
+const defaultMaxRepairAttempts = 3
+
+var (
+	watchPrefs   types.WatchConfig
+	watchPrefsMu sync.Mutex
+)
+
+// SetWatchPreferences installs the watch: preferences from config, which
+// StartWatcher applies to whatever its caller leaves unset.
+func SetWatchPreferences(prefs types.WatchConfig) {
+	watchPrefsMu.Lock()
+	watchPrefs = prefs
+	watchPrefsMu.Unlock()
+}
+
+// watchPreferencesFor returns the watch preferences for dir: the general
+// ones with those of the closest entry in Projects laid over them.
+func watchPreferencesFor(dir string) types.WatchConfig {
+	watchPrefsMu.Lock()
+	defer watchPrefsMu.Unlock()
+
+	prefs := watchPrefs
+	best := ""
+	var project *types.WatchConfig
+	for key, p := range watchPrefs.Projects {
+		path := expandPath(key)
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if (dir == path || strings.HasPrefix(dir, path+string(filepath.Separator))) && len(path) > len(best) {
+			best, project = path, &p
+		}
+	}
+	if project == nil {
+		return prefs
+	}
+
+	if project.BuildCommand != "" {
+		prefs.BuildCommand = project.BuildCommand
+	}
+	if project.TestCommand != "" {
+		prefs.TestCommand = project.TestCommand
+	}
+	if project.LintCommand != "" {
+		prefs.LintCommand = project.LintCommand
+	}
+	if project.FixCommand != "" {
+		prefs.FixCommand = project.FixCommand
+	}
+	if project.Lint != nil {
+		prefs.Lint = project.Lint
+	}
+	if len(project.Patterns) > 0 {
+		prefs.Patterns = project.Patterns
+	}
+	if len(project.Ignore) > 0 {
+		prefs.Ignore = project.Ignore
+	}
+	if project.DebounceMs > 0 {
+		prefs.DebounceMs = project.DebounceMs
+	}
+	if project.AutoRepair != nil {
+		prefs.AutoRepair = project.AutoRepair
+	}
+	if project.MaxRepairAttempts > 0 {
+		prefs.MaxRepairAttempts = project.MaxRepairAttempts
+	}
+	if project.MaxRepairsPerHour != 0 {
+		prefs.MaxRepairsPerHour = project.MaxRepairsPerHour
+	}
+	if project.MaxLoad > 0 {
+		prefs.MaxLoad = project.MaxLoad
+	}
+	if project.BuildTimeout > 0 {
+		prefs.BuildTimeout = project.BuildTimeout
+	}
+	if project.Notify != (types.WatchNotifyConfig{}) {
+		prefs.Notify = project.Notify
+	}
+	if hasWatchHooks(project.Hooks) {
+		prefs.Hooks = project.Hooks
+	}
+	if len(project.Targets) > 0 {
+		prefs.Targets = project.Targets
+	}
+	return prefs
+}
+
+func hasWatchHooks(hooks types.WatchHooksConfig) bool {
+	return len(hooks.OnError)+len(hooks.OnRepair)+len(hooks.OnGreen) > 0
+}
+
+// notify gets the user's attention in the ways they chose.
+func notify(cfg types.WatchNotifyConfig, title, message string) {
+	if cfg.Bell {
+		fmt.Fprint(os.Stderr, "\a")
+	}
+	if cfg.Desktop {
+		desktopNotify(title, message)
+	}
+}
+
+// desktopNotify shows a system notification where a way to do so is
+// installed.
+func desktopNotify(title, message string) {
+	switch runtime.GOOS {
+	case "darwin":
+		exec.Command("osascript", "-e", fmt.Sprintf("display notification %q with title %q", message, title)).Run()
+	case "linux", "freebsd", "openbsd":
+		if _, err := exec.LookPath("notify-send"); err == nil {
+			exec.Command("notify-send", title, message).Run()
+		}
+	}
+}
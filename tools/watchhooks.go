@@ -0,0 +1,164 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"q/types"
+	"time"
+)
+
+// watchHookTimeout bounds how long a hook may run.
+const watchHookTimeout = 30 * time.Second
+
+// watchHookEvent is what watch hooks get: on stdin for a script, as the
+// body for a webhook.
+type watchHookEvent struct {
+	// Event is error, repair or green.
+	Event string `json:"event"`
+	// Text describes the event in a line, for chat webhooks.
+	Text    string           `json:"text"`
+	Project string           `json:"project"`
+	Target  string           `json:"target,omitempty"`
+	Error   *watchHookError  `json:"error,omitempty"`
+	Repair  *watchHookRepair `json:"repair,omitempty"`
+	Time    time.Time        `json:"time"`
+}
+
+type watchHookError struct {
+	Type     string `json:"type"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+	Language string `json:"language,omitempty"`
+}
+
+type watchHookRepair struct {
+	Success    bool   `json:"success"`
+	Solution   string `json:"solution,omitempty"`
+	Command    string `json:"command,omitempty"`
+	Diff       string `json:"diff,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+func hookError(e ErrorEvent) *watchHookError {
+	return &watchHookError{Type: e.Type, File: e.File, Line: e.Line, Message: e.Message, Language: e.Language}
+}
+
+// describeError puts e in a line, such as "api: main.go:12: undefined: x".
+func describeError(e ErrorEvent) string {
+	text := truncate(e.Message, 200)
+	if e.File != "" && e.Line > 0 {
+		text = fmt.Sprintf("%s:%d: %s", e.File, e.Line, text)
+	} else if e.File != "" {
+		text = e.File + ": " + text
+	}
+	if e.Target != "" {
+		text = e.Target + ": " + text
+	}
+	return text
+}
+
+// hookOnError runs the on_error hooks for e.
+func (w *Watcher) hookOnError(e ErrorEvent) {
+	w.runHooks(w.config.Hooks.OnError, watchHookEvent{
+		Event:  "error",
+		Text:   fmt.Sprintf("%s error in %s", e.Type, describeError(e)),
+		Target: e.Target,
+		Error:  hookError(e),
+	})
+}
+
+// hookOnRepair runs the on_repair hooks for r, skipping those that only
+// want failures when it succeeded.
+func (w *Watcher) hookOnRepair(r RepairResult) {
+	text := "Could not repair " + describeError(r.Error)
+	if r.Success {
+		text = fmt.Sprintf("Repaired %s (%s)", describeError(r.Error), r.Solution)
+	}
+	var hooks []types.WatchHook
+	for _, h := range w.config.Hooks.OnRepair {
+		if !r.Success || !h.FailuresOnly {
+			hooks = append(hooks, h)
+		}
+	}
+	w.runHooks(hooks, watchHookEvent{
+		Event:  "repair",
+		Text:   text,
+		Target: r.Error.Target,
+		Error:  hookError(r.Error),
+		Repair: &watchHookRepair{Success: r.Success, Solution: r.Solution, Command: r.Command, Diff: r.Diff,
+			DurationMs: r.Duration.Milliseconds()},
+	})
+}
+
+// hookOnGreen runs the on_green hooks.
+func (w *Watcher) hookOnGreen() {
+	w.runHooks(w.config.Hooks.OnGreen, watchHookEvent{Event: "green", Text: "The build passes again"})
+}
+
+// runHooks runs hooks in the background, so a slow webhook never holds up
+// a build. Their failures are ignored, like those of notifications.
+func (w *Watcher) runHooks(hooks []types.WatchHook, event watchHookEvent) {
+	if len(hooks) == 0 {
+		return
+	}
+	event.Project = w.root
+	event.Text = fmt.Sprintf("shell-ai watch (%s): %s", filepath.Base(w.root), event.Text)
+	event.Time = time.Now()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	for _, h := range hooks {
+		go runWatchHook(h, w.root, event.Event, payload)
+	}
+}
+
+// runWatchHook runs h's script, then calls its webhook, with payload, the
+// event as JSON.
+func runWatchHook(h types.WatchHook, dir, event string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), watchHookTimeout)
+	defer cancel()
+
+	if h.Run != "" {
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "bash"
+		}
+		cmd := exec.CommandContext(ctx, shell, "-c", h.Run)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "SHELL_AI_WATCH_EVENT="+event)
+		cmd.Stdin = bytes.NewReader(payload)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("watch hook %q failed: %w", h.Run, err)
+		}
+	}
+
+	url := h.Webhook
+	if h.WebhookEnvVar != "" {
+		url = os.Getenv(h.WebhookEnvVar)
+	}
+	if url == "" {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("watch webhook failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("watch webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the watcher's budgets.
+const (
+	defaultMaxRepairsPerHour = 20
+	defaultBuildTimeout      = 2 * time.Minute
+)
+
+// watchLoadRetry is how long a build put off for load waits before the
+// load is checked again.
+const watchLoadRetry = 30 * time.Second
+
+// buildMu lets one build cycle run at a time, whether the watcher or
+// trigger_build started it, so builds never compete for the CPU.
+var buildMu sync.Mutex
+
+// watchCounters count what the watcher's budgets held back, for
+// watch_status.
+type watchCounters struct {
+	cycles int
+	// deferred counts the times a build was put off because the load was
+	// too high.
+	deferred int
+	// capped counts repairs not tried because the hourly cap was reached.
+	capped   int
+	timeouts int
+}
+
+// overloaded reports whether the load average is above MaxLoad, counting
+// a build put off if it is.
+func (w *Watcher) overloaded() bool {
+	if w.config.MaxLoad <= 0 {
+		return false
+	}
+	load, ok := loadAverage()
+	if !ok || load <= w.config.MaxLoad {
+		return false
+	}
+	w.mu.Lock()
+	w.counters.deferred++
+	w.mu.Unlock()
+	return true
+}
+
+// spendRepairBudget takes a repair from the hourly budget, reporting false
+// if none is left.
+func (w *Watcher) spendRepairBudget() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.config.MaxRepairsPerHour < 0 {
+		return true
+	}
+	hourAgo := time.Now().Add(-time.Hour)
+	recent := w.repairTimes[:0]
+	for _, t := range w.repairTimes {
+		if t.After(hourAgo) {
+			recent = append(recent, t)
+		}
+	}
+	w.repairTimes = recent
+	if len(recent) >= w.config.MaxRepairsPerHour {
+		w.counters.capped++
+		return false
+	}
+	w.repairTimes = append(w.repairTimes, time.Now())
+	return true
+}
+
+// repairsThisHour returns how many repairs ran in the last hour.
+func (w *Watcher) repairsThisHour() int {
+	hourAgo := time.Now().Add(-time.Hour)
+	n := 0
+	for _, t := range w.repairTimes {
+		if t.After(hourAgo) {
+			n++
+		}
+	}
+	return n
+}
+
+// loadAverage returns the one-minute load average, where the system
+// reports it.
+func loadAverage() (float64, bool) {
+	var field string
+	switch runtime.GOOS {
+	case "linux":
+		data, err := os.ReadFile("/proc/loadavg")
+		if err != nil {
+			return 0, false
+		}
+		field, _, _ = strings.Cut(string(data), " ")
+	case "darwin", "freebsd", "openbsd", "netbsd":
+		// vm.loadavg reads "{ 1.52 1.61 1.70 }".
+		out, err := exec.Command("sysctl", "-n", "vm.loadavg").Output()
+		if err != nil {
+			return 0, false
+		}
+		fields := strings.Fields(strings.Trim(strings.TrimSpace(string(out)), "{}"))
+		if len(fields) == 0 {
+			return 0, false
+		}
+		field = fields[0]
+	default:
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(field, 64)
+	return load, err == nil
+}
+
+// runBuildCommandWithin runs command in dir like runBuildCommand, killing
+// it after timeout.
+func runBuildCommandWithin(dir, command string, timeout time.Duration) (string, error) {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "bash"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, shell, "-c", command)
+	cmd.Dir = dir
+	// Processes the shell started may hold its output open after it is
+	// killed.
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		message := fmt.Sprintf("%s timed out after %s", command, timeout)
+		output = append(output, "\n"+message+"\n"...)
+		err = fmt.Errorf("%s: %w", message, ctx.Err())
+	}
+	return string(output), err
+}
@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"q/db"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/melbahja/goph"
+)
+
+// rememberDevice records a MAC sighting so wake_on_lan can find the machine
+// by name later.
+func rememberDevice(mac, ip, name, source string) {
+	if hostsDB == nil || mac == "" {
+		return
+	}
+	hostsDB.SaveDevice(mac, ip, name, source)
+}
+
+// learnSSHDevice stores the MAC of a host we just connected to, when it is on
+// the local network and therefore in the ARP table.
+func learnSSHDevice(alias string, client *goph.Client) {
+	if hostsDB == nil {
+		return
+	}
+	ip, _, err := net.SplitHostPort(client.RemoteAddr().String())
+	if err != nil {
+		return
+	}
+	if mac := readARPTable()[ip]; mac != "" {
+		rememberDevice(mac, ip, alias, "ssh")
+	}
+}
+
+func resolveIPv4(host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		return ""
+	}
+	return ips[0].String()
+}
+
+// lookupWakeTarget finds the MAC for a host name, inventory name or IP.
+func lookupWakeTarget(host string) (*db.KnownDevice, error) {
+	if hostsDB != nil {
+		if device, _ := hostsDB.FindDevice(host); device != nil {
+			return device, nil
+		}
+	}
+
+	hostname, _, _, _ := resolveSSHConfig(host)
+	ip := resolveIPv4(hostname)
+	if ip != "" {
+		if hostsDB != nil {
+			if device, _ := hostsDB.FindDevice(ip); device != nil {
+				return device, nil
+			}
+		}
+		// A machine that only just went to sleep is often still cached.
+		if mac := readARPTable()[ip]; mac != "" {
+			rememberDevice(mac, ip, host, "arp")
+			return &db.KnownDevice{MAC: mac, IP: ip, Name: host}, nil
+		}
+	}
+	return nil, fmt.Errorf("no MAC address known for %s; run lan_scan or connect over SSH while it is awake so it can be learned, or pass mac", host)
+}
+
+// hostUp reports whether the host answers ping or any common TCP port. A
+// refused connection counts: something replied.
+func hostUp(ctx context.Context, ip string) bool {
+	results := make(chan bool, 5)
+	go func() {
+		pinger, err := ping.NewPinger(ip)
+		if err != nil {
+			results <- false
+			return
+		}
+		pinger.Count = 1
+		pinger.Timeout = 2 * time.Second
+		pinger.SetPrivileged(false)
+		if err := pinger.Run(); err != nil {
+			results <- false
+			return
+		}
+		results <- pinger.Statistics().PacketsRecv > 0
+	}()
+	dialer := net.Dialer{Timeout: 2 * time.Second}
+	for _, port := range []string{"22", "445", "3389", "80"} {
+		go func(port string) {
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, port))
+			if err == nil {
+				conn.Close()
+				results <- true
+				return
+			}
+			results <- errors.Is(err, syscall.ECONNREFUSED)
+		}(port)
+	}
+	up := false
+	for i := 0; i < 5; i++ {
+		if <-results {
+			up = true
+		}
+	}
+	return up
+}
+
+// waitForHost polls until the host answers or wait runs out.
+func waitForHost(ctx context.Context, ip string, wait time.Duration) (bool, time.Duration) {
+	start := time.Now()
+	deadline := start.Add(wait)
+	for time.Now().Before(deadline) {
+		if hostUp(ctx, ip) {
+			return true, time.Since(start)
+		}
+		reportProgress("wake_on_lan", fmt.Sprintf("waiting for %s (%s)", ip, time.Since(start).Round(time.Second)))
+		select {
+		case <-ctx.Done():
+			return false, time.Since(start)
+		case <-time.After(3 * time.Second):
+		}
+	}
+	return false, time.Since(start)
+}
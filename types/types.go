@@ -9,6 +9,17 @@ type ModelConfig struct {
 	AuthHeader string    `yaml:"auth_header,omitempty"`
 	Provider   string    `yaml:"provider,omitempty"`
 	Prompt     []Message `yaml:"prompt"`
+	// SystemPrompt names a prompt in the config's prompt library to use as
+	// the system message in place of the one in Prompt.
+	SystemPrompt string `yaml:"system_prompt,omitempty"`
+	// AuthSource is "keychain" when the API key is kept in the OS
+	// keychain, which is used when the auth_env_var is not set.
+	AuthSource string `yaml:"auth_source,omitempty"`
+	// InputPrice and OutputPrice are USD per million prompt and completion
+	// tokens, used to estimate what a session cost. Well-known OpenAI
+	// models have built-in prices.
+	InputPrice  float64 `yaml:"input_price,omitempty"`
+	OutputPrice float64 `yaml:"output_price,omitempty"`
 }
 
 type Message struct {
@@ -17,14 +28,282 @@ type Message struct {
 }
 
 type Preferences struct {
-	DefaultModel     string `yaml:"default_model"`
-	SaveHistory      bool   `yaml:"save_history,omitempty"`
-	MaxHistoryDays   int    `yaml:"max_history_days,omitempty"`
-	EnableKnowledge  bool   `yaml:"enable_knowledge,omitempty"`
-	StreamResponses  bool   `yaml:"stream_responses,omitempty"`
-	ShowToolActivity bool   `yaml:"show_tool_activity,omitempty"`
-	DefaultTimeout   int    `yaml:"default_timeout,omitempty"`
-	AutoCopyCode     bool   `yaml:"auto_copy_code,omitempty"`
+	DefaultModel   string `yaml:"default_model"`
+	SaveHistory    bool   `yaml:"save_history,omitempty"`
+	MaxHistoryDays int    `yaml:"max_history_days,omitempty"`
+	// DBBackups is how many daily memory database backups to keep
+	// (default 7; -1 turns automatic backups off).
+	DBBackups        int  `yaml:"db_backups,omitempty"`
+	EnableKnowledge  bool `yaml:"enable_knowledge,omitempty"`
+	StreamResponses  bool `yaml:"stream_responses,omitempty"`
+	ShowToolActivity bool `yaml:"show_tool_activity,omitempty"`
+	DefaultTimeout   int  `yaml:"default_timeout,omitempty"`
+	AutoCopyCode     bool `yaml:"auto_copy_code,omitempty"`
+	// SummarizeDocs has the model write the summaries of fetched docs that
+	// search_docs shows, rather than taking their first plausible line.
+	SummarizeDocs bool `yaml:"summarize_docs,omitempty"`
+
+	ToolTimeouts   map[string]int  `yaml:"tool_timeouts,omitempty"`
+	ToolCategories map[string]bool `yaml:"tool_categories,omitempty"`
+
+	Voice      VoiceConfig      `yaml:"voice,omitempty"`
+	Sync       SyncConfig       `yaml:"sync,omitempty"`
+	Memory     MemoryConfig     `yaml:"memory,omitempty"`
+	Embeddings EmbeddingsConfig `yaml:"embeddings,omitempty"`
+	Watch      WatchConfig      `yaml:"watch,omitempty"`
+	Agents     AgentsConfig     `yaml:"agents,omitempty"`
+	Hooks      HooksConfig      `yaml:"hooks,omitempty"`
+}
+
+// HooksConfig lists the scripts run around each query and tool call. A
+// hook gets the event as JSON on stdin and may print JSON to change it:
+// {"prompt": ...} before a query, {"block": true, "reason": ...} or
+// {"arguments": {...}} before a tool call, {"result": ...} after one, and
+// {"response": ...} after the reply.
+type HooksConfig struct {
+	PreQuery     []Hook `yaml:"pre_query,omitempty"`
+	PostResponse []Hook `yaml:"post_response,omitempty"`
+	PreTool      []Hook `yaml:"pre_tool,omitempty"`
+	PostTool     []Hook `yaml:"post_tool,omitempty"`
+}
+
+// Hook is a script run, with $SHELL -c, at a point in a query.
+type Hook struct {
+	Run string `yaml:"run"`
+	// Tools limits a pre_tool or post_tool hook to these tools and tool
+	// categories (default all).
+	Tools []string `yaml:"tools,omitempty"`
+	// Timeout is how many seconds the script may take (default 30).
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// MemoryConfig controls how much of earlier conversations in a directory is
+// added to the system prompt. Zero values keep the defaults. Pinned memories
+// are always added.
+type MemoryConfig struct {
+	// Disabled stops earlier conversations from being added at all.
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Sessions is how many recent sessions to draw from (default 5).
+	Sessions int `yaml:"sessions,omitempty"`
+	// Messages caps the messages added across those sessions (default 10).
+	Messages int `yaml:"messages,omitempty"`
+	// MaxAgeDays skips sessions not used for this many days (0: no limit).
+	MaxAgeDays int `yaml:"max_age_days,omitempty"`
+	// Scope widens recall beyond this directory: "repo" adds other clones
+	// of the same git remote, "parent" adds the parent directory and its
+	// subdirectories, and "global" adds everything. Default "project".
+	Scope string `yaml:"scope,omitempty"`
+}
+
+// SyncConfig configures `q sync`, which shares sessions and knowledge
+// between machines through one JSON file on a remote the user controls.
+type SyncConfig struct {
+	// Remote is s3://bucket/key.json, an http(s) WebDAV file URL, or a git
+	// repository URL.
+	Remote string `yaml:"remote,omitempty"`
+	// Type is s3, webdav or git; guessed from Remote when empty.
+	Type string `yaml:"type,omitempty"`
+	// UsernameEnvVar and PasswordEnvVar name the WebDAV credentials.
+	UsernameEnvVar string `yaml:"username_env_var,omitempty"`
+	PasswordEnvVar string `yaml:"password_env_var,omitempty"`
+	// Machine names this machine in the sync file (default: hostname).
+	Machine string `yaml:"machine,omitempty"`
+}
+
+// VoiceConfig configures `q --voice`. Empty fields fall back to OpenAI's
+// transcription API and whichever recorder/speech tools are installed.
+type VoiceConfig struct {
+	TranscribeEndpoint string `yaml:"transcribe_endpoint,omitempty"`
+	TranscribeModel    string `yaml:"transcribe_model,omitempty"`
+	AuthEnvVar         string `yaml:"auth_env_var,omitempty"`
+	AuthSource         string `yaml:"auth_source,omitempty"`
+	RecordCommand      string `yaml:"record_command,omitempty"`
+	MaxSeconds         int    `yaml:"max_seconds,omitempty"`
+	Speak              bool   `yaml:"speak,omitempty"`
+	SpeakCommand       string `yaml:"speak_command,omitempty"`
+}
+
+// EmbeddingsConfig turns on finding knowledge by meaning as well as by
+// words. Empty fields fall back to OpenAI's embeddings API.
+type EmbeddingsConfig struct {
+	Enabled    bool   `yaml:"enabled,omitempty"`
+	Endpoint   string `yaml:"endpoint,omitempty"`
+	Model      string `yaml:"model,omitempty"`
+	AuthEnvVar string `yaml:"auth_env_var,omitempty"`
+	AuthSource string `yaml:"auth_source,omitempty"`
+}
+
+// AgentsConfig configures the sub-agents spawn_agent starts.
+type AgentsConfig struct {
+	// Model names the entry in models that agents use unless their role
+	// or spawn_agent picks another (default the model of the session).
+	Model string `yaml:"model,omitempty"`
+	// Roles are presets for the roles agents are spawned with, such as a
+	// cheap model for researchers and a strong one for coders.
+	Roles map[string]AgentRoleConfig `yaml:"roles,omitempty"`
+	// Pipelines are named chains of agents for run_pipeline, each step's
+	// output feeding the steps after it.
+	Pipelines map[string]PipelineConfig `yaml:"pipelines,omitempty"`
+	// MaxConcurrent is how many agents run at once; the rest wait their
+	// turn in the order they were spawned (default 4, -1: no limit).
+	MaxConcurrent int `yaml:"max_concurrent,omitempty"`
+	// Retry gives an agent that fails, on an API error or by running out
+	// of rounds, a second attempt that is told what went wrong (default
+	// true).
+	Retry *bool `yaml:"retry,omitempty"`
+}
+
+// AgentRoleConfig is a role preset. Fields left empty fall back to the
+// defaults.
+type AgentRoleConfig struct {
+	// Model names an entry in models.
+	Model string `yaml:"model,omitempty"`
+	// Prompt describes the role at the top of the agent's system prompt.
+	Prompt string `yaml:"prompt,omitempty"`
+	// Tools limits the agent to these tools and tool categories.
+	Tools []string `yaml:"tools,omitempty"`
+}
+
+// PipelineConfig is a pipeline of agents.
+type PipelineConfig struct {
+	Description string         `yaml:"description,omitempty"`
+	Steps       []PipelineStep `yaml:"steps"`
+}
+
+// PipelineStep is an agent in a pipeline. Its task may use {{input}} for
+// the pipeline's input and {{name}} for the result of an earlier step.
+type PipelineStep struct {
+	Name  string `yaml:"name" json:"name"`
+	Role  string `yaml:"role,omitempty" json:"role,omitempty"`
+	Model string `yaml:"model,omitempty" json:"model,omitempty"`
+	Task  string `yaml:"task" json:"task"`
+	// Tools limits the step's agent to these tools and tool categories,
+	// within what its role allows.
+	Tools []string `yaml:"tools,omitempty" json:"tools,omitempty"`
+	// After names steps to wait for besides those the task uses. A step
+	// with neither starts with the pipeline.
+	After []string `yaml:"after,omitempty" json:"after,omitempty"`
+	// Optional lets the pipeline go on if the step fails, with the steps
+	// using it told that it failed.
+	Optional bool `yaml:"optional,omitempty" json:"optional,omitempty"`
+}
+
+// WatchConfig configures watch mode, whether started with q --watch or by
+// the model. Empty fields fall back to what is detected from the project,
+// and Projects overrides them in particular directories.
+type WatchConfig struct {
+	BuildCommand string `yaml:"build_command,omitempty"`
+	TestCommand  string `yaml:"test_command,omitempty"`
+	// LintCommand runs after a build that passes, and FixCommand fixes what
+	// it can before anything else is tried. Without them, golangci-lint,
+	// ESLint and ruff are used where the project configures them.
+	LintCommand string `yaml:"lint_command,omitempty"`
+	FixCommand  string `yaml:"fix_command,omitempty"`
+	// Lint runs linters in the watch cycle (default true).
+	Lint *bool `yaml:"lint,omitempty"`
+	// Patterns are the files whose changes start a build, e.g. "*.go".
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Ignore lists globs of files and directories not to watch, matched
+	// against names and against paths relative to the project.
+	Ignore []string `yaml:"ignore,omitempty"`
+	// DebounceMs is how long to wait after a change for more before
+	// building (default 300).
+	DebounceMs int `yaml:"debounce_ms,omitempty"`
+	// AutoRepair tries learned and common fixes for errors (default true).
+	AutoRepair *bool `yaml:"auto_repair,omitempty"`
+	// MaxRepairAttempts is how many times an error is repaired before
+	// watch mode leaves it alone until the build passes (default 3).
+	MaxRepairAttempts int `yaml:"max_repair_attempts,omitempty"`
+	// MaxRepairsPerHour caps repairs across all errors; past it, errors
+	// wait for the next build (default 20, -1 for no cap).
+	MaxRepairsPerHour int `yaml:"max_repairs_per_hour,omitempty"`
+	// MaxLoad puts builds off while the one-minute load average is above
+	// it (default off).
+	MaxLoad float64 `yaml:"max_load,omitempty"`
+	// BuildTimeout is how many seconds a build, lint or test command may
+	// run (default 120).
+	BuildTimeout int               `yaml:"build_timeout,omitempty"`
+	Notify       WatchNotifyConfig `yaml:"notify,omitempty"`
+	// Hooks run scripts or call webhooks on errors, repairs and recovery.
+	Hooks WatchHooksConfig `yaml:"hooks,omitempty"`
+	// Targets splits a monorepo into parts built and tested separately,
+	// such as a frontend and a backend. Without them, the parts are
+	// detected from the project files in subdirectories.
+	Targets []WatchTargetConfig `yaml:"targets,omitempty"`
+	// Projects overrides these settings in a directory and those under
+	// it, keyed by path ("~/" allowed); the longest matching path wins.
+	Projects map[string]WatchConfig `yaml:"projects,omitempty"`
+}
+
+// WatchTargetConfig is a part of a project that watch mode builds and
+// tests on its own. What it leaves unset is detected from its directory.
+type WatchTargetConfig struct {
+	// Name labels the target's builds and errors (default Dir).
+	Name string `yaml:"name,omitempty"`
+	// Dir is the target's directory, relative to the project.
+	Dir          string   `yaml:"dir"`
+	BuildCommand string   `yaml:"build_command,omitempty"`
+	TestCommand  string   `yaml:"test_command,omitempty"`
+	LintCommand  string   `yaml:"lint_command,omitempty"`
+	FixCommand   string   `yaml:"fix_command,omitempty"`
+	Patterns     []string `yaml:"patterns,omitempty"`
+	// Language picks the error parser: go, rust, javascript, typescript,
+	// python, java, csharp or cpp.
+	Language string `yaml:"language,omitempty"`
+}
+
+// WatchNotifyConfig says how watch mode tells you about an error it could
+// not repair.
+type WatchNotifyConfig struct {
+	// Desktop shows a system notification (notify-send or osascript).
+	Desktop bool `yaml:"desktop,omitempty"`
+	// Bell rings the terminal bell.
+	Bell bool `yaml:"bell,omitempty"`
+	// Recovered also notifies when the build passes again.
+	Recovered bool `yaml:"recovered,omitempty"`
+}
+
+// WatchHooksConfig lists what watch mode runs when something happens, so
+// it can post to a chat channel or drive a status light. Each hook gets the
+// event as JSON.
+type WatchHooksConfig struct {
+	// OnError runs for each error the first time it turns up after the
+	// build last passed.
+	OnError []WatchHook `yaml:"on_error,omitempty"`
+	// OnRepair runs after each try at repairing an error, whether or not
+	// a fix was found.
+	OnRepair []WatchHook `yaml:"on_repair,omitempty"`
+	// OnGreen runs when every target passes again after a failure.
+	OnGreen []WatchHook `yaml:"on_green,omitempty"`
+}
+
+// WatchHook is a shell command, which gets the event on stdin, or a URL
+// the event is POSTed to. A Slack incoming webhook shows the event's text.
+type WatchHook struct {
+	Run     string `yaml:"run,omitempty"`
+	Webhook string `yaml:"webhook,omitempty"`
+	// WebhookEnvVar names an environment variable holding the URL, to keep
+	// it out of the config.
+	WebhookEnvVar string `yaml:"webhook_env_var,omitempty"`
+	// FailuresOnly skips successful repairs in OnRepair.
+	FailuresOnly bool `yaml:"failures_only,omitempty"`
+}
+
+// Recipe is a reusable prompt template run with `q run <name>`.
+type Recipe struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description,omitempty"`
+	Prompt      string        `yaml:"prompt"`
+	Tools       []string      `yaml:"tools,omitempty"`
+	Model       string        `yaml:"model,omitempty"`
+	Inputs      []RecipeInput `yaml:"inputs,omitempty"`
+}
+
+type RecipeInput struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Default     string `yaml:"default,omitempty"`
+	Required    bool   `yaml:"required,omitempty"`
 }
 
 type ProviderPreset struct {
@@ -35,12 +314,18 @@ type ProviderPreset struct {
 }
 
 type Payload struct {
-	Model       string    `json:"model"`
-	Prompt      string    `json:"prompt,omitempty"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float32   `json:"temperature,omitempty"`
-	Messages    []Message `json:"messages"`
-	Stream      bool      `json:"stream,omitempty"`
+	Model         string         `json:"model"`
+	Prompt        string         `json:"prompt,omitempty"`
+	MaxTokens     int            `json:"max_tokens,omitempty"`
+	Temperature   float32        `json:"temperature,omitempty"`
+	Messages      []Message      `json:"messages"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions asks the API to end a stream with a chunk reporting usage.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type ResponseData struct {
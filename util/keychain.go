@@ -0,0 +1,146 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Secrets are kept in the OS keychain: the macOS Keychain, the Secret
+// Service via secret-tool on Linux, or the Windows Credential Manager's
+// password vault via PowerShell. Entries are looked up by service and
+// account.
+
+// KeychainService is the service q's keychain entries are stored under.
+const KeychainService = "shell-ai"
+
+// KeychainGet returns the secret stored for account, or "" if there is
+// none or no keychain to ask.
+func KeychainGet(service, account string) string {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return ""
+		}
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	case "windows":
+		cmd = powershell(passwordVault + fmt.Sprintf("$c = $v.Retrieve(%s, %s); $c.RetrievePassword(); $c.Password", psQuote(service), psQuote(account)))
+	default:
+		return ""
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// KeychainSet stores secret for account, replacing any there is, with
+// label describing it to the user.
+func KeychainSet(service, account, label, secret string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// Given on the command line, the secret would show in ps; security
+		// reads the command from stdin instead.
+		if strings.ContainsAny(secret, "\r\n") {
+			return fmt.Errorf("the key cannot contain line breaks")
+		}
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -l %s -w %s\n",
+			securityQuote(service), securityQuote(account), securityQuote(label), securityQuote(secret)))
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return fmt.Errorf("secret-tool is not installed")
+		}
+		cmd = exec.Command("secret-tool", "store", "--label="+label, "service", service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	case "windows":
+		cmd = powershell(passwordVault + fmt.Sprintf("$v.Add((New-Object Windows.Security.Credentials.PasswordCredential(%s, %s, [Console]::In.ReadToEnd())))", psQuote(service), psQuote(account)))
+		cmd.Stdin = strings.NewReader(secret)
+	default:
+		return fmt.Errorf("no supported keychain on %s", runtime.GOOS)
+	}
+	out, err := cmd.CombinedOutput()
+	if runtime.GOOS == "darwin" {
+		// security -i succeeds whatever its commands do, and says nothing
+		// when they work.
+		out = []byte(strings.TrimSpace(strings.ReplaceAll(string(out), "security> ", "")))
+		if err == nil && len(out) > 0 {
+			err = fmt.Errorf("security failed")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store key in keychain: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// KeychainDelete removes the secret stored for account.
+func KeychainDelete(service, account string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", service, "-a", account)
+	case "linux":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return fmt.Errorf("secret-tool is not installed")
+		}
+		cmd = exec.Command("secret-tool", "clear", "service", service, "account", account)
+	case "windows":
+		cmd = powershell(passwordVault + fmt.Sprintf("$v.Remove($v.Retrieve(%s, %s))", psQuote(service), psQuote(account)))
+	default:
+		return fmt.Errorf("no supported keychain on %s", runtime.GOOS)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove key from keychain: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// passwordVault opens the Windows password vault as $v.
+const passwordVault = "[void][Windows.Security.Credentials.PasswordVault,Windows.Security.Credentials,ContentType=WindowsRuntime]; $v = New-Object Windows.Security.Credentials.PasswordVault; "
+
+func powershell(script string) *exec.Cmd {
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+}
+
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// securityQuote quotes s as a word of a command for security -i.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// AuthSourceKeychain is the auth_source of models whose API key is kept in
+// the keychain rather than only in their auth_env_var.
+const AuthSourceKeychain = "keychain"
+
+// APIKeyAccount is the keychain account of the API key a model reads from
+// authEnvVar, so that models sharing a variable share the stored key.
+func APIKeyAccount(authEnvVar string) string {
+	return "api-key/" + authEnvVar
+}
+
+// APIKey returns the API key of a model: its auth_env_var when that is
+// set, and otherwise, for models whose auth_source is keychain, the key
+// stored in the keychain. It returns "" when neither has one.
+func APIKey(authEnvVar, authSource string) string {
+	if authEnvVar == "" {
+		return ""
+	}
+	if key := os.Getenv(authEnvVar); key != "" {
+		return key
+	}
+	if authSource == AuthSourceKeychain {
+		return KeychainGet(KeychainService, APIKeyAccount(authEnvVar))
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var processStart = time.Now()
+
+type profileMark struct {
+	name string
+	at   time.Time
+}
+
+// StartupProfiler records named checkpoints relative to process start so
+// --profile-startup can report where time goes before the first prompt.
+type StartupProfiler struct {
+	mu      sync.Mutex
+	Enabled bool
+	marks   []profileMark
+}
+
+var Startup = &StartupProfiler{}
+
+func (p *StartupProfiler) Mark(name string) {
+	if !p.Enabled {
+		return
+	}
+	p.mu.Lock()
+	p.marks = append(p.marks, profileMark{name: name, at: time.Now()})
+	p.mu.Unlock()
+}
+
+func (p *StartupProfiler) Report(w io.Writer) {
+	if !p.Enabled {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintln(w, "Startup profile:")
+	prev := processStart
+	for _, m := range p.marks {
+		fmt.Fprintf(w, "  %-24s +%-10s (%s total)\n", m.name,
+			m.at.Sub(prev).Round(time.Microsecond), m.at.Sub(processStart).Round(time.Microsecond))
+		prev = m.at
+	}
+}